@@ -0,0 +1,30 @@
+// containers-image-ssh-helper serves an image to the ssh transport of github.com/containers/image/v5.
+//
+// The ssh transport runs (containers-image-ssh-helper image-name) on the remote host, and communicates with it
+// over the standard input and output; image-name is in the format of alltransports.ParseImageName.
+// Errors are reported on the standard error, which the ssh transport includes in its error messages.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/containers/image/v5/ssh/server"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s IMAGE-NAME\n", os.Args[0])
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := server.Serve(ctx, nil, os.Args[1], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		stop()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,425 @@
+package containerd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	leasesapi "github.com/containerd/containerd/api/services/leases/v1"
+	apitypes "github.com/containerd/containerd/api/types"
+	"github.com/containers/image/v5/internal/timeouts"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAddress = "/run/containerd/containerd.sock"
+	// namespaceHeader and leaseHeader are the gRPC metadata keys containerd uses to select a namespace and a lease.
+	namespaceHeader = "containerd-namespace"
+	leaseHeader     = "containerd-lease"
+	// leaseExpiration is how long a lease protects content from garbage collection if we fail to delete it.
+	leaseExpiration = 24 * time.Hour
+	// writeChunkSize is the maximum amount of data sent in a single write request;
+	// it must be smaller than the maximum gRPC message size accepted by containerd.
+	writeChunkSize = 1 << 20
+)
+
+// client is a connection to the containerd API, using a single namespace.
+type client struct {
+	conn      *grpc.ClientConn
+	namespace string
+	content   contentapi.ContentClient
+	images    imagesapi.ImagesClient
+	leases    leasesapi.LeasesClient
+}
+
+// newClient connects to the containerd instance configured in sys, for use with namespace.
+func newClient(ctx context.Context, sys *types.SystemContext, namespace string) (*client, error) {
+	address := os.Getenv("CONTAINERD_ADDRESS")
+	if sys != nil && sys.ContainerdAddress != "" {
+		address = sys.ContainerdAddress
+	}
+	if address == "" {
+		address = defaultAddress
+	}
+	target := address
+	if !strings.Contains(target, "://") {
+		target = "unix://" + target
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if sys != nil && sys.ConnectTimeout > 0 {
+		opts = append(opts, grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: sys.ConnectTimeout,
+		}))
+	}
+	if sys != nil && sys.RequestTimeout > 0 {
+		opts = append(opts,
+			grpc.WithUnaryInterceptor(unaryTimeoutInterceptor(sys)),
+			grpc.WithStreamInterceptor(streamTimeoutInterceptor(sys)))
+	}
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to containerd at %s: %w", address, err)
+	}
+	return &client{
+		conn:      conn,
+		namespace: namespace,
+		content:   contentapi.NewContentClient(conn),
+		images:    imagesapi.NewImagesClient(conn),
+		leases:    leasesapi.NewLeasesClient(conn),
+	}, nil
+}
+
+// unaryTimeoutInterceptor returns a grpc.UnaryClientInterceptor which enforces the request timeout configured in sys.
+func unaryTimeoutInterceptor(sys *types.SystemContext) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		watchdog, ctx := timeouts.NewWatchdog(ctx, sys)
+		defer watchdog.Stop()
+		return watchdog.Err(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// streamTimeoutInterceptor returns a grpc.StreamClientInterceptor which enforces the request timeout configured in sys
+// on each message sent or received on a stream.
+func streamTimeoutInterceptor(sys *types.SystemContext) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		watchdog, ctx := timeouts.NewWatchdog(ctx, sys)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			watchdog.Stop()
+			return nil, watchdog.Err(err)
+		}
+		watchdog.Pause()
+		return &watchedStream{ClientStream: stream, watchdog: watchdog}, nil
+	}
+}
+
+// watchedStream is a grpc.ClientStream which activates a timeouts.Watchdog while sending or receiving a message.
+type watchedStream struct {
+	grpc.ClientStream
+	watchdog *timeouts.Watchdog
+}
+
+func (s *watchedStream) SendMsg(m any) error {
+	s.watchdog.Resume()
+	err := s.ClientStream.SendMsg(m)
+	s.watchdog.Pause()
+	if err != nil && err != io.EOF {
+		return s.watchdog.Err(err)
+	}
+	return err
+}
+
+func (s *watchedStream) RecvMsg(m any) error {
+	s.watchdog.Resume()
+	err := s.ClientStream.RecvMsg(m)
+	s.watchdog.Pause()
+	if err != nil {
+		if err == io.EOF { // The stream has finished successfully
+			s.watchdog.Stop()
+			return err
+		}
+		return s.watchdog.Err(err)
+	}
+	return nil
+}
+
+// close closes the connection.
+func (c *client) close() error {
+	return c.conn.Close()
+}
+
+// withNamespace returns ctx with c.namespace attached as gRPC metadata.
+func (c *client) withNamespace(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, namespaceHeader, c.namespace)
+}
+
+// getImage returns the image named name.
+func (c *client) getImage(ctx context.Context, name string) (*imagesapi.Image, error) {
+	res, err := c.images.Get(c.withNamespace(ctx), &imagesapi.GetImageRequest{Name: name})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, fmt.Errorf("image %s not found in containerd namespace %s%.0w", name, c.namespace, types.ErrNotFound)
+		}
+		return nil, fmt.Errorf("reading image %s from containerd: %w", name, err)
+	}
+	if res.Image == nil || res.Image.Target == nil {
+		return nil, fmt.Errorf("containerd returned no target for image %s", name)
+	}
+	return res.Image, nil
+}
+
+// setImage creates, or updates, the image named name to refer to target.
+func (c *client) setImage(ctx context.Context, name string, target imgspecv1.Descriptor) error {
+	image := &imagesapi.Image{
+		Name: name,
+		Target: &apitypes.Descriptor{
+			MediaType:   target.MediaType,
+			Digest:      target.Digest.String(),
+			Size:        target.Size,
+			Annotations: target.Annotations,
+		},
+	}
+	ctx = c.withNamespace(ctx)
+	_, err := c.images.Create(ctx, &imagesapi.CreateImageRequest{Image: image})
+	if status.Code(err) == codes.AlreadyExists {
+		// With no update mask, containerd replaces the target and labels.
+		_, err = c.images.Update(ctx, &imagesapi.UpdateImageRequest{Image: image})
+	}
+	if err != nil {
+		return fmt.Errorf("recording image %s in containerd: %w", name, err)
+	}
+	return nil
+}
+
+// deleteImage deletes the image named name.
+func (c *client) deleteImage(ctx context.Context, name string) error {
+	if _, err := c.images.Delete(c.withNamespace(ctx), &imagesapi.DeleteImageRequest{Name: name}); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return fmt.Errorf("image %s not found in containerd namespace %s%.0w", name, c.namespace, types.ErrNotFound)
+		}
+		return fmt.Errorf("deleting image %s from containerd: %w", name, err)
+	}
+	return nil
+}
+
+// contentSize returns the size of the content with digest, and true, if it exists.
+func (c *client) contentSize(ctx context.Context, digest digest.Digest) (int64, bool, error) {
+	res, err := c.content.Info(c.withNamespace(ctx), &contentapi.InfoRequest{Digest: digest.String()})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return -1, false, nil
+		}
+		return -1, false, fmt.Errorf("looking up %s in containerd: %w", digest, err)
+	}
+	if res.Info == nil {
+		return -1, false, fmt.Errorf("containerd returned no information about %s", digest)
+	}
+	return res.Info.Size, true, nil
+}
+
+// readContent returns a stream with the contents of digest, starting at offset, and size bytes long (or until the end if size == math.MaxUint64).
+func (c *client) readContent(ctx context.Context, digest digest.Digest, offset, size uint64) (io.ReadCloser, error) {
+	req := &contentapi.ReadContentRequest{Digest: digest.String(), Offset: int64(offset)}
+	if size != math.MaxUint64 {
+		if size == 0 { // 0 would mean "until the end" to containerd
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		req.Size = int64(size)
+	}
+	ctx, cancel := context.WithCancel(c.withNamespace(ctx))
+	stream, err := c.content.Read(ctx, req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("reading %s from containerd: %w", digest, err)
+	}
+	return &contentReader{stream: stream, cancel: cancel, digest: digest}, nil
+}
+
+// contentReader is an io.ReadCloser reading content from a containerd Read stream.
+type contentReader struct {
+	stream  contentapi.Content_ReadClient
+	cancel  context.CancelFunc
+	digest  digest.Digest
+	pending []byte
+}
+
+func (r *contentReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		res, err := r.stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			if status.Code(err) == codes.NotFound {
+				return 0, fmt.Errorf("%s not found in containerd%.0w", r.digest, types.ErrNotFound)
+			}
+			return 0, fmt.Errorf("reading %s from containerd: %w", r.digest, err)
+		}
+		r.pending = res.Data
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *contentReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// newLease creates a lease protecting content we add from garbage collection, and returns its ID.
+// The lease expires automatically if we fail to delete it.
+func (c *client) newLease(ctx context.Context) (string, error) {
+	id, err := randomID("containers-image-")
+	if err != nil {
+		return "", err
+	}
+	_, err = c.leases.Create(c.withNamespace(ctx), &leasesapi.CreateRequest{
+		ID: id,
+		Labels: map[string]string{
+			"containerd.io/gc.expire": time.Now().Add(leaseExpiration).UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating a containerd lease: %w", err)
+	}
+	return id, nil
+}
+
+// deleteLease deletes the lease with id.
+func (c *client) deleteLease(ctx context.Context, id string) error {
+	if _, err := c.leases.Delete(c.withNamespace(ctx), &leasesapi.DeleteRequest{ID: id}); err != nil {
+		return fmt.Errorf("deleting containerd lease %s: %w", id, err)
+	}
+	return nil
+}
+
+// addContentToLease adds content with digest to the lease with id.
+func (c *client) addContentToLease(ctx context.Context, id string, digest digest.Digest) error {
+	_, err := c.leases.AddResource(c.withNamespace(ctx), &leasesapi.AddResourceRequest{
+		ID:       id,
+		Resource: &leasesapi.Resource{ID: digest.String(), Type: "content"},
+	})
+	if err != nil {
+		return fmt.Errorf("adding %s to containerd lease %s: %w", digest, id, err)
+	}
+	return nil
+}
+
+// errContentExists is returned by writeContent if the content already exists; the stream is not consumed in that case.
+var errContentExists = errors.New("content already exists")
+
+// writeContent stores the contents of stream, which is size bytes long (or -1 if unknown), in the content store, within the lease with leaseID.
+// If expected is not "", containerd verifies the content matches it; otherwise, the content must be digested using canonical digest,
+// and the resulting digest is returned.
+// labels are set on the committed content.
+func (c *client) writeContent(ctx context.Context, leaseID string, stream io.Reader, size int64, expected digest.Digest, labels map[string]string) (digest.Digest, int64, error) {
+	ref, err := randomID("containers-image-upload-")
+	if err != nil {
+		return "", -1, err
+	}
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(c.withNamespace(ctx), leaseHeader, leaseID))
+	defer cancel()
+	writer, err := c.content.Write(ctx)
+	if err != nil {
+		return "", -1, fmt.Errorf("starting a containerd content upload: %w", err)
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			// Use a separate context so that the abort happens even if ctx was cancelled.
+			abortCtx := metadata.AppendToOutgoingContext(c.withNamespace(context.Background()), leaseHeader, leaseID)
+			if _, err := c.content.Abort(abortCtx, &contentapi.AbortRequest{Ref: ref}); err != nil && status.Code(err) != codes.NotFound {
+				logrus.Debugf("Error aborting containerd upload %s: %v", ref, err)
+			}
+		}
+	}()
+	send := func(req *contentapi.WriteContentRequest) (*contentapi.WriteContentResponse, error) {
+		req.Ref = ref
+		if err := writer.Send(req); err != nil {
+			if err == io.EOF { // The server has closed the stream; the error is reported by Recv.
+				_, err = writer.Recv()
+			}
+			return nil, err
+		}
+		return writer.Recv()
+	}
+
+	statReq := &contentapi.WriteContentRequest{Action: contentapi.WriteAction_STAT, Expected: expected.String()}
+	if size != -1 {
+		statReq.Total = size
+	}
+	if _, err := send(statReq); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			succeeded = true // Nothing to abort
+			return expected, size, errContentExists
+		}
+		return "", -1, fmt.Errorf("starting a containerd content upload: %w", err)
+	}
+
+	digester := digest.Canonical.Digester()
+	if expected == "" {
+		stream = io.TeeReader(stream, digester.Hash())
+	}
+	buf := make([]byte, writeChunkSize)
+	offset := int64(0)
+	for {
+		n, err := io.ReadFull(stream, buf)
+		if n > 0 {
+			res, err := send(&contentapi.WriteContentRequest{Action: contentapi.WriteAction_WRITE, Offset: offset, Data: buf[:n]})
+			if err != nil {
+				return "", -1, fmt.Errorf("writing to containerd: %w", err)
+			}
+			if res.Offset != offset+int64(n) {
+				return "", -1, fmt.Errorf("unexpected containerd upload offset %d, expected %d", res.Offset, offset+int64(n))
+			}
+			offset = res.Offset
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", -1, err
+		}
+	}
+	if size != -1 && offset != size {
+		return "", -1, fmt.Errorf("size mismatch when writing to containerd, expected %d, got %d", size, offset)
+	}
+	if expected == "" {
+		expected = digester.Digest()
+	}
+
+	res, err := send(&contentapi.WriteContentRequest{
+		Action:   contentapi.WriteAction_COMMIT,
+		Total:    offset,
+		Offset:   offset,
+		Expected: expected.String(),
+		Labels:   labels,
+	})
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists { // Someone else has stored the same content concurrently.
+			succeeded = true
+			if err := c.addContentToLease(ctx, leaseID, expected); err != nil {
+				return "", -1, err
+			}
+			return expected, offset, nil
+		}
+		return "", -1, fmt.Errorf("committing content to containerd: %w", err)
+	}
+	if res.Digest != "" && res.Digest != expected.String() {
+		return "", -1, fmt.Errorf("containerd committed content with digest %s, expected %s", res.Digest, expected)
+	}
+	succeeded = true
+	if err := writer.CloseSend(); err != nil {
+		logrus.Debugf("Error closing containerd upload %s: %v", ref, err)
+	}
+	return expected, offset, nil
+}
+
+// randomID returns prefix followed by a random string.
+func randomID(prefix string) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,344 @@
+package containerd
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	leasesapi "github.com/containerd/containerd/api/services/leases/v1"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fakeContainerd is a minimal in-memory implementation of the parts of the containerd API used by this transport.
+// The services have methods with the same names, so they are implemented by separate types sharing this state.
+type fakeContainerd struct {
+	mu      sync.Mutex
+	content map[string][]byte            // "namespace/digest" -> data
+	labels  map[string]map[string]string // "namespace/digest" -> labels
+	images  map[string]*imagesapi.Image  // "namespace/name" -> image
+	leases  map[string]map[string]bool   // "namespace/lease" -> set of digests
+	aborts  int
+}
+
+// newFakeContainerd starts a fakeContainerd, and returns it and a SystemContext connecting to it.
+func newFakeContainerd(t *testing.T) (*fakeContainerd, *types.SystemContext) {
+	// Use a short path, the length of UNIX socket paths is limited.
+	dir, err := os.MkdirTemp("", "ctrd")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "containerd.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	f := &fakeContainerd{
+		content: map[string][]byte{},
+		labels:  map[string]map[string]string{},
+		images:  map[string]*imagesapi.Image{},
+		leases:  map[string]map[string]bool{},
+	}
+	server := grpc.NewServer()
+	contentapi.RegisterContentServer(server, fakeContent{f: f})
+	imagesapi.RegisterImagesServer(server, fakeImages{f: f})
+	leasesapi.RegisterLeasesServer(server, fakeLeases{f: f})
+	go func() {
+		_ = server.Serve(l)
+	}()
+	t.Cleanup(server.Stop)
+	return f, &types.SystemContext{ContainerdAddress: socket}
+}
+
+// requestNamespace returns the containerd namespace of the request in ctx.
+func requestNamespace(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ns := md.Get(namespaceHeader)
+	if len(ns) != 1 {
+		return "", status.Error(codes.FailedPrecondition, "namespace is required")
+	}
+	return ns[0], nil
+}
+
+// addContent adds data to the content store in namespace, and returns its digest.
+func (f *fakeContainerd) addContent(namespace string, data []byte) digest.Digest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := digest.FromBytes(data)
+	f.content[namespace+"/"+d.String()] = data
+	return d
+}
+
+func (c fakeContent) Info(ctx context.Context, req *contentapi.InfoRequest) (*contentapi.InfoResponse, error) {
+	f := c.f
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.content[ns+"/"+req.Digest]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "content %s not found", req.Digest)
+	}
+	return &contentapi.InfoResponse{Info: &contentapi.Info{Digest: req.Digest, Size: int64(len(data))}}, nil
+}
+
+func (c fakeContent) Read(req *contentapi.ReadContentRequest, srv contentapi.Content_ReadServer) error {
+	f := c.f
+	ns, err := requestNamespace(srv.Context())
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	data, ok := f.content[ns+"/"+req.Digest]
+	f.mu.Unlock()
+	if !ok {
+		return status.Errorf(codes.NotFound, "content %s not found", req.Digest)
+	}
+	if req.Offset > int64(len(data)) {
+		return status.Error(codes.OutOfRange, "offset out of range")
+	}
+	data = data[req.Offset:]
+	if req.Size > 0 && req.Size < int64(len(data)) {
+		data = data[:req.Size]
+	}
+	// Use small messages to exercise the reassembly in the client.
+	for len(data) > 0 {
+		n := min(len(data), 3)
+		if err := srv.Send(&contentapi.ReadContentResponse{Data: data[:n]}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (c fakeContent) Write(srv contentapi.Content_WriteServer) error {
+	f := c.f
+	ns, err := requestNamespace(srv.Context())
+	if err != nil {
+		return err
+	}
+	md, _ := metadata.FromIncomingContext(srv.Context())
+	leases := md.Get(leaseHeader)
+	data := []byte{}
+	for {
+		req, err := srv.Recv()
+		if err != nil {
+			return err
+		}
+		switch req.Action {
+		case contentapi.WriteAction_STAT:
+			if req.Expected != "" {
+				f.mu.Lock()
+				_, exists := f.content[ns+"/"+req.Expected]
+				f.mu.Unlock()
+				if exists {
+					return status.Errorf(codes.AlreadyExists, "content %s exists", req.Expected)
+				}
+			}
+		case contentapi.WriteAction_WRITE:
+			if req.Offset != int64(len(data)) {
+				return status.Error(codes.InvalidArgument, "unexpected offset")
+			}
+			data = append(data, req.Data...)
+		case contentapi.WriteAction_COMMIT:
+			d := digest.FromBytes(data)
+			if req.Expected != "" && req.Expected != d.String() {
+				return status.Errorf(codes.FailedPrecondition, "unexpected commit digest %s, expected %s", d, req.Expected)
+			}
+			if req.Total != int64(len(data)) {
+				return status.Error(codes.FailedPrecondition, "unexpected size")
+			}
+			f.mu.Lock()
+			f.content[ns+"/"+d.String()] = data
+			f.labels[ns+"/"+d.String()] = req.Labels
+			if len(leases) == 1 {
+				if lease, ok := f.leases[ns+"/"+leases[0]]; ok {
+					lease[d.String()] = true
+				}
+			}
+			f.mu.Unlock()
+		}
+		if err := srv.Send(&contentapi.WriteContentResponse{Action: req.Action, Offset: int64(len(data)), Digest: digest.FromBytes(data).String()}); err != nil {
+			return err
+		}
+	}
+}
+
+func (c fakeContent) Abort(ctx context.Context, req *contentapi.AbortRequest) (*emptypb.Empty, error) {
+	f := c.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborts++
+	return &emptypb.Empty{}, nil
+}
+
+func (i fakeImages) Get(ctx context.Context, req *imagesapi.GetImageRequest) (*imagesapi.GetImageResponse, error) {
+	f := i.f
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	image, ok := f.images[ns+"/"+req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "image %s not found", req.Name)
+	}
+	return &imagesapi.GetImageResponse{Image: image}, nil
+}
+
+func (i fakeImages) Create(ctx context.Context, req *imagesapi.CreateImageRequest) (*imagesapi.CreateImageResponse, error) {
+	f := i.f
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.images[ns+"/"+req.Image.Name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "image %s exists", req.Image.Name)
+	}
+	f.images[ns+"/"+req.Image.Name] = req.Image
+	return &imagesapi.CreateImageResponse{Image: req.Image}, nil
+}
+
+func (i fakeImages) Update(ctx context.Context, req *imagesapi.UpdateImageRequest) (*imagesapi.UpdateImageResponse, error) {
+	f := i.f
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.images[ns+"/"+req.Image.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "image %s not found", req.Image.Name)
+	}
+	f.images[ns+"/"+req.Image.Name] = req.Image
+	return &imagesapi.UpdateImageResponse{Image: req.Image}, nil
+}
+
+func (i fakeImages) Delete(ctx context.Context, req *imagesapi.DeleteImageRequest) (*emptypb.Empty, error) {
+	f := i.f
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.images[ns+"/"+req.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "image %s not found", req.Name)
+	}
+	delete(f.images, ns+"/"+req.Name)
+	return &emptypb.Empty{}, nil
+}
+
+type fakeContent struct {
+	contentapi.UnimplementedContentServer
+	f *fakeContainerd
+}
+
+type fakeImages struct {
+	imagesapi.UnimplementedImagesServer
+	f *fakeContainerd
+}
+
+type fakeLeases struct {
+	leasesapi.UnimplementedLeasesServer
+	f *fakeContainerd
+}
+
+func (l fakeLeases) Create(ctx context.Context, req *leasesapi.CreateRequest) (*leasesapi.CreateResponse, error) {
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Labels["containerd.io/gc.expire"] == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing expiration")
+	}
+	l.f.mu.Lock()
+	defer l.f.mu.Unlock()
+	l.f.leases[ns+"/"+req.ID] = map[string]bool{}
+	return &leasesapi.CreateResponse{Lease: &leasesapi.Lease{ID: req.ID, Labels: req.Labels}}, nil
+}
+
+func (l fakeLeases) Delete(ctx context.Context, req *leasesapi.DeleteRequest) (*emptypb.Empty, error) {
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.f.mu.Lock()
+	defer l.f.mu.Unlock()
+	delete(l.f.leases, ns+"/"+req.ID)
+	return &emptypb.Empty{}, nil
+}
+
+func (l fakeLeases) AddResource(ctx context.Context, req *leasesapi.AddResourceRequest) (*emptypb.Empty, error) {
+	ns, err := requestNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.f.mu.Lock()
+	defer l.f.mu.Unlock()
+	lease, ok := l.f.leases[ns+"/"+req.ID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "lease %s not found", req.ID)
+	}
+	lease[req.Resource.ID] = true
+	return &emptypb.Empty{}, nil
+}
+
+func TestClientReadContent(t *testing.T) {
+	f, sys := newFakeContainerd(t)
+	d := f.addContent("ns", []byte("0123456789"))
+	ctx := context.Background()
+	c, err := newClient(ctx, sys, "ns")
+	require.NoError(t, err)
+	defer c.close()
+
+	for _, tc := range []struct {
+		offset, size uint64
+		expected     string
+	}{
+		{0, 10, "0123456789"},
+		{2, 5, "23456"},
+		{7, 0, ""},
+	} {
+		stream, err := c.readContent(ctx, d, tc.offset, tc.size)
+		require.NoError(t, err)
+		data, err := io.ReadAll(stream)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, string(data))
+		stream.Close()
+	}
+
+	size, exists, err := c.contentSize(ctx, d)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, int64(10), size)
+
+	// Content is not visible from other namespaces.
+	c2, err := newClient(ctx, sys, "other")
+	require.NoError(t, err)
+	defer c2.close()
+	_, exists, err = c2.contentSize(ctx, d)
+	require.NoError(t, err)
+	require.False(t, exists)
+	stream, err := c2.readContent(ctx, d, 0, 10)
+	require.NoError(t, err)
+	_, err = io.ReadAll(stream)
+	require.Error(t, err)
+	stream.Close()
+}
@@ -0,0 +1,211 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+type containerdImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.NoSignaturesInitialize
+
+	ref     containerdReference
+	client  *client
+	leaseID string // Protects content we store, or reuse, from garbage collection until the image is committed.
+	// Set by PutManifest with instanceDigest == nil
+	target *imgspecv1.Descriptor
+}
+
+// newImageDestination returns an ImageDestination for writing an image to containerd.
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref containerdReference) (private.ImageDestination, error) {
+	c, err := newClient(ctx, sys, ref.namespace)
+	if err != nil {
+		return nil, err
+	}
+	leaseID, err := c.newLease(ctx)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	d := &containerdImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes: []string{
+				imgspecv1.MediaTypeImageManifest,
+				imgspecv1.MediaTypeImageIndex,
+				manifest.DockerV2Schema2MediaType,
+				manifest.DockerV2ListMediaType,
+			},
+			DesiredLayerCompression:        types.PreserveOriginal,
+			AcceptsForeignLayerURLs:        false,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, we don’t accept schema1 manifests.
+			HasThreadSafePutBlob:           true,
+			AcceptsNonImageArtifacts:       true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+		NoSignaturesInitialize:     stubs.NoSignatures("Pushing signatures to containerd is not supported"),
+
+		ref:     ref,
+		client:  c,
+		leaseID: leaseID,
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *containerdImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *containerdImageDestination) Close() error {
+	// Content not referenced by a committed image becomes eligible for garbage collection.
+	if err := d.client.deleteLease(context.Background(), d.leaseID); err != nil {
+		logrus.Debugf("%v", err)
+	}
+	return d.client.close()
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *containerdImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	blobDigest, size, err := d.client.writeContent(ctx, d.leaseID, stream, inputInfo.Size, inputInfo.Digest, nil)
+	if errors.Is(err, errContentExists) {
+		// Another writer has stored the blob since TryReusingBlob; consume the stream, which verifies that it matches.
+		size, err = io.Copy(io.Discard, stream)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		err = d.client.addContentToLease(ctx, d.leaseID, blobDigest)
+	}
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	return private.UploadedBlob{Digest: blobDigest, Size: size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *containerdImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalCandidateMatchesTryReusingBlobOptions(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	size, exists, err := d.client.contentSize(ctx, info.Digest)
+	if err != nil || !exists {
+		return false, private.ReusedBlob{}, err
+	}
+	if err := d.client.addContentToLease(ctx, d.leaseID, info.Digest); err != nil {
+		return false, private.ReusedBlob{}, err
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: size}, nil
+}
+
+// PutManifest writes a manifest to the destination.  Per our list of supported manifest MIME types,
+// this should be an OCI or Docker schema2 manifest (possibly converted to this format by the caller) or list,
+// none of which we'll need to modify further.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to overwrite the manifest for (when
+// the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *containerdImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	var manifestDigest digest.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	} else {
+		dig, err := manifest.Digest(m)
+		if err != nil {
+			return err
+		}
+		manifestDigest = dig
+	}
+	mimeType := manifest.GuessMIMEType(m)
+	labels, err := gcReferenceLabels(m, mimeType)
+	if err != nil {
+		return err
+	}
+	_, _, err = d.client.writeContent(ctx, d.leaseID, bytes.NewReader(m), int64(len(m)), manifestDigest, labels)
+	if errors.Is(err, errContentExists) {
+		err = d.client.addContentToLease(ctx, d.leaseID, manifestDigest)
+	}
+	if err != nil {
+		return err
+	}
+
+	if instanceDigest == nil {
+		d.target = &imgspecv1.Descriptor{
+			MediaType: mimeType,
+			Digest:    manifestDigest,
+			Size:      int64(len(m)),
+		}
+	}
+	return nil
+}
+
+// gcReferenceLabels returns containerd labels which make the garbage collector retain content referenced by manifest m.
+func gcReferenceLabels(m []byte, mimeType string) (map[string]string, error) {
+	labels := map[string]string{}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		list, err := manifest.ListFromBlob(m, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		for i, instance := range list.Instances() {
+			labels[fmt.Sprintf("containerd.io/gc.ref.content.m.%d", i)] = instance.String()
+		}
+		return labels, nil
+	}
+	parsed, err := manifest.FromBlob(m, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	labels["containerd.io/gc.ref.content.config"] = parsed.ConfigInfo().Digest.String()
+	for i, layer := range parsed.LayerInfos() {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.l.%d", i)] = layer.Digest.String()
+	}
+	return labels, nil
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *containerdImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	if d.target == nil {
+		return errors.New("internal error: Commit called before PutManifest")
+	}
+	return d.client.setImage(ctx, d.ref.ref.String(), *d.target)
+}
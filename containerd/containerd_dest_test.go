@@ -0,0 +1,172 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestImage writes a single-layer image to ref, and returns its manifest, config and layer.
+func writeTestImage(t *testing.T, f *fakeContainerd, sys *types.SystemContext, ref types.ImageReference) ([]byte, []byte, []byte) {
+	ctx := context.Background()
+	cache := memory.New()
+	dest, err := ref.NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("this is not really a layer")
+	configInfo, err := dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Size: -1}, cache, true)
+	require.NoError(t, err)
+	layerInfo, err := dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: digest.FromBytes(layer), Size: int64(len(layer))}, cache, false)
+	require.NoError(t, err)
+
+	m, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configInfo.Digest, Size: configInfo.Size},
+		Layers:    []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageLayer, Digest: layerInfo.Digest, Size: layerInfo.Size}},
+	})
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, m, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+	return m, config, layer
+}
+
+func TestDestinationRoundTrip(t *testing.T) {
+	f, sys := newFakeContainerd(t)
+	ctx := context.Background()
+	ref, err := ParseReference("[k8s.io]example.com/ns/foo:bar")
+	require.NoError(t, err)
+
+	m, config, layer := writeTestImage(t, f, sys, ref)
+	manifestDigest := digest.FromBytes(m)
+
+	f.mu.Lock()
+	image, ok := f.images["k8s.io/example.com/ns/foo:bar"]
+	require.True(t, ok)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, image.Target.MediaType)
+	assert.Equal(t, manifestDigest.String(), image.Target.Digest)
+	assert.Equal(t, int64(len(m)), image.Target.Size)
+	assert.Equal(t, map[string]string{
+		"containerd.io/gc.ref.content.config": digest.FromBytes(config).String(),
+		"containerd.io/gc.ref.content.l.0":    digest.FromBytes(layer).String(),
+	}, f.labels["k8s.io/"+manifestDigest.String()])
+	assert.Empty(t, f.leases) // The lease has been deleted by Close
+	_, ok = f.content["default/"+manifestDigest.String()]
+	assert.False(t, ok)
+	f.mu.Unlock()
+
+	src, err := ref.NewImageSource(ctx, sys)
+	require.NoError(t, err)
+	defer src.Close()
+	m2, mimeType, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, m, m2)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+	m2, mimeType, err = src.GetManifest(ctx, &manifestDigest)
+	require.NoError(t, err)
+	assert.Equal(t, m, m2)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+
+	for _, blob := range [][]byte{config, layer} {
+		stream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(blob), Size: -1}, memory.New())
+		require.NoError(t, err)
+		data, err := io.ReadAll(stream)
+		require.NoError(t, err)
+		stream.Close()
+		assert.Equal(t, blob, data)
+		assert.Equal(t, int64(len(blob)), size)
+	}
+	_, _, err = src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromString("missing"), Size: -1}, memory.New())
+	assert.Error(t, err)
+
+	// Overwriting the image updates the existing record.
+	writeTestImage(t, f, sys, ref)
+	f.mu.Lock()
+	assert.Len(t, f.images, 1)
+	f.mu.Unlock()
+}
+
+func TestDestinationPutBlobFailure(t *testing.T) {
+	f, sys := newFakeContainerd(t)
+	ctx := context.Background()
+	ref, err := ParseReference("busybox")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	readerErr := errors.New("mock read error")
+	_, err = dest.PutBlob(ctx, io.MultiReader(bytes.NewReader([]byte("partial")), iotestErrReader{readerErr}), types.BlobInfo{Size: -1}, memory.New(), false)
+	assert.ErrorIs(t, err, readerErr)
+	f.mu.Lock()
+	assert.Empty(t, f.content)
+	assert.Equal(t, 1, f.aborts)
+	f.mu.Unlock()
+
+	// A digest mismatch fails as well.
+	_, err = dest.PutBlob(ctx, bytes.NewReader([]byte("data")), types.BlobInfo{Digest: digest.FromString("other"), Size: -1}, memory.New(), false)
+	assert.Error(t, err)
+	f.mu.Lock()
+	assert.Empty(t, f.content)
+	f.mu.Unlock()
+}
+
+// iotestErrReader is an io.Reader which always fails with err.
+type iotestErrReader struct{ err error }
+
+func (r iotestErrReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestDestinationReuseBlob(t *testing.T) {
+	f, sys := newFakeContainerd(t)
+	ctx := context.Background()
+	blob := []byte("existing blob")
+	blobDigest := f.addContent("default", blob)
+	f.addContent("other", []byte("elsewhere"))
+
+	ref, err := ParseReference("busybox")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	reused, info, err := dest.TryReusingBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, memory.New(), false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, blobDigest, info.Digest)
+	assert.Equal(t, int64(len(blob)), info.Size)
+
+	reused, _, err = dest.TryReusingBlob(ctx, types.BlobInfo{Digest: digest.FromString("elsewhere"), Size: -1}, memory.New(), false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	// Uploading existing content succeeds without writing it.
+	uploaded, err := dest.PutBlob(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: blobDigest, Size: -1}, memory.New(), false)
+	require.NoError(t, err)
+	assert.Equal(t, blobDigest, uploaded.Digest)
+	assert.Equal(t, int64(len(blob)), uploaded.Size)
+
+	f.mu.Lock()
+	leases := f.leases
+	require.Len(t, leases, 1)
+	for _, lease := range leases {
+		assert.Equal(t, map[string]bool{blobDigest.String(): true}, lease)
+	}
+	f.mu.Unlock()
+}
@@ -0,0 +1,159 @@
+package containerd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+type containerdImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.NoSignatures
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.ImplementsGetBlobAt
+
+	ref             containerdReference
+	client          *client
+	maxManifestSize int
+	manifestDigest  digest.Digest
+	mimeType        string
+}
+
+// newImageSource returns an ImageSource for reading an image from containerd.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref containerdReference) (private.ImageSource, error) {
+	c, err := newClient(ctx, sys, ref.namespace)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			c.close()
+		}
+	}()
+	image, err := c.getImage(ctx, ref.ref.String())
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := digest.Parse(image.Target.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target digest of containerd image %s: %w", ref.ref.String(), err)
+	}
+
+	s := &containerdImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+
+		ref:             ref,
+		client:          c,
+		maxManifestSize: iolimits.MaxManifestBodySizeFor(sys),
+		manifestDigest:  manifestDigest,
+		mimeType:        image.Target.MediaType,
+	}
+	s.Compat = impl.AddCompat(s)
+	succeeded = true
+	return s, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *containerdImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *containerdImageSource) Close() error {
+	return s.client.close()
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *containerdImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	dig := s.manifestDigest
+	mimeType := s.mimeType
+	if instanceDigest != nil {
+		dig = *instanceDigest
+		mimeType = ""
+	}
+	stream, err := s.client.readContent(ctx, dig, 0, math.MaxUint64)
+	if err != nil {
+		return nil, "", err
+	}
+	defer stream.Close()
+	m, err := iolimits.ReadAtMost(stream, s.maxManifestSize)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			err = errcategory.Wrap(err, types.ErrManifestUnknown)
+		}
+		return nil, "", err
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *containerdImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	size, exists, err := s.client.contentSize(ctx, info.Digest)
+	if err != nil {
+		return nil, -1, err
+	}
+	if !exists {
+		return nil, -1, fmt.Errorf("blob %s not found in containerd%.0w", info.Digest, types.ErrBlobUnknown)
+	}
+	stream, err := s.client.readContent(ctx, info.Digest, 0, math.MaxUint64)
+	if err != nil {
+		return nil, -1, err
+	}
+	return stream, size, nil
+}
+
+// GetBlobAt returns a sequential channel of readers that contain data for the requested
+// blob chunks, and a channel that might get a single error value.
+// The specified chunks must be not overlapping and sorted by their offset.
+// The readers must be fully consumed, in the order they are returned, before blocking
+// to read the next chunk.
+// If the Length for the last chunk is set to math.MaxUint64, then it
+// fully fetches the remaining data from the offset to the end of the blob.
+func (s *containerdImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+	if len(chunks) == 0 {
+		return nil, nil, errors.New("internal error: GetBlobAt called with no chunks")
+	}
+	for i, c := range chunks {
+		if c.Length == math.MaxUint64 && i != len(chunks)-1 {
+			return nil, nil, fmt.Errorf("internal error: another chunk requested after an util-EOF chunk")
+		}
+	}
+	streams := make(chan io.ReadCloser)
+	errs := make(chan error)
+	go func() {
+		defer close(streams)
+		defer close(errs)
+		for _, c := range chunks {
+			stream, err := s.client.readContent(ctx, info.Digest, c.Offset, c.Length)
+			if err != nil {
+				errs <- err
+				return
+			}
+			streams <- stream
+		}
+	}()
+	return streams, errs, nil
+}
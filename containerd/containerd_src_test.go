@@ -0,0 +1,56 @@
+package containerd
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceGetBlobAt(t *testing.T) {
+	f, sys := newFakeContainerd(t)
+	ctx := context.Background()
+	ref, err := ParseReference("busybox")
+	require.NoError(t, err)
+	_, _, layer := writeTestImage(t, f, sys, ref)
+	layerInfo := types.BlobInfo{Digest: digest.FromBytes(layer), Size: int64(len(layer))}
+
+	src, err := ref.NewImageSource(ctx, sys)
+	require.NoError(t, err)
+	defer src.Close()
+	privateSrc := imagesource.FromPublic(src)
+	require.True(t, privateSrc.SupportsGetBlobAt())
+
+	streams, errs, err := privateSrc.GetBlobAt(ctx, layerInfo, []private.ImageSourceChunk{
+		{Offset: 0, Length: 4},
+		{Offset: 5, Length: 2},
+		{Offset: 12, Length: math.MaxUint64},
+	})
+	require.NoError(t, err)
+	res := []string{}
+	for stream := range streams {
+		data, err := io.ReadAll(stream)
+		require.NoError(t, err)
+		stream.Close()
+		res = append(res, string(data))
+	}
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{string(layer[0:4]), string(layer[5:7]), string(layer[12:])}, res)
+}
+
+func TestSourceMissingImage(t *testing.T) {
+	_, sys := newFakeContainerd(t)
+	ref, err := ParseReference("busybox")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(context.Background(), sys)
+	assert.Error(t, err)
+}
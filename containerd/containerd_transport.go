@@ -0,0 +1,203 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker/policyconfiguration"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/regexp"
+)
+
+func init() {
+	transports.Register(Transport)
+}
+
+// Transport is an ImageTransport for images stored in containerd.
+var Transport = containerdTransport{}
+
+type containerdTransport struct{}
+
+// DefaultNamespace is the containerd namespace used if the reference does not specify one.
+const DefaultNamespace = "default"
+
+// namespaceRegexp matches valid containerd namespace names.
+var namespaceRegexp = regexp.Delayed(`^[A-Za-z0-9]+(?:[._-][A-Za-z0-9]+)*$`)
+
+// maxNamespaceLength is the maximum length of a containerd namespace name.
+const maxNamespaceLength = 76
+
+func (t containerdTransport) Name() string {
+	return "containerd"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t containerdTransport) ParseReference(reference string) (types.ImageReference, error) {
+	return ParseReference(reference)
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t containerdTransport) ValidatePolicyConfigurationScope(scope string) error {
+	namespace, _, err := splitNamespace(scope)
+	if err != nil {
+		return err
+	}
+	if namespace == "" {
+		return fmt.Errorf("Invalid scope %s: must start with a [namespace] prefix", scope)
+	}
+	// FIXME? We could be verifying the various character set and length restrictions
+	// from docker/distribution/reference.regexp.go, but other than that there
+	// are few semantically invalid strings.
+	return nil
+}
+
+// containerdReference is an ImageReference for images stored in containerd.
+type containerdReference struct {
+	namespace string
+	ref       reference.Named // By construction we know that !reference.IsNameOnly(ref)
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into a containerd ImageReference.
+// The expected format is [[namespace]]docker-reference.
+func ParseReference(refString string) (types.ImageReference, error) {
+	namespace, refString, err := splitNamespace(refString)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	ref, err := reference.ParseNormalizedNamed(refString)
+	if err != nil {
+		return nil, err
+	}
+	return NewReference(namespace, reference.TagNameOnly(ref))
+}
+
+// NewReference returns a containerd reference for ref in namespace.
+func NewReference(namespace string, ref reference.Named) (types.ImageReference, error) {
+	if err := validateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if reference.IsNameOnly(ref) {
+		return nil, fmt.Errorf("containerd: reference %s has neither a tag nor a digest", reference.FamiliarString(ref))
+	}
+	// A github.com/distribution/reference value can have a tag and a digest at the same time!
+	// The policy identity of such a reference would be ambiguous, so reject such input, like the other transports do.
+	_, isTagged := ref.(reference.NamedTagged)
+	_, isDigested := ref.(reference.Canonical)
+	if isTagged && isDigested {
+		return nil, fmt.Errorf("containerd: references with both a tag and digest are currently not supported")
+	}
+	return containerdReference{namespace: namespace, ref: ref}, nil
+}
+
+// splitNamespace splits an optional "[namespace]" prefix from s, and returns the namespace ("" if not present) and the rest of s.
+func splitNamespace(s string) (string, string, error) {
+	rest, ok := strings.CutPrefix(s, "[")
+	if !ok {
+		return "", s, nil
+	}
+	namespace, rest, ok := strings.Cut(rest, "]")
+	if !ok {
+		return "", "", fmt.Errorf("containerd: missing ] in %q", s)
+	}
+	if err := validateNamespace(namespace); err != nil {
+		return "", "", err
+	}
+	return namespace, rest, nil
+}
+
+// validateNamespace returns an error if namespace is not a valid containerd namespace name.
+func validateNamespace(namespace string) error {
+	if len(namespace) > maxNamespaceLength || !namespaceRegexp.MatchString(namespace) {
+		return fmt.Errorf("containerd: invalid namespace %q", namespace)
+	}
+	return nil
+}
+
+func (ref containerdReference) Transport() types.ImageTransport {
+	return Transport
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref containerdReference) StringWithinTransport() string {
+	return "[" + ref.namespace + "]" + ref.ref.String()
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref containerdReference) DockerReference() reference.Named {
+	return ref.ref
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref containerdReference) PolicyConfigurationIdentity() string {
+	res, err := policyconfiguration.DockerReferenceIdentity(ref.ref)
+	if res == "" || err != nil { // Coverage: Should never happen, NewReference above should refuse values which could cause a failure.
+		panic(fmt.Sprintf("Internal inconsistency: policyconfiguration.DockerReferenceIdentity returned %#v, %v", res, err))
+	}
+	return "[" + ref.namespace + "]" + res
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref containerdReference) PolicyConfigurationNamespaces() []string {
+	res := []string{}
+	for _, ns := range policyconfiguration.DockerReferenceNamespaces(ref.ref) {
+		res = append(res, "["+ref.namespace+"]"+ns)
+	}
+	return append(res, "["+ref.namespace+"]")
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref containerdReference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref containerdReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref containerdReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return newImageDestination(ctx, sys, ref)
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref containerdReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	c, err := newClient(ctx, sys, ref.namespace)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	return c.deleteImage(ctx, ref.ref.String())
+}
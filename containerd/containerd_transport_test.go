@@ -0,0 +1,145 @@
+package containerd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sha256digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "containerd", Transport.Name())
+}
+
+func TestTransportParseReference(t *testing.T) {
+	for _, c := range []struct{ input, namespace, ref string }{
+		{"busybox", "default", "docker.io/library/busybox:latest"},
+		{"busybox:notlatest", "default", "docker.io/library/busybox:notlatest"},
+		{"[k8s.io]busybox", "k8s.io", "docker.io/library/busybox:latest"},
+		{"[k8s.io]example.com/ns/foo@" + sha256digest, "k8s.io", "example.com/ns/foo@" + sha256digest},
+		{"[my_ns-1]example.com:5000/foo:bar", "my_ns-1", "example.com:5000/foo:bar"},
+	} {
+		ref, err := Transport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		cRef, ok := ref.(containerdReference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.namespace, cRef.namespace, c.input)
+		assert.Equal(t, c.ref, cRef.ref.String(), c.input)
+	}
+
+	for _, input := range []string{
+		"",
+		"UPPERCASEISINVALID",
+		"[]busybox",
+		"[k8s.io",
+		"[.invalid]busybox",
+		"[in/valid]busybox",
+		"[" + strings.Repeat("a", maxNamespaceLength+1) + "]busybox",
+		"[k8s.io]",
+		"busybox:latest@" + sha256digest,
+	} {
+		_, err := Transport.ParseReference(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"[default]docker.io/library/busybox:latest",
+		"[k8s.io]example.com/ns/foo",
+		"[k8s.io]example.com",
+		"[k8s.io]",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"example.com/ns/foo",
+		"[]example.com",
+		"[in/valid]example.com",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestNewReference(t *testing.T) {
+	named, err := reference.ParseNormalizedNamed("busybox:notlatest")
+	require.NoError(t, err)
+	ref, err := NewReference("k8s.io", named)
+	require.NoError(t, err)
+	cRef, ok := ref.(containerdReference)
+	require.True(t, ok)
+	assert.Equal(t, "k8s.io", cRef.namespace)
+	assert.Equal(t, named, cRef.ref)
+
+	_, err = NewReference("in/valid", named)
+	assert.Error(t, err)
+
+	nameOnly, err := reference.ParseNormalizedNamed("busybox")
+	require.NoError(t, err)
+	_, err = NewReference("k8s.io", nameOnly)
+	assert.Error(t, err)
+}
+
+func TestReferenceStringWithinTransport(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{"busybox", "[default]docker.io/library/busybox:latest"},
+		{"[k8s.io]example.com/ns/foo:bar", "[k8s.io]example.com/ns/foo:bar"},
+	} {
+		ref, err := Transport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		stringRef := ref.StringWithinTransport()
+		assert.Equal(t, c.expected, stringRef, c.input)
+		// Do one more round to verify that the output can be parsed, to an equal value.
+		ref2, err := Transport.ParseReference(stringRef)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, ref, ref2, c.input)
+	}
+}
+
+func TestReferenceDockerReference(t *testing.T) {
+	ref, err := ParseReference("[k8s.io]busybox")
+	require.NoError(t, err)
+	dockerRef := ref.DockerReference()
+	require.NotNil(t, dockerRef)
+	assert.Equal(t, "docker.io/library/busybox:latest", dockerRef.String())
+}
+
+func TestReferencePolicyConfiguration(t *testing.T) {
+	ref, err := ParseReference("[k8s.io]example.com/ns/foo:bar")
+	require.NoError(t, err)
+	assert.Equal(t, "[k8s.io]example.com/ns/foo:bar", ref.PolicyConfigurationIdentity())
+	ns := ref.PolicyConfigurationNamespaces()
+	assert.Equal(t, []string{
+		"[k8s.io]example.com/ns/foo",
+		"[k8s.io]example.com/ns",
+		"[k8s.io]example.com",
+		"[k8s.io]*.com",
+		"[k8s.io]",
+	}, ns)
+	for _, n := range ns {
+		assert.NoError(t, Transport.ValidatePolicyConfigurationScope(n), n)
+	}
+}
+
+func TestReferenceDeleteImage(t *testing.T) {
+	f, sys := newFakeContainerd(t)
+	ref, err := ParseReference("[k8s.io]busybox")
+	require.NoError(t, err)
+
+	err = ref.DeleteImage(context.Background(), sys)
+	assert.Error(t, err)
+
+	writeTestImage(t, f, sys, ref)
+	err = ref.DeleteImage(context.Background(), sys)
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(context.Background(), sys)
+	assert.Error(t, err)
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/tracing"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
 	"github.com/sirupsen/logrus"
@@ -42,6 +43,13 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	// === Update progress bars
 	stream.reader = bar.ProxyReader(stream.reader)
 
+	// === Report progress events, if required.
+	var eventReader *progressEventReader
+	if ic.c.options.ProgressCallback != nil {
+		eventReader = ic.newProgressEventReader(stream.reader, srcInfo, isConfig)
+		stream.reader = eventReader
+	}
+
 	// === Decrypt the stream, if required.
 	decryptionStep, err := ic.blobPipelineDecryptionStep(&stream, srcInfo)
 	if err != nil {
@@ -50,7 +58,7 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 
 	// === Detect compression of the input stream.
 	// This requires us to “peek ahead” into the stream to read the initial part, which requires us to chain through another io.Reader returned by DetectCompression.
-	detectedCompression, err := blobPipelineDetectCompressionStep(&stream, srcInfo)
+	detectedCompression, err := blobPipelineDetectCompressionStep(&stream, srcInfo, ic.c.decompressorOptions())
 	if err != nil {
 		return types.BlobInfo{}, err
 	}
@@ -71,6 +79,9 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 		return types.BlobInfo{}, err
 	}
 	defer compressionStep.close()
+	if eventReader != nil {
+		eventReader.reportCompressionChange(compressionStep)
+	}
 
 	// === Encrypt the stream for valid mediatypes if ociEncryptConfig provided
 	if decryptionStep.decrypting && toEncrypt {
@@ -104,7 +115,16 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	if !isConfig {
 		options.LayerIndex = &layerIndex
 	}
-	destBlob, err := ic.c.dest.PutBlobWithOptions(ctx, &errorAnnotationReader{stream.reader}, stream.info, options)
+	if ic.c.concurrentBlobUploadsSemaphore != nil {
+		if err := ic.c.concurrentBlobUploadsSemaphore.Acquire(ctx, 1); err != nil {
+			// This can only fail with ctx.Err(), so no need to blame acquiring the semaphore.
+			return types.BlobInfo{}, fmt.Errorf("writing blob: %w", err)
+		}
+		defer ic.c.concurrentBlobUploadsSemaphore.Release(1)
+	}
+	putBlobCtx, span := tracing.StartSpan(ctx, "PutBlob", tracing.TransportKey.String(ic.c.dest.Reference().Transport().Name()))
+	destBlob, err := ic.c.dest.PutBlobWithOptions(putBlobCtx, &errorAnnotationReader{stream.reader}, stream.info, options)
+	tracing.EndSpan(span, err)
 	if err != nil {
 		return types.BlobInfo{}, fmt.Errorf("writing blob: %w", err)
 	}
@@ -140,6 +160,9 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 		}
 	}
 
+	if eventReader != nil {
+		eventReader.reportDone(uploadedInfo)
+	}
 	return uploadedInfo, nil
 }
 
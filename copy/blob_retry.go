@@ -0,0 +1,68 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultBlobCopyRetryDelay is the delay before the first retry of a layer copy, if Options.BlobCopyRetryDelay is not set.
+const defaultBlobCopyRetryDelay = 1 * time.Second
+
+// retryLayerCopy calls copyFn to copy the layer srcInfo, and retries it if it fails with a retryable error,
+// as configured by c.options.
+func (c *copier) retryLayerCopy(ctx context.Context, srcInfo types.BlobInfo, copyFn func() error) error {
+	delay := c.options.BlobCopyRetryDelay
+	if delay <= 0 {
+		delay = defaultBlobCopyRetryDelay
+	}
+	isRetryable := c.options.BlobCopyIsRetryable
+	if isRetryable == nil {
+		isRetryable = isRetryableBlobCopyError
+	}
+	for attempt := 1; ; attempt++ {
+		err := copyFn()
+		if err == nil || attempt > c.options.BlobCopyMaxRetries || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+		logrus.Warnf("Failed to copy blob %s, retrying in %s (%d/%d): %v", srcInfo.Digest, delay, attempt, c.options.BlobCopyMaxRetries, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isRetryableBlobCopyError returns true if err, returned by a failed blob copy, is likely to be transient:
+// a network error, or a registry asking clients to slow down or reporting it is temporarily unavailable.
+func isRetryableBlobCopyError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, docker.ErrTooManyRequests) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var ec errcode.ErrorCoder
+	if errors.As(err, &ec) {
+		switch ec.ErrorCode() {
+		case errcode.ErrorCodeTooManyRequests, errcode.ErrorCodeUnavailable:
+			return true
+		}
+	}
+	return false
+}
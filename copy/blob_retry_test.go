@@ -0,0 +1,83 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryLayerCopy(t *testing.T) {
+	ctx := context.Background()
+	transientErr := fmt.Errorf("reading blob: %w", io.ErrUnexpectedEOF)
+	permanentErr := errors.New("permanent failure")
+
+	for _, c := range []struct {
+		name          string
+		options       Options
+		errs          []error // Results of consecutive attempts; nil after the end
+		expectedCalls int
+		expectedErr   error
+	}{
+		{"no retries by default", Options{}, []error{transientErr}, 1, transientErr},
+		{"success after retries", Options{BlobCopyMaxRetries: 3, BlobCopyRetryDelay: time.Millisecond}, []error{transientErr, transientErr}, 3, nil},
+		{"retries exhausted", Options{BlobCopyMaxRetries: 2, BlobCopyRetryDelay: time.Millisecond}, []error{transientErr, transientErr, transientErr, transientErr}, 3, transientErr},
+		{"permanent error", Options{BlobCopyMaxRetries: 3, BlobCopyRetryDelay: time.Millisecond}, []error{permanentErr}, 1, permanentErr},
+		{"custom classifier", Options{BlobCopyMaxRetries: 3, BlobCopyRetryDelay: time.Millisecond, BlobCopyIsRetryable: func(err error) bool {
+			return errors.Is(err, permanentErr)
+		}}, []error{permanentErr}, 2, nil},
+	} {
+		c := c
+		calls := 0
+		copier := &copier{options: &c.options}
+		err := copier.retryLayerCopy(ctx, types.BlobInfo{}, func() error {
+			calls++
+			if calls <= len(c.errs) {
+				return c.errs[calls-1]
+			}
+			return nil
+		})
+		assert.Equal(t, c.expectedCalls, calls, c.name)
+		assert.Equal(t, c.expectedErr, err, c.name)
+	}
+
+	// Cancellation stops retrying
+	ctx, cancel := context.WithCancel(ctx)
+	calls := 0
+	copier := &copier{options: &Options{BlobCopyMaxRetries: 3, BlobCopyRetryDelay: time.Hour}}
+	err := copier.retryLayerCopy(ctx, types.BlobInfo{}, func() error {
+		calls++
+		cancel()
+		return transientErr
+	})
+	assert.Equal(t, 1, calls)
+	assert.ErrorIs(t, err, transientErr)
+}
+
+func TestIsRetryableBlobCopyError(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		expected bool
+	}{
+		{errors.New("some error"), false},
+		{context.Canceled, false},
+		{fmt.Errorf("copying: %w", context.DeadlineExceeded), false},
+		{io.ErrUnexpectedEOF, true},
+		{fmt.Errorf("writing blob: %w", syscall.ECONNRESET), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("reading blob: %w", docker.ErrTooManyRequests), true},
+		{errcode.ErrorCodeUnavailable.WithMessage("unavailable"), true},
+		{errcode.ErrorCodeDenied.WithMessage("denied"), false},
+	} {
+		assert.Equal(t, c.expected, isRetryableBlobCopyError(c.err), "%#v", c.err)
+	}
+}
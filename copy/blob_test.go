@@ -1,14 +1,24 @@
 package copy
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUpdatedBlobInfoFromUpload(t *testing.T) {
@@ -74,3 +84,110 @@ func TestUpdatedBlobInfoFromUpload(t *testing.T) {
 		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v", c.uploaded))
 	}
 }
+
+// threadSafeSourceReference is a types.ImageReference whose image sources claim to support concurrent GetBlob calls.
+type threadSafeSourceReference struct {
+	types.ImageReference
+}
+
+func (ref threadSafeSourceReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return threadSafeSource{src}, nil
+}
+
+// threadSafeSource is a types.ImageSource for a threadSafeSourceReference.
+type threadSafeSource struct {
+	types.ImageSource
+}
+
+func (src threadSafeSource) HasThreadSafeGetBlob() bool {
+	return true
+}
+
+// uploadCounter records the maximum number of concurrent PutBlob calls to a countingDestination.
+type uploadCounter struct {
+	mutex     sync.Mutex
+	active    int
+	maxActive int
+}
+
+// countingDestinationReference is a types.ImageReference whose image destinations update counter.
+type countingDestinationReference struct {
+	types.ImageReference
+	counter *uploadCounter
+}
+
+func (ref countingDestinationReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return countingDestination{ImageDestination: dest, counter: ref.counter}, nil
+}
+
+// countingDestination is a types.ImageDestination for a countingDestinationReference.
+type countingDestination struct {
+	types.ImageDestination
+	counter *uploadCounter
+}
+
+func (d countingDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	d.counter.mutex.Lock()
+	d.counter.active++
+	d.counter.maxActive = max(d.counter.maxActive, d.counter.active)
+	d.counter.mutex.Unlock()
+	defer func() {
+		d.counter.mutex.Lock()
+		d.counter.active--
+		d.counter.mutex.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond) // Give other uploads a chance to start concurrently
+	return d.ImageDestination.PutBlob(ctx, stream, inputInfo, cache, isConfig)
+}
+
+func TestMaxParallelUploads(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	layers := [][]byte{}
+	layerDescriptors := []string{}
+	for i := 0; i < 8; i++ {
+		layer := []byte(fmt.Sprintf("layer %d", i))
+		layers = append(layers, layer)
+		layerDescriptors = append(layerDescriptors, fmt.Sprintf(`{"mediaType":"%s","digest":"%s","size":%d}`,
+			imgspecv1.MediaTypeImageLayer, digest.FromBytes(layer), len(layer)))
+	}
+	manifestBlob := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s",`+
+		`"config":{"mediaType":"%s","digest":"%s","size":%d},"layers":[%s]}`,
+		imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageConfig, digest.FromBytes(config), len(config),
+		strings.Join(layerDescriptors, ",")))
+	srcDirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	srcDest, err := srcDirRef.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer srcDest.Close()
+	for _, blob := range append([][]byte{config}, layers...) {
+		_, err := srcDest.PutBlob(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}, none.NoCache, false)
+		require.NoError(t, err)
+	}
+	err = srcDest.PutManifest(ctx, manifestBlob, nil)
+	require.NoError(t, err)
+	err = srcDest.Commit(ctx, nil)
+	require.NoError(t, err)
+
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	destDirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	counter := &uploadCounter{}
+	_, err = Image(ctx, policyContext, countingDestinationReference{ImageReference: destDirRef, counter: counter},
+		threadSafeSourceReference{srcDirRef}, &Options{MaxParallelDownloads: uint(len(layers)), MaxParallelUploads: 2})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, counter.maxActive, 2)
+	assert.Positive(t, counter.maxActive)
+}
@@ -0,0 +1,358 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// CompareOptions allows supplying non-default configuration modifying the behavior of Compare.
+type CompareOptions struct {
+	SourceCtx        *types.SystemContext
+	DestinationCtx   *types.SystemContext
+	IgnoreSignatures bool // Don't read or compare signatures.
+}
+
+// CompareLayerReport describes a layer at a specific position in the source and destination images.
+type CompareLayerReport struct {
+	SourceDigest      digest.Digest // "" if the source image has fewer layers
+	DestinationDigest digest.Digest // "" if the destination image has fewer layers
+}
+
+// Match returns true if the layer is the same in the source and the destination.
+func (l CompareLayerReport) Match() bool {
+	return l.SourceDigest == l.DestinationDigest
+}
+
+// CompareImageReport describes the differences between a single image in the source and the destination.
+type CompareImageReport struct {
+	// The platform of the image, if it is an instance of a manifest list; nil otherwise.
+	Platform          *imgspecv1.Platform
+	SourceDigest      digest.Digest // Digest of the source manifest, or "" if the image only exists in the destination
+	DestinationDigest digest.Digest // Digest of the destination manifest, or "" if the image only exists in the source
+	// Digests of the configs; only set if both manifests exist and differ.
+	SourceConfigDigest      digest.Digest
+	DestinationConfigDigest digest.Digest
+	// Per-layer comparison; only set if both manifests exist and differ.
+	Layers []CompareLayerReport
+	// The number of signatures of the image; only set if signatures are compared and both manifests exist.
+	SourceSignatures      int
+	DestinationSignatures int
+	SignaturesMatch       bool // true if the source and destination have the same set of signatures, or signatures are not compared
+}
+
+// Match returns true if the image is the same in the source and the destination.
+func (r CompareImageReport) Match() bool {
+	return r.SourceDigest != "" && r.SourceDigest == r.DestinationDigest && r.SignaturesMatch
+}
+
+// CompareReport describes the differences between a source and a destination image, as determined by Compare.
+type CompareReport struct {
+	SourceDigest      digest.Digest // Digest of the top-level source manifest
+	DestinationDigest digest.Digest // Digest of the top-level destination manifest, or "" if the destination does not exist
+	// If both the source and the destination are manifest lists, one entry for every instance of either list,
+	// matched by digest or by platform; otherwise, a single entry comparing the top-level manifests.
+	Images []CompareImageReport
+	// The number of signatures of the top-level manifest lists; only set if signatures are compared and both the source and
+	// the destination are manifest lists.  (Otherwise, signatures of the top-level manifests are compared in Images.)
+	ListSourceSignatures      int
+	ListDestinationSignatures int
+	ListSignaturesMatch       bool // false only if both are manifest lists, signatures are compared, and they differ
+}
+
+// Match returns true if the destination is an exact copy of the source, including signatures unless ignored.
+func (r *CompareReport) Match() bool {
+	if r.SourceDigest != r.DestinationDigest || !r.ListSignaturesMatch {
+		return false
+	}
+	for _, img := range r.Images {
+		if !img.Match() {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare compares the image at srcRef with the image at destRef, e.g. to validate a mirror, without copying anything.
+// Only manifests and signatures are read, blobs are not; so the comparison does not detect corrupted or missing blobs
+// in the destination, and it assumes that both images are valid.
+// A missing destination is not an error; the returned report then has an empty DestinationDigest.
+func Compare(ctx context.Context, destRef, srcRef types.ImageReference, options *CompareOptions) (*CompareReport, error) {
+	if options == nil {
+		options = &CompareOptions{}
+	}
+	src, err := srcRef.NewImageSource(ctx, options.SourceCtx)
+	if err != nil {
+		return nil, fmt.Errorf("initializing source %s: %w", srcRef.StringWithinTransport(), err)
+	}
+	defer src.Close()
+	srcManifest, srcMIMEType, err := image.UnparsedInstance(src, nil).Manifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of source image: %w", err)
+	}
+	srcDigest, err := manifest.Digest(srcManifest)
+	if err != nil {
+		return nil, err
+	}
+	report := &CompareReport{SourceDigest: srcDigest, ListSignaturesMatch: true}
+
+	dest, err := destRef.NewImageSource(ctx, options.DestinationCtx)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			report.Images = []CompareImageReport{{SourceDigest: srcDigest}}
+			return report, nil
+		}
+		return nil, fmt.Errorf("initializing destination %s: %w", destRef.StringWithinTransport(), err)
+	}
+	defer dest.Close()
+	destManifest, destMIMEType, err := image.UnparsedInstance(dest, nil).Manifest(ctx)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			report.Images = []CompareImageReport{{SourceDigest: srcDigest}}
+			return report, nil
+		}
+		return nil, fmt.Errorf("reading manifest of destination image: %w", err)
+	}
+	report.DestinationDigest, err = manifest.Digest(destManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	c := imageComparer{src: src, dest: dest, options: options}
+	if !manifest.MIMETypeIsMultiImage(srcMIMEType) || !manifest.MIMETypeIsMultiImage(destMIMEType) {
+		img, err := c.compareImages(ctx, nil, nil, nil, srcManifest, srcMIMEType, destManifest, destMIMEType)
+		if err != nil {
+			return nil, err
+		}
+		report.Images = []CompareImageReport{img}
+		return report, nil
+	}
+	report.Images, err = c.compareLists(ctx, srcManifest, srcMIMEType, destManifest, destMIMEType)
+	if err != nil {
+		return nil, err
+	}
+	if !options.IgnoreSignatures {
+		report.ListSourceSignatures, report.ListDestinationSignatures, report.ListSignaturesMatch, err = c.compareSignatures(ctx, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// imageComparer contains the state of a Compare operation.
+type imageComparer struct {
+	src, dest types.ImageSource
+	options   *CompareOptions
+}
+
+// compareLists compares the instances of the source and destination manifest lists.
+func (c *imageComparer) compareLists(ctx context.Context, srcManifest []byte, srcMIMEType string, destManifest []byte, destMIMEType string) ([]CompareImageReport, error) {
+	srcList, err := manifest.ListFromBlob(srcManifest, srcMIMEType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing source manifest list: %w", err)
+	}
+	destList, err := manifest.ListFromBlob(destManifest, destMIMEType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing destination manifest list: %w", err)
+	}
+	srcInstances, err := listInstances(srcList)
+	if err != nil {
+		return nil, err
+	}
+	destInstances, err := listInstances(destList)
+	if err != nil {
+		return nil, err
+	}
+
+	// Match instances by digest first, so that platforms with several instances (e.g. with different compression)
+	// are matched correctly if they are unchanged, and only then by platform.
+	matches := make([]int, len(srcInstances)) // Index into destInstances, or -1
+	destMatched := make([]bool, len(destInstances))
+	for i, s := range srcInstances {
+		matches[i] = slices.IndexFunc(destInstances, func(d manifest.ListUpdate) bool {
+			return d.Digest == s.Digest
+		})
+		if matches[i] != -1 {
+			destMatched[matches[i]] = true
+		}
+	}
+	for i, s := range srcInstances {
+		if matches[i] != -1 {
+			continue
+		}
+		for j, d := range destInstances {
+			if !destMatched[j] && platformsEqual(s.ReadOnly.Platform, d.ReadOnly.Platform) &&
+				slices.Equal(s.ReadOnly.CompressionAlgorithmNames, d.ReadOnly.CompressionAlgorithmNames) {
+				matches[i] = j
+				destMatched[j] = true
+				break
+			}
+		}
+	}
+
+	res := []CompareImageReport{}
+	for i, s := range srcInstances {
+		if matches[i] == -1 {
+			res = append(res, CompareImageReport{Platform: s.ReadOnly.Platform, SourceDigest: s.Digest})
+			continue
+		}
+		d := destInstances[matches[i]]
+		srcManifest, srcMIMEType, err := image.UnparsedInstance(c.src, &s.Digest).Manifest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest %s from source: %w", s.Digest, err)
+		}
+		destManifest, destMIMEType, err := image.UnparsedInstance(c.dest, &d.Digest).Manifest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest %s from destination: %w", d.Digest, err)
+		}
+		img, err := c.compareImages(ctx, &s.Digest, &d.Digest, s.ReadOnly.Platform, srcManifest, srcMIMEType, destManifest, destMIMEType)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, img)
+	}
+	for j, d := range destInstances {
+		if !destMatched[j] {
+			res = append(res, CompareImageReport{Platform: d.ReadOnly.Platform, DestinationDigest: d.Digest})
+		}
+	}
+	return res, nil
+}
+
+// compareImages compares a single source and destination image, which are instances srcInstance and destInstance
+// of manifest lists, if not nil (otherwise, they are the top-level manifests); platform is the platform of the source instance, if any.
+func (c *imageComparer) compareImages(ctx context.Context, srcInstance, destInstance *digest.Digest, platform *imgspecv1.Platform,
+	srcManifest []byte, srcMIMEType string, destManifest []byte, destMIMEType string) (CompareImageReport, error) {
+	// Use the digests from the lists, which may use any algorithm, for instances; they have been verified when reading the manifests.
+	srcDigest, err := instanceOrManifestDigest(srcInstance, srcManifest)
+	if err != nil {
+		return CompareImageReport{}, err
+	}
+	destDigest, err := instanceOrManifestDigest(destInstance, destManifest)
+	if err != nil {
+		return CompareImageReport{}, err
+	}
+	res := CompareImageReport{
+		Platform:          platform,
+		SourceDigest:      srcDigest,
+		DestinationDigest: destDigest,
+		SignaturesMatch:   true,
+	}
+
+	if srcDigest != destDigest && !manifest.MIMETypeIsMultiImage(srcMIMEType) && !manifest.MIMETypeIsMultiImage(destMIMEType) {
+		srcParsed, err := manifest.FromBlob(srcManifest, srcMIMEType)
+		if err != nil {
+			return CompareImageReport{}, fmt.Errorf("parsing source manifest %s: %w", srcDigest, err)
+		}
+		destParsed, err := manifest.FromBlob(destManifest, destMIMEType)
+		if err != nil {
+			return CompareImageReport{}, fmt.Errorf("parsing destination manifest %s: %w", destDigest, err)
+		}
+		res.SourceConfigDigest = srcParsed.ConfigInfo().Digest
+		res.DestinationConfigDigest = destParsed.ConfigInfo().Digest
+		srcLayers := srcParsed.LayerInfos()
+		destLayers := destParsed.LayerInfos()
+		for i := 0; i < max(len(srcLayers), len(destLayers)); i++ {
+			layer := CompareLayerReport{}
+			if i < len(srcLayers) {
+				layer.SourceDigest = srcLayers[i].Digest
+			}
+			if i < len(destLayers) {
+				layer.DestinationDigest = destLayers[i].Digest
+			}
+			res.Layers = append(res.Layers, layer)
+		}
+	}
+
+	if !c.options.IgnoreSignatures {
+		res.SourceSignatures, res.DestinationSignatures, res.SignaturesMatch, err = c.compareSignatures(ctx, srcInstance, destInstance)
+		if err != nil {
+			return CompareImageReport{}, err
+		}
+	}
+	return res, nil
+}
+
+// instanceOrManifestDigest returns instanceDigest, if not nil, or the digest of the top-level manifest m.
+func instanceOrManifestDigest(instanceDigest *digest.Digest, m []byte) (digest.Digest, error) {
+	if instanceDigest != nil {
+		return *instanceDigest, nil
+	}
+	return manifest.Digest(m)
+}
+
+// compareSignatures compares signatures of srcInstance in the source and destInstance in the destination (of the top-level
+// manifests if nil), and returns the number of signatures of each, and whether they are the same.
+func (c *imageComparer) compareSignatures(ctx context.Context, srcInstance, destInstance *digest.Digest) (int, int, bool, error) {
+	srcSigs, err := c.src.GetSignatures(ctx, srcInstance)
+	if err != nil {
+		return -1, -1, false, fmt.Errorf("reading signatures of source image%s: %w", instanceDescription(srcInstance), err)
+	}
+	destSigs, err := c.dest.GetSignatures(ctx, destInstance)
+	if err != nil {
+		return -1, -1, false, fmt.Errorf("reading signatures of destination image%s: %w", instanceDescription(destInstance), err)
+	}
+	return len(srcSigs), len(destSigs), sameSignatures(srcSigs, destSigs), nil
+}
+
+// instanceDescription returns a suffix describing instanceDigest in error messages.
+func instanceDescription(instanceDigest *digest.Digest) string {
+	if instanceDigest == nil {
+		return ""
+	}
+	return " " + instanceDigest.String()
+}
+
+// listInstances returns descriptions of all instances of list.
+func listInstances(list manifest.List) ([]manifest.ListUpdate, error) {
+	res := []manifest.ListUpdate{}
+	for _, d := range list.Instances() {
+		instance, err := list.Instance(d)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, instance)
+	}
+	return res, nil
+}
+
+// platformsEqual returns true if a and b describe the same platform.
+func platformsEqual(a, b *imgspecv1.Platform) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.OS == b.OS && a.Architecture == b.Architecture && a.Variant == b.Variant &&
+		a.OSVersion == b.OSVersion && slices.Equal(a.OSFeatures, b.OSFeatures)
+}
+
+// sameSignatures returns true if a and b contain the same signatures, in any order.
+func sameSignatures(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	used := make([]bool, len(b))
+	for _, sa := range a {
+		found := false
+		for j, sb := range b {
+			if !used[j] && bytes.Equal(sa, sb) {
+				used[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	srcRef, srcManifest := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, []byte("layer 1"), imgspecv1.MediaTypeImageLayer)
+	otherRef, otherManifest := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, []byte("layer 2"), imgspecv1.MediaTypeImageLayer)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	layoutDir := t.TempDir()
+
+	// The destination does not exist
+	destRef, err := layout.NewReference(filepath.Join(layoutDir, "missing"), "tag")
+	require.NoError(t, err)
+	report, err := Compare(ctx, destRef, srcRef, nil)
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(srcManifest), report.SourceDigest)
+	assert.Equal(t, digest.Digest(""), report.DestinationDigest)
+	assert.False(t, report.Match())
+
+	// An exact copy
+	destRef, err = layout.NewReference(layoutDir, "tag")
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, destRef, srcRef, &Options{PreserveDigests: true})
+	require.NoError(t, err)
+	report, err = Compare(ctx, destRef, srcRef, nil)
+	require.NoError(t, err)
+	assert.True(t, report.Match())
+	require.Len(t, report.Images, 1)
+	assert.Nil(t, report.Images[0].Layers)
+
+	// A different image
+	report, err = Compare(ctx, destRef, otherRef, &CompareOptions{IgnoreSignatures: true})
+	require.NoError(t, err)
+	assert.False(t, report.Match())
+	assert.Equal(t, digest.FromBytes(otherManifest), report.SourceDigest)
+	require.Len(t, report.Images, 1)
+	img := report.Images[0]
+	assert.Equal(t, digest.FromBytes(config), img.SourceConfigDigest)
+	assert.Equal(t, digest.FromBytes(config), img.DestinationConfigDigest)
+	assert.Equal(t, []CompareLayerReport{{
+		SourceDigest:      digest.FromBytes([]byte("layer 2")),
+		DestinationDigest: digest.FromBytes([]byte("layer 1")),
+	}}, img.Layers)
+	assert.False(t, img.Layers[0].Match())
+}
+
+func TestSameSignatures(t *testing.T) {
+	for _, c := range []struct {
+		a, b     [][]byte
+		expected bool
+	}{
+		{nil, [][]byte{}, true},
+		{[][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("b"), []byte("a")}, true},
+		{[][]byte{[]byte("a")}, [][]byte{[]byte("a"), []byte("a")}, false},
+		{[][]byte{[]byte("a"), []byte("a")}, [][]byte{[]byte("a"), []byte("b")}, false},
+	} {
+		assert.Equal(t, c.expected, sameSignatures(c.a, c.b), "%q vs. %q", c.a, c.b)
+	}
+}
+
+func TestCompareListWithSHA512Instances(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	layer := []byte("layer")
+	instance := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s",`+
+		`"config":{"mediaType":"%s","digest":"%s","size":%d},`+
+		`"layers":[{"mediaType":"%s","digest":"%s","size":%d}]}`,
+		imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageConfig, digest.FromBytes(config), len(config),
+		imgspecv1.MediaTypeImageLayer, digest.FromBytes(layer), len(layer)))
+	instanceDigest := digest.SHA512.FromBytes(instance)
+	index := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s","manifests":[`+
+		`{"mediaType":"%s","digest":"%s","size":%d,"platform":{"architecture":"amd64","os":"linux"}}]}`,
+		imgspecv1.MediaTypeImageIndex, imgspecv1.MediaTypeImageManifest, instanceDigest, len(instance)))
+
+	ref, err := layout.NewReference(t.TempDir(), "tag")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	for _, blob := range [][]byte{config, layer} {
+		_, err := dest.PutBlob(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}, none.NoCache, false)
+		require.NoError(t, err)
+	}
+	err = dest.PutManifest(ctx, instance, &instanceDigest)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, index, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+
+	// Instances are identified by the digests in the lists, not by sha256 digests
+	report, err := Compare(ctx, ref, ref, nil)
+	require.NoError(t, err)
+	assert.True(t, report.Match())
+	require.Len(t, report.Images, 1)
+	assert.Equal(t, instanceDigest, report.Images[0].SourceDigest)
+	assert.Equal(t, instanceDigest, report.Images[0].DestinationDigest)
+}
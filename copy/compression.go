@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"io"
 	"maps"
+	"slices"
+	"strings"
 
 	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/compression"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
+	chunkedToc "github.com/containers/storage/pkg/chunked/toc"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 )
@@ -32,18 +36,41 @@ var (
 	}
 )
 
+// compressionAnnotationPrefixes and compressionAnnotationKeys identify annotations which describe a specific
+// compressed representation of a layer (e.g. the location of a zstd:chunked or eStargz TOC inside the blob),
+// and which are therefore invalid for any other representation of the same layer.
+var (
+	compressionAnnotationPrefixes = []string{
+		"io.github.containers.zstd-chunked.",
+	}
+	compressionAnnotationKeys = []string{
+		"containerd.io/snapshot/stargz/toc.digest",
+		"io.containers.estargz.uncompressed-size",
+	}
+)
+
+// isCompressionAnnotation returns true if key is an annotation which only applies to a specific compressed
+// representation of a layer.
+func isCompressionAnnotation(key string) bool {
+	return slices.Contains(compressionAnnotationKeys, key) ||
+		slices.ContainsFunc(compressionAnnotationPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(key, prefix)
+		})
+}
+
 // bpDetectCompressionStepData contains data that the copy pipeline needs about the “detect compression” step.
 type bpDetectCompressionStepData struct {
-	isCompressed      bool
-	format            compressiontypes.Algorithm        // Valid if isCompressed
-	decompressor      compressiontypes.DecompressorFunc // Valid if isCompressed
-	srcCompressorName string                            // Compressor name to possibly record in the blob info cache for the source blob.
+	isCompressed                 bool
+	format                       compressiontypes.Algorithm        // Valid if isCompressed
+	decompressor                 compressiontypes.DecompressorFunc // Valid if isCompressed
+	srcCompressorBaseVariantName string                            // Compressor name to possibly record in the blob info cache for the source blob.
 }
 
 // blobPipelineDetectCompressionStep updates *stream to detect its current compression format.
 // srcInfo is only used for error messages.
+// decompressorOptions configure the returned decompressor.
 // Returns data for other steps.
-func blobPipelineDetectCompressionStep(stream *sourceStream, srcInfo types.BlobInfo) (bpDetectCompressionStepData, error) {
+func blobPipelineDetectCompressionStep(stream *sourceStream, srcInfo types.BlobInfo, decompressorOptions compression.DecompressorOptions) (bpDetectCompressionStepData, error) {
 	// This requires us to “peek ahead” into the stream to read the initial part, which requires us to chain through another io.Reader returned by DetectCompression.
 	format, decompressor, reader, err := compression.DetectCompressionFormat(stream.reader) // We could skip this in some cases, but let's keep the code path uniform
 	if err != nil {
@@ -57,9 +84,15 @@ func blobPipelineDetectCompressionStep(stream *sourceStream, srcInfo types.BlobI
 		decompressor: decompressor,
 	}
 	if res.isCompressed {
-		res.srcCompressorName = format.Name()
+		res.decompressor, err = compression.DecompressorWithOptions(format, decompressorOptions)
+		if err != nil {
+			return bpDetectCompressionStepData{}, fmt.Errorf("decompressing blob %s: %w", srcInfo.Digest, err)
+		}
+		// DetectCompressionFormat can’t tell apart base variants and their non-base variants (e.g. zstd and zstd:chunked),
+		// so only record the base variant.
+		res.srcCompressorBaseVariantName = format.BaseVariantName()
 	} else {
-		res.srcCompressorName = internalblobinfocache.Uncompressed
+		res.srcCompressorBaseVariantName = internalblobinfocache.Uncompressed
 	}
 
 	if expectedBaseFormat, known := expectedBaseCompressionFormats[stream.info.MediaType]; known && res.isCompressed && format.BaseVariantName() != expectedBaseFormat.Name() {
@@ -70,13 +103,15 @@ func blobPipelineDetectCompressionStep(stream *sourceStream, srcInfo types.BlobI
 
 // bpCompressionStepData contains data that the copy pipeline needs about the compression step.
 type bpCompressionStepData struct {
-	operation              bpcOperation                // What we are actually doing
-	uploadedOperation      types.LayerCompression      // Operation to use for updating the blob metadata (matching the end state, not necessarily what we do)
-	uploadedAlgorithm      *compressiontypes.Algorithm // An algorithm parameter for the compressionOperation edits.
-	uploadedAnnotations    map[string]string           // Annotations that should be set on the uploaded blob. WARNING: This is only set after the srcStream.reader is fully consumed.
-	srcCompressorName      string                      // Compressor name to record in the blob info cache for the source blob.
-	uploadedCompressorName string                      // Compressor name to record in the blob info cache for the uploaded blob.
-	closers                []io.Closer                 // Objects to close after the upload is done, if any.
+	operation                             bpcOperation                // What we are actually doing
+	uploadedOperation                     types.LayerCompression      // Operation to use for updating the blob metadata (matching the end state, not necessarily what we do)
+	uploadedAlgorithm                     *compressiontypes.Algorithm // An algorithm parameter for the compressionOperation edits.
+	uploadedAnnotations                   map[string]string           // Compression-related annotations that should be set on the uploaded blob. WARNING: This is only set after the srcStream.reader is fully consumed.
+	srcCompressorBaseVariantName          string                      // Compressor base variant name to record in the blob info cache for the source blob.
+	uploadedCompressorBaseVariantName     string                      // Compressor base variant name to record in the blob info cache for the uploaded blob.
+	uploadedCompressorSpecificVariantName string                      // Compressor specific variant name to record in the blob info cache for the uploaded blob.
+	uncompressedDigester                  digest.Digester             // Only for bpcOpRecompressCompressed: digests the decompressed data. WARNING: This is only valid after the srcStream.reader is fully consumed.
+	closers                               []io.Closer                 // Objects to close after the upload is done, if any.
 }
 
 type bpcOperation int
@@ -128,11 +163,12 @@ func (ic *imageCopier) bpcPreserveEncrypted(stream *sourceStream, _ bpDetectComp
 		// We can’t do anything with an encrypted blob unless decrypted.
 		logrus.Debugf("Using original blob without modification for encrypted blob")
 		return &bpCompressionStepData{
-			operation:              bpcOpPreserveOpaque,
-			uploadedOperation:      types.PreserveOriginal,
-			uploadedAlgorithm:      nil,
-			srcCompressorName:      internalblobinfocache.UnknownCompression,
-			uploadedCompressorName: internalblobinfocache.UnknownCompression,
+			operation:                             bpcOpPreserveOpaque,
+			uploadedOperation:                     types.PreserveOriginal,
+			uploadedAlgorithm:                     nil,
+			srcCompressorBaseVariantName:          internalblobinfocache.UnknownCompression,
+			uploadedCompressorBaseVariantName:     internalblobinfocache.UnknownCompression,
+			uploadedCompressorSpecificVariantName: internalblobinfocache.UnknownCompression,
 		}, nil
 	}
 	return nil, nil
@@ -157,13 +193,14 @@ func (ic *imageCopier) bpcCompressUncompressed(stream *sourceStream, detected bp
 			Size:   -1,
 		}
 		return &bpCompressionStepData{
-			operation:              bpcOpCompressUncompressed,
-			uploadedOperation:      types.Compress,
-			uploadedAlgorithm:      uploadedAlgorithm,
-			uploadedAnnotations:    annotations,
-			srcCompressorName:      detected.srcCompressorName,
-			uploadedCompressorName: uploadedAlgorithm.Name(),
-			closers:                []io.Closer{reader},
+			operation:                             bpcOpCompressUncompressed,
+			uploadedOperation:                     types.Compress,
+			uploadedAlgorithm:                     uploadedAlgorithm,
+			uploadedAnnotations:                   annotations,
+			srcCompressorBaseVariantName:          detected.srcCompressorBaseVariantName,
+			uploadedCompressorBaseVariantName:     uploadedAlgorithm.BaseVariantName(),
+			uploadedCompressorSpecificVariantName: uploadedAlgorithm.Name(),
+			closers:                               []io.Closer{reader},
 		}, nil
 	}
 	return nil, nil
@@ -189,7 +226,10 @@ func (ic *imageCopier) bpcRecompressCompressed(stream *sourceStream, detected bp
 			}
 		}()
 
-		recompressed, annotations := ic.compressedStream(decompressed, *ic.compressionFormat)
+		// Compute the uncompressed digest while recompressing, so that both compression variants can be associated
+		// in the blob info cache, and later copies can reuse the recompressed blob.
+		uncompressedDigester := digest.Canonical.Digester()
+		recompressed, annotations := ic.compressedStream(io.TeeReader(decompressed, uncompressedDigester.Hash()), *ic.compressionFormat)
 		// Note: recompressed must be closed on all return paths.
 		stream.reader = recompressed
 		stream.info = types.BlobInfo{ // FIXME? Should we preserve more data in src.info? Notably the current approach correctly removes zstd:chunked metadata annotations.
@@ -198,13 +238,15 @@ func (ic *imageCopier) bpcRecompressCompressed(stream *sourceStream, detected bp
 		}
 		succeeded = true
 		return &bpCompressionStepData{
-			operation:              bpcOpRecompressCompressed,
-			uploadedOperation:      types.PreserveOriginal,
-			uploadedAlgorithm:      ic.compressionFormat,
-			uploadedAnnotations:    annotations,
-			srcCompressorName:      detected.srcCompressorName,
-			uploadedCompressorName: ic.compressionFormat.Name(),
-			closers:                []io.Closer{decompressed, recompressed},
+			operation:                             bpcOpRecompressCompressed,
+			uploadedOperation:                     types.PreserveOriginal,
+			uploadedAlgorithm:                     ic.compressionFormat,
+			uploadedAnnotations:                   annotations,
+			srcCompressorBaseVariantName:          detected.srcCompressorBaseVariantName,
+			uploadedCompressorBaseVariantName:     ic.compressionFormat.BaseVariantName(),
+			uploadedCompressorSpecificVariantName: ic.compressionFormat.Name(),
+			uncompressedDigester:                  uncompressedDigester,
+			closers:                               []io.Closer{decompressed, recompressed},
 		}, nil
 	}
 	return nil, nil
@@ -225,12 +267,13 @@ func (ic *imageCopier) bpcDecompressCompressed(stream *sourceStream, detected bp
 			Size:   -1,
 		}
 		return &bpCompressionStepData{
-			operation:              bpcOpDecompressCompressed,
-			uploadedOperation:      types.Decompress,
-			uploadedAlgorithm:      nil,
-			srcCompressorName:      detected.srcCompressorName,
-			uploadedCompressorName: internalblobinfocache.Uncompressed,
-			closers:                []io.Closer{s},
+			operation:                             bpcOpDecompressCompressed,
+			uploadedOperation:                     types.Decompress,
+			uploadedAlgorithm:                     nil,
+			srcCompressorBaseVariantName:          detected.srcCompressorBaseVariantName,
+			uploadedCompressorBaseVariantName:     internalblobinfocache.Uncompressed,
+			uploadedCompressorSpecificVariantName: internalblobinfocache.UnknownCompression,
+			closers:                               []io.Closer{s},
 		}, nil
 	}
 	return nil, nil
@@ -268,11 +311,12 @@ func (ic *imageCopier) bpcPreserveOriginal(_ *sourceStream, detected bpDetectCom
 		algorithm = nil
 	}
 	return &bpCompressionStepData{
-		operation:              bpcOp,
-		uploadedOperation:      uploadedOp,
-		uploadedAlgorithm:      algorithm,
-		srcCompressorName:      detected.srcCompressorName,
-		uploadedCompressorName: detected.srcCompressorName,
+		operation:                             bpcOp,
+		uploadedOperation:                     uploadedOp,
+		uploadedAlgorithm:                     algorithm,
+		srcCompressorBaseVariantName:          detected.srcCompressorBaseVariantName,
+		uploadedCompressorBaseVariantName:     detected.srcCompressorBaseVariantName,
+		uploadedCompressorSpecificVariantName: internalblobinfocache.UnknownCompression,
 	}
 }
 
@@ -310,11 +354,15 @@ func (d *bpCompressionStepData) recordValidatedDigestData(c *copier, uploadedInf
 			c.blobInfoCache.RecordDigestUncompressedPair(uploadedInfo.Digest, srcInfo.Digest)
 		case bpcOpDecompressCompressed:
 			c.blobInfoCache.RecordDigestUncompressedPair(srcInfo.Digest, uploadedInfo.Digest)
-		case bpcOpRecompressCompressed, bpcOpPreserveCompressed:
-			// We know one or two compressed digests. BlobInfoCache associates compression variants via the uncompressed digest,
-			// and we don’t know that one.
-			// That also means that repeated copies with the same recompression don’t identify reuse opportunities (unless
-			// RecordDigestUncompressedPair was called for both compressed variants for some other reason).
+		case bpcOpRecompressCompressed:
+			// We have digested the decompressed data while recompressing, so we know the uncompressed digest
+			// and can associate both compression variants with it.
+			uncompressedDigest := d.uncompressedDigester.Digest()
+			c.blobInfoCache.RecordDigestUncompressedPair(srcInfo.Digest, uncompressedDigest)
+			c.blobInfoCache.RecordDigestUncompressedPair(uploadedInfo.Digest, uncompressedDigest)
+		case bpcOpPreserveCompressed:
+			// We know the compressed digest. BlobInfoCache associates compression variants via the uncompressed digest,
+			// and we don’t know that one here (it may be recorded by the DiffID computation, if any).
 		case bpcOpPreserveUncompressed:
 			c.blobInfoCache.RecordDigestUncompressedPair(srcInfo.Digest, srcInfo.Digest)
 		case bpcOpInvalid:
@@ -323,25 +371,59 @@ func (d *bpCompressionStepData) recordValidatedDigestData(c *copier, uploadedInf
 			return fmt.Errorf("Internal error: Unexpected d.operation value %#v", d.operation)
 		}
 	}
-	if d.uploadedCompressorName != "" && d.uploadedCompressorName != internalblobinfocache.UnknownCompression {
-		if d.uploadedCompressorName != compressiontypes.ZstdChunkedAlgorithmName {
-			// HACK: Don’t record zstd:chunked algorithms.
-			// There is already a similar hack in internal/imagedestination/impl/helpers.CandidateMatchesTryReusingBlobOptions,
-			// and that one prevents reusing zstd:chunked blobs, so recording the algorithm here would be mostly harmless.
-			//
-			// We skip that here anyway to work around the inability of blobPipelineDetectCompressionStep to differentiate
-			// between zstd and zstd:chunked; so we could, in varying situations over time, call RecordDigestCompressorName
-			// with the same digest and both ZstdAlgorithmName and ZstdChunkedAlgorithmName , which causes warnings about
-			// inconsistent data to be logged.
-			c.blobInfoCache.RecordDigestCompressorName(uploadedInfo.Digest, d.uploadedCompressorName)
+	if d.uploadedCompressorBaseVariantName != "" && d.uploadedCompressorBaseVariantName != internalblobinfocache.UnknownCompression {
+		specificVariantName := internalblobinfocache.UnknownCompression
+		var specificVariantAnnotations map[string]string
+		// Only record a non-base variant, and its annotations, if we have just created it ourselves (so the data is locally verified),
+		// and not if encrypting or decrypting, for the same reasons as above.
+		if d.uploadedCompressorSpecificVariantName != d.uploadedCompressorBaseVariantName &&
+			!encryptionStep.encrypting && !decryptionStep.decrypting {
+			specificVariantName = d.uploadedCompressorSpecificVariantName
+			specificVariantAnnotations = d.uploadedAnnotations
+		}
+		c.blobInfoCache.RecordDigestCompressorData(uploadedInfo.Digest, internalblobinfocache.DigestCompressorData{
+			BaseVariantCompressor:      d.uploadedCompressorBaseVariantName,
+			SpecificVariantCompressor:  specificVariantName,
+			SpecificVariantAnnotations: specificVariantAnnotations,
+		})
+		if specificVariantName != internalblobinfocache.UnknownCompression {
+			if err := d.recordTOCUncompressedPair(c, srcInfo); err != nil {
+				return err
+			}
 		}
 	}
 	if srcInfo.Digest != "" && srcInfo.Digest != uploadedInfo.Digest &&
-		d.srcCompressorName != "" && d.srcCompressorName != internalblobinfocache.UnknownCompression {
-		if d.srcCompressorName != compressiontypes.ZstdChunkedAlgorithmName {
-			// HACK: Don’t record zstd:chunked algorithms, see above.
-			c.blobInfoCache.RecordDigestCompressorName(srcInfo.Digest, d.srcCompressorName)
-		}
+		d.srcCompressorBaseVariantName != "" && d.srcCompressorBaseVariantName != internalblobinfocache.UnknownCompression {
+		// If the source is already using some TOC-dependent variant, we either copied the
+		// blob as is, or perhaps decompressed it; either way we don’t trust the TOC digest,
+		// so record neither the variant name, nor the TOC digest.
+		c.blobInfoCache.RecordDigestCompressorData(srcInfo.Digest, internalblobinfocache.DigestCompressorData{
+			BaseVariantCompressor:      d.srcCompressorBaseVariantName,
+			SpecificVariantCompressor:  internalblobinfocache.UnknownCompression,
+			SpecificVariantAnnotations: nil,
+		})
+	}
+	return nil
+}
+
+// recordTOCUncompressedPair records the TOC digest of a blob we have just created with a non-base compression variant,
+// if any, and the corresponding uncompressed digest, if known.
+func (d *bpCompressionStepData) recordTOCUncompressedPair(c *copier, srcInfo types.BlobInfo) error {
+	var uncompressedDigest digest.Digest
+	switch d.operation {
+	case bpcOpCompressUncompressed:
+		uncompressedDigest = srcInfo.Digest
+	case bpcOpRecompressCompressed:
+		uncompressedDigest = d.uncompressedDigester.Digest()
+	default:
+		return nil
+	}
+	tocDigest, err := chunkedToc.GetTOCDigest(d.uploadedAnnotations)
+	if err != nil {
+		return fmt.Errorf("parsing just-created compression annotations: %w", err)
+	}
+	if tocDigest != nil && uncompressedDigest != "" {
+		c.blobInfoCache.RecordTOCUncompressedPair(*tocDigest, uncompressedDigest)
 	}
 	return nil
 }
@@ -354,8 +436,8 @@ func (d *bpCompressionStepData) close() {
 }
 
 // doCompression reads all input from src and writes its compressed equivalent to dest.
-func doCompression(dest io.Writer, src io.Reader, metadata map[string]string, compressionFormat compressiontypes.Algorithm, compressionLevel *int) error {
-	compressor, err := compression.CompressStreamWithMetadata(dest, metadata, compressionFormat, compressionLevel)
+func doCompression(dest io.Writer, src io.Reader, metadata map[string]string, compressionFormat compressiontypes.Algorithm, options compression.CompressorOptions) error {
+	compressor, err := compression.CompressStreamWithOptions(dest, metadata, compressionFormat, options)
 	if err != nil {
 		return err
 	}
@@ -378,7 +460,24 @@ func (ic *imageCopier) compressGoroutine(dest *io.PipeWriter, src io.Reader, met
 		_ = dest.CloseWithError(err) // CloseWithError(nil) is equivalent to Close(), always returns nil
 	}()
 
-	err = doCompression(dest, src, metadata, compressionFormat, ic.compressionLevel)
+	options := compression.CompressorOptions{Level: ic.compressionLevel}
+	if ic.c.options.DestinationCtx != nil {
+		options.ZstdWindowSize = ic.c.options.DestinationCtx.CompressionZstdWindowSize
+		options.ZstdConcurrency = ic.c.options.DestinationCtx.CompressionZstdConcurrency
+	}
+	err = doCompression(dest, src, metadata, compressionFormat, options)
+}
+
+// decompressorOptions returns options to use when decompressing blobs read from the source.
+func (c *copier) decompressorOptions() compression.DecompressorOptions {
+	if c.options.SourceCtx == nil {
+		return compression.DecompressorOptions{}
+	}
+	return compression.DecompressorOptions{
+		GzipBlockSize:    c.options.SourceCtx.DecompressionGzipBlockSize,
+		GzipBlocks:       c.options.SourceCtx.DecompressionGzipBlocks,
+		GzipDecompressor: c.options.SourceCtx.DecompressionGzipDecompressor,
+	}
 }
 
 // compressedStream returns a stream the input reader compressed using format, and a metadata map.
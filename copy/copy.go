@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/containers/image/v5/docker/reference"
@@ -16,6 +17,8 @@ import (
 	"github.com/containers/image/v5/internal/imagesource"
 	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/supporteddigests"
+	"github.com/containers/image/v5/internal/tracing"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache"
 	compression "github.com/containers/image/v5/pkg/compression/types"
@@ -25,6 +28,7 @@ import (
 	"github.com/containers/image/v5/types"
 	encconfig "github.com/containers/ocicrypt/config"
 	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/term"
@@ -70,6 +74,21 @@ const (
 // specific images from the source reference.
 type ImageListSelection int
 
+const (
+	// KeepSparseManifestList is the default value which, when set in Options.SparseManifestListAction,
+	// indicates that a manifest list of which only some instances were copied is written to the destination unmodified,
+	// i.e. still referring to the instances which were not copied.
+	KeepSparseManifestList SparseManifestListAction = iota
+	// StripSparseManifestList is a value which, when set in Options.SparseManifestListAction,
+	// indicates that instances which were not copied are removed from the manifest list written to the destination.
+	// This changes the digest of the manifest list.
+	StripSparseManifestList
+)
+
+// SparseManifestListAction is one of KeepSparseManifestList or StripSparseManifestList, to control the manifest list
+// written to the destination when ImageListSelection is CopySpecificImages and only some instances of a list are copied.
+type SparseManifestListAction int
+
 // Options allows supplying non-default configuration modifying the behavior of CopyImage.
 type Options struct {
 	RemoveSignatures bool // Remove any pre-existing signatures. Signers and SignBy… will still add a new signature.
@@ -87,6 +106,10 @@ type Options struct {
 	DestinationCtx   *types.SystemContext
 	ProgressInterval time.Duration                 // time to wait between reports to signal the progress channel
 	Progress         chan types.ProgressProperties // Reported to when ProgressInterval has arrived for a single artifact+offset.
+	// If not nil, ProgressCallback is called with detailed reports of the progress of the copy, as described by ProgressEvent.
+	// ProgressEventBlobRead events are reported every ProgressInterval, or every second if ProgressInterval is not set.
+	// The calls are never concurrent, but they may happen on different goroutines; ProgressCallback should return quickly.
+	ProgressCallback func(ProgressEvent)
 
 	// Preserve digests, and fail if we cannot.
 	PreserveDigests bool
@@ -94,12 +117,27 @@ type Options struct {
 	ForceManifestMIMEType string
 	ImageListSelection    ImageListSelection // set to either CopySystemImage (the default), CopyAllImages, or CopySpecificImages to control which instances we copy when the source reference is a list; ignored if the source reference is not a list
 	Instances             []digest.Digest    // if ImageListSelection is CopySpecificImages, copy only these instances and the list itself
+	// If ImageListSelection is CopySpecificImages, also copy the instances with one of these platforms.
+	// An empty Variant or OSVersion matches any value.
+	InstancePlatforms []imgspecv1.Platform
+	// Controls the manifest list written when ImageListSelection is CopySpecificImages, and only some instances are copied.
+	SparseManifestListAction SparseManifestListAction
 	// Give priority to pulling gzip images if multiple images are present when configured to OptionalBoolTrue,
 	// prefers the best compression if this is configured as OptionalBoolFalse. Choose automatically (and the choice may change over time)
 	// if this is set to OptionalBoolUndefined (which is the default behavior, and recommended for most callers).
 	// This only affects CopySystemImage.
 	PreferGzipInstances types.OptionalBool
 
+	// If > 0, a layer copy which fails with a retryable error is retried, up to BlobCopyMaxRetries times,
+	// instead of failing the whole copy (and transferring the already copied layers again when the caller retries).
+	BlobCopyMaxRetries int
+	// The delay before the first retry of a layer copy, doubled for every further retry; if 0, one second is used.
+	BlobCopyRetryDelay time.Duration
+	// If not nil, decides whether a layer copy which failed with the provided error can be retried.
+	// By default, network errors, and registry responses asking to slow down or reporting the registry to be
+	// temporarily unavailable, are retried.
+	BlobCopyIsRetryable func(error) bool
+
 	// If OciEncryptConfig is non-nil, it indicates that an image should be encrypted.
 	// The encryption options is derived from the construction of EncryptConfig object.
 	OciEncryptConfig *encconfig.EncryptConfig
@@ -119,6 +157,12 @@ type Options struct {
 	// MaxParallelDownloads indicates the maximum layers to pull at the same time. Applies to a single copy operation. A reasonable default is used if this is left as 0. Ignored if ConcurrentBlobCopiesSemaphore is set.
 	MaxParallelDownloads uint
 
+	// MaxParallelUploads, if > 0, additionally limits the number of blobs written to the destination at the same time,
+	// e.g. to avoid overloading a slow destination registry while layers which can be reused at the destination
+	// are still checked in parallel. Applies to a single copy operation; there is no separate limit by default.
+	// Because blobs are streamed from the source to the destination, a layer waiting for an upload slot also delays its download.
+	MaxParallelUploads uint
+
 	// When OptimizeDestinationImageAlreadyExists is set, optimize the copy assuming that the destination image already
 	// exists (and is equivalent). Making the eventual (no-op) copy more performant for this case. Enabling the option
 	// is slightly pessimistic if the destination image doesn't exist, or is not equivalent.
@@ -137,6 +181,35 @@ type Options struct {
 	// DestinationCtx.CompressionFormat is used exclusively, and blobs of other
 	// compression algorithms are not reused.
 	ForceCompressionFormat bool
+
+	// CopyReferrers, if set, also copies manifests which refer to the copied manifest using the OCI "subject" field
+	// (e.g. signatures, SBOMs or attestations), as listed by the OCI referrers API or its fallback tag schema,
+	// and cosign attestations and SBOMs stored using the "sha256-<hex>.att" and "sha256-<hex>.sbom" tags.
+	// Referrers are copied verbatim, except that if the copy changes the digest of the copied manifest, the "subject"
+	// field of referrers is updated to refer to the new digest; cosign attachments are not copied in that case.
+	// This is only supported when both the source and destination use the docker transport.
+	CopyReferrers bool
+
+	// AllowNonImageArtifacts, if set, allows copying OCI artifacts whose config is not an image configuration
+	// (e.g. Helm charts or WASM modules) without any image-specific processing: such artifacts are copied verbatim,
+	// without manifest format conversion, layer compression changes or DiffID computation.
+	// Copying artifacts to destinations which can only store images (e.g. containers-storage) fails.
+	AllowNonImageArtifacts bool
+
+	// ExistingTag determines whether the copy may replace an image which already exists at the destination,
+	// e.g. to protect release tags from being overwritten; the default is OverwriteExistingTag.
+	// Other values cause the copy to fail with a *TagExistsError; the destination is checked before anything is written to it.
+	ExistingTag ExistingTagPolicy
+
+	// If EditConfig is not nil, it is called with the configuration of every copied image, and can modify it,
+	// e.g. to add labels, to remove timestamps from the history, or to set the creation time.
+	// The configuration digest, and the manifest referring to it, are updated accordingly.
+	// Fields of the configuration which are not represented in imgspecv1.Image (e.g. Docker-specific ones) are preserved.
+	EditConfig func(config *imgspecv1.Image) error
+	// If EditManifestAnnotations is not nil, it is called with the annotations of the manifest of every copied image
+	// (an empty map if there are none), and can modify them.  Only OCI manifests can contain annotations.
+	// Editing images is not possible when the manifest can not be modified, e.g. with PreserveDigests or signed images.
+	EditManifestAnnotations func(annotations map[string]string) error
 }
 
 // OptionCompressionVariant allows to supply information about
@@ -160,11 +233,16 @@ type copier struct {
 	reportWriter   io.Writer
 	progressOutput io.Writer
 
-	unparsedToplevel              *image.UnparsedImage // for rawSource
-	blobInfoCache                 internalblobinfocache.BlobInfoCache2
-	concurrentBlobCopiesSemaphore *semaphore.Weighted // Limits the amount of concurrently copied blobs
-	signers                       []*signer.Signer    // Signers to use to create new signatures for the image
-	signersToClose                []*signer.Signer    // Signers that should be closed when this copier is destroyed.
+	unparsedToplevel               *image.UnparsedImage // for rawSource
+	blobInfoCache                  internalblobinfocache.BlobInfoCache2
+	concurrentBlobCopiesSemaphore  *semaphore.Weighted // Limits the amount of concurrently copied blobs
+	concurrentBlobUploadsSemaphore *semaphore.Weighted // Limits the amount of concurrently written blobs, or nil if not limited separately
+	progressCallbackLock           sync.Mutex          // Serializes calls to options.ProgressCallback
+	signers                        []*signer.Signer    // Signers to use to create new signatures for the image
+	signersToClose                 []*signer.Signer    // Signers that should be closed when this copier is destroyed.
+	dryRunReport                   *DryRunReport       // If not nil, nothing is written to dest; the work which would be done is recorded here instead.
+	existingTagDigest              digest.Digest       // If not "", the top-level manifest written to dest must have this digest, see Options.ExistingTag.
+	digestAlgorithm                digest.Algorithm    // Used for digests of manifests modified by the copy, see types.SystemContext.DigestAlgorithm.
 }
 
 // Internal function to validate `requireCompressionFormatMatch` for copySingleImageOptions
@@ -179,6 +257,34 @@ func shouldRequireCompressionFormatMatch(options *Options) (bool, error) {
 // source image admissibility.  It returns the manifest which was written to
 // the new copy of the image.
 func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options) (copiedManifest []byte, retErr error) {
+	return copyImage(ctx, policyContext, destRef, srcRef, options, copyImageOptions{})
+}
+
+// copyImageOptions contains parameters of copyImage which are not a part of Options.
+type copyImageOptions struct {
+	// If not nil, nothing is written to the destination; the work which would be done is recorded here instead.
+	dryRunReport *DryRunReport
+	// If not nil, the source to use instead of opening srcRef; it is not closed by copyImage.
+	source private.ImageSource
+}
+
+// copyTimeout returns the limit on the total time of copying an image configured in options, or 0 if there is no limit.
+func copyTimeout(options *Options) time.Duration {
+	res := time.Duration(0)
+	for _, sys := range []*types.SystemContext{options.SourceCtx, options.DestinationCtx} {
+		if sys != nil && sys.CopyTimeout > 0 && (res == 0 || sys.CopyTimeout < res) {
+			res = sys.CopyTimeout
+		}
+	}
+	return res
+}
+
+// copyImage implements Image, DryRun and ImageToDestinations.
+func copyImage(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options, opts copyImageOptions) (copiedManifest []byte, retErr error) {
+	ctx, span := tracing.StartSpan(ctx, "copy.Image",
+		tracing.SourceKey.String(transports.ImageName(srcRef)), tracing.DestinationKey.String(transports.ImageName(destRef)))
+	defer func() { tracing.EndSpan(span, retErr) }()
+
 	if options == nil {
 		options = &Options{}
 	}
@@ -186,6 +292,26 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	if err := validateImageListSelection(options.ImageListSelection); err != nil {
 		return nil, err
 	}
+	if err := validateCopyReferrers(destRef, srcRef, options); err != nil {
+		return nil, err
+	}
+	if err := validateExistingTagPolicy(options.ExistingTag); err != nil {
+		return nil, err
+	}
+	digestAlgorithm, err := supporteddigests.ForNewObjects(options.DestinationCtx)
+	if err != nil {
+		return nil, err
+	}
+	if timeout := copyTimeout(options); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// This must happen before NewImageDestination, which may already modify the destination.
+	existingTagDigest, err := checkExistingTag(ctx, destRef, options)
+	if err != nil {
+		return nil, err
+	}
 
 	reportWriter := io.Discard
 
@@ -193,11 +319,16 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		reportWriter = options.ReportWriter
 	}
 
-	publicDest, err := destRef.NewImageDestination(ctx, options.DestinationCtx)
-	if err != nil {
-		return nil, fmt.Errorf("initializing destination %s: %w", transports.ImageName(destRef), err)
+	var dest private.ImageDestination
+	if opts.dryRunReport != nil {
+		dest = newDryRunDestination(ctx, destRef, options.DestinationCtx)
+	} else {
+		publicDest, err := destRef.NewImageDestination(ctx, options.DestinationCtx)
+		if err != nil {
+			return nil, fmt.Errorf("initializing destination %s: %w", transports.ImageName(destRef), err)
+		}
+		dest = imagedestination.FromPublic(publicDest)
 	}
-	dest := imagedestination.FromPublic(publicDest)
 	defer func() {
 		if err := dest.Close(); err != nil {
 			if retErr != nil {
@@ -208,20 +339,23 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		}
 	}()
 
-	publicRawSource, err := srcRef.NewImageSource(ctx, options.SourceCtx)
-	if err != nil {
-		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
-	}
-	rawSource := imagesource.FromPublic(publicRawSource)
-	defer func() {
-		if err := rawSource.Close(); err != nil {
-			if retErr != nil {
-				retErr = fmt.Errorf(" (src: %v): %w", err, retErr)
-			} else {
-				retErr = fmt.Errorf(" (src: %v)", err)
-			}
+	rawSource := opts.source
+	if rawSource == nil {
+		publicRawSource, err := srcRef.NewImageSource(ctx, options.SourceCtx)
+		if err != nil {
+			return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
 		}
-	}()
+		rawSource = imagesource.FromPublic(publicRawSource)
+		defer func() {
+			if err := rawSource.Close(); err != nil {
+				if retErr != nil {
+					retErr = fmt.Errorf(" (src: %v): %w", err, retErr)
+				} else {
+					retErr = fmt.Errorf(" (src: %v)", err)
+				}
+			}
+		}()
+	}
 
 	// If reportWriter is not a TTY (e.g., when piping to a file), do not
 	// print the progress bars to avoid long and hard to parse output.
@@ -244,12 +378,18 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		// FIXME? The cache is used for sources and destinations equally, but we only have a SourceCtx and DestinationCtx.
 		// For now, use DestinationCtx (because blob reuse changes the behavior of the destination side more).
 		// Conceptually the cache settings should be in copy.Options instead.
-		blobInfoCache: internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(options.DestinationCtx)),
+		blobInfoCache:     internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(options.DestinationCtx)),
+		dryRunReport:      opts.dryRunReport,
+		existingTagDigest: existingTagDigest,
+		digestAlgorithm:   digestAlgorithm,
 	}
 	defer c.close()
 	c.blobInfoCache.Open()
 	defer c.blobInfoCache.Close()
 
+	if c.options.MaxParallelUploads > 0 {
+		c.concurrentBlobUploadsSemaphore = semaphore.NewWeighted(int64(c.options.MaxParallelUploads))
+	}
 	// Set the concurrentBlobCopiesSemaphore if we can copy layers in parallel.
 	if dest.HasThreadSafePutBlob() && rawSource.HasThreadSafeGetBlob() {
 		c.concurrentBlobCopiesSemaphore = c.options.ConcurrentBlobCopiesSemaphore
@@ -270,10 +410,14 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		}
 	}
 
-	if err := c.setupSigners(); err != nil {
-		return nil, err
+	// DryRun ignores signing options; don’t unlock keys or contact signing services just to discard the signers.
+	if c.dryRunReport == nil {
+		if err := c.setupSigners(); err != nil {
+			return nil, err
+		}
 	}
 
+	var copiedSourceInstance *digest.Digest // The instance of the source which was copied, if it is not the top-level manifest
 	multiImage, err := isMultiImage(ctx, c.unparsedToplevel)
 	if err != nil {
 		return nil, fmt.Errorf("determining manifest MIME type for %s: %w", transports.ImageName(srcRef), err)
@@ -311,7 +455,8 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		if err != nil {
 			return nil, fmt.Errorf("parsing primary manifest as list for %s: %w", transports.ImageName(srcRef), err)
 		}
-		instanceDigest, err := manifestList.ChooseInstanceByCompression(c.options.SourceCtx, c.options.PreferGzipInstances) // try to pick one that matches c.options.SourceCtx
+		// try to pick one that matches c.options.SourceCtx, descending into nested manifest lists
+		instanceDigest, _, _, err := image.ChooseInstance(ctx, c.options.SourceCtx, rawSource, manifestList, c.options.PreferGzipInstances)
 		if err != nil {
 			return nil, fmt.Errorf("choosing an image from manifest list %s: %w", transports.ImageName(srcRef), err)
 		}
@@ -322,6 +467,7 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 			return nil, fmt.Errorf("copying system image from manifest list: %w", err)
 		}
 		copiedManifest = single.manifest
+		copiedSourceInstance = &instanceDigest
 	} else { /* c.options.ImageListSelection == CopyAllImages or c.options.ImageListSelection == CopySpecificImages, */
 		// If we were asked to copy multiple images and can't, that's an error.
 		if !supportsMultipleImages(c.dest) {
@@ -339,10 +485,20 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		}
 	}
 
+	if c.dryRunReport != nil {
+		return nil, nil
+	}
+
 	if err := c.dest.Commit(ctx, c.unparsedToplevel); err != nil {
 		return nil, fmt.Errorf("committing the finished image: %w", err)
 	}
 
+	if options.CopyReferrers {
+		if err := c.copyReferrers(ctx, destRef, srcRef, copiedSourceInstance, copiedManifest); err != nil {
+			return nil, err
+		}
+	}
+
 	return copiedManifest, nil
 }
 
@@ -0,0 +1,27 @@
+package copy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyTimeout(t *testing.T) {
+	for _, c := range []struct {
+		src, dest *types.SystemContext
+		expected  time.Duration
+	}{
+		{nil, nil, 0},
+		{&types.SystemContext{}, &types.SystemContext{}, 0},
+		{&types.SystemContext{CopyTimeout: time.Minute}, nil, time.Minute},
+		{nil, &types.SystemContext{CopyTimeout: time.Minute}, time.Minute},
+		{&types.SystemContext{CopyTimeout: time.Minute}, &types.SystemContext{CopyTimeout: time.Hour}, time.Minute},
+		{&types.SystemContext{CopyTimeout: time.Hour}, &types.SystemContext{CopyTimeout: time.Minute}, time.Minute},
+		{&types.SystemContext{CopyTimeout: time.Hour}, &types.SystemContext{}, time.Hour},
+	} {
+		res := copyTimeout(&Options{SourceCtx: c.src, DestinationCtx: c.dest})
+		assert.Equal(t, c.expected, res)
+	}
+}
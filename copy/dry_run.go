@@ -0,0 +1,253 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/private"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// DryRunBlobStatus describes whether a blob would be transferred by Image.
+type DryRunBlobStatus int
+
+const (
+	// DryRunBlobUnknown indicates that it is not known whether the destination already contains the blob;
+	// the blob would be transferred unless it can be reused, e.g. based on the blob info cache.
+	DryRunBlobUnknown DryRunBlobStatus = iota
+	// DryRunBlobPresent indicates that the destination already contains the blob, as a part of the image
+	// currently stored at the destination reference, so it would be reused.
+	DryRunBlobPresent
+)
+
+// DryRunBlobReport describes a blob which would be copied by Image.
+type DryRunBlobReport struct {
+	Digest   digest.Digest
+	Size     int64 // -1 if unknown
+	IsConfig bool
+	Status   DryRunBlobStatus
+}
+
+// DryRunImageReport describes a single image which would be copied by Image.
+type DryRunImageReport struct {
+	SourceDigest           digest.Digest // Digest of the source manifest
+	SourceManifestMIMEType string
+	// The manifest format which would be written to the destination (with fallbacks to other formats if the destination rejects it).
+	ManifestMIMEType   string
+	ManifestConversion bool   // true if the manifest would be converted to ManifestMIMEType
+	CompressionFormat  string // The compression format layers would be converted to, if requested, or "" to use the default for the destination.
+	Blobs              []DryRunBlobReport
+}
+
+// DryRunReport describes the work Image would do, as determined by DryRun.
+type DryRunReport struct {
+	// The manifest list format which would be written to the destination if a manifest list would be copied; "" otherwise.
+	ManifestListMIMEType string
+	Images               []DryRunImageReport
+	// The total size of source blobs which would be transferred, i.e. which are not known to be present at the destination.
+	// Blobs with unknown sizes are not included, and the size of blobs written to the destination may differ
+	// if they are compressed, decompressed or encrypted.
+	EstimatedBytes int64
+}
+
+// DryRun evaluates a copy of srcRef to destRef with options, the same way as Image, including checking
+// the source against policyContext and determining the manifest conversions, without copying any blobs,
+// and without writing any manifests or signatures to the destination.
+// It returns a report of the work Image would do.
+//
+// DryRun never opens destRef as a destination, because that can have side effects (e.g. the dir: transport
+// removes previous contents of the destination directory); it only reads the image currently stored at destRef,
+// if any, to find blobs which are already present. Because the manifest formats accepted by the destination
+// are not known without opening it, manifest conversions are determined as if the destination accepted all formats,
+// unless Options.ForceManifestMIMEType is set.
+// Options.CopyReferrers and signing options are ignored.
+func DryRun(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options) (*DryRunReport, error) {
+	report := &DryRunReport{}
+	if _, err := copyImage(ctx, policyContext, destRef, srcRef, options, copyImageOptions{dryRunReport: report}); err != nil {
+		return nil, err
+	}
+	for _, img := range report.Images {
+		for _, blob := range img.Blobs {
+			if blob.Status != DryRunBlobPresent && blob.Size > 0 {
+				report.EstimatedBytes += blob.Size
+			}
+		}
+	}
+	return report, nil
+}
+
+// recordDryRun records the work which would be done by copying ic.src in ic.c.dryRunReport.
+func (ic *imageCopier) recordDryRun(ctx context.Context) error {
+	sourceDigest, err := manifest.Digest(ic.src.ManifestBlob)
+	if err != nil {
+		return err
+	}
+	res := DryRunImageReport{
+		SourceDigest:           sourceDigest,
+		SourceManifestMIMEType: ic.src.ManifestMIMEType,
+		ManifestMIMEType:       ic.manifestConversionPlan.preferredMIMEType,
+		ManifestConversion:     ic.manifestConversionPlan.preferredMIMETypeNeedsConversion,
+	}
+	if ic.compressionFormat != nil {
+		res.CompressionFormat = ic.compressionFormat.Name()
+	}
+
+	layerInfos, err := ic.src.LayerInfosForCopy(ctx)
+	if err != nil {
+		return err
+	}
+	if layerInfos == nil {
+		layerInfos = ic.src.LayerInfos()
+	}
+	blobs := []DryRunBlobReport{}
+	if config := ic.src.ConfigInfo(); config.Digest != "" {
+		blobs = append(blobs, DryRunBlobReport{Digest: config.Digest, Size: config.Size, IsConfig: true})
+	}
+	for _, layer := range layerInfos {
+		blobs = append(blobs, DryRunBlobReport{Digest: layer.Digest, Size: layer.Size})
+	}
+	dest, ok := ic.c.dest.(*dryRunDestination)
+	if !ok {
+		return errors.New("internal error: recording a dry run without a dryRunDestination")
+	}
+	for i := range blobs {
+		if _, ok := dest.existingBlobs[blobs[i].Digest]; ok {
+			blobs[i].Status = DryRunBlobPresent
+		} else {
+			blobs[i].Status = DryRunBlobUnknown
+		}
+	}
+	res.Blobs = blobs
+	ic.c.dryRunReport.Images = append(ic.c.dryRunReport.Images, res)
+	return nil
+}
+
+// errDryRunWrite is returned by all dryRunDestination methods which would write to the destination.
+var errDryRunWrite = errors.New("internal error: attempting to write to the destination during a dry run")
+
+// dryRunDestination is a private.ImageDestination used by DryRun instead of opening destRef as a destination,
+// which could modify it. It only provides the properties used to plan a copy; writing to it fails.
+type dryRunDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.AlwaysSupportsSignatures
+
+	ref           types.ImageReference
+	existingBlobs map[digest.Digest]struct{} // Blobs of the image currently stored at ref
+}
+
+// newDryRunDestination returns a dryRunDestination for ref, reading the image currently stored at ref, if any,
+// using sys.
+func newDryRunDestination(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) *dryRunDestination {
+	d := &dryRunDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes:     nil, // Not known without opening the destination; assume everything is accepted.
+			DesiredLayerCompression:        types.PreserveOriginal,
+			AcceptsForeignLayerURLs:        true,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false,
+			HasThreadSafePutBlob:           false,
+			AcceptsNonImageArtifacts:       true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+
+		ref:           ref,
+		existingBlobs: map[digest.Digest]struct{}{},
+	}
+	d.Compat = impl.AddCompat(d)
+	if err := d.readExistingBlobs(ctx, sys); err != nil {
+		// Most likely, there is no image at ref yet; either way, we can’t tell which blobs are present.
+		logrus.Debugf("Dry run: not using blobs of the image at the destination %s: %v", transports.ImageName(ref), err)
+	}
+	return d
+}
+
+// readExistingBlobs adds the blobs of the image currently stored at d.ref to d.existingBlobs.
+func (d *dryRunDestination) readExistingBlobs(ctx context.Context, sys *types.SystemContext) error {
+	src, err := d.ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	manifestBlob, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return err
+	}
+	manifests := [][]byte{}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		list, err := manifest.ListFromBlob(manifestBlob, mimeType)
+		if err != nil {
+			return err
+		}
+		for _, instanceDigest := range list.Instances() {
+			instanceBlob, instanceMIMEType, err := src.GetManifest(ctx, &instanceDigest)
+			if err != nil {
+				return err
+			}
+			if manifest.MIMETypeIsMultiImage(instanceMIMEType) {
+				continue // Nested lists are rare, not worth the effort of descending into them.
+			}
+			manifests = append(manifests, instanceBlob)
+		}
+	} else {
+		manifests = append(manifests, manifestBlob)
+	}
+	for _, m := range manifests {
+		parsed, err := manifest.FromBlob(m, manifest.GuessMIMEType(m))
+		if err != nil {
+			return err
+		}
+		if config := parsed.ConfigInfo(); config.Digest != "" {
+			d.existingBlobs[config.Digest] = struct{}{}
+		}
+		for _, layer := range parsed.LayerInfos() {
+			d.existingBlobs[layer.Digest] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Reference returns the reference used to set up this destination.
+func (d *dryRunDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *dryRunDestination) Close() error {
+	return nil
+}
+
+// PutBlobWithOptions always fails.
+func (d *dryRunDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	return private.UploadedBlob{}, errDryRunWrite
+}
+
+// TryReusingBlobWithOptions always fails.
+func (d *dryRunDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	return false, private.ReusedBlob{}, errDryRunWrite
+}
+
+// PutManifest always fails.
+func (d *dryRunDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	return errDryRunWrite
+}
+
+// PutSignaturesWithFormat always fails.
+func (d *dryRunDestination) PutSignaturesWithFormat(ctx context.Context, signatures []internalsig.Signature, instanceDigest *digest.Digest) error {
+	return errDryRunWrite
+}
+
+// Commit always fails.
+func (d *dryRunDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	return errDryRunWrite
+}
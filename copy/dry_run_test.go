@@ -0,0 +1,84 @@
+package copy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/oci/layout"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err := gzipWriter.Write([]byte("layer contents"))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	layer := gzipped.Bytes()
+	srcRef, srcManifest := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, layer, imgspecv1.MediaTypeImageLayerGzip)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	destDir := filepath.Join(t.TempDir(), "layout")
+	destRef, err := layout.NewReference(destDir, "tag")
+	require.NoError(t, err)
+
+	// Nothing is present at the destination, and nothing is written there
+	report, err := DryRun(ctx, policyContext, destRef, srcRef, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &DryRunReport{
+		Images: []DryRunImageReport{{
+			SourceDigest:           digest.FromBytes(srcManifest),
+			SourceManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+			ManifestMIMEType:       imgspecv1.MediaTypeImageManifest,
+			ManifestConversion:     false,
+			Blobs: []DryRunBlobReport{
+				{Digest: digest.FromBytes(config), Size: int64(len(config)), IsConfig: true, Status: DryRunBlobUnknown},
+				{Digest: digest.FromBytes(layer), Size: int64(len(layer)), Status: DryRunBlobUnknown},
+			},
+		}},
+		EstimatedBytes: int64(len(config) + len(layer)),
+	}, report)
+	_, err = os.Lstat(destDir)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// An existing dir: destination is not modified
+	dirDest := t.TempDir()
+	err = os.WriteFile(filepath.Join(dirDest, "unrelated"), []byte("data"), 0o600)
+	require.NoError(t, err)
+	dirDestRef, err := directory.NewReference(dirDest)
+	require.NoError(t, err)
+	_, err = DryRun(ctx, policyContext, dirDestRef, srcRef, nil)
+	require.NoError(t, err)
+	contents, err := os.ReadFile(filepath.Join(dirDest, "unrelated"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), contents)
+
+	// Signing options are ignored, so signing keys are not even loaded
+	_, err = DryRun(ctx, policyContext, destRef, srcRef, &Options{SignBySigstorePrivateKeyFile: filepath.Join(t.TempDir(), "nonexistent.key")})
+	require.NoError(t, err)
+
+	// After a copy, all blobs are present
+	_, err = Image(ctx, policyContext, destRef, srcRef, nil)
+	require.NoError(t, err)
+	report, err = DryRun(ctx, policyContext, destRef, srcRef, nil)
+	require.NoError(t, err)
+	require.Len(t, report.Images, 1)
+	for _, blob := range report.Images[0].Blobs {
+		assert.Equal(t, DryRunBlobPresent, blob.Status, blob.Digest.String())
+	}
+	assert.Equal(t, int64(0), report.EstimatedBytes)
+}
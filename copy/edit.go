@@ -0,0 +1,209 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// hasImageEdits returns true if options request editing the configuration or annotations of copied images.
+func hasImageEdits(options *Options) bool {
+	return options.EditConfig != nil || options.EditManifestAnnotations != nil
+}
+
+// editedImage is a types.Image with a manifest and configuration modified per Options.EditConfig and Options.EditManifestAnnotations.
+type editedImage struct {
+	types.Image
+	manifest         []byte
+	manifestMIMEType string
+	configInfo       types.BlobInfo
+	configBlob       []byte
+}
+
+func (i *editedImage) Manifest(ctx context.Context) ([]byte, string, error) {
+	return i.manifest, i.manifestMIMEType, nil
+}
+
+func (i *editedImage) ConfigInfo() types.BlobInfo {
+	return i.configInfo
+}
+
+func (i *editedImage) ConfigBlob(ctx context.Context) ([]byte, error) {
+	return i.configBlob, nil
+}
+
+// applyImageEdits returns src modified per ic.c.options.EditConfig and ic.c.options.EditManifestAnnotations.
+// If the edits don't change anything, it returns src.
+func (ic *imageCopier) applyImageEdits(ctx context.Context, src types.Image) (types.Image, error) {
+	man, mimeType, err := src.Manifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	configInfo := src.ConfigInfo()
+	configBlob, err := src.ConfigBlob(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading config blob %s: %w", configInfo.Digest, err)
+	}
+	configChanged := false
+	if ic.c.options.EditConfig != nil {
+		if configInfo.Digest == "" {
+			return nil, fmt.Errorf("can not edit the configuration of a %s image, which has none", mimeType)
+		}
+		edited, err := editConfigBlob(configBlob, ic.c.options.EditConfig)
+		if err != nil {
+			return nil, fmt.Errorf("editing image configuration: %w", err)
+		}
+		if !bytes.Equal(edited, configBlob) {
+			configChanged = true
+			configBlob = edited
+			configInfo.Digest = ic.c.digestAlgorithm.FromBytes(edited)
+			configInfo.Size = int64(len(edited))
+		}
+	}
+
+	switch manifest.NormalizedMIMEType(mimeType) {
+	case imgspecv1.MediaTypeImageManifest:
+		m, err := manifest.OCI1FromManifest(man)
+		if err != nil {
+			return nil, err
+		}
+		annotationsChanged := false
+		if ic.c.options.EditManifestAnnotations != nil {
+			annotations := maps.Clone(m.Annotations)
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			if err := ic.c.options.EditManifestAnnotations(annotations); err != nil {
+				return nil, fmt.Errorf("editing manifest annotations: %w", err)
+			}
+			if !maps.Equal(annotations, m.Annotations) {
+				annotationsChanged = true
+				if len(annotations) == 0 {
+					annotations = nil
+				}
+				m.Annotations = annotations
+			}
+		}
+		if !configChanged && !annotationsChanged {
+			return src, nil
+		}
+		m.Config.Digest = configInfo.Digest
+		m.Config.Size = configInfo.Size
+		man, err = m.Serialize()
+		if err != nil {
+			return nil, err
+		}
+	case manifest.DockerV2Schema2MediaType:
+		if ic.c.options.EditManifestAnnotations != nil {
+			// Docker schema2 manifests have no annotations; that's fine as long as the callback doesn't add any.
+			annotations := map[string]string{}
+			if err := ic.c.options.EditManifestAnnotations(annotations); err != nil {
+				return nil, fmt.Errorf("editing manifest annotations: %w", err)
+			}
+			if len(annotations) != 0 {
+				return nil, fmt.Errorf("can not set annotations in a %s manifest", mimeType)
+			}
+		}
+		if !configChanged {
+			return src, nil
+		}
+		m, err := manifest.Schema2FromManifest(man)
+		if err != nil {
+			return nil, err
+		}
+		m.ConfigDescriptor.Digest = configInfo.Digest
+		m.ConfigDescriptor.Size = configInfo.Size
+		man, err = m.Serialize()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("editing images with manifest type %s is not supported", mimeType)
+	}
+	return &editedImage{
+		Image:            src,
+		manifest:         man,
+		manifestMIMEType: mimeType,
+		configInfo:       configInfo,
+		configBlob:       configBlob,
+	}, nil
+}
+
+// editConfigBlob calls edit on configBlob parsed as an OCI image configuration, and returns the modified configuration.
+// Fields of configBlob which are not represented in imgspecv1.Image (e.g. Docker-specific ones) are preserved.
+// If edit changes nothing, configBlob is returned unmodified.
+func editConfigBlob(configBlob []byte, edit func(config *imgspecv1.Image) error) ([]byte, error) {
+	var config imgspecv1.Image
+	if err := json.Unmarshal(configBlob, &config); err != nil {
+		return nil, err
+	}
+	before, err := json.Marshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	if err := edit(&config); err != nil {
+		return nil, err
+	}
+	after, err := json.Marshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(before, after) {
+		return configBlob, nil
+	}
+
+	var raw, beforeMap, afterMap map[string]any
+	if err := json.Unmarshal(configBlob, &raw); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(before, &beforeMap); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &afterMap); err != nil {
+		return nil, err
+	}
+	mergeJSONChanges(raw, beforeMap, afterMap)
+	return json.Marshal(raw)
+}
+
+// mergeJSONChanges applies the differences between the JSON objects before and after to raw.
+// Nested objects are merged recursively, so that fields of raw not present in before and after are preserved.
+func mergeJSONChanges(raw, before, after map[string]any) {
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			delete(raw, k)
+		}
+	}
+	for k, v := range after {
+		rawObject, rawOK := raw[k].(map[string]any)
+		beforeObject, beforeOK := before[k].(map[string]any)
+		afterObject, afterOK := v.(map[string]any)
+		if rawOK && beforeOK && afterOK {
+			mergeJSONChanges(rawObject, beforeObject, afterObject)
+			continue
+		}
+		if b, ok := before[k]; ok && jsonEqual(b, v) {
+			continue
+		}
+		raw[k] = v
+	}
+}
+
+// jsonEqual returns true if a and b, values produced by json.Unmarshal into an interface, are equal.
+func jsonEqual(a, b any) bool {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aJSON, bJSON)
+}
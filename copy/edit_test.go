@@ -0,0 +1,112 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditConfigAndAnnotations(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"architecture":"amd64","os":"linux","container":"abc",` +
+		`"config":{"Healthcheck":{"Test":["CMD","true"]},"Labels":{"a":"1"}},` +
+		`"history":[{"created":"2020-01-01T00:00:00Z","created_by":"step"}],` +
+		`"rootfs":{"type":"layers","diff_ids":[]}}`)
+	srcRef, _ := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, []byte("layer"), imgspecv1.MediaTypeImageLayer)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	options := &Options{
+		EditConfig: func(config *imgspecv1.Image) error {
+			config.Config.Labels["b"] = "2"
+			for i := range config.History {
+				config.History[i].Created = nil
+			}
+			config.Created = &created
+			return nil
+		},
+		EditManifestAnnotations: func(annotations map[string]string) error {
+			annotations["org.example.mirrored"] = "true"
+			return nil
+		},
+	}
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	copied, err := Image(ctx, policyContext, destRef, srcRef, options)
+	require.NoError(t, err)
+
+	m, err := manifest.OCI1FromManifest(copied)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"org.example.mirrored": "true"}, m.Annotations)
+	src, err := destRef.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	img, err := image.FromUnparsedImage(ctx, nil, image.UnparsedInstance(src, nil))
+	require.NoError(t, err)
+	assert.Equal(t, m.Config.Digest, img.ConfigInfo().Digest)
+	configBlob, err := img.ConfigBlob(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Config.Digest, digest.FromBytes(configBlob))
+	var raw map[string]any
+	err = json.Unmarshal(configBlob, &raw)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", raw["container"])
+	assert.Equal(t, "2024-01-02T03:04:05Z", raw["created"])
+	assert.Equal(t, map[string]any{
+		"Healthcheck": map[string]any{"Test": []any{"CMD", "true"}},
+		"Labels":      map[string]any{"a": "1", "b": "2"},
+	}, raw["config"])
+	assert.Equal(t, []any{map[string]any{"created_by": "step"}}, raw["history"])
+
+	// The edited config is digested using the destination's configured algorithm, and can be read back
+	destRefSHA512, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	options.DestinationCtx = &types.SystemContext{DigestAlgorithm: digest.SHA512}
+	copied, err = Image(ctx, policyContext, destRefSHA512, srcRef, options)
+	require.NoError(t, err)
+	options.DestinationCtx = nil
+	m, err = manifest.OCI1FromManifest(copied)
+	require.NoError(t, err)
+	assert.Equal(t, digest.SHA512, m.Config.Digest.Algorithm())
+	srcSHA512, err := destRefSHA512.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer srcSHA512.Close()
+	img, err = image.FromUnparsedImage(ctx, nil, image.UnparsedInstance(srcSHA512, nil))
+	require.NoError(t, err)
+	configBlob, err = img.ConfigBlob(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Config.Digest, digest.SHA512.FromBytes(configBlob))
+
+	// Edits which change nothing leave the image unmodified
+	srcManifest, _, err := image.UnparsedInstance(src, nil).Manifest(ctx)
+	require.NoError(t, err)
+	destRef2, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	copied, err = Image(ctx, policyContext, destRef2, destRef, &Options{
+		EditConfig:              func(config *imgspecv1.Image) error { return nil },
+		EditManifestAnnotations: func(annotations map[string]string) error { return nil },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, srcManifest, copied)
+
+	// Edits are refused if the manifest can not be modified
+	destRef3, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	options.PreserveDigests = true
+	_, err = Image(ctx, policyContext, destRef3, srcRef, options)
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package copy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	encconfig "github.com/containers/ocicrypt/config"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyEncryptDecrypt(t *testing.T) {
+	ctx := context.Background()
+	uncompressed := []byte("layer contents")
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err := gzipWriter.Write(uncompressed)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	config := []byte(fmt.Sprintf(`{"rootfs":{"type":"layers","diff_ids":["%s"]}}`, digest.FromBytes(uncompressed)))
+	srcRef, _ := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, gzipped.Bytes(), imgspecv1.MediaTypeImageLayerGzip)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	// Encrypt all layers
+	encryptConfig, err := encconfig.EncryptWithJwe([][]byte{publicKeyPEM})
+	require.NoError(t, err)
+	encryptedRef, err := layout.NewReference(t.TempDir(), "encrypted")
+	require.NoError(t, err)
+	encryptedManifest, err := Image(ctx, policyContext, encryptedRef, srcRef, &Options{
+		OciEncryptConfig: encryptConfig.EncryptConfig,
+		OciEncryptLayers: &[]int{},
+	})
+	require.NoError(t, err)
+	m, err := manifest.OCI1FromManifest(encryptedManifest)
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 1)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip+"+encrypted", m.Layers[0].MediaType)
+	assert.NotEqual(t, digest.FromBytes(gzipped.Bytes()), m.Layers[0].Digest)
+	assert.Contains(t, m.Layers[0].Annotations, "org.opencontainers.image.enc.keys.jwe")
+
+	// Decrypt the result again
+	decryptConfig, err := encconfig.DecryptWithPrivKeys([][]byte{privateKeyPEM}, [][]byte{nil})
+	require.NoError(t, err)
+	decryptedRef, err := layout.NewReference(t.TempDir(), "decrypted")
+	require.NoError(t, err)
+	decryptedManifest, err := Image(ctx, policyContext, decryptedRef, encryptedRef, &Options{
+		OciDecryptConfig: decryptConfig.DecryptConfig,
+	})
+	require.NoError(t, err)
+	m, err = manifest.OCI1FromManifest(decryptedManifest)
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 1)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, m.Layers[0].MediaType)
+	assert.Equal(t, digest.FromBytes(gzipped.Bytes()), m.Layers[0].Digest)
+	for k := range m.Layers[0].Annotations {
+		assert.NotContains(t, k, "org.opencontainers.image.enc")
+	}
+}
@@ -0,0 +1,405 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/tmpdir"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// DestinationResult is the result of copying an image to one of the destinations of ImageToDestinations.
+type DestinationResult struct {
+	Destination    types.ImageReference
+	CopiedManifest []byte // The manifest written to Destination, if Err is nil
+	Err            error
+}
+
+// ImageToDestinations copies srcRef to each of destRefs concurrently, the same way as Image, but reads
+// every source blob only once, and streams it to all destinations which need it.
+// The blobs are spooled in temporary files (see types.SystemContext.BigFilesTemporaryDir in options.SourceCtx),
+// so that destinations consuming the data at different speeds don't block each other; the files are removed
+// when all copies are finished.
+//
+// The returned error is only used for failures affecting all destinations (e.g. if the source can not be opened);
+// otherwise, the result of each copy is returned in the corresponding element of the returned slice.
+// Note that progress reports of the individual copies, if requested in options, are interleaved;
+// options.ProgressCallback is never called concurrently, even for different destinations.
+func ImageToDestinations(ctx context.Context, policyContext *signature.PolicyContext, destRefs []types.ImageReference, srcRef types.ImageReference, options *Options) ([]DestinationResult, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	if timeout := copyTimeout(options); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	publicRawSource, err := srcRef.NewImageSource(ctx, options.SourceCtx)
+	if err != nil {
+		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
+	}
+	copyCtx, cancel := context.WithCancel(ctx)
+	src := newFanOutSource(copyCtx, imagesource.FromPublic(publicRawSource), options.SourceCtx)
+	defer func() {
+		cancel() // Stop reading blobs which are no longer needed
+		if err := src.closeAll(); err != nil {
+			logrus.Debugf("Error closing source %s: %v", transports.ImageName(srcRef), err)
+		}
+	}()
+
+	var progressCallbackLock sync.Mutex // Serializes calls to options.ProgressCallback across all copies
+	res := make([]DestinationResult, len(destRefs))
+	var wg sync.WaitGroup
+	for i, destRef := range destRefs {
+		res[i].Destination = destRef
+		// A PolicyContext can't be used concurrently, so use a separate one for every copy.
+		pc, err := signature.NewPolicyContext(policyContext.Policy)
+		if err != nil {
+			res[i].Err = err
+			continue
+		}
+		destOptions := *options
+		if options.ProgressCallback != nil {
+			destOptions.ProgressCallback = func(event ProgressEvent) {
+				progressCallbackLock.Lock()
+				defer progressCallbackLock.Unlock()
+				options.ProgressCallback(event)
+			}
+		}
+		wg.Add(1)
+		go func(i int, destRef types.ImageReference, pc *signature.PolicyContext, destOptions *Options) {
+			defer wg.Done()
+			defer func() {
+				if err := pc.Destroy(); err != nil && res[i].Err == nil {
+					res[i].Err = err
+				}
+			}()
+			res[i].CopiedManifest, res[i].Err = copyImage(copyCtx, pc, destRef, srcRef, destOptions, copyImageOptions{source: src})
+		}(i, destRef, pc, &destOptions)
+	}
+	wg.Wait()
+	return res, nil
+}
+
+// fanOutSource is a private.ImageSource which is shared by several concurrent copies:
+// each blob is read from the underlying source only once, into a temporary file, and all readers
+// of the blob follow the data as it is written.
+// Close does nothing, the owner must call closeAll when all users are done.
+type fanOutSource struct {
+	private.ImageSource
+	// Used for reading blobs, which is shared by all copies; so, it must not be the context of any single one of them.
+	spoolCtx context.Context
+	sys      *types.SystemContext
+
+	mutex     sync.Mutex
+	blobs     map[digest.Digest]*spooledBlob
+	manifests map[digest.Digest]fanOutManifest // Instance digest, or "" for the top-level manifest -> manifest
+	// Held while calling ImageSource, which may not be used concurrently; except for GetBlob if ImageSource.HasThreadSafeGetBlob.
+	// If GetBlob is not thread-safe, this is held while reading the blob.
+	sourceLock sync.Mutex
+	spoolers   sync.WaitGroup // Goroutines reading blobs from ImageSource
+}
+
+// fanOutManifest is a manifest cached by fanOutSource.
+type fanOutManifest struct {
+	manifest []byte
+	mimeType string
+}
+
+// newFanOutSource returns a fanOutSource wrapping src; blobs are read using spoolCtx, and temporary files are created according to sys.
+func newFanOutSource(spoolCtx context.Context, src private.ImageSource, sys *types.SystemContext) *fanOutSource {
+	return &fanOutSource{
+		ImageSource: src,
+		spoolCtx:    spoolCtx,
+		sys:         sys,
+		blobs:       map[digest.Digest]*spooledBlob{},
+		manifests:   map[digest.Digest]fanOutManifest{},
+	}
+}
+
+// Close does nothing; the underlying source is closed by closeAll.
+func (s *fanOutSource) Close() error {
+	return nil
+}
+
+// closeAll waits for reading blobs from the underlying source to finish, removes the temporary files,
+// and closes the underlying source.
+func (s *fanOutSource) closeAll() error {
+	s.spoolers.Wait()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, blob := range s.blobs {
+		blob.close()
+	}
+	s.blobs = map[digest.Digest]*spooledBlob{}
+	return s.ImageSource.Close()
+}
+
+// HasThreadSafeGetBlob indicates whether GetBlob can be executed concurrently.
+func (s *fanOutSource) HasThreadSafeGetBlob() bool {
+	return true
+}
+
+// SupportsGetBlobAt returns false: partial reads would bypass sharing the data between the copies.
+func (s *fanOutSource) SupportsGetBlobAt() bool {
+	return false
+}
+
+// GetBlobAt is not supported, see SupportsGetBlobAt.
+func (s *fanOutSource) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+	return nil, nil, fmt.Errorf("internal error: GetBlobAt is not supported by fanOutSource")
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *fanOutSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	key := digest.Digest("")
+	if instanceDigest != nil {
+		key = *instanceDigest
+	}
+	s.mutex.Lock()
+	m, ok := s.manifests[key]
+	s.mutex.Unlock()
+	if ok {
+		return m.manifest, m.mimeType, nil
+	}
+
+	s.sourceLock.Lock()
+	manifest, mimeType, err := s.ImageSource.GetManifest(ctx, instanceDigest)
+	s.sourceLock.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+	s.mutex.Lock()
+	s.manifests[key] = fanOutManifest{manifest: manifest, mimeType: mimeType}
+	s.mutex.Unlock()
+	return manifest, mimeType, nil
+}
+
+// GetSignatures returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *fanOutSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	s.sourceLock.Lock()
+	defer s.sourceLock.Unlock()
+	return s.ImageSource.GetSignatures(ctx, instanceDigest)
+}
+
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *fanOutSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]internalsig.Signature, error) {
+	s.sourceLock.Lock()
+	defer s.sourceLock.Unlock()
+	return s.ImageSource.GetSignaturesWithFormat(ctx, instanceDigest)
+}
+
+// LayerInfosForCopy returns either nil (meaning the values in the manifest are fine), or updated values for the layer
+// blobsums that are listed in the image's manifest.  If values are returned, they should be used when using GetBlob()
+// to read the image's layers.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve BlobInfos for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+// The Digest field is guaranteed to be provided; Size may be -1.
+// WARNING: The list may contain duplicates, and they are semantically relevant.
+func (s *fanOutSource) LayerInfosForCopy(ctx context.Context, instanceDigest *digest.Digest) ([]types.BlobInfo, error) {
+	s.sourceLock.Lock()
+	defer s.sourceLock.Unlock()
+	return s.ImageSource.LayerInfosForCopy(ctx, instanceDigest)
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+//
+// The first call for a blob starts reading it from the underlying source, independently of ctx; if that fails, all readers of the blob fail.
+// Canceling ctx only stops waiting for the data, both in GetBlob and in the returned stream.
+func (s *fanOutSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	s.mutex.Lock()
+	blob, ok := s.blobs[info.Digest]
+	if !ok {
+		file, err := tmpdir.CreateBigFileTemp(s.sys, "fan-out-blob")
+		if err != nil {
+			s.mutex.Unlock()
+			return nil, -1, fmt.Errorf("creating temporary file for blob %s: %w", info.Digest, err)
+		}
+		blob = newSpooledBlob(file)
+		s.blobs[info.Digest] = blob
+		s.spoolers.Add(1)
+		go s.spoolBlob(blob, info, cache)
+	}
+	s.mutex.Unlock()
+
+	size, err := blob.waitForSize(ctx)
+	if err != nil {
+		return nil, -1, err
+	}
+	return &spooledBlobReader{ctx: ctx, blob: blob}, size, nil
+}
+
+// spoolBlob reads info from the underlying source into blob, using s.spoolCtx.
+func (s *fanOutSource) spoolBlob(blob *spooledBlob, info types.BlobInfo, cache types.BlobInfoCache) {
+	defer s.spoolers.Done()
+	if !s.ImageSource.HasThreadSafeGetBlob() {
+		s.sourceLock.Lock()
+		defer s.sourceLock.Unlock()
+	}
+	stream, size, err := s.ImageSource.GetBlob(s.spoolCtx, info, cache)
+	if err != nil {
+		blob.finish(err)
+		return
+	}
+	defer stream.Close()
+	blob.setSize(size)
+	_, err = io.Copy(blob, stream)
+	blob.finish(err)
+}
+
+// spooledBlob is a blob being written to a temporary file, which can be read concurrently while it is being written.
+type spooledBlob struct {
+	file *os.File
+
+	mutex   sync.Mutex
+	changed chan struct{} // Closed, and replaced by a new channel, when any of the fields below change
+	sizeSet bool
+	size    int64 // Valid if sizeSet
+	written int64
+	done    bool
+	err     error // Valid if done
+}
+
+// newSpooledBlob returns a spooledBlob which will be written to file.
+func newSpooledBlob(file *os.File) *spooledBlob {
+	return &spooledBlob{file: file, changed: make(chan struct{})}
+}
+
+// notifyLocked wakes up all goroutines waiting for a change of b.
+// The caller must hold b.mutex.
+func (b *spooledBlob) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// waitLocked waits until a field of b changes, or until ctx is canceled.
+// The caller must hold b.mutex; it is temporarily released while waiting.
+func (b *spooledBlob) waitLocked(ctx context.Context) error {
+	changed := b.changed
+	b.mutex.Unlock()
+	defer b.mutex.Lock()
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setSize records the size of the blob reported by the source.
+func (b *spooledBlob) setSize(size int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.size = size
+	b.sizeSet = true
+	b.notifyLocked()
+}
+
+// waitForSize returns the size of the blob reported by the source, or an error if the blob can't be read at all,
+// or if ctx is canceled.
+func (b *spooledBlob) waitForSize(ctx context.Context) (int64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for !b.sizeSet && !b.done {
+		if err := b.waitLocked(ctx); err != nil {
+			return -1, err
+		}
+	}
+	if !b.sizeSet {
+		return -1, b.err
+	}
+	return b.size, nil
+}
+
+// Write appends p to the temporary file.
+func (b *spooledBlob) Write(p []byte) (int, error) {
+	n, err := b.file.Write(p)
+	b.mutex.Lock()
+	b.written += int64(n)
+	b.notifyLocked()
+	b.mutex.Unlock()
+	return n, err
+}
+
+// finish records that writing the blob has finished, with err (nil on success).
+func (b *spooledBlob) finish(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil && !b.sizeSet {
+		err = errors.New("internal error: blob size not recorded")
+	}
+	b.done = true
+	b.err = err
+	b.notifyLocked()
+}
+
+// close removes the temporary file.
+func (b *spooledBlob) close() {
+	b.file.Close()
+	os.Remove(b.file.Name())
+}
+
+// spooledBlobReader is a reader of a spooledBlob, returning data as it is written.
+type spooledBlobReader struct {
+	ctx    context.Context // Waiting for data fails when ctx is canceled
+	blob   *spooledBlob
+	offset int64
+}
+
+// Read implements io.Reader.
+func (r *spooledBlobReader) Read(p []byte) (int, error) {
+	b := r.blob
+	b.mutex.Lock()
+	for r.offset >= b.written && !b.done {
+		if err := b.waitLocked(r.ctx); err != nil {
+			b.mutex.Unlock()
+			return 0, err
+		}
+	}
+	written, done, err := b.written, b.done, b.err
+	b.mutex.Unlock()
+
+	if r.offset >= written {
+		if done && err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > written-r.offset {
+		p = p[:written-r.offset]
+	}
+	n, readErr := b.file.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if readErr != nil && !errors.Is(readErr, io.EOF) {
+		return n, readErr
+	}
+	return n, nil
+}
+
+// Close implements io.Closer.
+func (r *spooledBlobReader) Close() error {
+	return nil
+}
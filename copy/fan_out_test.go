@@ -0,0 +1,213 @@
+package copy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingBlobSource is a private.ImageSource which only supports GetBlob, and counts its calls.
+// GetBlob fails if ctx is canceled.
+type countingBlobSource struct {
+	private.ImageSource // To implement the remaining methods; they will panic
+	blobs               map[digest.Digest][]byte
+	mutex               sync.Mutex
+	calls               map[digest.Digest]int
+}
+
+func (s *countingBlobSource) HasThreadSafeGetBlob() bool {
+	return false
+}
+
+func (s *countingBlobSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, -1, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls[info.Digest]++
+	blob := s.blobs[info.Digest]
+	return io.NopCloser(bytes.NewReader(blob)), int64(len(blob)), nil
+}
+
+func (s *countingBlobSource) Close() error {
+	return nil
+}
+
+func TestFanOutSourceGetBlob(t *testing.T) {
+	ctx := context.Background()
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	blobDigest := digest.FromBytes(blob)
+	underlying := &countingBlobSource{
+		blobs: map[digest.Digest][]byte{blobDigest: blob},
+		calls: map[digest.Digest]int{},
+	}
+	src := newFanOutSource(ctx, underlying, &types.SystemContext{BigFilesTemporaryDir: t.TempDir()})
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, nil)
+			require.NoError(t, err)
+			defer stream.Close()
+			assert.Equal(t, int64(len(blob)), size)
+			results[i], err = io.ReadAll(stream)
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	for _, res := range results {
+		assert.Equal(t, blob, res)
+	}
+	assert.Equal(t, 1, underlying.calls[blobDigest])
+	err := src.closeAll()
+	require.NoError(t, err)
+}
+
+func TestFanOutSourceGetBlobCanceledReader(t *testing.T) {
+	blob := []byte("blob contents")
+	blobDigest := digest.FromBytes(blob)
+	underlying := &countingBlobSource{
+		blobs: map[digest.Digest][]byte{blobDigest: blob},
+		calls: map[digest.Digest]int{},
+	}
+	src := newFanOutSource(context.Background(), underlying, &types.SystemContext{BigFilesTemporaryDir: t.TempDir()})
+
+	// The context of the first reader, which may be canceled by that reader's copy, does not affect the others.
+	// (The first reader itself may, or may not, fail, depending on how far spooling got before it noticed.)
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream, _, err := src.GetBlob(canceledCtx, types.BlobInfo{Digest: blobDigest, Size: -1}, nil)
+	if err == nil {
+		_, _ = io.ReadAll(stream)
+		require.NoError(t, stream.Close())
+	}
+	stream, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, nil)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, blob, contents)
+	require.NoError(t, stream.Close())
+	assert.Equal(t, 1, underlying.calls[blobDigest])
+	err = src.closeAll()
+	require.NoError(t, err)
+}
+
+// stallingBlobSource is a private.ImageSource which only supports GetBlob; GetBlob blocks until getBlobDone is closed,
+// and then returns data written to pipe.
+type stallingBlobSource struct {
+	private.ImageSource // To implement the remaining methods; they will panic
+	getBlobDone         chan struct{}
+	pipe                *io.PipeReader
+}
+
+func (s *stallingBlobSource) HasThreadSafeGetBlob() bool {
+	return true
+}
+
+func (s *stallingBlobSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	select {
+	case <-s.getBlobDone:
+		return s.pipe, -1, nil
+	case <-ctx.Done():
+		return nil, -1, ctx.Err()
+	}
+}
+
+func (s *stallingBlobSource) Close() error {
+	return nil
+}
+
+func TestFanOutSourceGetBlobCanceledWhileSpooling(t *testing.T) {
+	blobDigest := digest.FromString("blob")
+	pipeReader, pipeWriter := io.Pipe()
+	underlying := &stallingBlobSource{getBlobDone: make(chan struct{}), pipe: pipeReader}
+	src := newFanOutSource(context.Background(), underlying, &types.SystemContext{BigFilesTemporaryDir: t.TempDir()})
+
+	// Canceling a GetBlob waiting for the source to start returning the blob
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, _, err := src.GetBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Canceling a read waiting for more data
+	close(underlying.getBlobDone)
+	ctx, cancel = context.WithCancel(context.Background())
+	stream, _, err := src.GetBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, nil)
+	require.NoError(t, err)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = io.ReadAll(stream)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, stream.Close())
+
+	err = pipeWriter.Close() // Let spooling finish
+	require.NoError(t, err)
+	err = src.closeAll()
+	require.NoError(t, err)
+}
+
+func TestImageToDestinations(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err := gzipWriter.Write([]byte("layer contents"))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	srcRef, srcManifest := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, gzipped.Bytes(), imgspecv1.MediaTypeImageLayerGzip)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	destRefs := []types.ImageReference{}
+	for i := 0; i < 3; i++ {
+		destRef, err := layout.NewReference(t.TempDir(), "tag")
+		require.NoError(t, err)
+		destRefs = append(destRefs, destRef)
+	}
+	var callbackMutex sync.Mutex // Only used to detect concurrent calls; ImageToDestinations must serialize them on its own
+	callbacks, concurrentCallbacks := 0, 0
+	options := &Options{ProgressCallback: func(event ProgressEvent) {
+		if !callbackMutex.TryLock() {
+			concurrentCallbacks++ // Racy, but only ever incremented if the calls are concurrent.
+			return
+		}
+		defer callbackMutex.Unlock()
+		callbacks++
+		time.Sleep(time.Millisecond) // Give other calls a chance to overlap
+	}}
+	results, err := ImageToDestinations(ctx, policyContext, destRefs, srcRef, options)
+	require.NoError(t, err)
+	assert.Positive(t, callbacks)
+	assert.Zero(t, concurrentCallbacks)
+	require.Len(t, results, len(destRefs))
+	for i, res := range results {
+		require.NoError(t, res.Err)
+		assert.Equal(t, destRefs[i], res.Destination)
+		assert.Equal(t, srcManifest, res.CopiedManifest)
+
+		src, err := destRefs[i].NewImageSource(ctx, nil)
+		require.NoError(t, err)
+		m, _, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, srcManifest, m)
+		require.NoError(t, src.Close())
+	}
+}
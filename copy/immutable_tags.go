@@ -0,0 +1,131 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ExistingTagPolicy determines whether a copy may replace an image which already exists at the destination;
+// see Options.ExistingTag.
+type ExistingTagPolicy int
+
+const (
+	// OverwriteExistingTag is the default value of Options.ExistingTag: an image at the destination is replaced.
+	OverwriteExistingTag ExistingTagPolicy = iota
+	// RejectExistingTag is a value which, when set in Options.ExistingTag, causes the copy to fail with a
+	// *TagExistsError if the destination already contains an image, before anything is written to the destination.
+	RejectExistingTag
+	// RejectChangedTag is a value which, when set in Options.ExistingTag, causes the copy to fail with a
+	// *TagExistsError if the destination already contains an image, and the top-level manifest to be written
+	// is different from the existing one. Copying the same image again succeeds, so that pushes can be retried.
+	RejectChangedTag
+)
+
+// TagExistsError is returned when a copy is rejected because of Options.ExistingTag.
+type TagExistsError struct {
+	Destination    string        // The destination, as formatted by transports.ImageName
+	ExistingDigest digest.Digest // The digest of the manifest which exists at the destination
+	NewDigest      digest.Digest // The digest of the manifest which would have been written, or "" if rejected before it was known
+}
+
+func (e *TagExistsError) Error() string {
+	if e.NewDigest == "" {
+		return fmt.Sprintf("%s already exists (with manifest digest %s)", e.Destination, e.ExistingDigest)
+	}
+	return fmt.Sprintf("%s already exists with manifest digest %s, refusing to replace it with %s", e.Destination, e.ExistingDigest, e.NewDigest)
+}
+
+// validateExistingTagPolicy returns an error if policy is not a valid ExistingTagPolicy value.
+func validateExistingTagPolicy(policy ExistingTagPolicy) error {
+	switch policy {
+	case OverwriteExistingTag, RejectExistingTag, RejectChangedTag:
+		return nil
+	default:
+		return fmt.Errorf("Invalid value for options.ExistingTag: %d", policy)
+	}
+}
+
+// checkExistingTag enforces options.ExistingTag before anything is written to destRef.
+// It returns the manifest digest of the image existing at destRef, if the top-level manifest must match it, or "".
+func checkExistingTag(ctx context.Context, destRef types.ImageReference, options *Options) (digest.Digest, error) {
+	if options.ExistingTag == OverwriteExistingTag {
+		return "", nil
+	}
+	if named := destRef.DockerReference(); named != nil {
+		if _, isTagged := named.(reference.NamedTagged); !isTagged {
+			if _, isDigested := named.(reference.Canonical); isDigested {
+				return "", nil // A digest reference can only ever refer to the same manifest.
+			}
+		}
+	}
+	existing, err := existingManifestDigest(ctx, destRef, options.DestinationCtx)
+	if err != nil {
+		return "", fmt.Errorf("checking whether %s already exists: %w", transports.ImageName(destRef), err)
+	}
+	if existing == "" {
+		return "", nil
+	}
+	if options.ExistingTag == RejectExistingTag {
+		return "", &TagExistsError{Destination: transports.ImageName(destRef), ExistingDigest: existing}
+	}
+	return existing, nil
+}
+
+// existingManifestDigest returns the digest of the top-level manifest at ref, or "" if ref does not exist.
+func existingManifestDigest(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (digest.Digest, error) {
+	var res digest.Digest
+	var err error
+	if ref.Transport().Name() == docker.Transport.Name() {
+		// Don’t use NewImageSource, which could read the image from a pull mirror instead of the destination registry.
+		res, err = docker.GetDigest(ctx, sys, ref)
+	} else {
+		res, err = existingManifestDigestFromSource(ctx, ref, sys)
+	}
+	if errors.Is(err, types.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return res, err
+}
+
+// existingManifestDigestFromSource returns the digest of the top-level manifest at ref, using an image source.
+func existingManifestDigestFromSource(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (digest.Digest, error) {
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	m, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	return manifest.Digest(m)
+}
+
+// checkToplevelManifest returns a *TagExistsError if writing the top-level manifest m is not allowed by options.ExistingTag.
+func (c *copier) checkToplevelManifest(m []byte) error {
+	if c.existingTagDigest == "" {
+		return nil
+	}
+	// The existing digest might use a different algorithm than we would, so compare using MatchesDigest.
+	matches, err := manifest.MatchesDigest(m, c.existingTagDigest)
+	if err != nil {
+		return err
+	}
+	if matches {
+		return nil
+	}
+	newDigest, err := manifest.Digest(m)
+	if err != nil {
+		return err
+	}
+	return &TagExistsError{Destination: transports.ImageName(c.dest.Reference()), ExistingDigest: c.existingTagDigest, NewDigest: newDigest}
+}
@@ -0,0 +1,176 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistingTag(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	srcRef, _ := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, []byte("layer 1"), imgspecv1.MediaTypeImageLayer)
+	otherRef, _ := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, []byte("layer 2"), imgspecv1.MediaTypeImageLayer)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	layoutDir := t.TempDir()
+
+	for _, c := range []struct {
+		policy ExistingTagPolicy
+		tag    string
+	}{
+		{RejectExistingTag, "reject-existing"},
+		{RejectChangedTag, "reject-changed"},
+	} {
+		policy := c.policy
+		destRef, err := layout.NewReference(layoutDir, c.tag)
+		require.NoError(t, err)
+		options := &Options{ExistingTag: policy}
+
+		// The destination does not exist yet
+		copied, err := Image(ctx, policyContext, destRef, srcRef, options)
+		require.NoError(t, err, policy)
+		copiedDigest := digest.FromBytes(copied)
+
+		// Copying the same image again
+		_, err = Image(ctx, policyContext, destRef, srcRef, options)
+		if policy == RejectExistingTag {
+			var tagErr *TagExistsError
+			require.ErrorAs(t, err, &tagErr)
+			assert.Equal(t, copiedDigest, tagErr.ExistingDigest)
+			assert.Equal(t, digest.Digest(""), tagErr.NewDigest)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		// Copying a different image
+		_, err = Image(ctx, policyContext, destRef, otherRef, options)
+		var tagErr *TagExistsError
+		require.ErrorAs(t, err, &tagErr, policy)
+		assert.Equal(t, copiedDigest, tagErr.ExistingDigest)
+		if policy == RejectChangedTag {
+			assert.NotEqual(t, digest.Digest(""), tagErr.NewDigest)
+			assert.NotEqual(t, copiedDigest, tagErr.NewDigest)
+		}
+		existing, err := existingManifestDigest(ctx, destRef, nil)
+		require.NoError(t, err)
+		assert.Equal(t, copiedDigest, existing, policy)
+
+		// The default is to overwrite
+		otherCopied, err := Image(ctx, policyContext, destRef, otherRef, nil)
+		require.NoError(t, err)
+		existing, err = existingManifestDigest(ctx, destRef, nil)
+		require.NoError(t, err)
+		assert.Equal(t, digest.FromBytes(otherCopied), existing, policy)
+	}
+
+	destRef, err := layout.NewReference(layoutDir, "tag")
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, destRef, srcRef, &Options{ExistingTag: RejectChangedTag + 1})
+	assert.Error(t, err)
+}
+
+// listTypesDestinationReference is a types.ImageReference whose image destinations support only supportedTypes.
+type listTypesDestinationReference struct {
+	types.ImageReference
+	supportedTypes []string
+}
+
+func (ref listTypesDestinationReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := ref.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return listTypesDestination{ImageDestination: dest, supportedTypes: ref.supportedTypes}, nil
+}
+
+// listTypesDestination is a types.ImageDestination for a listTypesDestinationReference.
+type listTypesDestination struct {
+	types.ImageDestination
+	supportedTypes []string
+}
+
+func (d listTypesDestination) SupportedManifestMIMETypes() []string {
+	return d.supportedTypes
+}
+
+func TestExistingTagManifestListFormats(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	layer := []byte("layer contents")
+	configDigest := digest.FromBytes(config)
+	layerDigest := digest.FromBytes(layer)
+	instance := []byte(`{"schemaVersion":2,"mediaType":"` + manifest.DockerV2Schema2MediaType + `",` +
+		`"config":{"mediaType":"` + manifest.DockerV2Schema2ConfigMediaType + `","digest":"` + configDigest.String() + `","size":` + strconv.Itoa(len(config)) + `},` +
+		`"layers":[{"mediaType":"` + manifest.DockerV2Schema2LayerMediaType + `","digest":"` + layerDigest.String() + `","size":` + strconv.Itoa(len(layer)) + `}]}`)
+	instanceDigest := digest.FromBytes(instance)
+	list, err := internalManifest.Schema2ListPublicFromComponents([]internalManifest.Schema2ManifestDescriptor{{
+		Schema2Descriptor: internalManifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2MediaType,
+			Digest:    instanceDigest,
+			Size:      int64(len(instance)),
+		},
+		Platform: internalManifest.Schema2PlatformSpec{OS: "linux", Architecture: "amd64"},
+	}}).Serialize()
+	require.NoError(t, err)
+
+	srcRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dest, err := srcRef.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	_, err = dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Digest: configDigest, Size: int64(len(config))}, none.NoCache, true)
+	require.NoError(t, err)
+	_, err = dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: layerDigest, Size: int64(len(layer))}, none.NoCache, false)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, instance, &instanceDigest)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, list, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	dirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	options := &Options{ImageListSelection: CopyAllImages, ExistingTag: RejectChangedTag}
+
+	// Write the list converted to an OCI index.
+	ociOnlyRef := listTypesDestinationReference{ImageReference: dirRef, supportedTypes: []string{imgspecv1.MediaTypeImageIndex, manifest.DockerV2Schema2MediaType}}
+	copied, err := Image(ctx, policyContext, ociOnlyRef, srcRef, options)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, manifest.GuessMIMEType(copied))
+
+	// The unconverted list is the first candidate, but only the OCI index matches the existing tag.
+	bothTypesRef := listTypesDestinationReference{ImageReference: dirRef, supportedTypes: []string{imgspecv1.MediaTypeImageIndex, manifest.DockerV2ListMediaType, manifest.DockerV2Schema2MediaType}}
+	recopied, err := Image(ctx, policyContext, bothTypesRef, srcRef, options)
+	require.NoError(t, err)
+	assert.Equal(t, copied, recopied)
+
+	// If no candidate matches the existing tag, the *TagExistsError is reported.
+	dockerOnlyRef := listTypesDestinationReference{ImageReference: dirRef, supportedTypes: []string{manifest.DockerV2ListMediaType, manifest.DockerV2Schema2MediaType}}
+	_, err = Image(ctx, policyContext, dockerOnlyRef, srcRef, options)
+	var tagErr *TagExistsError
+	require.ErrorAs(t, err, &tagErr)
+	assert.Equal(t, digest.FromBytes(copied), tagErr.ExistingDigest)
+	assert.Equal(t, digest.FromBytes(list), tagErr.NewDigest)
+}
@@ -35,6 +35,7 @@ type instanceCopy struct {
 	// Fields which can be used by callers when operation
 	// is `instanceCopyCopy`
 	copyForceCompressionFormat bool
+	copyNestedList             bool // The instance is a manifest list, to be copied with all of its instances
 
 	// Fields which can be used by callers when operation
 	// is `instanceCopyClone`
@@ -69,6 +70,18 @@ func platformV1ToPlatformComparable(platform *imgspecv1.Platform) platformCompar
 	}
 }
 
+// platformMatchesAny returns true if platform matches one of wanted; an empty Variant or OSVersion in wanted matches any value.
+func platformMatchesAny(platform *imgspecv1.Platform, wanted []imgspecv1.Platform) bool {
+	if platform == nil {
+		return false
+	}
+	return slices.ContainsFunc(wanted, func(w imgspecv1.Platform) bool {
+		return w.OS == platform.OS && w.Architecture == platform.Architecture &&
+			(w.Variant == "" || w.Variant == platform.Variant) &&
+			(w.OSVersion == "" || w.OSVersion == platform.OSVersion)
+	})
+}
+
 // platformCompressionMap prepares a mapping of platformComparable -> CompressionAlgorithmNames for given digests
 func platformCompressionMap(list internalManifest.List, instanceDigests []digest.Digest) (map[platformComparable]*set.Set[string], error) {
 	res := make(map[platformComparable]*set.Set[string])
@@ -118,19 +131,29 @@ func prepareInstanceCopies(list internalManifest.List, instanceDigests []digest.
 		return nil, err
 	}
 	for i, instanceDigest := range instanceDigests {
-		if options.ImageListSelection == CopySpecificImages &&
-			!slices.Contains(options.Instances, instanceDigest) {
-			logrus.Debugf("Skipping instance %s (%d/%d)", instanceDigest, i+1, len(instanceDigests))
-			continue
-		}
 		instanceDetails, err := list.Instance(instanceDigest)
 		if err != nil {
 			return res, fmt.Errorf("getting details for instance %s: %w", instanceDigest, err)
 		}
+		if options.ImageListSelection == CopySpecificImages &&
+			!slices.Contains(options.Instances, instanceDigest) &&
+			!platformMatchesAny(instanceDetails.ReadOnly.Platform, options.InstancePlatforms) {
+			logrus.Debugf("Skipping instance %s (%d/%d)", instanceDigest, i+1, len(instanceDigests))
+			continue
+		}
 		forceCompressionFormat, err := shouldRequireCompressionFormatMatch(options)
 		if err != nil {
 			return nil, err
 		}
+		if manifest.MIMETypeIsMultiImage(instanceDetails.MediaType) {
+			// A nested manifest list is copied with all of its instances; it has no layers to compress differently.
+			res = append(res, instanceCopy{
+				op:             instanceCopyCopy,
+				sourceDigest:   instanceDigest,
+				copyNestedList: true,
+			})
+			continue
+		}
 		res = append(res, instanceCopy{
 			op:                         instanceCopyCopy,
 			sourceDigest:               instanceDigest,
@@ -232,6 +255,24 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 	if err != nil {
 		return nil, fmt.Errorf("preparing instances for copy: %w", err)
 	}
+	// Remove the instances which will not be copied, if requested.
+	if c.options.ImageListSelection == CopySpecificImages && c.options.SparseManifestListAction == StripSparseManifestList {
+		copiedInstances := set.New[digest.Digest]()
+		for _, instance := range instanceCopyList {
+			copiedInstances.Add(instance.sourceDigest)
+		}
+		for _, instanceDigest := range instanceDigests {
+			if !copiedInstances.Contains(instanceDigest) {
+				if cannotModifyManifestListReason != "" {
+					return nil, fmt.Errorf("Instances not copied must be removed from the manifest list, but we cannot modify it: %q", cannotModifyManifestListReason)
+				}
+				instanceEdits = append(instanceEdits, internalManifest.ListEdit{
+					ListOperation: internalManifest.ListOpRemove,
+					RemoveDigest:  instanceDigest,
+				})
+			}
+		}
+	}
 	c.Printf("Copying %d images generated from %d images in list\n", len(instanceCopyList), len(instanceDigests))
 	for i, instance := range instanceCopyList {
 		// Update instances to be edited by their `ListOperation` and
@@ -239,9 +280,15 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 		switch instance.op {
 		case instanceCopyCopy:
 			logrus.Debugf("Copying instance %s (%d/%d)", instance.sourceDigest, i+1, len(instanceCopyList))
-			c.Printf("Copying image %s (%d/%d)\n", instance.sourceDigest, i+1, len(instanceCopyList))
-			unparsedInstance := image.UnparsedInstance(c.rawSource, &instanceCopyList[i].sourceDigest)
-			updated, err := c.copySingleImage(ctx, unparsedInstance, &instanceCopyList[i].sourceDigest, copySingleImageOptions{requireCompressionFormatMatch: instance.copyForceCompressionFormat})
+			var updated copySingleImageResult
+			if instance.copyNestedList {
+				c.Printf("Copying nested manifest list %s (%d/%d)\n", instance.sourceDigest, i+1, len(instanceCopyList))
+				updated, err = c.copyNestedList(ctx, instance.sourceDigest, 2, cannotModifyManifestListReason)
+			} else {
+				c.Printf("Copying image %s (%d/%d)\n", instance.sourceDigest, i+1, len(instanceCopyList))
+				unparsedInstance := image.UnparsedInstance(c.rawSource, &instanceCopyList[i].sourceDigest)
+				updated, err = c.copySingleImage(ctx, unparsedInstance, &instanceCopyList[i].sourceDigest, copySingleImageOptions{requireCompressionFormatMatch: instance.copyForceCompressionFormat})
+			}
 			if err != nil {
 				return nil, fmt.Errorf("copying image %d/%d from manifest list: %w", i+1, len(instanceCopyList), err)
 			}
@@ -280,6 +327,11 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 		}
 	}
 
+	if c.dryRunReport != nil {
+		c.dryRunReport.ManifestListMIMEType = selectedListType
+		return nil, nil
+	}
+
 	// Now reset the digest/size/types of the manifests in the list to account for any conversions that we made.
 	if err = updatedList.EditInstances(instanceEdits); err != nil {
 		return nil, fmt.Errorf("updating manifest list: %w", err)
@@ -288,6 +340,8 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 	// Iterate through supported list types, preferred format first.
 	c.Printf("Writing manifest list to image destination\n")
 	var errs []string
+	var tagErr error // The first error from checkToplevelManifest, if any
+	tagErrCount := 0
 	for _, thisListType := range append([]string{selectedListType}, otherManifestMIMETypeCandidates...) {
 		var attemptedList internalManifest.ListPublic = updatedList
 
@@ -324,6 +378,16 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 		}
 
 		// Save the manifest list.
+		// With options.ExistingTag, the existing tag might have been written using one of the other candidate formats, so keep trying.
+		if err := c.checkToplevelManifest(attemptedManifestList); err != nil {
+			logrus.Debugf("Manifest list type %s can not be written: %v", thisListType, err)
+			errs = append(errs, fmt.Sprintf("%s(%v)", thisListType, err))
+			if tagErr == nil {
+				tagErr = err
+			}
+			tagErrCount++
+			continue
+		}
 		err = c.dest.PutManifest(ctx, attemptedManifestList, nil)
 		if err != nil {
 			logrus.Debugf("Upload of manifest list type %s failed: %v", thisListType, err)
@@ -335,6 +399,10 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 		break
 	}
 	if errs != nil {
+		if tagErrCount == len(errs) {
+			// No format was acceptable to options.ExistingTag; report that as is, so that callers can recognize a *TagExistsError.
+			return nil, tagErr
+		}
 		return nil, fmt.Errorf("Uploading manifest list failed, attempted the following formats: %s", strings.Join(errs, ", "))
 	}
 
@@ -352,3 +420,88 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 
 	return manifestList, nil
 }
+
+// copyNestedList copies listDigest, a manifest list which is an instance of the manifest list being copied,
+// and all of its instances (recursively, if they are manifest lists as well), and writes it to the destination
+// as an instance. depth is the nesting depth of listDigest; the top-level manifest list is at depth 1.
+// cannotModifyManifestListReason is the reason why the list must not be modified, or "" if it can be.
+// The nested list is never converted to a different manifest list type.
+func (c *copier) copyNestedList(ctx context.Context, listDigest digest.Digest, depth int, cannotModifyManifestListReason string) (copySingleImageResult, error) {
+	if depth > image.MaxNestedListDepth {
+		return copySingleImageResult{}, fmt.Errorf("manifest lists are nested more than %d levels deep", image.MaxNestedListDepth)
+	}
+	manifestList, manifestType, err := image.UnparsedInstance(c.rawSource, &listDigest).Manifest(ctx)
+	if err != nil {
+		return copySingleImageResult{}, fmt.Errorf("reading nested manifest list %s: %w", listDigest, err)
+	}
+	originalList, err := internalManifest.ListFromBlob(manifestList, manifestType)
+	if err != nil {
+		return copySingleImageResult{}, fmt.Errorf("parsing nested manifest list %s: %w", listDigest, err)
+	}
+	updatedList := originalList.CloneInternal()
+
+	instanceDigests := originalList.Instances()
+	instanceEdits := []internalManifest.ListEdit{}
+	for i, instanceDigest := range instanceDigests {
+		instanceDetails, err := originalList.Instance(instanceDigest)
+		if err != nil {
+			return copySingleImageResult{}, fmt.Errorf("getting details for instance %s: %w", instanceDigest, err)
+		}
+		var updated copySingleImageResult
+		if manifest.MIMETypeIsMultiImage(instanceDetails.MediaType) {
+			c.Printf("Copying nested manifest list %s (%d/%d) from %s\n", instanceDigest, i+1, len(instanceDigests), listDigest)
+			updated, err = c.copyNestedList(ctx, instanceDigest, depth+1, cannotModifyManifestListReason)
+		} else {
+			c.Printf("Copying image %s (%d/%d) from %s\n", instanceDigest, i+1, len(instanceDigests), listDigest)
+			unparsedInstance := image.UnparsedInstance(c.rawSource, &instanceDigest)
+			updated, err = c.copySingleImage(ctx, unparsedInstance, &instanceDigest, copySingleImageOptions{})
+		}
+		if err != nil {
+			return copySingleImageResult{}, fmt.Errorf("copying image %d/%d from nested manifest list %s: %w", i+1, len(instanceDigests), listDigest, err)
+		}
+		instanceEdits = append(instanceEdits, internalManifest.ListEdit{
+			ListOperation:               internalManifest.ListOpUpdate,
+			UpdateOldDigest:             instanceDigest,
+			UpdateDigest:                updated.manifestDigest,
+			UpdateSize:                  int64(len(updated.manifest)),
+			UpdateCompressionAlgorithms: updated.compressionAlgorithms,
+			UpdateMediaType:             updated.manifestMIMEType})
+	}
+
+	if c.dryRunReport != nil {
+		return copySingleImageResult{}, nil
+	}
+
+	if err = updatedList.EditInstances(instanceEdits); err != nil {
+		return copySingleImageResult{}, fmt.Errorf("updating nested manifest list %s: %w", listDigest, err)
+	}
+	updatedManifestList, err := updatedList.Serialize()
+	if err != nil {
+		return copySingleImageResult{}, fmt.Errorf("encoding updated nested manifest list %s: %w", listDigest, err)
+	}
+	originalManifestList, err := originalList.Serialize()
+	if err != nil {
+		return copySingleImageResult{}, fmt.Errorf("encoding original nested manifest list %s for comparison: %w", listDigest, err)
+	}
+	if !bytes.Equal(updatedManifestList, originalManifestList) {
+		if cannotModifyManifestListReason != "" {
+			return copySingleImageResult{}, fmt.Errorf("Nested manifest list %s must be updated to be written to destination, but we cannot modify it: %q", listDigest, cannotModifyManifestListReason)
+		}
+		logrus.Debugf("Nested manifest list %s has been updated", listDigest)
+	} else {
+		// Use the original value so that we don't change the digest.
+		updatedManifestList = manifestList
+	}
+	updatedDigest, err := c.destinationManifestDigest(updatedManifestList, &listDigest)
+	if err != nil {
+		return copySingleImageResult{}, err
+	}
+	if err := c.dest.PutManifest(ctx, updatedManifestList, &updatedDigest); err != nil {
+		return copySingleImageResult{}, fmt.Errorf("writing nested manifest list %s: %w", listDigest, err)
+	}
+	return copySingleImageResult{
+		manifest:         updatedManifestList,
+		manifestMIMEType: originalList.MIMEType(),
+		manifestDigest:   updatedDigest,
+	}, nil
+}
@@ -1,13 +1,21 @@
 package copy
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/containers/image/v5/directory"
 	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -160,3 +168,135 @@ func convertInstanceCopyToSimplerInstanceCopy(copies []instanceCopy) []simplerIn
 	}
 	return res
 }
+
+// Test selecting instances by platform.
+func TestPrepareCopyInstancesforInstancePlatforms(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("..", "internal", "manifest", "testdata", "oci1.index.zstd-selection.json"))
+	require.NoError(t, err)
+	list, err := internalManifest.ListFromBlob(validManifest, internalManifest.GuessMIMEType(validManifest))
+	require.NoError(t, err)
+
+	sourceInstances := []digest.Digest{
+		digest.Digest("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+		digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"),
+		digest.Digest("sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"),
+	}
+
+	// Instances are selected if they match either Instances or InstancePlatforms
+	instancesToCopy, err := prepareInstanceCopies(list, sourceInstances, &Options{
+		ImageListSelection: CopySpecificImages,
+		Instances:          []digest.Digest{sourceInstances[0]},
+		InstancePlatforms:  []imgspecv1.Platform{{OS: "linux", Architecture: "s390x"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []instanceCopy{
+		{op: instanceCopyCopy, sourceDigest: sourceInstances[0]},
+		{op: instanceCopyCopy, sourceDigest: sourceInstances[2]},
+	}, instancesToCopy)
+
+	// InstancePlatforms is ignored with CopyAllImages
+	instancesToCopy, err = prepareInstanceCopies(list, sourceInstances, &Options{
+		InstancePlatforms: []imgspecv1.Platform{{OS: "linux", Architecture: "s390x"}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, instancesToCopy, len(sourceInstances))
+}
+
+func TestPlatformMatchesAny(t *testing.T) {
+	wanted := []imgspecv1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm", Variant: "v7"},
+	}
+	for _, c := range []struct {
+		platform *imgspecv1.Platform
+		expected bool
+	}{
+		{nil, false},
+		{&imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, true},
+		{&imgspecv1.Platform{OS: "linux", Architecture: "amd64", Variant: "v3"}, true},
+		{&imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1"}, false},
+		{&imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, true},
+		{&imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, false},
+		{&imgspecv1.Platform{OS: "linux", Architecture: "arm64"}, false},
+	} {
+		assert.Equal(t, c.expected, platformMatchesAny(c.platform, wanted), "%#v", c.platform)
+	}
+	assert.False(t, platformMatchesAny(&imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, nil))
+}
+
+func TestCopyNestedManifestLists(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err := gzipWriter.Write([]byte("layer contents"))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	layer := gzipped.Bytes()
+	configDigest := digest.FromBytes(config)
+	layerDigest := digest.FromBytes(layer)
+	instance := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest.String() + `","size":` + strconv.Itoa(len(config)) + `},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"` + layerDigest.String() + `","size":` + strconv.Itoa(len(layer)) + `}]}`)
+	instanceDigest := digest.FromBytes(instance)
+	nested, err := internalManifest.OCI1IndexPublicFromComponents([]imgspecv1.Descriptor{{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    instanceDigest,
+		Size:      int64(len(instance)),
+		Platform:  &imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+	}}, nil).Serialize()
+	require.NoError(t, err)
+	nestedDigest := digest.FromBytes(nested)
+	toplevel, err := internalManifest.OCI1IndexPublicFromComponents([]imgspecv1.Descriptor{{
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Digest:    nestedDigest,
+		Size:      int64(len(nested)),
+	}}, nil).Serialize()
+	require.NoError(t, err)
+
+	srcRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dest, err := srcRef.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	_, err = dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Digest: configDigest, Size: int64(len(config))}, none.NoCache, true)
+	require.NoError(t, err)
+	_, err = dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: layerDigest, Size: int64(len(layer))}, none.NoCache, false)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, instance, &instanceDigest)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, nested, &nestedDigest)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, toplevel, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// Copying all images copies the nested list and its instances verbatim
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	copiedManifest, err := Image(ctx, policyContext, destRef, srcRef, &Options{ImageListSelection: CopyAllImages})
+	require.NoError(t, err)
+	assert.Equal(t, toplevel, copiedManifest)
+	for d, expected := range map[digest.Digest][]byte{nestedDigest: nested, instanceDigest: instance} {
+		contents, err := os.ReadFile(filepath.Join(destRef.StringWithinTransport(), d.Encoded()+".manifest.json"))
+		require.NoError(t, err)
+		assert.Equal(t, expected, contents)
+	}
+
+	// Copying the system image chooses an instance of the nested list
+	destRef, err = directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	copiedManifest, err = Image(ctx, policyContext, destRef, srcRef, &Options{
+		ImageListSelection: CopySystemImage,
+		SourceCtx:          &types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "linux"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, instance, copiedManifest)
+}
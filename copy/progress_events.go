@@ -0,0 +1,184 @@
+package copy
+
+import (
+	"io"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// defaultProgressEventInterval is the interval between ProgressEventBlobRead events if Options.ProgressInterval is not set.
+const defaultProgressEventInterval = time.Second
+
+// ProgressEventType is the type of a ProgressEvent.
+// Warning: new event types may be added any time.
+type ProgressEventType int
+
+const (
+	// ProgressEventImageStarted is reported when copying the blobs of a single image starts.
+	// TotalBlobs and TotalSize describe the layers and config of the image.
+	ProgressEventImageStarted ProgressEventType = iota
+	// ProgressEventBlobStarted is reported when copying Blob starts.
+	ProgressEventBlobStarted
+	// ProgressEventBlobRead is reported periodically while Blob is being read from the source.
+	// Offset is the number of bytes read so far, Increment the number of bytes read since the previous event for Blob.
+	ProgressEventBlobRead
+	// ProgressEventBlobReused is reported instead of ProgressEventBlobStarted and later events if Blob has not been copied
+	// because the destination already contains it, or an equivalent blob, described by DestinationBlob.
+	ProgressEventBlobReused
+	// ProgressEventBlobCompressionChanged is reported when Blob is being compressed, decompressed or recompressed;
+	// DestinationBlob.CompressionOperation and DestinationBlob.CompressionAlgorithm describe the change.
+	ProgressEventBlobCompressionChanged
+	// ProgressEventBlobDone is reported after Blob has been copied to the destination, as DestinationBlob.
+	// Offset is the total number of bytes read, Increment the number of bytes read since the previous event for Blob.
+	ProgressEventBlobDone
+	// ProgressEventImageDone is reported after the manifest of a single image has been written.
+	// CopiedBlobs, ReusedBlobs and BytesRead summarize the blobs of the image.
+	ProgressEventImageDone
+)
+
+// ProgressEvent is a report of the progress of copying an image, reported to Options.ProgressCallback.
+// Only the fields relevant to Type are set.
+type ProgressEvent struct {
+	Type ProgressEventType
+	// Image is the digest of the source manifest of the single image being copied
+	// (an instance of the manifest list, when copying manifest lists).
+	Image digest.Digest
+
+	Blob            types.BlobInfo // The source blob
+	IsConfig        bool           // Blob is the config of Image, not a layer
+	DestinationBlob types.BlobInfo // The blob at the destination
+	Offset          uint64
+	Increment       uint64
+
+	TotalBlobs  int
+	TotalSize   int64 // -1 if unknown
+	CopiedBlobs int
+	ReusedBlobs int
+	BytesRead   uint64
+}
+
+// imageProgressStats accumulates the statistics of a single image reported in ProgressEventImageDone.
+type imageProgressStats struct {
+	copiedBlobs int
+	reusedBlobs int
+	bytesRead   uint64
+}
+
+// reportProgress reports event for ic to ic.c.options.ProgressCallback, if any.
+func (ic *imageCopier) reportProgress(event ProgressEvent) {
+	if ic.c.options.ProgressCallback == nil {
+		return
+	}
+	ic.c.progressCallbackLock.Lock()
+	defer ic.c.progressCallbackLock.Unlock()
+	event.Image = ic.imageDigest
+	switch event.Type {
+	case ProgressEventBlobReused:
+		ic.progressStats.reusedBlobs++
+	case ProgressEventBlobDone:
+		ic.progressStats.copiedBlobs++
+		ic.progressStats.bytesRead += event.Offset
+	case ProgressEventImageDone:
+		event.CopiedBlobs = ic.progressStats.copiedBlobs
+		event.ReusedBlobs = ic.progressStats.reusedBlobs
+		event.BytesRead = ic.progressStats.bytesRead
+	}
+	ic.c.options.ProgressCallback(event)
+}
+
+// progressEventReader is a reader that reports its progress using ProgressEventBlobRead events on an interval.
+type progressEventReader struct {
+	source       io.Reader
+	ic           *imageCopier
+	blob         types.BlobInfo
+	isConfig     bool
+	interval     time.Duration
+	lastUpdate   time.Time
+	offset       uint64
+	offsetUpdate uint64
+}
+
+// newProgressEventReader reports ProgressEventBlobStarted for blob, and returns a reader of source reporting progress of blob.
+func (ic *imageCopier) newProgressEventReader(source io.Reader, blob types.BlobInfo, isConfig bool) *progressEventReader {
+	ic.reportProgress(ProgressEvent{Type: ProgressEventBlobStarted, Blob: blob, IsConfig: isConfig})
+	interval := ic.c.options.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressEventInterval
+	}
+	return &progressEventReader{
+		source:     source,
+		ic:         ic,
+		blob:       blob,
+		isConfig:   isConfig,
+		interval:   interval,
+		lastUpdate: time.Now(),
+	}
+}
+
+// Read reads from the source, and reports progress if the interval has passed.
+func (r *progressEventReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	r.offset += uint64(n)
+	r.offsetUpdate += uint64(n)
+	if time.Since(r.lastUpdate) > r.interval {
+		r.ic.reportProgress(ProgressEvent{
+			Type:      ProgressEventBlobRead,
+			Blob:      r.blob,
+			IsConfig:  r.isConfig,
+			Offset:    r.offset,
+			Increment: r.offsetUpdate,
+		})
+		r.lastUpdate = time.Now()
+		r.offsetUpdate = 0
+	}
+	return n, err
+}
+
+// reportCompressionChange reports a ProgressEventBlobCompressionChanged, if compressionStep changes the compression of the blob.
+func (r *progressEventReader) reportCompressionChange(compressionStep *bpCompressionStepData) {
+	if compressionStep.uploadedOperation == types.PreserveOriginal {
+		return
+	}
+	r.ic.reportProgress(ProgressEvent{
+		Type:     ProgressEventBlobCompressionChanged,
+		Blob:     r.blob,
+		IsConfig: r.isConfig,
+		DestinationBlob: types.BlobInfo{
+			CompressionOperation: compressionStep.uploadedOperation,
+			CompressionAlgorithm: compressionStep.uploadedAlgorithm,
+		},
+	})
+}
+
+// reportDone reports that the blob has been copied as destInfo.
+func (r *progressEventReader) reportDone(destInfo types.BlobInfo) {
+	r.ic.reportProgress(ProgressEvent{
+		Type:            ProgressEventBlobDone,
+		Blob:            r.blob,
+		IsConfig:        r.isConfig,
+		DestinationBlob: destInfo,
+		Offset:          r.offset,
+		Increment:       r.offsetUpdate,
+	})
+	r.offsetUpdate = 0
+}
+
+// reportImageStarted reports ProgressEventImageStarted for ic.
+func (ic *imageCopier) reportImageStarted() {
+	event := ProgressEvent{Type: ProgressEventImageStarted}
+	blobs := ic.src.LayerInfos()
+	if config := ic.src.ConfigInfo(); config.Digest != "" {
+		blobs = append(blobs, config)
+	}
+	event.TotalBlobs = len(blobs)
+	for _, blob := range blobs {
+		if blob.Size == -1 {
+			event.TotalSize = -1
+			break
+		}
+		event.TotalSize += blob.Size
+	}
+	ic.reportProgress(event)
+}
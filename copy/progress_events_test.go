@@ -0,0 +1,70 @@
+package copy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/oci/layout"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressCallback(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("layer contents")
+	srcRef, _ := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, layer, "application/octet-stream")
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+	destRef, err := layout.NewReference(t.TempDir(), "tag")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		expectedTypes []ProgressEventType
+		copied        int
+		reused        int
+		bytes         uint64
+	}{
+		{ // Initial copy
+			expectedTypes: []ProgressEventType{ProgressEventImageStarted,
+				ProgressEventBlobStarted, ProgressEventBlobDone, // layer
+				ProgressEventBlobStarted, ProgressEventBlobDone, // config
+				ProgressEventImageDone},
+			copied: 2, reused: 0, bytes: uint64(len(config) + len(layer)),
+		},
+		{ // The layer already exists at the destination
+			expectedTypes: []ProgressEventType{ProgressEventImageStarted,
+				ProgressEventBlobReused,                         // layer
+				ProgressEventBlobStarted, ProgressEventBlobDone, // config
+				ProgressEventImageDone},
+			copied: 1, reused: 1, bytes: uint64(len(config)),
+		},
+	} {
+		events := []ProgressEvent{}
+		_, err = Image(ctx, policyContext, destRef, srcRef, &Options{
+			ProgressCallback: func(event ProgressEvent) {
+				events = append(events, event)
+			},
+		})
+		require.NoError(t, err)
+		eventTypes := []ProgressEventType{}
+		for _, e := range events {
+			if e.Type != ProgressEventBlobRead {
+				eventTypes = append(eventTypes, e.Type)
+			}
+			assert.NotEmpty(t, e.Image)
+		}
+		require.Equal(t, c.expectedTypes, eventTypes)
+		started := events[0]
+		assert.Equal(t, 2, started.TotalBlobs)
+		assert.Equal(t, int64(len(config)+len(layer)), started.TotalSize)
+		done := events[len(events)-1]
+		assert.Equal(t, c.copied, done.CopiedBlobs)
+		assert.Equal(t, c.reused, done.ReusedBlobs)
+		assert.Equal(t, c.bytes, done.BytesRead)
+	}
+}
@@ -0,0 +1,251 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// validateCopyReferrers returns an error if options.CopyReferrers is set but can not be honored for destRef and srcRef.
+func validateCopyReferrers(destRef, srcRef types.ImageReference, options *Options) error {
+	if !options.CopyReferrers {
+		return nil
+	}
+	if srcRef.Transport().Name() != docker.Transport.Name() || destRef.Transport().Name() != docker.Transport.Name() {
+		return errors.New("copying referrers is only supported when copying between registries")
+	}
+	if srcRef.DockerReference() == nil || destRef.DockerReference() == nil {
+		return errors.New("copying referrers requires named source and destination references")
+	}
+	return nil
+}
+
+// cosignAttachmentSuffixes are the suffixes of the cosign attachment tags copied by copyReferrers.
+// Signatures (".sig") are not included: they are copied as sigstore signatures, if the registry is configured to use sigstore attachments.
+var cosignAttachmentSuffixes = []string{"att", "sbom"}
+
+// copyReferrers copies the manifests in the repository of srcRef which refer to the copied manifest (e.g. signatures,
+// SBOMs or attestations), and, recursively, their referrers, to the repository of destRef.
+// srcInstance is the copied instance of srcRef, or nil if the top-level manifest was copied; copiedManifest
+// is the manifest written to destRef.
+// Referrers are found using the OCI referrers API or its fallback tag schema, and using the cosign attachment tags.
+// The referrers are not subject to the signature policy. They are copied verbatim, except that if the copy changed
+// the digest of the manifest they refer to, their "subject" field is updated to refer to the new digest.
+func (c *copier) copyReferrers(ctx context.Context, destRef, srcRef types.ImageReference, srcInstance *digest.Digest, copiedManifest []byte) error {
+	srcManifest, _, err := image.UnparsedInstance(c.rawSource, srcInstance).Manifest(ctx)
+	if err != nil {
+		return fmt.Errorf("reading source manifest: %w", err)
+	}
+	srcDigest, err := manifest.Digest(srcManifest)
+	if err != nil {
+		return err
+	}
+	copiedDesc, err := manifest.OCI1DescriptorForManifest(copiedManifest, "")
+	if err != nil {
+		return err
+	}
+	copiedDigest := copiedDesc.Digest
+
+	srcRepo := reference.TrimNamed(srcRef.DockerReference())
+	destRepo := reference.TrimNamed(destRef.DockerReference())
+	// Source digest -> descriptor of the corresponding manifest at the destination
+	copied := map[digest.Digest]imgspecv1.Descriptor{srcDigest: copiedDesc}
+	pending := []digest.Digest{srcDigest}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		referrers, err := docker.ListReferrers(ctx, c.options.SourceCtx, srcRef, current, "")
+		if err != nil {
+			return fmt.Errorf("listing referrers of %s: %w", current, err)
+		}
+		for _, referrer := range referrers {
+			if _, ok := copied[referrer.Digest]; ok {
+				continue
+			}
+			srcNamed, err := reference.WithDigest(srcRepo, referrer.Digest)
+			if err != nil {
+				return err
+			}
+			c.Printf("Copying referrer %s (%s)\n", referrer.Digest, referrer.ArtifactType)
+			subject := copied[current]
+			desc, err := c.copyReferrer(ctx, destRepo, "", srcNamed, &subject)
+			if err != nil {
+				return fmt.Errorf("copying referrer %s of %s: %w", referrer.Digest, current, err)
+			}
+			if desc == nil { // Skipped
+				continue
+			}
+			copied[referrer.Digest] = *desc
+			pending = append(pending, referrer.Digest)
+		}
+	}
+
+	tags, err := docker.ListCosignAttachments(ctx, c.options.SourceCtx, srcRef, srcDigest, cosignAttachmentSuffixes)
+	if err != nil {
+		return fmt.Errorf("listing cosign attachments of %s: %w", srcDigest, err)
+	}
+	if len(tags) > 0 && copiedDigest != srcDigest {
+		// The attachments are typically signed, and refer to the digest within the signed payload, so we can’t update them.
+		logrus.Warnf("Not copying cosign attachments %s: they refer to %s, but the copied manifest is %s", strings.Join(tags, ", "), srcDigest, copiedDigest)
+		return nil
+	}
+	for _, tag := range tags {
+		srcNamed, err := reference.WithTag(srcRepo, tag)
+		if err != nil {
+			return err
+		}
+		c.Printf("Copying cosign attachment %s\n", tag)
+		if _, err := c.copyReferrer(ctx, destRepo, tag, srcNamed, nil); err != nil {
+			return fmt.Errorf("copying cosign attachment %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// copyReferrer copies the manifest srcNamed, and the blobs it refers to, to destRepo, using destTag if it is not "",
+// or the digest of the copied manifest otherwise.
+// If subject is not nil, and the manifest refers to a different subject, its subject is replaced by *subject.
+// It returns a descriptor of the manifest written to the destination, or nil if the manifest was skipped.
+func (c *copier) copyReferrer(ctx context.Context, destRepo reference.Named, destTag string, srcNamed reference.Named, subject *imgspecv1.Descriptor) (*imgspecv1.Descriptor, error) {
+	srcRef, err := docker.NewReference(srcNamed)
+	if err != nil {
+		return nil, err
+	}
+	publicSrc, err := srcRef.NewImageSource(ctx, c.options.SourceCtx)
+	if err != nil {
+		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
+	}
+	src := imagesource.FromPublic(publicSrc)
+	defer src.Close()
+
+	unparsed := image.UnparsedInstance(src, nil)
+	m, mimeType, err := unparsed.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		logrus.Warnf("Skipping %s: copying referrers which are manifest lists is not supported", srcNamed.String())
+		return nil, nil
+	}
+	parsed, err := manifest.FromBlob(m, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	if subject != nil && mimeType == imgspecv1.MediaTypeImageManifest {
+		m, err = updateReferrerSubject(m, *subject)
+		if err != nil {
+			return nil, err
+		}
+	}
+	desc, err := manifest.OCI1DescriptorForManifest(m, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	var destNamed reference.Named
+	if destTag != "" {
+		destNamed, err = reference.WithTag(destRepo, destTag)
+	} else {
+		destNamed, err = reference.WithDigest(destRepo, desc.Digest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	destRef, err := docker.NewReference(destNamed)
+	if err != nil {
+		return nil, err
+	}
+	publicDest, err := destRef.NewImageDestination(ctx, c.options.DestinationCtx)
+	if err != nil {
+		return nil, fmt.Errorf("initializing destination %s: %w", transports.ImageName(destRef), err)
+	}
+	dest := imagedestination.FromPublic(publicDest)
+	defer dest.Close()
+
+	srcRepo := reference.TrimNamed(srcNamed)
+	if config := parsed.ConfigInfo(); config.Digest != "" {
+		if err := c.copyReferrerBlob(ctx, dest, src, srcRepo, mimeType, config, nil); err != nil {
+			return nil, err
+		}
+	}
+	for i, layer := range parsed.LayerInfos() {
+		layerIndex := i
+		if err := c.copyReferrerBlob(ctx, dest, src, srcRepo, mimeType, layer.BlobInfo, &layerIndex); err != nil {
+			return nil, err
+		}
+	}
+	if err := dest.PutManifest(ctx, m, nil); err != nil {
+		return nil, fmt.Errorf("writing manifest: %w", err)
+	}
+	if err := dest.Commit(ctx, unparsed); err != nil {
+		return nil, err
+	}
+	return &desc, nil
+}
+
+// updateReferrerSubject returns the OCI manifest m, with its subject replaced by subject if it refers to a different manifest.
+func updateReferrerSubject(m []byte, subject imgspecv1.Descriptor) ([]byte, error) {
+	parsed, err := manifest.OCI1FromManifest(m)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Subject == nil || parsed.Subject.Digest == subject.Digest {
+		return m, nil
+	}
+	logrus.Debugf("Updating referrer subject from %s to %s", parsed.Subject.Digest, subject.Digest)
+	parsed.Subject = &imgspecv1.Descriptor{
+		MediaType: subject.MediaType,
+		Digest:    subject.Digest,
+		Size:      subject.Size,
+	}
+	return parsed.Serialize()
+}
+
+// copyReferrerBlob copies a single blob of a referrer with manifestMIMEType from src to dest, unless dest already contains it.
+// layerIndex is nil for the config blob.
+func (c *copier) copyReferrerBlob(ctx context.Context, dest private.ImageDestination, src private.ImageSource, srcRepo reference.Named,
+	manifestMIMEType string, info types.BlobInfo, layerIndex *int) error {
+	reused, _, err := dest.TryReusingBlobWithOptions(ctx, info, private.TryReusingBlobOptions{
+		Cache:                   c.blobInfoCache,
+		CanSubstitute:           false,
+		LayerIndex:              layerIndex,
+		SrcRef:                  srcRepo,
+		PossibleManifestFormats: []string{manifestMIMEType},
+	})
+	if err != nil {
+		return fmt.Errorf("trying to reuse blob %s: %w", info.Digest, err)
+	}
+	if reused {
+		return nil
+	}
+	stream, size, err := src.GetBlob(ctx, info, c.blobInfoCache)
+	if err != nil {
+		return fmt.Errorf("reading blob %s: %w", info.Digest, err)
+	}
+	defer stream.Close()
+	if info.Size == -1 {
+		info.Size = size
+	}
+	if _, err := dest.PutBlobWithOptions(ctx, stream, info, private.PutBlobOptions{
+		Cache:      c.blobInfoCache,
+		IsConfig:   layerIndex == nil,
+		LayerIndex: layerIndex,
+	}); err != nil {
+		return fmt.Errorf("writing blob %s: %w", info.Digest, err)
+	}
+	return nil
+}
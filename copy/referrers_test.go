@@ -0,0 +1,62 @@
+package copy
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCopyReferrers(t *testing.T) {
+	registryRef, err := docker.ParseReference("//registry.example.com/repo:tag")
+	require.NoError(t, err)
+	otherRegistryRef, err := docker.ParseReference("//mirror.example.com/repo:tag")
+	require.NoError(t, err)
+	dirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		dest, src     types.ImageReference
+		copyReferrers bool
+		shouldFail    bool
+	}{
+		{dirRef, registryRef, false, false},
+		{otherRegistryRef, registryRef, true, false},
+		{dirRef, registryRef, true, true},
+		{registryRef, dirRef, true, true},
+	} {
+		err := validateCopyReferrers(c.dest, c.src, &Options{CopyReferrers: c.copyReferrers})
+		if c.shouldFail {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestUpdateReferrerSubject(t *testing.T) {
+	oldSubject := digest.FromString("old subject")
+	newSubject := imgspecv1.Descriptor{MediaType: manifest.DockerV2Schema2MediaType, Digest: digest.FromString("new subject"), Size: 42}
+	referrer := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"artifactType":"application/spdx+json",` +
+		`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},` +
+		`"layers":[],"subject":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + oldSubject.String() + `","size":1}}`)
+
+	updated, err := updateReferrerSubject(referrer, newSubject)
+	require.NoError(t, err)
+	parsed, err := manifest.OCI1FromManifest(updated)
+	require.NoError(t, err)
+	assert.Equal(t, &newSubject, parsed.Subject)
+	assert.Equal(t, "application/spdx+json", parsed.ArtifactType)
+
+	// No change if the subject already matches
+	res, err := updateReferrerSubject(updated, newSubject)
+	require.NoError(t, err)
+	assert.Equal(t, updated, res)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"reflect"
 	"slices"
 	"strings"
@@ -16,6 +17,7 @@ import (
 	"github.com/containers/image/v5/internal/pkg/platform"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/internal/tracing"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/compression"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
@@ -26,6 +28,7 @@ import (
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/vbauerster/mpb/v8"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // imageCopier tracks state specific to a single image (possibly an item of a manifest list)
@@ -40,6 +43,8 @@ type imageCopier struct {
 	compressionFormat             *compressiontypes.Algorithm // Compression algorithm to use, if the user explicitly requested one, or nil.
 	compressionLevel              *int
 	requireCompressionFormatMatch bool
+	imageDigest                   digest.Digest      // Digest of the source manifest, for progress events
+	progressStats                 imageProgressStats // Protected by c.progressCallbackLock
 }
 
 type copySingleImageOptions struct {
@@ -58,7 +63,14 @@ type copySingleImageResult struct {
 
 // copySingleImage copies a single (non-manifest-list) image unparsedImage, using c.policyContext to validate
 // source image admissibility.
-func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.UnparsedImage, targetInstance *digest.Digest, opts copySingleImageOptions) (copySingleImageResult, error) {
+func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.UnparsedImage, targetInstance *digest.Digest, opts copySingleImageOptions) (_ copySingleImageResult, retErr error) {
+	var spanAttrs []attribute.KeyValue
+	if targetInstance != nil {
+		spanAttrs = append(spanAttrs, tracing.InstanceKey.String(targetInstance.String()))
+	}
+	ctx, span := tracing.StartSpan(ctx, "copy.SingleImage", spanAttrs...)
+	defer func() { tracing.EndSpan(span, retErr) }()
+
 	// The caller is handling manifest lists; this could happen only if a manifest list contains a manifest list.
 	// Make sure we fail cleanly in such cases.
 	multiImage, err := isMultiImage(ctx, unparsedImage)
@@ -108,7 +120,13 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		}
 	}
 
-	if err := checkImageDestinationForCurrentRuntime(ctx, c.options.DestinationCtx, src, c.dest); err != nil {
+	nonImageArtifact := c.options.AllowNonImageArtifacts && isNonImageArtifact(src)
+	if nonImageArtifact {
+		if !c.dest.AcceptsNonImageArtifacts() {
+			return copySingleImageResult{}, fmt.Errorf("destination %s can only store images, not artifacts with config type %q",
+				transports.ImageName(c.dest.Reference()), src.ConfigInfo().MediaType)
+		}
+	} else if err := checkImageDestinationForCurrentRuntime(ctx, c.options.DestinationCtx, src, c.dest); err != nil {
 		return copySingleImageResult{}, err
 	}
 
@@ -132,6 +150,12 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	if c.options.PreserveDigests {
 		cannotModifyManifestReason = "Instructed to preserve digests"
 	}
+	if nonImageArtifact {
+		cannotModifyManifestReason = "Copying a non-image artifact"
+	}
+	if cannotModifyManifestReason != "" && hasImageEdits(c.options) {
+		return copySingleImageResult{}, fmt.Errorf("Editing the image configuration or annotations was requested, but the manifest can not be modified: %s", cannotModifyManifestReason)
+	}
 
 	ic := imageCopier{
 		c:               c,
@@ -187,13 +211,20 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	// If src.UpdatedImageNeedsLayerDiffIDs(ic.manifestUpdates) will be true, it needs to be true by the time we get here.
 	ic.diffIDsAreNeeded = src.UpdatedImageNeedsLayerDiffIDs(*ic.manifestUpdates)
 
+	if c.dryRunReport != nil {
+		if err := ic.recordDryRun(ctx); err != nil {
+			return copySingleImageResult{}, err
+		}
+		return copySingleImageResult{}, nil
+	}
+
 	// If enabled, fetch and compare the destination's manifest. And as an optimization skip updating the destination iff equal
 	if c.options.OptimizeDestinationImageAlreadyExists {
 		shouldUpdateSigs := len(sigs) > 0 || len(c.signers) != 0 // TODO: Consider allowing signatures updates only and skipping the image's layers/manifest copy if possible
 		noPendingManifestUpdates := ic.noPendingManifestUpdates()
 
 		logrus.Debugf("Checking if we can skip copying: has signatures=%t, OCI encryption=%t, no manifest updates=%t, compression match required for resuing blobs=%t", shouldUpdateSigs, destRequiresOciEncryption, noPendingManifestUpdates, opts.requireCompressionFormatMatch)
-		if !shouldUpdateSigs && !destRequiresOciEncryption && noPendingManifestUpdates && !ic.requireCompressionFormatMatch {
+		if !shouldUpdateSigs && !destRequiresOciEncryption && noPendingManifestUpdates && !ic.requireCompressionFormatMatch && !hasImageEdits(c.options) {
 			matchedResult, err := ic.compareImageDestinationManifestEqual(ctx, targetInstance)
 			if err != nil {
 				logrus.Warnf("Failed to compare destination image manifest: %v", err)
@@ -207,6 +238,14 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		}
 	}
 
+	if c.options.ProgressCallback != nil {
+		ic.imageDigest, err = manifest.Digest(src.ManifestBlob)
+		if err != nil {
+			return copySingleImageResult{}, err
+		}
+		ic.reportImageStarted()
+	}
+
 	compressionAlgos, err := ic.copyLayers(ctx)
 	if err != nil {
 		return copySingleImageResult{}, err
@@ -227,13 +266,15 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		logrus.Debugf("Writing manifest using preferred type %s failed: %v", ic.manifestConversionPlan.preferredMIMEType, err)
 		// … if it fails, and the failure is either because the manifest is rejected by the registry, or
 		// because we failed to create a manifest of the specified type because the specific manifest type
-		// doesn't support the type of compression we're trying to use (e.g. docker v2s2 and zstd), we may
-		// have other options available that could still succeed.
+		// doesn't support the type of compression we're trying to use (e.g. docker v2s2 and zstd), or
+		// some of the manifest fields (e.g. an OCI subject), we may have other options available that could still succeed.
 		var manifestTypeRejectedError types.ManifestTypeRejectedError
 		var manifestLayerCompressionIncompatibilityError manifest.ManifestLayerCompressionIncompatibilityError
+		var unsupportedFieldConversionError manifest.UnsupportedFieldConversionError
 		isManifestRejected := errors.As(err, &manifestTypeRejectedError)
 		isCompressionIncompatible := errors.As(err, &manifestLayerCompressionIncompatibilityError)
-		if (!isManifestRejected && !isCompressionIncompatible) || len(ic.manifestConversionPlan.otherMIMETypeCandidates) == 0 {
+		isFieldUnsupported := errors.As(err, &unsupportedFieldConversionError)
+		if (!isManifestRejected && !isCompressionIncompatible && !isFieldUnsupported) || len(ic.manifestConversionPlan.otherMIMETypeCandidates) == 0 {
 			// We don’t have other options.
 			// In principle the code below would handle this as well, but the resulting  error message is fairly ugly.
 			// Don’t bother the user with MIME types if we have no choice.
@@ -289,6 +330,7 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		}
 	}
 	wipResult.compressionAlgorithms = compressionAlgos
+	ic.reportProgress(ProgressEvent{Type: ProgressEventImageDone})
 	res := wipResult // We are done
 	return res, nil
 }
@@ -325,6 +367,11 @@ func checkImageDestinationForCurrentRuntime(ctx context.Context, sys *types.Syst
 	return nil
 }
 
+// isNonImageArtifact returns true if src is an OCI artifact, i.e. its config is not an image configuration.
+func isNonImageArtifact(src *image.SourcedImage) bool {
+	return src.ManifestMIMEType == imgspecv1.MediaTypeImageManifest && src.ConfigInfo().MediaType != imgspecv1.MediaTypeImageConfig
+}
+
 // updateEmbeddedDockerReference handles the Docker reference embedded in Docker schema1 manifests.
 func (ic *imageCopier) updateEmbeddedDockerReference() error {
 	if ic.c.dest.IgnoresEmbeddedDockerReference() {
@@ -569,6 +616,13 @@ func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context, instanc
 		}
 		pendingImage = pi
 	}
+	if hasImageEdits(ic.c.options) {
+		pi, err := ic.applyImageEdits(ctx, pendingImage)
+		if err != nil {
+			return nil, "", err
+		}
+		pendingImage = pi
+	}
 	man, _, err := pendingImage.Manifest(ctx)
 	if err != nil {
 		return nil, "", fmt.Errorf("reading manifest: %w", err)
@@ -579,24 +633,47 @@ func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context, instanc
 	}
 
 	ic.c.Printf("Writing manifest to image destination\n")
-	manifestDigest, err := manifest.Digest(man)
+	manifestDigest, err := ic.c.destinationManifestDigest(man, instanceDigest)
 	if err != nil {
 		return nil, "", err
 	}
 	if instanceDigest != nil {
 		instanceDigest = &manifestDigest
+	} else if err := ic.c.checkToplevelManifest(man); err != nil {
+		return nil, "", err
 	}
-	if err := ic.c.dest.PutManifest(ctx, man, instanceDigest); err != nil {
+	putManifestCtx, span := tracing.StartSpan(ctx, "PutManifest", tracing.TransportKey.String(ic.c.dest.Reference().Transport().Name()))
+	err = ic.c.dest.PutManifest(putManifestCtx, man, instanceDigest)
+	tracing.EndSpan(span, err)
+	if err != nil {
 		logrus.Debugf("Error %v while writing manifest %q", err, string(man))
 		return nil, "", fmt.Errorf("writing manifest: %w", err)
 	}
 	return man, manifestDigest, nil
 }
 
+// destinationManifestDigest returns the digest to use for man when writing it to the destination.
+// If originalDigest is not nil and matches man, it is preserved; otherwise, the digest is computed using c.digestAlgorithm.
+func (c *copier) destinationManifestDigest(man []byte, originalDigest *digest.Digest) (digest.Digest, error) {
+	if originalDigest != nil {
+		matches, err := manifest.MatchesDigest(man, *originalDigest)
+		if err != nil {
+			return "", err
+		}
+		if matches {
+			return *originalDigest, nil
+		}
+	}
+	return manifest.DigestWithAlgorithm(man, c.digestAlgorithm)
+}
+
 // copyConfig copies config.json, if any, from src to dest.
-func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
+func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) (retErr error) {
 	srcInfo := src.ConfigInfo()
 	if srcInfo.Digest != "" {
+		ctx, span := tracing.StartSpan(ctx, "copy.Config", tracing.DigestKey.String(srcInfo.Digest.String()))
+		defer func() { tracing.EndSpan(span, retErr) }()
+
 		if err := ic.c.concurrentBlobCopiesSemaphore.Acquire(ctx, 1); err != nil {
 			// This can only fail with ctx.Err(), so no need to blame acquiring the semaphore.
 			return fmt.Errorf("copying config: %w", err)
@@ -671,7 +748,11 @@ func compressionEditsFromBlobInfo(srcInfo types.BlobInfo) (types.LayerCompressio
 // copyLayer copies a layer with srcInfo (with known Digest and Annotations and possibly known Size) in src to dest, perhaps (de/re/)compressing it,
 // and returns a complete blobInfo of the copied layer, and a value for LayerDiffIDs if diffIDIsNeeded
 // srcRef can be used as an additional hint to the destination during checking whether a layer can be reused but srcRef can be nil.
-func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, toEncrypt bool, pool *mpb.Progress, layerIndex int, srcRef reference.Named, emptyLayer bool) (types.BlobInfo, digest.Digest, error) {
+func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, toEncrypt bool, pool *mpb.Progress, layerIndex int, srcRef reference.Named, emptyLayer bool) (_ types.BlobInfo, _ digest.Digest, retErr error) {
+	ctx, span := tracing.StartSpan(ctx, "copy.Layer", tracing.DigestKey.String(srcInfo.Digest.String()),
+		tracing.SizeKey.Int64(srcInfo.Size), tracing.LayerIndexKey.Int(layerIndex))
+	defer func() { tracing.EndSpan(span, retErr) }()
+
 	// If the srcInfo doesn't contain compression information, try to compute it from the
 	// MediaType, which was either read from a manifest by way of LayerInfos() or constructed
 	// by LayerInfosForCopy(), if it was supplied at all.  If we succeed in copying the blob,
@@ -764,8 +845,10 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 					Artifact: srcInfo,
 				}
 			}
+			destInfo := updatedBlobInfoFromReuse(srcInfo, reusedBlob)
+			ic.reportProgress(ProgressEvent{Type: ProgressEventBlobReused, Blob: srcInfo, DestinationBlob: destInfo})
 
-			return updatedBlobInfoFromReuse(srcInfo, reusedBlob), cachedDiffID, nil
+			return destInfo, cachedDiffID, nil
 		}
 	}
 
@@ -801,7 +884,10 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 				bar.mark100PercentComplete()
 				hideProgressBar = false
 				logrus.Debugf("Retrieved partial blob %v", srcInfo.Digest)
-				return true, updatedBlobInfoFromUpload(srcInfo, uploadedBlob), nil
+				destInfo := updatedBlobInfoFromUpload(srcInfo, uploadedBlob)
+				ic.reportProgress(ProgressEvent{Type: ProgressEventBlobStarted, Blob: srcInfo})
+				ic.reportProgress(ProgressEvent{Type: ProgressEventBlobDone, Blob: srcInfo, DestinationBlob: destInfo})
+				return true, destInfo, nil
 			}
 			logrus.Debugf("Failed to retrieve partial blob: %v", err)
 			return false, types.BlobInfo{}, nil
@@ -815,14 +901,16 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 	}
 
 	// Fallback: copy the layer, computing the diffID if we need to do so
-	return func() (types.BlobInfo, digest.Digest, error) { // A scope for defer
+	copyFromSource := func() (types.BlobInfo, digest.Digest, error) { // A scope for defer
 		bar, err := ic.c.createProgressBar(pool, false, srcInfo, "blob", "done")
 		if err != nil {
 			return types.BlobInfo{}, "", err
 		}
 		defer bar.Abort(false)
 
-		srcStream, srcBlobSize, err := ic.c.rawSource.GetBlob(ctx, srcInfo, ic.c.blobInfoCache)
+		getBlobCtx, span := tracing.StartSpan(ctx, "GetBlob", tracing.TransportKey.String(ic.c.rawSource.Reference().Transport().Name()))
+		srcStream, srcBlobSize, err := ic.c.rawSource.GetBlob(getBlobCtx, srcInfo, ic.c.blobInfoCache)
+		tracing.EndSpan(span, err)
 		if err != nil {
 			return types.BlobInfo{}, "", fmt.Errorf("reading blob %s: %w", srcInfo.Digest, err)
 		}
@@ -860,7 +948,18 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 
 		bar.mark100PercentComplete()
 		return blobInfo, diffID, nil
-	}()
+	}
+	var blobInfo types.BlobInfo
+	var diffID digest.Digest
+	err := ic.c.retryLayerCopy(ctx, srcInfo, func() error {
+		var err error
+		blobInfo, diffID, err = copyFromSource()
+		return err
+	})
+	if err != nil {
+		return types.BlobInfo{}, "", err
+	}
+	return blobInfo, diffID, nil
 }
 
 // updatedBlobInfoFromReuse returns inputInfo updated with reusedBlob which was created based on inputInfo.
@@ -872,9 +971,9 @@ func updatedBlobInfoFromReuse(inputInfo types.BlobInfo, reusedBlob private.Reuse
 	res := types.BlobInfo{
 		Digest:               reusedBlob.Digest,
 		Size:                 reusedBlob.Size,
-		URLs:                 nil,                   // This _must_ be cleared if Digest changes; clear it in other cases as well, to preserve previous behavior.
-		Annotations:          inputInfo.Annotations, // FIXME: This should remove zstd:chunked annotations (but those annotations being left with incorrect values should not break pulls)
-		MediaType:            inputInfo.MediaType,   // Mostly irrelevant, MediaType is updated based on Compression*/CryptoOperation.
+		URLs:                 nil, // This _must_ be cleared if Digest changes; clear it in other cases as well, to preserve previous behavior.
+		Annotations:          inputInfo.Annotations,
+		MediaType:            inputInfo.MediaType, // Mostly irrelevant, MediaType is updated based on Compression*/CryptoOperation.
 		CompressionOperation: reusedBlob.CompressionOperation,
 		CompressionAlgorithm: reusedBlob.CompressionAlgorithm,
 		CryptoOperation:      inputInfo.CryptoOperation, // Expected to be unset anyway.
@@ -885,6 +984,20 @@ func updatedBlobInfoFromReuse(inputInfo types.BlobInfo, reusedBlob private.Reuse
 	if reusedBlob.Digest == inputInfo.Digest {
 		res.CompressionOperation = inputInfo.CompressionOperation
 		res.CompressionAlgorithm = inputInfo.CompressionAlgorithm
+	} else if res.Annotations != nil {
+		// The blob was substituted; annotations describing the compressed representation of the original blob
+		// (e.g. a zstd:chunked TOC location) are not valid for the substitute.
+		res.Annotations = maps.Clone(res.Annotations)
+		maps.DeleteFunc(res.Annotations, func(key, _ string) bool {
+			return isCompressionAnnotation(key)
+		})
+	}
+	if len(reusedBlob.CompressionAnnotations) != 0 {
+		res.Annotations = maps.Clone(res.Annotations)
+		if res.Annotations == nil {
+			res.Annotations = map[string]string{}
+		}
+		maps.Copy(res.Annotations, reusedBlob.CompressionAnnotations)
 	}
 	return res
 }
@@ -2,16 +2,26 @@ package copy
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker/archive"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/blobinfocache"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/pkg/compression"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -71,10 +81,49 @@ func TestUpdatedBlobInfoFromReuse(t *testing.T) {
 				// CryptoOperation is set to the zero value
 			},
 		},
+		{ // Reuse with substitution by a blob with compression annotations
+			reused: private.ReusedBlob{
+				Digest:                 "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				Size:                   513543640,
+				CompressionOperation:   types.Compress,
+				CompressionAlgorithm:   &compression.ZstdChunked,
+				CompressionAnnotations: map[string]string{"zstd-toc": "value"},
+			},
+			expected: types.BlobInfo{
+				Digest:               "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				Size:                 513543640,
+				URLs:                 nil,
+				Annotations:          map[string]string{"test-annotation-2": "two", "zstd-toc": "value"},
+				MediaType:            imgspecv1.MediaTypeImageLayerGzip,
+				CompressionOperation: types.Compress,
+				CompressionAlgorithm: &compression.ZstdChunked,
+				// CryptoOperation is set to the zero value
+			},
+		},
 	} {
 		res := updatedBlobInfoFromReuse(srcInfo, c.reused)
 		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v", c.reused))
 	}
+	// The input annotations are not modified
+	assert.Equal(t, map[string]string{"test-annotation-2": "two"}, srcInfo.Annotations)
+
+	// Compression-specific annotations of the original blob are dropped if the blob is substituted
+	chunkedInfo := srcInfo
+	chunkedInfo.Annotations = map[string]string{
+		"test-annotation-2": "two",
+		"io.github.containers.zstd-chunked.manifest-checksum": "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+		"io.github.containers.zstd-chunked.manifest-position": "1:2:3:4",
+	}
+	res := updatedBlobInfoFromReuse(chunkedInfo, private.ReusedBlob{Digest: chunkedInfo.Digest, Size: chunkedInfo.Size})
+	assert.Equal(t, chunkedInfo.Annotations, res.Annotations)
+	res = updatedBlobInfoFromReuse(chunkedInfo, private.ReusedBlob{
+		Digest:               "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		Size:                 513543640,
+		CompressionOperation: types.Compress,
+		CompressionAlgorithm: &compression.Gzip,
+	})
+	assert.Equal(t, map[string]string{"test-annotation-2": "two"}, res.Annotations)
+	assert.Len(t, chunkedInfo.Annotations, 3)
 }
 
 func goDiffIDComputationGoroutineWithTimeout(layerStream io.ReadCloser, decompressor compressiontypes.DecompressorFunc) *diffIDResult {
@@ -89,6 +138,30 @@ func goDiffIDComputationGoroutineWithTimeout(layerStream io.ReadCloser, decompre
 	}
 }
 
+func TestDestinationManifestDigest(t *testing.T) {
+	man := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	sha256Digest := digest.FromBytes(man)
+	sha512Digest := digest.SHA512.FromBytes(man)
+	otherDigest := digest.FromBytes([]byte("other"))
+
+	for _, c := range []struct {
+		algorithm digest.Algorithm
+		original  *digest.Digest
+		expected  digest.Digest
+	}{
+		{digest.SHA256, nil, sha256Digest},
+		{digest.SHA512, nil, sha512Digest},
+		{digest.SHA256, &sha512Digest, sha512Digest}, // Matching original digests are preserved
+		{digest.SHA512, &sha256Digest, sha256Digest},
+		{digest.SHA512, &otherDigest, sha512Digest}, // Modified manifests use the configured algorithm
+	} {
+		c2 := &copier{digestAlgorithm: c.algorithm}
+		res, err := c2.destinationManifestDigest(man, c.original)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, res)
+	}
+}
+
 func TestDiffIDComputationGoroutine(t *testing.T) {
 	stream, err := os.Open("fixtures/Hello.uncompressed")
 	require.NoError(t, err)
@@ -139,3 +212,106 @@ func TestComputeDiffID(t *testing.T) {
 	_, err = computeDiffID(reader, nil)
 	assert.Error(t, err)
 }
+
+// newDirTestImage creates a dir: image with a config and a layer, using configMediaType and layerMediaType in an OCI manifest,
+// and returns a reference to it and the manifest.
+func newDirTestImage(t *testing.T, config []byte, configMediaType string, layer []byte, layerMediaType string) (types.ImageReference, []byte) {
+	ctx := context.Background()
+	configDigest := digest.FromBytes(config)
+	layerDigest := digest.FromBytes(layer)
+	manifestBlob := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s",`+
+		`"config":{"mediaType":"%s","digest":"%s","size":%d},`+
+		`"layers":[{"mediaType":"%s","digest":"%s","size":%d}]}`,
+		imgspecv1.MediaTypeImageManifest, configMediaType, configDigest, len(config), layerMediaType, layerDigest, len(layer)))
+
+	ref, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	_, err = dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Digest: configDigest, Size: int64(len(config))}, none.NoCache, true)
+	require.NoError(t, err)
+	_, err = dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: layerDigest, Size: int64(len(layer))}, none.NoCache, false)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, manifestBlob, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+	return ref, manifestBlob
+}
+
+// newAcceptAnythingPolicyContext returns a policy context accepting all images; the caller must call Destroy() on it.
+func newAcceptAnythingPolicyContext(t *testing.T) *signature.PolicyContext {
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	require.NoError(t, err)
+	return policyContext
+}
+
+func TestCopyNonImageArtifact(t *testing.T) {
+	ctx := context.Background()
+	srcRef, artifact := newDirTestImage(t, []byte("{}"), "application/vnd.cncf.helm.config.v1+json",
+		[]byte("chart contents"), "application/vnd.cncf.helm.chart.content.v1.tar+gzip")
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// The artifact is copied verbatim
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	copiedManifest, err := Image(ctx, policyContext, destRef, srcRef, &Options{AllowNonImageArtifacts: true})
+	require.NoError(t, err)
+	assert.Equal(t, artifact, copiedManifest)
+
+	// Destinations which can only store images reject the artifact early
+	archiveRef, err := archive.ParseReference(filepath.Join(t.TempDir(), "archive.tar"))
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, archiveRef, srcRef, &Options{AllowNonImageArtifacts: true})
+	assert.ErrorContains(t, err, "can only store images")
+
+	// Without AllowNonImageArtifacts, conversion to a format which can’t represent the artifact is attempted, and fails
+	destRef, err = directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, destRef, srcRef, &Options{ForceManifestMIMEType: manifest.DockerV2Schema2MediaType})
+	var nonImageErr manifest.NonImageArtifactError
+	assert.ErrorAs(t, err, &nonImageErr)
+}
+
+func TestCopyRecompressionRecordsUncompressedDigest(t *testing.T) {
+	ctx := context.Background()
+	uncompressed := []byte("layer contents")
+	uncompressedDigest := digest.FromBytes(uncompressed)
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err := gzipWriter.Write(uncompressed)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	config := []byte(fmt.Sprintf(`{"rootfs":{"type":"layers","diff_ids":["%s"]}}`, uncompressedDigest))
+	srcRef, _ := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, gzipped.Bytes(), imgspecv1.MediaTypeImageLayerGzip)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	destCtx := &types.SystemContext{
+		BlobInfoCacheDir:  t.TempDir(),
+		CompressionFormat: &compression.Zstd,
+	}
+	destRef, err := layout.NewReference(t.TempDir(), "tag")
+	require.NoError(t, err)
+	copiedManifest, err := Image(ctx, policyContext, destRef, srcRef, &Options{DestinationCtx: destCtx})
+	require.NoError(t, err)
+	m, err := manifest.OCI1FromManifest(copiedManifest)
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 1)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerZstd, m.Layers[0].MediaType)
+
+	// Both compression variants are associated with the uncompressed digest, so that later copies can reuse the recompressed blob.
+	cache := blobinfocache.DefaultCache(destCtx)
+	assert.Equal(t, uncompressedDigest, cache.UncompressedDigest(digest.FromBytes(gzipped.Bytes())))
+	assert.Equal(t, uncompressedDigest, cache.UncompressedDigest(m.Layers[0].Digest))
+}
@@ -0,0 +1,48 @@
+package copy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/testing/tracingtest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageTracing(t *testing.T) {
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	srcRef, _ := newDirTestImage(t, config, imgspecv1.MediaTypeImageConfig, []byte("layer"), imgspecv1.MediaTypeImageLayer)
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	policyContext := newAcceptAnythingPolicyContext(t)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	recorder := tracingtest.NewRecorder()
+	ctx, root := recorder.Tracer("test").Start(context.Background(), "root")
+	_, err = Image(ctx, policyContext, destRef, srcRef, nil)
+	require.NoError(t, err)
+	root.End()
+
+	spans := recorder.Ended()
+	byName := map[string]*tracingtest.Span{}
+	for _, span := range spans {
+		byName[span.Name()] = span
+	}
+	for _, c := range []struct{ name, parent string }{
+		{"copy.Image", "root"},
+		{"copy.SingleImage", "copy.Image"},
+		{"copy.Config", "copy.SingleImage"},
+		{"copy.Layer", "copy.SingleImage"},
+		{"GetBlob", "copy.Layer"},
+		{"PutManifest", "copy.SingleImage"},
+	} {
+		span, ok := byName[c.name]
+		require.True(t, ok, c.name)
+		assert.Equal(t, byName[c.parent].SpanContext().SpanID(), span.Parent().SpanID(), c.name)
+	}
+}
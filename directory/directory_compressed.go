@@ -0,0 +1,129 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// compressedLayerMetadata is the contents of the metadata file of a layer stored compressed;
+// see types.SystemContext.DirBlobCompression.
+type compressedLayerMetadata struct {
+	Digest           digest.Digest `json:"digest"`           // Digest of the layer, as referenced by the manifest
+	Size             int64         `json:"size"`             // Size of the layer, as referenced by the manifest
+	Compression      string        `json:"compression"`      // Name of the compression algorithm used for the stored data
+	CompressedDigest digest.Digest `json:"compressedDigest"` // Digest of the stored data
+	CompressedSize   int64         `json:"compressedSize"`   // Size of the stored data
+}
+
+// validateBlobCompression returns an error if algo can not be used for types.SystemContext.DirBlobCompression.
+func validateBlobCompression(algo *compression.Algorithm) error {
+	if algo == nil {
+		return nil
+	}
+	switch algo.Name() {
+	case compressiontypes.GzipAlgorithmName, compressiontypes.ZstdAlgorithmName:
+		return nil
+	default:
+		return fmt.Errorf("compression algorithm %q is not supported for storing layers in a directory", algo.Name())
+	}
+}
+
+// compressStream writes stream, compressed using algo, to dest.
+// It returns the size of stream, and the digest (using digestAlgorithm) and size of the data written to dest.
+func compressStream(dest io.Writer, stream io.Reader, algo compression.Algorithm, digestAlgorithm digest.Algorithm) (int64, digest.Digest, int64, error) {
+	digester := digestAlgorithm.Digester()
+	counter := &countingWriter{}
+	compressor, err := compression.CompressStream(io.MultiWriter(dest, digester.Hash(), counter), algo, nil)
+	if err != nil {
+		return -1, "", -1, err
+	}
+	size, err := io.Copy(compressor, stream)
+	if err != nil {
+		compressor.Close()
+		return -1, "", -1, err
+	}
+	if err := compressor.Close(); err != nil {
+		return -1, "", -1, err
+	}
+	return size, digester.Digest(), counter.n, nil
+}
+
+// countingWriter is an io.Writer which only counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// readCompressedLayerMetadata returns the metadata of layer layerDigest stored compressed in ref,
+// or nil if there is no such layer.
+func readCompressedLayerMetadata(ref dirReference, layerDigest digest.Digest) (*compressedLayerMetadata, error) {
+	path, err := ref.compressedLayerMetadataPath(layerDigest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var res compressedLayerMetadata
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", path, err)
+	}
+	if res.Digest != layerDigest {
+		return nil, fmt.Errorf("%q describes layer %q, expected %q", path, res.Digest, layerDigest)
+	}
+	return &res, nil
+}
+
+// openCompressedLayer returns a stream with the original contents of a layer stored compressed in ref, described by metadata.
+func openCompressedLayer(ref dirReference, metadata *compressedLayerMetadata) (io.ReadCloser, error) {
+	algo, err := compression.AlgorithmByName(metadata.Compression)
+	if err != nil {
+		return nil, err
+	}
+	decompressor, err := compression.DecompressorWithOptions(algo, compression.DecompressorOptions{})
+	if err != nil {
+		return nil, err
+	}
+	path, err := ref.compressedLayerPath(metadata.Digest)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := decompressor(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &compressedLayerReader{ReadCloser: stream, file: f}, nil
+}
+
+// compressedLayerReader is the decompressed contents of a layer stored compressed; Close also closes the underlying file.
+type compressedLayerReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (r *compressedLayerReader) Close() error {
+	err := r.ReadCloser.Close()
+	if err2 := r.file.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -2,26 +2,45 @@ package directory
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sync"
 
+	"github.com/containers/image/v5/internal/durablefile"
 	"github.com/containers/image/v5/internal/imagedestination/impl"
 	"github.com/containers/image/v5/internal/imagedestination/stubs"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/putblobdigest"
 	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/supporteddigests"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/fileutils"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 )
 
 const version = "Directory Transport Version: 1.1\n"
 
+// versionCompressedBlobs is the contents of the version file of a directory using the original layout, which may contain
+// layers stored compressed (see types.SystemContext.DirBlobCompression).  Older versions of this library refuse
+// to overwrite such directories.
+const versionCompressedBlobs = "Directory Transport Version: 1.2\n"
+
+// isV1Version returns true if contents of a version file describe a directory using the original layout.
+func isV1Version(contents []byte) bool {
+	return string(contents) == version || string(contents) == versionCompressedBlobs
+}
+
 // ErrNotContainerImageDir indicates that the directory doesn't match the expected contents of a directory created
 // using the 'dir' transport
 var ErrNotContainerImageDir = errors.New("not a containers image directory, don't want to overwrite important data")
@@ -32,7 +51,18 @@ type dirImageDestination struct {
 	stubs.NoPutBlobPartialInitialize
 	stubs.AlwaysSupportsSignatures
 
-	ref dirReference
+	ref             dirReference
+	blobCompression *compression.Algorithm // If not nil, uncompressed layers are stored compressed using this algorithm
+	digestAlgorithm digest.Algorithm       // For blobs and manifests written without a known digest
+	durableWrites   bool                   // types.SystemContext.LocalDurableWrites
+	syncDirs        durablefile.DirTracker // Directories to sync in Commit, if durableWrites
+
+	// The following members are only used with the v2 layout (ref.image != "").
+	v2BlobsLock        sync.Mutex                      // Protects v2Blobs
+	v2Blobs            map[digest.Digest]*dirIndexBlob // Blobs written or reused by this destination, including manifests
+	v2Manifest         []byte                          // The primary manifest, if already written
+	v2ManifestDigest   digest.Digest
+	v2ManifestMIMEType string
 }
 
 // newImageDestination returns an ImageDestination for writing to a directory.
@@ -49,71 +79,106 @@ func newImageDestination(sys *types.SystemContext, ref dirReference) (private.Im
 		if sys.DirForceDecompress {
 			desiredLayerCompression = types.Decompress
 		}
+		if err := validateBlobCompression(sys.DirBlobCompression); err != nil {
+			return nil, err
+		}
+	}
+
+	digestAlgorithm, err := supporteddigests.ForNewObjects(sys)
+	if err != nil {
+		return nil, err
+	}
+
+	durableWrites := sys != nil && sys.LocalDurableWrites
+	if ref.image != "" {
+		if err := prepareV2Layout(ref, durableWrites); err != nil {
+			return nil, err
+		}
+	} else {
+		v1Version := version
+		if sys != nil && sys.DirBlobCompression != nil {
+			v1Version = versionCompressedBlobs
+		}
+		if err := prepareV1Layout(ref, v1Version, durableWrites); err != nil {
+			return nil, err
+		}
 	}
 
+	d := &dirImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes:     nil,
+			DesiredLayerCompression:        desiredLayerCompression,
+			AcceptsForeignLayerURLs:        false,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
+			HasThreadSafePutBlob:           true,
+			AcceptsNonImageArtifacts:       true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+
+		ref:             ref,
+		digestAlgorithm: digestAlgorithm,
+		durableWrites:   durableWrites,
+		v2Blobs:         map[digest.Digest]*dirIndexBlob{},
+	}
+	if sys != nil {
+		d.blobCompression = sys.DirBlobCompression
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// prepareV1Layout prepares the directory of ref for writing a single image using the original layout,
+// deleting any image it previously contained, and marks it with newVersion.
+func prepareV1Layout(ref dirReference, newVersion string, durableWrites bool) error {
 	// If directory exists check if it is empty
 	// if not empty, check whether the contents match that of a container image directory and overwrite the contents
 	// if the contents don't match throw an error
 	dirExists, err := pathExists(ref.resolvedPath)
 	if err != nil {
-		return nil, fmt.Errorf("checking for path %q: %w", ref.resolvedPath, err)
+		return fmt.Errorf("checking for path %q: %w", ref.resolvedPath, err)
 	}
 	if dirExists {
 		isEmpty, err := isDirEmpty(ref.resolvedPath)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		if !isEmpty {
 			versionExists, err := pathExists(ref.versionPath())
 			if err != nil {
-				return nil, fmt.Errorf("checking if path exists %q: %w", ref.versionPath(), err)
+				return fmt.Errorf("checking if path exists %q: %w", ref.versionPath(), err)
 			}
 			if versionExists {
 				contents, err := os.ReadFile(ref.versionPath())
 				if err != nil {
-					return nil, err
+					return err
 				}
 				// check if contents of version file is what we expect it to be
-				if string(contents) != version {
-					return nil, ErrNotContainerImageDir
+				if !isV1Version(contents) {
+					return ErrNotContainerImageDir
 				}
 			} else {
-				return nil, ErrNotContainerImageDir
+				return ErrNotContainerImageDir
 			}
 			// delete directory contents so that only one image is in the directory at a time
 			if err = removeDirContents(ref.resolvedPath); err != nil {
-				return nil, fmt.Errorf("erasing contents in %q: %w", ref.resolvedPath, err)
+				return fmt.Errorf("erasing contents in %q: %w", ref.resolvedPath, err)
 			}
 			logrus.Debugf("overwriting existing container image directory %q", ref.resolvedPath)
 		}
 	} else {
 		// create directory if it doesn't exist
 		if err := os.MkdirAll(ref.resolvedPath, 0755); err != nil {
-			return nil, fmt.Errorf("unable to create directory %q: %w", ref.resolvedPath, err)
+			return fmt.Errorf("unable to create directory %q: %w", ref.resolvedPath, err)
 		}
 	}
 	// create version file
-	err = os.WriteFile(ref.versionPath(), []byte(version), 0644)
+	err = durablefile.WriteFile(ref.versionPath(), []byte(newVersion), 0644, durableWrites)
 	if err != nil {
-		return nil, fmt.Errorf("creating version file %q: %w", ref.versionPath(), err)
-	}
-
-	d := &dirImageDestination{
-		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
-			SupportedManifestMIMETypes:     nil,
-			DesiredLayerCompression:        desiredLayerCompression,
-			AcceptsForeignLayerURLs:        false,
-			MustMatchRuntimeOS:             false,
-			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
-			HasThreadSafePutBlob:           true,
-		}),
-		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
-
-		ref: ref,
+		return fmt.Errorf("creating version file %q: %w", ref.versionPath(), err)
 	}
-	d.Compat = impl.AddCompat(d)
-	return d, nil
+	return nil
 }
 
 // Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
@@ -127,6 +192,11 @@ func (d *dirImageDestination) Close() error {
 	return nil
 }
 
+// DigestAlgorithm returns the algorithm the destination uses for digests of blobs and manifests it creates.
+func (d *dirImageDestination) DigestAlgorithm() digest.Algorithm {
+	return d.digestAlgorithm
+}
+
 // PutBlobWithOptions writes contents of stream and returns data representing the result.
 // inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
 // inputInfo.Size is the expected length of stream, if known.
@@ -150,9 +220,30 @@ func (d *dirImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		}
 	}()
 
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	digester, stream := putblobdigest.DigestIfSupportedUnknown(stream, inputInfo, d.digestAlgorithm)
+	storeCompressed := false
+	if d.blobCompression != nil && !options.IsConfig {
+		_, decompressor, detectedStream, err := compression.DetectCompressionFormat(stream)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		stream = detectedStream
+		storeCompressed = decompressor == nil
+	}
 	// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
-	size, err := io.Copy(blobFile, stream)
+	var size int64
+	var compressedMetadata *compressedLayerMetadata
+	if storeCompressed {
+		// Use the same algorithm as the layer digest.
+		digestAlgorithm := d.digestAlgorithm
+		if inputInfo.Digest != "" && supporteddigests.IsSupported(inputInfo.Digest.Algorithm()) {
+			digestAlgorithm = inputInfo.Digest.Algorithm()
+		}
+		compressedMetadata = &compressedLayerMetadata{Compression: d.blobCompression.Name()}
+		size, compressedMetadata.CompressedDigest, compressedMetadata.CompressedSize, err = compressStream(blobFile, stream, *d.blobCompression, digestAlgorithm)
+	} else {
+		size, err = io.Copy(blobFile, stream)
+	}
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
@@ -174,7 +265,12 @@ func (d *dirImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		}
 	}
 
-	blobPath, err := d.ref.layerPath(blobDigest)
+	var blobPath string
+	if compressedMetadata != nil {
+		blobPath, err = d.ref.compressedLayerPath(blobDigest)
+	} else {
+		blobPath, err = d.ref.layerPath(blobDigest)
+	}
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
@@ -185,6 +281,16 @@ func (d *dirImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		return private.UploadedBlob{}, err
 	}
 	succeeded = true
+	d.fileWritten(blobPath)
+	if compressedMetadata != nil {
+		compressedMetadata.Digest = blobDigest
+		compressedMetadata.Size = size
+		if err := d.writeCompressedLayerMetadata(compressedMetadata); err != nil {
+			os.Remove(blobPath)
+			return private.UploadedBlob{}, err
+		}
+	}
+	d.recordV2Blob(blobDigest, size, inputInfo.MediaType)
 	return private.UploadedBlob{Digest: blobDigest, Size: size}, nil
 }
 
@@ -206,14 +312,57 @@ func (d *dirImageDestination) TryReusingBlobWithOptions(ctx context.Context, inf
 	}
 	finfo, err := os.Stat(blobPath)
 	if err != nil && os.IsNotExist(err) {
-		return false, private.ReusedBlob{}, nil
+		compressedMetadata, err := readCompressedLayerMetadata(d.ref, info.Digest)
+		if err != nil {
+			return false, private.ReusedBlob{}, err
+		}
+		if compressedMetadata == nil {
+			return false, private.ReusedBlob{}, nil
+		}
+		d.recordV2Blob(info.Digest, compressedMetadata.Size, info.MediaType)
+		return true, private.ReusedBlob{Digest: info.Digest, Size: compressedMetadata.Size}, nil
 	}
 	if err != nil {
 		return false, private.ReusedBlob{}, err
 	}
+	d.recordV2Blob(info.Digest, finfo.Size(), info.MediaType)
 	return true, private.ReusedBlob{Digest: info.Digest, Size: finfo.Size()}, nil
 }
 
+// recordV2Blob records that the image uses blob blobDigest, if using the v2 layout.
+func (d *dirImageDestination) recordV2Blob(blobDigest digest.Digest, size int64, mediaType string) {
+	if d.ref.image == "" {
+		return
+	}
+	d.v2BlobsLock.Lock()
+	defer d.v2BlobsLock.Unlock()
+	d.v2Blobs[blobDigest] = &dirIndexBlob{Size: size, MediaType: mediaType}
+}
+
+// writeCompressedLayerMetadata writes metadata of a layer stored compressed.
+func (d *dirImageDestination) writeCompressedLayerMetadata(metadata *compressedLayerMetadata) error {
+	path, err := d.ref.compressedLayerMetadataPath(metadata.Digest)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := durablefile.WriteFile(path, data, 0644, d.durableWrites); err != nil {
+		return err
+	}
+	d.fileWritten(path)
+	return nil
+}
+
+// fileWritten records that a file was created at path, so that Commit can sync its directory, if d.durableWrites.
+func (d *dirImageDestination) fileWritten(path string) {
+	if d.durableWrites {
+		d.syncDirs.Add(filepath.Dir(path))
+	}
+}
+
 // PutManifest writes manifest to the destination.
 // If instanceDigest is not nil, it contains a digest of the specific manifest instance to write the manifest for (when
 // the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
@@ -223,11 +372,49 @@ func (d *dirImageDestination) TryReusingBlobWithOptions(ctx context.Context, inf
 // If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
 // but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
 func (d *dirImageDestination) PutManifest(ctx context.Context, manifest []byte, instanceDigest *digest.Digest) error {
+	if d.ref.image != "" {
+		return d.putManifestV2(manifest, instanceDigest)
+	}
 	path, err := d.ref.manifestPath(instanceDigest)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, manifest, 0644)
+	if err := durablefile.WriteFile(path, manifest, 0644, d.durableWrites); err != nil {
+		return err
+	}
+	d.fileWritten(path)
+	return nil
+}
+
+// putManifestV2 implements PutManifest for the v2 layout, where manifests are stored as blobs.
+func (d *dirImageDestination) putManifestV2(manifestBlob []byte, instanceDigest *digest.Digest) error {
+	algorithm := d.digestAlgorithm
+	if instanceDigest != nil {
+		if err := instanceDigest.Validate(); err != nil { // digest.Digest.Algorithm() panics on failure
+			return err
+		}
+		algorithm = instanceDigest.Algorithm()
+	}
+	manifestDigest, err := manifest.DigestWithAlgorithm(manifestBlob, algorithm)
+	if err != nil {
+		return err
+	}
+	path, err := d.ref.manifestPath(&manifestDigest)
+	if err != nil {
+		return err
+	}
+	if err := durablefile.WriteFile(path, manifestBlob, 0644, d.durableWrites); err != nil {
+		return err
+	}
+	d.fileWritten(path)
+	mimeType := manifest.GuessMIMEType(manifestBlob)
+	d.recordV2Blob(manifestDigest, int64(len(manifestBlob)), mimeType)
+	if instanceDigest == nil {
+		d.v2Manifest = manifestBlob
+		d.v2ManifestDigest = manifestDigest
+		d.v2ManifestMIMEType = mimeType
+	}
+	return nil
 }
 
 // PutSignaturesWithFormat writes a set of signatures to the destination.
@@ -235,6 +422,12 @@ func (d *dirImageDestination) PutManifest(ctx context.Context, manifest []byte,
 // (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
 // MUST be called after PutManifest (signatures may reference manifest contents).
 func (d *dirImageDestination) PutSignaturesWithFormat(ctx context.Context, signatures []signature.Signature, instanceDigest *digest.Digest) error {
+	if d.ref.image != "" && instanceDigest == nil {
+		if d.v2ManifestDigest == "" {
+			return errors.New("internal error: PutSignatures called before PutManifest")
+		}
+		instanceDigest = &d.v2ManifestDigest
+	}
 	for i, sig := range signatures {
 		blob, err := signature.Blob(sig)
 		if err != nil {
@@ -244,9 +437,14 @@ func (d *dirImageDestination) PutSignaturesWithFormat(ctx context.Context, signa
 		if err != nil {
 			return err
 		}
-		if err := os.WriteFile(path, blob, 0644); err != nil {
+		if err := durablefile.WriteFile(path, blob, 0644, d.durableWrites); err != nil {
 			return err
 		}
+		d.fileWritten(path)
+	}
+	if d.ref.image != "" {
+		// Signatures are shared by all images with the same manifest; remove any left from a previous copy.
+		return removeSignatures(d.ref, *instanceDigest, len(signatures))
 	}
 	return nil
 }
@@ -259,9 +457,96 @@ func (d *dirImageDestination) PutSignaturesWithFormat(ctx context.Context, signa
 // - Uploaded data MAY be visible to others before Commit() is called
 // - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
 func (d *dirImageDestination) Commit(context.Context, types.UnparsedImage) error {
+	if d.durableWrites {
+		// Ensure all data is on disk before recording the image in the v2 index, or signaling success.
+		d.syncDirs.Add(d.ref.path)
+		if err := d.syncDirs.Sync(); err != nil {
+			return err
+		}
+	}
+	if d.ref.image != "" {
+		if err := d.commitV2(); err != nil {
+			return err
+		}
+		if d.durableWrites {
+			return durablefile.SyncDir(d.ref.path)
+		}
+	}
 	return nil
 }
 
+// commitV2 implements Commit for the v2 layout, by recording the image in the index.
+func (d *dirImageDestination) commitV2() error {
+	if d.v2ManifestDigest == "" {
+		return errors.New("internal error: Commit called before PutManifest")
+	}
+	d.v2BlobsLock.Lock()
+	blobs := maps.Clone(d.v2Blobs)
+	d.v2BlobsLock.Unlock()
+
+	blobDigests := make([]digest.Digest, 0, len(blobs))
+	for blobDigest := range blobs {
+		blobDigests = append(blobDigests, blobDigest)
+	}
+	slices.Sort(blobDigests)
+	image := &dirIndexImage{
+		ManifestDigest:    d.v2ManifestDigest,
+		ManifestMediaType: d.v2ManifestMIMEType,
+		Platforms:         d.v2Platforms(),
+		Blobs:             blobDigests,
+	}
+	return modifyIndex(d.ref, func(index *dirIndex) error {
+		previous := index.Images[d.ref.image]
+		index.Images[d.ref.image] = image
+		maps.Copy(index.Blobs, blobs)
+		if previous != nil {
+			return removeUnusedBlobs(d.ref, index, previous.Blobs)
+		}
+		return nil
+	})
+}
+
+// v2Platforms returns the platforms of the images described by the primary manifest, for the index.
+// Platforms which can't be determined (e.g. for artifacts) are recorded as nil.
+func (d *dirImageDestination) v2Platforms() []dirIndexPlatform {
+	if manifest.MIMETypeIsMultiImage(d.v2ManifestMIMEType) {
+		list, err := manifest.ListFromBlob(d.v2Manifest, d.v2ManifestMIMEType)
+		if err != nil {
+			logrus.Debugf("Not recording platforms of %s: %v", d.v2ManifestDigest, err)
+			return nil
+		}
+		res := []dirIndexPlatform{}
+		for _, instanceDigest := range list.Instances() {
+			entry := dirIndexPlatform{ManifestDigest: instanceDigest}
+			if instance, err := list.Instance(instanceDigest); err == nil {
+				entry.Platform = instance.ReadOnly.Platform
+			}
+			res = append(res, entry)
+		}
+		return res
+	}
+
+	entry := dirIndexPlatform{ManifestDigest: d.v2ManifestDigest}
+	m, err := manifest.FromBlob(d.v2Manifest, d.v2ManifestMIMEType)
+	if err == nil {
+		var info *types.ImageInspectInfo
+		info, err = m.Inspect(func(bi types.BlobInfo) ([]byte, error) {
+			path, err := d.ref.layerPath(bi.Digest)
+			if err != nil {
+				return nil, err
+			}
+			return os.ReadFile(path)
+		})
+		if err == nil {
+			entry.Platform = &imgspecv1.Platform{OS: info.Os, Architecture: info.Architecture, Variant: info.Variant}
+		}
+	}
+	if err != nil {
+		logrus.Debugf("Not recording the platform of %s: %v", d.v2ManifestDigest, err)
+	}
+	return []dirIndexPlatform{entry}
+}
+
 // returns true if path exists
 func pathExists(path string) (bool, error) {
 	err := fileutils.Exists(path)
@@ -0,0 +1,278 @@
+package directory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/containers/image/v5/internal/durablefile"
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/ioutils"
+	"github.com/containers/storage/pkg/lockfile"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// versionV2 is the contents of the version file of a directory using the v2 layout, which can contain any number of images:
+//   - index.json describes all images and blobs in the directory (see dirIndex)
+//   - blobs/ contains all blobs, including manifests, named by their digest
+//   - signatures/ contains signatures, named by the digest of the manifest they sign
+const versionV2 = "Directory Transport Version: 2.0\n"
+
+// indexLockFile is the name of a lock file, within a directory using the v2 layout, used to serialize modifications of index.json.
+const indexLockFile = "index.json.lock"
+
+// dirIndex is the contents of index.json in a directory using the v2 layout.
+type dirIndex struct {
+	Images map[string]*dirIndexImage       `json:"images"`
+	Blobs  map[digest.Digest]*dirIndexBlob `json:"blobs"`
+}
+
+// dirIndexImage describes a named image in a directory using the v2 layout.
+type dirIndexImage struct {
+	ManifestDigest    digest.Digest `json:"manifestDigest"`
+	ManifestMediaType string        `json:"manifestMediaType,omitempty"`
+	// Platforms lists the single-platform images; a single entry for the primary manifest, if it is not a manifest list.
+	Platforms []dirIndexPlatform `json:"platforms,omitempty"`
+	// Blobs lists all blobs used by the image, including manifests.
+	Blobs []digest.Digest `json:"blobs"`
+}
+
+// dirIndexPlatform describes a single-platform image within a dirIndexImage.
+type dirIndexPlatform struct {
+	ManifestDigest digest.Digest       `json:"manifestDigest"`
+	Platform       *imgspecv1.Platform `json:"platform,omitempty"`
+}
+
+// dirIndexBlob describes a blob in a directory using the v2 layout.
+type dirIndexBlob struct {
+	Size      int64  `json:"size"`
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+// ListImages returns references to all images in the directory at path, which must use the v2 layout, sorted by name.
+func ListImages(path string) ([]types.ImageReference, error) {
+	probe, err := NewReferenceWithImage(path, "probe")
+	if err != nil {
+		return nil, err
+	}
+	index, err := readIndex(probe.(dirReference))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(index.Images))
+	for name := range index.Images {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	res := make([]types.ImageReference, 0, len(names))
+	for _, name := range names {
+		ref, err := NewReferenceWithImage(path, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image name %q in %s: %w", name, path, err)
+		}
+		res = append(res, ref)
+	}
+	return res, nil
+}
+
+// readIndex returns the contents of index.json of the directory of ref, which must use the v2 layout.
+func readIndex(ref dirReference) (*dirIndex, error) {
+	contents, err := os.ReadFile(ref.versionPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if dirExists, err2 := pathExists(ref.resolvedPath); err2 == nil && !dirExists {
+				return nil, errcategory.Wrap(fmt.Errorf("reading %q: %w", ref.resolvedPath, err), types.ErrNotFound)
+			}
+			return nil, ErrNotContainerImageDir
+		}
+		return nil, err
+	}
+	if string(contents) != versionV2 {
+		return nil, fmt.Errorf("%q does not use the v2 directory layout: %w", ref.resolvedPath, ErrNotContainerImageDir)
+	}
+	data, err := os.ReadFile(ref.indexPath())
+	if err != nil {
+		return nil, err
+	}
+	index := dirIndex{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", ref.indexPath(), err)
+	}
+	if index.Images == nil {
+		index.Images = map[string]*dirIndexImage{}
+	}
+	if index.Blobs == nil {
+		index.Blobs = map[digest.Digest]*dirIndexBlob{}
+	}
+	return &index, nil
+}
+
+// readIndexImage returns the entry for ref.image in index.json of the directory of ref.
+func readIndexImage(ref dirReference) (*dirIndexImage, error) {
+	index, err := readIndex(ref)
+	if err != nil {
+		return nil, err
+	}
+	image, ok := index.Images[ref.image]
+	if !ok {
+		return nil, errcategory.Wrap(fmt.Errorf("image %q not found in %q", ref.image, ref.resolvedPath), types.ErrManifestUnknown)
+	}
+	return image, nil
+}
+
+// writeIndex writes index to index.json of the directory of ref.
+func writeIndex(ref dirReference, index *dirIndex) error {
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(ref.indexPath(), indexJSON, 0644)
+}
+
+// modifyIndex calls modify on the contents of index.json of the directory of ref, and atomically replaces the file
+// with the result.  Modifications made by this function are serialized using a lock file.
+func modifyIndex(ref dirReference, modify func(index *dirIndex) error) error {
+	lock, err := lockfile.GetLockFile(filepath.Join(ref.path, indexLockFile))
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	index, err := readIndex(ref)
+	if err != nil {
+		return err
+	}
+	if err := modify(index); err != nil {
+		return err
+	}
+	return writeIndex(ref, index)
+}
+
+// prepareV2Layout ensures that the directory of ref uses the v2 layout, creating it if it is missing or empty.
+func prepareV2Layout(ref dirReference, durableWrites bool) error {
+	contents, err := os.ReadFile(ref.versionPath())
+	if err == nil {
+		if string(contents) != versionV2 {
+			return ErrNotContainerImageDir
+		}
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Refuse to use a directory with unrelated contents; the lock file may exist if another process is creating the layout concurrently.
+	entries, err := os.ReadDir(ref.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() != indexLockFile {
+			return ErrNotContainerImageDir
+		}
+	}
+	if err := os.MkdirAll(ref.path, 0755); err != nil {
+		return fmt.Errorf("unable to create directory %q: %w", ref.resolvedPath, err)
+	}
+	lock, err := lockfile.GetLockFile(filepath.Join(ref.path, indexLockFile))
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	if contents, err := os.ReadFile(ref.versionPath()); err == nil { // Created concurrently
+		if string(contents) != versionV2 {
+			return ErrNotContainerImageDir
+		}
+		return nil
+	}
+	for _, dir := range []string{ref.blobsDir(), ref.signaturesDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := writeIndex(ref, &dirIndex{Images: map[string]*dirIndexImage{}, Blobs: map[digest.Digest]*dirIndexBlob{}}); err != nil {
+		return err
+	}
+	// The version file is written last, so that a directory with a version file is always complete.
+	if err := durablefile.WriteFile(ref.versionPath(), []byte(versionV2), 0644, durableWrites); err != nil {
+		return fmt.Errorf("creating version file %q: %w", ref.versionPath(), err)
+	}
+	return nil
+}
+
+// deleteImageV2 removes ref.image from the directory of ref, which uses the v2 layout,
+// along with all blobs not used by other images.
+func deleteImageV2(ref dirReference) error {
+	return modifyIndex(ref, func(index *dirIndex) error {
+		image, ok := index.Images[ref.image]
+		if !ok {
+			return errcategory.Wrap(fmt.Errorf("image %q not found in %q", ref.image, ref.resolvedPath), types.ErrNotFound)
+		}
+		delete(index.Images, ref.image)
+		return removeUnusedBlobs(ref, index, image.Blobs)
+	})
+}
+
+// removeUnusedBlobs removes those of candidates which are not used by any image in index from the directory of ref, and from index.
+func removeUnusedBlobs(ref dirReference, index *dirIndex, candidates []digest.Digest) error {
+	used := map[digest.Digest]struct{}{}
+	for _, image := range index.Images {
+		for _, d := range image.Blobs {
+			used[d] = struct{}{}
+		}
+	}
+	for _, d := range candidates {
+		if _, ok := used[d]; ok {
+			continue
+		}
+		if err := removeBlobFiles(ref, d); err != nil {
+			return err
+		}
+		delete(index.Blobs, d)
+	}
+	return nil
+}
+
+// removeBlobFiles removes all files belonging to blob d (in any storage format, and signatures, if d is a manifest)
+// from the directory of ref.
+func removeBlobFiles(ref dirReference, d digest.Digest) error {
+	paths := []string{}
+	for _, pathFn := range []func(digest.Digest) (string, error){ref.layerPath, ref.compressedLayerPath, ref.compressedLayerMetadataPath} {
+		path, err := pathFn(d)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return removeSignatures(ref, d, 0)
+}
+
+// removeSignatures removes signatures of manifest manifestDigest, starting with the one at index first, from the directory of ref.
+func removeSignatures(ref dirReference, manifestDigest digest.Digest, first int) error {
+	for i := first; ; i++ {
+		path, err := ref.signaturePath(i, &manifestDigest)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package directory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putV2TestImage writes a single-layer OCI image with the specified layer and architecture to ref,
+// and returns the manifest digest and the config digest.
+func putV2TestImage(t *testing.T, ref types.ImageReference, layer []byte, arch string, signatures [][]byte) (digest.Digest, digest.Digest) {
+	ctx := context.Background()
+	cache := memory.New()
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{OS: "linux", Architecture: arch},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromBytes(layer)}},
+	})
+	require.NoError(t, err)
+
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	configInfo, err := dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Digest: "", Size: -1}, cache, true)
+	require.NoError(t, err)
+	layerInfo, err := dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: "", Size: -1}, cache, false)
+	require.NoError(t, err)
+	m, err := manifest.OCI1FromComponents(imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Digest:    configInfo.Digest,
+		Size:      configInfo.Size,
+	}, []imgspecv1.Descriptor{{
+		MediaType: imgspecv1.MediaTypeImageLayer,
+		Digest:    layerInfo.Digest,
+		Size:      layerInfo.Size,
+	}}).Serialize()
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, m, nil)
+	require.NoError(t, err)
+	if signatures != nil {
+		err = dest.PutSignatures(ctx, signatures, nil)
+		require.NoError(t, err)
+	}
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	return digest.FromBytes(m), configInfo.Digest
+}
+
+func TestV2Layout(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	sharedLayer := []byte("shared layer")
+	// This signature is completely invalid; start with 0xA3 just to be minimally plausible to signature.FromBlob.
+	sig := []byte("\xA3sig")
+
+	ref1, err := NewReferenceWithImage(tmpDir, "image1")
+	require.NoError(t, err)
+	manifest1, config1 := putV2TestImage(t, ref1, sharedLayer, "amd64", [][]byte{sig})
+	ref2, err := NewReferenceWithImage(tmpDir, "image2")
+	require.NoError(t, err)
+	manifest2, config2 := putV2TestImage(t, ref2, sharedLayer, "arm64", nil)
+
+	refs, err := ListImages(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	assert.Equal(t, tmpDir+"#image1", refs[0].StringWithinTransport())
+	assert.Equal(t, tmpDir+"#image2", refs[1].StringWithinTransport())
+
+	index, err := readIndex(ref1.(dirReference))
+	require.NoError(t, err)
+	assert.Equal(t, manifest1, index.Images["image1"].ManifestDigest)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, index.Images["image1"].ManifestMediaType)
+	assert.Equal(t, []dirIndexPlatform{{
+		ManifestDigest: manifest1,
+		Platform:       &imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+	}}, index.Images["image1"].Platforms)
+	assert.Len(t, index.Images["image1"].Blobs, 3)
+	assert.Len(t, index.Blobs, 5) // Two manifests, two configs, one shared layer
+	assert.Equal(t, int64(len(sharedLayer)), index.Blobs[digest.FromBytes(sharedLayer)].Size)
+
+	src, err := ref1.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	m, mt, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifest1, digest.FromBytes(m))
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
+	rc, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(sharedLayer), Size: -1}, memory.New())
+	require.NoError(t, err)
+	layer, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	rc.Close()
+	assert.Equal(t, sharedLayer, layer)
+	assert.Equal(t, int64(len(sharedLayer)), size)
+	sigs, err := src.GetSignatures(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{sig}, sigs)
+	require.NoError(t, src.Close())
+
+	// A v1 reference can neither read nor overwrite the directory.
+	v1Ref, err := NewReference(tmpDir)
+	require.NoError(t, err)
+	_, err = v1Ref.NewImageDestination(ctx, nil)
+	assert.ErrorIs(t, err, ErrNotContainerImageDir)
+	err = v1Ref.DeleteImage(ctx, nil)
+	assert.ErrorIs(t, err, ErrNotContainerImageDir)
+
+	// Deleting an image only deletes blobs not used by other images.
+	err = ref1.DeleteImage(ctx, nil)
+	require.NoError(t, err)
+	for _, d := range []digest.Digest{manifest1, config1} {
+		_, err = os.Stat(filepath.Join(tmpDir, "blobs", d.Encoded()))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+	_, err = os.Stat(filepath.Join(tmpDir, "signatures", manifest1.Encoded()+".signature-1"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	for _, d := range []digest.Digest{manifest2, config2, digest.FromBytes(sharedLayer)} {
+		_, err = os.Stat(filepath.Join(tmpDir, "blobs", d.Encoded()))
+		assert.NoError(t, err)
+	}
+	_, err = ref1.NewImageSource(ctx, nil)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	err = ref1.DeleteImage(ctx, nil)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+
+	// Replacing an image deletes blobs no longer used.
+	manifest3, config3 := putV2TestImage(t, ref2, []byte("another layer"), "arm64", nil)
+	for _, d := range []digest.Digest{manifest2, digest.FromBytes(sharedLayer)} {
+		_, err = os.Stat(filepath.Join(tmpDir, "blobs", d.Encoded()))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+	index, err = readIndex(ref2.(dirReference))
+	require.NoError(t, err)
+	assert.Len(t, index.Images, 1)
+	assert.Equal(t, manifest3, index.Images["image2"].ManifestDigest)
+	assert.Contains(t, index.Blobs, config3)
+	assert.Len(t, index.Blobs, 3)
+}
+
+func TestV2LayoutRefusesOtherDirectories(t *testing.T) {
+	// A directory with unrelated contents
+	tmpDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tmpDir, "important"), []byte("data"), 0644)
+	require.NoError(t, err)
+	ref, err := NewReferenceWithImage(tmpDir, "image")
+	require.NoError(t, err)
+	_, err = ref.NewImageDestination(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNotContainerImageDir)
+
+	// A v1 image
+	v1Ref, tmpDir := refToTempDir(t)
+	dest, err := v1Ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	require.NoError(t, dest.Close())
+	ref, err = NewReferenceWithImage(tmpDir, "image")
+	require.NoError(t, err)
+	_, err = ref.NewImageDestination(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNotContainerImageDir)
+	_, err = ref.NewImageSource(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNotContainerImageDir)
+
+	// A missing directory
+	ref, err = NewReferenceWithImage(filepath.Join(t.TempDir(), "missing"), "image")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(context.Background(), nil)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
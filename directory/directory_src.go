@@ -2,10 +2,13 @@ package directory
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 
+	"github.com/containers/image/v5/internal/errcategory"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/manifest"
@@ -21,22 +24,32 @@ type dirImageSource struct {
 	impl.DoesNotAffectLayerInfosForCopy
 	stubs.NoGetBlobAtInitialize
 
-	ref dirReference
+	ref     dirReference
+	v2Image *dirIndexImage // The image in the index, only used with the v2 layout (ref.image != "")
 }
 
 // newImageSource returns an ImageSource reading from an existing directory.
 // The caller must call .Close() on the returned ImageSource.
-func newImageSource(ref dirReference) private.ImageSource {
+func newImageSource(ref dirReference) (private.ImageSource, error) {
+	var v2Image *dirIndexImage
+	if ref.image != "" {
+		image, err := readIndexImage(ref)
+		if err != nil {
+			return nil, err
+		}
+		v2Image = image
+	}
 	s := &dirImageSource{
 		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
 			HasThreadSafeGetBlob: false,
 		}),
 		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
 
-		ref: ref,
+		ref:     ref,
+		v2Image: v2Image,
 	}
 	s.Compat = impl.AddCompat(s)
-	return s
+	return s, nil
 }
 
 // Reference returns the reference used to set up this source, _as specified by the user_
@@ -55,12 +68,22 @@ func (s *dirImageSource) Close() error {
 // If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
 // this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
 func (s *dirImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if s.v2Image != nil && instanceDigest == nil {
+		m, _, err := s.GetManifest(ctx, &s.v2Image.ManifestDigest)
+		if err != nil {
+			return nil, "", err
+		}
+		return m, s.v2Image.ManifestMediaType, nil
+	}
 	path, err := s.ref.manifestPath(instanceDigest)
 	if err != nil {
 		return nil, "", err
 	}
 	m, err := os.ReadFile(path)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errcategory.Wrap(err, types.ErrManifestUnknown)
+		}
 		return nil, "", err
 	}
 	return m, manifest.GuessMIMEType(m), err
@@ -76,6 +99,20 @@ func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 	}
 	r, err := os.Open(path)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			compressedMetadata, err2 := readCompressedLayerMetadata(s.ref, info.Digest)
+			if err2 != nil {
+				return nil, -1, err2
+			}
+			if compressedMetadata != nil {
+				stream, err := openCompressedLayer(s.ref, compressedMetadata)
+				if err != nil {
+					return nil, -1, err
+				}
+				return stream, compressedMetadata.Size, nil
+			}
+			err = errcategory.Wrap(err, types.ErrBlobUnknown)
+		}
 		return nil, -1, err
 	}
 	fi, err := r.Stat()
@@ -90,6 +127,9 @@ func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 // (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
 // (e.g. if the source never returns manifest lists).
 func (s *dirImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	if s.v2Image != nil && instanceDigest == nil {
+		instanceDigest = &s.v2Image.ManifestDigest
+	}
 	signatures := []signature.Signature{}
 	for i := 0; ; i++ {
 		path, err := s.ref.signaturePath(i, instanceDigest)
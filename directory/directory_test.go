@@ -6,11 +6,13 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
@@ -101,6 +103,110 @@ func TestGetPutBlob(t *testing.T) {
 		assert.Equal(t, expectedBlob, b)
 		assert.Equal(t, int64(len(expectedBlob)), size)
 	}
+
+	_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: digest.FromBytes([]byte("missing")), Size: -1}, cache)
+	assert.ErrorIs(t, err, types.ErrBlobUnknown)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestGetPutBlobCompressedStorage(t *testing.T) {
+	uncompressedBlob := bytes.Repeat([]byte("uncompressed-layer"), 1000)
+	var gzipped bytes.Buffer
+	gzipWriter, err := compression.CompressStream(&gzipped, compression.Gzip, nil)
+	require.NoError(t, err)
+	_, err = gzipWriter.Write(uncompressedBlob)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	compressedBlob := gzipped.Bytes()
+	configBlob := []byte("{}")
+
+	ref, tmpDir := refToTempDir(t)
+	cache := memory.New()
+
+	_, err = ref.NewImageDestination(context.Background(), &types.SystemContext{DirBlobCompression: &compression.Xz})
+	assert.Error(t, err)
+
+	dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{DirBlobCompression: &compression.Zstd})
+	require.NoError(t, err)
+	defer dest.Close()
+	blobs := map[digest.Digest][]byte{}
+	for _, c := range []struct {
+		blob     []byte
+		isConfig bool
+	}{
+		{uncompressedBlob, false},
+		{compressedBlob, false},
+		{configBlob, true},
+	} {
+		info, err := dest.PutBlob(context.Background(), bytes.NewReader(c.blob), types.BlobInfo{Digest: "", Size: int64(-1)}, cache, c.isConfig)
+		require.NoError(t, err)
+		assert.Equal(t, digest.FromBytes(c.blob), info.Digest)
+		assert.Equal(t, int64(len(c.blob)), info.Size)
+		blobs[info.Digest] = c.blob
+	}
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	assert.NoError(t, err)
+
+	// Only the uncompressed layer is stored compressed.
+	uncompressedDigest := digest.FromBytes(uncompressedBlob)
+	_, err = os.Stat(filepath.Join(tmpDir, uncompressedDigest.Encoded()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	stored, err := os.ReadFile(filepath.Join(tmpDir, uncompressedDigest.Encoded()+".compressed"))
+	require.NoError(t, err)
+	assert.Less(t, len(stored), len(uncompressedBlob))
+	metadata, err := readCompressedLayerMetadata(ref.(dirReference), uncompressedDigest)
+	require.NoError(t, err)
+	assert.Equal(t, &compressedLayerMetadata{
+		Digest:           uncompressedDigest,
+		Size:             int64(len(uncompressedBlob)),
+		Compression:      compression.Zstd.Name(),
+		CompressedDigest: digest.FromBytes(stored),
+		CompressedSize:   int64(len(stored)),
+	}, metadata)
+	for _, b := range [][]byte{compressedBlob, configBlob} {
+		_, err = os.Stat(filepath.Join(tmpDir, digest.FromBytes(b).Encoded()))
+		assert.NoError(t, err)
+	}
+	versionContents, err := os.ReadFile(filepath.Join(tmpDir, "version"))
+	require.NoError(t, err)
+	assert.Equal(t, versionCompressedBlobs, string(versionContents))
+
+	// The digest of the stored data uses the algorithm of the layer digest.
+	sha512Blob := bytes.Repeat([]byte("sha512-layer"), 1000)
+	sha512Digest := digest.SHA512.FromBytes(sha512Blob)
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader(sha512Blob), types.BlobInfo{Digest: sha512Digest, Size: int64(len(sha512Blob))}, cache, false)
+	require.NoError(t, err)
+	stored, err = os.ReadFile(filepath.Join(tmpDir, sha512Digest.Encoded()+".compressed"))
+	require.NoError(t, err)
+	metadata, err = readCompressedLayerMetadata(ref.(dirReference), sha512Digest)
+	require.NoError(t, err)
+	assert.Equal(t, digest.SHA512.FromBytes(stored), metadata.CompressedDigest)
+
+	reused, reusedInfo, err := dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: uncompressedDigest, Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, int64(len(uncompressedBlob)), reusedInfo.Size)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	for digest, expectedBlob := range blobs {
+		rc, size, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: digest, Size: -1}, cache)
+		require.NoError(t, err)
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBlob, b)
+		assert.Equal(t, int64(len(expectedBlob)), size)
+	}
+
+	// A directory containing compressed layers can be overwritten, and is then marked using the original version.
+	dest2, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest2.Close()
+	versionContents, err = os.ReadFile(filepath.Join(tmpDir, "version"))
+	require.NoError(t, err)
+	assert.Equal(t, version, string(versionContents))
 }
 
 // readerFromFunc allows implementing Reader by any function, e.g. a closure.
@@ -208,3 +314,39 @@ func TestSourceReference(t *testing.T) {
 	ref2 := src.Reference()
 	assert.Equal(t, tmpDir, ref2.StringWithinTransport())
 }
+
+func TestPutDurableWrites(t *testing.T) {
+	sys := &types.SystemContext{LocalDurableWrites: true}
+	for _, v2 := range []bool{false, true} {
+		ref, tmpDir := refToTempDir(t)
+		if v2 {
+			var err error
+			ref, err = NewReferenceWithImage(tmpDir, "image")
+			require.NoError(t, err)
+		}
+		blob := []byte("test-blob")
+		man := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+		dest, err := ref.NewImageDestination(context.Background(), sys)
+		require.NoError(t, err)
+		defer dest.Close()
+		info, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Digest: "", Size: -1}, memory.New(), true)
+		require.NoError(t, err)
+		err = dest.PutManifest(context.Background(), man, nil)
+		require.NoError(t, err)
+		err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+		require.NoError(t, err)
+
+		src, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		defer src.Close()
+		m, _, err := src.GetManifest(context.Background(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, man, m)
+		rc, _, err := src.GetBlob(context.Background(), info, memory.New())
+		require.NoError(t, err)
+		contents, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		assert.Equal(t, blob, contents)
+	}
+}
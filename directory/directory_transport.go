@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/containers/image/v5/directory/explicitfilepath"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errcategory"
 	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
@@ -17,6 +21,7 @@ import (
 
 func init() {
 	transports.Register(Transport)
+	transports.Register(IndexTransport)
 }
 
 // Transport is an ImageTransport for directory paths.
@@ -53,6 +58,40 @@ func (t dirTransport) ValidatePolicyConfigurationScope(scope string) error {
 	return nil
 }
 
+// IndexTransport is an ImageTransport for named images in directories using the v2 layout, which can contain any number of images.
+// It is separate from Transport so that the meaning of existing dir: references is not changed.
+var IndexTransport = dirIndexTransport{}
+
+type dirIndexTransport struct{}
+
+func (t dirIndexTransport) Name() string {
+	return "dir-index"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+// The string must be PATH#IMAGE; image names can not contain '#', so PATH is everything up to the last '#'.
+func (t dirIndexTransport) ParseReference(reference string) (types.ImageReference, error) {
+	i := strings.LastIndex(reference, "#")
+	if i == -1 {
+		return nil, fmt.Errorf("Invalid %s: reference %q, expected PATH#IMAGE", t.Name(), reference)
+	}
+	return NewReferenceWithImage(reference[:i], reference[i+1:])
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t dirIndexTransport) ValidatePolicyConfigurationScope(scope string) error {
+	if i := strings.LastIndex(scope, "#"); i != -1 {
+		if err := validateImageName(scope[i+1:]); err != nil {
+			return fmt.Errorf("Invalid scope %s: %w", scope, err)
+		}
+		scope = scope[:i]
+	}
+	return Transport.ValidatePolicyConfigurationScope(scope)
+}
+
 // dirReference is an ImageReference for directory paths.
 type dirReference struct {
 	// Note that the interpretation of paths below depends on the underlying filesystem state, which may change under us at any time!
@@ -63,6 +102,9 @@ type dirReference struct {
 	// (But in general, we make no attempt to be completely safe against concurrent hostile filesystem modifications.)
 	path         string // As specified by the user. May be relative, contain symlinks, etc.
 	resolvedPath string // Absolute path with no symlinks, at least at the time of its creation. Primarily used for policy namespaces.
+	// image is the name of the image within a directory using the v2 layout, or "" for a directory containing a single image
+	// using the original layout.
+	image string
 }
 
 // There is no directory.ParseReference because it is rather pointless.
@@ -82,7 +124,37 @@ func NewReference(path string) (types.ImageReference, error) {
 	return dirReference{path: path, resolvedPath: resolved}, nil
 }
 
+// NewReferenceWithImage returns a reference to an image named image in a directory at path, using the v2 layout,
+// which can contain any number of images.
+func NewReferenceWithImage(path, image string) (types.ImageReference, error) {
+	if err := validateImageName(image); err != nil {
+		return nil, err
+	}
+	resolved, err := explicitfilepath.ResolvePathToFullyExplicit(path)
+	if err != nil {
+		return nil, err
+	}
+	return dirReference{path: path, resolvedPath: resolved, image: image}, nil
+}
+
+// validateImageName returns an error if image can not be used as an image name in a directory using the v2 layout.
+func validateImageName(image string) error {
+	if image == "" {
+		return errors.New("image name must not be empty")
+	}
+	if !imageNameRegexp.MatchString(image) {
+		return fmt.Errorf("invalid image name %q", image)
+	}
+	return nil
+}
+
+// imageNameRegexp matches valid image names; this allows names like docker/reference.Named values and OCI reference names.
+var imageNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:/@+-]*$`)
+
 func (ref dirReference) Transport() types.ImageTransport {
+	if ref.image != "" {
+		return IndexTransport
+	}
 	return Transport
 }
 
@@ -92,6 +164,9 @@ func (ref dirReference) Transport() types.ImageTransport {
 // e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
 // WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
 func (ref dirReference) StringWithinTransport() string {
+	if ref.image != "" {
+		return ref.path + "#" + ref.image
+	}
 	return ref.path
 }
 
@@ -110,6 +185,9 @@ func (ref dirReference) DockerReference() reference.Named {
 // not required/guaranteed that it will be a valid input to Transport().ParseReference().
 // Returns "" if configuration identities for these references are not supported.
 func (ref dirReference) PolicyConfigurationIdentity() string {
+	if ref.image != "" {
+		return ref.resolvedPath + "#" + ref.image
+	}
 	return ref.resolvedPath
 }
 
@@ -120,6 +198,9 @@ func (ref dirReference) PolicyConfigurationIdentity() string {
 // and each following element to be a prefix of the element preceding it.
 func (ref dirReference) PolicyConfigurationNamespaces() []string {
 	res := []string{}
+	if ref.image != "" {
+		res = append(res, ref.resolvedPath)
+	}
 	path := ref.resolvedPath
 	for {
 		lastSlash := strings.LastIndex(path, "/")
@@ -146,7 +227,7 @@ func (ref dirReference) NewImage(ctx context.Context, sys *types.SystemContext)
 // NewImageSource returns a types.ImageSource for this reference.
 // The caller must call .Close() on the returned ImageSource.
 func (ref dirReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
-	return newImageSource(ref), nil
+	return newImageSource(ref)
 }
 
 // NewImageDestination returns a types.ImageDestination for this reference.
@@ -156,12 +237,40 @@ func (ref dirReference) NewImageDestination(ctx context.Context, sys *types.Syst
 }
 
 // DeleteImage deletes the named image from the registry, if supported.
+// For dir: images, this removes the directory, if it was created by this transport.
+// For images in a directory using the v2 layout, this removes the image, and all blobs not used by other images in the directory.
 func (ref dirReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
-	return errors.New("Deleting images not implemented for dir: images")
+	if ref.image != "" {
+		return deleteImageV2(ref)
+	}
+	contents, err := os.ReadFile(ref.versionPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if dirExists, err2 := pathExists(ref.resolvedPath); err2 == nil && !dirExists {
+				return errcategory.Wrap(fmt.Errorf("deleting %q: %w", ref.resolvedPath, err), types.ErrNotFound)
+			}
+			return ErrNotContainerImageDir
+		}
+		return err
+	}
+	if !isV1Version(contents) {
+		return ErrNotContainerImageDir
+	}
+	if err := removeDirContents(ref.resolvedPath); err != nil {
+		return fmt.Errorf("deleting contents of %q: %w", ref.resolvedPath, err)
+	}
+	return os.Remove(ref.resolvedPath)
 }
 
 // manifestPath returns a path for the manifest within a directory using our conventions.
+// In the v2 layout, manifests are stored as blobs, so instanceDigest must be the digest of the manifest, even for the primary manifest.
 func (ref dirReference) manifestPath(instanceDigest *digest.Digest) (string, error) {
+	if ref.image != "" {
+		if instanceDigest == nil {
+			return "", errors.New("internal error: the path of a manifest in the v2 directory layout depends on its digest")
+		}
+		return ref.layerPath(*instanceDigest)
+	}
 	if instanceDigest != nil {
 		if err := instanceDigest.Validate(); err != nil { // digest.Digest.Encoded() panics on failure, and could possibly result in a path with ../, so validate explicitly.
 			return "", err
@@ -176,17 +285,48 @@ func (ref dirReference) layerPath(digest digest.Digest) (string, error) {
 	if err := digest.Validate(); err != nil { // digest.Digest.Encoded() panics on failure, and could possibly result in a path with ../, so validate explicitly.
 		return "", err
 	}
+	if ref.image != "" {
+		return filepath.Join(ref.blobsDir(), digest.Encoded()), nil
+	}
 	// FIXME: Should we keep the digest identification?
 	return filepath.Join(ref.path, digest.Encoded()), nil
 }
 
+// compressedLayerPath returns a path for a layer stored compressed (see types.SystemContext.DirBlobCompression) within a directory using our conventions.
+func (ref dirReference) compressedLayerPath(digest digest.Digest) (string, error) {
+	path, err := ref.layerPath(digest)
+	if err != nil {
+		return "", err
+	}
+	return path + ".compressed", nil
+}
+
+// compressedLayerMetadataPath returns a path for the metadata of a layer stored compressed within a directory using our conventions.
+func (ref dirReference) compressedLayerMetadataPath(digest digest.Digest) (string, error) {
+	path, err := ref.layerPath(digest)
+	if err != nil {
+		return "", err
+	}
+	return path + ".compressed.json", nil
+}
+
 // signaturePath returns a path for a signature within a directory using our conventions.
+// In the v2 layout, signatures are stored by manifest digest, so instanceDigest must be set even for the primary manifest.
 func (ref dirReference) signaturePath(index int, instanceDigest *digest.Digest) (string, error) {
+	if ref.image != "" {
+		if instanceDigest == nil {
+			return "", errors.New("internal error: the path of a signature in the v2 directory layout depends on the manifest digest")
+		}
+		if err := instanceDigest.Validate(); err != nil { // digest.Digest.Encoded() panics on failure, and could possibly result in a path with ../, so validate explicitly.
+			return "", err
+		}
+		return filepath.Join(ref.signaturesDir(), fmt.Sprintf("%s.signature-%d", instanceDigest.Encoded(), index+1)), nil
+	}
 	if instanceDigest != nil {
 		if err := instanceDigest.Validate(); err != nil { // digest.Digest.Encoded() panics on failure, and could possibly result in a path with ../, so validate explicitly.
 			return "", err
 		}
-		return filepath.Join(ref.path, fmt.Sprintf(instanceDigest.Encoded()+".signature-%d", index+1)), nil
+		return filepath.Join(ref.path, fmt.Sprintf("%s.signature-%d", instanceDigest.Encoded(), index+1)), nil
 	}
 	return filepath.Join(ref.path, fmt.Sprintf("signature-%d", index+1)), nil
 }
@@ -195,3 +335,18 @@ func (ref dirReference) signaturePath(index int, instanceDigest *digest.Digest)
 func (ref dirReference) versionPath() string {
 	return filepath.Join(ref.path, "version")
 }
+
+// indexPath returns a path for the index of a directory using the v2 layout.
+func (ref dirReference) indexPath() string {
+	return filepath.Join(ref.path, "index.json")
+}
+
+// blobsDir returns a path for the directory containing blobs (including manifests) in a directory using the v2 layout.
+func (ref dirReference) blobsDir() string {
+	return filepath.Join(ref.path, "blobs")
+}
+
+// signaturesDir returns a path for the directory containing signatures in a directory using the v2 layout.
+func (ref dirReference) signaturesDir() string {
+	return filepath.Join(ref.path, "signatures")
+}
@@ -2,6 +2,7 @@ package directory
 
 import (
 	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
@@ -17,6 +18,32 @@ func TestTransportName(t *testing.T) {
 	assert.Equal(t, "dir", Transport.Name())
 }
 
+func TestIndexTransportName(t *testing.T) {
+	assert.Equal(t, "dir-index", IndexTransport.Name())
+}
+
+func TestIndexTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"/etc",
+		"/etc#busybox",
+		"/has#hash#quay.io/ns/busybox:latest",
+	} {
+		err := IndexTransport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"relative/path#busybox",
+		"/double//slashes#busybox",
+		"/etc#",
+		"/etc#-invalid",
+		"/#busybox",
+	} {
+		err := IndexTransport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
 func TestTransportParseReference(t *testing.T) {
 	testNewReference(t, Transport.ParseReference)
 }
@@ -186,9 +213,30 @@ func TestReferenceNewImageDestination(t *testing.T) {
 }
 
 func TestReferenceDeleteImage(t *testing.T) {
-	ref, _ := refToTempDir(t)
-	err := ref.DeleteImage(context.Background(), nil)
-	assert.Error(t, err)
+	// Not a dir: image
+	ref, tmpDir := refToTempDir(t)
+	err := os.WriteFile(filepath.Join(tmpDir, "important"), []byte("data"), 0644)
+	require.NoError(t, err)
+	err = ref.DeleteImage(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNotContainerImageDir)
+	_, err = os.Stat(filepath.Join(tmpDir, "important"))
+	assert.NoError(t, err)
+
+	// An image
+	ref, tmpDir = refToTempDir(t)
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	err = dest.PutManifest(context.Background(), []byte("test-manifest"), nil)
+	require.NoError(t, err)
+	require.NoError(t, dest.Close())
+	err = ref.DeleteImage(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = os.Stat(tmpDir)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// A missing image
+	err = ref.DeleteImage(context.Background(), nil)
+	assert.ErrorIs(t, err, types.ErrNotFound)
 }
 
 func TestReferenceManifestPath(t *testing.T) {
@@ -250,3 +298,75 @@ func TestReferenceVersionPath(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, tmpDir+"/version", dirRef.versionPath())
 }
+
+func TestNewReferenceWithImage(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, c := range []struct{ input, path, image string }{
+		{tmpDir + "#busybox", tmpDir, "busybox"},
+		{tmpDir + "#quay.io/ns/busybox:latest", tmpDir, "quay.io/ns/busybox:latest"},
+		{tmpDir + "/has#hash#name", tmpDir + "/has#hash", "name"},
+	} {
+		ref, err := IndexTransport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		dirRef, ok := ref.(dirReference)
+		require.True(t, ok)
+		assert.Equal(t, c.path, dirRef.path, c.input)
+		assert.Equal(t, c.image, dirRef.image, c.input)
+		assert.Equal(t, c.input, ref.StringWithinTransport(), c.input)
+		assert.Equal(t, IndexTransport, ref.Transport(), c.input)
+	}
+	// The dir: transport treats the whole input as a path.
+	for _, input := range []string{tmpDir + "#busybox", tmpDir + "/has#hash#name"} {
+		ref, err := Transport.ParseReference(input)
+		require.NoError(t, err, input)
+		dirRef, ok := ref.(dirReference)
+		require.True(t, ok)
+		assert.Equal(t, input, dirRef.path, input)
+		assert.Equal(t, "", dirRef.image, input)
+		assert.Equal(t, Transport, ref.Transport(), input)
+	}
+
+	for _, image := range []string{"", "-invalid", "has space", "has#hash"} {
+		_, err := NewReferenceWithImage(tmpDir, image)
+		assert.Error(t, err, image)
+	}
+	for _, input := range []string{tmpDir, tmpDir + "#"} {
+		_, err := IndexTransport.ParseReference(input)
+		assert.Error(t, err, input)
+	}
+
+	ref, err := NewReferenceWithImage(tmpDir, "busybox")
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"#busybox", ref.PolicyConfigurationIdentity())
+	ns := ref.PolicyConfigurationNamespaces()
+	require.NotEmpty(t, ns)
+	assert.Equal(t, tmpDir, ns[0])
+	assert.Equal(t, filepath.Dir(tmpDir), ns[1])
+	assert.NoError(t, IndexTransport.ValidatePolicyConfigurationScope(ref.PolicyConfigurationIdentity()))
+}
+
+func TestReferenceV2Paths(t *testing.T) {
+	dhex := digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+
+	tmpDir := t.TempDir()
+	ref, err := NewReferenceWithImage(tmpDir, "busybox")
+	require.NoError(t, err)
+	dirRef, ok := ref.(dirReference)
+	require.True(t, ok)
+
+	res, err := dirRef.layerPath(dhex)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/blobs/"+dhex.Encoded(), res)
+	res, err = dirRef.manifestPath(&dhex)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/blobs/"+dhex.Encoded(), res)
+	_, err = dirRef.manifestPath(nil)
+	assert.Error(t, err)
+	res, err = dirRef.signaturePath(1, &dhex)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/signatures/"+dhex.Encoded()+".signature-2", res)
+	_, err = dirRef.signaturePath(0, nil)
+	assert.Error(t, err)
+	assert.Equal(t, tmpDir+"/index.json", dirRef.indexPath())
+}
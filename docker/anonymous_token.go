@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+)
+
+// knownRegistryProperties are the properties of a registry detected by pinging it, as remembered for
+// types.SystemContext.DockerRegistryPrefetchAnonymousTokens.
+type knownRegistryProperties struct {
+	scheme             string
+	challenges         []challenge
+	supportsSignatures bool
+}
+
+// knownRegistryPropertiesKey identifies a registry, and the TLS configuration used to ping it.
+type knownRegistryPropertiesKey struct {
+	registry           string
+	insecureSkipVerify bool
+}
+
+var (
+	knownRegistriesMutex sync.Mutex
+	knownRegistries      = map[knownRegistryPropertiesKey]knownRegistryProperties{}
+)
+
+// prefetchAnonymousTokens returns true if c should use, and record, knownRegistries.
+func (c *dockerClient) prefetchAnonymousTokens() bool {
+	return c.sys != nil && c.sys.DockerRegistryPrefetchAnonymousTokens &&
+		c.auth == (types.DockerAuthConfig{}) && c.registryToken == ""
+}
+
+// knownRegistryKey returns the key for c in knownRegistries.
+func (c *dockerClient) knownRegistryKey() knownRegistryPropertiesKey {
+	return knownRegistryPropertiesKey{registry: c.registry, insecureSkipVerify: c.tlsClientConfig.InsecureSkipVerify}
+}
+
+// recordKnownRegistryProperties records the properties of c.registry detected by a ping, if c.prefetchAnonymousTokens().
+func (c *dockerClient) recordKnownRegistryProperties() {
+	if !c.prefetchAnonymousTokens() {
+		return
+	}
+	knownRegistriesMutex.Lock()
+	defer knownRegistriesMutex.Unlock()
+	knownRegistries[c.knownRegistryKey()] = knownRegistryProperties{
+		scheme:             c.scheme,
+		challenges:         slices.Clone(c.challenges),
+		supportsSignatures: c.supportsSignatures,
+	}
+}
+
+// tryKnownRegistryProperties sets the detected registry properties of c from an earlier ping of the same registry,
+// and obtains an anonymous bearer token for c.scope, if c.prefetchAnonymousTokens() and the registry is known to use bearer tokens.
+// It returns true if the properties have been set, or false if the registry should be pinged as usual.
+func (c *dockerClient) tryKnownRegistryProperties(ctx context.Context) bool {
+	if !c.prefetchAnonymousTokens() {
+		return false
+	}
+	knownRegistriesMutex.Lock()
+	known, ok := knownRegistries[c.knownRegistryKey()]
+	knownRegistriesMutex.Unlock()
+	if !ok {
+		return false
+	}
+	// Use the same challenge as setupRequestAuth would.
+	i := slices.IndexFunc(known.challenges, func(ch challenge) bool { return ch.Scheme == "basic" || ch.Scheme == "bearer" })
+	if i == -1 || known.challenges[i].Scheme != "bearer" {
+		return false
+	}
+
+	scopes := []authScope{c.scope}
+	cacheKey, err := c.bearerTokenCacheKey(known.challenges[i], scopes)
+	if err != nil {
+		c.log.Debugf("Prefetching an anonymous token for %s failed, pinging the registry instead: %v", c.registry, err)
+		return false
+	}
+	if _, inCache := c.tokenCache.Get(cacheKey); !inCache {
+		token, err := c.getBearerToken(ctx, known.challenges[i], scopes)
+		if err != nil {
+			c.log.Debugf("Prefetching an anonymous token for %s failed, pinging the registry instead: %v", c.registry, err)
+			return false
+		}
+		c.tokenCache.Put(cacheKey, token.Token, token.expirationTime)
+	}
+	c.log.Debugf("Using previously detected properties of registry %s", c.registry)
+	c.scheme = known.scheme
+	c.challenges = slices.Clone(known.challenges)
+	c.supportsSignatures = known.supportsSignatures
+	return true
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetchAnonymousTokens(t *testing.T) {
+	var mutex sync.Mutex
+	requests := []string{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		requests = append(requests, req.URL.Path)
+		mutex.Unlock()
+		switch {
+		case req.URL.Path == "/token":
+			_, err := rw.Write([]byte(`{"token":"` + req.URL.Query().Get("scope") + `"}`))
+			require.NoError(t, err)
+		case req.Header.Get("Authorization") == "":
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+			rw.WriteHeader(http.StatusUnauthorized)
+		default:
+			rw.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	for _, prefetch := range []bool{false, true} {
+		sys := &types.SystemContext{
+			RegistriesDirPath:                     "/this/does/not/exist",
+			DockerPerHostCertDirPath:              "/this/does/not/exist",
+			SystemRegistriesConfPath:              registriesConf,
+			DockerInsecureSkipTLSVerify:           types.OptionalBoolTrue,
+			AuthFilePath:                          "/this/does/not/exist",
+			DockerRegistryPrefetchAnonymousTokens: prefetch,
+		}
+		registryConfig, err := loadRegistryConfiguration(sys)
+		require.NoError(t, err)
+		requests = []string{}
+		for _, repo := range []string{"repo1", "repo2"} {
+			ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/" + repo + ":tag")
+			require.NoError(t, err)
+			client, err := newDockerClientFromRef(sys, ref.(dockerReference), registryConfig, false, "pull")
+			require.NoError(t, err)
+			err = client.detectProperties(context.Background())
+			require.NoError(t, err)
+			res, err := client.makeRequest(context.Background(), http.MethodGet, "/v2/"+repo+"/manifests/tag", nil, nil, v2Auth, nil)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			client.Close()
+		}
+		if prefetch {
+			// The second client does not ping the registry
+			assert.Equal(t, []string{"/v2/", "/token", "/v2/repo1/manifests/tag", "/token", "/v2/repo2/manifests/tag"}, requests)
+		} else {
+			assert.Equal(t, []string{"/v2/", "/token", "/v2/repo1/manifests/tag", "/v2/", "/token", "/v2/repo2/manifests/tag"}, requests)
+		}
+	}
+}
@@ -1,14 +1,32 @@
 package archive
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/containers/image/v5/docker/internal/tarfile"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+// ImageSummary describes a single image in a Docker archive.
+type ImageSummary struct {
+	// SourceIndex is the zero-based index of the image in the archive manifest,
+	// usable as docker-archive:path:@SourceIndex.
+	SourceIndex int
+	// RepoTags are the tags of the image, as recorded in the archive (i.e. before normalization).
+	RepoTags []string
+	// ConfigDigest is the digest of the image’s config.
+	ConfigDigest digest.Digest
+	// Platform is the platform of the image, as recorded in its config.
+	Platform imgspecv1.Platform
+	// Layers is the number of layers of the image.
+	Layers int
+}
+
 // Reader manages a single Docker archive, allows listing its contents and accessing
 // individual images with less overhead than creating image references individually
 // (because the archive is, if necessary, copied or decompressed only once).
@@ -119,3 +137,40 @@ func (r *Reader) ManifestTagsForReference(ref types.ImageReference) ([]string, e
 	}
 	return manifestItem.RepoTags, nil
 }
+
+// Images returns a summary of every image in the Reader, in the order of the archive manifest.
+// Unlike List, this does not require creating an ImageReference or an ImageSource for every image.
+func (r *Reader) Images() ([]ImageSummary, error) {
+	res := make([]ImageSummary, 0, len(r.archive.Manifest))
+	for imageIndex := range r.archive.Manifest {
+		item := &r.archive.Manifest[imageIndex]
+		configBytes, err := r.archive.ReadManifestItemConfig(item)
+		if err != nil {
+			return nil, fmt.Errorf("reading config of manifest item @%d: %w", imageIndex, err)
+		}
+		var config imgspecv1.Image
+		if err := json.Unmarshal(configBytes, &config); err != nil {
+			return nil, fmt.Errorf("parsing config of manifest item @%d: %w", imageIndex, err)
+		}
+		res = append(res, ImageSummary{
+			SourceIndex:  imageIndex,
+			RepoTags:     append([]string{}, item.RepoTags...),
+			ConfigDigest: digest.FromBytes(configBytes),
+			Platform:     config.Platform,
+			Layers:       len(item.Layers),
+		})
+	}
+	return res, nil
+}
+
+// ListImages returns a summary of every image in the archive at path, in the order of the archive manifest.
+// Callers which also need to access the images should use NewReader and Reader.Images instead,
+// to avoid processing the archive twice.
+func ListImages(sys *types.SystemContext, path string) ([]ImageSummary, error) {
+	reader, err := NewReader(sys, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return reader.Images()
+}
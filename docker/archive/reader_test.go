@@ -0,0 +1,24 @@
+package archive
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListImages(t *testing.T) {
+	images, err := ListImages(nil, tarFixture)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, 0, images[0].SourceIndex)
+	assert.Equal(t, []string{"emptyimage:latest"}, images[0].RepoTags)
+	assert.Equal(t, digest.Digest("sha256:9d7f147c0d0c4d4538a04c7ef385809e56eb1aac7bf800fbe976612188025b68"), images[0].ConfigDigest)
+	assert.Equal(t, "amd64", images[0].Platform.Architecture)
+	assert.Equal(t, "linux", images[0].Platform.OS)
+	assert.Equal(t, 1, images[0].Layers)
+
+	_, err = ListImages(nil, "fixtures/this-does-not-exist.tar")
+	assert.Error(t, err)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/containers/image/v5/docker/internal/tarfile"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/types"
 )
 
@@ -16,6 +17,7 @@ import (
 type Writer struct {
 	path        string // The original, user-specified path; not the maintained temporary file, if any
 	regularFile bool   // path refers to a regular file (e.g. not a pipe)
+	appending   bool   // path refers to a pre-existing archive we are adding images to
 	archive     *tarfile.Writer
 	writer      io.Closer
 
@@ -32,7 +34,13 @@ func NewWriter(sys *types.SystemContext, path string) (*Writer, error) {
 	// in the case of a regular file, we don't want to overwrite any pre-existing file
 	// so we check for Size() == 0 below (This is racy, but using O_EXCL would also be racy,
 	// only in a different way. Either way, it’s up to the user to not have two writers to the same path.)
-	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	// If the caller asked to append to a pre-existing file, we also need to read it.
+	appendRequested := sys != nil && sys.DockerArchiveAppend
+	flags := os.O_WRONLY
+	if appendRequested {
+		flags = os.O_RDWR
+	}
+	fh, err := os.OpenFile(path, flags|os.O_CREATE, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("opening file %q: %w", path, err)
 	}
@@ -48,16 +56,33 @@ func NewWriter(sys *types.SystemContext, path string) (*Writer, error) {
 		return nil, fmt.Errorf("statting file %q: %w", path, err)
 	}
 	regularFile := fhStat.Mode().IsRegular()
+	appending := false
 	if regularFile && fhStat.Size() != 0 {
-		return nil, errors.New("docker-archive doesn't support modifying existing images")
+		if !appendRequested {
+			return nil, errors.New("docker-archive doesn't support modifying existing images")
+		}
+		appending = true
 	}
 
-	archive := tarfile.NewWriter(fh)
+	options := tarfile.WriterOptions{
+		ConcurrentBlobIngestion: sys != nil && sys.DockerArchiveConcurrentBlobIngestion,
+		Logger:                  logging.For(sys),
+	}
+	var archive *tarfile.Writer
+	if appending {
+		archive, err = tarfile.NewWriterAppendingToFile(fh, options)
+		if err != nil {
+			return nil, fmt.Errorf("preparing to append to %q: %w", path, err)
+		}
+	} else {
+		archive = tarfile.NewWriterWithOptions(fh, options)
+	}
 
 	succeeded = true
 	return &Writer{
 		path:        path,
 		regularFile: regularFile,
+		appending:   appending,
 		archive:     archive,
 		writer:      fh,
 		hadCommit:   false,
@@ -79,7 +104,7 @@ func (w *Writer) Close() error {
 	if err2 := w.writer.Close(); err2 != nil && err == nil {
 		err = err2
 	}
-	if err == nil && w.regularFile && !w.hadCommit {
+	if err == nil && w.regularFile && !w.appending && !w.hadCommit {
 		// Writing to the destination never had a success; delete the destination if we created it.
 		// This is done primarily because we don’t implement adding another image to a pre-existing image, so if we
 		// left a partial archive around (notably because reading from the _source_ has failed), we couldn’t retry without
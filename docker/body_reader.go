@@ -14,7 +14,7 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/containers/image/v5/internal/logging"
 )
 
 const (
@@ -31,6 +31,7 @@ type bodyReader struct {
 	c                   *dockerClient
 	path                string   // path to pass to makeRequest to retry
 	logURL              *url.URL // a string to use in error messages
+	log                 logging.Logger
 	firstConnectionTime time.Time
 
 	body            io.ReadCloser // The currently open connection we use to read data, or nil if there is nothing to read from / close.
@@ -53,6 +54,7 @@ func newBodyReader(ctx context.Context, c *dockerClient, path string, firstBody
 		c:                   c,
 		path:                path,
 		logURL:              logURL,
+		log:                 c.log,
 		firstConnectionTime: time.Now(),
 
 		body:            firstBody,
@@ -155,7 +157,7 @@ func (br *bodyReader) Read(p []byte) (int, error) {
 		}
 
 		if err := br.body.Close(); err != nil {
-			logrus.Debugf("Error closing blob body: %v", err) // … and ignore err otherwise
+			br.log.Debugf("Error closing blob body: %v", err) // … and ignore err otherwise
 		}
 		br.body = nil
 		time.Sleep(1*time.Second + time.Duration(rand.Intn(100_000))*time.Microsecond) // Some jitter so that a failure blip doesn’t cause a deterministic stampede
@@ -189,11 +191,11 @@ func (br *bodyReader) Read(p []byte) (int, error) {
 		case http.StatusOK:
 			return n, fmt.Errorf("%w (after reconnecting, server did not process a Range: header, status %d)", originalErr, http.StatusOK)
 		default:
-			err := registryHTTPResponseToError(res)
+			err := registryHTTPResponseToError(br.c.log, res)
 			return n, fmt.Errorf("%w (after reconnecting, fetching blob: %v)", originalErr, err)
 		}
 
-		logrus.Debugf("Successfully reconnected to %s", redactedURL)
+		br.log.Debugf("Successfully reconnected to %s", redactedURL)
 		consumedBody = true
 		br.body = res.Body
 		br.lastRetryOffset = br.offset
@@ -201,7 +203,7 @@ func (br *bodyReader) Read(p []byte) (int, error) {
 		return n, nil
 
 	default:
-		logrus.Debugf("Error reading blob body from %s: %#v", br.logURL.Redacted(), err)
+		br.log.Debugf("Error reading blob body from %s: %#v", br.logURL.Redacted(), err)
 		return n, err
 	}
 }
@@ -222,22 +224,22 @@ func (br *bodyReader) errorIfNotReconnecting(originalErr error, redactedURL stri
 	msSinceFirstConnection := millisecondsSinceOptional(currentTime, br.firstConnectionTime)
 	msSinceLastRetry := millisecondsSinceOptional(currentTime, br.lastRetryTime)
 	msSinceLastSuccess := millisecondsSinceOptional(currentTime, br.lastSuccessTime)
-	logrus.Debugf("Reading blob body from %s failed (%#v), decision inputs: total %d @%.3f ms, last retry %d @%.3f ms, last progress @%.3f ms",
+	br.log.Debugf("Reading blob body from %s failed (%#v), decision inputs: total %d @%.3f ms, last retry %d @%.3f ms, last progress @%.3f ms",
 		redactedURL, originalErr, br.offset, msSinceFirstConnection, br.lastRetryOffset, msSinceLastRetry, msSinceLastSuccess)
 	progress := br.offset - br.lastRetryOffset
 	if progress >= bodyReaderMinimumProgress {
-		logrus.Infof("Reading blob body from %s failed (%v), reconnecting after %d bytes…", redactedURL, originalErr, progress)
+		br.log.Infof("Reading blob body from %s failed (%v), reconnecting after %d bytes…", redactedURL, originalErr, progress)
 		return nil
 	}
 	if br.lastRetryTime == (time.Time{}) {
-		logrus.Infof("Reading blob body from %s failed (%v), reconnecting (first reconnection)…", redactedURL, originalErr)
+		br.log.Infof("Reading blob body from %s failed (%v), reconnecting (first reconnection)…", redactedURL, originalErr)
 		return nil
 	}
 	if msSinceLastRetry >= bodyReaderMSSinceLastRetry {
-		logrus.Infof("Reading blob body from %s failed (%v), reconnecting after %.3f ms…", redactedURL, originalErr, msSinceLastRetry)
+		br.log.Infof("Reading blob body from %s failed (%v), reconnecting after %.3f ms…", redactedURL, originalErr, msSinceLastRetry)
 		return nil
 	}
-	logrus.Debugf("Not reconnecting to %s: insufficient progress %d / time since last retry %.3f ms", redactedURL, progress, msSinceLastRetry)
+	br.log.Debugf("Not reconnecting to %s: insufficient progress %d / time since last retry %.3f ms", redactedURL, progress, msSinceLastRetry)
 	return fmt.Errorf("(heuristic tuning data: total %d @%.3f ms, last retry %d @%.3f ms, last progress @ %.3f ms): %w",
 		br.offset, msSinceFirstConnection, br.lastRetryOffset, msSinceLastRetry, msSinceLastSuccess, originalErr)
 }
@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+// CatalogOptions can be used to modify the behavior of ListRepositories.
+type CatalogOptions struct {
+	// If > 0, the number of repositories to request per page; the registry may return fewer. If 0, the registry default is used.
+	PageSize int
+	// If not "", only list repositories which sort after this one, as defined by the registry.
+	Last string
+	// If not nil, Fallback is used to enumerate the repositories of registry if it does not support the catalog API
+	// (e.g. because it has been disabled); it should call fn for each repository, and return the first error returned by fn.
+	Fallback func(ctx context.Context, registry string, fn func(repository string) error) error
+}
+
+// ListRepositories calls fn for each repository on registry (a host[:port]), using the /v2/_catalog API,
+// as they are received from the registry, following pagination links.
+// The repository names do not include the registry; use reference.ParseNormalizedNamed(registry+"/"+repository)
+// or similar to obtain a full reference.
+// If the registry does not support the catalog API, options.Fallback is used if set; otherwise ErrCatalogNotSupported is returned.
+// options may be nil. If fn returns an error, listing stops and that error is returned.
+func ListRepositories(ctx context.Context, sys *types.SystemContext, registry string, options *CatalogOptions, fn func(repository string) error) error {
+	if options == nil {
+		options = &CatalogOptions{}
+	}
+
+	// We can't use GetCredentialsForRef here because we want to list the whole registry.
+	auth, err := config.GetCredentials(sys, registry)
+	if err != nil {
+		return fmt.Errorf("getting username and password: %w", err)
+	}
+	client, err := newDockerClient(sys, registry, registry)
+	if err != nil {
+		return fmt.Errorf("creating new docker client: %w", err)
+	}
+	defer client.Close()
+	client.auth = auth
+	if sys != nil {
+		client.registryToken = sys.DockerBearerRegistryToken
+	}
+	client.scope = authScope{resourceType: "registry", remoteName: "catalog", actions: "*"}
+
+	path := catalogPath
+	query := url.Values{}
+	if options.PageSize > 0 {
+		query.Set("n", strconv.Itoa(options.PageSize))
+	}
+	if options.Last != "" {
+		query.Set("last", options.Last)
+	}
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+
+	first := true
+	for path != "" {
+		path, err = client.listRepositoriesPage(ctx, path, fn)
+		if err != nil {
+			if first && errors.Is(err, ErrCatalogNotSupported) && options.Fallback != nil {
+				logging.For(sys).Debugf("Catalog API not supported by %s, using the fallback", registry)
+				return options.Fallback(ctx, registry, fn)
+			}
+			return err
+		}
+		first = false
+	}
+	return nil
+}
+
+// listRepositoriesPage calls fn for each repository in a single page of the catalog at path.
+// It returns the path of the next page, or "" if there is none.
+func (c *dockerClient) listRepositoriesPage(ctx context.Context, path string, fn func(repository string) error) (string, error) {
+	res, err := c.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return "", fmt.Errorf("listing repositories in %s: %w", c.registry, ErrCatalogNotSupported)
+	default:
+		err := registryHTTPResponseToError(c.log, res)
+		var ec errcode.ErrorCoder
+		if errors.As(err, &ec) && ec.ErrorCode() == errcode.ErrorCodeUnsupported {
+			return "", fmt.Errorf("listing repositories in %s: %w", c.registry, ErrCatalogNotSupported)
+		}
+		return "", fmt.Errorf("listing repositories in %s: %w", c.registry, err)
+	}
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&catalog); err != nil {
+		return "", err
+	}
+	for _, repo := range catalog.Repositories {
+		if _, err := reference.ParseNamed(c.registry + "/" + repo); err != nil { // Ensure the name does not contain unexpected values
+			return "", fmt.Errorf("registry returned invalid repository name %q: %w", repo, err)
+		}
+		if err := fn(repo); err != nil {
+			return "", err
+		}
+	}
+
+	if link := res.Header.Get("Link"); link != "" {
+		return nextPagePath(link)
+	}
+	return "", nil
+}
@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRepositories(t *testing.T) {
+	catalogSupported := true
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case req.URL.Path == "/v2/_catalog" && !catalogSupported:
+			rw.WriteHeader(http.StatusNotFound)
+		case req.URL.Path == "/v2/_catalog" && req.URL.Query().Get("last") == "":
+			assert.Equal(t, "2", req.URL.Query().Get("n"))
+			rw.Header().Set("Link", `</v2/_catalog?last=b&n=2>; rel="next"`)
+			_, err := rw.Write([]byte(`{"repositories":["a","b"]}`))
+			require.NoError(t, err)
+		case req.URL.Path == "/v2/_catalog" && req.URL.Query().Get("last") == "b":
+			_, err := rw.Write([]byte(`{"repositories":["ns/c"]}`))
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", req.Method, req.URL)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+	}
+
+	repos := []string{}
+	err = ListRepositories(context.Background(), sys, registry, &CatalogOptions{PageSize: 2}, func(repo string) error {
+		repos = append(repos, repo)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "ns/c"}, repos)
+
+	// An error returned by fn stops the listing
+	errStop := errors.New("stop")
+	repos = []string{}
+	err = ListRepositories(context.Background(), sys, registry, &CatalogOptions{PageSize: 2}, func(repo string) error {
+		repos = append(repos, repo)
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, []string{"a"}, repos)
+
+	// Catalog not supported
+	catalogSupported = false
+	err = ListRepositories(context.Background(), sys, registry, nil, func(repo string) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrCatalogNotSupported)
+	repos = []string{}
+	err = ListRepositories(context.Background(), sys, registry, &CatalogOptions{
+		Fallback: func(ctx context.Context, fallbackRegistry string, fn func(repository string) error) error {
+			assert.Equal(t, registry, fallbackRegistry)
+			return fn("fallback")
+		},
+	}, func(repo string) error {
+		repos = append(repos, repo)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fallback"}, repos)
+}
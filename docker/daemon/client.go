@@ -3,17 +3,35 @@ package daemon
 import (
 	"net/http"
 	"path/filepath"
+	"strings"
 
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/internal/timeouts"
 	"github.com/containers/image/v5/types"
 	dockerclient "github.com/docker/docker/client"
 	"github.com/docker/go-connections/tlsconfig"
 )
 
+// daemonHost returns the address of the daemon configured in sys.
+// Unlike dockerclient.Client.DaemonHost, this distinguishes between different daemons accessed over SSH.
+func daemonHost(sys *types.SystemContext) string {
+	if sys != nil && sys.DockerDaemonHost != "" {
+		return sys.DockerDaemonHost
+	}
+	return dockerclient.DefaultDockerHost
+}
+
 // NewDockerClient initializes a new API client based on the passed SystemContext.
 func newDockerClient(sys *types.SystemContext) (*dockerclient.Client, error) {
-	host := dockerclient.DefaultDockerHost
-	if sys != nil && sys.DockerDaemonHost != "" {
-		host = sys.DockerDaemonHost
+	host := daemonHost(sys)
+
+	if strings.HasPrefix(host, "ssh://") {
+		c, err := newSSHDockerClient(sys, host)
+		if err != nil {
+			return nil, err
+		}
+		applyTimeouts(c, sys)
+		return c, nil
 	}
 
 	opts := []dockerclient.Opt{
@@ -58,7 +76,41 @@ func newDockerClient(sys *types.SystemContext) (*dockerclient.Client, error) {
 		opts = append(opts, dockerclient.WithHTTPClient(hc))
 	}
 
-	return dockerclient.NewClientWithOpts(opts...)
+	c, err := dockerclient.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	applyTimeouts(c, sys)
+	return c, nil
+}
+
+// applyTimeouts configures c to use the network timeouts configured in sys.
+func applyTimeouts(c *dockerclient.Client, sys *types.SystemContext) {
+	// c.HTTPClient() returns a copy of the http.Client, but the transport is shared.
+	if tr, ok := c.HTTPClient().Transport.(*http.Transport); ok {
+		timeouts.ApplyToTransport(tr, sys)
+	}
+}
+
+// newSSHDockerClient initializes a new API client tunneled over SSH to the host specified by an ssh:// URL, configured by sys.
+func newSSHDockerClient(sys *types.SystemContext, host string) (*dockerclient.Client, error) {
+	dialer, err := sshDialer(logging.For(sys), host)
+	if err != nil {
+		return nil, err
+	}
+	// The HTTP requests are sent over the SSH tunnel, so the host name in the requests does not matter.
+	// dockerclient.WithHost reconfigures the dialer of the transport, so it must be followed by WithDialContext.
+	return dockerclient.NewClientWithOpts(
+		dockerclient.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				DialContext: dialer,
+			},
+			CheckRedirect: dockerclient.CheckRedirect,
+		}),
+		dockerclient.WithHost(sshDummyHost),
+		dockerclient.WithDialContext(dialer),
+		dockerclient.WithAPIVersionNegotiation(),
+	)
 }
 
 func tlsConfig(sys *types.SystemContext) (*http.Client, error) {
@@ -106,3 +106,14 @@ func testDir(t *testing.T) string {
 	}
 	return testDir
 }
+
+func TestDockerClientFromSSHHost(t *testing.T) {
+	client, err := newDockerClient(&types.SystemContext{DockerDaemonHost: "ssh://user@example.com:2222"})
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+	assert.Equal(t, sshDummyHost, client.DaemonHost())
+	assert.NoError(t, client.Close())
+
+	_, err = newDockerClient(&types.SystemContext{DockerDaemonHost: "ssh://example.com/some/path"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/containerd"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/tmpdir"
+	ociarchive "github.com/containers/image/v5/oci/archive"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/client"
+)
+
+// containerdSnapshotterDriverType is the "driver-type" reported in DriverStatus by daemons which use
+// the containerd image store.
+const containerdSnapshotterDriverType = "io.containerd.snapshotter.v1"
+
+// dockerContainerdNamespace is the containerd namespace used by the Docker Engine.
+const dockerContainerdNamespace = "moby"
+
+// containerdImageStoreHosts caches the results of daemonUsesContainerdImageStore, keyed by the configured daemon host
+// (see daemonHost), so that the daemon is not queried every time an image is opened.
+// (Switching a daemon to or from the containerd image store requires restarting it, and migrating the images;
+// if reading an image fails, the entry is removed by forgetContainerdImageStore, so that the daemon is queried again.)
+var containerdImageStoreHosts = struct {
+	mutex sync.Mutex
+	hosts map[string]bool
+}{hosts: map[string]bool{}}
+
+// daemonUsesContainerdImageStore returns true if the daemon c, configured by sys, stores images in containerd.
+func daemonUsesContainerdImageStore(ctx context.Context, sys *types.SystemContext, c *client.Client) (bool, error) {
+	host := daemonHost(sys)
+	containerdImageStoreHosts.mutex.Lock()
+	res, ok := containerdImageStoreHosts.hosts[host]
+	containerdImageStoreHosts.mutex.Unlock()
+	if ok {
+		return res, nil
+	}
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return false, fmt.Errorf("querying docker engine information: %w", err)
+	}
+	res = usesContainerdImageStore(info)
+	containerdImageStoreHosts.mutex.Lock()
+	containerdImageStoreHosts.hosts[host] = res
+	containerdImageStoreHosts.mutex.Unlock()
+	return res, nil
+}
+
+// forgetContainerdImageStore removes the cached result of daemonUsesContainerdImageStore for the daemon configured by sys.
+func forgetContainerdImageStore(sys *types.SystemContext) {
+	containerdImageStoreHosts.mutex.Lock()
+	defer containerdImageStoreHosts.mutex.Unlock()
+	delete(containerdImageStoreHosts.hosts, daemonHost(sys))
+}
+
+// usesContainerdImageStore returns true if info describes a daemon which stores images in containerd.
+func usesContainerdImageStore(info system.Info) bool {
+	for _, status := range info.DriverStatus {
+		if status[0] == "driver-type" && status[1] == containerdSnapshotterDriverType {
+			return true
+		}
+	}
+	return false
+}
+
+// daemonContainerdImageSource is an image source for daemons which use the containerd image store.
+//
+// If the daemon is local, the address of its containerd instance is configured, and the image is referenced by name,
+// the image is read directly using the containerd content API;
+// otherwise, such daemons include an OCI layout in (docker save) output, which contains the images’ original manifests
+// (including multi-platform indexes) with their original digests, so we read that layout
+// instead of the lossy docker-archive metadata.
+// Either way, the original manifests and digests are preserved.
+type daemonContainerdImageSource struct {
+	private.ImageSource // A containerd source, or an oci-archive source for the saved image
+	ref                 daemonReference
+}
+
+// newContainerdImageSource returns a types.ImageSource for ref, on a daemon c which uses the containerd image store.
+// The caller must call .Close() on the returned ImageSource.
+func newContainerdImageSource(ctx context.Context, sys *types.SystemContext, c *client.Client, ref daemonReference) (private.ImageSource, error) {
+	// The containerd API is only usable if the daemon is local.  The daemon does not report which containerd instance it uses,
+	// and the default one may be a different instance, so only use the API if the caller configured the address explicitly.
+	// containerd only stores images by name, so references by image ID must use (docker save).
+	if ref.ref != nil && strings.HasPrefix(c.DaemonHost(), "unix://") && sys != nil && sys.ContainerdAddress != "" {
+		src, err := newContainerdContentImageSource(ctx, sys, ref)
+		if err == nil {
+			return src, nil
+		}
+		logging.For(sys).Debugf("docker-daemon: reading %s using the containerd API failed, using (docker save) instead: %v", ref.StringWithinTransport(), err)
+	}
+	return newContainerdSavedImageSource(ctx, sys, c, ref)
+}
+
+// newContainerdContentImageSource returns a types.ImageSource reading ref directly from the containerd instance used by a local daemon.
+// The caller must call .Close() on the returned ImageSource.
+func newContainerdContentImageSource(ctx context.Context, sys *types.SystemContext, ref daemonReference) (private.ImageSource, error) {
+	containerdRef, err := containerd.NewReference(dockerContainerdNamespace, ref.ref)
+	if err != nil {
+		return nil, err
+	}
+	src, err := containerdRef.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &daemonContainerdImageSource{
+		ImageSource: imagesource.FromPublic(src),
+		ref:         ref,
+	}, nil
+}
+
+// newContainerdSavedImageSource returns a types.ImageSource reading the OCI layout in the output of (docker save) for ref.
+// The caller must call .Close() on the returned ImageSource.
+func newContainerdSavedImageSource(ctx context.Context, sys *types.SystemContext, c *client.Client, ref daemonReference) (private.ImageSource, error) {
+	inputStream, err := imageSave(ctx, sys, c, ref.StringWithinTransport())
+	if err != nil {
+		return nil, fmt.Errorf("loading image from docker engine: %w", err)
+	}
+	defer inputStream.Close()
+
+	// oci-archive needs a file; it is only used while creating the source, which extracts it.
+	archiveFile, err := tmpdir.CreateBigFileTemp(sys, "docker-daemon-oci")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer func() {
+		archiveFile.Close()
+		if err := os.Remove(archiveFile.Name()); err != nil {
+			logging.For(sys).Debugf("Error removing temporary file %q: %v", archiveFile.Name(), err)
+		}
+	}()
+	var stream io.Reader = inputStream
+	if sys != nil && sys.DockerDaemonProgressCallback != nil {
+		stream = &saveProgressReader{reader: inputStream, progress: sys.DockerDaemonProgressCallback}
+	}
+	if _, err := io.Copy(archiveFile, stream); err != nil {
+		return nil, fmt.Errorf("copying image from docker engine to temporary file %q: %w", archiveFile.Name(), err)
+	}
+
+	archiveRef, err := ociarchive.NewReference(archiveFile.Name(), "")
+	if err != nil {
+		return nil, err
+	}
+	src, err := archiveRef.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, fmt.Errorf("reading OCI layout saved by docker engine: %w", err)
+	}
+	return &daemonContainerdImageSource{
+		ImageSource: imagesource.FromPublic(src),
+		ref:         ref,
+	}, nil
+}
+
+// Reference returns the reference used to set up this source, _as specified by the user_
+// (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
+func (s *daemonContainerdImageSource) Reference() types.ImageReference {
+	return s.ref
+}
@@ -0,0 +1,249 @@
+package daemon
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	apitypes "github.com/containerd/containerd/api/types"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testSocketDir returns a short directory path for UNIX sockets, the length of their paths is limited.
+func testSocketDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "dmn")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// testContainerdManifest returns an OCI manifest used by the tests in this file, and a map of all blobs it refers to.
+func testContainerdManifest() ([]byte, map[digest.Digest][]byte) {
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	// Not canonical JSON, so that the tests notice if the manifest is re-created.
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion": 2, "mediaType": %q, "config": {"mediaType": %q, "digest": %q, "size": %d}, "layers": []}`,
+		imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageConfig, digest.FromBytes(config), len(config)))
+	return manifest, map[digest.Digest][]byte{digest.FromBytes(config): config}
+}
+
+// ociArchiveContents returns a tar archive containing an OCI layout with manifest and blobs, like (docker save) on daemons using
+// the containerd image store.
+func ociArchiveContents(t *testing.T, manifest []byte, blobs map[digest.Digest][]byte) []byte {
+	manifestDigest := digest.FromBytes(manifest)
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    manifestDigest,
+			Size:      int64(len(manifest)),
+		}},
+	})
+	require.NoError(t, err)
+	files := map[string][]byte{
+		"oci-layout": []byte(`{"imageLayoutVersion": "1.0.0"}`),
+		"index.json": index,
+		"blobs/sha256/" + manifestDigest.Encoded(): manifest,
+	}
+	for d, blob := range blobs {
+		files["blobs/sha256/"+d.Encoded()] = blob
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, dir := range []string{"blobs/", "blobs/sha256/"} {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0o755})
+		require.NoError(t, err)
+	}
+	for name, contents := range files {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644, Size: int64(len(contents))})
+		require.NoError(t, err)
+		_, err = tw.Write(contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// fakeDockerDaemon is a minimal Docker Engine API server, for a daemon which uses the containerd image store.
+type fakeDockerDaemon struct {
+	saved     []byte // The response to (docker save)
+	infoCalls atomic.Int32
+	saveCalls atomic.Int32
+}
+
+func (d *fakeDockerDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/_ping":
+		w.Header().Set("API-Version", "1.45")
+		w.WriteHeader(http.StatusOK)
+	case strings.HasSuffix(r.URL.Path, "/info"):
+		d.infoCalls.Add(1)
+		_, _ = w.Write([]byte(`{"DriverStatus":[["driver-type","io.containerd.snapshotter.v1"]]}`))
+	case strings.HasSuffix(r.URL.Path, "/images/get"):
+		d.saveCalls.Add(1)
+		_, _ = w.Write(d.saved)
+	default:
+		http.Error(w, "unexpected request", http.StatusNotFound)
+	}
+}
+
+// startFakeDockerDaemon starts d listening on a UNIX socket if unixSocket, or on TCP otherwise, and returns the daemon host.
+func startFakeDockerDaemon(t *testing.T, d *fakeDockerDaemon, unixSocket bool) string {
+	if !unixSocket {
+		server := httptest.NewServer(d)
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	socket := filepath.Join(testSocketDir(t), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(d)
+	server.Listener = l
+	server.Start()
+	t.Cleanup(server.Close)
+	return "unix://" + socket
+}
+
+// fakeContainerd is a minimal containerd API server, supporting only reading images.
+type fakeContainerd struct {
+	images  map[string]*imagesapi.Image // Image names in the "moby" namespace
+	content map[digest.Digest][]byte
+}
+
+// The services have methods with the same names, so they are implemented by separate types sharing fakeContainerd.
+type fakeContainerdImages struct {
+	imagesapi.UnimplementedImagesServer
+	f *fakeContainerd
+}
+type fakeContainerdContent struct {
+	contentapi.UnimplementedContentServer
+	f *fakeContainerd
+}
+
+// startFakeContainerd starts f, and returns its socket path.
+func startFakeContainerd(t *testing.T, f *fakeContainerd) string {
+	socket := filepath.Join(testSocketDir(t), "containerd.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	contentapi.RegisterContentServer(server, fakeContainerdContent{f: f})
+	imagesapi.RegisterImagesServer(server, fakeContainerdImages{f: f})
+	go func() {
+		_ = server.Serve(l)
+	}()
+	t.Cleanup(server.Stop)
+	return socket
+}
+
+// checkNamespace returns an error if ctx is not a request in the namespace used by the Docker Engine.
+func checkNamespace(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ns := md.Get("containerd-namespace"); len(ns) != 1 || ns[0] != dockerContainerdNamespace {
+		return status.Errorf(codes.FailedPrecondition, "unexpected namespace %v", ns)
+	}
+	return nil
+}
+
+func (i fakeContainerdImages) Get(ctx context.Context, req *imagesapi.GetImageRequest) (*imagesapi.GetImageResponse, error) {
+	if err := checkNamespace(ctx); err != nil {
+		return nil, err
+	}
+	image, ok := i.f.images[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "image %s not found", req.Name)
+	}
+	return &imagesapi.GetImageResponse{Image: image}, nil
+}
+
+func (c fakeContainerdContent) Read(req *contentapi.ReadContentRequest, srv contentapi.Content_ReadServer) error {
+	if err := checkNamespace(srv.Context()); err != nil {
+		return err
+	}
+	data, ok := c.f.content[digest.Digest(req.Digest)]
+	if !ok {
+		return status.Errorf(codes.NotFound, "content %s not found", req.Digest)
+	}
+	return srv.Send(&contentapi.ReadContentResponse{Data: data[req.Offset:]})
+}
+
+func TestNewImageSourceContainerdImageStore(t *testing.T) {
+	ctx := context.Background()
+	manifest, blobs := testContainerdManifest()
+	saved := ociArchiveContents(t, manifest, blobs)
+	ref, err := ParseReference("busybox:latest")
+	require.NoError(t, err)
+
+	checkManifest := func(t *testing.T, sys *types.SystemContext) {
+		src, err := ref.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		defer src.Close()
+		assert.Equal(t, ref, src.Reference())
+		m, mimeType, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, manifest, m)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+	}
+
+	// A remote daemon: the image is read from (docker save), and the daemon is only queried about its image store once.
+	daemon := &fakeDockerDaemon{saved: saved}
+	sys := &types.SystemContext{DockerDaemonHost: startFakeDockerDaemon(t, daemon, false)}
+	checkManifest(t, sys)
+	checkManifest(t, sys)
+	assert.Equal(t, int32(1), daemon.infoCalls.Load())
+	assert.Equal(t, int32(2), daemon.saveCalls.Load())
+
+	// A local daemon, with a reachable containerd: the image is read using the containerd API.
+	containerdSocket := startFakeContainerd(t, &fakeContainerd{
+		images: map[string]*imagesapi.Image{
+			"docker.io/library/busybox:latest": {
+				Name: "docker.io/library/busybox:latest",
+				Target: &apitypes.Descriptor{
+					MediaType: imgspecv1.MediaTypeImageManifest,
+					Digest:    digest.FromBytes(manifest).String(),
+					Size:      int64(len(manifest)),
+				},
+			},
+		},
+		content: map[digest.Digest][]byte{digest.FromBytes(manifest): manifest},
+	})
+	daemon = &fakeDockerDaemon{saved: saved}
+	sys = &types.SystemContext{
+		DockerDaemonHost:  startFakeDockerDaemon(t, daemon, true),
+		ContainerdAddress: containerdSocket,
+	}
+	checkManifest(t, sys)
+	assert.Equal(t, int32(0), daemon.saveCalls.Load())
+
+	// A local daemon, without an explicitly configured containerd: the image is read from (docker save),
+	// because the default containerd instance may not be the one used by the daemon.
+	t.Setenv("CONTAINERD_ADDRESS", containerdSocket)
+	daemon2 := &fakeDockerDaemon{saved: saved}
+	checkManifest(t, &types.SystemContext{DockerDaemonHost: startFakeDockerDaemon(t, daemon2, true)})
+	assert.Equal(t, int32(1), daemon2.saveCalls.Load())
+
+	// A local daemon, with an unreachable containerd: the image is read from (docker save).
+	sys.ContainerdAddress = filepath.Join(testSocketDir(t), "does-not-exist.sock")
+	checkManifest(t, sys)
+	assert.Equal(t, int32(1), daemon.saveCalls.Load())
+}
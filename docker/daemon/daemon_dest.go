@@ -6,13 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/containers/image/v5/docker/internal/tarfile"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/types"
 	"github.com/docker/docker/client"
-	"github.com/sirupsen/logrus"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type daemonImageDestination struct {
@@ -26,6 +30,7 @@ type daemonImageDestination struct {
 	writer          *io.PipeWriter
 	// Other state
 	committed bool // writer has been closed
+	log       logging.Logger
 }
 
 // newImageDestination returns a types.ImageDestination for the specified image reference.
@@ -39,7 +44,7 @@ func newImageDestination(ctx context.Context, sys *types.SystemContext, ref daem
 	}
 
 	var mustMatchRuntimeOS = true
-	if sys != nil && sys.DockerDaemonHost != client.DefaultDockerHost {
+	if sys != nil && (sys.DockerDaemonHost != client.DefaultDockerHost || sys.DockerDaemonPlatform != nil) {
 		mustMatchRuntimeOS = false
 	}
 
@@ -48,13 +53,19 @@ func newImageDestination(ctx context.Context, sys *types.SystemContext, ref daem
 		return nil, fmt.Errorf("initializing docker engine client: %w", err)
 	}
 
+	log := logging.For(sys)
 	reader, writer := io.Pipe()
-	archive := tarfile.NewWriter(writer)
+	archive := tarfile.NewWriterWithOptions(writer, tarfile.WriterOptions{Logger: log})
 	// Commit() may never be called, so we may never read from this channel; so, make this buffered to allow imageLoadGoroutine to write status and terminate even if we never read it.
 	statusChannel := make(chan error, 1)
 
+	var progress func(types.DockerDaemonProgressEvent)
+	if sys != nil {
+		progress = sys.DockerDaemonProgressCallback
+	}
+
 	goroutineContext, goroutineCancel := context.WithCancel(ctx)
-	go imageLoadGoroutine(goroutineContext, c, reader, statusChannel)
+	go imageLoadGoroutine(goroutineContext, c, reader, requestedPlatform(sys), progress, log, statusChannel)
 
 	return &daemonImageDestination{
 		ref:                ref,
@@ -65,15 +76,19 @@ func newImageDestination(ctx context.Context, sys *types.SystemContext, ref daem
 		statusChannel:      statusChannel,
 		writer:             writer,
 		committed:          false,
+		log:                log,
 	}, nil
 }
 
-// imageLoadGoroutine accepts tar stream on reader, sends it to c, and reports error or success by writing to statusChannel
-func imageLoadGoroutine(ctx context.Context, c *client.Client, reader *io.PipeReader, statusChannel chan<- error) {
+// imageLoadGoroutine accepts tar stream on reader, sends it to c, and reports error or success by writing to statusChannel.
+// If platform is not nil, the image is loaded for that platform.
+// If progress is not nil, it is called with progress reports from c.
+func imageLoadGoroutine(ctx context.Context, c *client.Client, reader *io.PipeReader, platform *imgspecv1.Platform,
+	progress func(types.DockerDaemonProgressEvent), log logging.Logger, statusChannel chan<- error) {
 	defer c.Close()
 	err := errors.New("Internal error: unexpected panic in imageLoadGoroutine")
 	defer func() {
-		logrus.Debugf("docker-daemon: sending done, status %v", err)
+		log.Debugf("docker-daemon: sending done, status %v", err)
 		statusChannel <- err
 	}()
 	defer func() {
@@ -81,32 +96,62 @@ func imageLoadGoroutine(ctx context.Context, c *client.Client, reader *io.PipeRe
 			reader.Close()
 		} else {
 			if err := reader.CloseWithError(err); err != nil {
-				logrus.Debugf("imageLoadGoroutine: Error during reader.CloseWithError: %v", err)
+				log.Debugf("imageLoadGoroutine: Error during reader.CloseWithError: %v", err)
 			}
 		}
 	}()
 
-	err = imageLoad(ctx, c, reader)
+	err = imageLoad(ctx, c, reader, platform, progress)
 }
 
-// imageLoad accepts tar stream on reader and sends it to c
-func imageLoad(ctx context.Context, c *client.Client, reader *io.PipeReader) error {
-	resp, err := c.ImageLoad(ctx, reader, true)
-	if err != nil {
-		return fmt.Errorf("starting a load operation in docker engine: %w", err)
+// imageLoad accepts tar stream on reader and sends it to c.
+// If platform is not nil, the image is loaded for that platform.
+// If progress is not nil, it is called with progress reports from c.
+func imageLoad(ctx context.Context, c *client.Client, reader *io.PipeReader, platform *imgspecv1.Platform, progress func(types.DockerDaemonProgressEvent)) error {
+	var body io.ReadCloser
+	if platform != nil {
+		quiet := "1"
+		if progress != nil {
+			quiet = "0"
+		}
+		b, err := platformAPIRequest(ctx, c, http.MethodPost, "/images/load", url.Values{"quiet": {quiet}}, platform, reader, "application/x-tar")
+		if err != nil {
+			return fmt.Errorf("starting a load operation in docker engine: %w", err)
+		}
+		body = b
+	} else {
+		resp, err := c.ImageLoad(ctx, reader, progress == nil)
+		if err != nil {
+			return fmt.Errorf("starting a load operation in docker engine: %w", err)
+		}
+		body = resp.Body
 	}
-	defer resp.Body.Close()
+	defer body.Close()
+
+	return parseImageLoadResponse(body, progress)
+}
 
-	// jsonError and jsonMessage are small subsets of docker/docker/pkg/jsonmessage.JSONError and JSONMessage,
-	// copied here to minimize dependencies.
+// parseImageLoadResponse processes the JSON progress stream returned by a docker load operation,
+// calling progress, if not nil, with every progress report.
+func parseImageLoadResponse(body io.Reader, progress func(types.DockerDaemonProgressEvent)) error {
+	// jsonError, jsonProgress and jsonMessage are small subsets of docker/docker/pkg/jsonmessage.JSONError,
+	// JSONProgress and JSONMessage, copied here to minimize dependencies.
 	type jsonError struct {
 		Message string `json:"message,omitempty"`
 	}
+	type jsonProgress struct {
+		Current int64 `json:"current,omitempty"`
+		Total   int64 `json:"total,omitempty"`
+	}
 	type jsonMessage struct {
-		Error *jsonError `json:"errorDetail,omitempty"`
+		Stream   string        `json:"stream,omitempty"`
+		Status   string        `json:"status,omitempty"`
+		Progress *jsonProgress `json:"progressDetail,omitempty"`
+		ID       string        `json:"id,omitempty"`
+		Error    *jsonError    `json:"errorDetail,omitempty"`
 	}
 
-	dec := json.NewDecoder(resp.Body)
+	dec := json.NewDecoder(body)
 	for {
 		var msg jsonMessage
 		if err := dec.Decode(&msg); err != nil {
@@ -118,6 +163,22 @@ func imageLoad(ctx context.Context, c *client.Client, reader *io.PipeReader) err
 		if msg.Error != nil {
 			return fmt.Errorf("docker engine reported: %q", msg.Error.Message)
 		}
+		if progress != nil {
+			event := types.DockerDaemonProgressEvent{
+				ID:     msg.ID,
+				Status: msg.Status,
+			}
+			if event.Status == "" {
+				event.Status = strings.TrimSpace(msg.Stream)
+			}
+			if msg.Progress != nil {
+				event.Current = msg.Progress.Current
+				event.Total = msg.Progress.Total
+			}
+			if event.Status != "" || event.ID != "" {
+				progress(event)
+			}
+		}
 	}
 	return nil // No error reported = success
 }
@@ -135,7 +196,7 @@ func (d *daemonImageDestination) MustMatchRuntimeOS() bool {
 // Close removes resources associated with an initialized ImageDestination, if any.
 func (d *daemonImageDestination) Close() error {
 	if !d.committed {
-		logrus.Debugf("docker-daemon: Closing tar stream to abort loading")
+		d.log.Debugf("docker-daemon: Closing tar stream to abort loading")
 		// In principle, goroutineCancel() should abort the HTTP request and stop the process from continuing.
 		// In practice, though, various HTTP implementations used by client.Client.ImageLoad() (including
 		// https://github.com/golang/net/blob/master/context/ctxhttp/ctxhttp_pre17.go and the
@@ -167,7 +228,7 @@ func (d *daemonImageDestination) Reference() types.ImageReference {
 // - Uploaded data MAY be visible to others before Commit() is called
 // - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
 func (d *daemonImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
-	logrus.Debugf("docker-daemon: Closing tar stream")
+	d.log.Debugf("docker-daemon: Closing tar stream")
 	if err := d.archive.Close(); err != nil {
 		return err
 	}
@@ -176,7 +237,7 @@ func (d *daemonImageDestination) Commit(ctx context.Context, unparsedToplevel ty
 	}
 	d.committed = true // We may still fail, but we are done sending to imageLoadGoroutine.
 
-	logrus.Debugf("docker-daemon: Waiting for status")
+	d.log.Debugf("docker-daemon: Waiting for status")
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
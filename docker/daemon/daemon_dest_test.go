@@ -1,5 +1,40 @@
 package daemon
 
-import "github.com/containers/image/v5/internal/private"
+import (
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
 var _ private.ImageDestination = (*daemonImageDestination)(nil)
+
+func TestParseImageLoadResponse(t *testing.T) {
+	const response = `{"status":"Loading layer","progressDetail":{"current":32768,"total":65536},"progress":"[=====>     ]","id":"abcdef012345"}
+{"status":"Loading layer","progressDetail":{"current":65536,"total":65536},"id":"abcdef012345"}
+{"stream":"Loaded image: example.com/foo:latest\n"}
+`
+	events := []types.DockerDaemonProgressEvent{}
+	err := parseImageLoadResponse(strings.NewReader(response), func(e types.DockerDaemonProgressEvent) {
+		events = append(events, e)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []types.DockerDaemonProgressEvent{
+		{ID: "abcdef012345", Status: "Loading layer", Current: 32768, Total: 65536},
+		{ID: "abcdef012345", Status: "Loading layer", Current: 65536, Total: 65536},
+		{Status: "Loaded image: example.com/foo:latest"},
+	}, events)
+
+	// No callback
+	err = parseImageLoadResponse(strings.NewReader(response), nil)
+	assert.NoError(t, err)
+
+	// Errors
+	err = parseImageLoadResponse(strings.NewReader(`{"errorDetail":{"message":"failed"}}`), nil)
+	assert.Error(t, err)
+	err = parseImageLoadResponse(strings.NewReader(`{"status":`), nil)
+	assert.Error(t, err)
+}
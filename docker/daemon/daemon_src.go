@@ -3,8 +3,10 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/containers/image/v5/docker/internal/tarfile"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/types"
 )
@@ -30,15 +32,34 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref daemonRef
 	}
 	defer c.Close()
 
+	usesContainerd, err := daemonUsesContainerdImageStore(ctx, sys, c)
+	if err != nil {
+		return nil, err
+	}
+	if usesContainerd {
+		logging.For(sys).Debugf("docker-daemon: the daemon uses the containerd image store")
+		src, err := newContainerdImageSource(ctx, sys, c, ref)
+		if err != nil {
+			forgetContainerdImageStore(sys) // The daemon may have been reconfigured.
+			return nil, err
+		}
+		return src, nil
+	}
+
 	// Per NewReference(), ref.StringWithinTransport() is either an image ID (config digest), or a !reference.NameOnly() reference.
 	// Either way ImageSave should create a tarball with exactly one image.
-	inputStream, err := c.ImageSave(ctx, []string{ref.StringWithinTransport()})
+	inputStream, err := imageSave(ctx, sys, c, ref.StringWithinTransport())
 	if err != nil {
 		return nil, fmt.Errorf("loading image from docker engine: %w", err)
 	}
 	defer inputStream.Close()
 
-	archive, err := tarfile.NewReaderFromStream(sys, inputStream)
+	var stream io.Reader = inputStream
+	if sys != nil && sys.DockerDaemonProgressCallback != nil {
+		stream = &saveProgressReader{reader: inputStream, progress: sys.DockerDaemonProgressCallback}
+	}
+
+	archive, err := tarfile.NewReaderFromStream(sys, stream)
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +70,23 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref daemonRef
 	}, nil
 }
 
+// saveProgressReader is an io.Reader which reports the number of bytes of (docker save) output read so far.
+// The Docker Engine does not report any progress of save operations on its own.
+type saveProgressReader struct {
+	reader   io.Reader
+	progress func(types.DockerDaemonProgressEvent)
+	current  int64
+}
+
+func (r *saveProgressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.current += int64(n)
+		r.progress(types.DockerDaemonProgressEvent{Status: "Saving", Current: r.current})
+	}
+	return n, err
+}
+
 // Reference returns the reference used to set up this source, _as specified by the user_
 // (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
 func (s *daemonImageSource) Reference() types.ImageReference {
@@ -1,5 +1,25 @@
 package daemon
 
-import "github.com/containers/image/v5/internal/private"
+import (
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/docker/docker/api/types/system"
+	"github.com/stretchr/testify/assert"
+)
 
 var _ private.ImageSource = (*daemonImageSource)(nil)
+var _ private.ImageSource = (*daemonContainerdImageSource)(nil)
+
+func TestUsesContainerdImageStore(t *testing.T) {
+	for _, c := range []struct {
+		status   [][2]string
+		expected bool
+	}{
+		{nil, false},
+		{[][2]string{{"Backing Filesystem", "extfs"}, {"Supports d_type", "true"}}, false},
+		{[][2]string{{"driver-type", "io.containerd.snapshotter.v1"}}, true},
+	} {
+		assert.Equal(t, c.expected, usesContainerdImageStore(system.Info{DriverStatus: c.status}), c.status)
+	}
+}
@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/timeouts"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// minimumPlatformAPIVersion is the first Engine API version which supports the platform parameter
+// of the image save and load operations.
+const minimumPlatformAPIVersion = "1.48"
+
+// requestedPlatform returns the platform requested in sys, or nil if the daemon default should be used.
+func requestedPlatform(sys *types.SystemContext) *imgspecv1.Platform {
+	if sys == nil {
+		return nil
+	}
+	return sys.DockerDaemonPlatform
+}
+
+// daemonBaseURL returns the base URL for raw HTTP requests to a daemon at host, as used by newDockerClient.
+func daemonBaseURL(host string) (string, error) {
+	hostURL, err := client.ParseHostURL(host)
+	if err != nil {
+		return "", err
+	}
+	switch hostURL.Scheme {
+	case "unix", "npipe":
+		// The transport dials the socket and ignores the host name.
+		return "http://" + client.DummyHost, nil
+	case "http":
+		return "http://" + hostURL.Host + hostURL.Path, nil
+	default: // newDockerClient uses TLS for all other schemes
+		return "https://" + hostURL.Host + hostURL.Path, nil
+	}
+}
+
+// platformAPIRequest sends a request for apiPath with query, and an additional platform parameter, to the daemon c
+// connects to, and returns the response body. The caller must close the returned body.
+//
+// The dockerclient.Client does not support the platform parameter, so this builds the request manually,
+// using the HTTP client (and its transport, which knows how to connect to the daemon) of c.
+func platformAPIRequest(ctx context.Context, c *client.Client, method, apiPath string, query url.Values,
+	platform *imgspecv1.Platform, body io.Reader, contentType string) (io.ReadCloser, error) {
+	ping, err := c.Ping(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("contacting docker engine: %w", err)
+	}
+	if ping.APIVersion == "" || versions.LessThan(ping.APIVersion, minimumPlatformAPIVersion) {
+		return nil, fmt.Errorf("docker engine API version %q does not support selecting a platform, at least %s is required",
+			ping.APIVersion, minimumPlatformAPIVersion)
+	}
+
+	platformJSON, err := json.Marshal(platform)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("platform", string(platformJSON))
+
+	baseURL, err := daemonBaseURL(c.DaemonHost())
+	if err != nil {
+		return nil, err
+	}
+	requestURL := strings.TrimSuffix(baseURL, "/") + "/v" + minimumPlatformAPIVersion + apiPath + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.HTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, err := iolimits.ReadAtMost(resp.Body, iolimits.MaxErrorBodySize)
+		category := errcategory.FromHTTPStatus(resp.StatusCode)
+		if err != nil {
+			return nil, errcategory.Wrap(fmt.Errorf("docker engine returned status %s", resp.Status), category)
+		}
+		return nil, errcategory.Wrap(fmt.Errorf("docker engine returned status %s: %s", resp.Status, strings.TrimSpace(string(msg))), category)
+	}
+	return resp.Body, nil
+}
+
+// imageSave returns a (docker save) stream of the image name from c, for the platform requested in sys, if any.
+// The caller must close the returned stream.
+func imageSave(ctx context.Context, sys *types.SystemContext, c *client.Client, name string) (io.ReadCloser, error) {
+	watchdog, ctx := timeouts.NewWatchdog(ctx, sys)
+	var stream io.ReadCloser
+	var err error
+	if platform := requestedPlatform(sys); platform != nil {
+		stream, err = platformAPIRequest(ctx, c, http.MethodGet, "/images/get", url.Values{"names": {name}}, platform, nil, "")
+	} else {
+		stream, err = c.ImageSave(ctx, []string{name})
+		if client.IsErrNotFound(err) {
+			err = errcategory.Wrap(err, types.ErrNotFound)
+		}
+	}
+	if err != nil {
+		watchdog.Stop()
+		return nil, watchdog.Err(err)
+	}
+	return watchdog.Wrap(stream), nil
+}
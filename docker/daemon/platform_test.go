@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemonBaseURL(t *testing.T) {
+	for _, c := range []struct{ host, expected string }{
+		{"unix:///var/run/docker.sock", "http://api.moby.localhost"},
+		{"http://127.0.0.1:2375", "http://127.0.0.1:2375"},
+		{"tcp://127.0.0.1:2376", "https://127.0.0.1:2376"},
+		{"tcp://127.0.0.1:2376/prefix", "https://127.0.0.1:2376/prefix"},
+	} {
+		res, err := daemonBaseURL(c.host)
+		require.NoError(t, err, c.host)
+		assert.Equal(t, c.expected, res, c.host)
+	}
+	_, err := daemonBaseURL("no-scheme")
+	assert.Error(t, err)
+}
+
+func TestImageSaveWithPlatform(t *testing.T) {
+	apiVersion := "1.48"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_ping":
+			w.Header().Set("API-Version", apiVersion)
+			w.WriteHeader(http.StatusOK)
+		case "/v1.48/images/get":
+			assert.Equal(t, []string{"busybox:latest"}, r.URL.Query()["names"])
+			assert.Equal(t, `{"architecture":"arm64","os":"linux","variant":"v8"}`, r.URL.Query().Get("platform"))
+			_, _ = w.Write([]byte("tar contents"))
+		default:
+			http.Error(w, "unexpected request", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	sys := &types.SystemContext{
+		DockerDaemonHost:     "http://" + serverURL.Host,
+		DockerDaemonPlatform: &imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}
+	c, err := newDockerClient(sys)
+	require.NoError(t, err)
+	defer c.Close()
+
+	stream, err := imageSave(context.Background(), sys, c, "busybox:latest")
+	require.NoError(t, err)
+	contents, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "tar contents", string(contents))
+	require.NoError(t, stream.Close())
+
+	apiVersion = "1.45"
+	_, err = imageSave(context.Background(), sys, c, "busybox:latest")
+	assert.Error(t, err)
+}
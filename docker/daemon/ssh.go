@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/containers/image/v5/internal/commandconn"
+	"github.com/containers/image/v5/internal/logging"
+)
+
+// sshDummyHost is the host name used in HTTP requests tunneled over SSH; the value is never resolved.
+const sshDummyHost = "http://docker.example.com"
+
+// sshCommandArgs returns the arguments of an ssh(1) invocation which connects to the Docker Engine API
+// on the host specified by an ssh://[user@]host[:port] URL.
+func sshCommandArgs(sshURL string) ([]string, error) {
+	u, err := url.Parse(sshURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing docker daemon host %q: %w", sshURL, err)
+	}
+	if u.Scheme != "ssh" {
+		return nil, fmt.Errorf("docker daemon host %q is not an ssh:// URL", sshURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("docker daemon host %q does not specify a host name", sshURL)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("docker daemon host %q must not contain a path", sshURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("docker daemon host %q must not contain a query or a fragment", sshURL)
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return nil, fmt.Errorf("docker daemon host %q must not contain a password, use an SSH key or an agent instead", sshURL)
+	}
+
+	args := []string{}
+	if user := u.User.Username(); user != "" {
+		args = append(args, "-l", user)
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	// "--" ensures that a host name starting with "-" is not interpreted as an option.
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+	return args, nil
+}
+
+// sshDialer returns a DialContext function which connects to the Docker Engine API on the host specified by
+// an ssh://[user@]host[:port] URL, using (ssh host docker system dial-stdio); the network and addr
+// arguments are ignored.  Debug messages are logged to log.
+func sshDialer(log logging.Logger, sshURL string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	args, err := sshCommandArgs(sshURL)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		log.Debugf("docker-daemon: connecting using ssh %v", args)
+		return commandconn.New(ctx, "ssh", args...)
+	}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,9 +18,14 @@ import (
 	"time"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errcategory"
 	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/multierr"
 	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/timeouts"
+	"github.com/containers/image/v5/internal/tracing"
 	"github.com/containers/image/v5/internal/useragent"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/docker/config"
@@ -33,7 +39,6 @@ import (
 	"github.com/docker/go-connections/tlsconfig"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -48,6 +53,8 @@ const (
 	blobsPath               = "/v2/%s/blobs/%s"
 	blobUploadPath          = "/v2/%s/blobs/uploads/"
 	extensionsSignaturePath = "/extensions/v2/%s/signatures/%s"
+	referrersPath           = "/v2/%s/referrers/%s"
+	catalogPath             = "/v2/_catalog"
 
 	minimumTokenLifetimeSeconds = 60
 
@@ -89,6 +96,7 @@ type extensionSignatureList struct {
 type bearerToken struct {
 	Token          string    `json:"token"`
 	AccessToken    string    `json:"access_token"`
+	RefreshToken   string    `json:"refresh_token"` // Only set by OAuth 2.0 token endpoints which rotate refresh tokens
 	ExpiresIn      int       `json:"expires_in"`
 	IssuedAt       time.Time `json:"issued_at"`
 	expirationTime time.Time
@@ -100,16 +108,21 @@ type dockerClient struct {
 	sys       *types.SystemContext
 	registry  string
 	userAgent string
+	log       logging.Logger
 
 	// tlsClientConfig is setup by newDockerClient and will be used and updated
 	// by detectProperties(). Callers can edit tlsClientConfig.InsecureSkipVerify in the meantime.
 	tlsClientConfig *tls.Config
+	// proxy is setup by newDockerClient and will be used by detectProperties(), as http.Transport.Proxy;
+	// nil means using the proxy environment variables. Callers can change it in the meantime.
+	proxy func(*http.Request) (*url.URL, error)
 	// The following members are not set by newDockerClient and must be set by callers if needed.
-	auth                   types.DockerAuthConfig
-	registryToken          string
-	signatureBase          lookasideStorageBase
-	useSigstoreAttachments bool
-	scope                  authScope
+	auth                      types.DockerAuthConfig
+	registryToken             string
+	signatureBase             lookasideStorageBase
+	useSigstoreAttachments    bool
+	sigstoreAttachmentsFormat string // One of sigstoreAttachmentsFormat*, relevant only if useSigstoreAttachments
+	scope                     authScope
 
 	// The following members are detected registry properties:
 	// They are set after a successful detectProperties(), and never change afterwards.
@@ -118,8 +131,11 @@ type dockerClient struct {
 	challenges         []challenge
 	supportsSignatures bool
 
-	// Private state for setupRequestAuth (key: string, value: bearerToken)
-	tokenCache sync.Map
+	// Private state for setupRequestAuth
+	tokenCache types.DockerBearerTokenCache
+	// Private state for getBearerTokenOAuth2
+	identityTokenLock      sync.Mutex
+	refreshedIdentityToken string // If not "", a newer identity token issued by the registry, replacing auth.IdentityToken
 	// Private state for detectProperties:
 	detectPropertiesOnce  sync.Once // detectPropertiesOnce is used to execute detectProperties() at most once.
 	detectPropertiesError error     // detectPropertiesError caches the initial error.
@@ -149,7 +165,7 @@ const (
 
 // newBearerTokenFromHTTPResponseBody parses a http.Response to obtain a bearerToken.
 // The caller is still responsible for ensuring res.Body is closed.
-func newBearerTokenFromHTTPResponseBody(res *http.Response) (*bearerToken, error) {
+func newBearerTokenFromHTTPResponseBody(log logging.Logger, res *http.Response) (*bearerToken, error) {
 	blob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxAuthTokenBodySize)
 	if err != nil {
 		return nil, err
@@ -169,7 +185,7 @@ func newBearerTokenFromHTTPResponseBody(res *http.Response) (*bearerToken, error
 	}
 	if token.ExpiresIn < minimumTokenLifetimeSeconds {
 		token.ExpiresIn = minimumTokenLifetimeSeconds
-		logrus.Debugf("Increasing token expiration to: %d seconds", token.ExpiresIn)
+		log.Debugf("Increasing token expiration to: %d seconds", token.ExpiresIn)
 	}
 	if token.IssuedAt.IsZero() {
 		token.IssuedAt = time.Now().UTC()
@@ -208,7 +224,7 @@ func dockerCertDir(sys *types.SystemContext, hostPort string) (string, error) {
 			continue
 		}
 		if os.IsPermission(err) {
-			logrus.Debugf("error accessing certs directory due to permissions: %v", err)
+			logging.For(sys).Debugf("error accessing certs directory due to permissions: %v", err)
 			continue
 		}
 		return "", err
@@ -230,6 +246,10 @@ func newDockerClientFromRef(sys *types.SystemContext, ref dockerReference, regis
 	if err != nil {
 		return nil, err
 	}
+	sigstoreAttachmentsFormat, err := registryConfig.sigstoreAttachmentsFormat(ref)
+	if err != nil {
+		return nil, err
+	}
 
 	registry := reference.Domain(ref.ref)
 	client, err := newDockerClient(sys, registry, ref.ref.Name())
@@ -242,6 +262,7 @@ func newDockerClientFromRef(sys *types.SystemContext, ref dockerReference, regis
 	}
 	client.signatureBase = sigBase
 	client.useSigstoreAttachments = registryConfig.useSigstoreAttachments(ref)
+	client.sigstoreAttachmentsFormat = sigstoreAttachmentsFormat
 	client.scope.resourceType = "repository"
 	client.scope.actions = actions
 	client.scope.remoteName = reference.Path(ref.ref)
@@ -276,10 +297,18 @@ func newDockerClient(sys *types.SystemContext, registry, reference string) (*doc
 	if err := tlsclientconfig.SetupCertificates(certDir, tlsClientConfig); err != nil {
 		return nil, err
 	}
+	if sys != nil {
+		if tlsConfig, ok := sys.DockerRegistryTLSConfigs[hostName]; ok && tlsConfig != nil {
+			if err := tlsclientconfig.SetupPEMCertificates(tlsConfig.CACertificates, tlsConfig.ClientCertificate, tlsConfig.ClientKey, tlsClientConfig); err != nil {
+				return nil, fmt.Errorf("setting up TLS configuration for %s: %w", hostName, err)
+			}
+		}
+	}
 
 	// Check if TLS verification shall be skipped (default=false) which can
 	// be specified in the sysregistriesv2 configuration.
 	skipVerify := false
+	endpointProxy := ""
 	reg, err := sysregistriesv2.FindRegistry(sys, reference)
 	if err != nil {
 		return nil, fmt.Errorf("loading registries: %w", err)
@@ -289,19 +318,32 @@ func newDockerClient(sys *types.SystemContext, registry, reference string) (*doc
 			return nil, fmt.Errorf("registry %s is blocked in %s or %s", reg.Prefix, sysregistriesv2.ConfigPath(sys), sysregistriesv2.ConfigDirPath(sys))
 		}
 		skipVerify = reg.Insecure
+		endpointProxy = reg.Proxy
 	}
 	tlsClientConfig.InsecureSkipVerify = skipVerify
+	proxy, err := registryProxy(sys, hostName, endpointProxy)
+	if err != nil {
+		return nil, err
+	}
 
 	userAgent := useragent.DefaultUserAgent
 	if sys != nil && sys.DockerRegistryUserAgent != "" {
 		userAgent = sys.DockerRegistryUserAgent
 	}
 
+	tokenCache := NewBearerTokenCache()
+	if sys != nil && sys.DockerBearerTokenCache != nil {
+		tokenCache = sys.DockerBearerTokenCache
+	}
+
 	return &dockerClient{
 		sys:              sys,
 		registry:         registry,
 		userAgent:        userAgent,
 		tlsClientConfig:  tlsClientConfig,
+		proxy:            proxy,
+		log:              logging.For(sys),
+		tokenCache:       tokenCache,
 		reportedWarnings: set.New[string](),
 	}, nil
 }
@@ -325,7 +367,7 @@ func CheckAuth(ctx context.Context, sys *types.SystemContext, username, password
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		err := registryHTTPResponseToError(resp)
+		err := registryHTTPResponseToError(client.log, resp)
 		if resp.StatusCode == http.StatusUnauthorized {
 			err = ErrUnauthorizedForCredentials{Err: err}
 		}
@@ -352,6 +394,7 @@ type SearchResult struct {
 // The limit is the max number of results desired
 // Note: The limit value doesn't work with all registries
 // for example registry.access.redhat.com returns all the results without limiting it to the limit value
+// See also Search, which supports pagination.
 func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, image string, limit int) ([]SearchResult, error) {
 	type V2Results struct {
 		// Repositories holds the results returned by the /v2/_catalog endpoint
@@ -406,14 +449,14 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 		q.Set("n", strconv.Itoa(limit))
 		u.RawQuery = q.Encode()
 
-		logrus.Debugf("trying to talk to v1 search endpoint")
+		logging.For(sys).Debugf("trying to talk to v1 search endpoint")
 		resp, err := client.makeRequest(ctx, http.MethodGet, u.String(), nil, nil, noAuth, nil)
 		if err != nil {
-			logrus.Debugf("error getting search results from v1 endpoint %q: %v", registry, err)
+			logging.For(sys).Debugf("error getting search results from v1 endpoint %q: %v", registry, err)
 		} else {
 			defer resp.Body.Close()
 			if resp.StatusCode != http.StatusOK {
-				logrus.Debugf("error getting search results from v1 endpoint %q: %v", registry, httpResponseToError(resp, ""))
+				logging.For(sys).Debugf("error getting search results from v1 endpoint %q: %v", registry, httpResponseToError(client.log, resp, ""))
 			} else {
 				if err := json.NewDecoder(resp.Body).Decode(v1Res); err != nil {
 					return nil, err
@@ -423,19 +466,19 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 		}
 	}
 
-	logrus.Debugf("trying to talk to v2 search endpoint")
+	logging.For(sys).Debugf("trying to talk to v2 search endpoint")
 	searchRes := []SearchResult{}
 	path := "/v2/_catalog"
 	for len(searchRes) < limit {
 		resp, err := client.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
 		if err != nil {
-			logrus.Debugf("error getting search results from v2 endpoint %q: %v", registry, err)
+			logging.For(sys).Debugf("error getting search results from v2 endpoint %q: %v", registry, err)
 			return nil, fmt.Errorf("couldn't search registry %q: %w", registry, err)
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
-			err := registryHTTPResponseToError(resp)
-			logrus.Errorf("error getting search results from v2 endpoint %q: %v", registry, err)
+			err := registryHTTPResponseToError(client.log, resp)
+			logging.For(sys).Errorf("error getting search results from v2 endpoint %q: %v", registry, err)
 			return nil, fmt.Errorf("couldn't search registry %q: %w", registry, err)
 		}
 		v2Res := &V2Results{}
@@ -511,7 +554,7 @@ func (c *dockerClient) resolveRequestURL(path string) (*url.URL, error) {
 // Checks if the auth headers in the response contain an indication of a failed
 // authorizdation because of an "insufficient_scope" error. If that's the case,
 // returns the required scope to be used for fetching a new token.
-func needsRetryWithUpdatedScope(res *http.Response) (bool, *authScope) {
+func needsRetryWithUpdatedScope(log logging.Logger, res *http.Response) (bool, *authScope) {
 	if res.StatusCode == http.StatusUnauthorized {
 		challenges := parseAuthHeader(res.Header)
 		for _, challenge := range challenges {
@@ -521,11 +564,7 @@ func needsRetryWithUpdatedScope(res *http.Response) (bool, *authScope) {
 						if newScope, err := parseAuthScope(scope); err == nil {
 							return true, newScope
 						} else {
-							logrus.WithFields(logrus.Fields{
-								"error":     err,
-								"scope":     scope,
-								"challenge": challenge,
-							}).Error("Failed to parse the authentication scope from the given challenge")
+							log.Errorf("Failed to parse the authentication scope %q from the given challenge %v: %v", scope, challenge, err)
 						}
 					}
 				}
@@ -537,12 +576,12 @@ func needsRetryWithUpdatedScope(res *http.Response) (bool, *authScope) {
 
 // parseRetryAfter determines the delay required by the "Retry-After" header in res and returns it,
 // silently falling back to fallbackDelay if the header is missing or invalid.
-func parseRetryAfter(res *http.Response, fallbackDelay time.Duration) time.Duration {
+func parseRetryAfter(log logging.Logger, res *http.Response, fallbackDelay time.Duration) time.Duration {
 	after := res.Header.Get("Retry-After")
 	if after == "" {
 		return fallbackDelay
 	}
-	logrus.Debugf("Detected 'Retry-After' header %q", after)
+	log.Debugf("Detected 'Retry-After' header %q", after)
 	// First, check if we have a numerical value.
 	if num, err := strconv.ParseInt(after, 10, 64); err == nil {
 		return time.Duration(num) * time.Second
@@ -554,20 +593,61 @@ func parseRetryAfter(res *http.Response, fallbackDelay time.Duration) time.Durat
 		if delta > 0 {
 			return delta
 		}
-		logrus.Debugf("Retry-After date in the past, ignoring it")
+		log.Debugf("Retry-After date in the past, ignoring it")
 		return fallbackDelay
 	}
-	logrus.Debugf("Invalid Retry-After format, ignoring it")
+	log.Debugf("Invalid Retry-After format, ignoring it")
 	return fallbackDelay
 }
 
+// retryPolicy returns the maximum number of attempts, and the maximum delay between attempts, for a single request.
+func (c *dockerClient) retryPolicy() (int, time.Duration) {
+	attempts, maxDelay := backoffNumIterations, backoffMaxDelay
+	if c.sys != nil {
+		switch {
+		case c.sys.DockerRegistryMaxRetries > 0:
+			attempts = c.sys.DockerRegistryMaxRetries + 1
+		case c.sys.DockerRegistryMaxRetries < 0:
+			attempts = 1
+		}
+		if c.sys.DockerRegistryMaxRetryDelay > 0 {
+			maxDelay = c.sys.DockerRegistryMaxRetryDelay
+		}
+	}
+	return attempts, maxDelay
+}
+
+// isRetryableResponse returns true if a request using method, which received res, may be retried after a delay.
+func isRetryableResponse(method string, res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		// The server might have partially processed the request; only retry requests which are safe to repeat.
+		return method == http.MethodGet || method == http.MethodHead
+	default:
+		return false
+	}
+}
+
+// backoffJitter returns a random delay in [delay/2, delay], so that clients rejected at the same time
+// don’t all retry at the same time.
+func backoffJitter(delay time.Duration) time.Duration {
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
 // makeRequestToResolvedURL creates and executes a http.Request with the specified parameters, adding authentication and TLS options for the Docker client.
 // streamLen, if not -1, specifies the length of the data expected on stream.
 // makeRequest should generally be preferred.
-// In case of an HTTP 429 status code in the response, it may automatically retry a few times.
+// In case of an HTTP 429 status code, or a transient server error for GET and HEAD requests, it may automatically retry a few times,
+// honoring the "Retry-After" header if present, and backing off exponentially otherwise.
 // TODO(runcom): too many arguments here, use a struct
 func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method string, requestURL *url.URL, headers map[string][]string, stream io.Reader, streamLen int64, auth sendAuth, extraScope *authScope) (*http.Response, error) {
-	delay := backoffInitialDelay
+	maxAttempts, maxDelay := c.retryPolicy()
+	delay := min(backoffInitialDelay, maxDelay)
 	attempts := 0
 	for {
 		res, err := c.makeRequestToResolvedURLOnce(ctx, method, requestURL, headers, stream, streamLen, auth, extraScope)
@@ -589,8 +669,8 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 		// We also cannot retry with a body (stream != nil) as stream
 		// was already read
 		if attempts == 1 && stream == nil && auth != noAuth {
-			if retry, newScope := needsRetryWithUpdatedScope(res); retry {
-				logrus.Debug("Detected insufficient_scope error, will retry request with updated scope")
+			if retry, newScope := needsRetryWithUpdatedScope(c.log, res); retry {
+				c.log.Debug("Detected insufficient_scope error, will retry request with updated scope")
 				res.Body.Close()
 				// Note: This retry ignores extraScope. That’s, strictly speaking, incorrect, but we don’t currently
 				// expect the insufficient_scope errors to happen for those callers. If that changes, we can add support
@@ -603,30 +683,31 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 			}
 		}
 
-		if res.StatusCode != http.StatusTooManyRequests || // Only retry on StatusTooManyRequests, success or other failure is returned to caller immediately
+		if !isRetryableResponse(method, res) || // Success or other failure is returned to caller immediately
 			stream != nil || // We can't retry with a body (which is not restartable in the general case)
-			attempts == backoffNumIterations {
+			attempts >= maxAttempts {
 			return res, nil
 		}
 		// close response body before retry or context done
 		res.Body.Close()
+		c.addToCounter(types.MetricRequestRetries, "", 1)
 
-		delay = min(parseRetryAfter(res, delay), backoffMaxDelay)
-		logrus.Debugf("Too many requests to %s: sleeping for %f seconds before next attempt", requestURL.Redacted(), delay.Seconds())
+		sleep := min(parseRetryAfter(c.log, res, backoffJitter(delay)), maxDelay)
+		c.log.Debugf("Received %q from %s: sleeping for %f seconds before next attempt", res.Status, requestURL.Redacted(), sleep.Seconds())
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-time.After(delay):
+		case <-time.After(sleep):
 			// Nothing
 		}
-		delay *= 2 // If the registry does not specify a delay, back off exponentially.
+		delay = min(delay*2, maxDelay) // If the registry does not specify a delay, back off exponentially.
 	}
 }
 
 // makeRequestToResolvedURLOnce creates and executes a http.Request with the specified parameters, adding authentication and TLS options for the Docker client.
 // streamLen, if not -1, specifies the length of the data expected on stream.
 // makeRequest should generally be preferred.
-// Note that no exponential back off is performed when receiving an http 429 status code.
+// Note that no exponential back off is performed when receiving an http 429 or 5xx status code.
 func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method string, resolvedURL *url.URL, headers map[string][]string, stream io.Reader, streamLen int64, auth sendAuth, extraScope *authScope) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, method, resolvedURL.String(), stream)
 	if err != nil {
@@ -644,17 +725,22 @@ func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method
 	req.Header.Add("User-Agent", c.userAgent)
 	if auth == v2Auth {
 		if err := c.setupRequestAuth(req, extraScope); err != nil {
+			c.addToCounter(types.MetricAuthFailures, "", 1)
 			return nil, err
 		}
 	}
-	logrus.Debugf("%s %s", method, resolvedURL.Redacted())
+	c.log.Debugf("%s %s", method, resolvedURL.Redacted())
 	res, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if auth == v2Auth && res.StatusCode == http.StatusUnauthorized {
+		c.addToCounter(types.MetricAuthFailures, "", 1)
+	}
 	if warnings := res.Header.Values("Warning"); len(warnings) != 0 {
 		c.logResponseWarnings(res, warnings)
 	}
+	c.reportRateLimit(res)
 	return res, nil
 }
 
@@ -666,16 +752,16 @@ func (c *dockerClient) logResponseWarnings(res *http.Response, warningHeaders []
 	for _, header := range warningHeaders {
 		warningString := parseRegistryWarningHeader(header)
 		if warningString == "" {
-			logrus.Debugf("Ignored Warning: header from registry: %q", header)
+			c.log.Debugf("Ignored Warning: header from registry: %q", header)
 		} else {
 			if !c.reportedWarnings.Contains(warningString) {
 				c.reportedWarnings.Add(warningString)
 				// Note that reportedWarnings is based only on warningString, so that we don’t
 				// repeat the same warning for every request - but the warning includes the URL;
 				// so it may not be specific to that URL.
-				logrus.Warnf("Warning from registry (first encountered at %q): %q", res.Request.URL.Redacted(), warningString)
+				c.log.Warnf("Warning from registry (first encountered at %q): %q", res.Request.URL.Redacted(), warningString)
 			} else {
-				logrus.Debugf("Repeated warning from registry at %q: %q", res.Request.URL.Redacted(), warningString)
+				c.log.Debugf("Repeated warning from registry at %q: %q", res.Request.URL.Redacted(), warningString)
 			}
 		}
 	}
@@ -747,29 +833,16 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 		case "bearer":
 			registryToken := c.registryToken
 			if registryToken == "" {
-				cacheKey := ""
 				scopes := []authScope{c.scope}
 				if extraScope != nil {
-					// Using ':' as a separator here is unambiguous because getBearerToken below
-					// uses the same separator when formatting a remote request (and because
-					// repository names that we create can't contain colons, and extraScope values
-					// coming from a server come from `parseAuthScope`, which also splits on colons).
-					cacheKey = fmt.Sprintf("%s:%s:%s", extraScope.resourceType, extraScope.remoteName, extraScope.actions)
-					if colonCount := strings.Count(cacheKey, ":"); colonCount != 2 {
-						return fmt.Errorf(
-							"Internal error: there must be exactly 2 colons in the cacheKey ('%s') but got %d",
-							cacheKey,
-							colonCount,
-						)
-					}
 					scopes = append(scopes, *extraScope)
 				}
-				var token bearerToken
-				t, inCache := c.tokenCache.Load(cacheKey)
-				if inCache {
-					token = t.(bearerToken)
+				cacheKey, err := c.bearerTokenCacheKey(challenge, scopes)
+				if err != nil {
+					return err
 				}
-				if !inCache || time.Now().After(token.expirationTime) {
+				token, inCache := c.tokenCache.Get(cacheKey)
+				if !inCache {
 					var (
 						t   *bearerToken
 						err error
@@ -783,18 +856,18 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 						return err
 					}
 
-					token = *t
-					c.tokenCache.Store(cacheKey, token)
+					token = t.Token
+					c.tokenCache.Put(cacheKey, token, t.expirationTime)
 				}
-				registryToken = token.Token
+				registryToken = token
 			}
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", registryToken))
 			return nil
 		default:
-			logrus.Debugf("no handler for %s authentication", challenge.Scheme)
+			c.log.Debugf("no handler for %s authentication", challenge.Scheme)
 		}
 	}
-	logrus.Infof("None of the challenges sent by server (%s) are supported, trying an unauthenticated request anyway", strings.Join(schemeNames, ", "))
+	c.log.Infof("None of the challenges sent by server (%s) are supported, trying an unauthenticated request anyway", strings.Join(schemeNames, ", "))
 	return nil
 }
 
@@ -822,24 +895,53 @@ func (c *dockerClient) getBearerTokenOAuth2(ctx context.Context, challenge chall
 			params.Add("scope", fmt.Sprintf("%s:%s:%s", scope.resourceType, scope.remoteName, scope.actions))
 		}
 	}
+	identityToken := c.currentIdentityToken()
 	params.Add("grant_type", "refresh_token")
-	params.Add("refresh_token", c.auth.IdentityToken)
+	params.Add("refresh_token", identityToken)
 	params.Add("client_id", "containers/image")
 
 	authReq.Body = io.NopCloser(strings.NewReader(params.Encode()))
 	authReq.Header.Add("User-Agent", c.userAgent)
 	authReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	logrus.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
+	c.log.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
 	res, err := c.client.Do(authReq)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	if err := httpResponseToError(res, "Trying to obtain access token"); err != nil {
+	if err := httpResponseToError(c.log, res, "Trying to obtain access token"); err != nil {
 		return nil, err
 	}
 
-	return newBearerTokenFromHTTPResponseBody(res)
+	token, err := newBearerTokenFromHTTPResponseBody(c.log, res)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" && token.RefreshToken != identityToken {
+		c.updateIdentityToken(token.RefreshToken)
+	}
+	return token, nil
+}
+
+// currentIdentityToken returns the identity token to use for obtaining access tokens.
+func (c *dockerClient) currentIdentityToken() string {
+	c.identityTokenLock.Lock()
+	defer c.identityTokenLock.Unlock()
+	if c.refreshedIdentityToken != "" {
+		return c.refreshedIdentityToken
+	}
+	return c.auth.IdentityToken
+}
+
+// updateIdentityToken records a new identity token issued by the registry, and reports it to the user, if requested.
+func (c *dockerClient) updateIdentityToken(identityToken string) {
+	c.log.Debugf("Registry %s issued a new identity token", c.registry)
+	c.identityTokenLock.Lock()
+	c.refreshedIdentityToken = identityToken
+	c.identityTokenLock.Unlock()
+	if c.sys != nil && c.sys.DockerIdentityTokenRefreshedCallback != nil {
+		c.sys.DockerIdentityTokenRefreshedCallback(c.registry, identityToken)
+	}
 }
 
 func (c *dockerClient) getBearerToken(ctx context.Context, challenge challenge,
@@ -876,17 +978,72 @@ func (c *dockerClient) getBearerToken(ctx context.Context, challenge challenge,
 	}
 	authReq.Header.Add("User-Agent", c.userAgent)
 
-	logrus.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
+	c.log.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
 	res, err := c.client.Do(authReq)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	if err := httpResponseToError(res, "Requesting bearer token"); err != nil {
+	if err := httpResponseToError(c.log, res, "Requesting bearer token"); err != nil {
 		return nil, err
 	}
 
-	return newBearerTokenFromHTTPResponseBody(res)
+	return newBearerTokenFromHTTPResponseBody(c.log, res)
+}
+
+// applyRegistryTransportOptions modifies tr according to the registry connection options in sys, if any.
+func applyRegistryTransportOptions(tr *http.Transport, sys *types.SystemContext) {
+	if sys == nil {
+		return
+	}
+	if sys.DockerRegistryMaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = sys.DockerRegistryMaxIdleConnsPerHost
+		tr.MaxIdleConns = max(tr.MaxIdleConns, tr.MaxIdleConnsPerHost)
+	}
+	if sys.DockerRegistryMaxConnsPerHost > 0 {
+		tr.MaxConnsPerHost = sys.DockerRegistryMaxConnsPerHost
+	}
+	if sys.DockerRegistryIdleConnTimeout > 0 {
+		tr.IdleConnTimeout = sys.DockerRegistryIdleConnTimeout
+	}
+	if sys.DockerRegistryTLSHandshakeTimeout > 0 {
+		tr.TLSHandshakeTimeout = sys.DockerRegistryTLSHandshakeTimeout
+	}
+	if sys.DockerRegistryEnableHTTP2 {
+		tr.ForceAttemptHTTP2 = true
+	}
+}
+
+// registryProxy returns the value of http.Transport.Proxy for connections to the registry at hostName,
+// based on sys and endpointProxy, the proxy configured in registries.conf, if any;
+// or nil if the proxy environment variables should be used.
+func registryProxy(sys *types.SystemContext, hostName, endpointProxy string) (func(*http.Request) (*url.URL, error), error) {
+	proxy := endpointProxy
+	if sys != nil {
+		if p, ok := sys.DockerRegistryProxies[hostName]; ok {
+			if p == "" {
+				return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+			}
+			proxy = p
+		}
+	}
+	if proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		// Don’t include err, it contains the URL, which may contain a password.
+		return nil, fmt.Errorf("invalid proxy for registry %s", hostName)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q of proxy for registry %s", u.Scheme, hostName)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %s for registry %s has no host", u.Redacted(), hostName)
+	}
+	return http.ProxyURL(u), nil
 }
 
 // detectPropertiesHelper performs the work of detectProperties which executes
@@ -899,7 +1056,16 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 	}
 	tr := tlsclientconfig.NewTransport()
 	tr.TLSClientConfig = c.tlsClientConfig
-	c.client = &http.Client{Transport: tr}
+	timeouts.ApplyToTransport(tr, c.sys)
+	applyRegistryTransportOptions(tr, c.sys)
+	if c.proxy != nil {
+		tr.Proxy = c.proxy
+	}
+	c.client = &http.Client{Transport: c.wrapRegistryTransport(tracing.NewRoundTripper(timeouts.NewRoundTripper(tr, c.sys)))}
+
+	if c.tryKnownRegistryProperties(ctx) {
+		return nil
+	}
 
 	ping := func(scheme string) error {
 		pingURL, err := url.Parse(fmt.Sprintf(resolvedPingV2URL, scheme, c.registry))
@@ -908,17 +1074,18 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 		}
 		resp, err := c.makeRequestToResolvedURL(ctx, http.MethodGet, pingURL, nil, nil, -1, noAuth, nil)
 		if err != nil {
-			logrus.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
+			c.log.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
 			return err
 		}
 		defer resp.Body.Close()
-		logrus.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
+		c.log.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
 		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
-			return registryHTTPResponseToError(resp)
+			return registryHTTPResponseToError(c.log, resp)
 		}
 		c.challenges = parseAuthHeader(resp.Header)
 		c.scheme = scheme
 		c.supportsSignatures = resp.Header.Get("X-Registry-Supports-Signatures") == "1"
+		c.recordKnownRegistryProperties()
 		return nil
 	}
 	err := ping("https")
@@ -938,11 +1105,11 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 			}
 			resp, err := c.makeRequestToResolvedURL(ctx, http.MethodGet, pingURL, nil, nil, -1, noAuth, nil)
 			if err != nil {
-				logrus.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
+				c.log.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
 				return false
 			}
 			defer resp.Body.Close()
-			logrus.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
+			c.log.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
 			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
 				return false
 			}
@@ -973,21 +1140,50 @@ func (c *dockerClient) fetchManifest(ctx context.Context, ref dockerReference, t
 	headers := map[string][]string{
 		"Accept": manifest.DefaultRequestedManifestMIMETypes,
 	}
+	var manifestCache types.DockerManifestCache
+	if c.sys != nil {
+		manifestCache = c.sys.DockerManifestCache
+	}
+	cacheKey := ""
+	var cachedManifest []byte
+	cachedMIMEType, cachedETag := "", ""
+	if manifestCache != nil {
+		cacheKey = c.manifestCacheKey(ref, tagOrDigest)
+		var ok bool
+		cachedManifest, cachedMIMEType, cachedETag, ok = manifestCache.Get(cacheKey)
+		if ok && cachedETag != "" {
+			headers["If-None-Match"] = []string{cachedETag}
+		}
+	}
 	res, err := c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
 	if err != nil {
 		return nil, "", err
 	}
-	logrus.Debugf("Content-Type from manifest GET is %q", res.Header.Get("Content-Type"))
+	c.log.Debugf("Content-Type from manifest GET is %q", res.Header.Get("Content-Type"))
 	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified && cachedETag != "" {
+		c.log.Debugf("Manifest %s in %s not modified, using the cached copy", tagOrDigest, ref.ref.Name())
+		return cachedManifest, cachedMIMEType, nil
+	}
 	if res.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("reading manifest %s in %s: %w", tagOrDigest, ref.ref.Name(), registryHTTPResponseToError(res))
+		err := registryHTTPResponseToError(c.log, res)
+		if isManifestUnknownError(err) && !errors.Is(err, types.ErrManifestUnknown) {
+			err = errcategory.Wrap(err, types.ErrManifestUnknown)
+		}
+		return nil, "", fmt.Errorf("reading manifest %s in %s: %w", tagOrDigest, ref.ref.Name(), err)
 	}
 
-	manblob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	manblob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySizeFor(c.sys))
 	if err != nil {
 		return nil, "", err
 	}
-	return manblob, simplifyContentType(res.Header.Get("Content-Type")), nil
+	mimeType := simplifyContentType(res.Header.Get("Content-Type"))
+	if manifestCache != nil {
+		if etag := res.Header.Get("ETag"); etag != "" {
+			manifestCache.Put(cacheKey, manblob, mimeType, etag)
+		}
+	}
+	return manblob, mimeType, nil
 }
 
 // getExternalBlob returns the reader of the first available blob URL from urls, which must not be empty.
@@ -1014,7 +1210,7 @@ func (c *dockerClient) getExternalBlob(ctx context.Context, urls []string) (io.R
 		if resp.StatusCode != http.StatusOK {
 			err := fmt.Errorf("error fetching external blob from %q: %d (%s)", u, resp.StatusCode, http.StatusText(resp.StatusCode))
 			remoteErrors = append(remoteErrors, err)
-			logrus.Debug(err)
+			c.log.Debug(err)
 			resp.Body.Close()
 			continue
 		}
@@ -1051,13 +1247,16 @@ func (c *dockerClient) getBlob(ctx context.Context, ref dockerReference, info ty
 		return nil, 0, err
 	}
 	path := fmt.Sprintf(blobsPath, reference.Path(ref.ref), info.Digest.String())
-	logrus.Debugf("Downloading %s", path)
+	c.log.Debugf("Downloading %s", path)
 	res, err := c.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
 	if err != nil {
 		return nil, 0, err
 	}
 	if res.StatusCode != http.StatusOK {
-		err := registryHTTPResponseToError(res)
+		err := registryHTTPResponseToError(c.log, res)
+		if res.StatusCode == http.StatusNotFound && !errors.Is(err, types.ErrBlobUnknown) {
+			err = errcategory.Wrap(err, types.ErrBlobUnknown)
+		}
 		res.Body.Close()
 		return nil, 0, fmt.Errorf("fetching blob: %w", err)
 	}
@@ -1126,17 +1325,17 @@ func (c *dockerClient) getSigstoreAttachmentManifest(ctx context.Context, ref do
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debugf("Looking for sigstore attachments in %s", sigstoreRef.String())
+	c.log.Debugf("Looking for sigstore attachments in %s", sigstoreRef.String())
 	manifestBlob, mimeType, err := c.fetchManifest(ctx, ref, tag)
 	if err != nil {
 		// FIXME: Are we going to need better heuristics??
 		// This alone is probably a good enough reason for sigstore to be opt-in only,
 		// otherwise we would just break ordinary copies.
 		if isManifestUnknownError(err) {
-			logrus.Debugf("Fetching sigstore attachment manifest failed, assuming it does not exist: %v", err)
+			c.log.Debugf("Fetching sigstore attachment manifest failed, assuming it does not exist: %v", err)
 			return nil, nil
 		}
-		logrus.Debugf("Fetching sigstore attachment manifest failed: %v", err)
+		c.log.Debugf("Fetching sigstore attachment manifest failed: %v", err)
 		return nil, err
 	}
 	if mimeType != imgspecv1.MediaTypeImageManifest {
@@ -1151,6 +1350,42 @@ func (c *dockerClient) getSigstoreAttachmentManifest(ctx context.Context, ref do
 	return res, nil
 }
 
+// getSigstoreReferrerManifests loads and parses the manifests for sigstore signatures referring to digest in ref,
+// per sigstoreAttachmentsFormatReferrers.
+func (c *dockerClient) getSigstoreReferrerManifests(ctx context.Context, ref dockerReference, digest digest.Digest) ([]*manifest.OCI1, error) {
+	c.log.Debugf("Looking for sigstore signature referrers of %s in %s", digest.String(), ref.ref.Name())
+	referrers, err := c.getReferrers(ctx, ref, digest, signature.SigstoreSignatureArtifactType)
+	if err != nil {
+		return nil, err
+	}
+	res := []*manifest.OCI1{}
+	for _, referrer := range referrers {
+		if err := referrer.Digest.Validate(); err != nil { // Make sure referrer.Digest.String() does not contain any unexpected characters
+			return nil, err
+		}
+		manifestBlob, mimeType, err := c.fetchManifest(ctx, ref, referrer.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+		if mimeType != imgspecv1.MediaTypeImageManifest {
+			return nil, fmt.Errorf("unexpected MIME type for sigstore signature manifest %s: %q", referrer.Digest.String(), mimeType)
+		}
+		matches, err := manifest.MatchesDigest(manifestBlob, referrer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			return nil, fmt.Errorf("sigstore signature manifest does not match digest %s", referrer.Digest.String())
+		}
+		m, err := manifest.OCI1FromManifest(manifestBlob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing manifest %s: %w", referrer.Digest.String(), err)
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
 // getExtensionsSignatures returns signatures from the X-Registry-Supports-Signatures API extension,
 // using the original data structures.
 func (c *dockerClient) getExtensionsSignatures(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) (*extensionSignatureList, error) {
@@ -1164,10 +1399,10 @@ func (c *dockerClient) getExtensionsSignatures(ctx context.Context, ref dockerRe
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("downloading signatures for %s in %s: %w", manifestDigest, ref.ref.Name(), registryHTTPResponseToError(res))
+		return nil, fmt.Errorf("downloading signatures for %s in %s: %w", manifestDigest, ref.ref.Name(), registryHTTPResponseToError(c.log, res))
 	}
 
-	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxSignatureListBodySize)
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxSignatureListBodySizeFor(c.sys))
 	if err != nil {
 		return nil, err
 	}
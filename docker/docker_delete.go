@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// tagPlaceholderArtifactType is the artifact type of the manifest a tag is pointed at, before deleting it,
+	// if the registry does not support deleting tags.
+	tagPlaceholderArtifactType = "application/vnd.containers.image.deleted-tag"
+	// tagPlaceholderTagAnnotation is an annotation of the placeholder manifest, containing the deleted tag
+	// (so that concurrent deletions of different tags don’t use the same manifest).
+	tagPlaceholderTagAnnotation = "io.containers.image.deleted-tag"
+)
+
+// deleteImage deletes the named image from the registry, if supported.
+//
+// If ref contains a tag and sys.DockerRegistryDeleteTagOnly is set, only the tag is deleted.
+// Otherwise the manifest ref refers to is deleted (which, on most registries, also deletes all tags referring to it),
+// along with its lookaside signatures.
+func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerReference) error {
+	if ref.isUnknownDigest {
+		return fmt.Errorf("Docker reference without a tag or digest cannot be deleted")
+	}
+
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return err
+	}
+	// docker/distribution does not document what action should be used for deleting images.
+	//
+	// Current docker/distribution requires "pull" for reading the manifest and "delete" for deleting it.
+	// quay.io requires "push" (an explicit "pull" is unnecessary), does not grant any token (fails parsing the request) if "delete" is included.
+	// OpenShift ignores the action string (both the password and the token is an OpenShift API token identifying a user).
+	//
+	// We have to hard-code a single string, luckily both docker/distribution and quay.io support "*" to mean "everything".
+	c, err := newDockerClientFromRef(sys, ref, registryConfig, true, "*")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	tagged, isTagged := ref.ref.(reference.NamedTagged)
+	if isTagged && sys != nil && sys.DockerRegistryDeleteTagOnly {
+		return deleteTag(ctx, sys, c, ref, tagged.Tag())
+	}
+
+	var manifestDigest digest.Digest
+	if canonical, ok := ref.ref.(reference.Canonical); ok {
+		manifestDigest = canonical.Digest()
+	} else {
+		manifestDigest, err = resolveManifestDigest(ctx, c, ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := deleteManifest(ctx, c, ref, manifestDigest.String())
+	if err != nil {
+		return err
+	}
+	if res != nil && isTagged && registryDeleteUnsupported(res) {
+		// Some registries only support deleting manifests using the tag.
+		logging.For(sys).Debugf("Registry does not support deleting %s by digest (%v), trying to delete it by tag", ref.ref, res)
+		res, err = deleteManifest(ctx, c, ref, tagged.Tag())
+		if err != nil {
+			return err
+		}
+	}
+	if res != nil {
+		return fmt.Errorf("deleting %v: %w", ref.ref, res)
+	}
+
+	for i := 0; ; i++ {
+		sigURL, err := lookasideStorageURL(c.signatureBase, manifestDigest, i)
+		if err != nil {
+			return err
+		}
+		missing, err := c.deleteOneSignature(sigURL)
+		if err != nil {
+			return err
+		}
+		if missing {
+			break
+		}
+	}
+
+	return nil
+}
+
+// resolveManifestDigest returns the digest of the manifest the tag in ref refers to.
+func resolveManifestDigest(ctx context.Context, c *dockerClient, ref dockerReference) (digest.Digest, error) {
+	headers := map[string][]string{
+		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+	}
+	refTail, err := ref.tagOrDigest()
+	if err != nil {
+		return "", err
+	}
+	getPath := fmt.Sprintf(manifestPath, reference.Path(ref.ref), refTail)
+	get, err := c.makeRequest(ctx, http.MethodGet, getPath, headers, nil, v2Auth, nil)
+	if err != nil {
+		return "", err
+	}
+	defer get.Body.Close()
+	switch get.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("Unable to delete %v. Image may not exist or is not stored with a v2 Schema in a v2 registry%.0w", ref.ref, types.ErrManifestUnknown)
+	default:
+		return "", fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(c.log, get))
+	}
+	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.MaxManifestBodySizeFor(c.sys))
+	if err != nil {
+		return "", err
+	}
+
+	manifestDigest, err := manifest.Digest(manifestBody)
+	if err != nil {
+		return "", fmt.Errorf("computing manifest digest: %w", err)
+	}
+	return manifestDigest, nil
+}
+
+// deleteManifest sends a request to delete the manifest tagOrDigest in the repository of ref.
+// It returns a nil *registryDeleteError if the manifest was deleted, a non-nil one if the registry refused the request,
+// or an error if the request could not be made.
+func deleteManifest(ctx context.Context, c *dockerClient, ref dockerReference, tagOrDigest string) (*registryDeleteError, error) {
+	headers := map[string][]string{
+		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+	}
+	deletePath := fmt.Sprintf(manifestPath, reference.Path(ref.ref), tagOrDigest)
+	res, err := c.makeRequest(ctx, http.MethodDelete, deletePath, headers, nil, v2Auth, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusAccepted {
+		return nil, nil
+	}
+	return &registryDeleteError{statusCode: res.StatusCode, err: registryHTTPResponseToError(c.log, res)}, nil
+}
+
+// registryDeleteError is a rejected manifest deletion request.
+type registryDeleteError struct {
+	statusCode int
+	err        error
+}
+
+func (e *registryDeleteError) Error() string {
+	return e.err.Error()
+}
+
+func (e *registryDeleteError) Unwrap() error {
+	return e.err
+}
+
+// registryDeleteUnsupported returns true if res indicates that the registry does not support the kind of deletion request
+// (by tag or by digest) it rejected, as opposed to e.g. the manifest not existing or the user not being allowed to delete it.
+func registryDeleteUnsupported(res *registryDeleteError) bool {
+	if res.statusCode == http.StatusMethodNotAllowed {
+		return true
+	}
+	var ec errcode.ErrorCoder
+	if errors.As(res.err, &ec) {
+		switch ec.ErrorCode() {
+		case errcode.ErrorCodeUnsupported,
+			v2.ErrorCodeDigestInvalid: // Returned by registries which parse every deletion request as a digest
+			return true
+		}
+	}
+	return false
+}
+
+// deleteTag deletes tag in the repository of ref, without deleting the manifest it refers to.
+// If the registry does not support deleting tags, the tag is pointed at a placeholder manifest, which is then deleted.
+func deleteTag(ctx context.Context, sys *types.SystemContext, c *dockerClient, ref dockerReference, tag string) error {
+	res, err := deleteManifest(ctx, c, ref, tag)
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		return nil
+	}
+	if !registryDeleteUnsupported(res) {
+		return fmt.Errorf("deleting tag %v: %w", ref.ref, res)
+	}
+	logging.For(sys).Debugf("Registry does not support deleting tag %s (%v), replacing it with a placeholder manifest", ref.ref, res)
+
+	placeholder, err := manifest.OCI1ArtifactFromComponents(tagPlaceholderArtifactType, nil, nil,
+		map[string]string{tagPlaceholderTagAnnotation: tag}).Serialize()
+	if err != nil {
+		return err
+	}
+	placeholderDigest, err := manifest.Digest(placeholder)
+	if err != nil {
+		return err
+	}
+	dest, err := newImageDestination(sys, ref)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	emptyJSON := imgspecv1.DescriptorEmptyJSON
+	if _, err := dest.PutBlob(ctx, bytes.NewReader(emptyJSON.Data), types.BlobInfo{Digest: emptyJSON.Digest, Size: emptyJSON.Size}, none.NoCache, true); err != nil {
+		return fmt.Errorf("deleting tag %v: uploading placeholder config: %w", ref.ref, err)
+	}
+	if err := dest.PutManifest(ctx, placeholder, nil); err != nil {
+		return fmt.Errorf("deleting tag %v: replacing it with a placeholder manifest: %w", ref.ref, err)
+	}
+	res, err = deleteManifest(ctx, c, ref, placeholderDigest.String())
+	if err != nil {
+		return err
+	}
+	if res != nil && !errors.Is(res, types.ErrNotFound) { // A concurrent deletion of the same tag may have deleted the placeholder already.
+		return fmt.Errorf("deleting tag %v: it now refers to placeholder manifest %s, which could not be deleted: %w", ref.ref, placeholderDigest, res)
+	}
+	return nil
+}
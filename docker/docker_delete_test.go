@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryDeleteUnsupported(t *testing.T) {
+	for _, c := range []struct {
+		response    string
+		unsupported bool
+	}{
+		{ // Deletion disabled in the registry
+			"HTTP/1.1 405 Method Not Allowed\r\n" +
+				"\r\n" +
+				`{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}` + "\r\n",
+			true,
+		},
+		{ // Deleting by tag on a registry which only supports digests
+			"HTTP/1.1 400 Bad Request\r\n" +
+				"\r\n" +
+				`{"errors":[{"code":"DIGEST_INVALID","message":"provided digest did not match uploaded content"}]}` + "\r\n",
+			true,
+		},
+		{
+			"HTTP/1.1 404 Not Found\r\n" +
+				"\r\n" +
+				`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}` + "\r\n",
+			false,
+		},
+		{
+			"HTTP/1.1 403 Forbidden\r\n" +
+				"\r\n" +
+				`{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}` + "\r\n",
+			false,
+		},
+		{
+			"HTTP/1.1 500 Internal Server Error\r\n" +
+				"\r\n",
+			false,
+		},
+	} {
+		res, err := http.ReadResponse(bufio.NewReader(bytes.NewBufferString(c.response)), nil)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		deleteErr := &registryDeleteError{statusCode: res.StatusCode, err: registryHTTPResponseToError(logging.Logger{}, res)}
+		assert.Equal(t, c.unsupported, registryDeleteUnsupported(deleteErr), c.response)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
@@ -14,7 +16,6 @@ import (
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
 )
 
 // Image is a Docker-specific implementation of types.ImageCloser with a few extra methods
@@ -55,75 +56,131 @@ func (i *Image) GetRepositoryTags(ctx context.Context) ([]string, error) {
 // GetRepositoryTags list all tags available in the repository. The tag
 // provided inside the ImageReference will be ignored.
 func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]string, error) {
+	tags := make([]string, 0)
+	err := ListRepositoryTags(ctx, sys, ref, nil, func(tag string) error {
+		tags = append(tags, tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// TagListOptions can be used to modify the behavior of ListRepositoryTags.
+type TagListOptions struct {
+	// If > 0, the number of tags to request per page; the registry may return fewer. If 0, the registry default is used.
+	PageSize int
+	// If not "", only list tags which sort after this one, as defined by the registry.
+	Last string
+	// If not nil, only tags matching this expression are passed to the callback.
+	Filter *regexp.Regexp
+}
+
+// ListRepositoryTags calls fn for each tag available in the repository, as they are received from the registry,
+// following pagination links. The tag provided inside the ImageReference will be ignored.
+// options may be nil. If fn returns an error, listing stops and that error is returned.
+func ListRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, options *TagListOptions, fn func(tag string) error) error {
 	dr, ok := ref.(dockerReference)
 	if !ok {
-		return nil, errors.New("ref must be a dockerReference")
+		return errors.New("ref must be a dockerReference")
+	}
+	if options == nil {
+		options = &TagListOptions{}
 	}
 
 	registryConfig, err := loadRegistryConfiguration(sys)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	path := fmt.Sprintf(tagsPath, reference.Path(dr.ref))
+	query := url.Values{}
+	if options.PageSize > 0 {
+		query.Set("n", strconv.Itoa(options.PageSize))
+	}
+	if options.Last != "" {
+		query.Set("last", options.Last)
+	}
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
 	client, err := newDockerClientFromRef(sys, dr, registryConfig, false, "pull")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create client: %w", err)
+		return fmt.Errorf("failed to create client: %w", err)
 	}
 	defer client.Close()
 
-	tags := make([]string, 0)
-
-	for {
-		res, err := client.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
+	for path != "" {
+		path, err = listRepositoryTagsPage(ctx, client, dr, path, options.Filter, fn)
 		if err != nil {
-			return nil, err
-		}
-		defer res.Body.Close()
-		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("fetching tags list: %w", registryHTTPResponseToError(res))
+			return err
 		}
+	}
+	return nil
+}
+
+// listRepositoryTagsPage calls fn for each tag in a single page of the tag list of ref at path, which match filter if it is not nil.
+// It returns the path of the next page, or "" if there is none.
+func listRepositoryTagsPage(ctx context.Context, client *dockerClient, dr dockerReference, path string, filter *regexp.Regexp, fn func(tag string) error) (string, error) {
+	res, err := client.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching tags list: %w", registryHTTPResponseToError(client.log, res))
+	}
 
-		var tagsHolder struct {
-			Tags []string
+	var tagsHolder struct {
+		Tags []string
+	}
+	if err = json.NewDecoder(res.Body).Decode(&tagsHolder); err != nil {
+		return "", err
+	}
+	for _, tag := range tagsHolder.Tags {
+		if _, err := reference.WithTag(dr.ref, tag); err != nil { // Ensure the tag does not contain unexpected values
+			// Per https://github.com/containers/skopeo/issues/2346 , unknown versions of JFrog Artifactory,
+			// contrary to the tag format specified in
+			// https://github.com/opencontainers/distribution-spec/blob/8a871c8234977df058f1a14e299fe0a673853da2/spec.md?plain=1#L160 ,
+			// include digests in the list.
+			if _, err := digest.Parse(tag); err == nil {
+				client.log.Debugf("Ignoring invalid tag %q matching a digest format", tag)
+				continue
+			}
+			return "", fmt.Errorf("registry returned invalid tag %q: %w", tag, err)
 		}
-		if err = json.NewDecoder(res.Body).Decode(&tagsHolder); err != nil {
-			return nil, err
+		if filter != nil && !filter.MatchString(tag) {
+			continue
 		}
-		for _, tag := range tagsHolder.Tags {
-			if _, err := reference.WithTag(dr.ref, tag); err != nil { // Ensure the tag does not contain unexpected values
-				// Per https://github.com/containers/skopeo/issues/2346 , unknown versions of JFrog Artifactory,
-				// contrary to the tag format specified in
-				// https://github.com/opencontainers/distribution-spec/blob/8a871c8234977df058f1a14e299fe0a673853da2/spec.md?plain=1#L160 ,
-				// include digests in the list.
-				if _, err := digest.Parse(tag); err == nil {
-					logrus.Debugf("Ignoring invalid tag %q matching a digest format", tag)
-					continue
-				}
-				return nil, fmt.Errorf("registry returned invalid tag %q: %w", tag, err)
-			}
-			tags = append(tags, tag)
+		if err := fn(tag); err != nil {
+			return "", err
 		}
+	}
 
-		link := res.Header.Get("Link")
-		if link == "" {
-			break
-		}
+	link := res.Header.Get("Link")
+	if link == "" {
+		return "", nil
+	}
+	return nextPagePath(link)
+}
 
-		linkURLPart, _, _ := strings.Cut(link, ";")
-		linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
-		if err != nil {
-			return tags, err
-		}
+// nextPagePath returns a path for c.makeRequest to read the next page of a paginated response,
+// based on the value of its "Link" header.
+func nextPagePath(link string) (string, error) {
+	linkURLPart, _, _ := strings.Cut(link, ";")
+	linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
+	if err != nil {
+		return "", err
+	}
 
-		// can be relative or absolute, but we only want the path (and I
-		// guess we're in trouble if it forwards to a new place...)
-		path = linkURL.Path
-		if linkURL.RawQuery != "" {
-			path += "?"
-			path += linkURL.RawQuery
-		}
+	// can be relative or absolute, but we only want the path (and I
+	// guess we're in trouble if it forwards to a new place...)
+	path := linkURL.Path
+	if linkURL.RawQuery != "" {
+		path += "?"
+		path += linkURL.RawQuery
 	}
-	return tags, nil
+	return path, nil
 }
 
 // GetDigest returns the image's digest
@@ -168,7 +225,7 @@ func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageRef
 
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, dr.ref.Name(), registryHTTPResponseToError(res))
+		return "", fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, dr.ref.Name(), registryHTTPResponseToError(client.log, res))
 	}
 
 	dig, err := digest.Parse(res.Header.Get("Docker-Content-Digest"))
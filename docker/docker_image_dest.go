@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/blobinfocache"
@@ -26,6 +27,7 @@ import (
 	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/internal/streamdigest"
+	"github.com/containers/image/v5/internal/supporteddigests"
 	"github.com/containers/image/v5/internal/uploadreader"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
@@ -35,7 +37,6 @@ import (
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 )
 
 type dockerImageDestination struct {
@@ -43,14 +44,19 @@ type dockerImageDestination struct {
 	impl.PropertyMethodsInitialize
 	stubs.NoPutBlobPartialInitialize
 
-	ref dockerReference
-	c   *dockerClient
+	ref             dockerReference
+	c               *dockerClient
+	digestAlgorithm digest.Algorithm // For blobs and manifests pushed without a known digest
 	// State
 	manifestDigest digest.Digest // or "" if not yet known.
 }
 
 // newImageDestination creates a new ImageDestination for the specified image reference.
 func newImageDestination(sys *types.SystemContext, ref dockerReference) (private.ImageDestination, error) {
+	digestAlgorithm, err := supporteddigests.ForNewObjects(sys)
+	if err != nil {
+		return nil, err
+	}
 	registryConfig, err := loadRegistryConfiguration(sys)
 	if err != nil {
 		return nil, err
@@ -76,11 +82,13 @@ func newImageDestination(sys *types.SystemContext, ref dockerReference) (private
 			MustMatchRuntimeOS:             false,
 			IgnoresEmbeddedDockerReference: false, // We do want the manifest updated; older registry versions refuse manifests if the embedded reference does not match.
 			HasThreadSafePutBlob:           true,
+			AcceptsNonImageArtifacts:       true,
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
 
-		ref: ref,
-		c:   c,
+		ref:             ref,
+		c:               c,
+		digestAlgorithm: digestAlgorithm,
 	}
 	dest.Compat = impl.AddCompat(dest)
 	return dest, nil
@@ -97,6 +105,11 @@ func (d *dockerImageDestination) Close() error {
 	return d.c.Close()
 }
 
+// DigestAlgorithm returns the algorithm the destination uses for digests of blobs and manifests it creates.
+func (d *dockerImageDestination) DigestAlgorithm() digest.Algorithm {
+	return d.digestAlgorithm
+}
+
 // SupportsSignatures returns an error (to be displayed to the user) if the destination certainly can't store signatures.
 // Note: It is still possible for PutSignatures to fail if SupportsSignatures returns nil.
 func (d *dockerImageDestination) SupportsSignatures(ctx context.Context) error {
@@ -135,11 +148,12 @@ func (c *sizeCounter) Write(p []byte) (n int, err error) {
 // to any other readers for download using the supplied digest.
 // If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
 func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	start := time.Now()
 	// If requested, precompute the blob digest to prevent uploading layers that already exist on the registry.
 	// This functionality is particularly useful when BlobInfoCache has not been populated with compressed digests,
 	// the source blob is uncompressed, and the destination blob is being compressed "on the fly".
 	if inputInfo.Digest == "" && d.c.sys != nil && d.c.sys.DockerRegistryPushPrecomputeDigests {
-		logrus.Debugf("Precomputing digest layer for %s", reference.Path(d.ref.ref))
+		d.c.log.Debugf("Precomputing digest layer for %s", reference.Path(d.ref.ref))
 		streamCopy, cleanup, err := streamdigest.ComputeBlobInfo(d.c.sys, stream, &inputInfo)
 		if err != nil {
 			return private.UploadedBlob{}, err
@@ -156,53 +170,63 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 			return private.UploadedBlob{}, err
 		}
 		if haveBlob {
+			d.c.addToCounter(types.MetricBlobsReused, "", 1)
 			return private.UploadedBlob{Digest: reusedInfo.Digest, Size: reusedInfo.Size}, nil
 		}
 	}
 
 	// FIXME? Chunked upload, progress reporting, etc.
-	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
-	logrus.Debugf("Uploading %s", uploadPath)
-	res, err := d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
-	if err != nil {
-		return private.UploadedBlob{}, err
-	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusAccepted {
-		logrus.Debugf("Error initiating layer upload, response %#v", *res)
-		return private.UploadedBlob{}, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(res))
-	}
-	uploadLocation, err := res.Location()
-	if err != nil {
-		return private.UploadedBlob{}, fmt.Errorf("determining upload URL: %w", err)
+	uploadStatePath := d.uploadStatePath(inputInfo.Digest)
+	uploadLocation, uploadOffset := d.resumableUpload(ctx, uploadStatePath, inputInfo.Size)
+	var res *http.Response
+	if uploadLocation == nil {
+		uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
+		d.c.log.Debugf("Uploading %s", uploadPath)
+		var err error
+		res, err = d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			d.c.log.Debugf("Error initiating layer upload, response %#v", *res)
+			return private.UploadedBlob{}, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(d.c.log, res))
+		}
+		uploadLocation, err = res.Location()
+		if err != nil {
+			return private.UploadedBlob{}, fmt.Errorf("determining upload URL: %w", err)
+		}
 	}
+	d.recordUploadState(uploadStatePath, uploadLocation)
 
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	digester, stream := putblobdigest.DigestIfSupportedUnknown(stream, inputInfo, d.digestAlgorithm)
 	sizeCounter := &sizeCounter{}
 	stream = io.TeeReader(stream, sizeCounter)
 
-	uploadLocation, err = func() (*url.URL, error) { // A scope for defer
-		uploadReader := uploadreader.NewUploadReader(stream)
-		// This error text should never be user-visible, we terminate only after makeRequestToResolvedURL
-		// returns, so there isn’t a way for the error text to be provided to any of our callers.
-		defer uploadReader.Terminate(errors.New("Reading data from an already terminated upload"))
-		res, err = d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, uploadReader, inputInfo.Size, v2Auth, nil)
-		if err != nil {
-			logrus.Debugf("Error uploading layer chunked %v", err)
-			return nil, err
+	patchHeaders := map[string][]string{"Content-Type": {"application/octet-stream"}}
+	patchSize := inputInfo.Size
+	if uploadOffset > 0 {
+		d.c.log.Debugf("Resuming upload of %s at offset %d", inputInfo.Digest, uploadOffset)
+		// The skipped data still needs to be digested and counted.
+		if _, err := io.CopyN(io.Discard, stream, uploadOffset); err != nil {
+			return private.UploadedBlob{}, fmt.Errorf("skipping already uploaded data: %w", err)
 		}
-		defer res.Body.Close()
-		if !successStatus(res.StatusCode) {
-			return nil, fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(res))
+		if inputInfo.Size != -1 {
+			patchSize = inputInfo.Size - uploadOffset
+			patchHeaders["Content-Range"] = []string{fmt.Sprintf("%d-%d", uploadOffset, inputInfo.Size-1)}
 		}
-		uploadLocation, err := res.Location()
+	}
+
+	// If the registry already has all of the data (e.g. if only the final PUT failed), there is nothing to PATCH;
+	// an empty PATCH would need an invalid Content-Range.
+	var err error
+	if inputInfo.Size != -1 && uploadOffset == inputInfo.Size {
+		d.c.log.Debugf("The registry already has all data of %s", inputInfo.Digest)
+	} else {
+		uploadLocation, err = d.patchBlobUpload(ctx, uploadLocation, patchHeaders, stream, patchSize)
 		if err != nil {
-			return nil, fmt.Errorf("determining upload URL: %w", err)
+			return private.UploadedBlob{}, err
 		}
-		return uploadLocation, nil
-	}()
-	if err != nil {
-		return private.UploadedBlob{}, err
 	}
 	blobDigest := digester.Digest()
 
@@ -217,15 +241,40 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusCreated {
-		logrus.Debugf("Error uploading layer, response %#v", *res)
-		return private.UploadedBlob{}, fmt.Errorf("uploading layer to %s: %w", uploadLocation, registryHTTPResponseToError(res))
+		d.c.log.Debugf("Error uploading layer, response %#v", *res)
+		return private.UploadedBlob{}, fmt.Errorf("uploading layer to %s: %w", uploadLocation, registryHTTPResponseToError(d.c.log, res))
 	}
 
-	logrus.Debugf("Upload of layer %s complete", blobDigest)
+	d.removeUploadState(uploadStatePath)
+	d.c.log.Debugf("Upload of layer %s complete", blobDigest)
+	d.c.reportBlobTransfer(types.MetricDirectionPush, sizeCounter.size-uploadOffset, start)
 	options.Cache.RecordKnownLocation(d.ref.Transport(), bicTransportScope(d.ref), blobDigest, newBICLocationReference(d.ref))
 	return private.UploadedBlob{Digest: blobDigest, Size: sizeCounter.size}, nil
 }
 
+// patchBlobUpload sends size bytes (or all data, if size is -1) from stream to the upload session at uploadLocation,
+// and returns the location to use for the rest of the upload.
+func (d *dockerImageDestination) patchBlobUpload(ctx context.Context, uploadLocation *url.URL, headers map[string][]string, stream io.Reader, size int64) (*url.URL, error) {
+	uploadReader := uploadreader.NewUploadReader(stream)
+	// This error text should never be user-visible, we terminate only after makeRequestToResolvedURL
+	// returns, so there isn’t a way for the error text to be provided to any of our callers.
+	defer uploadReader.Terminate(errors.New("Reading data from an already terminated upload"))
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, headers, uploadReader, size, v2Auth, nil)
+	if err != nil {
+		d.c.log.Debugf("Error uploading layer chunked %v", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if !successStatus(res.StatusCode) {
+		return nil, fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(d.c.log, res))
+	}
+	uploadLocation, err = res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("determining upload URL: %w", err)
+	}
+	return uploadLocation, nil
+}
+
 // blobExists returns true iff repo contains a blob with digest, and if so, also its size.
 // If the destination does not contain the blob, or it is unknown, blobExists ordinarily returns (false, -1, nil);
 // it returns a non-nil error only on an unexpected failure.
@@ -234,7 +283,7 @@ func (d *dockerImageDestination) blobExists(ctx context.Context, repo reference.
 		return false, -1, err
 	}
 	checkPath := fmt.Sprintf(blobsPath, reference.Path(repo), digest.String())
-	logrus.Debugf("Checking %s", checkPath)
+	d.c.log.Debugf("Checking %s", checkPath)
 	res, err := d.c.makeRequest(ctx, http.MethodHead, checkPath, nil, nil, v2Auth, extraScope)
 	if err != nil {
 		return false, -1, err
@@ -242,16 +291,16 @@ func (d *dockerImageDestination) blobExists(ctx context.Context, repo reference.
 	defer res.Body.Close()
 	switch res.StatusCode {
 	case http.StatusOK:
-		logrus.Debugf("... already exists")
+		d.c.log.Debugf("... already exists")
 		return true, getBlobSize(res), nil
 	case http.StatusUnauthorized:
-		logrus.Debugf("... not authorized")
-		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(res))
+		d.c.log.Debugf("... not authorized")
+		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(d.c.log, res))
 	case http.StatusNotFound:
-		logrus.Debugf("... not present")
+		d.c.log.Debugf("... not present")
 		return false, -1, nil
 	default:
-		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(res))
+		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(d.c.log, res))
 	}
 }
 
@@ -264,7 +313,7 @@ func (d *dockerImageDestination) mountBlob(ctx context.Context, srcRepo referenc
 			"from":  {reference.Path(srcRepo)},
 		}.Encode(),
 	}
-	logrus.Debugf("Trying to mount %s", u.Redacted())
+	d.c.log.Debugf("Trying to mount %s", u.Redacted())
 	res, err := d.c.makeRequest(ctx, http.MethodPost, u.String(), nil, nil, v2Auth, extraScope)
 	if err != nil {
 		return err
@@ -272,7 +321,7 @@ func (d *dockerImageDestination) mountBlob(ctx context.Context, srcRepo referenc
 	defer res.Body.Close()
 	switch res.StatusCode {
 	case http.StatusCreated:
-		logrus.Debugf("... mount OK")
+		d.c.log.Debugf("... mount OK")
 		return nil
 	case http.StatusAccepted:
 		// Oops, the mount was ignored - either the registry does not support that yet, or the blob does not exist; the registry has started an ordinary upload process.
@@ -282,21 +331,21 @@ func (d *dockerImageDestination) mountBlob(ctx context.Context, srcRepo referenc
 		if err != nil {
 			return fmt.Errorf("determining upload URL after a mount attempt: %w", err)
 		}
-		logrus.Debugf("... started an upload instead of mounting, trying to cancel at %s", uploadLocation.Redacted())
+		d.c.log.Debugf("... started an upload instead of mounting, trying to cancel at %s", uploadLocation.Redacted())
 		res2, err := d.c.makeRequestToResolvedURL(ctx, http.MethodDelete, uploadLocation, nil, nil, -1, v2Auth, extraScope)
 		if err != nil {
-			logrus.Debugf("Error trying to cancel an inadvertent upload: %s", err)
+			d.c.log.Debugf("Error trying to cancel an inadvertent upload: %s", err)
 		} else {
 			defer res2.Body.Close()
 			if res2.StatusCode != http.StatusNoContent {
-				logrus.Debugf("Error trying to cancel an inadvertent upload, status %s", http.StatusText(res.StatusCode))
+				d.c.log.Debugf("Error trying to cancel an inadvertent upload, status %s", http.StatusText(res.StatusCode))
 			}
 		}
 		// Anyway, if canceling the upload fails, ignore it and return the more important error:
 		return fmt.Errorf("Mounting %s from %s to %s started an upload instead", srcDigest, srcRepo.Name(), d.ref.ref.Name())
 	default:
-		logrus.Debugf("Error mounting, response %#v", *res)
-		return fmt.Errorf("mounting %s from %s to %s: %w", srcDigest, srcRepo.Name(), d.ref.ref.Name(), registryHTTPResponseToError(res))
+		d.c.log.Debugf("Error mounting, response %#v", *res)
+		return fmt.Errorf("mounting %s from %s to %s: %w", srcDigest, srcRepo.Name(), d.ref.ref.Name(), registryHTTPResponseToError(d.c.log, res))
 	}
 }
 
@@ -339,34 +388,39 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 			return false, private.ReusedBlob{}, err
 		}
 		if haveBlob {
+			d.c.addToCounter(types.MetricBlobsReused, "", 1)
 			return true, reusedInfo, nil
 		}
 	} else {
-		logrus.Debugf("Ignoring exact blob match, compression %s does not match required %s or MIME types %#v",
+		d.c.log.Debugf("Ignoring exact blob match, compression %s does not match required %s or MIME types %#v",
 			optionalCompressionName(options.OriginalCompression), optionalCompressionName(options.RequiredCompression), options.PossibleManifestFormats)
 	}
 
-	// Then try reusing blobs from other locations.
-	candidates := options.Cache.CandidateLocations2(d.ref.Transport(), bicTransportScope(d.ref), info.Digest, blobinfocache.CandidateLocations2Options{
+	// Then try reusing blobs from other locations, starting with any explicitly provided by the user.
+	candidates := []blobinfocache.BICReplacementCandidate2{}
+	if impl.OriginalCandidateMatchesTryReusingBlobOptions(options) {
+		candidates = append(candidates, d.blobMountHintCandidates(info.Digest)...)
+	}
+	candidates = append(candidates, options.Cache.CandidateLocations2(d.ref.Transport(), bicTransportScope(d.ref), info.Digest, blobinfocache.CandidateLocations2Options{
 		CanSubstitute:           options.CanSubstitute,
 		PossibleManifestFormats: options.PossibleManifestFormats,
 		RequiredCompression:     options.RequiredCompression,
-	})
+	})...)
 	for _, candidate := range candidates {
 		var candidateRepo reference.Named
 		if !candidate.UnknownLocation {
 			var err error
 			candidateRepo, err = parseBICLocationReference(candidate.Location)
 			if err != nil {
-				logrus.Debugf("Error parsing BlobInfoCache location reference: %s", err)
+				d.c.log.Debugf("Error parsing BlobInfoCache location reference: %s", err)
 				continue
 			}
 		}
 		if !candidate.UnknownLocation {
 			if candidate.CompressionAlgorithm != nil {
-				logrus.Debugf("Trying to reuse blob with cached digest %s compressed with %s in destination repo %s", candidate.Digest.String(), candidate.CompressionAlgorithm.Name(), candidateRepo.Name())
+				d.c.log.Debugf("Trying to reuse blob with cached digest %s compressed with %s in destination repo %s", candidate.Digest.String(), candidate.CompressionAlgorithm.Name(), candidateRepo.Name())
 			} else {
-				logrus.Debugf("Trying to reuse blob with cached digest %s in destination repo %s", candidate.Digest.String(), candidateRepo.Name())
+				d.c.log.Debugf("Trying to reuse blob with cached digest %s in destination repo %s", candidate.Digest.String(), candidateRepo.Name())
 			}
 			// Sanity checks:
 			if reference.Domain(candidateRepo) != reference.Domain(d.ref.ref) {
@@ -375,14 +429,14 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 				//
 				// OTOH that would mean we can’t do the “blobExists” check, and if there is no match
 				// we could get an upload request that we would have to cancel.
-				logrus.Debugf("... Internal error: domain %s does not match destination %s", reference.Domain(candidateRepo), reference.Domain(d.ref.ref))
+				d.c.log.Debugf("... Internal error: domain %s does not match destination %s", reference.Domain(candidateRepo), reference.Domain(d.ref.ref))
 				continue
 			}
 		} else {
 			if candidate.CompressionAlgorithm != nil {
-				logrus.Debugf("Trying to reuse blob with cached digest %s compressed with %s with no location match, checking current repo", candidate.Digest.String(), candidate.CompressionAlgorithm.Name())
+				d.c.log.Debugf("Trying to reuse blob with cached digest %s compressed with %s with no location match, checking current repo", candidate.Digest.String(), candidate.CompressionAlgorithm.Name())
 			} else {
-				logrus.Debugf("Trying to reuse blob with cached digest %s in destination repo with no location match, checking current repo", candidate.Digest.String())
+				d.c.log.Debugf("Trying to reuse blob with cached digest %s in destination repo with no location match, checking current repo", candidate.Digest.String())
 			}
 			// This digest is a known variant of this blob but we don’t
 			// have a recorded location in this registry, let’s try looking
@@ -390,7 +444,11 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 			candidateRepo = reference.TrimNamed(d.ref.ref)
 		}
 		if candidateRepo.Name() == d.ref.ref.Name() && candidate.Digest == info.Digest {
-			logrus.Debug("... Already tried the primary destination")
+			d.c.log.Debug("... Already tried the primary destination")
+			continue
+		}
+		if candidateRepo.Name() != d.ref.ref.Name() && d.c.sys != nil && d.c.sys.DockerRegistryDisableBlobMounting {
+			d.c.log.Debug("... Cross-repository blob mounting is disabled")
 			continue
 		}
 
@@ -412,32 +470,56 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 		// so, be a nice client and don't create unnecessary upload sessions on the server.
 		exists, size, err := d.blobExists(ctx, candidateRepo, candidate.Digest, extraScope)
 		if err != nil {
-			logrus.Debugf("... Failed: %v", err)
+			d.c.log.Debugf("... Failed: %v", err)
 			continue
 		}
 		if !exists {
 			// FIXME? Should we drop the blob from cache here (and elsewhere?)?
-			continue // logrus.Debug() already happened in blobExists
+			continue // d.c.log.Debug() already happened in blobExists
 		}
 		if candidateRepo.Name() != d.ref.ref.Name() {
 			if err := d.mountBlob(ctx, candidateRepo, candidate.Digest, extraScope); err != nil {
-				logrus.Debugf("... Mount failed: %v", err)
+				d.c.log.Debugf("... Mount failed: %v", err)
 				continue
 			}
 		}
 
 		options.Cache.RecordKnownLocation(d.ref.Transport(), bicTransportScope(d.ref), candidate.Digest, newBICLocationReference(d.ref))
 
+		d.c.addToCounter(types.MetricBlobsReused, "", 1)
 		return true, private.ReusedBlob{
-			Digest:               candidate.Digest,
-			Size:                 size,
-			CompressionOperation: candidate.CompressionOperation,
-			CompressionAlgorithm: candidate.CompressionAlgorithm}, nil
+			Digest:                 candidate.Digest,
+			Size:                   size,
+			CompressionOperation:   candidate.CompressionOperation,
+			CompressionAlgorithm:   candidate.CompressionAlgorithm,
+			CompressionAnnotations: candidate.CompressionAnnotations,
+		}, nil
 	}
 
 	return false, private.ReusedBlob{}, nil
 }
 
+// blobMountHintCandidates returns candidate locations of blobDigest in other repositories of the destination registry,
+// as provided by the user in SystemContext.DockerRegistryBlobMountHints.
+func (d *dockerImageDestination) blobMountHintCandidates(blobDigest digest.Digest) []blobinfocache.BICReplacementCandidate2 {
+	if d.c.sys == nil {
+		return nil
+	}
+	res := []blobinfocache.BICReplacementCandidate2{}
+	for _, repo := range d.c.sys.DockerRegistryBlobMountHints[blobDigest] {
+		if reference.Domain(repo) != reference.Domain(d.ref.ref) {
+			d.c.log.Debugf("Ignoring blob mount hint %s for %s, it is not on the destination registry %s", repo.Name(), blobDigest, reference.Domain(d.ref.ref))
+			continue
+		}
+		res = append(res, blobinfocache.BICReplacementCandidate2{
+			Digest:               blobDigest,
+			CompressionOperation: types.PreserveOriginal,
+			Location:             types.BICLocationReference{Opaque: repo.Name()},
+		})
+	}
+	return res
+}
+
 // PutManifest writes manifest to the destination.
 // When the primary manifest is a manifest list, if instanceDigest is nil, we're saving the list
 // itself, else instanceDigest contains a digest of the specific manifest instance to overwrite the
@@ -450,7 +532,7 @@ func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, inst
 	// If d.ref.isUnknownDigest=true, then we push without a tag, so get the
 	// digest that will be used
 	if d.ref.isUnknownDigest {
-		digest, err := manifest.Digest(m)
+		digest, err := manifest.DigestWithAlgorithm(m, d.digestAlgorithm)
 		if err != nil {
 			return err
 		}
@@ -467,7 +549,7 @@ func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, inst
 			return fmt.Errorf("digesting manifest in PutManifest: %w", err)
 		}
 		if !matches {
-			manifestDigest, merr := manifest.Digest(m)
+			manifestDigest, merr := manifest.DigestWithAlgorithm(m, instanceDigest.Algorithm())
 			if merr != nil {
 				return fmt.Errorf("Attempted to PutManifest using an explicitly specified digest (%q) that didn't match the manifest's digest: %w", instanceDigest.String(), merr)
 			}
@@ -476,7 +558,12 @@ func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, inst
 	} else {
 		// Compute the digest of the main manifest, or the list if it's a list, so that we
 		// have a digest value to use if we're asked to save a signature for the manifest.
-		digest, err := manifest.Digest(m)
+		// Use the algorithm of the digest in the reference, if any, so that the two match.
+		algorithm := d.digestAlgorithm
+		if canonical, ok := d.ref.ref.(reference.Canonical); ok {
+			algorithm = canonical.Digest().Algorithm()
+		}
+		digest, err := manifest.DigestWithAlgorithm(m, algorithm)
 		if err != nil {
 			return err
 		}
@@ -507,7 +594,7 @@ func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, t
 	}
 	defer res.Body.Close()
 	if !successStatus(res.StatusCode) {
-		rawErr := registryHTTPResponseToError(res)
+		rawErr := registryHTTPResponseToError(d.c.log, res)
 		err := fmt.Errorf("uploading manifest %s to %s: %w", tagOrDigest, d.ref.ref.Name(), rawErr)
 		if isManifestInvalidError(rawErr) {
 			err = types.ManifestTypeRejectedError{Err: err}
@@ -524,7 +611,14 @@ func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, t
 	// https://github.com/opencontainers/distribution-spec/blob/ec90a2af85fe4d612cf801e1815b95bfa40ae72b/spec.md#legacy-docker-support-http-headers
 	// So, just note the missing header in a debug log.
 	if v := res.Header.Values("Docker-Content-Digest"); len(v) == 0 {
-		logrus.Debugf("Manifest upload response didn’t contain a Docker-Content-Digest header, it might not be a container registry")
+		d.c.log.Debugf("Manifest upload response didn’t contain a Docker-Content-Digest header, it might not be a container registry")
+	}
+	// Registries which support the referrers API confirm that they have processed the subject field
+	// using the OCI-Subject header; otherwise, maintain the referrers list using the fallback tag schema.
+	if res.Header.Get("OCI-Subject") == "" {
+		if err := d.updateReferrersTagSchema(ctx, m, mimeType); err != nil {
+			return fmt.Errorf("updating referrers of manifest %s in %s: %w", tagOrDigest, d.ref.ref.Name(), err)
+		}
 	}
 	return nil
 }
@@ -663,7 +757,7 @@ func (d *dockerImageDestination) putSignaturesToLookaside(signatures []signature
 func (d *dockerImageDestination) putOneSignature(sigURL *url.URL, sig signature.Signature) error {
 	switch sigURL.Scheme {
 	case "file":
-		logrus.Debugf("Writing to %s", sigURL.Path)
+		d.c.log.Debugf("Writing to %s", sigURL.Path)
 		err := os.MkdirAll(filepath.Dir(sigURL.Path), 0755)
 		if err != nil {
 			return err
@@ -689,6 +783,9 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 	if !d.c.useSigstoreAttachments {
 		return errors.New("writing sigstore attachments is disabled by configuration")
 	}
+	if d.c.sigstoreAttachmentsFormat == sigstoreAttachmentsFormatReferrers {
+		return d.putSignaturesToSigstoreReferrers(ctx, signatures, manifestDigest)
+	}
 
 	ociManifest, err := d.c.getSigstoreAttachmentManifest(ctx, d.ref, manifestDigest)
 	if err != nil {
@@ -703,9 +800,9 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		}, nil)
 		ociConfig.RootFS.Type = "layers"
 	} else {
-		logrus.Debugf("Fetching sigstore attachment config %s", ociManifest.Config.Digest.String())
+		d.c.log.Debugf("Fetching sigstore attachment config %s", ociManifest.Config.Digest.String())
 		// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount configs.
-		configBlob, err := d.c.getOCIDescriptorContents(ctx, d.ref, ociManifest.Config, iolimits.MaxConfigBodySize,
+		configBlob, err := d.c.getOCIDescriptorContents(ctx, d.ref, ociManifest.Config, iolimits.MaxConfigBodySizeFor(d.c.sys),
 			none.NoCache)
 		if err != nil {
 			return err
@@ -728,7 +825,7 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		alreadyOnRegistry := false
 		for _, layer := range ociManifest.Layers {
 			if layerMatchesSigstoreSignature(layer, mimeType, payloadBlob, annotations) {
-				logrus.Debugf("Signature with digest %s already exists on the registry", layer.Digest.String())
+				d.c.log.Debugf("Signature with digest %s already exists on the registry", layer.Digest.String())
 				alreadyOnRegistry = true
 				break
 			}
@@ -752,14 +849,14 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		sigDesc.Annotations = annotations
 		ociManifest.Layers = append(ociManifest.Layers, sigDesc)
 		ociConfig.RootFS.DiffIDs = append(ociConfig.RootFS.DiffIDs, sigDesc.Digest)
-		logrus.Debugf("Adding new signature, digest %s", sigDesc.Digest.String())
+		d.c.log.Debugf("Adding new signature, digest %s", sigDesc.Digest.String())
 	}
 
 	configBlob, err := json.Marshal(ociConfig)
 	if err != nil {
 		return err
 	}
-	logrus.Debugf("Uploading updated sigstore attachment config")
+	d.c.log.Debugf("Uploading updated sigstore attachment config")
 	// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount configs.
 	configDesc, err := d.putBlobBytesAsOCI(ctx, configBlob, imgspecv1.MediaTypeImageConfig, private.PutBlobOptions{
 		Cache:      none.NoCache,
@@ -780,10 +877,83 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 	if err != nil {
 		return err
 	}
-	logrus.Debugf("Uploading sigstore attachment manifest")
+	d.c.log.Debugf("Uploading sigstore attachment manifest")
 	return d.uploadManifest(ctx, manifestBlob, attachmentTag)
 }
 
+// putSignaturesToSigstoreReferrers implements putSignaturesToSigstoreAttachments for sigstoreAttachmentsFormatReferrers:
+// each signature which does not exist yet is written as a separate OCI artifact manifest, with manifestDigest as its subject.
+func (d *dockerImageDestination) putSignaturesToSigstoreReferrers(ctx context.Context, signatures []signature.Sigstore, manifestDigest digest.Digest) error {
+	subjectManifest, subjectMIMEType, err := d.c.fetchManifest(ctx, d.ref, manifestDigest.String())
+	if err != nil {
+		return fmt.Errorf("reading signed manifest %s: %w", manifestDigest.String(), err)
+	}
+	subjectDesc, err := manifest.OCI1DescriptorForManifest(subjectManifest, subjectMIMEType)
+	if err != nil {
+		return err
+	}
+	subject := imgspecv1.Descriptor{
+		MediaType: subjectDesc.MediaType,
+		Digest:    subjectDesc.Digest,
+		Size:      subjectDesc.Size,
+	}
+	existing, err := d.c.getSigstoreReferrerManifests(ctx, d.ref, manifestDigest)
+	if err != nil {
+		return err
+	}
+
+	configUploaded := false
+	for _, sig := range signatures {
+		mimeType := sig.UntrustedMIMEType()
+		payloadBlob := sig.UntrustedPayload()
+		annotations := sig.UntrustedAnnotations()
+
+		if slices.ContainsFunc(existing, func(m *manifest.OCI1) bool {
+			return slices.ContainsFunc(m.Layers, func(layer imgspecv1.Descriptor) bool {
+				return layerMatchesSigstoreSignature(layer, mimeType, payloadBlob, annotations)
+			})
+		}) {
+			d.c.log.Debugf("Signature with digest %s already exists on the registry", digest.FromBytes(payloadBlob).String())
+			continue
+		}
+
+		if !configUploaded {
+			// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount configs.
+			if _, err := d.putBlobBytesAsOCI(ctx, imgspecv1.DescriptorEmptyJSON.Data, imgspecv1.MediaTypeEmptyJSON, private.PutBlobOptions{
+				Cache:      none.NoCache,
+				IsConfig:   true,
+				EmptyLayer: false,
+				LayerIndex: nil,
+			}); err != nil {
+				return err
+			}
+			configUploaded = true
+		}
+		// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount attachment payloads.
+		sigDesc, err := d.putBlobBytesAsOCI(ctx, payloadBlob, mimeType, private.PutBlobOptions{
+			Cache:      none.NoCache,
+			IsConfig:   false,
+			EmptyLayer: false,
+			LayerIndex: nil,
+		})
+		if err != nil {
+			return err
+		}
+		sigDesc.Annotations = annotations
+		ociManifest := manifest.OCI1ArtifactFromComponents(signature.SigstoreSignatureArtifactType, []imgspecv1.Descriptor{sigDesc}, &subject, nil)
+		manifestBlob, err := ociManifest.Serialize()
+		if err != nil {
+			return err
+		}
+		d.c.log.Debugf("Uploading sigstore signature manifest for signature %s", sigDesc.Digest.String())
+		if err := d.uploadManifest(ctx, manifestBlob, digest.FromBytes(manifestBlob).String()); err != nil {
+			return err
+		}
+		existing = append(existing, ociManifest)
+	}
+	return nil
+}
+
 func layerMatchesSigstoreSignature(layer imgspecv1.Descriptor, mimeType string,
 	payloadBlob []byte, annotations map[string]string) bool {
 	if layer.MediaType != mimeType ||
@@ -825,7 +995,7 @@ func (d *dockerImageDestination) putBlobBytesAsOCI(ctx context.Context, contents
 func (c *dockerClient) deleteOneSignature(sigURL *url.URL) (missing bool, err error) {
 	switch sigURL.Scheme {
 	case "file":
-		logrus.Debugf("Deleting %s", sigURL.Path)
+		c.log.Debugf("Deleting %s", sigURL.Path)
 		err := os.Remove(sigURL.Path)
 		if err != nil && os.IsNotExist(err) {
 			return true, nil
@@ -905,8 +1075,8 @@ func (d *dockerImageDestination) putSignaturesToAPIExtension(ctx context.Context
 		}
 		defer res.Body.Close()
 		if res.StatusCode != http.StatusCreated {
-			logrus.Debugf("Error uploading signature, status %d, %#v", res.StatusCode, res)
-			return fmt.Errorf("uploading signature to %s in %s: %w", path, d.c.registry, registryHTTPResponseToError(res))
+			d.c.log.Debugf("Error uploading signature, status %d, %#v", res.StatusCode, res)
+			return fmt.Errorf("uploading signature to %s in %s: %w", path, d.c.registry, registryHTTPResponseToError(d.c.log, res))
 		}
 	}
 
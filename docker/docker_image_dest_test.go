@@ -3,10 +3,26 @@ package docker
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,8 +45,394 @@ func TestIsManifestInvalidError(t *testing.T) {
 	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader([]byte(response))), nil)
 	require.NoError(t, err)
 	defer resp.Body.Close()
-	err = registryHTTPResponseToError(resp)
+	err = registryHTTPResponseToError(logging.Logger{}, resp)
 
 	res := isManifestInvalidError(err)
 	assert.True(t, res, "%#v", err)
 }
+
+func TestDockerImageDestinationBlobMounting(t *testing.T) {
+	blobDigest := digest.FromString("blob")
+	mounts := 0
+	otherRepoRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/blobs/"+blobDigest.String():
+			rw.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/other/blobs/"+blobDigest.String():
+			otherRepoRequests++
+			rw.Header().Set("Content-Length", "4")
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/repo/blobs/uploads/":
+			assert.Equal(t, blobDigest.String(), r.URL.Query().Get("mount"))
+			assert.Equal(t, "other", r.URL.Query().Get("from"))
+			mounts++
+			rw.WriteHeader(http.StatusCreated)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	ref, err := ParseReference("//" + registry + "/repo:tag")
+	require.NoError(t, err)
+	otherRepo, err := reference.ParseNormalizedNamed(registry + "/other")
+	require.NoError(t, err)
+	elsewhere, err := reference.ParseNormalizedNamed("elsewhere.example.com/other")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		disable          bool
+		hints            []reference.Named
+		expectedReused   bool
+		expectedRequests int
+	}{
+		{false, nil, false, 0},
+		{false, []reference.Named{elsewhere}, false, 0},
+		{false, []reference.Named{otherRepo}, true, 1},
+		{true, []reference.Named{otherRepo}, false, 0},
+	} {
+		mounts, otherRepoRequests = 0, 0
+		dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{
+			RegistriesDirPath:                 "/this/does/not/exist",
+			DockerPerHostCertDirPath:          "/this/does/not/exist",
+			SystemRegistriesConfPath:          registriesConf,
+			DockerInsecureSkipTLSVerify:       types.OptionalBoolTrue,
+			AuthFilePath:                      "/this/does/not/exist",
+			DockerRegistryDisableBlobMounting: c.disable,
+			DockerRegistryBlobMountHints:      map[digest.Digest][]reference.Named{blobDigest: c.hints},
+		})
+		require.NoError(t, err)
+		reused, blob, err := dest.(private.ImageDestination).TryReusingBlobWithOptions(context.Background(),
+			types.BlobInfo{Digest: blobDigest, Size: 4}, private.TryReusingBlobOptions{
+				Cache: blobinfocache.FromBlobInfoCache(memory.New()),
+			})
+		require.NoError(t, err)
+		assert.Equal(t, c.expectedReused, reused)
+		if c.expectedReused {
+			assert.Equal(t, private.ReusedBlob{Digest: blobDigest, Size: 4}, blob)
+		}
+		assert.Equal(t, c.expectedRequests, mounts)
+		assert.Equal(t, c.expectedRequests, otherRepoRequests)
+		require.NoError(t, dest.Close())
+	}
+}
+
+func TestDockerImageDestinationResumableUpload(t *testing.T) {
+	blob := []byte("0123456789abcdef")
+	blobDigest := digest.FromBytes(blob)
+	var mutex sync.Mutex
+	received := []byte{}
+	sessions := 0
+	failPatch := true
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/blobs/"+blobDigest.String():
+			rw.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/repo/blobs/uploads/":
+			sessions++
+			received = []byte{}
+			rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+			rw.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/blobs/uploads/session":
+			rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+			rw.Header().Set("Range", fmt.Sprintf("0-%d", len(received)-1))
+			rw.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPatch && r.URL.Path == "/v2/repo/blobs/uploads/session":
+			if failPatch { // Simulate a connection failure after receiving some of the data
+				data := make([]byte, 5)
+				_, err := io.ReadFull(r.Body, data)
+				require.NoError(t, err)
+				received = append(received, data...)
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if len(received) != 0 {
+				assert.Equal(t, fmt.Sprintf("%d-%d", len(received), len(blob)-1), r.Header.Get("Content-Range"))
+			}
+			data, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			received = append(received, data...)
+			rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+			rw.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/repo/blobs/uploads/session":
+			assert.Equal(t, blobDigest.String(), r.URL.Query().Get("digest"))
+			assert.Equal(t, blob, received)
+			rw.WriteHeader(http.StatusCreated)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	stateDir := t.TempDir()
+	ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:            "/this/does/not/exist",
+		DockerPerHostCertDirPath:     "/this/does/not/exist",
+		SystemRegistriesConfPath:     registriesConf,
+		DockerInsecureSkipTLSVerify:  types.OptionalBoolTrue,
+		AuthFilePath:                 "/this/does/not/exist",
+		DockerRegistryUploadStateDir: stateDir,
+	}
+
+	putBlob := func() (private.UploadedBlob, error) {
+		dest, err := ref.NewImageDestination(context.Background(), sys)
+		require.NoError(t, err)
+		defer dest.Close()
+		return dest.(private.ImageDestination).PutBlobWithOptions(context.Background(), bytes.NewReader(blob),
+			types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, private.PutBlobOptions{
+				Cache: blobinfocache.FromBlobInfoCache(memory.New()),
+			})
+	}
+
+	_, err = putBlob()
+	assert.Error(t, err)
+	states, err := os.ReadDir(stateDir)
+	require.NoError(t, err)
+	assert.Len(t, states, 1)
+
+	mutex.Lock()
+	failPatch = false
+	mutex.Unlock()
+	uploaded, err := putBlob()
+	require.NoError(t, err)
+	assert.Equal(t, private.UploadedBlob{Digest: blobDigest, Size: int64(len(blob))}, uploaded)
+	assert.Equal(t, 1, sessions)
+	states, err = os.ReadDir(stateDir)
+	require.NoError(t, err)
+	assert.Empty(t, states)
+}
+
+func TestDockerImageDestinationResumeCompleteOrInvalidUpload(t *testing.T) {
+	blob := []byte("0123456789abcdef")
+	blobDigest := digest.FromBytes(blob)
+	for _, c := range []struct {
+		name             string
+		received         []byte // Data received by the registry in the recorded upload session
+		expectedSessions int
+		expectedPatches  int
+	}{
+		{"all data received", blob, 0, 0},                                  // Only the final PUT is needed
+		{"more data than the blob", append(slices.Clone(blob), 'x'), 1, 1}, // The upload is restarted
+	} {
+		var mutex sync.Mutex
+		received := c.received
+		sessions, patches := 0, 0
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/blobs/"+blobDigest.String():
+				rw.WriteHeader(http.StatusNotFound)
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/repo/blobs/uploads/":
+				sessions++
+				received = []byte{}
+				rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+				rw.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/blobs/uploads/session":
+				rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+				rw.Header().Set("Range", fmt.Sprintf("0-%d", len(received)-1))
+				rw.WriteHeader(http.StatusNoContent)
+			case r.Method == http.MethodPatch && r.URL.Path == "/v2/repo/blobs/uploads/session":
+				patches++
+				assert.Empty(t, r.Header.Get("Content-Range"), c.name)
+				data, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				received = append(received, data...)
+				rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+				rw.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodPut && r.URL.Path == "/v2/repo/blobs/uploads/session":
+				assert.Equal(t, blobDigest.String(), r.URL.Query().Get("digest"), c.name)
+				assert.Equal(t, blob, received, c.name)
+				rw.WriteHeader(http.StatusCreated)
+			default:
+				require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+			}
+		}))
+		defer server.Close()
+
+		registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+		err := os.WriteFile(registriesConf, []byte{}, 0o600)
+		require.NoError(t, err)
+		ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+		require.NoError(t, err)
+		dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{
+			RegistriesDirPath:            "/this/does/not/exist",
+			DockerPerHostCertDirPath:     "/this/does/not/exist",
+			SystemRegistriesConfPath:     registriesConf,
+			DockerInsecureSkipTLSVerify:  types.OptionalBoolTrue,
+			AuthFilePath:                 "/this/does/not/exist",
+			DockerRegistryUploadStateDir: t.TempDir(),
+		})
+		require.NoError(t, err)
+		defer dest.Close()
+		dockerDest, ok := dest.(*dockerImageDestination)
+		require.True(t, ok)
+		sessionURL, err := url.Parse(server.URL + "/v2/repo/blobs/uploads/session")
+		require.NoError(t, err)
+		dockerDest.recordUploadState(dockerDest.uploadStatePath(blobDigest), sessionURL)
+
+		uploaded, err := dockerDest.PutBlobWithOptions(context.Background(), bytes.NewReader(blob),
+			types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, private.PutBlobOptions{
+				Cache: blobinfocache.FromBlobInfoCache(memory.New()),
+			})
+		require.NoError(t, err, c.name)
+		assert.Equal(t, private.UploadedBlob{Digest: blobDigest, Size: int64(len(blob))}, uploaded, c.name)
+		assert.Equal(t, c.expectedSessions, sessions, c.name)
+		assert.Equal(t, c.expectedPatches, patches, c.name)
+	}
+}
+
+func TestDockerImageDestinationPutManifestDigestAlgorithm(t *testing.T) {
+	m := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":1},` +
+		`"layers":[]}`)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/repo/manifests/"):
+			rw.Header().Set("OCI-Subject", "unused") // Don't try to update the referrers tag schema
+			rw.WriteHeader(http.StatusCreated)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, c := range []struct {
+		ref      string
+		expected digest.Digest
+	}{
+		{"//" + host + "/repo:tag", digest.SHA512.FromBytes(m)},
+		// The digest in the reference determines the algorithm
+		{"//" + host + "/repo@" + digest.SHA256.FromBytes(m).String(), digest.SHA256.FromBytes(m)},
+	} {
+		ref, err := ParseReference(c.ref)
+		require.NoError(t, err, c.ref)
+		dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    registriesConf,
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			AuthFilePath:                "/this/does/not/exist",
+			DigestAlgorithm:             digest.SHA512,
+		})
+		require.NoError(t, err, c.ref)
+		defer dest.Close()
+		err = dest.PutManifest(context.Background(), m, nil)
+		require.NoError(t, err, c.ref)
+		dockerDest, ok := dest.(*dockerImageDestination)
+		require.True(t, ok)
+		// Signatures are stored for this digest
+		assert.Equal(t, c.expected, dockerDest.manifestDigest, c.ref)
+	}
+}
+
+// readCounter counts the bytes read from an io.Reader.
+type readCounter struct {
+	r     io.Reader
+	bytes int
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.bytes += n
+	return n, err
+}
+
+func TestDockerImageDestinationUnknownSizeBlob(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	blobDigest := digest.FromBytes(blob)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/repo/blobs/uploads/":
+			rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+			rw.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPatch && r.URL.Path == "/v2/repo/blobs/uploads/session":
+			// The data is streamed without knowing its size upfront
+			assert.Equal(t, int64(-1), r.ContentLength)
+			data, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, blob, data)
+			rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+			rw.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/repo/blobs/uploads/session":
+			assert.Equal(t, blobDigest.String(), r.URL.Query().Get("digest"))
+			rw.WriteHeader(http.StatusCreated)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+		BigFilesTemporaryDir:        "/this/does/not/exist", // Make sure the blob is not buffered on disk
+	}
+	dest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	// A blob with unknown digest and size is read only once, and its digest and size are computed while uploading
+	stream := &readCounter{r: bytes.NewReader(blob)}
+	uploaded, err := dest.(private.ImageDestination).PutBlobWithOptions(context.Background(), stream,
+		types.BlobInfo{Digest: "", Size: -1}, private.PutBlobOptions{
+			Cache: blobinfocache.FromBlobInfoCache(memory.New()),
+		})
+	require.NoError(t, err)
+	assert.Equal(t, private.UploadedBlob{Digest: blobDigest, Size: int64(len(blob))}, uploaded)
+	assert.Equal(t, len(blob), stream.bytes)
+}
+
+func TestParseUploadRange(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected int64
+	}{
+		{"", 0},
+		{"0--1", 0},
+		{"0-0", 1},
+		{"0-1023", 1024},
+	} {
+		res, err := parseUploadRange(c.input)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+	for _, input := range []string{"1-10", "0-", "0-x", "10"} {
+		_, err := parseUploadRange(input)
+		assert.Error(t, err, input)
+	}
+}
@@ -16,11 +16,13 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
@@ -29,7 +31,7 @@ import (
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/regexp"
 	digest "github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // maxLookasideSignatures is an arbitrary limit for the total number of signatures we would try to read from a lookaside server,
@@ -44,6 +46,7 @@ type dockerImageSource struct {
 
 	logicalRef  dockerReference // The reference the user requested. This must satisfy !isUnknownDigest
 	physicalRef dockerReference // The actual reference we are accessing (possibly a mirror). This must satisfy !isUnknownDigest
+	endpoint    string          // The location of the sysregistriesv2.Endpoint physicalRef was obtained from
 	c           *dockerClient
 	// State
 	cachedManifest         []byte // nil if not loaded yet
@@ -82,10 +85,12 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 	// non-mirror original location last; this both transparently handles the case
 	// of no mirrors configured, and ensures we return the error encountered when
 	// accessing the upstream location if all endpoints fail.
+	// Mirrors which have recently failed in this process are skipped.
 	pullSources, err := registry.PullSourcesFromReference(ref.ref)
 	if err != nil {
 		return nil, err
 	}
+	pullSources = pullEndpointHealth.orderPullSources(logging.For(sys), pullSources)
 	type attempt struct {
 		ref reference.Named
 		err error
@@ -93,15 +98,17 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 	attempts := []attempt{}
 	for _, pullSource := range pullSources {
 		if sys != nil && sys.DockerLogMirrorChoice {
-			logrus.Infof("Trying to access %q", pullSource.Reference)
+			logging.For(sys).Infof("Trying to access %q", pullSource.Reference)
 		} else {
-			logrus.Debugf("Trying to access %q", pullSource.Reference)
+			logging.For(sys).Debugf("Trying to access %q", pullSource.Reference)
 		}
 		s, err := newImageSourceAttempt(ctx, sys, ref, pullSource, registryConfig)
 		if err == nil {
+			pullEndpointHealth.recordSuccess(pullSource.Endpoint.Location)
 			return s, nil
 		}
-		logrus.Debugf("Accessing %q failed: %v", pullSource.Reference, err)
+		logging.For(sys).Debugf("Accessing %q failed: %v", pullSource.Reference, err)
+		pullEndpointHealth.recordFailure(logging.For(sys), pullSource.Endpoint.Location, err)
 		attempts = append(attempts, attempt{
 			ref: pullSource.Reference,
 			err: err,
@@ -149,6 +156,10 @@ func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logica
 		return nil, err
 	}
 	client.tlsClientConfig.InsecureSkipVerify = pullSource.Endpoint.Insecure
+	client.proxy, err = registryProxy(endpointSys, reference.Domain(physicalRef.ref), pullSource.Endpoint.Proxy)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &dockerImageSource{
 		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
@@ -157,6 +168,7 @@ func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logica
 
 		logicalRef:  logicalRef,
 		physicalRef: physicalRef,
+		endpoint:    pullSource.Endpoint.Location,
 		c:           client,
 	}
 	s.Compat = impl.AddCompat(s)
@@ -180,16 +192,15 @@ func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logica
 		}
 		acfD, err := json.Marshal(acf)
 		if err != nil {
-			logrus.Warnf("failed to marshal auth config: %v", err)
+			logging.For(sys).Warnf("failed to marshal auth config: %v", err)
 		} else {
-			cmd := exec.Command(h)
+			cmd := exec.CommandContext(ctx, h)
 			cmd.Stdin = bytes.NewReader(acfD)
+			// exec.ExitError.Stderr is only populated by cmd.Output(), so collect stderr ourselves.
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
 			if err := cmd.Run(); err != nil {
-				var stderr string
-				if ee, ok := err.(*exec.ExitError); ok {
-					stderr = string(ee.Stderr)
-				}
-				logrus.Warnf("Failed to call additional-layer-store-auth-helper (stderr:%s): %v", stderr, err)
+				logging.For(sys).Warnf("Failed to call additional-layer-store-auth-helper (stderr:%s): %v", stderr.String(), err)
 			}
 		}
 	}
@@ -411,7 +422,7 @@ func (s *dockerImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo,
 		return nil, nil, err
 	}
 	path := fmt.Sprintf(blobsPath, reference.Path(s.physicalRef.ref), info.Digest.String())
-	logrus.Debugf("Downloading %s", path)
+	s.c.log.Debugf("Downloading %s", path)
 	res, err := s.c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
 	if err != nil {
 		return nil, nil, err
@@ -436,11 +447,12 @@ func (s *dockerImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo,
 
 		go handle206Response(streams, errs, res.Body, chunks, mediaType, params)
 		return streams, errs, nil
-	case http.StatusBadRequest:
+	case http.StatusBadRequest, http.StatusRequestedRangeNotSatisfiable:
+		// Some registries reject requests for too many ranges; report that so that the caller can retry with fewer, larger, chunks.
 		res.Body.Close()
 		return nil, nil, private.BadPartialRequestError{Status: res.Status}
 	default:
-		err := registryHTTPResponseToError(res)
+		err := registryHTTPResponseToError(s.c.log, res)
 		res.Body.Close()
 		return nil, nil, fmt.Errorf("fetching partial blob: %w", err)
 	}
@@ -450,7 +462,18 @@ func (s *dockerImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo,
 // The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
 // May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
 func (s *dockerImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
-	return s.c.getBlob(ctx, s.physicalRef, info, cache)
+	if s.c.sys != nil && s.c.sys.DockerLogMirrorChoice {
+		s.c.log.Infof("Fetching blob %s from %q", info.Digest, s.physicalRef.ref.Name())
+	} else {
+		s.c.log.Debugf("Fetching blob %s from %q", info.Digest, s.physicalRef.ref.Name())
+	}
+	start := time.Now()
+	stream, size, err := s.c.getBlob(ctx, s.physicalRef, info, cache)
+	if err != nil {
+		pullEndpointHealth.recordFailure(s.c.log, s.endpoint, err)
+		return nil, 0, err
+	}
+	return newMetricsReader(s.c, stream, start), size, nil
 }
 
 // GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
@@ -542,7 +565,7 @@ func (s *dockerImageSource) getSignaturesFromLookaside(ctx context.Context, inst
 func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL) (signature.Signature, bool, error) {
 	switch sigURL.Scheme {
 	case "file":
-		logrus.Debugf("Reading %s", sigURL.Path)
+		s.c.log.Debugf("Reading %s", sigURL.Path)
 		sigBlob, err := os.ReadFile(sigURL.Path)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -557,7 +580,7 @@ func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL
 		return sig, false, nil
 
 	case "http", "https":
-		logrus.Debugf("GET %s", sigURL.Redacted())
+		s.c.log.Debugf("GET %s", sigURL.Redacted())
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sigURL.String(), nil)
 		if err != nil {
 			return nil, false, err
@@ -568,7 +591,7 @@ func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL
 		}
 		defer res.Body.Close()
 		if res.StatusCode == http.StatusNotFound {
-			logrus.Debugf("... got status 404, as expected = end of signatures")
+			s.c.log.Debugf("... got status 404, as expected = end of signatures")
 			return nil, true, nil
 		} else if res.StatusCode != http.StatusOK {
 			return nil, false, fmt.Errorf("reading signature from %s: status %d (%s)", sigURL.Redacted(), res.StatusCode, http.StatusText(res.StatusCode))
@@ -576,7 +599,7 @@ func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL
 
 		contentType := res.Header.Get("Content-Type")
 		if mimeType := simplifyContentType(contentType); mimeType == "text/html" {
-			logrus.Warnf("Signature %q has Content-Type %q, unexpected for a signature", sigURL.Redacted(), contentType)
+			s.c.log.Warnf("Signature %q has Content-Type %q, unexpected for a signature", sigURL.Redacted(), contentType)
 			// Don’t immediately fail; the lookaside spec does not place any requirements on Content-Type.
 			// If the content really is HTML, it’s going to fail in signature.FromBlob.
 		}
@@ -619,7 +642,7 @@ func (s *dockerImageSource) getSignaturesFromAPIExtension(ctx context.Context, i
 
 func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
 	if !s.c.useSigstoreAttachments {
-		logrus.Debugf("Not looking for sigstore attachments: disabled by configuration")
+		s.c.log.Debugf("Not looking for sigstore attachments: disabled by configuration")
 		return nil, nil
 	}
 
@@ -628,20 +651,33 @@ func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Con
 		return nil, err
 	}
 
-	ociManifest, err := s.c.getSigstoreAttachmentManifest(ctx, s.physicalRef, manifestDigest)
-	if err != nil {
-		return nil, err
-	}
-	if ociManifest == nil {
-		return nil, nil
+	var layers []imgspecv1.Descriptor
+	if s.c.sigstoreAttachmentsFormat == sigstoreAttachmentsFormatReferrers {
+		ociManifests, err := s.c.getSigstoreReferrerManifests(ctx, s.physicalRef, manifestDigest)
+		if err != nil {
+			return nil, err
+		}
+		s.c.log.Debugf("Found %d sigstore signature manifests", len(ociManifests))
+		for _, ociManifest := range ociManifests {
+			layers = append(layers, ociManifest.Layers...)
+		}
+	} else {
+		ociManifest, err := s.c.getSigstoreAttachmentManifest(ctx, s.physicalRef, manifestDigest)
+		if err != nil {
+			return nil, err
+		}
+		if ociManifest == nil {
+			return nil, nil
+		}
+		s.c.log.Debugf("Found a sigstore attachment manifest with %d layers", len(ociManifest.Layers))
+		layers = ociManifest.Layers
 	}
 
-	logrus.Debugf("Found a sigstore attachment manifest with %d layers", len(ociManifest.Layers))
 	res := []signature.Signature{}
-	for layerIndex, layer := range ociManifest.Layers {
+	for layerIndex, layer := range layers {
 		// Note that this copies all kinds of attachments: attestations, and whatever else is there,
 		// not just signatures. We leave the signature consumers to decide based on the MIME type.
-		logrus.Debugf("Fetching sigstore attachment %d/%d: %s", layerIndex+1, len(ociManifest.Layers), layer.Digest.String())
+		s.c.log.Debugf("Fetching sigstore attachment %d/%d: %s", layerIndex+1, len(layers), layer.Digest.String())
 		// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount attachment payloads.
 		// That might eventually need to change if payloads grow to be not just signatures, but something
 		// significantly large.
@@ -655,88 +691,6 @@ func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Con
 	return res, nil
 }
 
-// deleteImage deletes the named image from the registry, if supported.
-func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerReference) error {
-	if ref.isUnknownDigest {
-		return fmt.Errorf("Docker reference without a tag or digest cannot be deleted")
-	}
-
-	registryConfig, err := loadRegistryConfiguration(sys)
-	if err != nil {
-		return err
-	}
-	// docker/distribution does not document what action should be used for deleting images.
-	//
-	// Current docker/distribution requires "pull" for reading the manifest and "delete" for deleting it.
-	// quay.io requires "push" (an explicit "pull" is unnecessary), does not grant any token (fails parsing the request) if "delete" is included.
-	// OpenShift ignores the action string (both the password and the token is an OpenShift API token identifying a user).
-	//
-	// We have to hard-code a single string, luckily both docker/distribution and quay.io support "*" to mean "everything".
-	c, err := newDockerClientFromRef(sys, ref, registryConfig, true, "*")
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-
-	headers := map[string][]string{
-		"Accept": manifest.DefaultRequestedManifestMIMETypes,
-	}
-	refTail, err := ref.tagOrDigest()
-	if err != nil {
-		return err
-	}
-	getPath := fmt.Sprintf(manifestPath, reference.Path(ref.ref), refTail)
-	get, err := c.makeRequest(ctx, http.MethodGet, getPath, headers, nil, v2Auth, nil)
-	if err != nil {
-		return err
-	}
-	defer get.Body.Close()
-	switch get.StatusCode {
-	case http.StatusOK:
-	case http.StatusNotFound:
-		return fmt.Errorf("Unable to delete %v. Image may not exist or is not stored with a v2 Schema in a v2 registry", ref.ref)
-	default:
-		return fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(get))
-	}
-	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.MaxManifestBodySize)
-	if err != nil {
-		return err
-	}
-
-	manifestDigest, err := manifest.Digest(manifestBody)
-	if err != nil {
-		return fmt.Errorf("computing manifest digest: %w", err)
-	}
-	deletePath := fmt.Sprintf(manifestPath, reference.Path(ref.ref), manifestDigest)
-
-	// When retrieving the digest from a registry >= 2.3 use the following header:
-	//   "Accept": "application/vnd.docker.distribution.manifest.v2+json"
-	delete, err := c.makeRequest(ctx, http.MethodDelete, deletePath, headers, nil, v2Auth, nil)
-	if err != nil {
-		return err
-	}
-	defer delete.Body.Close()
-	if delete.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(delete))
-	}
-
-	for i := 0; ; i++ {
-		sigURL, err := lookasideStorageURL(c.signatureBase, manifestDigest, i)
-		if err != nil {
-			return err
-		}
-		missing, err := c.deleteOneSignature(sigURL)
-		if err != nil {
-			return err
-		}
-		if missing {
-			break
-		}
-	}
-
-	return nil
-}
-
 type bufferedNetworkReaderBuffer struct {
 	data     []byte
 	len      int
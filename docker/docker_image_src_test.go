@@ -3,11 +3,14 @@ package docker
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -84,6 +87,58 @@ location = "@REGISTRY@/with-mirror"
 	}
 }
 
+func TestDockerImageSourceAdditionalLayerStoreAuthHelper(t *testing.T) {
+	manifestPathRegex := regexp.MustCompile("^/v2/.*/manifests/latest$")
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && manifestPathRegex.MatchString(r.URL.Path):
+			rw.WriteHeader(http.StatusOK)
+			// Empty body is good enough for this test
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	helperOutput := filepath.Join(tmpDir, "helper-input")
+	helper := filepath.Join(tmpDir, "helper")
+	err = os.WriteFile(helper, []byte("#!/bin/sh\ncat > "+helperOutput+"\n"), 0700)
+	require.NoError(t, err)
+	registriesConf := filepath.Join(tmpDir, "registries.conf")
+	err = os.WriteFile(registriesConf, []byte(fmt.Sprintf("additional-layer-store-auth-helper = %q\n", helper)), 0600)
+	require.NoError(t, err)
+
+	ref, err := ParseReference("//" + registryURL.Host + "/repo:latest")
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		DockerAuthConfig:            &types.DockerAuthConfig{Username: "user", Password: "pass"},
+	})
+	require.NoError(t, err)
+	defer src.Close()
+
+	input, err := os.ReadFile(helperOutput)
+	require.NoError(t, err)
+	var parsed map[string]struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	err = json.Unmarshal(input, &parsed)
+	require.NoError(t, err)
+	creds, ok := parsed[registryURL.Host+"/repo:latest"]
+	require.True(t, ok)
+	assert.Equal(t, "user", creds.Username)
+	assert.Equal(t, "pass", creds.Password)
+}
+
 func TestSimplifyContentType(t *testing.T) {
 	for _, c := range []struct{ input, expected string }{
 		{"", ""},
@@ -211,3 +266,51 @@ func TestParseMediaType(t *testing.T) {
 	_, _, err = parseMediaType("multipart/byteranges; boundary=@")
 	require.Error(t, err)
 }
+
+func TestGetBlobAtBadRequest(t *testing.T) {
+	manifestPathRegex := regexp.MustCompile("^/v2/.*/manifests/latest$")
+	blobPathRegex := regexp.MustCompile("^/v2/.*/blobs/")
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && manifestPathRegex.MatchString(r.URL.Path):
+			rw.WriteHeader(http.StatusOK)
+			// Empty body is good enough for this test
+		case r.Method == http.MethodGet && blobPathRegex.MatchString(r.URL.Path):
+			assert.Equal(t, "bytes=0-9,20-29", r.Header.Get("Range"))
+			rw.WriteHeader(status)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ref, err := ParseReference("//" + registryURL.Host + "/repo:latest")
+	require.NoError(t, err)
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(registriesConf, []byte{}, 0600)
+	require.NoError(t, err)
+	genericSrc, err := ref.NewImageSource(context.Background(), &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	})
+	require.NoError(t, err)
+	defer genericSrc.Close()
+	src, ok := genericSrc.(*dockerImageSource)
+	require.True(t, ok)
+
+	info := types.BlobInfo{Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000", Size: 100}
+	chunks := []private.ImageSourceChunk{{Offset: 0, Length: 10}, {Offset: 20, Length: 10}}
+	for _, s := range []int{http.StatusBadRequest, http.StatusRequestedRangeNotSatisfiable} {
+		status = s
+		_, _, err := src.GetBlobAt(context.Background(), info, chunks)
+		var badRequest private.BadPartialRequestError
+		assert.ErrorAs(t, err, &badRequest, http.StatusText(s))
+	}
+}
@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRepositoryTags(t *testing.T) {
+	allTags := []string{"1.0", "1.1", "2.0", "2.1", "latest"}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/tags/list":
+			requests++
+			tags := allTags
+			if last := r.URL.Query().Get("last"); last != "" {
+				i := 0
+				for i < len(tags) && tags[i] <= last {
+					i++
+				}
+				tags = tags[i:]
+			}
+			if n := r.URL.Query().Get("n"); n != "" {
+				pageSize, err := strconv.Atoi(n)
+				require.NoError(t, err)
+				if pageSize < len(tags) {
+					tags = tags[:pageSize]
+					rw.Header().Set("Link", `</v2/repo/tags/list?n=`+n+`&last=`+tags[len(tags)-1]+`>; rel="next"`)
+				}
+			}
+			body, err := json.Marshal(map[string]any{"name": "repo", "tags": tags})
+			require.NoError(t, err)
+			rw.WriteHeader(http.StatusOK)
+			_, err = rw.Write(body)
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+	}
+	ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		options          *TagListOptions
+		expected         []string
+		expectedRequests int
+	}{
+		{nil, allTags, 1},
+		{&TagListOptions{PageSize: 2}, allTags, 3},
+		{&TagListOptions{PageSize: 2, Last: "1.1"}, []string{"2.0", "2.1", "latest"}, 2},
+		{&TagListOptions{PageSize: 2, Filter: regexp.MustCompile(`^2\.`)}, []string{"2.0", "2.1"}, 3},
+	} {
+		requests = 0
+		tags := []string{}
+		err := ListRepositoryTags(context.Background(), sys, ref, c.options, func(tag string) error {
+			tags = append(tags, tag)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, tags)
+		assert.Equal(t, c.expectedRequests, requests)
+	}
+
+	// The callback can stop the listing
+	requests = 0
+	errStop := errors.New("stop")
+	tags := []string{}
+	err = ListRepositoryTags(context.Background(), sys, ref, &TagListOptions{PageSize: 2}, func(tag string) error {
+		tags = append(tags, tag)
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, []string{"1.0"}, tags)
+	assert.Equal(t, 1, requests)
+
+	tags, err = GetRepositoryTags(context.Background(), sys, ref)
+	require.NoError(t, err)
+	assert.Equal(t, allTags, tags)
+}
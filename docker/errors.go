@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/types"
 	"github.com/docker/distribution/registry/api/errcode"
-	"github.com/sirupsen/logrus"
+	v2 "github.com/docker/distribution/registry/api/v2"
 )
 
 var (
@@ -14,7 +17,14 @@ var (
 	// docker V1 registry.
 	ErrV1NotSupported = errors.New("can't talk to a V1 container registry")
 	// ErrTooManyRequests is returned when the status code returned is 429
-	ErrTooManyRequests = errors.New("too many requests to registry")
+	// It matches types.ErrRateLimited.
+	ErrTooManyRequests = fmt.Errorf("too many requests to registry%.0w", types.ErrRateLimited)
+	// ErrCatalogNotSupported is returned by ListRepositories when the registry does not support
+	// enumerating repositories, and no fallback was provided.
+	ErrCatalogNotSupported = errors.New("registry does not support listing repositories")
+	// ErrSearchNotSupported is returned by SearchOptions.Extension when it can not search a registry,
+	// and by Search when the registry supports neither the search API nor listing repositories.
+	ErrSearchNotSupported = errors.New("registry does not support searching")
 )
 
 // ErrUnauthorizedForCredentials is returned when the status code returned is 401
@@ -26,17 +36,23 @@ func (e ErrUnauthorizedForCredentials) Error() string {
 	return fmt.Sprintf("unable to retrieve auth token: invalid username/password: %s", e.Err.Error())
 }
 
+// Is returns true if target is types.ErrUnauthorized, so that errors.Is(err, types.ErrUnauthorized) works.
+func (e ErrUnauthorizedForCredentials) Is(target error) bool {
+	return target == types.ErrUnauthorized
+}
+
 // httpResponseToError translates the https.Response into an error, possibly prefixing it with the supplied context. It returns
 // nil if the response is not considered an error.
 // NOTE: Almost all callers in this package should use registryHTTPResponseToError instead.
-func httpResponseToError(res *http.Response, context string) error {
+// Debug messages are logged to log.
+func httpResponseToError(log logging.Logger, res *http.Response, context string) error {
 	switch res.StatusCode {
 	case http.StatusOK:
 		return nil
 	case http.StatusTooManyRequests:
 		return ErrTooManyRequests
 	case http.StatusUnauthorized:
-		err := registryHTTPResponseToError(res)
+		err := registryHTTPResponseToError(log, res)
 		return ErrUnauthorizedForCredentials{Err: err}
 	default:
 		if context != "" {
@@ -53,7 +69,8 @@ func httpResponseToError(res *http.Response, context string) error {
 // “A `4XX` response code from the registry MAY return a body in any format.”; but if it is
 // JSON, it MUST use the errcode.Error structure.
 // So, callers should primarily decide based on HTTP StatusCode, not based on error type here.
-func registryHTTPResponseToError(res *http.Response) error {
+// Debug messages are logged to log.
+func registryHTTPResponseToError(log logging.Logger, res *http.Response) error {
 	err := handleErrorResponse(res)
 	// len(errs) == 0 should never be returned by handleErrorResponse; if it does, we don't modify it and let the caller report it as is.
 	if errs, ok := err.(errcode.Errors); ok && len(errs) > 0 {
@@ -74,9 +91,9 @@ func registryHTTPResponseToError(res *http.Response) error {
 		// Also, docker/docker similarly only logs the other errors and returns the
 		// first one.
 		if len(errs) > 1 {
-			logrus.Debugf("Discarding non-primary errors:")
+			log.Debugf("Discarding non-primary errors:")
 			for _, err := range errs[1:] {
-				logrus.Debugf("  %s", err.Error())
+				log.Debugf("  %s", err.Error())
 			}
 		}
 		err = errs[0]
@@ -97,5 +114,31 @@ func registryHTTPResponseToError(res *http.Response) error {
 			err = fmt.Errorf("%s%.0w", e.Message, e)
 		}
 	}
-	return err
+	return errcategory.Wrap(err, registryErrorCategory(res.StatusCode, err))
+}
+
+// registryErrorCategory returns the types.Err* value matching err, created by registryHTTPResponseToError
+// for a response with statusCode, or nil if none applies.
+func registryErrorCategory(statusCode int, err error) error {
+	var ec errcode.ErrorCoder
+	if errors.As(err, &ec) {
+		switch ec.ErrorCode() {
+		case errcode.ErrorCodeUnauthorized:
+			return types.ErrUnauthorized
+		case errcode.ErrorCodeDenied:
+			return types.ErrDenied
+		case errcode.ErrorCodeTooManyRequests:
+			return types.ErrRateLimited
+		case v2.ErrorCodeNameUnknown:
+			return types.ErrNotFound
+		case v2.ErrorCodeManifestUnknown:
+			return types.ErrManifestUnknown
+		case v2.ErrorCodeBlobUnknown:
+			return types.ErrBlobUnknown
+		case v2.ErrorCodeManifestInvalid, v2.ErrorCodeManifestUnverified, v2.ErrorCodeManifestBlobUnknown:
+			return types.ErrManifestInvalid
+		}
+	}
+	// opencontainers/distribution-spec does not require the errcode.Error payloads to be used, so fall back to the HTTP status.
+	return errcategory.FromHTTPStatus(statusCode)
 }
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/types"
 	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/stretchr/testify/assert"
@@ -26,6 +28,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 		errorType         any                           // A value of the same type as the expected error, or nil
 		unwrappedErrorPtr any                           // A pointer to a value expected to be reachable using errors.As, or nil
 		errorCode         *errcode.ErrorCode            // A matching ErrorCode, or nil
+		category          error                         // A types.Err* value expected to match using errors.Is, or nil
 		fn                func(t *testing.T, err error) // A more specialized test, or nil
 	}{
 		{
@@ -57,6 +60,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeUnauthorized,
+			category:          types.ErrUnauthorized,
 		},
 		{ // docker.io when an image is not found
 			name: "GET https://registry-1.docker.io/v2/library/this-does-not-exist/manifests/latest",
@@ -74,6 +78,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeDenied,
+			category:          types.ErrDenied,
 		},
 		{ // docker.io when a tag is not found
 			name: "GET https://registry-1.docker.io/v2/library/busybox/manifests/this-does-not-exist",
@@ -92,6 +97,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &v2.ErrorCodeManifestUnknown,
+			category:          types.ErrManifestUnknown,
 		},
 		{ // public.ecr.aws does not implement tag list
 			name: "GET https://public.ecr.aws/v2/nginx/nginx/tags/list",
@@ -107,6 +113,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeUnknown,
+			category:          types.ErrNotFound,
 			fn: func(t *testing.T, err error) {
 				var e errcode.Error
 				ok := errors.As(err, &e)
@@ -135,9 +142,10 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 				"\r\n" +
 				"{\"errors\": [{\"code\": \"404\", \"message\": \"Not Found\"}]}\r\n",
 			errorString:       "unknown: Not Found",
-			errorType:         errcode.Error{},
+			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeUnknown,
+			category:          types.ErrNotFound,
 			fn: func(t *testing.T, err error) {
 				var e errcode.Error
 				ok := errors.As(err, &e)
@@ -164,6 +172,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorString:       `StatusCode: 404, "Not found\r"`,
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedUnexpectedHTTPResponseError,
+			category:          types.ErrNotFound,
 			fn: func(t *testing.T, err error) {
 				var e *unexpectedHTTPResponseError
 				ok := errors.As(err, &e)
@@ -186,9 +195,10 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 				"\r\n" +
 				"{\"errors\":[{\"code\":\"NOT_FOUND\",\"message\":\"artifact test/alpine:sha256-443205b0cfcc78444321d56a2fe273f06e27b2c72b5058f8d7e975997d45b015.sig not found\"}]}\n",
 			errorString:       "unknown: artifact test/alpine:sha256-443205b0cfcc78444321d56a2fe273f06e27b2c72b5058f8d7e975997d45b015.sig not found",
-			errorType:         errcode.Error{},
+			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeUnknown,
+			category:          types.ErrNotFound,
 			fn: func(t *testing.T, err error) {
 				var e errcode.Error
 				ok := errors.As(err, &e)
@@ -206,7 +216,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 		require.NoError(t, err, c.name)
 		defer res.Body.Close()
 
-		err = registryHTTPResponseToError(res)
+		err = registryHTTPResponseToError(logging.Logger{}, res)
 		assert.Equal(t, c.errorString, err.Error(), c.name)
 		if c.errorType != nil {
 			assert.IsType(t, c.errorType, err, c.name)
@@ -221,6 +231,9 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			require.True(t, ok, c.name)
 			assert.Equal(t, *c.errorCode, ec.ErrorCode(), c.name)
 		}
+		if c.category != nil {
+			assert.ErrorIs(t, err, c.category, c.name)
+		}
 		if c.fn != nil {
 			c.fn(t, err)
 		}
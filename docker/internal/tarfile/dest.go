@@ -7,17 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/imagedestination/impl"
 	"github.com/containers/image/v5/internal/imagedestination/stubs"
 	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/putblobdigest"
 	"github.com/containers/image/v5/internal/streamdigest"
+	"github.com/containers/image/v5/internal/tmpdir"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
 )
 
 // Destination is a partial implementation of private.ImageDestination for writing to an io.Writer.
@@ -49,10 +52,11 @@ func NewDestination(sys *types.SystemContext, archive *Writer, transportName str
 			AcceptsForeignLayerURLs:        false,
 			MustMatchRuntimeOS:             false,
 			IgnoresEmbeddedDockerReference: false, // N/A, we only accept schema2 images where EmbeddedDockerReferenceConflicts() is always false.
-			// The code _is_ actually thread-safe, but apart from computing sizes/digests of layers where
-			// this is unknown in advance, the actual copy is serialized by d.archive, so there probably isn’t
-			// much benefit from concurrency, mostly just extra CPU, memory and I/O contention.
-			HasThreadSafePutBlob: false,
+			// The code _is_ always thread-safe, but unless layers are spilled into temporary files,
+			// apart from computing sizes/digests of layers where this is unknown in advance, the actual copy
+			// is serialized by d.archive, so there probably isn’t much benefit from concurrency,
+			// mostly just extra CPU, memory and I/O contention.
+			HasThreadSafePutBlob: archive.concurrent,
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartialRaw(transportName),
 		NoSignaturesInitialize:     stubs.NoSignatures("Storing signatures for docker tar files is not supported"),
@@ -78,17 +82,21 @@ func (d *Destination) AddRepoTags(tags []reference.NamedTagged) {
 // to any other readers for download using the supplied digest.
 // If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
 func (d *Destination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	if d.archive.concurrent && !options.IsConfig {
+		return d.putLayerConcurrently(stream, inputInfo)
+	}
+
 	// Ouch, we need to stream the blob into a temporary file just to determine the size.
 	// When the layer is decompressed, we also have to generate the digest on uncompressed data.
 	if inputInfo.Size == -1 || inputInfo.Digest == "" {
-		logrus.Debugf("docker tarfile: input with unknown size, streaming to disk first ...")
+		logging.For(d.sysCtx).Debugf("docker tarfile: input with unknown size, streaming to disk first ...")
 		streamCopy, cleanup, err := streamdigest.ComputeBlobInfo(d.sysCtx, stream, &inputInfo)
 		if err != nil {
 			return private.UploadedBlob{}, err
 		}
 		defer cleanup()
 		stream = streamCopy
-		logrus.Debugf("... streaming done")
+		logging.For(d.sysCtx).Debugf("... streaming done")
 	}
 
 	if err := d.archive.lock(); err != nil {
@@ -106,7 +114,7 @@ func (d *Destination) PutBlobWithOptions(ctx context.Context, stream io.Reader,
 	}
 
 	if options.IsConfig {
-		buf, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		buf, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySizeFor(d.sysCtx))
 		if err != nil {
 			return private.UploadedBlob{}, fmt.Errorf("reading Config file stream: %w", err)
 		}
@@ -115,7 +123,7 @@ func (d *Destination) PutBlobWithOptions(ctx context.Context, stream io.Reader,
 		if err != nil {
 			return private.UploadedBlob{}, err
 		}
-		if err := d.archive.sendFileLocked(configPath, inputInfo.Size, bytes.NewReader(buf)); err != nil {
+		if err := d.archive.sendBlobLocked(configPath, inputInfo, bytes.NewReader(buf)); err != nil {
 			return private.UploadedBlob{}, fmt.Errorf("writing Config file: %w", err)
 		}
 	} else {
@@ -123,7 +131,7 @@ func (d *Destination) PutBlobWithOptions(ctx context.Context, stream io.Reader,
 		if err != nil {
 			return private.UploadedBlob{}, err
 		}
-		if err := d.archive.sendFileLocked(layerPath, inputInfo.Size, stream); err != nil {
+		if err := d.archive.sendBlobLocked(layerPath, inputInfo, stream); err != nil {
 			return private.UploadedBlob{}, err
 		}
 	}
@@ -131,6 +139,77 @@ func (d *Destination) PutBlobWithOptions(ctx context.Context, stream io.Reader,
 	return private.UploadedBlob{Digest: inputInfo.Digest, Size: inputInfo.Size}, nil
 }
 
+// putLayerConcurrently implements PutBlobWithOptions for layers if d.archive.concurrent:
+// it spills the layer into a temporary file, to be sent into the archive by PutManifest.
+func (d *Destination) putLayerConcurrently(stream io.Reader, inputInfo types.BlobInfo) (private.UploadedBlob, error) {
+	if inputInfo.Digest != "" {
+		// Maybe the blob has been already sent
+		if err := d.archive.lock(); err != nil {
+			return private.UploadedBlob{}, err
+		}
+		ok, reusedInfo, err := d.archive.tryReusingBlobLocked(inputInfo)
+		d.archive.unlock()
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		if ok {
+			return private.UploadedBlob{Digest: reusedInfo.Digest, Size: reusedInfo.Size}, nil
+		}
+	}
+
+	file, err := tmpdir.CreateBigFileTemp(d.sysCtx, "docker-tarfile-blob")
+	if err != nil {
+		return private.UploadedBlob{}, fmt.Errorf("creating temporary file: %w", err)
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	var verifier digest.Verifier
+	if d.archive.strict && inputInfo.Digest != "" {
+		if err := inputInfo.Digest.Validate(); err != nil { // digest.Digest.Verifier() panics on failure, so validate explicitly.
+			return private.UploadedBlob{}, fmt.Errorf("invalid digest %q: %w", inputInfo.Digest, err)
+		}
+		verifier = inputInfo.Digest.Verifier()
+		stream = io.TeeReader(stream, verifier)
+	}
+	digester, stream := putblobdigest.DigestIfUnknown(stream, inputInfo)
+	size, err := io.Copy(file, stream)
+	if err != nil {
+		return private.UploadedBlob{}, fmt.Errorf("writing to temporary file: %w", err)
+	}
+	if inputInfo.Size != -1 && size != inputInfo.Size {
+		return private.UploadedBlob{}, fmt.Errorf("Size mismatch when copying %s, expected %d, got %d", inputInfo.Digest, inputInfo.Size, size)
+	}
+	if verifier != nil && !verifier.Verified() {
+		return private.UploadedBlob{}, fmt.Errorf("Digest mismatch when copying blob, expected %s", inputInfo.Digest)
+	}
+	blobInfo := types.BlobInfo{Digest: digester.Digest(), Size: size}
+	layerPath, err := d.archive.physicalLayerPath(blobInfo.Digest)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+
+	if err := d.archive.lock(); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	defer d.archive.unlock()
+	// Another goroutine may have received the same blob in the meantime.
+	ok, reusedInfo, err := d.archive.tryReusingBlobLocked(blobInfo)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	if ok {
+		return private.UploadedBlob{Digest: reusedInfo.Digest, Size: reusedInfo.Size}, nil
+	}
+	d.archive.recordPendingBlobLocked(blobInfo, layerPath, file)
+	succeeded = true
+	return private.UploadedBlob{Digest: blobInfo.Digest, Size: blobInfo.Size}, nil
+}
+
 // TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
 // (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
 // info.Digest must not be empty.
@@ -173,6 +252,15 @@ func (d *Destination) PutManifest(ctx context.Context, m []byte, instanceDigest
 	}
 	defer d.archive.unlock()
 
+	// If layers were received concurrently, send them in a deterministic order now.
+	layerDigests := make([]digest.Digest, 0, len(man.LayersDescriptors))
+	for _, l := range man.LayersDescriptors {
+		layerDigests = append(layerDigests, l.Digest)
+	}
+	if err := d.archive.flushPendingBlobsLocked(layerDigests); err != nil {
+		return err
+	}
+
 	if err := d.archive.writeLegacyMetadataLocked(man.LayersDescriptors, d.config, d.repoTags); err != nil {
 		return err
 	}
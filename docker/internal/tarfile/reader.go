@@ -20,9 +20,18 @@ import (
 type Reader struct {
 	// None of the fields below are modified after the archive is created, until .Close();
 	// this allows concurrent readers of the same archive.
-	path          string         // "" if the archive has already been closed.
-	removeOnClose bool           // Remove file on close if true
-	Manifest      []ManifestItem // Guaranteed to exist after the archive is created.
+	path          string                   // "" if the archive has already been closed.
+	removeOnClose bool                     // Remove file on close if true
+	index         map[string]tarIndexEntry // Keyed by path.Clean()ed component path; built when the archive is created.
+	dataEnd       int64                    // Offset just past the data of the last component, i.e. where more components can be appended.
+	Manifest      []ManifestItem           // Guaranteed to exist after the archive is created.
+	maxConfigSize int                      // The maximum size of configs read by ReadManifestItemConfig and Source.
+}
+
+// tarIndexEntry records the location of a single component within the archive.
+type tarIndexEntry struct {
+	header *tar.Header // The header of the component
+	offset int64       // Offset of the component’s data within the archive file
 }
 
 // NewReaderFromFile returns a Reader for the specified path.
@@ -45,7 +54,7 @@ func NewReaderFromFile(sys *types.SystemContext, path string) (*Reader, error) {
 		defer decompressed.Close()
 		stream = decompressed
 		if !isCompressed {
-			return newReader(path, false)
+			return newReader(sys, path, false)
 		}
 	}
 	return NewReaderFromStream(sys, stream)
@@ -57,7 +66,13 @@ func NewReaderFromFile(sys *types.SystemContext, path string) (*Reader, error) {
 // The caller should call .Close() on the returned archive when done.
 func NewReaderFromStream(sys *types.SystemContext, inputStream io.Reader) (*Reader, error) {
 	// Save inputStream to a temporary file
-	tarCopyFile, err := tmpdir.CreateBigFileTemp(sys, "docker-tar")
+	var tarCopyFile *os.File
+	var err error
+	if sys != nil && sys.DockerArchiveStreamSpoolDir != "" {
+		tarCopyFile, err = os.CreateTemp(sys.DockerArchiveStreamSpoolDir, "docker-tar")
+	} else {
+		tarCopyFile, err = tmpdir.CreateBigFileTemp(sys, "docker-tar")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("creating temporary file: %w", err)
 	}
@@ -83,21 +98,32 @@ func NewReaderFromStream(sys *types.SystemContext, inputStream io.Reader) (*Read
 	//
 	// TODO: This can take quite some time, and should ideally be cancellable
 	//       using a context.Context.
-	if _, err := io.Copy(tarCopyFile, uncompressedStream); err != nil {
+	var limitedStream io.Reader = uncompressedStream
+	var maxSize int64 = -1
+	if sys != nil && sys.DockerArchiveStreamSpoolMaxSize > 0 {
+		maxSize = sys.DockerArchiveStreamSpoolMaxSize
+		limitedStream = io.LimitReader(uncompressedStream, maxSize+1)
+	}
+	size, err := io.Copy(tarCopyFile, limitedStream)
+	if err != nil {
 		return nil, fmt.Errorf("copying contents to temporary file %q: %w", tarCopyFile.Name(), err)
 	}
+	if maxSize != -1 && size > maxSize {
+		return nil, fmt.Errorf("archive exceeds the maximum size of %d bytes allowed for a temporary copy", maxSize)
+	}
 	succeeded = true
 
-	return newReader(tarCopyFile.Name(), true)
+	return newReader(sys, tarCopyFile.Name(), true)
 }
 
 // newReader creates a Reader for the specified path and removeOnClose flag.
 // The caller should call .Close() on the returned archive when done.
-func newReader(path string, removeOnClose bool) (*Reader, error) {
+func newReader(sys *types.SystemContext, path string, removeOnClose bool) (*Reader, error) {
 	// This is a valid enough archive, except Manifest is not yet filled.
 	r := Reader{
 		path:          path,
 		removeOnClose: removeOnClose,
+		maxConfigSize: iolimits.MaxConfigBodySizeFor(sys),
 	}
 	succeeded := false
 	defer func() {
@@ -106,10 +132,16 @@ func newReader(path string, removeOnClose bool) (*Reader, error) {
 		}
 	}()
 
-	// We initialize Manifest immediately when constructing the Reader instead
+	// We initialize the index and Manifest immediately when constructing the Reader instead
 	// of later on-demand because every caller will need the data, and because doing it now
 	// removes the need to synchronize the access/creation of the data if the archive is later
 	// used from multiple goroutines to access different images.
+	index, dataEnd, err := buildTarIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	r.index = index
+	r.dataEnd = dataEnd
 
 	// FIXME? Do we need to deal with the legacy format?
 	bytes, err := r.readTarComponent(manifestFileName, iolimits.MaxTarFileManifestSize)
@@ -174,19 +206,72 @@ func (r *Reader) ChooseManifestItem(ref reference.NamedTagged, sourceIndex int)
 	}
 }
 
-// tarReadCloser is a way to close the backing file of a tar.Reader when the user no longer needs the tar component.
-type tarReadCloser struct {
-	*tar.Reader
+// ReadManifestItemConfig returns the contents of the config of item, which should be an element of r.Manifest.
+// It is safe to call this method from multiple goroutines simultaneously.
+func (r *Reader) ReadManifestItemConfig(item *ManifestItem) ([]byte, error) {
+	return r.readTarComponent(item.Config, r.maxConfigSize)
+}
+
+// tarBlockSize is the size of a tar block; component data is padded to a multiple of it.
+const tarBlockSize = 512
+
+// countingReader is an io.Reader which counts the bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// buildTarIndex reads the archive at tarPath once, and returns an index of all of its components,
+// and the offset just past the data of the last component.
+// If a path occurs several times in the archive, only the last instance is recorded, consistent with
+// extracting the archive (and with docker-archive destinations which append to an existing archive).
+func buildTarIndex(tarPath string) (map[string]tarIndexEntry, int64, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer f.Close()
+
+	// archive/tar reads exactly the header blocks in Next(), so after Next() returns, the
+	// number of consumed bytes is the offset of the component’s data.
+	counter := &countingReader{reader: f}
+	t := tar.NewReader(counter)
+	index := map[string]tarIndexEntry{}
+	dataEnd := int64(0)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, -1, fmt.Errorf("indexing tar archive: %w", err)
+		}
+		index[path.Clean(h.Name)] = tarIndexEntry{header: h, offset: counter.count}
+		dataEnd = counter.count
+		if h.Typeflag == tar.TypeReg {
+			dataEnd += (h.Size + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+		}
+	}
+	return index, dataEnd, nil
+}
+
+// sectionReadCloser is a way to close the backing file of an io.SectionReader when the user no longer needs the tar component.
+type sectionReadCloser struct {
+	*io.SectionReader
 	backingFile *os.File
 }
 
-func (t *tarReadCloser) Close() error {
-	return t.backingFile.Close()
+func (s *sectionReadCloser) Close() error {
+	return s.backingFile.Close()
 }
 
 // openTarComponent returns a ReadCloser for the specific file within the archive.
-// This is linear scan; we assume that the tar file will have a fairly small amount of files (~layers),
-// and that filesystem caching will make the repeated seeking over the (uncompressed) tarPath cheap enough.
 // It is safe to call this method from multiple goroutines simultaneously.
 // The caller should call .Close() on the returned stream.
 func (r *Reader) openTarComponent(componentPath string) (io.ReadCloser, error) {
@@ -196,65 +281,33 @@ func (r *Reader) openTarComponent(componentPath string) (io.ReadCloser, error) {
 		return nil, errors.New("Internal error: trying to read an already closed tarfile.Reader")
 	}
 
-	f, err := os.Open(r.path)
-	if err != nil {
-		return nil, err
-	}
-	succeeded := false
-	defer func() {
-		if !succeeded {
-			f.Close()
-		}
-	}()
-
-	tarReader, header, err := findTarComponent(f, componentPath)
-	if err != nil {
-		return nil, err
-	}
-	if header == nil {
+	componentPath = path.Clean(componentPath)
+	entry, ok := r.index[componentPath]
+	if !ok {
 		return nil, os.ErrNotExist
 	}
-	if header.FileInfo().Mode()&os.ModeType == os.ModeSymlink { // FIXME: untested
+	if entry.header.FileInfo().Mode()&os.ModeType == os.ModeSymlink {
 		// We follow only one symlink; so no loops are possible.
-		if _, err := f.Seek(0, io.SeekStart); err != nil {
-			return nil, err
-		}
 		// The new path could easily point "outside" the archive, but we only compare it to existing tar headers without extracting the archive,
 		// so we don't care.
-		tarReader, header, err = findTarComponent(f, path.Join(path.Dir(componentPath), header.Linkname))
-		if err != nil {
-			return nil, err
-		}
-		if header == nil {
+		entry, ok = r.index[path.Join(path.Dir(componentPath), entry.header.Linkname)]
+		if !ok {
 			return nil, os.ErrNotExist
 		}
 	}
 
-	if !header.FileInfo().Mode().IsRegular() {
-		return nil, fmt.Errorf("Error reading tar archive component %q: not a regular file", header.Name)
+	if !entry.header.FileInfo().Mode().IsRegular() || entry.header.Typeflag == tar.TypeGNUSparse {
+		return nil, fmt.Errorf("Error reading tar archive component %q: not a regular file", entry.header.Name)
 	}
-	succeeded = true
-	return &tarReadCloser{Reader: tarReader, backingFile: f}, nil
-}
 
-// findTarComponent returns a header and a reader matching componentPath within inputFile,
-// or (nil, nil, nil) if not found.
-func findTarComponent(inputFile io.Reader, componentPath string) (*tar.Reader, *tar.Header, error) {
-	t := tar.NewReader(inputFile)
-	componentPath = path.Clean(componentPath)
-	for {
-		h, err := t.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, nil, err
-		}
-		if path.Clean(h.Name) == componentPath {
-			return t, h, nil
-		}
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil, nil
+	return &sectionReadCloser{
+		SectionReader: io.NewSectionReader(f, entry.offset, entry.header.Size),
+		backingFile:   f,
+	}, nil
 }
 
 // readTarComponent returns full contents of componentPath.
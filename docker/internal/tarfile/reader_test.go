@@ -0,0 +1,117 @@
+package tarfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderOpenTarComponent(t *testing.T) {
+	tarPath := filepath.Join(t.TempDir(), "archive.tar")
+	f, err := os.Create(tarPath)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	for _, c := range []struct{ name, contents string }{
+		{"first", "first contents"},
+		{"dir/second", "second contents"},
+		{manifestFileName, "[]"},
+	} {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: c.name, Size: int64(len(c.contents)), Mode: 0o444})
+		require.NoError(t, err)
+		_, err = tw.Write([]byte(c.contents))
+		require.NoError(t, err)
+	}
+	err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: "../first"})
+	require.NoError(t, err)
+	err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0o755})
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	r, err := newReader(nil, tarPath, false)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for _, c := range []struct{ path, contents string }{
+		{"first", "first contents"},
+		{"./dir/second", "second contents"},
+		{"dir/link", "first contents"},
+	} {
+		rc, err := r.openTarComponent(c.path)
+		require.NoError(t, err, c.path)
+		contents, err := io.ReadAll(rc)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, c.contents, string(contents), c.path)
+		require.NoError(t, rc.Close())
+	}
+
+	_, err = r.openTarComponent("missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = r.openTarComponent("dir")
+	assert.Error(t, err)
+}
+
+func TestNewReaderFromStreamSpool(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: manifestFileName, Size: 2, Mode: 0o444})
+	require.NoError(t, err)
+	_, err = tw.Write([]byte("[]"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	spoolDir := t.TempDir()
+	r, err := NewReaderFromStream(&types.SystemContext{
+		DockerArchiveStreamSpoolDir:     spoolDir,
+		DockerArchiveStreamSpoolMaxSize: int64(archive.Len()),
+	}, bytes.NewReader(archive.Bytes()))
+	require.NoError(t, err)
+	entries, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	require.NoError(t, r.Close())
+
+	_, err = NewReaderFromStream(&types.SystemContext{
+		DockerArchiveStreamSpoolDir:     spoolDir,
+		DockerArchiveStreamSpoolMaxSize: int64(archive.Len() - 1),
+	}, bytes.NewReader(archive.Bytes()))
+	assert.Error(t, err)
+	entries, err = os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestNewReaderFromFileCompressed(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: manifestFileName, Size: 2, Mode: 0o444})
+	require.NoError(t, err)
+	_, err = tw.Write([]byte("[]"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	for _, algo := range []compression.Algorithm{compression.Gzip, compression.Xz, compression.Zstd} {
+		archivePath := filepath.Join(t.TempDir(), "archive.tar")
+		f, err := os.Create(archivePath)
+		require.NoError(t, err, algo.Name())
+		compressor, err := compression.CompressStream(f, algo, nil)
+		require.NoError(t, err, algo.Name())
+		_, err = compressor.Write(archive.Bytes())
+		require.NoError(t, err, algo.Name())
+		require.NoError(t, compressor.Close(), algo.Name())
+		require.NoError(t, f.Close(), algo.Name())
+
+		r, err := NewReaderFromFile(&types.SystemContext{BigFilesTemporaryDir: t.TempDir()}, archivePath)
+		require.NoError(t, err, algo.Name())
+		assert.Equal(t, []ManifestItem{}, r.Manifest, algo.Name())
+		require.NoError(t, r.Close(), algo.Name())
+	}
+}
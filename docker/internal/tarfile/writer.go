@@ -8,18 +8,22 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"sync"
 	"time"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
 )
 
 // Writer allows creating a (docker save)-formatted tar archive containing one or more images.
@@ -31,22 +35,167 @@ type Writer struct {
 	tar    *tar.Writer // nil if the Writer has already been closed.
 	// Other state.
 	blobs            map[digest.Digest]types.BlobInfo // list of already-sent blobs
+	pendingBlobs     map[digest.Digest]pendingBlob    // blobs spilled into temporary files, not yet sent; only used if concurrent
 	repositories     map[string]map[string]string
 	legacyLayers     *set.Set[string] // A set of IDs of legacy layers that have been already sent.
 	manifest         []ManifestItem
 	manifestByConfig map[digest.Digest]int // A map from config digest to an entry index in manifest above.
+	// Configuration, does not change after creation.
+	strict     bool                     // Verify blob digests while writing them, and report all failures to create tar entries.
+	concurrent bool                     // Accept layers from several goroutines at once, see WriterOptions.ConcurrentBlobIngestion.
+	blobPaths  map[digest.Digest]string // Paths of blobs which were already present in an archive being appended to.
+	log        logging.Logger
+}
+
+// pendingBlob is a blob that has been received, but not yet sent into the tar stream.
+type pendingBlob struct {
+	path string   // Path within the archive
+	size int64    // Size of the blob, always known
+	file *os.File // A temporary file containing the blob; to be removed after the blob is sent
+}
+
+// WriterOptions contains options for NewWriterWithOptions.
+type WriterOptions struct {
+	// DisableStrictValidation turns off verification of blob digests while the blobs are being written
+	// into the archive. It should only be necessary for callers that can’t provide correct digests.
+	DisableStrictValidation bool
+	// ConcurrentBlobIngestion allows layers to be received from several goroutines at once: each layer is
+	// spilled into a temporary file (computing its digest and size in parallel with other layers), and the
+	// spilled layers are sent into the archive in the order of the image’s manifest when the manifest is written.
+	// This uses more disk space and I/O than writing blobs directly into the archive.
+	ConcurrentBlobIngestion bool
+	// Logger receives the debug messages of the Writer; the zero value uses the global logrus logger.
+	Logger logging.Logger
 }
 
 // NewWriter returns a Writer for the specified io.Writer.
 // The caller must eventually call .Close() on the returned object to create a valid archive.
+//
+// The returned Writer does not verify blob digests; prefer NewWriterWithOptions.
 func NewWriter(dest io.Writer) *Writer {
+	return NewWriterWithOptions(dest, WriterOptions{DisableStrictValidation: true})
+}
+
+// NewWriterWithOptions returns a Writer for the specified io.Writer, configured by options.
+// Unless options.DisableStrictValidation is set, the Writer verifies the digest of every blob as it is
+// being written, and fails the write on a mismatch.
+// The caller must eventually call .Close() on the returned object to create a valid archive.
+func NewWriterWithOptions(dest io.Writer, options WriterOptions) *Writer {
 	return &Writer{
 		writer:           dest,
 		tar:              tar.NewWriter(dest),
 		blobs:            make(map[digest.Digest]types.BlobInfo),
+		pendingBlobs:     map[digest.Digest]pendingBlob{},
 		repositories:     map[string]map[string]string{},
 		legacyLayers:     set.New[string](),
 		manifestByConfig: map[digest.Digest]int{},
+		strict:           !options.DisableStrictValidation,
+		concurrent:       options.ConcurrentBlobIngestion,
+		blobPaths:        map[digest.Digest]string{},
+		log:              options.Logger,
+	}
+}
+
+// NewWriterAppendingToFile returns a Writer which adds images to the existing uncompressed archive in file,
+// which must be open for both reading and writing.
+// Blobs already present in the archive are reused, and the images already present in the archive
+// are preserved in the rewritten manifest.json.
+// The caller must eventually call .Close() on the returned object to create a valid archive.
+func NewWriterAppendingToFile(file *os.File, options WriterOptions) (*Writer, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	algo, decompressor, _, err := compression.DetectCompressionFormat(file)
+	if err != nil {
+		return nil, fmt.Errorf("detecting compression of %q: %w", file.Name(), err)
+	}
+	if decompressor != nil {
+		return nil, fmt.Errorf("appending to a %s-compressed archive %q is not supported", algo.Name(), file.Name())
+	}
+
+	r, err := newReader(nil, file.Name(), false)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	w := NewWriterWithOptions(file, options)
+	if err := w.recordExistingContents(r); err != nil {
+		return nil, err
+	}
+	// Overwrite the end-of-archive marker, and any trailing data.
+	if err := file.Truncate(r.dataEnd); err != nil {
+		return nil, fmt.Errorf("truncating %q: %w", file.Name(), err)
+	}
+	if _, err := file.Seek(r.dataEnd, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// recordExistingContents records the images, blobs and legacy metadata present in r,
+// so that they are preserved and reused when appending to r.
+// This must only be called when creating w.
+func (w *Writer) recordExistingContents(r *Reader) error {
+	for _, item := range r.Manifest {
+		configBytes, err := r.readTarComponent(item.Config, r.maxConfigSize)
+		if err != nil {
+			return err
+		}
+		configDigest := digest.FromBytes(configBytes)
+		w.recordExistingBlob(configDigest, int64(len(configBytes)), item.Config)
+		if _, ok := w.manifestByConfig[configDigest]; !ok {
+			w.manifestByConfig[configDigest] = len(w.manifest)
+			w.manifest = append(w.manifest, item)
+		}
+
+		for _, layerPath := range item.Layers {
+			if err := w.recordExistingLayer(r, layerPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, ok := r.index[legacyRepositoriesFileName]; ok {
+		b, err := r.readTarComponent(legacyRepositoriesFileName, iolimits.MaxTarFileManifestSize)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &w.repositories); err != nil {
+			return fmt.Errorf("decoding tar %s: %w", legacyRepositoriesFileName, err)
+		}
+	}
+	for componentPath := range r.index {
+		if dir, file := path.Split(componentPath); file == legacyVersionFileName && dir != "" {
+			w.legacyLayers.Add(path.Clean(dir))
+		}
+	}
+	return nil
+}
+
+// recordExistingLayer computes the digest of the layer at layerPath in r, and records it as an existing blob.
+// This must only be called when creating w.
+func (w *Writer) recordExistingLayer(r *Reader, layerPath string) error {
+	stream, err := r.openTarComponent(layerPath)
+	if err != nil {
+		return fmt.Errorf("opening layer %q: %w", layerPath, err)
+	}
+	defer stream.Close()
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(digester.Hash(), stream)
+	if err != nil {
+		return fmt.Errorf("reading layer %q: %w", layerPath, err)
+	}
+	w.recordExistingBlob(digester.Digest(), size, layerPath)
+	return nil
+}
+
+// recordExistingBlob records a blob already present at blobPath.
+// This must only be called when creating w.
+func (w *Writer) recordExistingBlob(d digest.Digest, size int64, blobPath string) {
+	if _, ok := w.blobPaths[d]; !ok {
+		w.blobPaths[d] = blobPath
+		w.blobs[d] = types.BlobInfo{Digest: d, Size: size}
 	}
 }
 
@@ -80,6 +229,9 @@ func (w *Writer) tryReusingBlobLocked(info types.BlobInfo) (bool, private.Reused
 	if blob, ok := w.blobs[info.Digest]; ok {
 		return true, private.ReusedBlob{Digest: info.Digest, Size: blob.Size}, nil
 	}
+	if blob, ok := w.pendingBlobs[info.Digest]; ok {
+		return true, private.ReusedBlob{Digest: info.Digest, Size: blob.size}, nil
+	}
 	return false, private.ReusedBlob{}, nil
 }
 
@@ -89,6 +241,45 @@ func (w *Writer) recordBlobLocked(info types.BlobInfo) {
 	w.blobs[info.Digest] = info
 }
 
+// recordPendingBlobLocked records a blob, which must contain at least a digest and size, stored in file,
+// to be sent to path by a later flushPendingBlobsLocked. The Writer takes ownership of file.
+// The caller must have locked the Writer.
+func (w *Writer) recordPendingBlobLocked(info types.BlobInfo, path string, file *os.File) {
+	w.pendingBlobs[info.Digest] = pendingBlob{path: path, size: info.Size, file: file}
+}
+
+// flushPendingBlobsLocked sends the pending blobs among digests into the tar stream, in the order of digests.
+// Digests which don’t refer to a pending blob are ignored.
+// The caller must have locked the Writer.
+func (w *Writer) flushPendingBlobsLocked(digests []digest.Digest) error {
+	for _, d := range digests {
+		blob, ok := w.pendingBlobs[d]
+		if !ok {
+			continue
+		}
+		if _, err := blob.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("rewinding temporary file for %s: %w", blob.path, err)
+		}
+		if err := w.sendFileLocked(blob.path, blob.size, blob.file); err != nil {
+			return err
+		}
+		w.discardPendingBlobLocked(d)
+		w.recordBlobLocked(types.BlobInfo{Digest: d, Size: blob.size})
+	}
+	return nil
+}
+
+// discardPendingBlobLocked forgets about a pending blob, and removes its temporary file.
+// The caller must have locked the Writer.
+func (w *Writer) discardPendingBlobLocked(d digest.Digest) {
+	blob := w.pendingBlobs[d]
+	blob.file.Close()
+	if err := os.Remove(blob.file.Name()); err != nil {
+		w.log.Debugf("Error removing temporary file %q: %v", blob.file.Name(), err)
+	}
+	delete(w.pendingBlobs, d)
+}
+
 // ensureSingleLegacyLayerLocked writes legacy VERSION and configuration files for a single layer
 // The caller must have locked the Writer.
 func (w *Writer) ensureSingleLegacyLayerLocked(layerID string, layerDigest digest.Digest, configBytes []byte) error {
@@ -281,6 +472,19 @@ func (w *Writer) Close() error {
 		return err
 	}
 	defer w.unlock()
+	defer func() {
+		for d := range w.pendingBlobs {
+			w.discardPendingBlobLocked(d)
+		}
+	}()
+
+	// Blobs which were received but never referenced by a manifest are still recorded in the archive,
+	// as if they were written directly; sort them to keep the archive contents deterministic.
+	pending := maps.Keys(w.pendingBlobs)
+	slices.Sort(pending)
+	if err := w.flushPendingBlobsLocked(pending); err != nil {
+		return err
+	}
 
 	b, err := json.Marshal(&w.manifest)
 	if err != nil {
@@ -309,6 +513,9 @@ func (w *Writer) Close() error {
 // NOTE: This is an internal implementation detail, not a format property, and can change
 // any time.
 func (w *Writer) configPath(configDigest digest.Digest) (string, error) {
+	if p, ok := w.blobPaths[configDigest]; ok {
+		return p, nil
+	}
 	if err := configDigest.Validate(); err != nil { // digest.Digest.Encoded() panics on failure, and could possibly result in unexpected paths, so validate explicitly.
 		return "", err
 	}
@@ -320,6 +527,9 @@ func (w *Writer) configPath(configDigest digest.Digest) (string, error) {
 // NOTE: This is an internal implementation detail, not a format property, and can change
 // any time.
 func (w *Writer) physicalLayerPath(layerDigest digest.Digest) (string, error) {
+	if p, ok := w.blobPaths[layerDigest]; ok {
+		return p, nil
+	}
 	if err := layerDigest.Validate(); err != nil { // digest.Digest.Encoded() panics on failure, and could possibly result in unexpected paths, so validate explicitly.
 		return "", err
 	}
@@ -364,9 +574,9 @@ func (t *tarFI) Sys() any {
 func (w *Writer) sendSymlinkLocked(path string, target string) error {
 	hdr, err := tar.FileInfoHeader(&tarFI{path: path, size: 0, isSymlink: true}, target)
 	if err != nil {
-		return err
+		return fmt.Errorf("creating tar header for %q: %w", path, err)
 	}
-	logrus.Debugf("Sending as tar link %s -> %s", path, target)
+	w.log.Debugf("Sending as tar link %s -> %s", path, target)
 	return w.tar.WriteHeader(hdr)
 }
 
@@ -376,14 +586,34 @@ func (w *Writer) sendBytesLocked(path string, b []byte) error {
 	return w.sendFileLocked(path, int64(len(b)), bytes.NewReader(b))
 }
 
+// sendBlobLocked sends a blob with the specified digest and size into the tar stream.
+// If the Writer is strict, the contents of stream are verified to match info.Digest.
+// The caller must have locked the Writer.
+func (w *Writer) sendBlobLocked(path string, info types.BlobInfo, stream io.Reader) error {
+	if !w.strict {
+		return w.sendFileLocked(path, info.Size, stream)
+	}
+	if err := info.Digest.Validate(); err != nil { // digest.Digest.Verifier() panics on failure, so validate explicitly.
+		return fmt.Errorf("invalid digest %q of %s: %w", info.Digest, path, err)
+	}
+	verifier := info.Digest.Verifier()
+	if err := w.sendFileLocked(path, info.Size, io.TeeReader(stream, verifier)); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("Digest mismatch when copying %s, expected %s", path, info.Digest)
+	}
+	return nil
+}
+
 // sendFileLocked sends a file into the tar stream.
 // The caller must have locked the Writer.
 func (w *Writer) sendFileLocked(path string, expectedSize int64, stream io.Reader) error {
 	hdr, err := tar.FileInfoHeader(&tarFI{path: path, size: expectedSize}, "")
 	if err != nil {
-		return err
+		return fmt.Errorf("creating tar header for %q: %w", path, err)
 	}
-	logrus.Debugf("Sending as tar file %s", path)
+	w.log.Debugf("Sending as tar file %s", path)
 	if err := w.tar.WriteHeader(hdr); err != nil {
 		return err
 	}
@@ -0,0 +1,211 @@
+package tarfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterStrictValidation(t *testing.T) {
+	const blob = "blob contents"
+	for _, c := range []struct {
+		options    WriterOptions
+		digest     digest.Digest
+		shouldFail bool
+	}{
+		{WriterOptions{}, digest.FromString(blob), false},
+		{WriterOptions{}, digest.FromString("something else"), true},
+		{WriterOptions{DisableStrictValidation: true}, digest.FromString("something else"), false},
+	} {
+		var tarfileBuffer bytes.Buffer
+		writer := NewWriterWithOptions(&tarfileBuffer, c.options)
+		dest := NewDestination(nil, writer, "transport name", nil)
+		_, err := dest.PutBlob(context.Background(), strings.NewReader(blob),
+			types.BlobInfo{Digest: c.digest, Size: int64(len(blob))}, memory.New(), false)
+		if c.shouldFail {
+			assert.Error(t, err, c.digest)
+		} else {
+			assert.NoError(t, err, c.digest)
+		}
+		require.NoError(t, writer.Close())
+	}
+}
+
+func TestWriterConcurrentBlobIngestion(t *testing.T) {
+	ctx := context.Background()
+	cache := memory.New()
+	var tarfileBuffer bytes.Buffer
+	writer := NewWriterWithOptions(&tarfileBuffer, WriterOptions{ConcurrentBlobIngestion: true})
+	dest := NewDestination(&types.SystemContext{BigFilesTemporaryDir: t.TempDir()}, writer, "transport name", nil)
+	assert.True(t, dest.HasThreadSafePutBlob())
+
+	const numLayers = 10
+	layers := make([]manifest.Schema2Descriptor, numLayers)
+	var wg sync.WaitGroup
+	for i := 0; i < numLayers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			contents := fmt.Sprintf("layer %d", i)
+			info, err := dest.PutBlob(ctx, strings.NewReader(contents), types.BlobInfo{Size: -1}, cache, false)
+			assert.NoError(t, err)
+			layers[i] = manifest.Schema2Descriptor{
+				MediaType: manifest.DockerV2Schema2LayerMediaType,
+				Size:      info.Size,
+				Digest:    info.Digest,
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	configInfo, err := dest.PutBlob(ctx, strings.NewReader(`{"rootfs":{}}`), types.BlobInfo{Size: -1}, cache, true)
+	require.NoError(t, err)
+	man, err := manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+		MediaType: manifest.DockerV2Schema2ConfigMediaType,
+		Size:      configInfo.Size,
+		Digest:    configInfo.Digest,
+	}, layers).Serialize()
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, man, nil)
+	require.NoError(t, err)
+	err = writer.Close()
+	require.NoError(t, err)
+
+	// Layers must have been written in manifest order.
+	expected := []string{}
+	for _, l := range layers {
+		expected = append(expected, l.Digest.Encoded()+".tar")
+	}
+	layerFiles := []string{}
+	tr := tar.NewReader(&tarfileBuffer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if strings.HasSuffix(hdr.Name, ".tar") && hdr.Typeflag == tar.TypeReg {
+			layerFiles = append(layerFiles, hdr.Name)
+		}
+	}
+	assert.Equal(t, expected, layerFiles)
+}
+
+func TestWriterLogger(t *testing.T) {
+	var logBuffer bytes.Buffer
+	sys := &types.SystemContext{
+		BigFilesTemporaryDir: t.TempDir(),
+		Logger:               slog.New(slog.NewTextHandler(&logBuffer, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	var tarfileBuffer bytes.Buffer
+	writer := NewWriterWithOptions(&tarfileBuffer, WriterOptions{Logger: logging.For(sys)})
+	dest := NewDestination(sys, writer, "transport name", nil)
+	putTestImage(t, dest, []string{"layer"}, `{"rootfs":{}}`)
+	err := writer.Close()
+	require.NoError(t, err)
+
+	assert.Contains(t, logBuffer.String(), "Sending as tar file manifest.json")
+	assert.Contains(t, logBuffer.String(), "streaming to disk first")
+}
+
+// putTestImage writes an image consisting of layers and config into dest.
+func putTestImage(t *testing.T, dest *Destination, layers []string, config string) {
+	ctx := context.Background()
+	cache := memory.New()
+	descriptors := []manifest.Schema2Descriptor{}
+	for _, l := range layers {
+		info, err := dest.PutBlob(ctx, strings.NewReader(l), types.BlobInfo{Size: -1}, cache, false)
+		require.NoError(t, err)
+		descriptors = append(descriptors, manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2LayerMediaType,
+			Size:      info.Size,
+			Digest:    info.Digest,
+		})
+	}
+	configInfo, err := dest.PutBlob(ctx, strings.NewReader(config), types.BlobInfo{Size: -1}, cache, true)
+	require.NoError(t, err)
+	man, err := manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+		MediaType: manifest.DockerV2Schema2ConfigMediaType,
+		Size:      configInfo.Size,
+		Digest:    configInfo.Digest,
+	}, descriptors).Serialize()
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, man, nil)
+	require.NoError(t, err)
+}
+
+func TestNewWriterAppendingToFile(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "archive.tar")
+
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	writer := NewWriterWithOptions(f, WriterOptions{})
+	ref1, err := reference.ParseNormalizedNamed("example.com/first:tag")
+	require.NoError(t, err)
+	putTestImage(t, NewDestination(nil, writer, "transport name", ref1.(reference.NamedTagged)),
+		[]string{"shared layer", "first layer"}, `{"rootfs":{},"os":"first"}`)
+	require.NoError(t, writer.Close())
+	require.NoError(t, f.Close())
+
+	f, err = os.OpenFile(archivePath, os.O_RDWR, 0)
+	require.NoError(t, err)
+	writer, err = NewWriterAppendingToFile(f, WriterOptions{})
+	require.NoError(t, err)
+	ref2, err := reference.ParseNormalizedNamed("example.com/second:tag")
+	require.NoError(t, err)
+	putTestImage(t, NewDestination(nil, writer, "transport name", ref2.(reference.NamedTagged)),
+		[]string{"shared layer", "second layer"}, `{"rootfs":{},"os":"second"}`)
+	require.NoError(t, writer.Close())
+	require.NoError(t, f.Close())
+
+	reader, err := newReader(nil, archivePath, false)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Len(t, reader.Manifest, 2)
+	assert.Equal(t, []string{"example.com/first:tag"}, reader.Manifest[0].RepoTags)
+	assert.Equal(t, []string{"example.com/second:tag"}, reader.Manifest[1].RepoTags)
+	assert.Equal(t, reader.Manifest[0].Layers[0], reader.Manifest[1].Layers[0])
+	for i, expected := range []string{"first", "second"} {
+		config, err := reader.readTarComponent(reader.Manifest[i].Config, 1024)
+		require.NoError(t, err)
+		assert.Contains(t, string(config), expected)
+		layer, err := reader.readTarComponent(reader.Manifest[i].Layers[1], 1024)
+		require.NoError(t, err)
+		assert.Equal(t, expected+" layer", string(layer))
+	}
+
+	// The shared layer must have been stored only once.
+	f, err = os.Open(archivePath)
+	require.NoError(t, err)
+	defer f.Close()
+	occurrences := 0
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Name == reader.Manifest[0].Layers[0] {
+			occurrences++
+		}
+	}
+	assert.Equal(t, 1, occurrences)
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+)
+
+// memoryManifestCache is an in-memory implementation of types.DockerManifestCache.
+type memoryManifestCache struct {
+	mutex     sync.Mutex
+	manifests map[string]memoryManifestCacheEntry
+}
+
+type memoryManifestCacheEntry struct {
+	manifest []byte
+	mimeType string
+	etag     string
+}
+
+// NewManifestCache returns an in-memory types.DockerManifestCache, which can be used by setting it as SystemContext.DockerManifestCache.
+// The cache is not bounded in size; it is intended to be used for a limited set of images, e.g. by a single long-running operation.
+func NewManifestCache() types.DockerManifestCache {
+	return &memoryManifestCache{
+		manifests: map[string]memoryManifestCacheEntry{},
+	}
+}
+
+// Get returns the manifest, its MIME type and its ETag stored for key, and true, if it exists.
+func (c *memoryManifestCache) Get(key string) ([]byte, string, string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.manifests[key]
+	if !ok {
+		return nil, "", "", false
+	}
+	return entry.manifest, entry.mimeType, entry.etag, true
+}
+
+// Put stores manifest with mimeType and etag for key.
+func (c *memoryManifestCache) Put(key string, manifest []byte, mimeType string, etag string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.manifests[key] = memoryManifestCacheEntry{manifest: manifest, mimeType: mimeType, etag: etag}
+}
+
+// manifestCacheKey returns a key for the manifest for (the repo of ref) + tagOrDigest read by c.
+// Note that the key does not identify the credentials: a cached manifest is only used after the registry
+// has confirmed, using the credentials of c, that it has not changed.
+func (c *dockerClient) manifestCacheKey(ref dockerReference, tagOrDigest string) string {
+	return strings.Join([]string{c.registry, reference.Path(ref.ref), tagOrDigest}, "\x00")
+}
@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryManifestCache(t *testing.T) {
+	cache := NewManifestCache()
+	_, _, _, ok := cache.Get("key")
+	assert.False(t, ok)
+	cache.Put("key", []byte("manifest"), "mime type", `"etag"`)
+	m, mimeType, etag, ok := cache.Get("key")
+	require.True(t, ok)
+	assert.Equal(t, []byte("manifest"), m)
+	assert.Equal(t, "mime type", mimeType)
+	assert.Equal(t, `"etag"`, etag)
+}
+
+func TestFetchManifestWithCache(t *testing.T) {
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`)
+	etag := `"v1"`
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/tag":
+			if req.Header.Get("If-None-Match") == etag {
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads++
+			rw.Header().Set("Content-Type", imgspecv1.MediaTypeImageIndex)
+			rw.Header().Set("ETag", etag)
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write(manifestBlob)
+			require.NoError(t, err)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+		DockerManifestCache:         NewManifestCache(),
+	}
+	ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+	require.NoError(t, err)
+
+	for i, expectedDownloads := range []int{1, 1, 2} {
+		if i == 2 {
+			etag = `"v2"` // The manifest has changed
+		}
+		src, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		m, mimeType, err := src.GetManifest(context.Background(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, manifestBlob, m)
+		assert.Equal(t, imgspecv1.MediaTypeImageIndex, mimeType)
+		assert.Equal(t, expectedDownloads, downloads)
+		require.NoError(t, src.Close())
+	}
+}
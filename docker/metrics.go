@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"io"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// metricLabels returns labels for a metric about c, with direction if not "".
+func (c *dockerClient) metricLabels(direction string) map[string]string {
+	labels := map[string]string{types.MetricLabelRegistry: c.registry}
+	if direction != "" {
+		labels[types.MetricLabelDirection] = direction
+	}
+	return labels
+}
+
+// metricsEnabled returns true if c should report metrics.
+func (c *dockerClient) metricsEnabled() bool {
+	return c.sys != nil && c.sys.MetricsSink != nil
+}
+
+// addToCounter adds value to the counter name, labeled with c.registry and direction (if not ""), if c reports metrics.
+func (c *dockerClient) addToCounter(name, direction string, value float64) {
+	if c.metricsEnabled() {
+		c.sys.MetricsSink.AddToCounter(name, c.metricLabels(direction), value)
+	}
+}
+
+// reportBlobTransfer reports a transfer of size bytes in direction, which started at start, if c reports metrics.
+func (c *dockerClient) reportBlobTransfer(direction string, size int64, start time.Time) {
+	if c.metricsEnabled() {
+		c.sys.MetricsSink.AddToCounter(types.MetricBytesTransferred, c.metricLabels(direction), float64(size))
+		c.sys.MetricsSink.ObserveHistogram(types.MetricBlobDuration, c.metricLabels(direction), time.Since(start).Seconds())
+	}
+}
+
+// metricsReader is an io.ReadCloser which reports the pull of a blob when it is closed.
+type metricsReader struct {
+	io.ReadCloser
+	c      *dockerClient
+	start  time.Time
+	size   int64
+	closed bool
+}
+
+// newMetricsReader returns stream, counting the data read from it if c reports metrics.
+func newMetricsReader(c *dockerClient, stream io.ReadCloser, start time.Time) io.ReadCloser {
+	if !c.metricsEnabled() {
+		return stream
+	}
+	return &metricsReader{ReadCloser: stream, c: c, start: start}
+}
+
+func (r *metricsReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *metricsReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.c.reportBlobTransfer(types.MetricDirectionPull, r.size, r.start)
+	}
+	return r.ReadCloser.Close()
+}
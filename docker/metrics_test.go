@@ -0,0 +1,97 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMetricsSink is a types.MetricsSink which records all reported values.
+type recordingMetricsSink struct {
+	mutex      sync.Mutex
+	counters   map[string]float64
+	histograms map[string][]float64
+}
+
+// metricKey returns a key identifying name with labels, for recordingMetricsSink.
+func metricKey(name string, labels map[string]string) string {
+	key := name
+	for _, label := range []string{types.MetricLabelRegistry, types.MetricLabelDirection} {
+		if v, ok := labels[label]; ok {
+			key += "," + label + "=" + v
+		}
+	}
+	return key
+}
+
+func (s *recordingMetricsSink) AddToCounter(name string, labels map[string]string, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counters[metricKey(name, labels)] += value
+}
+
+func (s *recordingMetricsSink) ObserveHistogram(name string, labels map[string]string, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := metricKey(name, labels)
+	s.histograms[key] = append(s.histograms[key], value)
+}
+
+func TestMetrics(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+	requestURL, err := url.Parse(s.URL + "/v2/")
+	require.NoError(t, err)
+
+	sink := &recordingMetricsSink{counters: map[string]float64{}, histograms: map[string][]float64{}}
+	client, err := newDockerClient(&types.SystemContext{
+		MetricsSink:                 sink,
+		DockerRegistryMaxRetries:    2,
+		DockerRegistryMaxRetryDelay: time.Millisecond,
+	}, "registry.example", "registry.example")
+	require.NoError(t, err)
+	client.client = &http.Client{}
+
+	// Retries
+	res, err := client.makeRequestToResolvedURL(context.Background(), http.MethodGet, requestURL, nil, nil, -1, noAuth, nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, float64(2), sink.counters["containers_image_request_retries_total,registry=registry.example"])
+
+	// Authentication failures
+	status = http.StatusUnauthorized
+	res, err = client.makeRequestToResolvedURL(context.Background(), http.MethodGet, requestURL, nil, nil, -1, v2Auth, nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, float64(1), sink.counters["containers_image_auth_failures_total,registry=registry.example"])
+
+	// Pulled data
+	stream := newMetricsReader(client, io.NopCloser(strings.NewReader("some data")), time.Now())
+	data, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("some data"), data)
+	require.NoError(t, stream.Close())
+	require.NoError(t, stream.Close()) // Only reported once
+	assert.Equal(t, float64(len("some data")), sink.counters["containers_image_blob_bytes_total,registry=registry.example,direction=pull"])
+	assert.Len(t, sink.histograms["containers_image_blob_duration_seconds,registry=registry.example,direction=pull"], 1)
+
+	// Without a sink, nothing is counted.
+	client, err = newDockerClient(&types.SystemContext{}, "registry.example", "registry.example")
+	require.NoError(t, err)
+	reader := io.NopCloser(strings.NewReader("some data"))
+	assert.Equal(t, reader, newMetricsReader(client, reader, time.Now()))
+}
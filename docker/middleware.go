@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// wrapRegistryTransport returns rt wrapped per c.sys.DockerRequestCallback and c.sys.DockerRegistryMiddleware, if any.
+func (c *dockerClient) wrapRegistryTransport(rt http.RoundTripper) http.RoundTripper {
+	if c.sys == nil || (c.sys.DockerRequestCallback == nil && len(c.sys.DockerRegistryMiddleware) == 0) {
+		return rt
+	}
+	res := rt
+	if c.sys.DockerRequestCallback != nil {
+		res = &observingRoundTripper{rt: res, registry: c.registry, callback: c.sys.DockerRequestCallback}
+	}
+	for i := len(c.sys.DockerRegistryMiddleware) - 1; i >= 0; i-- {
+		res = c.sys.DockerRegistryMiddleware[i](res)
+	}
+	return &middlewareRoundTripper{RoundTripper: res, base: rt}
+}
+
+// middlewareRoundTripper is a http.RoundTripper wrapped by caller-provided middleware, which can still close
+// idle connections of the underlying http.RoundTripper, even if the middleware does not support that.
+type middlewareRoundTripper struct {
+	http.RoundTripper
+	base http.RoundTripper
+}
+
+// CloseIdleConnections calls the CloseIdleConnections method of the underlying http.RoundTripper, if any,
+// so that http.Client.CloseIdleConnections works.
+func (rt *middlewareRoundTripper) CloseIdleConnections() {
+	if c, ok := rt.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// observingRoundTripper is a http.RoundTripper which reports every request to a types.SystemContext.DockerRequestCallback.
+type observingRoundTripper struct {
+	rt       http.RoundTripper
+	registry string
+	callback func(types.DockerRequestInfo)
+}
+
+func (rt *observingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := rt.rt.RoundTrip(req)
+	info := types.DockerRequestInfo{
+		Registry: rt.registry,
+		Method:   req.Method,
+		URL:      req.URL.Redacted(),
+		Err:      err,
+		Duration: time.Since(start),
+	}
+	if err == nil {
+		info.StatusCode = res.StatusCode
+	}
+	rt.callback(info)
+	return res, err
+}
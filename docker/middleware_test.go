@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTripperFunc is a http.RoundTripper implemented by a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRegistryMiddleware(t *testing.T) {
+	var receivedHeaders []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = append(receivedHeaders, r.Header.Get("X-Test"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer s.Close()
+	requestURL, err := url.Parse(s.URL + "/v2/")
+	require.NoError(t, err)
+
+	var (
+		mutex     sync.Mutex
+		calls     []string
+		infos     []types.DockerRequestInfo
+		setHeader = func(value string) func(http.RoundTripper) http.RoundTripper {
+			return func(next http.RoundTripper) http.RoundTripper {
+				return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					mutex.Lock()
+					calls = append(calls, value)
+					mutex.Unlock()
+					req = req.Clone(req.Context())
+					req.Header.Set("X-Test", value) // Only the innermost value is sent
+					return next.RoundTrip(req)
+				})
+			}
+		}
+	)
+	client, err := newDockerClient(&types.SystemContext{
+		DockerRegistryMiddleware: []func(http.RoundTripper) http.RoundTripper{setHeader("outer"), setHeader("inner")},
+		DockerRequestCallback: func(info types.DockerRequestInfo) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			infos = append(infos, info)
+		},
+	}, "registry.example", "registry.example")
+	require.NoError(t, err)
+	client.client = &http.Client{Transport: client.wrapRegistryTransport(http.DefaultTransport)}
+	res, err := client.makeRequestToResolvedURL(context.Background(), http.MethodGet, requestURL, nil, nil, -1, noAuth, nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.Equal(t, []string{"outer", "inner"}, calls)
+	assert.Equal(t, []string{"inner"}, receivedHeaders)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "registry.example", infos[0].Registry)
+	assert.Equal(t, http.MethodGet, infos[0].Method)
+	assert.Equal(t, requestURL.String(), infos[0].URL)
+	assert.Equal(t, http.StatusAccepted, infos[0].StatusCode)
+	assert.NoError(t, infos[0].Err)
+
+	// Failed requests are reported as well.
+	infos = nil
+	failingURL, err := url.Parse("http://127.0.0.1:0/v2/")
+	require.NoError(t, err)
+	_, err = client.makeRequestToResolvedURL(context.Background(), http.MethodGet, failingURL, nil, nil, -1, noAuth, nil)
+	require.Error(t, err)
+	require.NotEmpty(t, infos)
+	assert.Equal(t, 0, infos[0].StatusCode)
+	assert.Error(t, infos[0].Err)
+
+	// Closing idle connections works even if the middleware does not support it.
+	client.Close()
+
+	// Without any configuration, the transport is not modified.
+	client, err = newDockerClient(&types.SystemContext{}, "registry.example", "registry.example")
+	require.NoError(t, err)
+	assert.Equal(t, http.DefaultTransport, client.wrapRegistryTransport(http.DefaultTransport))
+}
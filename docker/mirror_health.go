@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+// mirrorFailureTTL is the time for which a mirror that has failed is skipped by later pulls in this process.
+const mirrorFailureTTL = 5 * time.Minute
+
+// endpointHealth tracks pull endpoints which have recently failed.
+type endpointHealth struct {
+	mutex    sync.Mutex
+	failures map[string]time.Time // Endpoint location -> time of the most recent failure
+}
+
+// pullEndpointHealth is the process-wide record of failed pull endpoints.
+var pullEndpointHealth = &endpointHealth{failures: map[string]time.Time{}}
+
+// recordFailure records that endpoint has failed, if err indicates that the endpoint is not healthy
+// (as opposed to, e.g., just not containing the requested image).
+func (h *endpointHealth) recordFailure(log logging.Logger, endpoint string, err error) {
+	if !isEndpointFailure(err) {
+		return
+	}
+	log.Debugf("Marking endpoint %q as failed: %v", endpoint, err)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.failures[endpoint] = time.Now()
+}
+
+// recordSuccess records that endpoint has successfully served a request.
+func (h *endpointHealth) recordSuccess(endpoint string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.failures, endpoint)
+}
+
+// recentlyFailed returns true if endpoint has failed within mirrorFailureTTL.
+func (h *endpointHealth) recentlyFailed(endpoint string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	failed, ok := h.failures[endpoint]
+	if !ok {
+		return false
+	}
+	if time.Since(failed) > mirrorFailureTTL {
+		delete(h.failures, endpoint)
+		return false
+	}
+	return true
+}
+
+// orderPullSources returns pullSources, omitting mirrors which have recently failed.
+// The primary endpoint, which is always the last element of pullSources, is never omitted.
+func (h *endpointHealth) orderPullSources(log logging.Logger, pullSources []sysregistriesv2.PullSource) []sysregistriesv2.PullSource {
+	res := make([]sysregistriesv2.PullSource, 0, len(pullSources))
+	for i, pullSource := range pullSources {
+		if i != len(pullSources)-1 && h.recentlyFailed(pullSource.Endpoint.Location) {
+			log.Debugf("Skipping %q, its endpoint has recently failed", pullSource.Reference)
+			continue
+		}
+		res = append(res, pullSource)
+	}
+	return res
+}
+
+// isEndpointFailure returns true if err suggests that the endpoint is unavailable or unhealthy.
+func isEndpointFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrTooManyRequests) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var statusErr *unexpectedHTTPStatusError // Returned for 5xx responses
+	if errors.As(err, &statusErr) {
+		return true
+	}
+	var responseErr *unexpectedHTTPResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	var ec errcode.ErrorCoder
+	if errors.As(err, &ec) && ec.ErrorCode() == errcode.ErrorCodeTooManyRequests {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointHealthOrderPullSources(t *testing.T) {
+	h := &endpointHealth{failures: map[string]time.Time{}}
+	sources := []sysregistriesv2.PullSource{
+		{Endpoint: sysregistriesv2.Endpoint{Location: "mirror1.example.com"}},
+		{Endpoint: sysregistriesv2.Endpoint{Location: "mirror2.example.com"}},
+		{Endpoint: sysregistriesv2.Endpoint{Location: "primary.example.com"}},
+	}
+	locations := func(sources []sysregistriesv2.PullSource) []string {
+		res := []string{}
+		for _, s := range sources {
+			res = append(res, s.Endpoint.Location)
+		}
+		return res
+	}
+	assert.Equal(t, []string{"mirror1.example.com", "mirror2.example.com", "primary.example.com"}, locations(h.orderPullSources(logging.Logger{}, sources)))
+
+	unhealthy := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	h.recordFailure(logging.Logger{}, "mirror1.example.com", unhealthy)
+	h.recordFailure(logging.Logger{}, "primary.example.com", unhealthy)
+	assert.Equal(t, []string{"mirror2.example.com", "primary.example.com"}, locations(h.orderPullSources(logging.Logger{}, sources)))
+
+	// Errors which do not indicate an unhealthy endpoint are ignored
+	h.recordFailure(logging.Logger{}, "mirror2.example.com", errcode.ErrorCodeDenied)
+	assert.Equal(t, []string{"mirror2.example.com", "primary.example.com"}, locations(h.orderPullSources(logging.Logger{}, sources)))
+
+	h.recordSuccess("mirror1.example.com")
+	assert.Equal(t, []string{"mirror1.example.com", "mirror2.example.com", "primary.example.com"}, locations(h.orderPullSources(logging.Logger{}, sources)))
+
+	// Failures expire
+	h.failures["mirror1.example.com"] = time.Now().Add(-2 * mirrorFailureTTL)
+	assert.False(t, h.recentlyFailed("mirror1.example.com"))
+	assert.NotContains(t, h.failures, "mirror1.example.com")
+}
+
+func TestIsEndpointFailure(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+		{ErrTooManyRequests, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{fmt.Errorf("pinging container registry: %w", &unexpectedHTTPStatusError{Status: "503 Service Unavailable"}), true},
+		{&unexpectedHTTPResponseError{ParseErr: errNoErrorsInBody, StatusCode: http.StatusTooManyRequests}, true},
+		{&unexpectedHTTPResponseError{ParseErr: errNoErrorsInBody, StatusCode: http.StatusNotFound}, false},
+		{errcode.ErrorCodeTooManyRequests.WithMessage("slow down"), true},
+		{errcode.ErrorCodeDenied.WithMessage("denied"), false},
+		{ErrUnauthorizedForCredentials{Err: errors.New("denied")}, false},
+	} {
+		assert.Equal(t, c.expected, isEndpointFailure(c.err), fmt.Sprintf("%v", c.err))
+	}
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// reportRateLimit calls c.sys.DockerRateLimitCallback, if any, if res contains rate limit headers.
+func (c *dockerClient) reportRateLimit(res *http.Response) {
+	if c.sys == nil || c.sys.DockerRateLimitCallback == nil {
+		return
+	}
+	rl, ok := parseRateLimitHeaders(res.Header)
+	if !ok {
+		return
+	}
+	rl.Registry = c.registry
+	c.sys.DockerRateLimitCallback(rl)
+}
+
+// parseRateLimitHeaders returns the rate limit state reported in header, and true if header contains any rate limit headers.
+//
+// This recognizes the headers used by Docker Hub (RateLimit-Limit: 100;w=21600, RateLimit-Remaining: 76;w=21600,
+// Docker-RateLimit-Source: …), and the headers of the IETF RateLimit header fields drafts:
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy, or a combined RateLimit: limit=…, remaining=…, reset=….
+// Malformed values are ignored.
+func parseRateLimitHeaders(header http.Header) (types.DockerRateLimit, bool) {
+	res := types.DockerRateLimit{Limit: -1, Remaining: -1}
+	found := false
+	if n, window, ok := parseRateLimitQuota(header.Get("RateLimit-Limit")); ok {
+		res.Limit = n
+		res.Window = window
+		found = true
+	}
+	if n, window, ok := parseRateLimitQuota(header.Get("RateLimit-Remaining")); ok {
+		res.Remaining = n
+		if res.Window == 0 {
+			res.Window = window
+		}
+		found = true
+	}
+	if seconds, ok := parseRateLimitInt(header.Get("RateLimit-Reset")); ok {
+		res.Reset = time.Duration(seconds) * time.Second
+		found = true
+	}
+	if combined := header.Get("RateLimit"); combined != "" {
+		for _, item := range strings.Split(combined, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				continue
+			}
+			n, ok := parseRateLimitInt(value)
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(key) {
+			case "limit":
+				res.Limit = n
+			case "remaining":
+				res.Remaining = n
+			case "reset":
+				res.Reset = time.Duration(n) * time.Second
+			default:
+				continue
+			}
+			found = true
+		}
+	}
+	if n, window, ok := parseRateLimitQuota(header.Get("RateLimit-Policy")); ok {
+		if res.Limit == -1 {
+			res.Limit = n
+		}
+		if res.Window == 0 {
+			res.Window = window
+		}
+		found = true
+	}
+	if found {
+		res.Source = header.Get("Docker-RateLimit-Source")
+	}
+	return res, found
+}
+
+// parseRateLimitQuota parses a quota value like "100" or "100;w=21600", as used in RateLimit-Limit and similar headers.
+// If the value is a list of quota policies ("10, 10;w=1, 50;w=60"), only the first one is used.
+// It returns the quota, the window (0 if not specified), and true if value was valid.
+func parseRateLimitQuota(value string) (int, time.Duration, bool) {
+	value, _, _ = strings.Cut(value, ",")
+	quota, params, _ := strings.Cut(value, ";")
+	n, ok := parseRateLimitInt(quota)
+	if !ok {
+		return 0, 0, false
+	}
+	var window time.Duration
+	for _, param := range strings.Split(params, ";") {
+		key, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.ToLower(key) == "w" {
+			if seconds, ok := parseRateLimitInt(v); ok {
+				window = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return n, window, true
+}
+
+// parseRateLimitInt parses a non-negative integer in a rate limit header.
+func parseRateLimitInt(value string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		headers  map[string]string
+		expected *types.DockerRateLimit
+	}{
+		{"no headers", map[string]string{}, nil},
+		{"unrelated headers", map[string]string{"Content-Type": "application/json"}, nil},
+		{"malformed", map[string]string{"RateLimit-Limit": "many", "RateLimit-Remaining": "-1"}, nil},
+		{
+			"Docker Hub",
+			map[string]string{
+				"Ratelimit-Limit":         "100;w=21600",
+				"Ratelimit-Remaining":     "76;w=21600",
+				"Docker-Ratelimit-Source": "192.0.2.1",
+			},
+			&types.DockerRateLimit{Limit: 100, Remaining: 76, Window: 6 * time.Hour, Source: "192.0.2.1"},
+		},
+		{
+			"separate IETF headers",
+			map[string]string{
+				"RateLimit-Limit":     "10, 10;w=1, 50;w=60",
+				"RateLimit-Remaining": "5",
+				"RateLimit-Reset":     "30",
+			},
+			&types.DockerRateLimit{Limit: 10, Remaining: 5, Reset: 30 * time.Second},
+		},
+		{
+			"combined IETF header",
+			map[string]string{
+				"RateLimit":        "limit=10, remaining=0, reset=7",
+				"RateLimit-Policy": "10;w=60",
+			},
+			&types.DockerRateLimit{Limit: 10, Remaining: 0, Window: time.Minute, Reset: 7 * time.Second},
+		},
+		{
+			"remaining only",
+			map[string]string{"RateLimit-Remaining": "3"},
+			&types.DockerRateLimit{Limit: -1, Remaining: 3},
+		},
+	} {
+		header := http.Header{}
+		for k, v := range c.headers {
+			header.Set(k, v)
+		}
+		res, ok := parseRateLimitHeaders(header)
+		if c.expected == nil {
+			assert.False(t, ok, c.name)
+		} else {
+			assert.True(t, ok, c.name)
+			assert.Equal(t, *c.expected, res, c.name)
+		}
+	}
+}
+
+func TestDockerClientReportRateLimit(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	res.Header.Set("RateLimit-Limit", "100;w=21600")
+	res.Header.Set("RateLimit-Remaining", "0;w=21600")
+
+	// No callback
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		c := &dockerClient{sys: sys, registry: "registry.example"}
+		c.reportRateLimit(res) // Does not crash
+	}
+
+	var reported []types.DockerRateLimit
+	c := &dockerClient{
+		sys: &types.SystemContext{DockerRateLimitCallback: func(rl types.DockerRateLimit) {
+			reported = append(reported, rl)
+		}},
+		registry: "registry.example",
+	}
+	c.reportRateLimit(&http.Response{Header: http.Header{}})
+	assert.Empty(t, reported)
+	c.reportRateLimit(res)
+	assert.Equal(t, []types.DockerRateLimit{
+		{Registry: "registry.example", Limit: 100, Remaining: 0, Window: 6 * time.Hour},
+	}, reported)
+}
@@ -0,0 +1,282 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// errReferrersAPINotSupported is returned by getReferrersPage if the registry does not support the referrers API.
+var errReferrersAPINotSupported = errors.New("referrers API not supported")
+
+// ListReferrers returns descriptors of manifests in the repository of ref which refer to the manifest with digest subject
+// using their "subject" field, e.g. signatures, SBOMs or attestations.
+// If artifactType is not "", only manifests with that artifact type are returned.
+// The OCI referrers API is used if the registry supports it; otherwise, the referrers list maintained
+// by clients using the fallback tag schema is read.
+// The tag or digest provided inside the ImageReference is ignored; the referring manifests can be read
+// by using a reference to the same repository with the returned digests.
+func ListReferrers(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, subject digest.Digest, artifactType string) ([]imgspecv1.Descriptor, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return nil, errors.New("ref must be a dockerReference")
+	}
+
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newDockerClientFromRef(sys, dr, registryConfig, false, "pull")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer client.Close()
+
+	return client.getReferrers(ctx, dr, subject, artifactType)
+}
+
+// ListCosignAttachments returns the tags in the repository of ref which contain cosign attachments of the manifest
+// with digest subject, using the "sha256-<hex>.<suffix>" tag schema, for each of suffixes
+// (e.g. "att" for attestations, or "sbom" for SBOMs).
+// The tag or digest provided inside the ImageReference is ignored.
+func ListCosignAttachments(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, subject digest.Digest, suffixes []string) ([]string, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return nil, errors.New("ref must be a dockerReference")
+	}
+	subjectTag, err := referrersTagSchemaTag(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newDockerClientFromRef(sys, dr, registryConfig, false, "pull")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer client.Close()
+
+	res := []string{}
+	for _, suffix := range suffixes {
+		tag := subjectTag + "." + suffix
+		if _, err := reference.WithTag(reference.TrimNamed(dr.ref), tag); err != nil {
+			return nil, fmt.Errorf("invalid cosign attachment suffix %q: %w", suffix, err)
+		}
+		if _, _, err := client.fetchManifest(ctx, dr, tag); err != nil {
+			if isManifestUnknownError(err) {
+				continue
+			}
+			return nil, err
+		}
+		res = append(res, tag)
+	}
+	return res, nil
+}
+
+// getReferrers returns descriptors of manifests in the repository of ref which refer to subject,
+// optionally limited to artifactType.
+func (c *dockerClient) getReferrers(ctx context.Context, ref dockerReference, subject digest.Digest, artifactType string) ([]imgspecv1.Descriptor, error) {
+	if err := subject.Validate(); err != nil { // Make sure subject.String() does not contain any unexpected characters
+		return nil, err
+	}
+	path := fmt.Sprintf(referrersPath, reference.Path(ref.ref), subject.String())
+	if artifactType != "" {
+		path += "?" + url.Values{"artifactType": {artifactType}}.Encode()
+	}
+
+	res := []imgspecv1.Descriptor{}
+	for path != "" {
+		descriptors, next, err := c.getReferrersPage(ctx, ref, path, artifactType)
+		if err != nil {
+			if errors.Is(err, errReferrersAPINotSupported) && len(res) == 0 {
+				c.log.Debugf("Referrers API not supported for %s, falling back to the tag schema", ref.ref.Name())
+				index, err := c.getReferrersTagSchemaIndex(ctx, ref, subject)
+				if err != nil {
+					return nil, err
+				}
+				return filterReferrers(index.Manifests, artifactType), nil
+			}
+			return nil, err
+		}
+		res = append(res, descriptors...)
+		path = next
+	}
+	return res, nil
+}
+
+// getReferrersPage reads a single page of referrers using the referrers API at path, filtering it by artifactType
+// if the registry did not do so.  It returns the path for the next page, or "" if there is none.
+func (c *dockerClient) getReferrersPage(ctx context.Context, ref dockerReference, path string, artifactType string) ([]imgspecv1.Descriptor, string, error) {
+	headers := map[string][]string{
+		"Accept": {imgspecv1.MediaTypeImageIndex},
+	}
+	res, err := c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, "", errReferrersAPINotSupported
+	default:
+		return nil, "", fmt.Errorf("listing referrers in %s: %w", ref.ref.Name(), registryHTTPResponseToError(c.log, res))
+	}
+
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySizeFor(c.sys))
+	if err != nil {
+		return nil, "", err
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, "", fmt.Errorf("parsing referrers list in %s: %w", ref.ref.Name(), err)
+	}
+	descriptors := index.Manifests
+	if artifactType != "" && !slices.Contains(strings.Split(res.Header.Get("OCI-Filters-Applied"), ","), "artifactType") {
+		descriptors = filterReferrers(descriptors, artifactType)
+	}
+
+	next := ""
+	if link := res.Header.Get("Link"); link != "" {
+		next, err = nextPagePath(link)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return descriptors, next, nil
+}
+
+// getReferrersTagSchemaIndex returns the index stored for subject in the repository of ref using the fallback tag schema,
+// or an empty index if there is none.
+func (c *dockerClient) getReferrersTagSchemaIndex(ctx context.Context, ref dockerReference, subject digest.Digest) (*imgspecv1.Index, error) {
+	tag, err := referrersTagSchemaTag(subject)
+	if err != nil {
+		return nil, err
+	}
+	index := &imgspecv1.Index{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{},
+	}
+	manifestBlob, mimeType, err := c.fetchManifest(ctx, ref, tag)
+	if err != nil {
+		if isManifestUnknownError(err) {
+			c.log.Debugf("Fetching referrers index failed, assuming it does not exist: %v", err)
+			return index, nil
+		}
+		return nil, err
+	}
+	if mimeType != imgspecv1.MediaTypeImageIndex {
+		return nil, fmt.Errorf("unexpected MIME type for referrers index %s in %s: %q", tag, ref.ref.Name(), mimeType)
+	}
+	if err := json.Unmarshal(manifestBlob, index); err != nil {
+		return nil, fmt.Errorf("parsing referrers index %s in %s: %w", tag, ref.ref.Name(), err)
+	}
+	return index, nil
+}
+
+// filterReferrers returns the descriptors with artifactType, or all descriptors if artifactType is "".
+func filterReferrers(descriptors []imgspecv1.Descriptor, artifactType string) []imgspecv1.Descriptor {
+	if artifactType == "" {
+		return descriptors
+	}
+	res := []imgspecv1.Descriptor{}
+	for _, d := range descriptors {
+		if d.ArtifactType == artifactType {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// referrersTagSchemaTag returns the tag used to store the referrers of d by registries which don’t support the referrers API.
+func referrersTagSchemaTag(d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil { // Make sure d.String() doesn’t contain any unexpected characters
+		return "", err
+	}
+	return strings.Replace(d.String(), ":", "-", 1), nil
+}
+
+// referrerDescriptor returns a descriptor of manifest m with mimeType, suitable for a referrers list,
+// and the digest of its subject, or "" if m has no subject.
+func referrerDescriptor(m []byte, mimeType string) (imgspecv1.Descriptor, digest.Digest, error) {
+	if mimeType != imgspecv1.MediaTypeImageManifest && mimeType != imgspecv1.MediaTypeImageIndex {
+		return imgspecv1.Descriptor{}, "", nil
+	}
+	var parsed struct {
+		ArtifactType string                `json:"artifactType,omitempty"`
+		Config       *imgspecv1.Descriptor `json:"config,omitempty"`
+		Subject      *imgspecv1.Descriptor `json:"subject,omitempty"`
+		Annotations  map[string]string     `json:"annotations,omitempty"`
+	}
+	if err := json.Unmarshal(m, &parsed); err != nil {
+		return imgspecv1.Descriptor{}, "", err
+	}
+	if parsed.Subject == nil {
+		return imgspecv1.Descriptor{}, "", nil
+	}
+	artifactType := parsed.ArtifactType
+	if artifactType == "" && parsed.Config != nil {
+		artifactType = parsed.Config.MediaType
+	}
+	manifestDigest, err := manifest.Digest(m)
+	if err != nil {
+		return imgspecv1.Descriptor{}, "", err
+	}
+	return imgspecv1.Descriptor{
+		MediaType:    mimeType,
+		ArtifactType: artifactType,
+		Digest:       manifestDigest,
+		Size:         int64(len(m)),
+		Annotations:  parsed.Annotations,
+	}, parsed.Subject.Digest, nil
+}
+
+// updateReferrersTagSchema adds manifest m, if it has a subject, to the referrers list of the subject stored using
+// the fallback tag schema, for registries which don’t support the referrers API.
+// Note that concurrent updates of the same referrers list by other clients may be lost.
+func (d *dockerImageDestination) updateReferrersTagSchema(ctx context.Context, m []byte, mimeType string) error {
+	desc, subject, err := referrerDescriptor(m, mimeType)
+	if err != nil {
+		return fmt.Errorf("parsing manifest subject: %w", err)
+	}
+	if subject == "" {
+		return nil
+	}
+	index, err := d.c.getReferrersTagSchemaIndex(ctx, d.ref, subject)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(index.Manifests, func(existing imgspecv1.Descriptor) bool {
+		return existing.Digest == desc.Digest
+	}) {
+		return nil
+	}
+	index.Manifests = append(index.Manifests, desc)
+	indexBlob, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tag, err := referrersTagSchemaTag(subject)
+	if err != nil {
+		return err
+	}
+	d.c.log.Debugf("Registry did not process the subject of manifest %s, updating referrers index %s", desc.Digest, tag)
+	return d.uploadManifest(ctx, indexBlob, tag)
+}
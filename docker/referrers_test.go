@@ -0,0 +1,320 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// referrersTestRegistry is a minimal registry storing manifests and blobs, optionally supporting the referrers API.
+type referrersTestRegistry struct {
+	t                  *testing.T
+	supportsReferrers  bool
+	mutex              sync.Mutex
+	manifests          map[string][]byte // Tag or digest -> manifest; all manifests are OCI
+	manifestTypes      map[string]string // Tag or digest -> MIME type, if known; an OCI index otherwise
+	referrersResponses map[digest.Digest][]imgspecv1.Descriptor
+	blobs              map[digest.Digest][]byte
+	upload             []byte // Contents of the only upload session
+}
+
+func (r *referrersTestRegistry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/v2/":
+		rw.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/v2/repo/referrers/"):
+		if !r.supportsReferrers {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		subject := digest.Digest(strings.TrimPrefix(req.URL.Path, "/v2/repo/referrers/"))
+		index, err := json.Marshal(imgspecv1.Index{MediaType: imgspecv1.MediaTypeImageIndex, Manifests: r.referrersResponses[subject]})
+		require.NoError(r.t, err)
+		rw.Header().Set("Content-Type", imgspecv1.MediaTypeImageIndex)
+		rw.WriteHeader(http.StatusOK)
+		_, err = rw.Write(index)
+		require.NoError(r.t, err)
+	case req.Method == http.MethodHead && strings.HasPrefix(req.URL.Path, "/v2/repo/blobs/"):
+		blob, ok := r.blobs[digest.Digest(strings.TrimPrefix(req.URL.Path, "/v2/repo/blobs/"))]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		rw.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/v2/repo/blobs/") && !strings.HasPrefix(req.URL.Path, "/v2/repo/blobs/uploads/"):
+		blob, ok := r.blobs[digest.Digest(strings.TrimPrefix(req.URL.Path, "/v2/repo/blobs/"))]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+		_, err := rw.Write(blob)
+		require.NoError(r.t, err)
+	case req.Method == http.MethodPost && req.URL.Path == "/v2/repo/blobs/uploads/":
+		r.upload = []byte{}
+		rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+		rw.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPatch && req.URL.Path == "/v2/repo/blobs/uploads/session":
+		data, err := io.ReadAll(req.Body)
+		require.NoError(r.t, err)
+		r.upload = append(r.upload, data...)
+		rw.Header().Set("Location", "/v2/repo/blobs/uploads/session")
+		rw.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && req.URL.Path == "/v2/repo/blobs/uploads/session":
+		blobDigest := digest.Digest(req.URL.Query().Get("digest"))
+		require.Equal(r.t, blobDigest, digest.FromBytes(r.upload))
+		r.blobs[blobDigest] = r.upload
+		rw.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(req.URL.Path, "/v2/repo/manifests/"):
+		key := strings.TrimPrefix(req.URL.Path, "/v2/repo/manifests/")
+		switch req.Method {
+		case http.MethodGet:
+			m, ok := r.manifests[key]
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			mimeType, ok := r.manifestTypes[key]
+			if !ok {
+				mimeType = imgspecv1.MediaTypeImageIndex
+			}
+			rw.Header().Set("Content-Type", mimeType)
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write(m)
+			require.NoError(r.t, err)
+		case http.MethodPut:
+			m, err := io.ReadAll(req.Body)
+			require.NoError(r.t, err)
+			r.manifests[key] = m
+			r.manifests[digest.FromBytes(m).String()] = m
+			if mimeType := req.Header.Get("Content-Type"); mimeType != "" {
+				r.manifestTypes[key] = mimeType
+				r.manifestTypes[digest.FromBytes(m).String()] = mimeType
+			}
+			rw.Header().Set("Docker-Content-Digest", digest.FromBytes(m).String())
+			if r.supportsReferrers {
+				var parsed imgspecv1.Manifest
+				err = json.Unmarshal(m, &parsed)
+				require.NoError(r.t, err)
+				if parsed.Subject != nil {
+					r.referrersResponses[parsed.Subject.Digest] = append(r.referrersResponses[parsed.Subject.Digest], imgspecv1.Descriptor{
+						MediaType:    parsed.MediaType,
+						ArtifactType: parsed.ArtifactType,
+						Digest:       digest.FromBytes(m),
+						Size:         int64(len(m)),
+					})
+				}
+				rw.Header().Set("OCI-Subject", "sha256:"+strings.Repeat("0", 64))
+			}
+			rw.WriteHeader(http.StatusCreated)
+		default:
+			require.FailNowf(r.t, "Unexpected request", "%v %v", req.Method, req.URL.Path)
+		}
+	default:
+		require.FailNowf(r.t, "Unexpected request", "%v %v", req.Method, req.URL.Path)
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+	}
+
+	subject := digest.FromString("subject")
+	sbom := imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, ArtifactType: "application/spdx+json", Digest: digest.FromString("sbom"), Size: 1}
+	signature := imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, ArtifactType: "application/vnd.dev.sigstore.bundle+json", Digest: digest.FromString("signature"), Size: 1}
+
+	// Registry supporting the referrers API
+	registry := &referrersTestRegistry{
+		t:                  t,
+		supportsReferrers:  true,
+		manifests:          map[string][]byte{},
+		manifestTypes:      map[string]string{},
+		referrersResponses: map[digest.Digest][]imgspecv1.Descriptor{subject: {sbom, signature}},
+	}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+	require.NoError(t, err)
+
+	referrers, err := ListReferrers(ctx, sys, ref, subject, "")
+	require.NoError(t, err)
+	assert.Equal(t, []imgspecv1.Descriptor{sbom, signature}, referrers)
+	referrers, err = ListReferrers(ctx, sys, ref, subject, sbom.ArtifactType)
+	require.NoError(t, err)
+	assert.Equal(t, []imgspecv1.Descriptor{sbom}, referrers)
+	referrers, err = ListReferrers(ctx, sys, ref, digest.FromString("unknown"), "")
+	require.NoError(t, err)
+	assert.Empty(t, referrers)
+
+	// Registry not supporting the referrers API: pushing a manifest with a subject updates the fallback tag
+	registry.supportsReferrers = false
+	referrers, err = ListReferrers(ctx, sys, ref, subject, "")
+	require.NoError(t, err)
+	assert.Empty(t, referrers)
+
+	artifact := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"artifactType":"application/spdx+json",` +
+		`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},` +
+		`"layers":[],"subject":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + subject.String() + `","size":1}}`)
+	artifactRef, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo@" + digest.FromBytes(artifact).String())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ { // Pushing the same artifact again must not duplicate the entry
+		dest, err := artifactRef.NewImageDestination(ctx, sys)
+		require.NoError(t, err)
+		err = dest.PutManifest(ctx, artifact, nil)
+		require.NoError(t, err)
+		require.NoError(t, dest.Close())
+	}
+	referrers, err = ListReferrers(ctx, sys, ref, subject, "")
+	require.NoError(t, err)
+	assert.Equal(t, []imgspecv1.Descriptor{{
+		MediaType:    imgspecv1.MediaTypeImageManifest,
+		ArtifactType: "application/spdx+json",
+		Digest:       digest.FromBytes(artifact),
+		Size:         int64(len(artifact)),
+	}}, referrers)
+	referrers, err = ListReferrers(ctx, sys, ref, subject, signature.ArtifactType)
+	require.NoError(t, err)
+	assert.Empty(t, referrers)
+}
+
+func TestListCosignAttachments(t *testing.T) {
+	ctx := context.Background()
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+	}
+
+	subject := digest.Digest("sha256:" + strings.Repeat("a", 64))
+	registry := &referrersTestRegistry{
+		t: t,
+		manifests: map[string][]byte{
+			"sha256-" + strings.Repeat("a", 64) + ".att": []byte("{}"),
+		},
+		manifestTypes: map[string]string{},
+	}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+	require.NoError(t, err)
+
+	tags, err := ListCosignAttachments(ctx, sys, ref, subject, []string{"att", "sbom"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256-" + strings.Repeat("a", 64) + ".att"}, tags)
+
+	_, err = ListCosignAttachments(ctx, sys, ref, subject, []string{"invalid/suffix"})
+	assert.Error(t, err)
+}
+
+func TestReferrersTagSchemaTag(t *testing.T) {
+	tag, err := referrersTagSchemaTag(digest.Digest("sha256:" + strings.Repeat("a", 64)))
+	require.NoError(t, err)
+	assert.Equal(t, "sha256-"+strings.Repeat("a", 64), tag)
+
+	_, err = referrersTagSchemaTag(digest.Digest("sha256:../"))
+	assert.Error(t, err)
+}
+
+func TestSigstoreSignaturesAsReferrers(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	registriesConf := filepath.Join(tmpDir, "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	registriesDir := filepath.Join(tmpDir, "registries.d")
+	err = os.Mkdir(registriesDir, 0o700)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(registriesDir, "default.yaml"), []byte("default-docker:\n"+
+		"  lookaside: file://"+filepath.Join(tmpDir, "lookaside")+"\n"+
+		"  use-sigstore-attachments: true\n"+
+		"  sigstore-attachments-format: referrers\n"), 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           registriesDir,
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+	}
+
+	image := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:` + strings.Repeat("1", 64) + `","size":1},` +
+		`"layers":[]}`)
+	sig1 := signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte("payload 1"), map[string]string{signature.SigstoreSignatureAnnotationKey: "sig1"})
+	sig2 := signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte("payload 2"), map[string]string{signature.SigstoreSignatureAnnotationKey: "sig2"})
+
+	for _, supportsReferrers := range []bool{true, false} {
+		registry := &referrersTestRegistry{
+			t:                  t,
+			supportsReferrers:  supportsReferrers,
+			manifests:          map[string][]byte{},
+			manifestTypes:      map[string]string{},
+			referrersResponses: map[digest.Digest][]imgspecv1.Descriptor{},
+			blobs:              map[digest.Digest][]byte{},
+		}
+		server := httptest.NewServer(registry)
+		ref, err := ParseReference("//" + strings.TrimPrefix(server.URL, "http://") + "/repo:tag")
+		require.NoError(t, err)
+
+		dest, err := ref.NewImageDestination(ctx, sys)
+		require.NoError(t, err)
+		err = dest.PutManifest(ctx, image, nil)
+		require.NoError(t, err)
+		privateDest, ok := dest.(private.ImageDestination)
+		require.True(t, ok)
+		err = privateDest.PutSignaturesWithFormat(ctx, []signature.Signature{sig1}, nil)
+		require.NoError(t, err)
+		// Existing signatures are not duplicated
+		err = privateDest.PutSignaturesWithFormat(ctx, []signature.Signature{sig1, sig2}, nil)
+		require.NoError(t, err)
+		require.NoError(t, dest.Close())
+
+		referrers, err := ListReferrers(ctx, sys, ref, digest.FromBytes(image), signature.SigstoreSignatureArtifactType)
+		require.NoError(t, err)
+		assert.Len(t, referrers, 2)
+
+		src, err := ref.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		privateSrc, ok := src.(private.ImageSource)
+		require.True(t, ok)
+		sigs, err := privateSrc.GetSignaturesWithFormat(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []signature.Signature{sig1, sig2}, sigs)
+		require.NoError(t, src.Close())
+		server.Close()
+	}
+}
@@ -10,12 +10,12 @@ import (
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/internal/rootless"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/fileutils"
 	"github.com/containers/storage/pkg/homedir"
 	"github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
@@ -43,6 +43,8 @@ type registryConfiguration struct {
 	DefaultDocker *registryNamespace `yaml:"default-docker"`
 	// The key is a namespace, using fully-expanded Docker reference format or parent namespaces (per dockerReference.PolicyConfiguration*),
 	Docker map[string]registryNamespace `yaml:"docker"`
+
+	log logging.Logger // Set by loadRegistryConfiguration; the zero value logs to logrus.
 }
 
 // registryNamespace defines lookaside locations for a single namespace.
@@ -52,8 +54,19 @@ type registryNamespace struct {
 	SigStore               string `yaml:"sigstore"`          // For compatibility, deprecated in favor of Lookaside.
 	SigStoreStaging        string `yaml:"sigstore-staging"`  // For compatibility, deprecated in favor of LookasideStaging.
 	UseSigstoreAttachments *bool  `yaml:"use-sigstore-attachments,omitempty"`
+	// How sigstore attachments are stored, one of sigstoreAttachmentsFormat*; "" means the value is not set.
+	SigstoreAttachmentsFormat string `yaml:"sigstore-attachments-format,omitempty"`
 }
 
+const (
+	// sigstoreAttachmentsFormatTag stores all sigstore signatures of a manifest in a single manifest,
+	// using a "sha256-<hex>.sig" tag, as done by cosign by default.
+	sigstoreAttachmentsFormatTag = "tag"
+	// sigstoreAttachmentsFormatReferrers stores each sigstore signature in a separate OCI artifact manifest
+	// referring to the signed manifest using its "subject" field.
+	sigstoreAttachmentsFormatReferrers = "referrers"
+)
+
 // lookasideStorageBase is an "opaque" type representing a lookaside Docker signature storage.
 // Users outside of this file should use SignatureStorageBaseURL and lookasideStorageURL below.
 type lookasideStorageBase *url.URL
@@ -78,8 +91,14 @@ func SignatureStorageBaseURL(sys *types.SystemContext, ref types.ImageReference,
 // loadRegistryConfiguration returns a registryConfiguration appropriate for sys.
 func loadRegistryConfiguration(sys *types.SystemContext) (*registryConfiguration, error) {
 	dirPath := registriesDirPath(sys)
-	logrus.Debugf(`Using registries.d directory %s`, dirPath)
-	return loadAndMergeConfig(dirPath)
+	log := logging.For(sys)
+	log.Debugf(`Using registries.d directory %s`, dirPath)
+	config, err := loadAndMergeConfig(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	config.log = log
+	return config, nil
 }
 
 // registriesDirPath returns a path to registries.d
@@ -174,7 +193,7 @@ func (config *registryConfiguration) lookasideStorageBaseURL(dr dockerReference,
 	} else {
 		// returns default directory if no lookaside specified in configuration file
 		baseURL = builtinDefaultLookasideStorageDir(rootless.GetRootlessEUID())
-		logrus.Debugf(" No signature storage configuration found for %s, using built-in default %s", dr.PolicyConfigurationIdentity(), baseURL.Redacted())
+		config.log.Debugf(" No signature storage configuration found for %s, using built-in default %s", dr.PolicyConfigurationIdentity(), baseURL.Redacted())
 	}
 	// NOTE: Keep this in sync with docs/signature-protocols.md!
 	// FIXME? Restrict to explicitly supported schemes?
@@ -201,8 +220,8 @@ func (config *registryConfiguration) signatureTopLevel(ref dockerReference, writ
 		// Look for a full match.
 		identity := ref.PolicyConfigurationIdentity()
 		if ns, ok := config.Docker[identity]; ok {
-			logrus.Debugf(` Lookaside configuration: using "docker" namespace %s`, identity)
-			if ret := ns.signatureTopLevel(write); ret != "" {
+			config.log.Debugf(` Lookaside configuration: using "docker" namespace %s`, identity)
+			if ret := ns.signatureTopLevel(config.log, write); ret != "" {
 				return ret
 			}
 		}
@@ -210,8 +229,8 @@ func (config *registryConfiguration) signatureTopLevel(ref dockerReference, writ
 		// Look for a match of the possible parent namespaces.
 		for _, name := range ref.PolicyConfigurationNamespaces() {
 			if ns, ok := config.Docker[name]; ok {
-				logrus.Debugf(` Lookaside configuration: using "docker" namespace %s`, name)
-				if ret := ns.signatureTopLevel(write); ret != "" {
+				config.log.Debugf(` Lookaside configuration: using "docker" namespace %s`, name)
+				if ret := ns.signatureTopLevel(config.log, write); ret != "" {
 					return ret
 				}
 			}
@@ -219,8 +238,8 @@ func (config *registryConfiguration) signatureTopLevel(ref dockerReference, writ
 	}
 	// Look for a default location
 	if config.DefaultDocker != nil {
-		logrus.Debugf(` Lookaside configuration: using "default-docker" configuration`)
-		if ret := config.DefaultDocker.signatureTopLevel(write); ret != "" {
+		config.log.Debugf(` Lookaside configuration: using "default-docker" configuration`)
+		if ret := config.DefaultDocker.signatureTopLevel(config.log, write); ret != "" {
 			return ret
 		}
 	}
@@ -234,7 +253,7 @@ func (config *registryConfiguration) useSigstoreAttachments(ref dockerReference)
 		// Look for a full match.
 		identity := ref.PolicyConfigurationIdentity()
 		if ns, ok := config.Docker[identity]; ok {
-			logrus.Debugf(` Sigstore attachments: using "docker" namespace %s`, identity)
+			config.log.Debugf(` Sigstore attachments: using "docker" namespace %s`, identity)
 			if ns.UseSigstoreAttachments != nil {
 				return *ns.UseSigstoreAttachments
 			}
@@ -243,7 +262,7 @@ func (config *registryConfiguration) useSigstoreAttachments(ref dockerReference)
 		// Look for a match of the possible parent namespaces.
 		for _, name := range ref.PolicyConfigurationNamespaces() {
 			if ns, ok := config.Docker[name]; ok {
-				logrus.Debugf(` Sigstore attachments: using "docker" namespace %s`, name)
+				config.log.Debugf(` Sigstore attachments: using "docker" namespace %s`, name)
 				if ns.UseSigstoreAttachments != nil {
 					return *ns.UseSigstoreAttachments
 				}
@@ -252,7 +271,7 @@ func (config *registryConfiguration) useSigstoreAttachments(ref dockerReference)
 	}
 	// Look for a default location
 	if config.DefaultDocker != nil {
-		logrus.Debugf(` Sigstore attachments: using "default-docker" configuration`)
+		config.log.Debugf(` Sigstore attachments: using "default-docker" configuration`)
 		if config.DefaultDocker.UseSigstoreAttachments != nil {
 			return *config.DefaultDocker.UseSigstoreAttachments
 		}
@@ -260,25 +279,64 @@ func (config *registryConfiguration) useSigstoreAttachments(ref dockerReference)
 	return false
 }
 
+// config.sigstoreAttachmentsFormat returns the format of sigstore attachments for ref, one of sigstoreAttachmentsFormat*.
+func (config *registryConfiguration) sigstoreAttachmentsFormat(ref dockerReference) (string, error) {
+	format := ""
+	if config.Docker != nil {
+		// Look for a full match.
+		identity := ref.PolicyConfigurationIdentity()
+		if ns, ok := config.Docker[identity]; ok && ns.SigstoreAttachmentsFormat != "" {
+			config.log.Debugf(` Sigstore attachments format: using "docker" namespace %s`, identity)
+			format = ns.SigstoreAttachmentsFormat
+		}
+
+		// Look for a match of the possible parent namespaces.
+		if format == "" {
+			for _, name := range ref.PolicyConfigurationNamespaces() {
+				if ns, ok := config.Docker[name]; ok && ns.SigstoreAttachmentsFormat != "" {
+					config.log.Debugf(` Sigstore attachments format: using "docker" namespace %s`, name)
+					format = ns.SigstoreAttachmentsFormat
+					break
+				}
+			}
+		}
+	}
+	// Look for a default location
+	if format == "" && config.DefaultDocker != nil && config.DefaultDocker.SigstoreAttachmentsFormat != "" {
+		config.log.Debugf(` Sigstore attachments format: using "default-docker" configuration`)
+		format = config.DefaultDocker.SigstoreAttachmentsFormat
+	}
+
+	switch format {
+	case "":
+		return sigstoreAttachmentsFormatTag, nil
+	case sigstoreAttachmentsFormatTag, sigstoreAttachmentsFormatReferrers:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown sigstore-attachments-format %q", format)
+	}
+}
+
 // ns.signatureTopLevel returns an URL string configured in ns for ref, for write access if “write”.
 // or "" if nothing has been configured.
-func (ns registryNamespace) signatureTopLevel(write bool) string {
+// Debug messages are logged to log.
+func (ns registryNamespace) signatureTopLevel(log logging.Logger, write bool) string {
 	if write {
 		if ns.LookasideStaging != "" {
-			logrus.Debugf(`  Using "lookaside-staging" %s`, ns.LookasideStaging)
+			log.Debugf(`  Using "lookaside-staging" %s`, ns.LookasideStaging)
 			return ns.LookasideStaging
 		}
 		if ns.SigStoreStaging != "" {
-			logrus.Debugf(`  Using "sigstore-staging" %s`, ns.SigStoreStaging)
+			log.Debugf(`  Using "sigstore-staging" %s`, ns.SigStoreStaging)
 			return ns.SigStoreStaging
 		}
 	}
 	if ns.Lookaside != "" {
-		logrus.Debugf(`  Using "lookaside" %s`, ns.Lookaside)
+		log.Debugf(`  Using "lookaside" %s`, ns.Lookaside)
 		return ns.Lookaside
 	}
 	if ns.SigStore != "" {
-		logrus.Debugf(`  Using "sigstore" %s`, ns.SigStore)
+		log.Debugf(`  Using "sigstore" %s`, ns.SigStore)
 		return ns.SigStore
 	}
 	return ""
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/internal/logging"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
@@ -271,6 +272,34 @@ func TestRegistryConfigurationSignatureTopLevel(t *testing.T) {
 	assert.Equal(t, "", res)
 }
 
+func TestRegistryConfigurationSigstoreAttachmentsFormat(t *testing.T) {
+	config := registryConfiguration{
+		DefaultDocker: &registryNamespace{SigstoreAttachmentsFormat: sigstoreAttachmentsFormatReferrers},
+		Docker: map[string]registryNamespace{
+			"example.com":              {SigstoreAttachmentsFormat: sigstoreAttachmentsFormatTag},
+			"example.com/ns1":          {}, // Not set, the parent namespace applies
+			"example.com/ns1/ns2":      {SigstoreAttachmentsFormat: sigstoreAttachmentsFormatReferrers},
+			"example.com/ns1/ns2/repo": {SigstoreAttachmentsFormat: "invalid"},
+		},
+	}
+	for _, c := range []struct{ input, expected string }{
+		{"example.com/ns1/ns2/other", sigstoreAttachmentsFormatReferrers},
+		{"example.com/ns1/other", sigstoreAttachmentsFormatTag},
+		{"example.com/other", sigstoreAttachmentsFormatTag},
+		{"unknown.example.com/busybox", sigstoreAttachmentsFormatReferrers},
+	} {
+		res, err := config.sigstoreAttachmentsFormat(dockerRefFromString(t, "//"+c.input))
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+	_, err := config.sigstoreAttachmentsFormat(dockerRefFromString(t, "//example.com/ns1/ns2/repo"))
+	assert.Error(t, err)
+
+	res, err := (&registryConfiguration{}).sigstoreAttachmentsFormat(dockerRefFromString(t, "//example.com/repo"))
+	require.NoError(t, err)
+	assert.Equal(t, sigstoreAttachmentsFormatTag, res)
+}
+
 func TestRegistryNamespaceSignatureTopLevel(t *testing.T) {
 	for _, c := range []struct {
 		ns         registryNamespace
@@ -296,7 +325,7 @@ func TestRegistryNamespaceSignatureTopLevel(t *testing.T) {
 		{registryNamespace{Lookaside: "b", SigStore: "d"}, false, "b"},
 		{registryNamespace{SigStore: "d"}, false, "d"},
 	} {
-		res := c.ns.signatureTopLevel(c.forWriting)
+		res := c.ns.signatureTopLevel(logging.Logger{}, c.forWriting)
 		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v %v", c.ns, c.forWriting))
 	}
 }
@@ -0,0 +1,212 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/internal/logging"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+)
+
+// defaultSearchPageSize is the number of results per page used by Search if SearchOptions.PageSize is not set.
+const defaultSearchPageSize = 25
+
+// SearchOptions can be used to modify the behavior of Search.
+type SearchOptions struct {
+	// The 1-based index of the page of results to return; the first page is returned if this is 0.
+	Page int
+	// If > 0, the number of results per page; a default of 25 is used otherwise.
+	// Some registries return more or fewer results per page than requested.
+	PageSize int
+	// If not nil, Extension is tried first, e.g. to use a registry-specific search API. It should return a page of
+	// results for query, as specified by page and pageSize, or an error wrapping ErrSearchNotSupported if it can not
+	// search registry, in which case the built-in methods are used.
+	Extension func(ctx context.Context, sys *types.SystemContext, registry, query string, page, pageSize int) (*SearchPage, error)
+}
+
+// SearchMethod identifies the method used to search a registry.
+type SearchMethod int
+
+const (
+	// SearchMethodV1 is the /v1/search API, supported e.g. by Docker Hub.
+	SearchMethodV1 SearchMethod = iota
+	// SearchMethodCatalog is filtering the list of repositories returned by the /v2/_catalog API.
+	SearchMethodCatalog
+	// SearchMethodExtension is SearchOptions.Extension.
+	SearchMethodExtension
+)
+
+// SearchPage is a single page of results returned by Search.
+type SearchPage struct {
+	Results  []SearchResult
+	Method   SearchMethod // The method used to obtain the results
+	Page     int          // The 1-based index of this page
+	PageSize int          // The requested number of results per page
+	// The total number of results and pages, or -1 if not known.
+	TotalResults int
+	TotalPages   int
+	// True if there are more results, i.e. if the following page is not known to be empty.
+	HasMore bool
+}
+
+// Search returns a page of results of searching registry (a host[:port]) for repositories matching query,
+// using the /v1/search API if available, and filtering the result of the /v2/_catalog API by substring otherwise.
+// The semantics of the query depend on the registry; query must not be empty unless the catalog API is used.
+// options may be nil.
+func Search(ctx context.Context, sys *types.SystemContext, registry, query string, options *SearchOptions) (*SearchPage, error) {
+	if options == nil {
+		options = &SearchOptions{}
+	}
+	page := max(options.Page, 1)
+	pageSize := options.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+
+	if options.Extension != nil {
+		res, err := options.Extension(ctx, sys, registry, query, page, pageSize)
+		if err == nil {
+			res.Method = SearchMethodExtension
+			return res, nil
+		}
+		if !errors.Is(err, ErrSearchNotSupported) {
+			return nil, err
+		}
+		logging.For(sys).Debugf("Search extension does not support %s: %v", registry, err)
+	}
+
+	if query != "" {
+		res, err := searchV1(ctx, sys, registry, query, page, pageSize)
+		if err == nil {
+			return res, nil
+		}
+		if registry == dockerHostname || !errors.Is(err, ErrSearchNotSupported) {
+			return nil, err
+		}
+		logging.For(sys).Debugf("Search API not supported by %s, filtering the catalog: %v", registry, err)
+	}
+
+	res, err := searchCatalog(ctx, sys, registry, query, page, pageSize)
+	if err != nil {
+		if errors.Is(err, ErrCatalogNotSupported) {
+			return nil, fmt.Errorf("searching %s: %w", registry, ErrSearchNotSupported)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// searchV1 returns a page of results of searching registry for query using the /v1/search API.
+func searchV1(ctx context.Context, sys *types.SystemContext, registry, query string, page, pageSize int) (*SearchPage, error) {
+	// We can't use GetCredentialsForRef here because we want to search the whole registry.
+	auth, err := config.GetCredentials(sys, registry)
+	if err != nil {
+		return nil, fmt.Errorf("getting username and password: %w", err)
+	}
+	hostname := registry
+	if registry == dockerHostname {
+		// The search API is only available on the v1 hostname of docker.io; see also SearchRegistry.
+		hostname = dockerV1Hostname
+		query = strings.TrimPrefix(query, "library/")
+	}
+	client, err := newDockerClient(sys, hostname, registry)
+	if err != nil {
+		return nil, fmt.Errorf("creating new docker client: %w", err)
+	}
+	defer client.Close()
+	client.auth = auth
+	if sys != nil {
+		client.registryToken = sys.DockerBearerRegistryToken
+	}
+
+	q := url.Values{}
+	q.Set("q", query)
+	q.Set("n", strconv.Itoa(pageSize))
+	q.Set("page", strconv.Itoa(page))
+	res, err := client.makeRequest(ctx, http.MethodGet, "/v1/search?"+q.Encode(), nil, nil, noAuth, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, fmt.Errorf("searching %s: %w", registry, ErrSearchNotSupported)
+	default:
+		return nil, fmt.Errorf("searching %s: %w", registry, registryHTTPResponseToError(client.log, res))
+	}
+
+	var v1Res struct {
+		NumPages   *int           `json:"num_pages"`
+		NumResults *int           `json:"num_results"`
+		Page       *int           `json:"page"`
+		Results    []SearchResult `json:"results"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v1Res); err != nil {
+		return nil, fmt.Errorf("parsing search results from %s: %w", registry, err)
+	}
+	searchPage := &SearchPage{
+		Results:      v1Res.Results,
+		Method:       SearchMethodV1,
+		Page:         page,
+		PageSize:     pageSize,
+		TotalResults: -1,
+		TotalPages:   -1,
+	}
+	if searchPage.Results == nil {
+		searchPage.Results = []SearchResult{}
+	}
+	if v1Res.Page != nil {
+		searchPage.Page = *v1Res.Page
+	}
+	if v1Res.NumResults != nil {
+		searchPage.TotalResults = *v1Res.NumResults
+	}
+	if v1Res.NumPages != nil { // Otherwise, the registry doesn't paginate, and returns all results at once.
+		searchPage.TotalPages = *v1Res.NumPages
+		searchPage.HasMore = searchPage.Page < searchPage.TotalPages
+	}
+	return searchPage, nil
+}
+
+// errSearchPageFull is used to stop listing the catalog when a page of search results is complete.
+var errSearchPageFull = errors.New("search page full")
+
+// searchCatalog returns a page of results of searching registry for repositories containing query using the /v2/_catalog API.
+func searchCatalog(ctx context.Context, sys *types.SystemContext, registry, query string, page, pageSize int) (*SearchPage, error) {
+	res := &SearchPage{
+		Results:      []SearchResult{},
+		Method:       SearchMethodCatalog,
+		Page:         page,
+		PageSize:     pageSize,
+		TotalResults: -1,
+		TotalPages:   -1,
+	}
+	skip := (page - 1) * pageSize
+	err := ListRepositories(ctx, sys, registry, nil, func(repository string) error {
+		if !strings.Contains(repository, query) {
+			return nil
+		}
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		if len(res.Results) == pageSize {
+			res.HasMore = true
+			return errSearchPageFull
+		}
+		res.Results = append(res.Results, SearchResult{Name: repository})
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSearchPageFull) {
+		return nil, err
+	}
+	return res, nil
+}
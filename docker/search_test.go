@@ -0,0 +1,111 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	v1Supported := true
+	catalogSupported := true
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case req.URL.Path == "/v1/search" && !v1Supported:
+			rw.WriteHeader(http.StatusNotFound)
+		case req.URL.Path == "/v1/search":
+			assert.Equal(t, "foo", req.URL.Query().Get("q"))
+			assert.Equal(t, "2", req.URL.Query().Get("n"))
+			page := req.URL.Query().Get("page")
+			_, err := fmt.Fprintf(rw, `{"num_pages":2,"num_results":3,"page":%s,"page_size":2,"query":"foo",`+
+				`"results":[{"name":"foo%s","description":"d","star_count":5,"is_official":true}]}`, page, page)
+			require.NoError(t, err)
+		case req.URL.Path == "/v2/_catalog" && !catalogSupported:
+			rw.WriteHeader(http.StatusNotFound)
+		case req.URL.Path == "/v2/_catalog":
+			_, err := rw.Write([]byte(`{"repositories":["foo1","bar","foo2","ns/foo3","foo4"]}`))
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", req.Method, req.URL)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+	}
+
+	// The v1 search API
+	res, err := Search(context.Background(), sys, registry, "foo", &SearchOptions{Page: 2, PageSize: 2})
+	require.NoError(t, err)
+	assert.Equal(t, &SearchPage{
+		Results:      []SearchResult{{Name: "foo2", Description: "d", StarCount: 5, IsOfficial: true}},
+		Method:       SearchMethodV1,
+		Page:         2,
+		PageSize:     2,
+		TotalResults: 3,
+		TotalPages:   2,
+		HasMore:      false,
+	}, res)
+
+	// The catalog
+	v1Supported = false
+	for _, c := range []struct {
+		page     int
+		expected []string
+		hasMore  bool
+	}{
+		{0, []string{"foo1", "foo2"}, true},
+		{2, []string{"ns/foo3", "foo4"}, false},
+		{3, []string{}, false},
+	} {
+		res, err := Search(context.Background(), sys, registry, "foo", &SearchOptions{Page: c.page, PageSize: 2})
+		require.NoError(t, err)
+		assert.Equal(t, SearchMethodCatalog, res.Method)
+		names := []string{}
+		for _, r := range res.Results {
+			names = append(names, r.Name)
+		}
+		assert.Equal(t, c.expected, names, c.page)
+		assert.Equal(t, c.hasMore, res.HasMore, c.page)
+		assert.Equal(t, -1, res.TotalResults)
+	}
+
+	// Neither is supported
+	catalogSupported = false
+	_, err = Search(context.Background(), sys, registry, "foo", nil)
+	assert.ErrorIs(t, err, ErrSearchNotSupported)
+
+	// An extension
+	extension := func(ctx context.Context, sys *types.SystemContext, extRegistry, query string, page, pageSize int) (*SearchPage, error) {
+		if extRegistry != registry {
+			return nil, ErrSearchNotSupported
+		}
+		assert.Equal(t, 1, page)
+		assert.Equal(t, defaultSearchPageSize, pageSize)
+		return &SearchPage{Results: []SearchResult{{Name: query}}, Page: page, PageSize: pageSize, TotalResults: 1, TotalPages: 1}, nil
+	}
+	res, err = Search(context.Background(), sys, registry, "foo", &SearchOptions{Extension: extension})
+	require.NoError(t, err)
+	assert.Equal(t, SearchMethodExtension, res.Method)
+	assert.Equal(t, []SearchResult{{Name: "foo"}}, res.Results)
+}
@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// memoryBearerTokenCache is an in-memory implementation of types.DockerBearerTokenCache.
+type memoryBearerTokenCache struct {
+	mutex  sync.Mutex
+	tokens map[string]memoryBearerTokenCacheEntry
+}
+
+type memoryBearerTokenCacheEntry struct {
+	token      string
+	expiration time.Time
+}
+
+// NewBearerTokenCache returns an in-memory types.DockerBearerTokenCache,
+// which can be shared by image sources and destinations by setting it as SystemContext.DockerBearerTokenCache.
+func NewBearerTokenCache() types.DockerBearerTokenCache {
+	return &memoryBearerTokenCache{
+		tokens: map[string]memoryBearerTokenCacheEntry{},
+	}
+}
+
+// Get returns a token stored for key, and true, if it exists and has not expired.
+func (c *memoryBearerTokenCache) Get(key string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.tokens[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expiration) {
+		delete(c.tokens, key)
+		return "", false
+	}
+	return entry.token, true
+}
+
+// Put stores token for key; it must not be returned by Get after expiration.
+func (c *memoryBearerTokenCache) Put(key string, token string, expiration time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tokens[key] = memoryBearerTokenCacheEntry{token: token, expiration: expiration}
+}
+
+// bearerTokenCacheKeySecret returns a random key, generated once per process, used to compute bearerTokenCacheKey values.
+var bearerTokenCacheKeySecret = sync.OnceValues(func() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generating a bearer token cache key secret: %w", err)
+	}
+	return secret, nil
+})
+
+// bearerTokenCacheKey returns a key for a token obtained by c using challenge for scopes.
+// The key identifies the registry and the credentials, so that caches can be shared by clients using different credentials,
+// but it is a HMAC using a per-process secret, so that the credentials can not be recovered from (or guessed by checking against)
+// keys which are logged or persisted by a types.DockerBearerTokenCache implementation.
+func (c *dockerClient) bearerTokenCacheKey(challenge challenge, scopes []authScope) (string, error) {
+	secret, err := bearerTokenCacheKeySecret()
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, secret)
+	for _, s := range []string{c.registry, challenge.Parameters["realm"], challenge.Parameters["service"],
+		c.auth.Username, c.auth.Password, c.auth.IdentityToken} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	for _, scope := range scopes {
+		for _, s := range []string{scope.resourceType, scope.remoteName, scope.actions} {
+			h.Write([]byte(s))
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBearerTokenCache(t *testing.T) {
+	cache := NewBearerTokenCache()
+	_, ok := cache.Get("key")
+	assert.False(t, ok)
+
+	cache.Put("key", "token", time.Now().Add(time.Hour))
+	token, ok := cache.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "token", token)
+
+	cache.Put("key", "expired", time.Now().Add(-time.Second))
+	_, ok = cache.Get("key")
+	assert.False(t, ok)
+}
+
+func TestBearerTokenCacheKey(t *testing.T) {
+	c1 := &dockerClient{registry: "registry.example.com", auth: types.DockerAuthConfig{Username: "user", Password: "pass1"}}
+	c2 := &dockerClient{registry: "registry.example.com", auth: types.DockerAuthConfig{Username: "user", Password: "pass2"}}
+	ch := challenge{Scheme: "bearer", Parameters: map[string]string{"realm": "https://auth.example.com/token"}}
+	pull := []authScope{{resourceType: "repository", remoteName: "repo", actions: "pull"}}
+	push := []authScope{{resourceType: "repository", remoteName: "repo", actions: "pull,push"}}
+
+	key := func(c *dockerClient, scopes []authScope) string {
+		res, err := c.bearerTokenCacheKey(ch, scopes)
+		require.NoError(t, err)
+		return res
+	}
+	assert.Equal(t, key(c1, pull), key(c1, pull))
+	assert.NotEqual(t, key(c1, pull), key(c2, pull))
+	assert.NotEqual(t, key(c1, pull), key(c1, push))
+	assert.NotContains(t, key(c1, pull), "pass1")
+
+	// The key is not an unsalted hash of the inputs, which could be checked against guessed credentials.
+	h := sha256.New()
+	for _, s := range []string{"registry.example.com", "https://auth.example.com/token", "", "user", "pass1", "",
+		"repository", "repo", "pull"} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	assert.NotEqual(t, hex.EncodeToString(h.Sum(nil)), key(c1, pull))
+}
+
+func TestSharedBearerTokenCache(t *testing.T) {
+	tokenRequests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/token":
+			tokenRequests++
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write([]byte(`{"token":"sentinel-token","expires_in":300}`))
+			require.NoError(t, err)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			if r.Header.Get("Authorization") == "Bearer sentinel-token" {
+				rw.WriteHeader(http.StatusOK)
+				return
+			}
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+			rw.WriteHeader(http.StatusUnauthorized)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	for _, c := range []struct {
+		cache            types.DockerBearerTokenCache
+		expectedRequests int
+	}{
+		{nil, 2},
+		{NewBearerTokenCache(), 1},
+	} {
+		tokenRequests = 0
+		sys := &types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			DockerBearerTokenCache:      c.cache,
+		}
+		for i := 0; i < 2; i++ {
+			err := CheckAuth(context.Background(), sys, "user", "pass", registry)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, c.expectedRequests, tokenRequests)
+	}
+}
@@ -0,0 +1,134 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/storage/pkg/ioutils"
+	"github.com/opencontainers/go-digest"
+)
+
+// uploadState is the recorded state of a blob upload, allowing it to be resumed.
+type uploadState struct {
+	Location string `json:"location"` // The URL of the upload session
+}
+
+// uploadStatePath returns the path of the file recording the state of an upload of blobDigest to d,
+// or "" if upload states should not be recorded.
+func (d *dockerImageDestination) uploadStatePath(blobDigest digest.Digest) string {
+	if d.c.sys == nil || d.c.sys.DockerRegistryUploadStateDir == "" || blobDigest == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(d.c.registry + "/" + reference.Path(d.ref.ref) + "@" + blobDigest.String()))
+	return filepath.Join(d.c.sys.DockerRegistryUploadStateDir, hex.EncodeToString(h[:])+".json")
+}
+
+// recordUploadState records that an upload to be stored at path is using an upload session at location.
+func (d *dockerImageDestination) recordUploadState(path string, location *url.URL) {
+	if path == "" {
+		return
+	}
+	state, err := json.Marshal(uploadState{Location: location.String()})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o700)
+	}
+	if err == nil {
+		err = ioutils.AtomicWriteFile(path, state, 0o600)
+	}
+	if err != nil {
+		d.c.log.Debugf("Error recording upload state in %s, the upload will not be resumable: %v", path, err)
+	}
+}
+
+// removeUploadState removes an upload state at path, if any.
+func (d *dockerImageDestination) removeUploadState(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		d.c.log.Debugf("Error removing upload state %s: %v", path, err)
+	}
+}
+
+// resumableUpload returns the location of an upload session recorded at path, and the number of bytes the registry has already received,
+// or (nil, 0) if there is no such upload session that can be resumed.
+// size is the size of the blob being uploaded, or -1 if unknown.
+func (d *dockerImageDestination) resumableUpload(ctx context.Context, path string, size int64) (*url.URL, int64) {
+	if path == "" {
+		return nil, 0
+	}
+	stateBytes, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			d.c.log.Debugf("Error reading upload state %s: %v", path, err)
+		}
+		return nil, 0
+	}
+	var state uploadState
+	if err := json.Unmarshal(stateBytes, &state); err != nil {
+		d.c.log.Debugf("Error parsing upload state %s: %v", path, err)
+		d.removeUploadState(path)
+		return nil, 0
+	}
+	location, err := url.Parse(state.Location)
+	if err != nil {
+		d.c.log.Debugf("Error parsing upload location in %s: %v", path, err)
+		d.removeUploadState(path)
+		return nil, 0
+	}
+
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodGet, location, nil, nil, -1, v2Auth, nil)
+	if err != nil {
+		d.c.log.Debugf("Error checking status of upload %s: %v", location.Redacted(), err)
+		return nil, 0
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		d.c.log.Debugf("Upload %s can not be resumed, status %d", location.Redacted(), res.StatusCode)
+		d.removeUploadState(path)
+		return nil, 0
+	}
+	offset, err := parseUploadRange(res.Header.Get("Range"))
+	if err != nil {
+		d.c.log.Debugf("Upload %s can not be resumed: %v", location.Redacted(), err)
+		d.removeUploadState(path)
+		return nil, 0
+	}
+	if size != -1 && offset > size {
+		d.c.log.Debugf("Upload %s can not be resumed: the registry has %d bytes, more than the blob size %d", location.Redacted(), offset, size)
+		d.removeUploadState(path)
+		return nil, 0
+	}
+	if newLocation, err := res.Location(); err == nil {
+		location = newLocation
+	}
+	return location, offset
+}
+
+// parseUploadRange returns the number of bytes received by the registry, given a Range header value of an upload status response.
+func parseUploadRange(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	start, end, ok := strings.Cut(value, "-")
+	if !ok || start != "0" {
+		return -1, fmt.Errorf("unexpected upload range %q", value)
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil || last < -1 {
+		return -1, fmt.Errorf("unexpected upload range %q", value)
+	}
+	return last + 1, nil
+}
@@ -0,0 +1,22 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// InspectInfo is a summary of a single image, as returned by Inspect.
+type InspectInfo = image.InspectInfo
+
+// Inspect returns a summary of the image instanceDigest in src (or of its primary manifest, if instanceDigest is nil),
+// including the manifest and config digests, sizes and MIME types, the layers as stored in src, and the creation history.
+// If that is a manifest list, an instance appropriate for sys is chosen, like FromSource does.
+//
+// Unlike FromSource(…).Inspect, this only fetches and parses the manifest(s) and the config blob, without building
+// the state necessary to use or copy the image; prefer it when inspecting many images, e.g. to list a repository.
+func Inspect(ctx context.Context, sys *types.SystemContext, src types.ImageSource, instanceDigest *digest.Digest) (*InspectInfo, error) {
+	return image.Inspect(ctx, sys, src, instanceDigest)
+}
@@ -1,6 +1,8 @@
 package blobinfocache
 
 import (
+	"time"
+
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
@@ -26,19 +28,40 @@ type BlobInfoCache2 interface {
 	// Close destroys state created by Open().
 	Close()
 
-	// RecordDigestCompressorName records a compressor for the blob with the specified digest,
-	// or Uncompressed or UnknownCompression.
-	// WARNING: Only call this with LOCALLY VERIFIED data; don’t record a compressor for a
-	// digest just because some remote author claims so (e.g. because a manifest says so);
+	// UncompressedDigestForTOC returns an uncompressed digest corresponding to tocDigest.
+	// Returns "" if the uncompressed digest is unknown.
+	UncompressedDigestForTOC(tocDigest digest.Digest) digest.Digest
+	// RecordTOCUncompressedPair records that the tocDigest corresponds to uncompressed.
+	// WARNING: Only call this for LOCALLY VERIFIED data; don’t record a digest pair just because some remote author claims so (e.g.
+	// because a manifest/config pair exists); otherwise the cache could be poisoned and allow substituting unexpected blobs.
+	// (Eventually, the DiffIDs in image config could detect the substitution, but that may be too late, and not all image formats contain that data.)
+	RecordTOCUncompressedPair(tocDigest digest.Digest, uncompressed digest.Digest)
+
+	// RecordDigestCompressorData records data for the blob with the specified digest.
+	// WARNING: Only call this with LOCALLY VERIFIED data:
+	//   - don’t record a compressor for a digest just because some remote author claims so
+	//     (e.g. because a manifest says so);
+	//   - don’t record the non-base variant or annotations if we are not _sure_ that the base variant
+	//     and the blob’s digest match the non-base variant’s annotations (e.g. because we saw them
+	//     in a manifest)
 	// otherwise the cache could be poisoned and cause us to make incorrect edits to type
 	// information in a manifest.
-	RecordDigestCompressorName(anyDigest digest.Digest, compressorName string)
+	RecordDigestCompressorData(anyDigest digest.Digest, data DigestCompressorData)
 	// CandidateLocations2 returns a prioritized, limited, number of blobs and their locations (if known)
 	// that could possibly be reused within the specified (transport scope) (if they still
 	// exist, which is not guaranteed).
 	CandidateLocations2(transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, options CandidateLocations2Options) []BICReplacementCandidate2
 }
 
+// DigestCompressorData is information known about how a blob is compressed.
+// (This is worded generically, but basically targeted at the zstd / zstd:chunked situation.)
+type DigestCompressorData struct {
+	BaseVariantCompressor string // A compressor’s base variant name, or Uncompressed or UnknownCompression.
+	// The following fields are only valid if the base variant is neither Uncompressed nor UnknownCompression:
+	SpecificVariantCompressor  string            // A non-base variant compressor (or UnknownCompression if the true format is just the base variant)
+	SpecificVariantAnnotations map[string]string // Annotations required to benefit from the base variant.
+}
+
 // CandidateLocations2Options are used in CandidateLocations2.
 type CandidateLocations2Options struct {
 	// If !CanSubstitute, the returned candidates will match the submitted digest exactly; if
@@ -54,6 +77,26 @@ type BICReplacementCandidate2 struct {
 	Digest               digest.Digest
 	CompressionOperation types.LayerCompression      // Either types.Decompress for uncompressed, or types.Compress for compressed
 	CompressionAlgorithm *compressiontypes.Algorithm // An algorithm when the candidate is compressed, or nil when it is uncompressed
-	UnknownLocation      bool                        // is true when `Location` for this blob is not set
-	Location             types.BICLocationReference  // not set if UnknownLocation is set to `true`
+	// Annotations required to use CompressionAlgorithm, if any; only set if CompressionAlgorithm is a non-base variant
+	// (e.g. zstd:chunked), and the annotations were recorded in the cache.
+	CompressionAnnotations map[string]string
+	UnknownLocation        bool                       // is true when `Location` for this blob is not set
+	Location               types.BICLocationReference // not set if UnknownLocation is set to `true`
+}
+
+// PruneOptions are used in Pruner.Prune.
+// Only known locations are pruned; other data (uncompressed digests, compression and TOC data) is small,
+// and remains valid indefinitely.
+type PruneOptions struct {
+	MaxLocationAge time.Duration // If not 0, remove known locations last recorded more than MaxLocationAge ago
+	// If not 0, remove the least recently recorded known locations so that at most MaxLocations remain.
+	// NOTE: The cache does not track when a location was last used, only when it was last recorded (i.e. when a blob was last
+	// copied to or from that location); so this is not a least-recently-used policy.
+	MaxLocations int
+}
+
+// Pruner is implemented by BlobInfoCache implementations which support removing old known locations.
+type Pruner interface {
+	// Prune removes known locations from the cache as specified by options.
+	Prune(options PruneOptions) error
 }
@@ -0,0 +1,92 @@
+// Package commandconn provides a net.Conn which communicates with the standard input and output of a command,
+// e.g. ssh(1) connecting to a remote host.
+package commandconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// commandConn is a net.Conn which communicates with the standard input and output of a command.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+// New starts name with args, and returns a net.Conn connected to its standard input and output.
+// The command is killed when the returned connection is closed; ctx only affects starting the command.
+func New(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %w", name, err)
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// Close terminates the command.
+func (c *commandConn) Close() error {
+	err := c.stdin.Close()
+	if killErr := c.cmd.Process.Kill(); killErr != nil && !errors.Is(killErr, os.ErrProcessDone) && err == nil {
+		err = killErr
+	}
+	_ = c.cmd.Wait() // The exit status of a killed process is not interesting.
+	return err
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return commandAddr{}
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return commandAddr{}
+}
+
+// SetDeadline, SetReadDeadline and SetWriteDeadline are not supported, and only exist to implement net.Conn.
+func (c *commandConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// commandAddr is a net.Addr of a commandConn.
+type commandAddr struct{}
+
+func (commandAddr) Network() string {
+	return "command"
+}
+
+func (commandAddr) String() string {
+	return "command"
+}
@@ -0,0 +1,27 @@
+package commandconn
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	conn, err := New(context.Background(), "cat")
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	assert.NoError(t, conn.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = New(ctx, "cat")
+	assert.Error(t, err)
+}
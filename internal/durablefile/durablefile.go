@@ -0,0 +1,76 @@
+// Package durablefile implements writing files so that they survive a system crash or a power loss,
+// for transports which store images in local directories.
+package durablefile
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/storage/pkg/ioutils"
+)
+
+// WriteFile writes data to path, like os.WriteFile.
+// If durable, the data is written to a temporary file, synced to disk, and renamed into place,
+// so that path never contains partial data, even after a crash.
+// (The directory containing path must also be synced, e.g. using DirTracker, for the new file to survive a crash.)
+func WriteFile(path string, data []byte, perm os.FileMode, durable bool) error {
+	if durable {
+		return ioutils.AtomicWriteFileWithOpts(path, data, perm, &ioutils.AtomicFileWriterOptions{NoSync: false})
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// SyncDir syncs the directory at path to disk, so that changes to its entries (e.g. renames into it) survive a crash.
+// This does nothing on Windows, which does not support syncing directories.
+func SyncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if err2 := dir.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// DirTracker records directories in which files were created, so that they can all be synced at once.
+// It is safe for concurrent use; the zero value is ready to use.
+type DirTracker struct {
+	lock sync.Mutex
+	dirs *set.Set[string]
+}
+
+// Add records that dir must be synced.
+func (t *DirTracker) Add(dir string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.dirs == nil {
+		t.dirs = set.New[string]()
+	}
+	t.dirs.Add(dir)
+}
+
+// Sync syncs all recorded directories to disk.
+func (t *DirTracker) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.dirs == nil {
+		return nil
+	}
+	errs := []error{}
+	for _, dir := range t.dirs.Values() {
+		if err := SyncDir(dir); err != nil {
+			errs = append(errs, err)
+		} else {
+			t.dirs.Delete(dir)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package durablefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	for _, durable := range []bool{false, true} {
+		tmpDir := t.TempDir()
+		path := filepath.Join(tmpDir, "file")
+		err := WriteFile(path, []byte("contents"), 0640, durable)
+		require.NoError(t, err)
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("contents"), contents)
+		fi, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), fi.Mode().Perm()&^0022) // Ignore the umask
+		entries, err := os.ReadDir(tmpDir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1) // No temporary files are left behind
+
+		err = WriteFile(filepath.Join(tmpDir, "missing", "file"), []byte("contents"), 0644, durable)
+		assert.Error(t, err)
+	}
+}
+
+func TestDirTracker(t *testing.T) {
+	var tracker DirTracker
+	assert.NoError(t, tracker.Sync()) // Nothing to do
+
+	tmpDir := t.TempDir()
+	tracker.Add(tmpDir)
+	tracker.Add(tmpDir)
+	assert.NoError(t, tracker.Sync())
+
+	missing := filepath.Join(tmpDir, "missing")
+	tracker.Add(missing)
+	assert.Error(t, tracker.Sync())
+	// A failed directory is kept, so that it can be retried.
+	require.NoError(t, os.Mkdir(missing, 0755))
+	assert.NoError(t, tracker.Sync())
+}
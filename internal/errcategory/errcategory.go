@@ -0,0 +1,34 @@
+// Package errcategory helps transports report errors matching the types.Err* categories.
+package errcategory
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/containers/image/v5/types"
+)
+
+// Wrap returns an error with the same text as err, which also matches category using errors.Is.
+// It returns err unmodified if err or category is nil.
+func Wrap(err error, category error) error {
+	if err == nil || category == nil {
+		return err
+	}
+	// %.0w makes category visible to errors.Is() without including any text
+	return fmt.Errorf("%w%.0w", err, category)
+}
+
+// FromHTTPStatus returns the types.Err* value matching an unsuccessful HTTP statusCode, or nil if none applies.
+func FromHTTPStatus(statusCode int) error {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return types.ErrUnauthorized
+	case http.StatusForbidden:
+		return types.ErrDenied
+	case http.StatusNotFound:
+		return types.ErrNotFound
+	case http.StatusTooManyRequests:
+		return types.ErrRateLimited
+	}
+	return nil
+}
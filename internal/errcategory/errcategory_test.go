@@ -0,0 +1,40 @@
+package errcategory
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap(t *testing.T) {
+	assert.NoError(t, Wrap(nil, types.ErrNotFound))
+
+	base := errors.New("base error")
+	assert.Equal(t, base, Wrap(base, nil))
+
+	err := Wrap(base, types.ErrBlobUnknown)
+	assert.Equal(t, "base error", err.Error())
+	assert.ErrorIs(t, err, base)
+	assert.ErrorIs(t, err, types.ErrBlobUnknown)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	assert.NotErrorIs(t, err, types.ErrManifestUnknown)
+}
+
+func TestFromHTTPStatus(t *testing.T) {
+	for _, c := range []struct {
+		status   int
+		expected error
+	}{
+		{http.StatusBadRequest, nil},
+		{http.StatusUnauthorized, types.ErrUnauthorized},
+		{http.StatusForbidden, types.ErrDenied},
+		{http.StatusNotFound, types.ErrNotFound},
+		{http.StatusTooManyRequests, types.ErrRateLimited},
+		{http.StatusInternalServerError, nil},
+	} {
+		assert.Equal(t, c.expected, FromHTTPStatus(c.status), c.status)
+	}
+}
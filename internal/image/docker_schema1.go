@@ -219,7 +219,7 @@ func (m *manifestSchema1) convertToManifestSchema2(_ context.Context, options *t
 	configDescriptor := manifest.Schema2Descriptor{
 		MediaType: "application/vnd.docker.container.image.v1+json",
 		Size:      int64(len(configJSON)),
-		Digest:    digest.FromBytes(configJSON),
+		Digest:    newObjectDigestAlgorithm(options).FromBytes(configJSON),
 	}
 
 	if options.LayerInfos != nil {
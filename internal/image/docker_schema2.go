@@ -37,28 +37,31 @@ var GzippedEmptyLayer = []byte{
 const GzippedEmptyLayerDigest = digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
 
 type manifestSchema2 struct {
-	src        types.ImageSource // May be nil if configBlob is not nil
-	configBlob []byte            // If set, corresponds to contents of ConfigDescriptor.
-	m          *manifest.Schema2
+	src           types.ImageSource // May be nil if configBlob is not nil
+	configBlob    []byte            // If set, corresponds to contents of ConfigDescriptor.
+	m             *manifest.Schema2
+	maxConfigSize int // The maximum size of configBlob when reading it from src
 }
 
-func manifestSchema2FromManifest(src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
+func manifestSchema2FromManifest(sys *types.SystemContext, src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
 	m, err := manifest.Schema2FromManifest(manifestBlob)
 	if err != nil {
 		return nil, err
 	}
 	return &manifestSchema2{
-		src: src,
-		m:   m,
+		src:           src,
+		m:             m,
+		maxConfigSize: iolimits.MaxConfigBodySizeFor(sys),
 	}, nil
 }
 
 // manifestSchema2FromComponents builds a new manifestSchema2 from the supplied data:
 func manifestSchema2FromComponents(config manifest.Schema2Descriptor, src types.ImageSource, configBlob []byte, layers []manifest.Schema2Descriptor) *manifestSchema2 {
 	return &manifestSchema2{
-		src:        src,
-		configBlob: configBlob,
-		m:          manifest.Schema2FromComponents(config, layers),
+		src:           src,
+		configBlob:    configBlob,
+		m:             manifest.Schema2FromComponents(config, layers),
+		maxConfigSize: iolimits.MaxConfigBodySize,
 	}
 }
 
@@ -106,13 +109,12 @@ func (m *manifestSchema2) ConfigBlob(ctx context.Context) ([]byte, error) {
 			return nil, err
 		}
 		defer stream.Close()
-		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		blob, err := iolimits.ReadAtMost(stream, m.maxConfigSize)
 		if err != nil {
 			return nil, err
 		}
-		computedDigest := digest.FromBytes(blob)
-		if computedDigest != m.m.ConfigDescriptor.Digest {
-			return nil, fmt.Errorf("Download config.json digest %s does not match expected %s", computedDigest, m.m.ConfigDescriptor.Digest)
+		if err := verifyConfigDigest(blob, m.m.ConfigDescriptor.Digest); err != nil {
+			return nil, err
 		}
 		m.configBlob = blob
 	}
@@ -163,9 +165,10 @@ func (m *manifestSchema2) UpdatedImageNeedsLayerDiffIDs(options types.ManifestUp
 // options.LayerInfos items is anything other than gzip.
 func (m *manifestSchema2) UpdatedImage(ctx context.Context, options types.ManifestUpdateOptions) (types.Image, error) {
 	copy := manifestSchema2{ // NOTE: This is not a deep copy, it still shares slices etc.
-		src:        m.src,
-		configBlob: m.configBlob,
-		m:          manifest.Schema2Clone(m.m),
+		src:           m.src,
+		configBlob:    m.configBlob,
+		m:             manifest.Schema2Clone(m.m),
+		maxConfigSize: m.maxConfigSize,
 	}
 
 	converted, err := convertManifestIfRequiredWithUpdate(ctx, options, map[string]manifestConvertFn{
@@ -205,7 +208,7 @@ func oci1DescriptorFromSchema2Descriptor(d manifest.Schema2Descriptor) imgspecv1
 // It may use options.InformationOnly and also adjust *options to be appropriate for editing the returned
 // value.
 // This does not change the state of the original manifestSchema2 object.
-func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context, _ *types.ManifestUpdateOptions) (genericManifest, error) {
+func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context, options *types.ManifestUpdateOptions) (genericManifest, error) {
 	configOCI, err := m.OCIConfig(ctx)
 	if err != nil {
 		return nil, err
@@ -218,7 +221,7 @@ func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context, _ *types.Ma
 	config := imgspecv1.Descriptor{
 		MediaType: imgspecv1.MediaTypeImageConfig,
 		Size:      int64(len(configOCIBytes)),
-		Digest:    digest.FromBytes(configOCIBytes),
+		Digest:    newObjectDigestAlgorithm(options).FromBytes(configOCIBytes),
 	}
 
 	layers := make([]imgspecv1.Descriptor, len(m.m.LayersDescriptors))
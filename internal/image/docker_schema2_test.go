@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
@@ -28,7 +29,7 @@ func manifestSchema2FromFixture(t *testing.T, src types.ImageSource, fixture str
 	manifest, err := os.ReadFile(filepath.Join("fixtures", fixture))
 	require.NoError(t, err)
 
-	m, err := manifestSchema2FromManifest(src, manifest)
+	m, err := manifestSchema2FromManifest(nil, src, manifest)
 	if mustFail {
 		require.Error(t, err)
 	} else {
@@ -76,7 +77,7 @@ func TestManifestSchema2FromManifest(t *testing.T) {
 	// values are correctly returned in tests for the individual getter methods.
 	_ = manifestSchema2FromFixture(t, mocks.ForbiddenImageSource{}, "schema2.json", false)
 
-	_, err := manifestSchema2FromManifest(nil, []byte{})
+	_, err := manifestSchema2FromManifest(nil, nil, []byte{})
 	assert.Error(t, err)
 }
 
@@ -532,7 +533,7 @@ func TestConvertToManifestOCI(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
 	// Layers have been updated as expected
-	ociManifest, err := manifestOCI1FromManifest(originalSrc, convertedJSON)
+	ociManifest, err := manifestOCI1FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -563,6 +564,33 @@ func TestConvertToManifestOCI(t *testing.T) {
 	}, ociManifest.LayerInfos())
 }
 
+// digestAlgorithmDest is a private.ImageDestinationWithDigestAlgorithm which only supports DigestAlgorithm.
+type digestAlgorithmDest struct {
+	private.ImageDestination // To implement the remaining methods; they will panic
+	algorithm                digest.Algorithm
+}
+
+func (d digestAlgorithmDest) DigestAlgorithm() digest.Algorithm {
+	return d.algorithm
+}
+
+func TestConvertToManifestOCIDigestAlgorithm(t *testing.T) {
+	originalSrc := newSchema2ImageSource(t, "httpd-copy:latest")
+	original := manifestSchema2FromFixture(t, originalSrc, "schema2.json", false)
+	res, err := original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		ManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+		InformationOnly: types.ManifestUpdateInformation{
+			Destination: digestAlgorithmDest{algorithm: digest.SHA512},
+		},
+	})
+	require.NoError(t, err)
+	convertedConfig, err := res.ConfigBlob(context.Background())
+	require.NoError(t, err)
+	configInfo := res.ConfigInfo()
+	assert.Equal(t, digest.SHA512, configInfo.Digest.Algorithm())
+	assert.Equal(t, digest.SHA512.FromBytes(convertedConfig), configInfo.Digest)
+}
+
 func TestConvertToManifestOCIAllMediaTypes(t *testing.T) {
 	originalSrc := newSchema2ImageSource(t, "httpd-copy:latest")
 	original := manifestSchema2FromFixture(t, originalSrc, "schema2-all-media-types.json", false)
@@ -0,0 +1,145 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// InspectInfo is a summary of a single image, as returned by Inspect.
+type InspectInfo struct {
+	types.ImageInspectInfo // LayersData contains the sizes and MIME types of the layers as stored in the source (typically compressed).
+
+	ManifestDigest   digest.Digest // Digest of the manifest of the inspected image (the chosen instance, if the source contains a manifest list)
+	ManifestMIMEType string
+	ManifestSize     int64
+	// Config describes the config blob, or is BlobInfo{Digest: ""} if the image doesn’t have a separate config object.
+	Config types.BlobInfo
+	// History is the image’s creation history, oldest first.
+	History []imgspecv1.History
+}
+
+// Inspect returns a summary of the image instanceDigest in src (or of its primary manifest, if instanceDigest is nil).
+// If that is a manifest list, an instance appropriate for sys is chosen, like FromSource does.
+//
+// Unlike FromSource(…).Inspect, this only fetches and parses the manifest(s) and the config blob, and does not build
+// any of the other state necessary to use or copy the image; it is intended for callers which inspect many images.
+func Inspect(ctx context.Context, sys *types.SystemContext, src types.ImageSource, instanceDigest *digest.Digest) (*InspectInfo, error) {
+	manblob, mt, err := UnparsedInstance(src, instanceDigest).Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mt == "" {
+		mt = manifest.GuessMIMEType(manblob)
+	}
+	var manifestDigest digest.Digest
+	if manifest.MIMETypeIsMultiImage(mt) {
+		list, err := internalManifest.ListFromBlob(manblob, manifest.NormalizedMIMEType(mt))
+		if err != nil {
+			return nil, fmt.Errorf("parsing manifest list: %w", err)
+		}
+		manifestDigest, manblob, mt, err = ChooseInstance(ctx, sys, src, list, types.OptionalBoolFalse)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		manifestDigest, err = manifest.Digest(manblob)
+		if err != nil {
+			return nil, fmt.Errorf("computing manifest digest: %w", err)
+		}
+	}
+
+	m, err := manifest.FromBlob(manblob, mt)
+	if err != nil {
+		return nil, err
+	}
+	var configBlob []byte
+	info, err := m.Inspect(func(bi types.BlobInfo) ([]byte, error) {
+		configBlob, err = fetchConfig(ctx, sys, src, bi)
+		return configBlob, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	history, err := inspectHistory(m, configBlob)
+	if err != nil {
+		return nil, err
+	}
+	return &InspectInfo{
+		ImageInspectInfo: *info,
+		ManifestDigest:   manifestDigest,
+		ManifestMIMEType: manifest.NormalizedMIMEType(mt),
+		ManifestSize:     int64(len(manblob)),
+		Config:           m.ConfigInfo(),
+		History:          history,
+	}, nil
+}
+
+// fetchConfig returns the config blob described by info from src, after verifying its digest.
+func fetchConfig(ctx context.Context, sys *types.SystemContext, src types.ImageSource, info types.BlobInfo) ([]byte, error) {
+	stream, _, err := src.GetBlob(ctx, info, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySizeFor(sys))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyConfigDigest(blob, info.Digest); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// verifyConfigDigest returns an error if blob does not match expected, which may use any supported digest algorithm.
+func verifyConfigDigest(blob []byte, expected digest.Digest) error {
+	if err := expected.Validate(); err != nil {
+		return fmt.Errorf("invalid config digest %q: %w", expected, err)
+	}
+	computedDigest := expected.Algorithm().FromBytes(blob)
+	if computedDigest != expected {
+		return fmt.Errorf("Download config.json digest %s does not match expected %s", computedDigest, expected)
+	}
+	return nil
+}
+
+// inspectHistory returns the creation history of an image with manifest m and configBlob (which is nil
+// for formats without a separate config object), oldest first.
+func inspectHistory(m manifest.Manifest, configBlob []byte) ([]imgspecv1.History, error) {
+	if s1, ok := m.(*manifest.Schema1); ok {
+		// Schema1 lists the history newest first; this matches the conversion in manifest.Schema1.ToSchema2Config.
+		history := make([]imgspecv1.History, 0, len(s1.ExtractedV1Compatibility))
+		for i := len(s1.ExtractedV1Compatibility) - 1; i >= 0; i-- {
+			compat := &s1.ExtractedV1Compatibility[i]
+			history = append(history, imgspecv1.History{
+				Created:    &compat.Created,
+				CreatedBy:  strings.Join(compat.ContainerConfig.Cmd, " "),
+				Author:     compat.Author,
+				Comment:    compat.Comment,
+				EmptyLayer: compat.ThrowAway,
+			})
+		}
+		return history, nil
+	}
+	if configBlob == nil {
+		return nil, nil
+	}
+	// Docker schema2 and OCI configs use the same representation of the history.
+	var config struct {
+		History []imgspecv1.History `json:"history,omitempty"`
+	}
+	if err := json.Unmarshal(configBlob, &config); err != nil {
+		return nil, fmt.Errorf("parsing image config history: %w", err)
+	}
+	return config.History, nil
+}
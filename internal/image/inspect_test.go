@@ -0,0 +1,155 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inspectImageSource is a types.ImageSource which only supports GetManifest and GetBlob, and counts GetBlob calls.
+type inspectImageSource struct {
+	types.ImageSource // To implement the remaining methods; they will panic
+	primary           []byte
+	primaryMIMEType   string
+	instances         map[digest.Digest][]byte
+	blobs             map[digest.Digest][]byte
+	getBlobCalls      int
+}
+
+func (s *inspectImageSource) Reference() types.ImageReference {
+	return inspectImageReference{}
+}
+
+func (s *inspectImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest == nil {
+		return s.primary, s.primaryMIMEType, nil
+	}
+	return s.instances[*instanceDigest], "", nil
+}
+
+func (s *inspectImageSource) GetBlob(ctx context.Context, info types.BlobInfo, _ types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	s.getBlobCalls++
+	blob, ok := s.blobs[info.Digest]
+	if !ok {
+		return nil, -1, types.ErrBlobUnknown
+	}
+	return io.NopCloser(bytes.NewReader(blob)), int64(len(blob)), nil
+}
+
+// inspectImageReference is a mock of types.ImageReference for inspectImageSource.
+type inspectImageReference struct {
+	mocks.ForbiddenImageReference // We inherit almost all of the methods, which just panic()
+}
+
+func (ref inspectImageReference) Transport() types.ImageTransport {
+	return mocks.NameImageTransport("==Inspect")
+}
+
+func (ref inspectImageReference) DockerReference() reference.Named {
+	return nil
+}
+
+func TestInspect(t *testing.T) {
+	ctx := context.Background()
+	ociManifest, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+	require.NoError(t, err)
+	config, err := os.ReadFile(filepath.Join("fixtures", "oci1-config.json"))
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(ociManifest)
+	blobs := map[digest.Digest][]byte{commonFixtureConfigDigest: config}
+
+	for _, c := range []struct {
+		name     string
+		primary  []byte
+		mimeType string
+	}{
+		{"single image", ociManifest, imgspecv1.MediaTypeImageManifest},
+		{"single image, unknown MIME type", ociManifest, ""},
+		{"index", []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + manifestDigest.String() + `","size":1,` +
+			`"platform":{"architecture":"amd64","os":"linux"}}]}`), imgspecv1.MediaTypeImageIndex},
+	} {
+		src := &inspectImageSource{
+			primary:         c.primary,
+			primaryMIMEType: c.mimeType,
+			instances:       map[digest.Digest][]byte{manifestDigest: ociManifest},
+			blobs:           blobs,
+		}
+		info, err := Inspect(ctx, &types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "linux"}, src, nil)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, 1, src.getBlobCalls, c.name)
+		assert.Equal(t, manifestDigest, info.ManifestDigest, c.name)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, info.ManifestMIMEType, c.name)
+		assert.Equal(t, int64(len(ociManifest)), info.ManifestSize, c.name)
+		assert.Equal(t, digest.Digest(commonFixtureConfigDigest), info.Config.Digest, c.name)
+		assert.Equal(t, int64(5940), info.Config.Size, c.name)
+		assert.Equal(t, "amd64", info.Architecture, c.name)
+		assert.Contains(t, info.Env, "HTTPD_VERSION=2.4.23", c.name)
+		require.Len(t, info.LayersData, 5, c.name)
+		assert.Equal(t, int64(51354364), info.LayersData[0].Size, c.name)
+		assert.Len(t, info.History, 15, c.name)
+	}
+
+	// A config which does not match its digest
+	src := &inspectImageSource{
+		primary:         ociManifest,
+		primaryMIMEType: imgspecv1.MediaTypeImageManifest,
+		blobs:           map[digest.Digest][]byte{commonFixtureConfigDigest: []byte("{}")},
+	}
+	_, err = Inspect(ctx, nil, src, nil)
+	assert.Error(t, err)
+
+	// A missing config
+	src = &inspectImageSource{
+		primary:         ociManifest,
+		primaryMIMEType: imgspecv1.MediaTypeImageManifest,
+		blobs:           map[digest.Digest][]byte{},
+	}
+	_, err = Inspect(ctx, nil, src, nil)
+	assert.ErrorIs(t, err, types.ErrBlobUnknown)
+
+	// Schema1 has no config blob
+	schema1, err := os.ReadFile(filepath.Join("fixtures", "schema1.json"))
+	require.NoError(t, err)
+	src = &inspectImageSource{
+		primary:         schema1,
+		primaryMIMEType: manifest.DockerV2Schema1SignedMediaType,
+	}
+	info, err := Inspect(ctx, nil, src, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, src.getBlobCalls)
+	assert.Equal(t, "latest", info.Tag)
+	assert.Equal(t, digest.Digest(""), info.Config.Digest)
+	require.Len(t, info.History, 6)
+	assert.True(t, info.History[0].Created.Before(*info.History[5].Created))
+}
+
+func TestVerifyConfigDigest(t *testing.T) {
+	blob := []byte(`{"architecture":"amd64"}`)
+	for _, algo := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+		err := verifyConfigDigest(blob, algo.FromBytes(blob))
+		assert.NoError(t, err, algo.String())
+		err = verifyConfigDigest([]byte("other"), algo.FromBytes(blob))
+		assert.Error(t, err, algo.String())
+	}
+	for _, d := range []digest.Digest{
+		"",
+		"sha256:invalid",
+		"unknown:0123456789abcdef",
+	} {
+		err := verifyConfigDigest(blob, d)
+		assert.Error(t, err, string(d))
+	}
+}
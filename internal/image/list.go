@@ -0,0 +1,55 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// MaxNestedListDepth is the maximum number of manifest lists, including the top-level one, followed when
+// processing nested manifest lists (e.g. by ChooseInstance).
+const MaxNestedListDepth = 8
+
+// ChooseInstance returns the digest, manifest and MIME type of the instance of list, a manifest list in src,
+// most appropriate for the platform described by sys (preferring gzip or zstd instances according to preferGzip,
+// see manifest.List.ChooseInstanceByCompression).
+// If the chosen instance is itself a manifest list (some build systems create such “nested indexes”), an instance
+// is chosen from that list, recursively, so that the returned instance is never a manifest list.
+func ChooseInstance(ctx context.Context, sys *types.SystemContext, src types.ImageSource, list manifest.List, preferGzip types.OptionalBool) (digest.Digest, []byte, string, error) {
+	for depth := 1; ; depth++ {
+		instanceDigest, err := list.ChooseInstanceByCompression(sys, preferGzip)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("choosing image instance: %w", err)
+		}
+		manblob, mt, err := src.GetManifest(ctx, &instanceDigest)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("fetching target platform image selected from manifest list: %w", err)
+		}
+		matches, err := manifest.MatchesDigest(manblob, instanceDigest)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("computing manifest digest: %w", err)
+		}
+		if !matches {
+			return "", nil, "", fmt.Errorf("Image manifest does not match selected manifest digest %s", instanceDigest)
+		}
+		if mt == "" {
+			mt = manifest.GuessMIMEType(manblob)
+		}
+		normalized := manifest.NormalizedMIMEType(mt)
+		if normalized != manifest.DockerV2ListMediaType && normalized != imgspecv1.MediaTypeImageIndex {
+			return instanceDigest, manblob, mt, nil
+		}
+
+		if depth >= MaxNestedListDepth {
+			return "", nil, "", fmt.Errorf("manifest lists are nested more than %d levels deep", MaxNestedListDepth)
+		}
+		list, err = manifest.ListFromBlob(manblob, normalized)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("parsing nested manifest list %s: %w", instanceDigest, err)
+		}
+	}
+}
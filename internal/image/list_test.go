@@ -0,0 +1,90 @@
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestsImageSource is a types.ImageSource which only supports GetManifest of instances.
+type manifestsImageSource struct {
+	types.ImageSource // To implement the remaining methods; they will panic
+	manifests         map[digest.Digest][]byte
+	mimeTypes         map[digest.Digest]string
+}
+
+func (s *manifestsImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	return s.manifests[*instanceDigest], s.mimeTypes[*instanceDigest], nil
+}
+
+// add adds an instance with blob and mimeType to s, and returns a descriptor of it.
+func (s *manifestsImageSource) add(blob []byte, mimeType string, platform *imgspecv1.Platform) imgspecv1.Descriptor {
+	d := digest.FromBytes(blob)
+	s.manifests[d] = blob
+	s.mimeTypes[d] = mimeType
+	return imgspecv1.Descriptor{MediaType: mimeType, Digest: d, Size: int64(len(blob)), Platform: platform}
+}
+
+// ociIndexFromComponents returns an OCI index containing components.
+func ociIndexFromComponents(components []imgspecv1.Descriptor) *manifest.OCI1Index {
+	return &manifest.OCI1Index{OCI1IndexPublic: *manifest.OCI1IndexPublicFromComponents(components, nil)}
+}
+
+func TestChooseInstance(t *testing.T) {
+	ctx := context.Background()
+	sys := &types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "linux"}
+	src := &manifestsImageSource{manifests: map[digest.Digest][]byte{}, mimeTypes: map[digest.Digest]string{}}
+	amd64 := src.add([]byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"size":1}]}`),
+		imgspecv1.MediaTypeImageManifest, &imgspecv1.Platform{OS: "linux", Architecture: "amd64"})
+	arm64 := src.add([]byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"size":2}]}`),
+		imgspecv1.MediaTypeImageManifest, &imgspecv1.Platform{OS: "linux", Architecture: "arm64"})
+
+	// A list without nesting
+	list := ociIndexFromComponents([]imgspecv1.Descriptor{arm64, amd64})
+	instanceDigest, manblob, mt, err := ChooseInstance(ctx, sys, src, list, types.OptionalBoolFalse)
+	require.NoError(t, err)
+	assert.Equal(t, amd64.Digest, instanceDigest)
+	assert.Equal(t, src.manifests[amd64.Digest], manblob)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
+
+	// Nested lists
+	nested := list
+	for i := 0; i < 3; i++ {
+		blob, err := nested.Serialize()
+		require.NoError(t, err)
+		nestedDesc := src.add(blob, imgspecv1.MediaTypeImageIndex, nil)
+		nested = ociIndexFromComponents([]imgspecv1.Descriptor{nestedDesc})
+		instanceDigest, manblob, mt, err = ChooseInstance(ctx, sys, src, nested, types.OptionalBoolFalse)
+		require.NoError(t, err)
+		assert.Equal(t, amd64.Digest, instanceDigest)
+		assert.Equal(t, src.manifests[amd64.Digest], manblob)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
+	}
+
+	// No matching instance in the nested list
+	_, _, _, err = ChooseInstance(ctx, &types.SystemContext{ArchitectureChoice: "s390x", OSChoice: "linux"}, src, nested, types.OptionalBoolFalse)
+	assert.Error(t, err)
+
+	// Too deeply nested lists
+	for i := 0; i < MaxNestedListDepth; i++ {
+		blob, err := nested.Serialize()
+		require.NoError(t, err)
+		nestedDesc := src.add(blob, imgspecv1.MediaTypeImageIndex, nil)
+		nested = ociIndexFromComponents([]imgspecv1.Descriptor{nestedDesc})
+	}
+	_, _, _, err = ChooseInstance(ctx, sys, src, nested, types.OptionalBoolFalse)
+	assert.Error(t, err)
+
+	// An instance not matching its digest
+	bad := amd64
+	bad.Digest = digest.FromString("does not match")
+	src.manifests[bad.Digest] = src.manifests[amd64.Digest]
+	_, _, _, err = ChooseInstance(ctx, sys, src, ociIndexFromComponents([]imgspecv1.Descriptor{bad}), types.OptionalBoolFalse)
+	assert.Error(t, err)
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -68,9 +70,9 @@ func manifestInstanceFromBlob(ctx context.Context, sys *types.SystemContext, src
 	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType:
 		return manifestSchema1FromManifest(manblob)
 	case imgspecv1.MediaTypeImageManifest:
-		return manifestOCI1FromManifest(src, manblob)
+		return manifestOCI1FromManifest(sys, src, manblob)
 	case manifest.DockerV2Schema2MediaType:
-		return manifestSchema2FromManifest(src, manblob)
+		return manifestSchema2FromManifest(sys, src, manblob)
 	case manifest.DockerV2ListMediaType:
 		return manifestSchema2FromManifestList(ctx, sys, src, manblob)
 	case imgspecv1.MediaTypeImageIndex:
@@ -119,3 +121,14 @@ func convertManifestIfRequiredWithUpdate(ctx context.Context, options types.Mani
 	optionsCopy.ManifestMIMEType = ""
 	return convertedImage.UpdatedImage(ctx, optionsCopy)
 }
+
+// newObjectDigestAlgorithm returns the digest algorithm to use for objects (e.g. config blobs) created by
+// conversions using options: the one used by options.InformationOnly.Destination, if it is known, or digest.Canonical.
+func newObjectDigestAlgorithm(options *types.ManifestUpdateOptions) digest.Algorithm {
+	if options != nil {
+		if dest, ok := options.InformationOnly.Destination.(private.ImageDestinationWithDigestAlgorithm); ok {
+			return dest.DigestAlgorithm()
+		}
+	}
+	return digest.Canonical
+}
@@ -14,33 +14,35 @@ import (
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/types"
 	ociencspec "github.com/containers/ocicrypt/spec"
-	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type manifestOCI1 struct {
-	src        types.ImageSource // May be nil if configBlob is not nil
-	configBlob []byte            // If set, corresponds to contents of m.Config.
-	m          *manifest.OCI1
+	src           types.ImageSource // May be nil if configBlob is not nil
+	configBlob    []byte            // If set, corresponds to contents of m.Config.
+	m             *manifest.OCI1
+	maxConfigSize int // The maximum size of configBlob when reading it from src
 }
 
-func manifestOCI1FromManifest(src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
+func manifestOCI1FromManifest(sys *types.SystemContext, src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
 	m, err := manifest.OCI1FromManifest(manifestBlob)
 	if err != nil {
 		return nil, err
 	}
 	return &manifestOCI1{
-		src: src,
-		m:   m,
+		src:           src,
+		m:             m,
+		maxConfigSize: iolimits.MaxConfigBodySizeFor(sys),
 	}, nil
 }
 
 // manifestOCI1FromComponents builds a new manifestOCI1 from the supplied data:
 func manifestOCI1FromComponents(config imgspecv1.Descriptor, src types.ImageSource, configBlob []byte, layers []imgspecv1.Descriptor) genericManifest {
 	return &manifestOCI1{
-		src:        src,
-		configBlob: configBlob,
-		m:          manifest.OCI1FromComponents(config, layers),
+		src:           src,
+		configBlob:    configBlob,
+		m:             manifest.OCI1FromComponents(config, layers),
+		maxConfigSize: iolimits.MaxConfigBodySize,
 	}
 }
 
@@ -70,13 +72,12 @@ func (m *manifestOCI1) ConfigBlob(ctx context.Context) ([]byte, error) {
 			return nil, err
 		}
 		defer stream.Close()
-		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		blob, err := iolimits.ReadAtMost(stream, m.maxConfigSize)
 		if err != nil {
 			return nil, err
 		}
-		computedDigest := digest.FromBytes(blob)
-		if computedDigest != m.m.Config.Digest {
-			return nil, fmt.Errorf("Download config.json digest %s does not match expected %s", computedDigest, m.m.Config.Digest)
+		if err := verifyConfigDigest(blob, m.m.Config.Digest); err != nil {
+			return nil, err
 		}
 		m.configBlob = blob
 	}
@@ -147,9 +148,10 @@ func (m *manifestOCI1) UpdatedImageNeedsLayerDiffIDs(options types.ManifestUpdat
 // an algorithm that is not allowed in OCI.
 func (m *manifestOCI1) UpdatedImage(ctx context.Context, options types.ManifestUpdateOptions) (types.Image, error) {
 	copy := manifestOCI1{ // NOTE: This is not a deep copy, it still shares slices etc.
-		src:        m.src,
-		configBlob: m.configBlob,
-		m:          manifest.OCI1Clone(m.m),
+		src:           m.src,
+		configBlob:    m.configBlob,
+		m:             manifest.OCI1Clone(m.m),
+		maxConfigSize: m.maxConfigSize,
 	}
 
 	converted, err := convertManifestIfRequiredWithUpdate(ctx, options, map[string]manifestConvertFn{
@@ -241,13 +243,29 @@ func (m *manifestOCI1) layerEditsOfOCIOnlyFeatures(options *types.ManifestUpdate
 	return ociOnlyEdits, nil
 }
 
+// checkConvertibleToDocker returns an error if m can’t be converted to a Docker manifest with targetMIMEType
+// without losing information.
+func (m *manifestOCI1) checkConvertibleToDocker(targetMIMEType string) error {
+	if m.m.Config.MediaType != imgspecv1.MediaTypeImageConfig {
+		return internalManifest.NewNonImageArtifactError(&m.m.Manifest)
+	}
+	// Docker manifests can’t refer to other manifests, and don’t have an artifact type.
+	if m.m.Subject != nil {
+		return internalManifest.UnsupportedFieldConversionError{Field: "subject", TargetMIMEType: targetMIMEType}
+	}
+	if m.m.ArtifactType != "" {
+		return internalManifest.UnsupportedFieldConversionError{Field: "artifactType", TargetMIMEType: targetMIMEType}
+	}
+	return nil
+}
+
 // convertToManifestSchema2 returns a genericManifest implementation converted to manifest.DockerV2Schema2MediaType.
 // It may use options.InformationOnly and also adjust *options to be appropriate for editing the returned
 // value.
 // This does not change the state of the original manifestOCI1 object.
 func (m *manifestOCI1) convertToManifestSchema2(_ context.Context, options *types.ManifestUpdateOptions) (*manifestSchema2, error) {
-	if m.m.Config.MediaType != imgspecv1.MediaTypeImageConfig {
-		return nil, internalManifest.NewNonImageArtifactError(&m.m.Manifest)
+	if err := m.checkConvertibleToDocker(manifest.DockerV2Schema2MediaType); err != nil {
+		return nil, err
 	}
 
 	// Mostly we first make a format conversion, and _afterwards_ do layer edits. But first we need to do the layer edits
@@ -308,8 +326,8 @@ func (m *manifestOCI1) convertToManifestSchema2(_ context.Context, options *type
 // value.
 // This does not change the state of the original manifestOCI1 object.
 func (m *manifestOCI1) convertToManifestSchema1(ctx context.Context, options *types.ManifestUpdateOptions) (genericManifest, error) {
-	if m.m.Config.MediaType != imgspecv1.MediaTypeImageConfig {
-		return nil, internalManifest.NewNonImageArtifactError(&m.m.Manifest)
+	if err := m.checkConvertibleToDocker(options.ManifestMIMEType); err != nil {
+		return nil, err
 	}
 
 	// We can't directly convert images to V1, but we can transitively convert via a V2 image
@@ -13,22 +13,9 @@ func manifestOCI1FromImageIndex(ctx context.Context, sys *types.SystemContext, s
 	if err != nil {
 		return nil, fmt.Errorf("parsing OCI1 index: %w", err)
 	}
-	targetManifestDigest, err := index.ChooseInstance(sys)
+	_, manblob, mt, err := ChooseInstance(ctx, sys, src, index, types.OptionalBoolFalse)
 	if err != nil {
-		return nil, fmt.Errorf("choosing image instance: %w", err)
+		return nil, err
 	}
-	manblob, mt, err := src.GetManifest(ctx, &targetManifestDigest)
-	if err != nil {
-		return nil, fmt.Errorf("fetching target platform image selected from image index: %w", err)
-	}
-
-	matches, err := manifest.MatchesDigest(manblob, targetManifestDigest)
-	if err != nil {
-		return nil, fmt.Errorf("computing manifest digest: %w", err)
-	}
-	if !matches {
-		return nil, fmt.Errorf("Image manifest does not match selected manifest digest %s", targetManifestDigest)
-	}
-
 	return manifestInstanceFromBlob(ctx, sys, src, manblob, mt)
 }
@@ -28,7 +28,7 @@ func manifestOCI1FromFixture(t *testing.T, src types.ImageSource, fixture string
 	manifest, err := os.ReadFile(filepath.Join("fixtures", fixture))
 	require.NoError(t, err)
 
-	m, err := manifestOCI1FromManifest(src, manifest)
+	m, err := manifestOCI1FromManifest(nil, src, manifest)
 	require.NoError(t, err)
 	return m
 }
@@ -96,7 +96,7 @@ func TestManifestOCI1FromManifest(t *testing.T) {
 	// values are correctly returned in tests for the individual getter methods.
 	_ = manifestOCI1FromFixture(t, mocks.ForbiddenImageSource{}, "oci1.json")
 
-	_, err := manifestOCI1FromManifest(nil, []byte{})
+	_, err := manifestOCI1FromManifest(nil, nil, []byte{})
 	assert.Error(t, err)
 }
 
@@ -204,6 +204,39 @@ func TestManifestOCI1ConfigBlob(t *testing.T) {
 	assert.Equal(t, configBlob, cb)
 }
 
+func TestManifestOCI1ConfigBlobSizeLimit(t *testing.T) {
+	realConfigJSON, err := os.ReadFile("fixtures/oci1-config.json")
+	require.NoError(t, err)
+	manifest, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+	require.NoError(t, err)
+	src := configBlobImageSource{
+		expectedDigest: commonFixtureConfigDigest,
+		f: func() (io.ReadCloser, int64, error) {
+			return io.NopCloser(bytes.NewReader(realConfigJSON)), int64(len(realConfigJSON)), nil
+		},
+	}
+
+	for _, c := range []struct {
+		limit   int
+		success bool
+	}{
+		{0, true}, // The default limit
+		{len(realConfigJSON), true},
+		{len(realConfigJSON) - 1, false},
+	} {
+		sys := &types.SystemContext{ParsingLimits: types.ParsingLimits{MaxConfigSize: c.limit}}
+		m, err := manifestOCI1FromManifest(sys, src, manifest)
+		require.NoError(t, err)
+		blob, err := m.ConfigBlob(context.Background())
+		if c.success {
+			require.NoError(t, err, c.limit)
+			assert.Equal(t, realConfigJSON, blob)
+		} else {
+			assert.Error(t, err, c.limit)
+		}
+	}
+}
+
 func TestManifestOCI1OCIConfig(t *testing.T) {
 	// Just a smoke-test that the code can read the data…
 	configJSON, err := os.ReadFile("fixtures/oci1-config.json")
@@ -557,6 +590,35 @@ func TestManifestOCI1ConvertToManifestSchema1(t *testing.T) {
 	var expected manifest.NonImageArtifactError
 	assert.ErrorAs(t, err, &expected)
 
+	// Conversion of an image with a subject or an artifact type fails, instead of dropping the fields
+	for _, edit := range []func(m *manifest.OCI1){
+		func(m *manifest.OCI1) {
+			m.Subject = &imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: commonFixtureConfigDigest, Size: 1}
+		},
+		func(m *manifest.OCI1) { m.ArtifactType = "application/vnd.example.image" },
+	} {
+		fixture, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+		require.NoError(t, err)
+		parsed, err := manifest.OCI1FromManifest(fixture)
+		require.NoError(t, err)
+		edit(parsed)
+		edited, err := parsed.Serialize()
+		require.NoError(t, err)
+		withFields, err := manifestOCI1FromManifest(nil, originalSrc, edited)
+		require.NoError(t, err)
+		for _, mimeType := range []string{manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema1SignedMediaType} {
+			_, err = withFields.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+				ManifestMIMEType: mimeType,
+				InformationOnly: types.ManifestUpdateInformation{
+					Destination: &memoryImageDest{ref: originalSrc.ref},
+				},
+			})
+			var unsupportedField manifest.UnsupportedFieldConversionError
+			require.ErrorAs(t, err, &unsupportedField, mimeType)
+			assert.Equal(t, mimeType, unsupportedField.TargetMIMEType)
+		}
+	}
+
 	// Conversion of an encrypted image fails
 	encrypted := manifestOCI1FromFixture(t, originalSrc, "oci1.encrypted.json")
 	encrypted2 := manifestOCI1FromFixture(t, originalSrc, "oci1.encrypted.json")
@@ -697,6 +759,35 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	var expected manifest.NonImageArtifactError
 	assert.ErrorAs(t, err, &expected)
 
+	// Conversion of an image with a subject or an artifact type fails, instead of dropping the fields
+	for _, edit := range []func(m *manifest.OCI1){
+		func(m *manifest.OCI1) {
+			m.Subject = &imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: commonFixtureConfigDigest, Size: 1}
+		},
+		func(m *manifest.OCI1) { m.ArtifactType = "application/vnd.example.image" },
+	} {
+		fixture, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+		require.NoError(t, err)
+		parsed, err := manifest.OCI1FromManifest(fixture)
+		require.NoError(t, err)
+		edit(parsed)
+		edited, err := parsed.Serialize()
+		require.NoError(t, err)
+		withFields, err := manifestOCI1FromManifest(nil, originalSrc, edited)
+		require.NoError(t, err)
+		for _, mimeType := range []string{manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema1SignedMediaType} {
+			_, err = withFields.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+				ManifestMIMEType: mimeType,
+				InformationOnly: types.ManifestUpdateInformation{
+					Destination: &memoryImageDest{ref: originalSrc.ref},
+				},
+			})
+			var unsupportedField manifest.UnsupportedFieldConversionError
+			require.ErrorAs(t, err, &unsupportedField, mimeType)
+			assert.Equal(t, mimeType, unsupportedField.TargetMIMEType)
+		}
+	}
+
 	// Conversion of an encrypted image fails
 	encrypted := manifestOCI1FromFixture(t, originalSrc, "oci1.encrypted.json")
 	encrypted2 := manifestOCI1FromFixture(t, originalSrc, "oci1.encrypted.json")
@@ -723,7 +814,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err := manifestSchema2FromManifest(originalSrc, convertedJSON)
+	s2Manifest, err := manifestSchema2FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -777,7 +868,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err = manifestSchema2FromManifest(mixedSrc, convertedJSON)
+	s2Manifest, err = manifestSchema2FromManifest(nil, mixedSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -826,7 +917,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err = manifestSchema2FromManifest(mixedSrc, convertedJSON)
+	s2Manifest, err = manifestSchema2FromManifest(nil, mixedSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -872,7 +963,7 @@ func TestConvertToV2S2WithInvalidMIMEType(t *testing.T) {
 	manifest, err := os.ReadFile(filepath.Join("fixtures", "oci1-invalid-media-type.json"))
 	require.NoError(t, err)
 
-	_, err = manifestOCI1FromManifest(originalSrc, manifest)
+	_, err = manifestOCI1FromManifest(nil, originalSrc, manifest)
 	require.NoError(t, err)
 }
 
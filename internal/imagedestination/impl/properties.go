@@ -21,6 +21,9 @@ type Properties struct {
 	IgnoresEmbeddedDockerReference bool
 	// HasThreadSafePutBlob indicates that PutBlob can be executed concurrently.
 	HasThreadSafePutBlob bool
+	// AcceptsNonImageArtifacts is set to true if the destination can store manifests whose config is not an image configuration,
+	// verbatim.
+	AcceptsNonImageArtifacts bool
 }
 
 // PropertyMethodsInitialize implements parts of private.ImageDestination corresponding to Properties.
@@ -70,3 +73,9 @@ func (o PropertyMethodsInitialize) IgnoresEmbeddedDockerReference() bool {
 func (o PropertyMethodsInitialize) HasThreadSafePutBlob() bool {
 	return o.vals.HasThreadSafePutBlob
 }
+
+// AcceptsNonImageArtifacts returns true if the destination can store manifests whose config is not an image configuration
+// (e.g. OCI artifacts like Helm charts), verbatim.
+func (o PropertyMethodsInitialize) AcceptsNonImageArtifacts() bool {
+	return o.vals.AcceptsNonImageArtifacts
+}
@@ -33,11 +33,22 @@ func FromPublic(dest types.ImageDestination) private.ImageDestination {
 	if dest2, ok := dest.(private.ImageDestination); ok {
 		return dest2
 	}
-	return &wrapped{
+	w := &wrapped{
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(dest.Reference()),
 
 		ImageDestination: dest,
 	}
+	if partial, ok := dest.(types.ImageDestinationWithPartialBlobs); ok {
+		return &wrappedWithPartialBlobs{wrapped: w, partial: partial}
+	}
+	return w
+}
+
+// AcceptsNonImageArtifacts returns true if the destination can store manifests whose config is not an image configuration
+// (e.g. OCI artifacts like Helm charts), verbatim.
+// The public API does not provide this information, so assume the destination can not.
+func (w *wrapped) AcceptsNonImageArtifacts() bool {
+	return false
 }
 
 // PutBlobWithOptions writes contents of stream and returns data representing the result.
@@ -94,3 +105,34 @@ func (w *wrapped) PutSignaturesWithFormat(ctx context.Context, signatures []sign
 	}
 	return w.PutSignatures(ctx, simpleSigs, instanceDigest)
 }
+
+// wrappedWithPartialBlobs provides the private.ImageDestination operations
+// for a destination that implements types.ImageDestinationWithPartialBlobs
+type wrappedWithPartialBlobs struct {
+	*wrapped
+	partial types.ImageDestinationWithPartialBlobs
+}
+
+// SupportsPutBlobPartial returns true if PutBlobPartial is supported.
+func (w *wrappedWithPartialBlobs) SupportsPutBlobPartial() bool {
+	return w.partial.SupportsPutBlobPartial()
+}
+
+// PutBlobPartial attempts to create a blob using the data that is already present
+// at the destination. chunkAccessor is accessed in a non-sequential way to retrieve the missing chunks.
+// It is available only if SupportsPutBlobPartial().
+// Even if SupportsPutBlobPartial() returns true, the call can fail, in which case the caller
+// should fall back to PutBlobWithOptions.
+func (w *wrappedWithPartialBlobs) PutBlobPartial(ctx context.Context, chunkAccessor private.BlobChunkAccessor, srcInfo types.BlobInfo, options private.PutBlobPartialOptions) (private.UploadedBlob, error) {
+	res, err := w.partial.PutBlobPartial(ctx, chunkAccessor, srcInfo, types.PutBlobPartialOptions{
+		Cache:      options.Cache,
+		LayerIndex: options.LayerIndex,
+	})
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	return private.UploadedBlob{
+		Digest: res.Digest,
+		Size:   res.Size,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package imagedestination
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// publicDestination is a types.ImageDestination which only implements the public API.
+type publicDestination struct {
+	types.ImageDestination
+}
+
+// partialDestination is a types.ImageDestinationWithPartialBlobs.
+type partialDestination struct {
+	types.ImageDestination
+	options types.PutBlobPartialOptions
+}
+
+func (d *partialDestination) SupportsPutBlobPartial() bool {
+	return true
+}
+
+func (d *partialDestination) PutBlobPartial(ctx context.Context, chunkAccessor types.BlobChunkAccessor, srcInfo types.BlobInfo, options types.PutBlobPartialOptions) (types.BlobInfo, error) {
+	d.options = options
+	if srcInfo.Size < 0 {
+		return types.BlobInfo{}, errors.New("unknown size")
+	}
+	return types.BlobInfo{Digest: srcInfo.Digest, Size: srcInfo.Size}, nil
+}
+
+func TestFromPublicPartialBlobs(t *testing.T) {
+	ref, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dirDest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dirDest.Close()
+
+	dest := FromPublic(&publicDestination{ImageDestination: dirDest})
+	assert.False(t, dest.SupportsPutBlobPartial())
+
+	partial := &partialDestination{ImageDestination: dirDest}
+	dest = FromPublic(partial)
+	assert.True(t, dest.SupportsPutBlobPartial())
+	blobDigest := digest.FromString("blob")
+	res, err := dest.PutBlobPartial(context.Background(), nil, types.BlobInfo{Digest: blobDigest, Size: 4}, private.PutBlobPartialOptions{LayerIndex: 2})
+	require.NoError(t, err)
+	assert.Equal(t, private.UploadedBlob{Digest: blobDigest, Size: 4}, res)
+	assert.Equal(t, 2, partial.options.LayerIndex)
+	_, err = dest.PutBlobPartial(context.Background(), nil, types.BlobInfo{Digest: blobDigest, Size: -1}, private.PutBlobPartialOptions{})
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package imagesource
 
 import (
 	"context"
+	"io"
 
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/private"
@@ -32,11 +33,15 @@ func FromPublic(src types.ImageSource) private.ImageSource {
 	if src2, ok := src.(private.ImageSource); ok {
 		return src2
 	}
-	return &wrapped{
+	w := &wrapped{
 		NoGetBlobAtInitialize: stubs.NoGetBlobAt(src.Reference()),
 
 		ImageSource: src,
 	}
+	if chunked, ok := src.(types.ImageSourceWithBlobChunks); ok {
+		return &wrappedWithBlobChunks{wrapped: w, chunked: chunked}
+	}
+	return w
 }
 
 // GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
@@ -54,3 +59,26 @@ func (w *wrapped) GetSignaturesWithFormat(ctx context.Context, instanceDigest *d
 	}
 	return res, nil
 }
+
+// wrappedWithBlobChunks provides the private.ImageSource operations
+// for a source that implements types.ImageSourceWithBlobChunks
+type wrappedWithBlobChunks struct {
+	*wrapped
+	chunked types.ImageSourceWithBlobChunks
+}
+
+// SupportsGetBlobAt() returns true if GetBlobAt (BlobChunkAccessor) is supported.
+func (w *wrappedWithBlobChunks) SupportsGetBlobAt() bool {
+	return w.chunked.SupportsGetBlobAt()
+}
+
+// GetBlobAt returns a sequential channel of readers that contain data for the requested
+// blob chunks, and a channel that might get a single error value.
+// The specified chunks must be not overlapping and sorted by their offset.
+// The readers must be fully consumed, in the order they are returned, before blocking
+// to read the next chunk.
+// If the Length for the last chunk is set to math.MaxUint64, then it
+// fully fetches the remaining data from the offset to the end of the blob.
+func (w *wrappedWithBlobChunks) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+	return w.chunked.GetBlobAt(ctx, info, chunks)
+}
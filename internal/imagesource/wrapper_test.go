@@ -0,0 +1,67 @@
+package imagesource
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeReference is a types.ImageReference which only implements Transport().
+type fakeReference struct {
+	types.ImageReference
+}
+
+func (ref fakeReference) Transport() types.ImageTransport {
+	return fakeTransport{}
+}
+
+// fakeTransport is a types.ImageTransport which only implements Name().
+type fakeTransport struct {
+	types.ImageTransport
+}
+
+func (t fakeTransport) Name() string {
+	return "fake"
+}
+
+// publicSource is a types.ImageSource which only implements the public API.
+type publicSource struct {
+	types.ImageSource
+}
+
+func (s *publicSource) Reference() types.ImageReference {
+	return fakeReference{}
+}
+
+// chunkedSource is a types.ImageSourceWithBlobChunks.
+type chunkedSource struct {
+	publicSource
+	chunks []types.ImageSourceChunk
+}
+
+func (s *chunkedSource) SupportsGetBlobAt() bool {
+	return true
+}
+
+func (s *chunkedSource) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []types.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+	s.chunks = chunks
+	return nil, nil, types.BadPartialRequestError{Status: "416 Range Not Satisfiable"}
+}
+
+func TestFromPublicBlobChunks(t *testing.T) {
+	src := FromPublic(&publicSource{})
+	assert.False(t, src.SupportsGetBlobAt())
+
+	chunked := &chunkedSource{}
+	src = FromPublic(chunked)
+	assert.True(t, src.SupportsGetBlobAt())
+	chunks := []private.ImageSourceChunk{{Offset: 1, Length: 2}}
+	_, _, err := src.GetBlobAt(context.Background(), types.BlobInfo{}, chunks)
+	var badRequest private.BadPartialRequestError
+	assert.ErrorAs(t, err, &badRequest)
+	assert.Equal(t, chunks, chunked.chunks)
+}
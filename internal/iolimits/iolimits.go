@@ -3,6 +3,8 @@ package iolimits
 import (
 	"fmt"
 	"io"
+
+	"github.com/containers/image/v5/types"
 )
 
 // All constants below are intended to be used as limits for `ReadAtMost`. The
@@ -41,6 +43,30 @@ const (
 	MaxTarFileManifestSize = megaByte
 )
 
+// MaxManifestBodySizeFor returns the maximum allowed size of a manifest when using sys.
+func MaxManifestBodySizeFor(sys *types.SystemContext) int {
+	if sys != nil && sys.ParsingLimits.MaxManifestSize > 0 {
+		return sys.ParsingLimits.MaxManifestSize
+	}
+	return MaxManifestBodySize
+}
+
+// MaxConfigBodySizeFor returns the maximum allowed size of a config blob when using sys.
+func MaxConfigBodySizeFor(sys *types.SystemContext) int {
+	if sys != nil && sys.ParsingLimits.MaxConfigSize > 0 {
+		return sys.ParsingLimits.MaxConfigSize
+	}
+	return MaxConfigBodySize
+}
+
+// MaxSignatureListBodySizeFor returns the maximum allowed size of a signature list when using sys.
+func MaxSignatureListBodySizeFor(sys *types.SystemContext) int {
+	if sys != nil && sys.ParsingLimits.MaxSignatureListSize > 0 {
+		return sys.ParsingLimits.MaxSignatureListSize
+	}
+	return MaxSignatureListBodySize
+}
+
 // ReadAtMost reads from reader and errors out if the specified limit (in bytes) is exceeded.
 func ReadAtMost(reader io.Reader, limit int) ([]byte, error) {
 	limitedReader := io.LimitReader(reader, int64(limit+1))
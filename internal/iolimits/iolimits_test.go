@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -35,3 +36,29 @@ func TestReadAtMost(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxBodySizeFor(t *testing.T) {
+	for _, c := range []struct {
+		sys                                   *types.SystemContext
+		manifestSize, configSize, sigListSize int
+	}{
+		{nil, MaxManifestBodySize, MaxConfigBodySize, MaxSignatureListBodySize},
+		{&types.SystemContext{}, MaxManifestBodySize, MaxConfigBodySize, MaxSignatureListBodySize},
+		{
+			&types.SystemContext{ParsingLimits: types.ParsingLimits{MaxManifestSize: -1, MaxConfigSize: -1, MaxSignatureListSize: -1}},
+			MaxManifestBodySize, MaxConfigBodySize, MaxSignatureListBodySize,
+		},
+		{
+			&types.SystemContext{ParsingLimits: types.ParsingLimits{MaxManifestSize: 1, MaxConfigSize: 2, MaxSignatureListSize: 3}},
+			1, 2, 3,
+		},
+		{
+			&types.SystemContext{ParsingLimits: types.ParsingLimits{MaxConfigSize: 64 * megaByte}},
+			MaxManifestBodySize, 64 * megaByte, MaxSignatureListBodySize,
+		},
+	} {
+		assert.Equal(t, c.manifestSize, MaxManifestBodySizeFor(c.sys))
+		assert.Equal(t, c.configSize, MaxConfigBodySizeFor(c.sys))
+		assert.Equal(t, c.sigListSize, MaxSignatureListBodySizeFor(c.sys))
+	}
+}
@@ -0,0 +1,96 @@
+// Package logging routes log messages to the logger configured in types.SystemContext.Logger,
+// or to the global logrus logger if none is configured.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger logs messages either to a *slog.Logger or to logrus.
+// The zero value logs to logrus.
+type Logger struct {
+	slog *slog.Logger // nil to use logrus
+}
+
+// For returns a Logger using sys.Logger, if set, or logrus.
+func For(sys *types.SystemContext) Logger {
+	if sys == nil {
+		return Logger{}
+	}
+	return Logger{slog: sys.Logger}
+}
+
+// Debugf logs a formatted message at the debug level.
+func (l Logger) Debugf(format string, args ...any) {
+	l.logf(slog.LevelDebug, logrus.DebugLevel, format, args)
+}
+
+// Debug logs a message at the debug level, formatting args like fmt.Sprint.
+func (l Logger) Debug(args ...any) {
+	l.log(slog.LevelDebug, logrus.DebugLevel, args)
+}
+
+// Infof logs a formatted message at the info level.
+func (l Logger) Infof(format string, args ...any) {
+	l.logf(slog.LevelInfo, logrus.InfoLevel, format, args)
+}
+
+// Info logs a message at the info level, formatting args like fmt.Sprint.
+func (l Logger) Info(args ...any) {
+	l.log(slog.LevelInfo, logrus.InfoLevel, args)
+}
+
+// Warnf logs a formatted message at the warning level.
+func (l Logger) Warnf(format string, args ...any) {
+	l.logf(slog.LevelWarn, logrus.WarnLevel, format, args)
+}
+
+// Errorf logs a formatted message at the error level.
+func (l Logger) Errorf(format string, args ...any) {
+	l.logf(slog.LevelError, logrus.ErrorLevel, format, args)
+}
+
+// DebugEnabled returns true if debug-level messages are logged, so that callers can avoid expensive computations otherwise.
+func (l Logger) DebugEnabled() bool {
+	if l.slog == nil {
+		return logrus.IsLevelEnabled(logrus.DebugLevel)
+	}
+	return l.slog.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// logf is the implementation of Debugf and similar methods, which must call it directly.
+func (l Logger) logf(level slog.Level, logrusLevel logrus.Level, format string, args []any) {
+	if l.slog == nil {
+		logrus.StandardLogger().Logf(logrusLevel, format, args...)
+		return
+	}
+	if l.slog.Enabled(context.Background(), level) {
+		l.output(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// log is the implementation of Debug and similar methods, which must call it directly.
+func (l Logger) log(level slog.Level, logrusLevel logrus.Level, args []any) {
+	if l.slog == nil {
+		logrus.StandardLogger().Log(logrusLevel, args...)
+		return
+	}
+	if l.slog.Enabled(context.Background(), level) {
+		l.output(level, fmt.Sprint(args...))
+	}
+}
+
+// output logs msg to l.slog, attributing it to the caller of the exported method.
+func (l Logger) output(level slog.Level, msg string) {
+	var pcs [1]uintptr
+	runtime.Callers(4, pcs[:]) // Skip runtime.Callers, output, logf or log, and the exported method.
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	_ = l.slog.Handler().Handle(context.Background(), r)
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFor(t *testing.T) {
+	assert.Equal(t, Logger{}, For(nil))
+	assert.Equal(t, Logger{}, For(&types.SystemContext{}))
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	assert.Equal(t, Logger{slog: logger}, For(&types.SystemContext{Logger: logger}))
+}
+
+func TestLoggerSlog(t *testing.T) {
+	var buf bytes.Buffer
+	l := For(&types.SystemContext{Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelInfo,
+	}))})
+
+	assert.False(t, l.DebugEnabled())
+	l.Debugf("debug %d", 1)
+	l.Debug("debug", 2)
+	assert.Empty(t, buf.String())
+
+	l.Infof("info %d", 1)
+	assert.Contains(t, buf.String(), "level=INFO")
+	assert.Contains(t, buf.String(), `msg="info 1"`)
+	assert.Contains(t, buf.String(), "logging_test.go:") // The source is the caller, not this package.
+	assert.NotContains(t, buf.String(), "logging.go:")
+	buf.Reset()
+
+	l.Info("info", 2)
+	assert.Contains(t, buf.String(), "msg=info2")
+	assert.Contains(t, buf.String(), "logging_test.go:")
+	buf.Reset()
+
+	l.Warnf("warning %s", "x")
+	assert.Contains(t, buf.String(), "level=WARN")
+	assert.Contains(t, buf.String(), `msg="warning x"`)
+	buf.Reset()
+
+	l.Errorf("error %s", "x")
+	assert.Contains(t, buf.String(), "level=ERROR")
+	assert.Contains(t, buf.String(), `msg="error x"`)
+}
+
+func TestLoggerLogrus(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.StandardLogger()
+	oldOut, oldLevel := logger.Out, logger.GetLevel()
+	defer func() {
+		logger.SetOutput(oldOut)
+		logger.SetLevel(oldLevel)
+	}()
+	logger.SetOutput(&buf)
+
+	l := Logger{}
+	logger.SetLevel(logrus.InfoLevel)
+	assert.False(t, l.DebugEnabled())
+	l.Debugf("debug %d", 1)
+	assert.Empty(t, buf.String())
+
+	logger.SetLevel(logrus.DebugLevel)
+	assert.True(t, l.DebugEnabled())
+	l.Debugf("debug %d", 1)
+	assert.Contains(t, buf.String(), "level=debug")
+	assert.Contains(t, buf.String(), `msg="debug 1"`)
+}
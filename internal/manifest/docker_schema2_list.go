@@ -128,6 +128,15 @@ func (index *Schema2ListPublic) editInstances(editInstances []ListEdit) error {
 				},
 				schema2PlatformSpecFromOCIPlatform(*editInstance.AddPlatform),
 			})
+		case ListOpRemove:
+			targetIndex := slices.IndexFunc(index.Manifests, func(m Schema2ManifestDescriptor) bool {
+				return m.Digest == editInstance.RemoveDigest
+			})
+			if targetIndex == -1 {
+				return fmt.Errorf("Schema2List.EditInstances: digest %s not found", editInstance.RemoveDigest)
+			}
+			// slices.Clone() here to ensure a private backing array, as in the ListOpAdd case.
+			index.Manifests = slices.Delete(slices.Clone(index.Manifests), targetIndex, targetIndex+1)
 		default:
 			return fmt.Errorf("internal error: invalid operation: %d", editInstance.ListOperation)
 		}
@@ -144,6 +153,70 @@ func (index *Schema2List) EditInstances(editInstances []ListEdit) error {
 	return index.editInstances(editInstances)
 }
 
+// instanceIndex returns the position of the instance with instanceDigest in list.Manifests.
+func (list *Schema2ListPublic) instanceIndex(instanceDigest digest.Digest) (int, error) {
+	i := slices.IndexFunc(list.Manifests, func(m Schema2ManifestDescriptor) bool {
+		return m.Digest == instanceDigest
+	})
+	if i == -1 {
+		return -1, fmt.Errorf("instance %s not found in Schema2List", instanceDigest)
+	}
+	return i, nil
+}
+
+// AddInstance adds a copy of instance at the end of the list.
+// It fails if the list already contains an instance with the same digest.
+func (list *Schema2ListPublic) AddInstance(instance Schema2ManifestDescriptor) error {
+	if err := instance.Digest.Validate(); err != nil {
+		return fmt.Errorf("adding instance %q to Schema2List: %w", instance.Digest, err)
+	}
+	if _, err := list.instanceIndex(instance.Digest); err == nil {
+		return fmt.Errorf("adding instance %s to Schema2List: the list already contains it", instance.Digest)
+	}
+	// slices.Clone() here to ensure a private backing array, as in editInstances.
+	list.Manifests = append(slices.Clone(list.Manifests), schema2ManifestDescriptorClone(instance))
+	return nil
+}
+
+// RemoveInstance removes the instance with instanceDigest from the list.
+// The order of the remaining instances is preserved.
+func (list *Schema2ListPublic) RemoveInstance(instanceDigest digest.Digest) error {
+	return list.editInstances([]ListEdit{{ListOperation: ListOpRemove, RemoveDigest: instanceDigest}})
+}
+
+// ReplaceInstance replaces the instance with oldDigest by a copy of instance, at the same position in the list.
+// It fails if the list already contains a different instance with the digest of instance.
+func (list *Schema2ListPublic) ReplaceInstance(oldDigest digest.Digest, instance Schema2ManifestDescriptor) error {
+	i, err := list.instanceIndex(oldDigest)
+	if err != nil {
+		return err
+	}
+	if err := instance.Digest.Validate(); err != nil {
+		return fmt.Errorf("replacing instance %s in Schema2List with %q: %w", oldDigest, instance.Digest, err)
+	}
+	if instance.Digest != oldDigest {
+		if _, err := list.instanceIndex(instance.Digest); err == nil {
+			return fmt.Errorf("replacing instance %s in Schema2List with %s: the list already contains it", oldDigest, instance.Digest)
+		}
+	}
+	// slices.Clone() here to ensure a private backing array, as in AddInstance.
+	list.Manifests = slices.Clone(list.Manifests)
+	list.Manifests[i] = schema2ManifestDescriptorClone(instance)
+	return nil
+}
+
+// SetInstancePlatform sets the platform of the instance with instanceDigest to a copy of platform.
+func (list *Schema2ListPublic) SetInstancePlatform(instanceDigest digest.Digest, platform Schema2PlatformSpec) error {
+	i, err := list.instanceIndex(instanceDigest)
+	if err != nil {
+		return err
+	}
+	// slices.Clone() here to ensure a private backing array, as in AddInstance.
+	list.Manifests = slices.Clone(list.Manifests)
+	list.Manifests[i].Platform = schema2PlatformSpecClone(platform)
+	return nil
+}
+
 func (list *Schema2ListPublic) ChooseInstanceByCompression(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error) {
 	// ChooseInstanceByCompression is same as ChooseInstance for schema2 manifest list.
 	return list.ChooseInstance(ctx)
@@ -169,6 +242,7 @@ func (list *Schema2ListPublic) ChooseInstance(ctx *types.SystemContext) (digest.
 
 // Serialize returns the list in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
+// The output is deterministic: equal lists, including the order of instances, serialize to identical blobs.
 func (list *Schema2ListPublic) Serialize() ([]byte, error) {
 	buf, err := json.Marshal(list)
 	if err != nil {
@@ -187,27 +261,36 @@ func Schema2ListPublicFromComponents(components []Schema2ManifestDescriptor) *Sc
 		Manifests:     make([]Schema2ManifestDescriptor, len(components)),
 	}
 	for i, component := range components {
-		m := Schema2ManifestDescriptor{
-			Schema2Descriptor{
-				MediaType: component.MediaType,
-				Size:      component.Size,
-				Digest:    component.Digest,
-				URLs:      slices.Clone(component.URLs),
-			},
-			Schema2PlatformSpec{
-				Architecture: component.Platform.Architecture,
-				OS:           component.Platform.OS,
-				OSVersion:    component.Platform.OSVersion,
-				OSFeatures:   slices.Clone(component.Platform.OSFeatures),
-				Variant:      component.Platform.Variant,
-				Features:     slices.Clone(component.Platform.Features),
-			},
-		}
-		list.Manifests[i] = m
+		list.Manifests[i] = schema2ManifestDescriptorClone(component)
 	}
 	return &list
 }
 
+// schema2ManifestDescriptorClone returns an independent copy of a list entry d.
+func schema2ManifestDescriptorClone(d Schema2ManifestDescriptor) Schema2ManifestDescriptor {
+	return Schema2ManifestDescriptor{
+		Schema2Descriptor{
+			MediaType: d.MediaType,
+			Size:      d.Size,
+			Digest:    d.Digest,
+			URLs:      slices.Clone(d.URLs),
+		},
+		schema2PlatformSpecClone(d.Platform),
+	}
+}
+
+// schema2PlatformSpecClone returns an independent copy of p.
+func schema2PlatformSpecClone(p Schema2PlatformSpec) Schema2PlatformSpec {
+	return Schema2PlatformSpec{
+		Architecture: p.Architecture,
+		OS:           p.OS,
+		OSVersion:    p.OSVersion,
+		OSFeatures:   slices.Clone(p.OSFeatures),
+		Variant:      p.Variant,
+		Features:     slices.Clone(p.Features),
+	}
+}
+
 // Schema2ListPublicClone creates a deep copy of the passed-in list.
 // This is publicly visible as c/image/manifest.Schema2ListClone.
 func Schema2ListPublicClone(list *Schema2ListPublic) *Schema2ListPublic {
@@ -87,6 +87,86 @@ func TestSchema2ListEditInstances(t *testing.T) {
 		digest.Digest("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
 		digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"),
 	), list.Instances())
+
+	// Remove an instance
+	err = list.EditInstances([]ListEdit{{
+		ListOperation: ListOpRemove,
+		RemoveDigest:  originalListOrder[0],
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, append(slices.Clone(originalListOrder[1:]),
+		digest.Digest("sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+		digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"),
+	), list.Instances())
+	err = list.EditInstances([]ListEdit{{
+		ListOperation: ListOpRemove,
+		RemoveDigest:  originalListOrder[0],
+	}})
+	assert.Error(t, err)
+}
+
+func TestSchema2ListInstanceEditing(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("testdata", "v2list.manifest.json"))
+	require.NoError(t, err)
+	list, err := Schema2ListPublicFromManifest(validManifest)
+	require.NoError(t, err)
+	original := list.Instances()
+	newDigest := digest.Digest("sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	replacementDigest := digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc")
+
+	// AddInstance
+	features := []string{"sse4"}
+	err = list.AddInstance(Schema2ManifestDescriptor{
+		Schema2Descriptor: Schema2Descriptor{MediaType: DockerV2Schema2MediaType, Digest: newDigest, Size: 42},
+		Platform:          Schema2PlatformSpec{OS: "linux", Architecture: "amd64", Features: features},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, append(slices.Clone(original), newDigest), list.Instances())
+	features[0] = "modified" // The list must contain a copy
+	assert.Equal(t, []string{"sse4"}, list.Manifests[len(list.Manifests)-1].Platform.Features)
+	err = list.AddInstance(Schema2ManifestDescriptor{Schema2Descriptor: Schema2Descriptor{Digest: newDigest}}) // Duplicate
+	assert.Error(t, err)
+	err = list.AddInstance(Schema2ManifestDescriptor{Schema2Descriptor: Schema2Descriptor{Digest: "invalid"}})
+	assert.Error(t, err)
+
+	// SetInstancePlatform
+	err = list.SetInstancePlatform(newDigest, Schema2PlatformSpec{OS: "linux", Architecture: "s390x"})
+	require.NoError(t, err)
+	instance, err := list.Instance(newDigest)
+	require.NoError(t, err)
+	assert.Equal(t, "s390x", instance.ReadOnly.Platform.Architecture)
+	err = list.SetInstancePlatform(replacementDigest, Schema2PlatformSpec{})
+	assert.Error(t, err)
+
+	// ReplaceInstance
+	aliased := list.Manifests
+	err = list.ReplaceInstance(original[0], Schema2ManifestDescriptor{
+		Schema2Descriptor: Schema2Descriptor{MediaType: DockerV2Schema2MediaType, Digest: replacementDigest, Size: 1},
+		Platform:          Schema2PlatformSpec{OS: "linux", Architecture: "arm64"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, original[0], aliased[0].Digest) // Like AddInstance, edits don’t write into a caller’s copy of Manifests
+	expected := append(slices.Clone(original), newDigest)
+	expected[0] = replacementDigest
+	assert.Equal(t, expected, list.Instances())
+	err = list.ReplaceInstance(replacementDigest, Schema2ManifestDescriptor{Schema2Descriptor: Schema2Descriptor{Digest: newDigest}}) // Duplicate
+	assert.Error(t, err)
+
+	// RemoveInstance
+	err = list.RemoveInstance(replacementDigest)
+	require.NoError(t, err)
+	assert.Equal(t, expected[1:], list.Instances())
+	err = list.RemoveInstance(replacementDigest)
+	assert.Error(t, err)
+
+	// Serialization is deterministic
+	serialized1, err := list.Serialize()
+	require.NoError(t, err)
+	parsed, err := Schema2ListPublicFromManifest(serialized1)
+	require.NoError(t, err)
+	serialized2, err := parsed.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, serialized1, serialized2)
 }
 
 func TestSchema2ListFromManifest(t *testing.T) {
@@ -54,3 +54,17 @@ func (e NonImageArtifactError) Error() string {
 	}
 	return fmt.Sprintf("unsupported image-specific operation on artifact with type %q", e.mimeType)
 }
+
+// UnsupportedFieldConversionError (detected via errors.As) is used when a manifest can’t be converted
+// to a format which can’t represent one of its fields (e.g. the OCI “subject” field when converting to
+// Docker schema2), because silently dropping the field would change the meaning of the manifest.
+//
+// This is publicly visible as c/image/manifest.UnsupportedFieldConversionError
+type UnsupportedFieldConversionError struct {
+	Field          string // The JSON name of the field, e.g. "subject"
+	TargetMIMEType string // The MIME type of the format the conversion was attempted to
+}
+
+func (e UnsupportedFieldConversionError) Error() string {
+	return fmt.Sprintf("converting to %q would drop the %q field, which the format does not support", e.TargetMIMEType, e.Field)
+}
@@ -2,7 +2,9 @@ package manifest
 
 import (
 	"fmt"
+	"slices"
 
+	platform "github.com/containers/image/v5/internal/pkg/platform"
 	compression "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
@@ -57,7 +59,7 @@ type List interface {
 	// when configured to OptionalBoolTrue and chooses best available compression when it is OptionalBoolFalse or left OptionalBoolUndefined.
 	ChooseInstanceByCompression(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error)
 	// Edit information about the list's instances. Contains Slice of ListEdit where each element
-	// is responsible for either Modifying or Adding a new instance to the Manifest. Operation is
+	// is responsible for either Modifying, Adding or Removing an instance of the Manifest. Operation is
 	// selected on the basis of configured ListOperation field.
 	EditInstances([]ListEdit) error
 }
@@ -83,6 +85,7 @@ const (
 	listOpInvalid ListOp = iota
 	ListOpAdd
 	ListOpUpdate
+	ListOpRemove
 )
 
 // ListEdit includes the fields which a List's EditInstances() method will modify.
@@ -106,6 +109,9 @@ type ListEdit struct {
 	AddPlatform              *imgspecv1.Platform
 	AddAnnotations           map[string]string
 	AddCompressionAlgorithms []compression.Algorithm
+
+	// If Op = ListOpRemove. All fields must be set.
+	RemoveDigest digest.Digest
 }
 
 // ListPublicFromBlob parses a list of manifests.
@@ -131,3 +137,85 @@ func ListFromBlob(manifest []byte, manifestMIMEType string) (List, error) {
 	}
 	return nil, fmt.Errorf("Unimplemented manifest list MIME type %q (normalized as %q)", manifestMIMEType, normalized)
 }
+
+// PlatformSelectionOptions modifies how CompatibleInstances and ChooseInstanceWithOptions select instances.
+// The zero value selects instances the same way as ListPublic.ChooseInstance, except that compression is not considered.
+// This is publicly visible as c/image/manifest.PlatformSelectionOptions.
+type PlatformSelectionOptions struct {
+	// If true, only instances with exactly the wanted variant are compatible; by default, instances with less capable variants
+	// (e.g. arm/v7 and arm/v6 when arm/v8 is wanted) and instances without a variant are compatible as well.
+	StrictVariant bool
+	// If not nil, overrides the built-in variant fallback chains: for each architecture, the list of known variants,
+	// from the most capable to the least capable (e.g. "arm": {"v8", "v7", "v6"}).
+	VariantFallbacks map[string][]string
+	// If not "", only instances with a matching os.version are compatible (instances without an os.version do not match).
+	// A trailing "*" matches any suffix, e.g. "10.0.17763.*" matches any Windows Server 2019 build.
+	OSVersion string
+}
+
+// CompatibleInstances returns the instances of list which are compatible with the platform described by ctx
+// (or the current platform if ctx doesn't specify any details), modified by options,
+// ranked from the most to the least preferred.
+// Instances without a platform (which only OCI indexes allow) are compatible with any platform, and ranked last.
+// This is publicly visible as c/image/manifest.CompatibleInstances.
+func CompatibleInstances(list ListPublic, ctx *types.SystemContext, options PlatformSelectionOptions) ([]digest.Digest, error) {
+	wantedPlatforms, err := platform.WantedPlatformsWithOptions(ctx, platform.MatchOptions{
+		StrictVariant:    options.StrictVariant,
+		VariantFallbacks: options.VariantFallbacks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting platform information %#v: %w", ctx, err)
+	}
+	type candidate struct {
+		platformIndex int // Index in wantedPlatforms, or len(wantedPlatforms) if the instance has no platform
+		digest        digest.Digest
+	}
+	candidates := []candidate{}
+	for _, instanceDigest := range list.Instances() {
+		instance, err := list.Instance(instanceDigest)
+		if err != nil {
+			return nil, err
+		}
+		if instance.ReadOnly.Platform == nil {
+			candidates = append(candidates, candidate{platformIndex: len(wantedPlatforms), digest: instanceDigest})
+			continue
+		}
+		imagePlatform := *instance.ReadOnly.Platform
+		if !platform.MatchesOSVersion(imagePlatform.OSVersion, options.OSVersion) || (options.OSVersion != "" && imagePlatform.OSVersion == "") {
+			continue
+		}
+		platformIndex := slices.IndexFunc(wantedPlatforms, func(wantedPlatform imgspecv1.Platform) bool {
+			return platform.MatchesPlatform(imagePlatform, wantedPlatform)
+		})
+		if platformIndex != -1 {
+			candidates = append(candidates, candidate{platformIndex: platformIndex, digest: instanceDigest})
+		}
+	}
+	// Stable, so that instances matching the same platform are ranked in the order of the list.
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return a.platformIndex - b.platformIndex
+	})
+	res := make([]digest.Digest, 0, len(candidates))
+	for _, c := range candidates {
+		res = append(res, c.digest)
+	}
+	return res, nil
+}
+
+// ChooseInstanceWithOptions returns the most preferred instance of list which is compatible with the platform described by ctx
+// (or the current platform if ctx doesn't specify any details), modified by options; see CompatibleInstances.
+// This is publicly visible as c/image/manifest.ChooseInstanceWithOptions.
+func ChooseInstanceWithOptions(list ListPublic, ctx *types.SystemContext, options PlatformSelectionOptions) (digest.Digest, error) {
+	instances, err := CompatibleInstances(list, ctx, options)
+	if err != nil {
+		return "", err
+	}
+	if len(instances) == 0 {
+		wantedPlatforms, err := platform.WantedPlatforms(ctx)
+		if err != nil {
+			return "", fmt.Errorf("getting platform information %#v: %w", ctx, err)
+		}
+		return "", fmt.Errorf("no image found in manifest list for architecture %q, variant %q, OS %q", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS)
+	}
+	return instances[0], nil
+}
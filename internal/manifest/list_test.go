@@ -92,6 +92,12 @@ func TestChooseInstance(t *testing.T) {
 			require.NoError(t, err)
 			return list.ChooseInstanceByCompression(sys, types.OptionalBoolUndefined)
 		},
+		// Default options.
+		func(sys *types.SystemContext, rawManifest []byte) (digest.Digest, error) {
+			list, err := ListPublicFromBlob(rawManifest, GuessMIMEType(rawManifest))
+			require.NoError(t, err)
+			return ChooseInstanceWithOptions(list, sys, PlatformSelectionOptions{})
+		},
 	}
 	for _, manifestList := range []struct {
 		listFile           string
@@ -159,3 +165,100 @@ func TestChooseInstance(t *testing.T) {
 		}
 	}
 }
+
+func TestCompatibleInstances(t *testing.T) {
+	const (
+		digestAMD64      = digest.Digest("sha256:59eec8837a4d942cc19a52b8c09ea75121acc38114a2c68b98983ce9356b8610")
+		digestV7         = digest.Digest("sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")
+		digestV6a        = digest.Digest("sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd")
+		digestV6b        = digest.Digest("sha256:f365626a556e58189fc21d099fc64603db0f440bff07f77c740989515c544a39")
+		digestNoVariant  = digest.Digest("sha256:c84b0a3a07b628bc4d62e5047d0f8dff80f7c00979e1e28a821a033ecda8fe53")
+		digestWin2019    = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		digestWin2022    = digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+		digestNoPlatform = digest.Digest("sha256:3333333333333333333333333333333333333333333333333333333333333333")
+	)
+	rawManifest, err := os.ReadFile(filepath.Join("testdata", "ocilist-variants.json"))
+	require.NoError(t, err)
+	variantsList, err := ListPublicFromBlob(rawManifest, GuessMIMEType(rawManifest))
+	require.NoError(t, err)
+	windowsList := OCI1IndexPublicFromComponents([]imgspecv1.Descriptor{
+		{MediaType: imgspecv1.MediaTypeImageManifest, Digest: digestWin2019, Size: 1,
+			Platform: &imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.5329"}},
+		{MediaType: imgspecv1.MediaTypeImageManifest, Digest: digestWin2022, Size: 1,
+			Platform: &imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2227"}},
+		{MediaType: imgspecv1.MediaTypeImageManifest, Digest: digestNoPlatform, Size: 1},
+	}, nil)
+
+	for _, c := range []struct {
+		name     string
+		list     ListPublic
+		sys      types.SystemContext
+		options  PlatformSelectionOptions
+		expected []digest.Digest
+	}{
+		{
+			name:     "default fallbacks",
+			list:     variantsList,
+			sys:      types.SystemContext{OSChoice: "linux", ArchitectureChoice: "arm", VariantChoice: "v7"},
+			expected: []digest.Digest{digestV7, digestV6a, digestV6b, digestNoVariant},
+		},
+		{
+			name:     "strict variant",
+			list:     variantsList,
+			sys:      types.SystemContext{OSChoice: "linux", ArchitectureChoice: "arm", VariantChoice: "v7"},
+			options:  PlatformSelectionOptions{StrictVariant: true},
+			expected: []digest.Digest{digestV7},
+		},
+		{
+			name:     "custom fallbacks",
+			list:     variantsList,
+			sys:      types.SystemContext{OSChoice: "linux", ArchitectureChoice: "arm", VariantChoice: "v7"},
+			options:  PlatformSelectionOptions{VariantFallbacks: map[string][]string{"arm": {"v7"}}},
+			expected: []digest.Digest{digestV7, digestNoVariant},
+		},
+		{
+			name:     "no variant architecture",
+			list:     variantsList,
+			sys:      types.SystemContext{OSChoice: "linux", ArchitectureChoice: "amd64"},
+			expected: []digest.Digest{digestAMD64},
+		},
+		{
+			name:     "unmatched",
+			list:     variantsList,
+			sys:      types.SystemContext{OSChoice: "linux", ArchitectureChoice: "s390x"},
+			expected: []digest.Digest{},
+		},
+		{
+			name:     "any OS version",
+			list:     windowsList,
+			sys:      types.SystemContext{OSChoice: "windows", ArchitectureChoice: "amd64"},
+			expected: []digest.Digest{digestWin2019, digestWin2022, digestNoPlatform},
+		},
+		{
+			name:     "OS version wildcard",
+			list:     windowsList,
+			sys:      types.SystemContext{OSChoice: "windows", ArchitectureChoice: "amd64"},
+			options:  PlatformSelectionOptions{OSVersion: "10.0.20348.*"},
+			expected: []digest.Digest{digestWin2022, digestNoPlatform},
+		},
+		{
+			name:     "exact OS version",
+			list:     windowsList,
+			sys:      types.SystemContext{OSChoice: "windows", ArchitectureChoice: "amd64"},
+			options:  PlatformSelectionOptions{OSVersion: "10.0.17763.5329"},
+			expected: []digest.Digest{digestWin2019, digestNoPlatform},
+		},
+	} {
+		res, err := CompatibleInstances(c.list, &c.sys, c.options)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, res, c.name)
+
+		chosen, err := ChooseInstanceWithOptions(c.list, &c.sys, c.options)
+		if len(c.expected) == 0 {
+			assert.Error(t, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+			assert.Equal(t, c.expected[0], chosen, c.name)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package manifest
 
 import (
 	"encoding/json"
+	"fmt"
 	"slices"
 
+	"github.com/containers/image/v5/internal/supporteddigests"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/libtrust"
 	digest "github.com/opencontainers/go-digest"
@@ -108,6 +110,16 @@ func GuessMIMEType(manifest []byte) string {
 // Digest returns the a digest of a docker manifest, with any necessary implied transformations like stripping v1s1 signatures.
 // This is publicly visible as c/image/manifest.Digest.
 func Digest(manifest []byte) (digest.Digest, error) {
+	return DigestWithAlgorithm(manifest, digest.Canonical)
+}
+
+// DigestWithAlgorithm returns a digest of a docker manifest using algorithm, with any necessary implied transformations
+// like stripping v1s1 signatures.
+// This is publicly visible as c/image/manifest.DigestWithAlgorithm.
+func DigestWithAlgorithm(manifest []byte, algorithm digest.Algorithm) (digest.Digest, error) {
+	if !supporteddigests.IsSupported(algorithm) {
+		return "", fmt.Errorf("digest algorithm %q is not supported", algorithm)
+	}
 	if GuessMIMEType(manifest) == DockerV2Schema1SignedMediaType {
 		sig, err := libtrust.ParsePrettySignature(manifest, "signatures")
 		if err != nil {
@@ -121,7 +133,7 @@ func Digest(manifest []byte) (digest.Digest, error) {
 		}
 	}
 
-	return digest.FromBytes(manifest), nil
+	return algorithm.FromBytes(manifest), nil
 }
 
 // MatchesDigest returns true iff the manifest matches expectedDigest.
@@ -130,8 +142,14 @@ func Digest(manifest []byte) (digest.Digest, error) {
 // or we are not using a cryptographic channel and the attacker can modify the digest along with the manifest blob.
 // This is publicly visible as c/image/manifest.MatchesDigest.
 func MatchesDigest(manifest []byte, expectedDigest digest.Digest) (bool, error) {
-	// This should eventually support various digest types.
-	actualDigest, err := Digest(manifest)
+	if err := expectedDigest.Validate(); err != nil {
+		return false, nil // A malformed digest, or an unknown algorithm, can not match.
+	}
+	algorithm := expectedDigest.Algorithm()
+	if !supporteddigests.IsSupported(algorithm) {
+		return false, nil
+	}
+	actualDigest, err := DigestWithAlgorithm(manifest, algorithm)
 	if err != nil {
 		return false, err
 	}
@@ -205,9 +223,11 @@ type ReuseConditions struct {
 // (which can be nil to represent uncompressed or unknown) matches reuseConditions.
 func CandidateCompressionMatchesReuseConditions(c ReuseConditions, candidateCompression *compressiontypes.Algorithm) bool {
 	if c.RequiredCompression != nil {
-		if c.RequiredCompression.Name() == compressiontypes.ZstdChunkedAlgorithmName {
-			// HACK: Never match when the caller asks for zstd:chunked, because we don’t record the annotations required to use the chunked blobs.
-			// The caller must re-compress to build those annotations.
+		if c.RequiredCompression.Name() == compressiontypes.ZstdChunkedAlgorithmName &&
+			(candidateCompression == nil || candidateCompression.Name() != compressiontypes.ZstdChunkedAlgorithmName) {
+			// HACK: When the caller asks for zstd:chunked, only match candidates known to be zstd:chunked (which must come with
+			// the annotations required to use the chunked blobs); a plain zstd blob can’t be used, the caller must re-compress
+			// to build those annotations.
 			return false
 		}
 		if candidateCompression == nil ||
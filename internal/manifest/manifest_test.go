@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/containers/image/v5/pkg/compression"
@@ -73,6 +74,35 @@ func TestDigest(t *testing.T) {
 	assert.Equal(t, digest.Digest(digestSha256EmptyTar), actualDigest)
 }
 
+func TestDigestWithAlgorithm(t *testing.T) {
+	for _, path := range []string{"v2s2.manifest.json", "v2s1-unsigned.manifest.json"} {
+		manifest, err := os.ReadFile(filepath.Join("testdata", path))
+		require.NoError(t, err)
+		for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+			actualDigest, err := DigestWithAlgorithm(manifest, algorithm)
+			require.NoError(t, err)
+			assert.Equal(t, algorithm.FromBytes(manifest), actualDigest)
+		}
+		_, err = DigestWithAlgorithm(manifest, digest.SHA384)
+		assert.Error(t, err)
+		_, err = DigestWithAlgorithm(manifest, "unknown")
+		assert.Error(t, err)
+	}
+
+	// The signatures of signed schema1 manifests are stripped with any algorithm.
+	manifest, err := os.ReadFile(filepath.Join("testdata", "v2s1.manifest.json"))
+	require.NoError(t, err)
+	sha256Digest, err := DigestWithAlgorithm(manifest, digest.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, TestDockerV2S1ManifestDigest, sha256Digest)
+	sha512Digest, err := DigestWithAlgorithm(manifest, digest.SHA512)
+	require.NoError(t, err)
+	assert.NotEqual(t, digest.SHA512.FromBytes(manifest), sha512Digest)
+	res, err := MatchesDigest(manifest, sha512Digest)
+	require.NoError(t, err)
+	assert.True(t, res)
+}
+
 func TestMatchesDigest(t *testing.T) {
 	cases := []struct {
 		path           string
@@ -87,6 +117,8 @@ func TestMatchesDigest(t *testing.T) {
 		{"v2s1.manifest.json", TestDockerV2S2ManifestDigest, false},
 		// Unrecognized algorithm
 		{"v2s2.manifest.json", digest.Digest("md5:2872f31c5c1f62a694fbd20c1e85257c"), false},
+		// A known but unsupported algorithm
+		{"v2s2.manifest.json", digest.Digest("sha384:" + strings.Repeat("0", 96)), false},
 		// Mangled format
 		{"v2s2.manifest.json", digest.Digest(TestDockerV2S2ManifestDigest.String() + "abc"), false},
 		{"v2s2.manifest.json", digest.Digest(TestDockerV2S2ManifestDigest.String()[:20]), false},
@@ -110,6 +142,17 @@ func TestMatchesDigest(t *testing.T) {
 	res, err = MatchesDigest([]byte{}, digest.Digest(digestSha256EmptyTar))
 	assert.True(t, res)
 	assert.NoError(t, err)
+
+	for _, path := range []string{"v2s2.manifest.json", "v2s1-unsigned.manifest.json"} {
+		manifest, err := os.ReadFile(filepath.Join("testdata", path))
+		require.NoError(t, err)
+		res, err := MatchesDigest(manifest, digest.SHA512.FromBytes(manifest))
+		require.NoError(t, err)
+		assert.True(t, res, path)
+		res, err = MatchesDigest(manifest, digest.SHA512.FromString("something else"))
+		require.NoError(t, err)
+		assert.False(t, res, path)
+	}
 }
 
 func TestNormalizedMIMEType(t *testing.T) {
@@ -195,6 +238,10 @@ func TestCandidateCompressionMatchesReuseConditions(t *testing.T) {
 		{&compression.Gzip, nil, &compression.Zstd, false},
 		{&compression.Zstd, nil, nil, false},
 		{nil, nil, &compression.Zstd, true},
+		{&compression.Zstd, nil, &compression.ZstdChunked, true},
+		{&compression.ZstdChunked, nil, &compression.ZstdChunked, true},
+		{&compression.ZstdChunked, nil, &compression.Zstd, false},
+		{&compression.ZstdChunked, nil, nil, false},
 		// PossibleManifestFormats restrictions
 		{nil, []string{imgspecv1.MediaTypeImageManifest}, &compression.Zstd, true},
 		{nil, []string{DockerV2Schema2MediaType}, &compression.Zstd, false},
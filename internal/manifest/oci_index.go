@@ -165,6 +165,15 @@ func (index *OCI1IndexPublic) editInstances(editInstances []ListEdit) error {
 				Platform:     editInstance.AddPlatform,
 				Annotations:  annotations,
 			})
+		case ListOpRemove:
+			targetIndex := slices.IndexFunc(index.Manifests, func(m imgspecv1.Descriptor) bool {
+				return m.Digest == editInstance.RemoveDigest
+			})
+			if targetIndex == -1 {
+				return fmt.Errorf("OCI1Index.EditInstances: digest %s not found", editInstance.RemoveDigest)
+			}
+			// slices.Clone() here to ensure a private backing array, as in the ListOpAdd case.
+			index.Manifests = slices.Delete(slices.Clone(index.Manifests), targetIndex, targetIndex+1)
 		default:
 			return fmt.Errorf("internal error: invalid operation: %d", editInstance.ListOperation)
 		}
@@ -197,6 +206,88 @@ func (index *OCI1Index) EditInstances(editInstances []ListEdit) error {
 	return index.editInstances(editInstances)
 }
 
+// instanceIndex returns the position of the instance with instanceDigest in index.Manifests.
+func (index *OCI1IndexPublic) instanceIndex(instanceDigest digest.Digest) (int, error) {
+	i := slices.IndexFunc(index.Manifests, func(m imgspecv1.Descriptor) bool {
+		return m.Digest == instanceDigest
+	})
+	if i == -1 {
+		return -1, fmt.Errorf("instance %s not found in OCI1Index", instanceDigest)
+	}
+	return i, nil
+}
+
+// AddInstance adds a copy of instance at the end of the index.
+// It fails if the index already contains an instance with the same digest.
+func (index *OCI1IndexPublic) AddInstance(instance imgspecv1.Descriptor) error {
+	if err := instance.Digest.Validate(); err != nil {
+		return fmt.Errorf("adding instance %q to OCI1Index: %w", instance.Digest, err)
+	}
+	if _, err := index.instanceIndex(instance.Digest); err == nil {
+		return fmt.Errorf("adding instance %s to OCI1Index: the index already contains it", instance.Digest)
+	}
+	// slices.Clone() here to ensure a private backing array, as in editInstances.
+	index.Manifests = append(slices.Clone(index.Manifests), ociIndexDescriptorClone(instance))
+	return nil
+}
+
+// RemoveInstance removes the instance with instanceDigest from the index.
+// The order of the remaining instances is preserved.
+func (index *OCI1IndexPublic) RemoveInstance(instanceDigest digest.Digest) error {
+	return index.editInstances([]ListEdit{{ListOperation: ListOpRemove, RemoveDigest: instanceDigest}})
+}
+
+// ReplaceInstance replaces the instance with oldDigest by a copy of instance, at the same position in the index.
+// It fails if the index already contains a different instance with the digest of instance.
+func (index *OCI1IndexPublic) ReplaceInstance(oldDigest digest.Digest, instance imgspecv1.Descriptor) error {
+	i, err := index.instanceIndex(oldDigest)
+	if err != nil {
+		return err
+	}
+	if err := instance.Digest.Validate(); err != nil {
+		return fmt.Errorf("replacing instance %s in OCI1Index with %q: %w", oldDigest, instance.Digest, err)
+	}
+	if instance.Digest != oldDigest {
+		if _, err := index.instanceIndex(instance.Digest); err == nil {
+			return fmt.Errorf("replacing instance %s in OCI1Index with %s: the index already contains it", oldDigest, instance.Digest)
+		}
+	}
+	// slices.Clone() here to ensure a private backing array, as in AddInstance.
+	index.Manifests = slices.Clone(index.Manifests)
+	index.Manifests[i] = ociIndexDescriptorClone(instance)
+	return nil
+}
+
+// SetInstancePlatform sets the platform of the instance with instanceDigest to a copy of platform; nil removes the platform.
+func (index *OCI1IndexPublic) SetInstancePlatform(instanceDigest digest.Digest, platform *imgspecv1.Platform) error {
+	i, err := index.instanceIndex(instanceDigest)
+	if err != nil {
+		return err
+	}
+	// slices.Clone() here to ensure a private backing array, as in AddInstance.
+	index.Manifests = slices.Clone(index.Manifests)
+	if platform == nil {
+		index.Manifests[i].Platform = nil
+	} else {
+		platformCopy := ociPlatformClone(*platform)
+		index.Manifests[i].Platform = &platformCopy
+	}
+	return nil
+}
+
+// SetInstanceAnnotations sets the annotations of the instance with instanceDigest to a copy of annotations,
+// replacing any previous annotations; nil removes all annotations.
+func (index *OCI1IndexPublic) SetInstanceAnnotations(instanceDigest digest.Digest, annotations map[string]string) error {
+	i, err := index.instanceIndex(instanceDigest)
+	if err != nil {
+		return err
+	}
+	// slices.Clone() here to ensure a private backing array, as in AddInstance.
+	index.Manifests = slices.Clone(index.Manifests)
+	index.Manifests[i].Annotations = maps.Clone(annotations)
+	return nil
+}
+
 // instanceIsZstd returns true if instance is a zstd instance otherwise false.
 func instanceIsZstd(manifest imgspecv1.Descriptor) bool {
 	if value, ok := manifest.Annotations[OCI1InstanceAnnotationCompressionZSTD]; ok && value == "true" {
@@ -275,6 +366,7 @@ func (index *OCI1IndexPublic) ChooseInstance(ctx *types.SystemContext) (digest.D
 
 // Serialize returns the index in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
+// The output is deterministic: equal indexes, including the order of instances, serialize to identical blobs.
 func (index *OCI1IndexPublic) Serialize() ([]byte, error) {
 	buf, err := json.Marshal(index)
 	if err != nil {
@@ -296,29 +388,39 @@ func OCI1IndexPublicFromComponents(components []imgspecv1.Descriptor, annotation
 		},
 	}
 	for i, component := range components {
-		var platform *imgspecv1.Platform
-		if component.Platform != nil {
-			platformCopy := ociPlatformClone(*component.Platform)
-			platform = &platformCopy
-		}
-		m := imgspecv1.Descriptor{
-			MediaType:    component.MediaType,
-			ArtifactType: component.ArtifactType,
-			Size:         component.Size,
-			Digest:       component.Digest,
-			URLs:         slices.Clone(component.URLs),
-			Annotations:  maps.Clone(component.Annotations),
-			Platform:     platform,
-		}
-		index.Manifests[i] = m
+		index.Manifests[i] = ociIndexDescriptorClone(component)
 	}
 	return &index
 }
 
+// ociIndexDescriptorClone returns an independent copy of an index entry d.
+func ociIndexDescriptorClone(d imgspecv1.Descriptor) imgspecv1.Descriptor {
+	var platform *imgspecv1.Platform
+	if d.Platform != nil {
+		platformCopy := ociPlatformClone(*d.Platform)
+		platform = &platformCopy
+	}
+	return imgspecv1.Descriptor{
+		MediaType:    d.MediaType,
+		ArtifactType: d.ArtifactType,
+		Size:         d.Size,
+		Digest:       d.Digest,
+		URLs:         slices.Clone(d.URLs),
+		Annotations:  maps.Clone(d.Annotations),
+		Platform:     platform,
+	}
+}
+
 // OCI1IndexPublicClone creates a deep copy of the passed-in index.
 // This is publicly visible as c/image/manifest.OCI1IndexClone.
 func OCI1IndexPublicClone(index *OCI1IndexPublic) *OCI1IndexPublic {
-	return OCI1IndexPublicFromComponents(index.Manifests, index.Annotations)
+	res := OCI1IndexPublicFromComponents(index.Manifests, index.Annotations)
+	res.ArtifactType = index.ArtifactType
+	if index.Subject != nil {
+		subject := ociIndexDescriptorClone(*index.Subject)
+		res.Subject = &subject
+	}
+	return res
 }
 
 // ToOCI1Index returns the index encoded as an OCI1 index.
@@ -327,7 +429,15 @@ func (index *OCI1IndexPublic) ToOCI1Index() (*OCI1IndexPublic, error) {
 }
 
 // ToSchema2List returns the index encoded as a Schema2 list.
+// It fails with UnsupportedFieldConversionError if the index has a subject or an artifact type,
+// which Schema2 lists can’t represent.
 func (index *OCI1IndexPublic) ToSchema2List() (*Schema2ListPublic, error) {
+	if index.Subject != nil {
+		return nil, UnsupportedFieldConversionError{Field: "subject", TargetMIMEType: DockerV2ListMediaType}
+	}
+	if index.ArtifactType != "" {
+		return nil, UnsupportedFieldConversionError{Field: "artifactType", TargetMIMEType: DockerV2ListMediaType}
+	}
 	components := make([]Schema2ManifestDescriptor, 0, len(index.Manifests))
 	for _, manifest := range index.Manifests {
 		platform := manifest.Platform
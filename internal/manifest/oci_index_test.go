@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/containers/image/v5/pkg/compression"
@@ -188,6 +189,135 @@ func TestOCI1EditInstances(t *testing.T) {
 	instance, err = list.Instance(digest.Digest("sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"))
 	require.NoError(t, err)
 	assert.Equal(t, "application/x-tar", instance.ReadOnly.ArtifactType)
+
+	// Remove an instance
+	originalListOrder := list.Instances()
+	err = list.EditInstances([]ListEdit{{
+		ListOperation: ListOpRemove,
+		RemoveDigest:  digest.Digest("sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, slices.DeleteFunc(slices.Clone(originalListOrder), func(d digest.Digest) bool {
+		return d == digest.Digest("sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	}), list.Instances())
+	err = list.EditInstances([]ListEdit{{
+		ListOperation: ListOpRemove,
+		RemoveDigest:  digest.Digest("sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+	}})
+	assert.Error(t, err)
+}
+
+func TestOCI1IndexInstanceEditing(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("testdata", "ociv1.image.index.json"))
+	require.NoError(t, err)
+	index, err := OCI1IndexPublicFromManifest(validManifest)
+	require.NoError(t, err)
+	original := index.Instances()
+	newDigest := digest.Digest("sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	replacementDigest := digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc")
+
+	// AddInstance
+	annotations := map[string]string{"a": "b"}
+	platform := imgspecv1.Platform{OS: "linux", Architecture: "riscv64"}
+	err = index.AddInstance(imgspecv1.Descriptor{
+		MediaType:   imgspecv1.MediaTypeImageManifest,
+		Digest:      newDigest,
+		Size:        42,
+		Platform:    &platform,
+		Annotations: annotations,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, append(slices.Clone(original), newDigest), index.Instances())
+	annotations["a"] = "modified" // The index must contain a copy
+	platform.Architecture = "modified"
+	instance, err := index.Instance(newDigest)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b"}, instance.ReadOnly.Annotations)
+	assert.Equal(t, &imgspecv1.Platform{OS: "linux", Architecture: "riscv64"}, instance.ReadOnly.Platform)
+	err = index.AddInstance(imgspecv1.Descriptor{Digest: newDigest}) // Duplicate
+	assert.Error(t, err)
+	err = index.AddInstance(imgspecv1.Descriptor{Digest: "invalid"})
+	assert.Error(t, err)
+
+	// SetInstancePlatform, SetInstanceAnnotations
+	err = index.SetInstancePlatform(newDigest, &imgspecv1.Platform{OS: "linux", Architecture: "s390x"})
+	require.NoError(t, err)
+	err = index.SetInstanceAnnotations(newDigest, map[string]string{"c": "d"})
+	require.NoError(t, err)
+	instance, err = index.Instance(newDigest)
+	require.NoError(t, err)
+	assert.Equal(t, &imgspecv1.Platform{OS: "linux", Architecture: "s390x"}, instance.ReadOnly.Platform)
+	assert.Equal(t, map[string]string{"c": "d"}, instance.ReadOnly.Annotations)
+	err = index.SetInstancePlatform(newDigest, nil)
+	require.NoError(t, err)
+	instance, err = index.Instance(newDigest)
+	require.NoError(t, err)
+	assert.Nil(t, instance.ReadOnly.Platform)
+	err = index.SetInstancePlatform(replacementDigest, nil)
+	assert.Error(t, err)
+	err = index.SetInstanceAnnotations(replacementDigest, nil)
+	assert.Error(t, err)
+
+	// ReplaceInstance
+	aliased := index.Manifests
+	err = index.ReplaceInstance(original[0], imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: replacementDigest, Size: 1})
+	require.NoError(t, err)
+	assert.Equal(t, original[0], aliased[0].Digest) // Like AddInstance, edits don’t write into a caller’s copy of Manifests
+	expected := append(slices.Clone(original), newDigest)
+	expected[0] = replacementDigest
+	assert.Equal(t, expected, index.Instances())
+	err = index.ReplaceInstance(replacementDigest, imgspecv1.Descriptor{Digest: newDigest}) // Duplicate
+	assert.Error(t, err)
+	err = index.ReplaceInstance(original[0], imgspecv1.Descriptor{Digest: newDigest}) // Not found
+	assert.Error(t, err)
+
+	// RemoveInstance
+	err = index.RemoveInstance(replacementDigest)
+	require.NoError(t, err)
+	assert.Equal(t, expected[1:], index.Instances())
+	err = index.RemoveInstance(replacementDigest)
+	assert.Error(t, err)
+
+	// Serialization is deterministic
+	serialized1, err := index.Serialize()
+	require.NoError(t, err)
+	parsed, err := OCI1IndexPublicFromManifest(serialized1)
+	require.NoError(t, err)
+	serialized2, err := parsed.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, serialized1, serialized2)
+}
+
+func TestOCI1IndexToSchema2List(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("testdata", "ociv1.image.index.json"))
+	require.NoError(t, err)
+	index, err := OCI1IndexPublicFromManifest(validManifest)
+	require.NoError(t, err)
+	list, err := index.ToSchema2List()
+	require.NoError(t, err)
+	assert.Equal(t, index.Instances(), list.Instances())
+
+	// Fields which can’t be represented in a Schema2 list are not silently dropped
+	for field, edit := range map[string]func(*OCI1IndexPublic){
+		"subject": func(i *OCI1IndexPublic) {
+			i.Subject = &imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: index.Manifests[0].Digest, Size: 1}
+		},
+		"artifactType": func(i *OCI1IndexPublic) { i.ArtifactType = "application/vnd.example.collection" },
+	} {
+		edited := OCI1IndexPublicClone(index)
+		edit(edited)
+		// OCI-to-OCI conversions preserve the field
+		converted, err := edited.ConvertToMIMEType(imgspecv1.MediaTypeImageIndex)
+		require.NoError(t, err, field)
+		assert.Equal(t, edited, converted, field)
+
+		_, err = edited.ToSchema2List()
+		var unsupportedField UnsupportedFieldConversionError
+		require.ErrorAs(t, err, &unsupportedField, field)
+		assert.Equal(t, UnsupportedFieldConversionError{Field: field, TargetMIMEType: DockerV2ListMediaType}, unsupportedField)
+		_, err = edited.ConvertToMIMEType(DockerV2ListMediaType)
+		assert.ErrorAs(t, err, &unsupportedField, field)
+	}
 }
 
 func TestOCI1IndexChooseInstanceByCompression(t *testing.T) {
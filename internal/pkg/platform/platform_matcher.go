@@ -154,6 +154,24 @@ var compatibility = map[string][]string{
 // the most compatible platform is first.
 // If some option (arch, os, variant) is not present, a value from current platform is detected.
 func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
+	return WantedPlatformsWithOptions(ctx, MatchOptions{})
+}
+
+// MatchOptions modifies the platforms returned by WantedPlatformsWithOptions.
+// The zero value corresponds to WantedPlatforms.
+type MatchOptions struct {
+	// If true, only the wanted variant is accepted; there is no fallback to less capable variants,
+	// or to platforms without a variant.
+	StrictVariant bool
+	// If not nil, overrides the built-in variant fallback chains: for each architecture, the list of known variants,
+	// from the most capable to the least capable (e.g. "arm": {"v8", "v7", "v6"}).
+	VariantFallbacks map[string][]string
+}
+
+// WantedPlatformsWithOptions returns all compatible platforms with the platform specifics possibly overridden by user,
+// and modified by options, the most compatible platform is first.
+// If some option (arch, os, variant) is not present, a value from current platform is detected.
+func WantedPlatformsWithOptions(ctx *types.SystemContext, options MatchOptions) ([]imgspecv1.Platform, error) {
 	// Note that this does not use Platform.OSFeatures and Platform.OSVersion at all.
 	// The fields are not specified by the OCI specification, as of version 1.1, usefully enough
 	// to be interoperable, anyway.
@@ -179,11 +197,17 @@ func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
 		wantedOS = ctx.OSChoice
 	}
 
+	fallbacks := compatibility
+	if options.VariantFallbacks != nil {
+		fallbacks = options.VariantFallbacks
+	}
 	var variants []string = nil
-	if wantedVariant != "" {
+	if options.StrictVariant {
+		variants = []string{wantedVariant}
+	} else if wantedVariant != "" {
 		// If the user requested a specific variant, we'll walk down
 		// the list from most to least compatible.
-		if variantOrder := compatibility[wantedArch]; variantOrder != nil {
+		if variantOrder := fallbacks[wantedArch]; variantOrder != nil {
 			if i := slices.Index(variantOrder, wantedVariant); i != -1 {
 				variants = variantOrder[i:]
 			}
@@ -198,7 +222,7 @@ func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
 		// Make sure to have a candidate with an empty variant as well.
 		variants = append(variants, "")
 		// If available add the entire compatibility matrix for the specific architecture.
-		if possibleVariants, ok := compatibility[wantedArch]; ok {
+		if possibleVariants, ok := fallbacks[wantedArch]; ok {
 			variants = append(variants, possibleVariants...)
 		}
 	}
@@ -221,3 +245,13 @@ func MatchesPlatform(image imgspecv1.Platform, wanted imgspecv1.Platform) bool {
 		image.OS == wanted.OS &&
 		image.Variant == wanted.Variant
 }
+
+// MatchesOSVersion returns true if the os.version value of a platform descriptor from a multi-arch image, imageOSVersion,
+// matches wanted, which is either an exact value, or a prefix followed by "*" (e.g. "10.0.17763.*").
+// An empty wanted value matches any imageOSVersion.
+func MatchesOSVersion(imageOSVersion string, wanted string) bool {
+	if prefix, ok := strings.CutSuffix(wanted, "*"); ok {
+		return strings.HasPrefix(imageOSVersion, prefix)
+	}
+	return wanted == "" || imageOSVersion == wanted
+}
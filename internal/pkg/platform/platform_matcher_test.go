@@ -59,3 +59,61 @@ func TestWantedPlatforms(t *testing.T) {
 		assert.Equal(t, c.expected, platforms, testName)
 	}
 }
+
+func TestWantedPlatformsWithOptions(t *testing.T) {
+	sys := &types.SystemContext{ArchitectureChoice: "arm", OSChoice: "linux", VariantChoice: "v7"}
+	for _, c := range []struct {
+		name     string
+		options  MatchOptions
+		expected []imgspecv1.Platform
+	}{
+		{
+			name: "default",
+			expected: []imgspecv1.Platform{
+				{OS: "linux", Architecture: "arm", Variant: "v7"},
+				{OS: "linux", Architecture: "arm", Variant: "v6"},
+				{OS: "linux", Architecture: "arm", Variant: "v5"},
+				{OS: "linux", Architecture: "arm", Variant: ""},
+			},
+		},
+		{
+			name:    "strict",
+			options: MatchOptions{StrictVariant: true},
+			expected: []imgspecv1.Platform{
+				{OS: "linux", Architecture: "arm", Variant: "v7"},
+			},
+		},
+		{
+			name:    "custom fallbacks",
+			options: MatchOptions{VariantFallbacks: map[string][]string{"arm": {"v8", "v7", "v6"}}},
+			expected: []imgspecv1.Platform{
+				{OS: "linux", Architecture: "arm", Variant: "v7"},
+				{OS: "linux", Architecture: "arm", Variant: "v6"},
+				{OS: "linux", Architecture: "arm", Variant: ""},
+			},
+		},
+	} {
+		platforms, err := WantedPlatformsWithOptions(sys, c.options)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, platforms, c.name)
+	}
+}
+
+func TestMatchesOSVersion(t *testing.T) {
+	for _, c := range []struct {
+		image, wanted string
+		expected      bool
+	}{
+		{"10.0.17763.5329", "", true},
+		{"", "", true},
+		{"10.0.17763.5329", "10.0.17763.5329", true},
+		{"10.0.17763.5329", "10.0.17763.1", false},
+		{"10.0.17763.5329", "10.0.17763.*", true},
+		{"10.0.20348.2227", "10.0.17763.*", false},
+		{"", "10.0.17763.*", false},
+		{"anything", "*", true},
+	} {
+		res := MatchesOSVersion(c.image, c.wanted)
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%q vs. %q", c.image, c.wanted))
+	}
+}
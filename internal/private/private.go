@@ -38,6 +38,9 @@ type ImageSource interface {
 type ImageDestinationInternalOnly interface {
 	// SupportsPutBlobPartial returns true if PutBlobPartial is supported.
 	SupportsPutBlobPartial() bool
+	// AcceptsNonImageArtifacts returns true if the destination can store manifests whose config is not an image configuration
+	// (e.g. OCI artifacts like Helm charts), verbatim.
+	AcceptsNonImageArtifacts() bool
 	// FIXME: Add SupportsSignaturesWithFormat or something like that, to allow early failures
 	// on unsupported formats.
 
@@ -78,6 +81,15 @@ type ImageDestination interface {
 	ImageDestinationInternalOnly
 }
 
+// ImageDestinationWithDigestAlgorithm is an optional extension of ImageDestination, implemented by destinations
+// which can be configured to use a non-default digest algorithm (see types.SystemContext.DigestAlgorithm).
+type ImageDestinationWithDigestAlgorithm interface {
+	ImageDestination
+	// DigestAlgorithm returns the algorithm the destination uses for digests of blobs and manifests it creates;
+	// callers creating new objects to write to the destination should use the same algorithm.
+	DigestAlgorithm() digest.Algorithm
+}
+
 // UploadedBlob is information about a blob written to a destination.
 // It is the subset of types.BlobInfo fields the transport is responsible for setting; all fields must be provided.
 type UploadedBlob struct {
@@ -136,41 +148,22 @@ type ReusedBlob struct {
 	// a differently-compressed blob.
 	CompressionOperation types.LayerCompression // Compress/Decompress, matching the reused blob; PreserveOriginal if N/A
 	CompressionAlgorithm *compression.Algorithm // Algorithm if compressed, nil if decompressed or N/A
+	// Annotations that should be added, for CompressionAlgorithm. Note that they might need to be
+	// added even if the digest doesn’t change (if we found the annotations in a cache).
+	CompressionAnnotations map[string]string
 
 	MatchedByTOCDigest bool // Whether the layer was reused/matched by TOC digest. Used only for UI purposes.
 }
 
 // ImageSourceChunk is a portion of a blob.
 // This API is experimental and can be changed without bumping the major version number.
-type ImageSourceChunk struct {
-	// Offset specifies the starting position of the chunk within the source blob.
-	Offset uint64
-
-	// Length specifies the size of the chunk.  If it is set to math.MaxUint64,
-	// then it refers to all the data from Offset to the end of the blob.
-	Length uint64
-}
+type ImageSourceChunk = types.ImageSourceChunk
 
 // BlobChunkAccessor allows fetching discontiguous chunks of a blob.
-type BlobChunkAccessor interface {
-	// GetBlobAt returns a sequential channel of readers that contain data for the requested
-	// blob chunks, and a channel that might get a single error value.
-	// The specified chunks must be not overlapping and sorted by their offset.
-	// The readers must be fully consumed, in the order they are returned, before blocking
-	// to read the next chunk.
-	// If the Length for the last chunk is set to math.MaxUint64, then it
-	// fully fetches the remaining data from the offset to the end of the blob.
-	GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []ImageSourceChunk) (chan io.ReadCloser, chan error, error)
-}
+type BlobChunkAccessor = types.BlobChunkAccessor
 
 // BadPartialRequestError is returned by BlobChunkAccessor.GetBlobAt on an invalid request.
-type BadPartialRequestError struct {
-	Status string
-}
-
-func (e BadPartialRequestError) Error() string {
-	return e.Status
-}
+type BadPartialRequestError = types.BadPartialRequestError
 
 // UnparsedImage is an internal extension to the types.UnparsedImage interface.
 type UnparsedImage interface {
@@ -72,3 +72,32 @@ func TestDigestIfCanonicalUnknown(t *testing.T) {
 		},
 	})
 }
+
+func TestDigestIfSupportedUnknown(t *testing.T) {
+	for _, algorithm := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+		testDigester(t, func(stream io.Reader, blobInfo types.BlobInfo) (Digester, io.Reader) {
+			return DigestIfSupportedUnknown(stream, blobInfo, algorithm)
+		}, []testCase{
+			{
+				inputDigest:    digest.Digest("sha256:uninspected-value"),
+				computesDigest: false,
+				expectedDigest: digest.Digest("sha256:uninspected-value"),
+			},
+			{
+				inputDigest:    digest.Digest("sha512:uninspected-value"),
+				computesDigest: false,
+				expectedDigest: digest.Digest("sha512:uninspected-value"),
+			},
+			{
+				inputDigest:    digest.Digest("unknown-algorithm:uninspected-value"),
+				computesDigest: true,
+				expectedDigest: algorithm.FromBytes(testData),
+			},
+			{
+				inputDigest:    "",
+				computesDigest: true,
+				expectedDigest: algorithm.FromBytes(testData),
+			},
+		})
+	}
+}
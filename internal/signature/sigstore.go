@@ -17,6 +17,8 @@ const (
 	SigstoreCertificateAnnotationKey = "dev.sigstore.cosign/certificate"
 	// from sigstore/cosign/pkg/oci/static.ChainAnnotationKey
 	SigstoreIntermediateCertificateChainAnnotationKey = "dev.sigstore.cosign/chain"
+	// The artifact type of manifests containing signatures, used by cosign when attaching signatures using the OCI referrers API
+	SigstoreSignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
 )
 
 // Sigstore is a github.com/cosign/cosign signature.
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/containers/image/v5/internal/putblobdigest"
+	"github.com/containers/image/v5/internal/supporteddigests"
 	"github.com/containers/image/v5/internal/tmpdir"
 	"github.com/containers/image/v5/types"
 )
@@ -15,6 +16,10 @@ import (
 // It is the caller's responsibility to call the cleanup function, which closes and removes the temporary file.
 // If an error occurs, inputInfo is not modified.
 func ComputeBlobInfo(sys *types.SystemContext, stream io.Reader, inputInfo *types.BlobInfo) (io.Reader, func(), error) {
+	algorithm, err := supporteddigests.ForNewObjects(sys)
+	if err != nil {
+		return nil, nil, err
+	}
 	diskBlob, err := tmpdir.CreateBigFileTemp(sys, "stream-blob")
 	if err != nil {
 		return nil, nil, fmt.Errorf("creating temporary on-disk layer: %w", err)
@@ -23,7 +28,7 @@ func ComputeBlobInfo(sys *types.SystemContext, stream io.Reader, inputInfo *type
 		diskBlob.Close()
 		os.Remove(diskBlob.Name())
 	}
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, *inputInfo)
+	digester, stream := putblobdigest.DigestIfSupportedUnknown(stream, *inputInfo, algorithm)
 	written, err := io.Copy(diskBlob, stream)
 	if err != nil {
 		cleanup()
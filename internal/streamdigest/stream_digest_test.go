@@ -1,11 +1,13 @@
 package streamdigest
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"testing"
 
 	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,3 +36,28 @@ func TestComputeBlobInfo(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, b, fixtureBytes)
 }
+
+func TestComputeBlobInfoDigestAlgorithm(t *testing.T) {
+	fixtureBytes := []byte("Hello")
+	for _, c := range []struct {
+		inputDigest    digest.Digest
+		expectedDigest digest.Digest
+	}{
+		{"", digest.SHA512.FromBytes(fixtureBytes)},
+		{digest.SHA256.FromBytes(fixtureBytes), digest.SHA256.FromBytes(fixtureBytes)}, // A known supported digest is preserved
+	} {
+		inputInfo := types.BlobInfo{Digest: c.inputDigest, Size: -1}
+		streamCopy, cleanup, err := ComputeBlobInfo(&types.SystemContext{DigestAlgorithm: digest.SHA512}, bytes.NewReader(fixtureBytes), &inputInfo)
+		require.NoError(t, err)
+		defer cleanup()
+		assert.Equal(t, types.BlobInfo{Digest: c.expectedDigest, Size: int64(len(fixtureBytes))}, inputInfo)
+		b, err := io.ReadAll(streamCopy)
+		require.NoError(t, err)
+		assert.Equal(t, fixtureBytes, b)
+	}
+
+	inputInfo := types.BlobInfo{Digest: "", Size: -1}
+	_, _, err := ComputeBlobInfo(&types.SystemContext{DigestAlgorithm: "md5"}, bytes.NewReader(fixtureBytes), &inputInfo)
+	assert.Error(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: "", Size: -1}, inputInfo)
+}
@@ -0,0 +1,33 @@
+// Package supporteddigests centralizes the choice of digest algorithms which this module can compute and verify.
+package supporteddigests
+
+import (
+	_ "crypto/sha256" // Register the algorithms with go-digest.
+	_ "crypto/sha512"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// IsSupported returns true if digests using algorithm can be computed and verified.
+func IsSupported(algorithm digest.Algorithm) bool {
+	switch algorithm {
+	case digest.SHA256, digest.SHA512:
+		return true
+	default:
+		return false
+	}
+}
+
+// ForNewObjects returns the algorithm to use for digests of blobs and manifests created when writing to a destination
+// configured by sys, per types.SystemContext.DigestAlgorithm.
+func ForNewObjects(sys *types.SystemContext) (digest.Algorithm, error) {
+	if sys == nil || sys.DigestAlgorithm == "" {
+		return digest.Canonical, nil
+	}
+	if !IsSupported(sys.DigestAlgorithm) {
+		return "", fmt.Errorf("digest algorithm %q is not supported", sys.DigestAlgorithm)
+	}
+	return sys.DigestAlgorithm, nil
+}
@@ -0,0 +1,49 @@
+package supporteddigests
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSupported(t *testing.T) {
+	for _, c := range []struct {
+		algorithm digest.Algorithm
+		expected  bool
+	}{
+		{digest.SHA256, true},
+		{digest.SHA512, true},
+		{digest.SHA384, false},
+		{"md5", false},
+		{"", false},
+	} {
+		assert.Equal(t, c.expected, IsSupported(c.algorithm), c.algorithm)
+		if c.expected {
+			assert.True(t, c.algorithm.Available(), c.algorithm)
+		}
+	}
+}
+
+func TestForNewObjects(t *testing.T) {
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		expected digest.Algorithm
+	}{
+		{nil, digest.Canonical},
+		{&types.SystemContext{}, digest.Canonical},
+		{&types.SystemContext{DigestAlgorithm: digest.SHA256}, digest.SHA256},
+		{&types.SystemContext{DigestAlgorithm: digest.SHA512}, digest.SHA512},
+	} {
+		res, err := ForNewObjects(c.sys)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, res)
+	}
+
+	for _, algorithm := range []digest.Algorithm{digest.SHA384, "md5", "unknown"} {
+		_, err := ForNewObjects(&types.SystemContext{DigestAlgorithm: algorithm})
+		assert.Error(t, err, algorithm)
+	}
+}
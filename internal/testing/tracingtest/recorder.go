@@ -0,0 +1,196 @@
+// Package tracingtest provides an OpenTelemetry TracerProvider which records spans in memory, for use in tests.
+//
+// It only uses the OpenTelemetry API, so that tests don’t make the OpenTelemetry SDK a dependency of this module.
+package tracingtest
+
+import (
+	"context"
+	"encoding/binary"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// Recorder is a trace.TracerProvider which records all spans started using its tracers.
+type Recorder struct {
+	embedded.TracerProvider
+
+	mutex  sync.Mutex
+	lastID uint64
+	ended  []*Span
+}
+
+// NewRecorder returns a new, empty, Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Tracer returns a tracer which records spans in r.
+func (r *Recorder) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return &tracer{recorder: r}
+}
+
+// Ended returns the spans which have ended, in the order in which they ended.
+func (r *Recorder) Ended() []*Span {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return slices.Clone(r.ended)
+}
+
+// newID returns a new unique, non-zero, ID.
+func (r *Recorder) newID() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lastID++
+	return r.lastID
+}
+
+// tracer is a trace.Tracer which records spans in a Recorder.
+type tracer struct {
+	embedded.Tracer
+
+	recorder *Recorder
+}
+
+func (t *tracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(options...)
+	parent := trace.SpanContextFromContext(ctx)
+	if config.NewRoot() {
+		parent = trace.SpanContext{}
+	}
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		binary.BigEndian.PutUint64(traceID[8:], t.recorder.newID())
+	}
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], t.recorder.newID())
+	span := &Span{
+		recorder: t.recorder,
+		name:     name,
+		kind:     config.SpanKind(),
+		parent:   parent,
+		spanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}),
+		attributes: slices.Clone(config.Attributes()),
+	}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// Status is the status of a Span.
+type Status struct {
+	Code        codes.Code
+	Description string
+}
+
+// Span is a trace.Span recorded by a Recorder.
+type Span struct {
+	embedded.Span
+
+	recorder    *Recorder
+	mutex       sync.Mutex
+	name        string
+	kind        trace.SpanKind
+	parent      trace.SpanContext
+	spanContext trace.SpanContext
+	attributes  []attribute.KeyValue
+	status      Status
+	ended       bool
+}
+
+// End ends the span, and records it in its Recorder.
+func (s *Span) End(options ...trace.SpanEndOption) {
+	s.mutex.Lock()
+	alreadyEnded := s.ended
+	s.ended = true
+	s.mutex.Unlock()
+	if !alreadyEnded {
+		s.recorder.mutex.Lock()
+		s.recorder.ended = append(s.recorder.ended, s)
+		s.recorder.mutex.Unlock()
+	}
+}
+
+// AddEvent does nothing; events are not recorded.
+func (s *Span) AddEvent(name string, options ...trace.EventOption) {}
+
+// IsRecording returns true until the span ends.
+func (s *Span) IsRecording() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.ended
+}
+
+// RecordError does nothing; errors are only recorded if they are reported using SetStatus.
+func (s *Span) RecordError(err error, options ...trace.EventOption) {}
+
+// SpanContext returns the SpanContext of the span.
+func (s *Span) SpanContext() trace.SpanContext {
+	return s.spanContext
+}
+
+// SetStatus sets the status of the span.
+func (s *Span) SetStatus(code codes.Code, description string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if code != codes.Error {
+		description = "" // As specified by OpenTelemetry
+	}
+	s.status = Status{Code: code, Description: description}
+}
+
+// SetName sets the name of the span.
+func (s *Span) SetName(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.name = name
+}
+
+// SetAttributes adds kv to the attributes of the span.
+func (s *Span) SetAttributes(kv ...attribute.KeyValue) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes = append(s.attributes, kv...)
+}
+
+// TracerProvider returns the Recorder of the span.
+func (s *Span) TracerProvider() trace.TracerProvider {
+	return s.recorder
+}
+
+// Name returns the name of the span.
+func (s *Span) Name() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.name
+}
+
+// SpanKind returns the kind of the span.
+func (s *Span) SpanKind() trace.SpanKind {
+	return s.kind
+}
+
+// Parent returns the SpanContext of the parent of the span, which is not valid if the span has no parent.
+func (s *Span) Parent() trace.SpanContext {
+	return s.parent
+}
+
+// Attributes returns the attributes of the span.
+func (s *Span) Attributes() []attribute.KeyValue {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.attributes)
+}
+
+// Status returns the status of the span.
+func (s *Span) Status() Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status
+}
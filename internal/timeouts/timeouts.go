@@ -0,0 +1,248 @@
+// Package timeouts implements the network timeouts configured in types.SystemContext.
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// TimeoutError is returned when an operation made no progress within the configured types.SystemContext.RequestTimeout.
+type TimeoutError struct {
+	Limit time.Duration // The configured timeout
+	Err   error         // The error the operation failed with after it was canceled
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after making no progress for %s: %v", e.Limit, e.Err)
+}
+
+// Unwrap returns context.DeadlineExceeded, so that callers can recognize timeouts using errors.Is.
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Timeout returns true, like the net.Error implementations.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// ConnectTimeout returns the timeout for establishing a network connection configured in sys, or defaultTimeout.
+func ConnectTimeout(sys *types.SystemContext, defaultTimeout time.Duration) time.Duration {
+	if sys != nil && sys.ConnectTimeout > 0 {
+		return sys.ConnectTimeout
+	}
+	return defaultTimeout
+}
+
+// ApplyToTransport configures tr to use the connection and response timeouts configured in sys.
+// It should be called after tr.DialContext is set, if the caller uses a custom one.
+// Note that this only limits the time to receive response headers; use NewRoundTripper to also limit reading response bodies.
+func ApplyToTransport(tr *http.Transport, sys *types.SystemContext) {
+	if sys == nil {
+		return
+	}
+	if sys.ConnectTimeout > 0 {
+		dial := tr.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext
+		}
+		timeout := sys.ConnectTimeout
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return dial(ctx, network, addr)
+		}
+		tr.TLSHandshakeTimeout = timeout
+	}
+	if sys.RequestTimeout > 0 {
+		tr.ResponseHeaderTimeout = sys.RequestTimeout
+	}
+}
+
+// NewRoundTripper returns a http.RoundTripper which uses rt, and fails requests which make no progress
+// for the types.SystemContext.RequestTimeout configured in sys, while sending the request body, while waiting
+// for the response, and while reading the response body.
+// If sys does not configure a timeout, it returns rt.
+func NewRoundTripper(rt http.RoundTripper, sys *types.SystemContext) http.RoundTripper {
+	if sys == nil || sys.RequestTimeout <= 0 {
+		return rt
+	}
+	return &roundTripper{rt: rt, timeout: sys.RequestTimeout}
+}
+
+// roundTripper is a http.RoundTripper which enforces a request timeout.
+type roundTripper struct {
+	rt      http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	w, ctx := newWatchdog(req.Context(), t.timeout)
+	req = req.WithContext(ctx)
+	// Uploading a large body can take much longer than the timeout; restart the timeout whenever
+	// the transport consumes more of the body.
+	// The transport may still be reading the body after RoundTrip returns, e.g. if the server responded early;
+	// that must not affect the watchdog any more, so uploadReaders stop using it when uploadDone is set.
+	uploadDone := &atomic.Bool{}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &uploadReader{rc: req.Body, w: w, done: uploadDone}
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				rc, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return &uploadReader{rc: rc, w: w, done: uploadDone}, nil
+			}
+		}
+	}
+	res, err := t.rt.RoundTrip(req)
+	uploadDone.Store(true)
+	if err != nil {
+		w.Stop()
+		return nil, w.Err(err)
+	}
+	res.Body = w.Wrap(res.Body)
+	return res, nil
+}
+
+// CloseIdleConnections calls the CloseIdleConnections method of the underlying http.RoundTripper, if any,
+// so that http.Client.CloseIdleConnections works.
+func (t *roundTripper) CloseIdleConnections() {
+	if c, ok := t.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// uploadReader is an io.ReadCloser for a request body, which restarts a Watchdog whenever data is read.
+type uploadReader struct {
+	rc   io.ReadCloser
+	w    *Watchdog
+	done *atomic.Bool // Set when RoundTrip returns; from then on the watchdog is not restarted.
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if n > 0 && !r.done.Load() {
+		r.w.Resume()
+	}
+	return n, err
+}
+
+func (r *uploadReader) Close() error {
+	return r.rc.Close()
+}
+
+// Watchdog cancels a context if an operation spends more than a timeout waiting for a server while the watchdog is active.
+// All methods of a nil *Watchdog do nothing, so callers don’t need to check whether a timeout is configured.
+type Watchdog struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// errWatchdogExpired is the cancellation cause of contexts canceled by a Watchdog.
+var errWatchdogExpired = errors.New("watchdog expired")
+
+// NewWatchdog returns a Watchdog for the types.SystemContext.RequestTimeout configured in sys, and a child of ctx
+// which it cancels. The watchdog is initially active.
+// If sys does not configure a timeout, it returns (nil, ctx).
+// The caller must call Stop when the operation is done.
+func NewWatchdog(ctx context.Context, sys *types.SystemContext) (*Watchdog, context.Context) {
+	if sys == nil || sys.RequestTimeout <= 0 {
+		return nil, ctx
+	}
+	return newWatchdog(ctx, sys.RequestTimeout)
+}
+
+// newWatchdog returns an active Watchdog for timeout, and a child of ctx which it cancels.
+func newWatchdog(ctx context.Context, timeout time.Duration) (*Watchdog, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	w := &Watchdog{
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: timeout,
+	}
+	w.timer = time.AfterFunc(timeout, func() {
+		cancel(errWatchdogExpired)
+	})
+	return w, ctx
+}
+
+// Resume activates the watchdog, with the full timeout.
+func (w *Watchdog) Resume() {
+	if w == nil {
+		return
+	}
+	w.timer.Reset(w.timeout)
+}
+
+// Pause deactivates the watchdog, e.g. while the caller is processing data instead of waiting for a server.
+func (w *Watchdog) Pause() {
+	if w == nil {
+		return
+	}
+	w.timer.Stop()
+}
+
+// Stop deactivates the watchdog, and cancels its context.
+func (w *Watchdog) Stop() {
+	if w == nil {
+		return
+	}
+	w.timer.Stop()
+	w.cancel(nil)
+}
+
+// Err returns err, or a *TimeoutError if err was caused by the watchdog canceling its context.
+func (w *Watchdog) Err(err error) error {
+	if w == nil || err == nil {
+		return err
+	}
+	if errors.Is(context.Cause(w.ctx), errWatchdogExpired) {
+		return &TimeoutError{Limit: w.timeout, Err: err}
+	}
+	return err
+}
+
+// Wrap deactivates the watchdog, and returns a reader of rc which activates the watchdog during each Read call,
+// and stops the watchdog when it is closed.
+// If w is nil, it returns rc.
+func (w *Watchdog) Wrap(rc io.ReadCloser) io.ReadCloser {
+	if w == nil {
+		return rc
+	}
+	w.Pause()
+	return &watchedReader{rc: rc, w: w}
+}
+
+// watchedReader is an io.ReadCloser which activates a Watchdog during each Read call.
+type watchedReader struct {
+	rc io.ReadCloser
+	w  *Watchdog
+}
+
+func (r *watchedReader) Read(p []byte) (int, error) {
+	r.w.Resume()
+	n, err := r.rc.Read(p)
+	r.w.Pause()
+	if err != nil && err != io.EOF {
+		err = r.w.Err(err)
+	}
+	return n, err
+}
+
+func (r *watchedReader) Close() error {
+	err := r.rc.Close()
+	r.w.Stop()
+	return err
+}
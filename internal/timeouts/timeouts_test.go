@@ -0,0 +1,177 @@
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectTimeout(t *testing.T) {
+	assert.Equal(t, 5*time.Second, ConnectTimeout(nil, 5*time.Second))
+	assert.Equal(t, 5*time.Second, ConnectTimeout(&types.SystemContext{}, 5*time.Second))
+	assert.Equal(t, time.Second, ConnectTimeout(&types.SystemContext{ConnectTimeout: time.Second}, 5*time.Second))
+}
+
+func TestApplyToTransport(t *testing.T) {
+	// Nothing configured
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		tr := &http.Transport{TLSHandshakeTimeout: 10 * time.Second}
+		ApplyToTransport(tr, sys)
+		assert.Nil(t, tr.DialContext)
+		assert.Equal(t, 10*time.Second, tr.TLSHandshakeTimeout)
+		assert.Equal(t, time.Duration(0), tr.ResponseHeaderTimeout)
+	}
+
+	// A custom DialContext is used, with a deadline
+	var dialDeadline time.Time
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			dialDeadline = deadline
+			return nil, errors.New("dial failed")
+		},
+	}
+	ApplyToTransport(tr, &types.SystemContext{ConnectTimeout: time.Minute, RequestTimeout: 2 * time.Minute})
+	assert.Equal(t, time.Minute, tr.TLSHandshakeTimeout)
+	assert.Equal(t, 2*time.Minute, tr.ResponseHeaderTimeout)
+	start := time.Now()
+	_, err := tr.DialContext(context.Background(), "tcp", "localhost:1")
+	assert.Error(t, err)
+	assert.WithinDuration(t, start.Add(time.Minute), dialDeadline, 10*time.Second)
+}
+
+func TestNewRoundTripper(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	sys := &types.SystemContext{RequestTimeout: timeout}
+
+	// Nothing configured
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		assert.Same(t, http.DefaultTransport, NewRoundTripper(http.DefaultTransport, sys))
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte("contents"))
+		case "/slow-headers":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		case "/upload":
+			_, _ = io.Copy(io.Discard, r.Body)
+			_, _ = w.Write([]byte("uploaded"))
+		case "/slow-body":
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: NewRoundTripper(http.DefaultTransport, sys)}
+	defer client.CloseIdleConnections()
+
+	// A successful request is not affected by the time the caller spends between reads.
+	res, err := client.Get(server.URL + "/ok")
+	require.NoError(t, err)
+	time.Sleep(3 * timeout)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(body))
+	res.Body.Close()
+
+	// A request body which takes longer than the timeout to upload, but keeps making progress.
+	uploadReader, uploadWriter := io.Pipe()
+	go func() {
+		for i := 0; i < 6; i++ {
+			time.Sleep(timeout / 2)
+			_, _ = uploadWriter.Write([]byte("chunk"))
+		}
+		uploadWriter.Close()
+	}()
+	res, err = client.Post(server.URL+"/upload", "application/octet-stream", uploadReader)
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "uploaded", string(body))
+	res.Body.Close()
+
+	// A request body which stops making progress
+	stalledReader, stalledWriter := io.Pipe()
+	go func() {
+		_, _ = stalledWriter.Write([]byte("chunk"))
+		// http.Transport waits for the body to return from Read, so it must eventually fail.
+		time.Sleep(5 * timeout)
+		stalledWriter.CloseWithError(errors.New("stalled body"))
+	}()
+	_, err = client.Post(server.URL+"/upload", "application/octet-stream", stalledReader)
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+
+	// No response
+	_, err = client.Get(server.URL + "/slow-headers")
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, timeout, timeoutErr.Limit)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A response body which stops making progress
+	res, err = client.Get(server.URL + "/slow-body")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	_, err = io.ReadAll(res.Body)
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWatchdog(t *testing.T) {
+	// No timeout configured
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		ctx := context.Background()
+		w, ctx2 := NewWatchdog(ctx, sys)
+		assert.Nil(t, w)
+		assert.Equal(t, ctx, ctx2)
+		// All methods can be called on a nil *Watchdog.
+		w.Resume()
+		w.Pause()
+		err := errors.New("some error")
+		assert.Equal(t, err, w.Err(err))
+		rc := io.NopCloser(nil)
+		assert.Equal(t, rc, w.Wrap(rc))
+		w.Stop()
+	}
+
+	// A paused watchdog does not expire.
+	w, ctx := NewWatchdog(context.Background(), &types.SystemContext{RequestTimeout: 50 * time.Millisecond})
+	w.Pause()
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, ctx.Err())
+	// An active one does.
+	w.Resume()
+	<-ctx.Done()
+	err := w.Err(ctx.Err())
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.True(t, timeoutErr.Timeout())
+	w.Stop()
+
+	// Errors not caused by the watchdog are returned unmodified.
+	w, ctx = NewWatchdog(context.Background(), &types.SystemContext{RequestTimeout: time.Hour})
+	w.Stop()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.Equal(t, context.Canceled, w.Err(context.Canceled))
+}
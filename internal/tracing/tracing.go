@@ -0,0 +1,90 @@
+// Package tracing creates OpenTelemetry spans for operations of this module.
+//
+// Spans are only recorded if the context passed to the instrumented operation contains a span
+// (e.g. started by the caller using its own TracerProvider); they are created using the TracerProvider of that span.
+// Otherwise, tracing has no effect, and no global OpenTelemetry state is used.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the tracer used by this module.
+const instrumentationName = "github.com/containers/image/v5"
+
+// Attribute keys used by spans of this module.
+const (
+	SourceKey      = attribute.Key("containers.image.source")
+	DestinationKey = attribute.Key("containers.image.destination")
+	InstanceKey    = attribute.Key("containers.image.instance")
+	DigestKey      = attribute.Key("containers.image.blob.digest")
+	SizeKey        = attribute.Key("containers.image.blob.size")
+	LayerIndexKey  = attribute.Key("containers.image.layer.index")
+	TransportKey   = attribute.Key("containers.image.transport")
+)
+
+// StartSpan starts a span named name, with attrs, as a child of the span in ctx, if any.
+// The caller must call EndSpan on the returned span.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(instrumentationName)
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err, if not nil, in span, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// NewRoundTripper returns a http.RoundTripper which uses rt, and records a client span for every request,
+// as a child of the span in the request’s context, if any.
+func NewRoundTripper(rt http.RoundTripper) http.RoundTripper {
+	return &roundTripper{rt: rt}
+}
+
+// roundTripper is a http.RoundTripper which records spans.
+type roundTripper struct {
+	rt http.RoundTripper
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	parent := trace.SpanFromContext(req.Context())
+	if !parent.SpanContext().IsValid() {
+		return t.rt.RoundTrip(req)
+	}
+	ctx, span := parent.TracerProvider().Tracer(instrumentationName).Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.Redacted()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		))
+	res, err := t.rt.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		EndSpan(span, err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	span.End()
+	return res, nil
+}
+
+// CloseIdleConnections calls the CloseIdleConnections method of the underlying http.RoundTripper, if any,
+// so that http.Client.CloseIdleConnections works.
+func (t *roundTripper) CloseIdleConnections() {
+	if c, ok := t.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
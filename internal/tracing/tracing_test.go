@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containers/image/v5/internal/testing/tracingtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartSpan(t *testing.T) {
+	// Without a span in the context, nothing is recorded.
+	ctx, span := StartSpan(context.Background(), "no-op")
+	assert.False(t, span.SpanContext().IsValid())
+	assert.False(t, trace.SpanFromContext(ctx).SpanContext().IsValid())
+	EndSpan(span, nil)
+
+	recorder := tracingtest.NewRecorder()
+	ctx, parent := recorder.Tracer("test").Start(context.Background(), "parent")
+	_, child := StartSpan(ctx, "child", SourceKey.String("src"))
+	EndSpan(child, errors.New("failed"))
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Contains(t, spans[0].Attributes(), SourceKey.String("src"))
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "failed", spans[0].Status().Description)
+}
+
+func TestRoundTripper(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+	client := &http.Client{Transport: NewRoundTripper(http.DefaultTransport)}
+
+	recorder := tracingtest.NewRecorder()
+	for _, traced := range []bool{false, true} {
+		ctx := context.Background()
+		var parent trace.Span
+		if traced {
+			ctx, parent = recorder.Tracer("test").Start(ctx, "parent")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/v2/", nil)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		if parent != nil {
+			parent.End()
+		}
+	}
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2) // The HTTP request of the traced iteration, and its parent
+	assert.Equal(t, "HTTP GET", spans[0].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Contains(t, spans[0].Attributes(), semconv.URLFull(s.URL+"/v2/"))
+	assert.Contains(t, spans[0].Attributes(), semconv.HTTPResponseStatusCode(http.StatusNotFound))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
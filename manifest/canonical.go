@@ -0,0 +1,60 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Canonicalize returns manifestBlob re-serialized in a canonical form: object keys are sorted, there is no insignificant
+// whitespace, and strings use the escaping of encoding/json. Numbers are preserved as written.
+// Manifests which differ only in key order or formatting have the same canonical form, so tools that edit and re-serialize
+// manifests can use it (or CanonicalDigest) to get reproducible results.
+//
+// Note that canonicalizing a manifest changes its digest unless it already was in the canonical form;
+// signed Docker schema1 manifests are rejected, because canonicalizing them would invalidate the signatures.
+func Canonicalize(manifestBlob []byte) ([]byte, error) {
+	if GuessMIMEType(manifestBlob) == DockerV2Schema1SignedMediaType {
+		return nil, errors.New("canonicalizing signed schema1 manifests is not supported")
+	}
+	dec := json.NewDecoder(bytes.NewReader(manifestBlob))
+	dec.UseNumber()
+	var parsed any
+	if err := dec.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("parsing manifest: unexpected data after the JSON value")
+	}
+	if _, ok := parsed.(map[string]any); !ok {
+		return nil, errors.New("parsing manifest: not a JSON object")
+	}
+	// json.Marshal sorts the keys of maps, and writes json.Number values verbatim.
+	res, err := json.Marshal(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("serializing manifest: %w", err)
+	}
+	return res, nil
+}
+
+// CanonicalDigest returns the digest of the canonical form of manifestBlob, as returned by Canonicalize.
+func CanonicalDigest(manifestBlob []byte) (digest.Digest, error) {
+	canonical, err := Canonicalize(manifestBlob)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(canonical), nil
+}
+
+// IsCanonical returns true if manifestBlob is already in the canonical form returned by Canonicalize.
+func IsCanonical(manifestBlob []byte) (bool, error) {
+	canonical, err := Canonicalize(manifestBlob)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(canonical, manifestBlob), nil
+}
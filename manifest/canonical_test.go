@@ -0,0 +1,91 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{`{}`, `{}`},
+		{`{"b": 1, "a": {"d": [3, 2, 1], "c": "x"}}`, `{"a":{"c":"x","d":[3,2,1]},"b":1}`},
+		{"\n{\n\t\"schemaVersion\" : 2 ,\n\t\"size\": 12345678901234567890\n}\n", `{"schemaVersion":2,"size":12345678901234567890}`},
+		{`{"a": 1.50, "b": "A"}`, `{"a":1.50,"b":"A"}`},
+	} {
+		res, err := Canonicalize([]byte(c.input))
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, string(res), c.input)
+		// Canonicalization is idempotent.
+		res2, err := Canonicalize(res)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, res, res2, c.input)
+	}
+
+	for _, input := range []string{
+		``,
+		`{`,
+		`{} {}`,
+		`[]`,
+		`"a string"`,
+	} {
+		_, err := Canonicalize([]byte(input))
+		assert.Error(t, err, input)
+	}
+
+	// Signed schema1 manifests are rejected.
+	manifest, err := os.ReadFile(filepath.Join("fixtures", "v2s1.manifest.json"))
+	require.NoError(t, err)
+	_, err = Canonicalize(manifest)
+	assert.Error(t, err)
+}
+
+func TestCanonicalDigest(t *testing.T) {
+	for _, fixture := range []string{"ociv1.manifest.json", "ociv1.image.index.json", "v2s2.manifest.json", "v2list.manifest.json", "v2s1-unsigned.manifest.json"} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", fixture))
+		require.NoError(t, err)
+		canonical, err := Canonicalize(manifest)
+		require.NoError(t, err)
+
+		d, err := CanonicalDigest(manifest)
+		require.NoError(t, err, fixture)
+		assert.Equal(t, digest.FromBytes(canonical), d, fixture)
+
+		// Reformatting the manifest doesn’t change the canonical digest.
+		var reformatted bytes.Buffer
+		err = json.Indent(&reformatted, manifest, "  ", "\t")
+		require.NoError(t, err, fixture)
+		d2, err := CanonicalDigest(reformatted.Bytes())
+		require.NoError(t, err, fixture)
+		assert.Equal(t, d, d2, fixture)
+	}
+
+	_, err := CanonicalDigest([]byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestIsCanonical(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected bool
+	}{
+		{`{}`, true},
+		{`{"a":1,"b":[1,2]}`, true},
+		{`{"b":1,"a":1}`, false},
+		{`{"a": 1}`, false},
+		{"{\"a\":1}\n", false},
+	} {
+		res, err := IsCanonical([]byte(c.input))
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+
+	_, err := IsCanonical([]byte(`{`))
+	assert.Error(t, err)
+}
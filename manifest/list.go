@@ -2,6 +2,8 @@ package manifest
 
 import (
 	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -33,3 +35,21 @@ func ListFromBlob(manifestBlob []byte, manifestMIMEType string) (List, error) {
 func ConvertListToMIMEType(list List, manifestMIMEType string) (List, error) {
 	return list.ConvertToMIMEType(manifestMIMEType)
 }
+
+// PlatformSelectionOptions modifies how CompatibleInstances and ChooseInstanceWithOptions select instances.
+// The zero value selects instances the same way as List.ChooseInstance, except that compression is not considered.
+type PlatformSelectionOptions = manifest.PlatformSelectionOptions
+
+// CompatibleInstances returns the instances of list which are compatible with the platform described by ctx
+// (or the current platform if ctx doesn't specify any details), modified by options,
+// ranked from the most to the least preferred.
+// Instances without a platform (which only OCI indexes allow) are compatible with any platform, and ranked last.
+func CompatibleInstances(list List, ctx *types.SystemContext, options PlatformSelectionOptions) ([]digest.Digest, error) {
+	return manifest.CompatibleInstances(list, ctx, options)
+}
+
+// ChooseInstanceWithOptions returns the most preferred instance of list which is compatible with the platform described by ctx
+// (or the current platform if ctx doesn't specify any details), modified by options; see CompatibleInstances.
+func ChooseInstanceWithOptions(list List, ctx *types.SystemContext, options PlatformSelectionOptions) (digest.Digest, error) {
+	return manifest.ChooseInstanceWithOptions(list, ctx, options)
+}
@@ -3,6 +3,7 @@ package manifest
 import (
 	"fmt"
 
+	"github.com/containers/image/v5/internal/errcategory"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/libtrust"
@@ -38,6 +39,11 @@ const (
 // on an object which is not a “container image” in the standard sense (e.g. an OCI artifact)
 type NonImageArtifactError = manifest.NonImageArtifactError
 
+// UnsupportedFieldConversionError (detected via errors.As) is used when a manifest can’t be converted
+// to a format which can’t represent one of its fields (e.g. the OCI “subject” field when converting to
+// Docker schema2), because silently dropping the field would change the meaning of the manifest.
+type UnsupportedFieldConversionError = manifest.UnsupportedFieldConversionError
+
 // SupportedSchema2MediaType checks if the specified string is a supported Docker v2s2 media type.
 func SupportedSchema2MediaType(m string) error {
 	switch m {
@@ -110,6 +116,12 @@ func Digest(manifestBlob []byte) (digest.Digest, error) {
 	return manifest.Digest(manifestBlob)
 }
 
+// DigestWithAlgorithm returns a digest of a docker manifest using algorithm, which must be digest.SHA256 or digest.SHA512,
+// with any necessary implied transformations like stripping v1s1 signatures.
+func DigestWithAlgorithm(manifestBlob []byte, algorithm digest.Algorithm) (digest.Digest, error) {
+	return manifest.DigestWithAlgorithm(manifestBlob, algorithm)
+}
+
 // MatchesDigest returns true iff the manifest matches expectedDigest.
 // Error may be set if this returns false.
 // Note that this is not doing ConstantTimeCompare; by the time we get here, the cryptographic signature must already have been verified,
@@ -154,17 +166,46 @@ func NormalizedMIMEType(input string) string {
 
 // FromBlob returns a Manifest instance for the specified manifest blob and the corresponding MIME type
 func FromBlob(manblob []byte, mt string) (Manifest, error) {
+	var m Manifest
+	var err error
 	nmt := NormalizedMIMEType(mt)
 	switch nmt {
 	case DockerV2Schema1MediaType, DockerV2Schema1SignedMediaType:
-		return Schema1FromManifest(manblob)
+		m, err = Schema1FromManifest(manblob)
 	case imgspecv1.MediaTypeImageManifest:
-		return OCI1FromManifest(manblob)
+		m, err = OCI1FromManifest(manblob)
 	case DockerV2Schema2MediaType:
-		return Schema2FromManifest(manblob)
+		m, err = Schema2FromManifest(manblob)
 	case DockerV2ListMediaType, imgspecv1.MediaTypeImageIndex:
 		return nil, fmt.Errorf("Treating manifest lists as individual manifests is not implemented")
+	default:
+		// Note that this may not be reachable, NormalizedMIMEType has a default for unknown values.
+		return nil, fmt.Errorf("Unimplemented manifest MIME type %q (normalized as %q)", mt, nmt)
+	}
+	if err != nil {
+		return nil, errcategory.Wrap(err, types.ErrManifestInvalid)
+	}
+	return m, nil
+}
+
+// SubjectAndArtifactType returns the subject (the manifest manblob refers to, e.g. if it is a signature or an SBOM)
+// and the artifactType fields of manblob with MIME type mt.
+// It returns nil and "" if the fields are not set, or if the manifest format does not support them.
+func SubjectAndArtifactType(manblob []byte, mt string) (*imgspecv1.Descriptor, string, error) {
+	switch NormalizedMIMEType(mt) {
+	case imgspecv1.MediaTypeImageManifest:
+		m, err := OCI1FromManifest(manblob)
+		if err != nil {
+			return nil, "", err
+		}
+		return m.Subject, m.ArtifactType, nil
+	case imgspecv1.MediaTypeImageIndex:
+		index, err := OCI1IndexFromManifest(manblob)
+		if err != nil {
+			return nil, "", err
+		}
+		return index.Subject, index.ArtifactType, nil
+	default:
+		return nil, "", nil
 	}
-	// Note that this may not be reachable, NormalizedMIMEType has a default for unknown values.
-	return nil, fmt.Errorf("Unimplemented manifest MIME type %q (normalized as %q)", mt, nmt)
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/types"
 	"github.com/containers/libtrust"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -167,3 +168,71 @@ func TestNormalizedMIMEType(t *testing.T) {
 		assert.Equal(t, DockerV2Schema1SignedMediaType, res, c)
 	}
 }
+
+func TestSubjectAndArtifactType(t *testing.T) {
+	subject := &imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		Size:      100,
+	}
+	artifact, err := OCI1ArtifactFromComponents("application/vnd.example.sbom", nil, subject, nil).Serialize()
+	require.NoError(t, err)
+	index := OCI1IndexFromComponents(nil, nil)
+	index.Subject = subject
+	index.ArtifactType = "application/vnd.example.collection"
+	indexBlob, err := index.Serialize()
+	require.NoError(t, err)
+	image, err := os.ReadFile(filepath.Join("fixtures", "ociv1.manifest.json"))
+	require.NoError(t, err)
+	schema2, err := os.ReadFile(filepath.Join("fixtures", "v2s2.manifest.json"))
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name                 string
+		manifest             []byte
+		mimeType             string
+		expectedSubject      *imgspecv1.Descriptor
+		expectedArtifactType string
+	}{
+		{"artifact", artifact, imgspecv1.MediaTypeImageManifest, subject, "application/vnd.example.sbom"},
+		{"index", indexBlob, imgspecv1.MediaTypeImageIndex, subject, "application/vnd.example.collection"},
+		{"OCI image", image, imgspecv1.MediaTypeImageManifest, nil, ""},
+		{"schema2", schema2, DockerV2Schema2MediaType, nil, ""},
+	} {
+		resSubject, resArtifactType, err := SubjectAndArtifactType(c.manifest, c.mimeType)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expectedSubject, resSubject, c.name)
+		assert.Equal(t, c.expectedArtifactType, resArtifactType, c.name)
+	}
+
+	_, _, err = SubjectAndArtifactType([]byte("invalid"), imgspecv1.MediaTypeImageManifest)
+	assert.Error(t, err)
+}
+
+func TestFromBlob(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		mimeType string
+	}{
+		{"ociv1.manifest.json", imgspecv1.MediaTypeImageManifest},
+		{"v2s2.manifest.json", DockerV2Schema2MediaType},
+		{"v2s1.manifest.json", DockerV2Schema1SignedMediaType},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.path))
+		require.NoError(t, err)
+		m, err := FromBlob(manifest, c.mimeType)
+		require.NoError(t, err, c.path)
+		assert.NotNil(t, m, c.path)
+	}
+
+	// Invalid manifests
+	for _, mimeType := range []string{imgspecv1.MediaTypeImageManifest, DockerV2Schema2MediaType, DockerV2Schema1SignedMediaType} {
+		_, err := FromBlob([]byte("invalid"), mimeType)
+		assert.ErrorIs(t, err, types.ErrManifestInvalid, mimeType)
+	}
+
+	// Manifest lists are not individual manifests, but they are not invalid either.
+	_, err := FromBlob([]byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`), imgspecv1.MediaTypeImageIndex)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, types.ErrManifestInvalid)
+}
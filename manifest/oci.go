@@ -79,6 +79,28 @@ func OCI1FromComponents(config imgspecv1.Descriptor, layers []imgspecv1.Descript
 	}
 }
 
+// OCI1ArtifactFromComponents creates an OCI1 manifest instance for a non-image artifact of artifactType,
+// using the empty config (imgspecv1.DescriptorEmptyJSON), as recommended by the OCI image specification.
+// If layers is empty, the manifest refers to the empty blob as its only layer, as the specification requires at least one layer.
+// subject, if not nil, is the manifest the artifact refers to (e.g. for signatures or SBOMs).
+// NOTE: The caller is responsible for making the empty blob (imgspecv1.DescriptorEmptyJSON.Data) available at the destination.
+func OCI1ArtifactFromComponents(artifactType string, layers []imgspecv1.Descriptor, subject *imgspecv1.Descriptor, annotations map[string]string) *OCI1 {
+	if len(layers) == 0 {
+		layers = []imgspecv1.Descriptor{imgspecv1.DescriptorEmptyJSON}
+	}
+	return &OCI1{
+		imgspecv1.Manifest{
+			Versioned:    specs.Versioned{SchemaVersion: 2},
+			MediaType:    imgspecv1.MediaTypeImageManifest,
+			ArtifactType: artifactType,
+			Config:       imgspecv1.DescriptorEmptyJSON,
+			Layers:       layers,
+			Subject:      subject,
+			Annotations:  annotations,
+		},
+	}
+}
+
 // OCI1Clone creates a copy of the supplied OCI1 manifest.
 func OCI1Clone(src *OCI1) *OCI1 {
 	return &OCI1{
@@ -86,6 +108,38 @@ func OCI1Clone(src *OCI1) *OCI1 {
 	}
 }
 
+// IsArtifact returns true if m is a non-image artifact, i.e. if its config is not an OCI image config.
+func (m *OCI1) IsArtifact() bool {
+	return m.Config.MediaType != imgspecv1.MediaTypeImageConfig
+}
+
+// EffectiveArtifactType returns the artifact type of m as defined by the OCI image specification:
+// the artifactType field if it is set, or the config media type otherwise.
+// Note that this returns imgspecv1.MediaTypeImageConfig for images; use IsArtifact to distinguish those.
+func (m *OCI1) EffectiveArtifactType() string {
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
+	return m.Config.MediaType
+}
+
+// OCI1DescriptorForManifest returns a descriptor of manifestBlob with mimeType, suitable e.g. as the subject of an artifact.
+// If mimeType is "", it is guessed from manifestBlob.
+func OCI1DescriptorForManifest(manifestBlob []byte, mimeType string) (imgspecv1.Descriptor, error) {
+	if mimeType == "" {
+		mimeType = GuessMIMEType(manifestBlob)
+	}
+	manifestDigest, err := Digest(manifestBlob)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestBlob)),
+	}, nil
+}
+
 // ConfigInfo returns a complete BlobInfo for the separate config object, or a BlobInfo{Digest:""} if there isn't a separate object.
 func (m *OCI1) ConfigInfo() types.BlobInfo {
 	return BlobInfoFromOCI1Descriptor(m.Config)
@@ -198,7 +252,7 @@ func (m *OCI1) Serialize() ([]byte, error) {
 
 // Inspect returns various information for (skopeo inspect) parsed from the manifest and configuration.
 func (m *OCI1) Inspect(configGetter func(types.BlobInfo) ([]byte, error)) (*types.ImageInspectInfo, error) {
-	if m.Config.MediaType != imgspecv1.MediaTypeImageConfig {
+	if m.IsArtifact() {
 		// We could return at least the layers, but that’s already available in a better format via types.Image.LayerInfos.
 		// Most software calling this without human intervention is going to expect the values to be realistic and relevant,
 		// and is probably better served by failing; we can always re-visit that later if we fail now, but
@@ -253,7 +307,7 @@ func (m *OCI1) ImageID(diffIDs []digest.Digest) (string, error) {
 	// without committing to that approach now.
 	// (The only known caller of ImageID is storage/storageImageDestination.computeID,
 	// which can’t work with non-image artifacts.)
-	if m.Config.MediaType != imgspecv1.MediaTypeImageConfig {
+	if m.IsArtifact() {
 		return "", manifest.NewNonImageArtifactError(&m.Manifest)
 	}
 
@@ -268,7 +322,7 @@ func (m *OCI1) ImageID(diffIDs []digest.Digest) (string, error) {
 // NOTE: Even if this returns true, the relevant format might not accept all compression algorithms; the set of accepted
 // algorithms depends not on the current format, but possibly on the target of a conversion.
 func (m *OCI1) CanChangeLayerCompression(mimeType string) bool {
-	if m.Config.MediaType != imgspecv1.MediaTypeImageConfig {
+	if m.IsArtifact() {
 		return false
 	}
 	return compressionVariantsRecognizeMIMEType(oci1CompressionMIMETypeSets, mimeType)
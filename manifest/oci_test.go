@@ -69,6 +69,73 @@ func TestOCI1FromManifest(t *testing.T) {
 	testValidManifestWithExtraFieldsIsRejected(t, parser, validManifest, []string{"fsLayers", "history", "manifests"})
 }
 
+func TestOCI1ArtifactFromComponents(t *testing.T) {
+	subject := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		Size:      100,
+	}
+	layer := imgspecv1.Descriptor{
+		MediaType: "application/spdx+json",
+		Digest:    "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+		Size:      200,
+	}
+	m := OCI1ArtifactFromComponents("application/vnd.example.sbom", []imgspecv1.Descriptor{layer}, &subject, map[string]string{"a": "b"})
+	blob, err := m.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, GuessMIMEType(blob))
+
+	parsed, err := OCI1FromManifest(blob)
+	require.NoError(t, err)
+	assert.Equal(t, m, parsed)
+	assert.True(t, parsed.IsArtifact())
+	assert.Equal(t, "application/vnd.example.sbom", parsed.EffectiveArtifactType())
+	assert.Equal(t, imgspecv1.DescriptorEmptyJSON, parsed.Config)
+	assert.Equal(t, []imgspecv1.Descriptor{layer}, parsed.Layers)
+	assert.Equal(t, &subject, parsed.Subject)
+	assert.Equal(t, map[string]string{"a": "b"}, parsed.Annotations)
+
+	// With no layers, the empty blob is used as the only layer
+	m = OCI1ArtifactFromComponents("application/vnd.example.signature", nil, nil, nil)
+	assert.Equal(t, []imgspecv1.Descriptor{imgspecv1.DescriptorEmptyJSON}, m.Layers)
+	assert.Nil(t, m.Subject)
+}
+
+func TestOCI1IsArtifact(t *testing.T) {
+	for _, c := range []struct {
+		fixture      string
+		isArtifact   bool
+		artifactType string
+	}{
+		{"ociv1.manifest.json", false, imgspecv1.MediaTypeImageConfig},
+		{"ociv1.artifact.json", true, "application/vnd.oci.custom.artifact.config.v1+json"},
+	} {
+		m := manifestOCI1FromFixture(t, c.fixture)
+		assert.Equal(t, c.isArtifact, m.IsArtifact(), c.fixture)
+		assert.Equal(t, c.artifactType, m.EffectiveArtifactType(), c.fixture)
+	}
+}
+
+func TestOCI1DescriptorForManifest(t *testing.T) {
+	for _, c := range []struct {
+		fixture, mimeType, expectedMIMEType string
+	}{
+		{"ociv1.manifest.json", "", imgspecv1.MediaTypeImageManifest},
+		{"ociv1.image.index.json", "", imgspecv1.MediaTypeImageIndex},
+		{"v2s2.manifest.json", DockerV2Schema2MediaType, DockerV2Schema2MediaType},
+	} {
+		blob, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		desc, err := OCI1DescriptorForManifest(blob, c.mimeType)
+		require.NoError(t, err, c.fixture)
+		assert.Equal(t, imgspecv1.Descriptor{
+			MediaType: c.expectedMIMEType,
+			Digest:    digest.FromBytes(blob),
+			Size:      int64(len(blob)),
+		}, desc, c.fixture)
+	}
+}
+
 func TestOCI1UpdateLayerInfos(t *testing.T) {
 	customCompression := compression.Algorithm{}
 
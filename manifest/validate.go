@@ -0,0 +1,157 @@
+package manifest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValidationViolation is a single way in which a manifest does not conform to its specification.
+type ValidationViolation struct {
+	Field       string // The path of the offending value, e.g. "layers.0.digest", or "(root)"
+	Description string
+}
+
+func (v ValidationViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Description)
+}
+
+//go:embed schemas/*.json
+var validationSchemaFiles embed.FS
+
+// validationSchemaFileNames maps the MIME types supported by Validate to their schema files.
+var validationSchemaFileNames = map[string]string{
+	imgspecv1.MediaTypeImageManifest: "schemas/oci-image-manifest.json",
+	imgspecv1.MediaTypeImageIndex:    "schemas/oci-image-index.json",
+	DockerV2Schema2MediaType:         "schemas/docker-v2s2-manifest.json",
+	DockerV2ListMediaType:            "schemas/docker-v2-list.json",
+}
+
+var (
+	validationSchemasLock sync.Mutex
+	validationSchemas     = map[string]*gojsonschema.Schema{} // MIME type -> compiled schema, populated on first use
+)
+
+// validationSchema returns the JSON schema for manifestMIMEType.
+func validationSchema(manifestMIMEType string) (*gojsonschema.Schema, error) {
+	validationSchemasLock.Lock()
+	defer validationSchemasLock.Unlock()
+	if schema, ok := validationSchemas[manifestMIMEType]; ok {
+		return schema, nil
+	}
+	fileName, ok := validationSchemaFileNames[manifestMIMEType]
+	if !ok {
+		return nil, fmt.Errorf("validating manifests with MIME type %q is not supported", manifestMIMEType)
+	}
+	data, err := validationSchemaFiles.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: reading schema for %q: %w", manifestMIMEType, err)
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, fmt.Errorf("internal error: loading schema for %q: %w", manifestMIMEType, err)
+	}
+	validationSchemas[manifestMIMEType] = schema
+	return schema, nil
+}
+
+// Validate checks manifestBlob, a manifest or a manifest list with manifestMIMEType, against the JSON schema
+// of its format, and against rules not expressed by the schema (e.g. that digests are valid, and that sizes
+// are consistent with embedded data).
+// If manifestMIMEType is "", it is guessed from manifestBlob.
+// Only OCI manifests and indexes, and Docker schema2 manifests and lists are supported.
+//
+// It returns the list of violations, which is empty if manifestBlob is valid; an error is only returned
+// if the manifest can’t be validated at all (e.g. if it is not JSON, or its MIME type is not supported).
+func Validate(manifestBlob []byte, manifestMIMEType string) ([]ValidationViolation, error) {
+	if manifestMIMEType == "" {
+		manifestMIMEType = GuessMIMEType(manifestBlob)
+	}
+	schema, err := validationSchema(manifestMIMEType)
+	if err != nil {
+		return nil, err
+	}
+	res, err := schema.Validate(gojsonschema.NewBytesLoader(manifestBlob))
+	if err != nil {
+		return nil, fmt.Errorf("validating manifest: %w", err)
+	}
+	violations := []ValidationViolation{}
+	for _, e := range res.Errors() {
+		violations = append(violations, ValidationViolation{Field: e.Field(), Description: e.Description()})
+	}
+
+	// A subset of fields of all supported formats; the Docker descriptors use the same field names as OCI.
+	var parsed struct {
+		MediaType    string                 `json:"mediaType"`
+		ArtifactType string                 `json:"artifactType"`
+		Config       *imgspecv1.Descriptor  `json:"config"`
+		Layers       []imgspecv1.Descriptor `json:"layers"`
+		Manifests    []imgspecv1.Descriptor `json:"manifests"`
+		Subject      *imgspecv1.Descriptor  `json:"subject"`
+	}
+	if err := json.Unmarshal(manifestBlob, &parsed); err != nil {
+		// The types of some fields don’t match; that has already been reported by the schema validation.
+		if len(violations) == 0 {
+			violations = append(violations, ValidationViolation{Field: "(root)", Description: err.Error()})
+		}
+		return violations, nil
+	}
+	if parsed.MediaType != "" && parsed.MediaType != manifestMIMEType {
+		violations = append(violations, ValidationViolation{Field: "mediaType",
+			Description: fmt.Sprintf("media type %q does not match the manifest type %q", parsed.MediaType, manifestMIMEType)})
+	}
+	if parsed.Config != nil {
+		violations = append(violations, validateDescriptor("config", *parsed.Config)...)
+		if parsed.Config.MediaType == imgspecv1.MediaTypeEmptyJSON {
+			if parsed.Config.Digest != imgspecv1.DescriptorEmptyJSON.Digest || parsed.Config.Size != imgspecv1.DescriptorEmptyJSON.Size {
+				violations = append(violations, ValidationViolation{Field: "config",
+					Description: fmt.Sprintf("config with media type %q does not refer to the empty JSON blob", imgspecv1.MediaTypeEmptyJSON)})
+			}
+			if manifestMIMEType == imgspecv1.MediaTypeImageManifest && parsed.ArtifactType == "" {
+				violations = append(violations, ValidationViolation{Field: "artifactType",
+					Description: fmt.Sprintf("artifactType must be set when the config media type is %q", imgspecv1.MediaTypeEmptyJSON)})
+			}
+		}
+	}
+	for i, layer := range parsed.Layers {
+		violations = append(violations, validateDescriptor(fmt.Sprintf("layers.%d", i), layer)...)
+	}
+	for i, manifest := range parsed.Manifests {
+		violations = append(violations, validateDescriptor(fmt.Sprintf("manifests.%d", i), manifest)...)
+	}
+	if parsed.Subject != nil {
+		violations = append(violations, validateDescriptor("subject", *parsed.Subject)...)
+	}
+	return violations, nil
+}
+
+// validateDescriptor returns violations of rules not expressed by the JSON schemas in desc, at field.
+func validateDescriptor(field string, desc imgspecv1.Descriptor) []ValidationViolation {
+	res := []ValidationViolation{}
+	digestValid := false
+	if desc.Digest != "" { // A missing digest is reported by the JSON schema
+		if err := desc.Digest.Validate(); err != nil {
+			res = append(res, ValidationViolation{Field: field + ".digest", Description: err.Error()})
+		} else {
+			digestValid = true
+		}
+	}
+	if desc.Size < 0 {
+		res = append(res, ValidationViolation{Field: field + ".size", Description: fmt.Sprintf("invalid negative size %d", desc.Size)})
+	}
+	if desc.Data != nil {
+		if int64(len(desc.Data)) != desc.Size {
+			res = append(res, ValidationViolation{Field: field + ".size",
+				Description: fmt.Sprintf("size %d does not match the size of the embedded data, %d", desc.Size, len(desc.Data))})
+		}
+		if digestValid && desc.Digest.Algorithm().FromBytes(desc.Data) != desc.Digest {
+			res = append(res, ValidationViolation{Field: field + ".digest",
+				Description: fmt.Sprintf("digest %s does not match the embedded data", desc.Digest)})
+		}
+	}
+	return res
+}
@@ -0,0 +1,110 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	// Valid manifests
+	for _, c := range []struct{ fixture, mimeType string }{
+		{"ociv1.manifest.json", imgspecv1.MediaTypeImageManifest},
+		{"ociv1.image.index.json", imgspecv1.MediaTypeImageIndex},
+		{"v2s2.manifest.json", DockerV2Schema2MediaType},
+		{"v2list.manifest.json", DockerV2ListMediaType},
+		{"ociv1.manifest.json", ""},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		violations, err := Validate(manifest, c.mimeType)
+		require.NoError(t, err, c.fixture)
+		assert.Empty(t, violations, c.fixture)
+	}
+	artifact, err := OCI1ArtifactFromComponents("application/vnd.example.sbom", nil, nil, nil).Serialize()
+	require.NoError(t, err)
+	violations, err := Validate(artifact, imgspecv1.MediaTypeImageManifest)
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+
+	// Invalid manifests
+	validOCI, err := os.ReadFile(filepath.Join("fixtures", "ociv1.manifest.json"))
+	require.NoError(t, err)
+	validDocker, err := os.ReadFile(filepath.Join("fixtures", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name           string
+		manifest       string
+		mimeType       string
+		expectedFields []string
+	}{
+		{
+			name:           "missing layers",
+			manifest:       `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}}`,
+			mimeType:       imgspecv1.MediaTypeImageManifest,
+			expectedFields: []string{"(root)"},
+		},
+		{
+			name:           "invalid digest length",
+			manifest:       strings.Replace(string(validOCI), "sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7", "sha256:b5b2b2c5", 1),
+			mimeType:       imgspecv1.MediaTypeImageManifest,
+			expectedFields: []string{"config.digest"},
+		},
+		{
+			name:           "negative size",
+			manifest:       strings.Replace(string(validDocker), `"size": 7023`, `"size": -1`, 1),
+			mimeType:       DockerV2Schema2MediaType,
+			expectedFields: []string{"config.size"},
+		},
+		{
+			name:           "mismatched media type",
+			manifest:       string(validOCI),
+			mimeType:       imgspecv1.MediaTypeImageIndex,
+			expectedFields: []string{"(root)", "mediaType"},
+		},
+		{
+			name: "empty config without artifactType",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+				`"config":{"mediaType":"application/vnd.oci.empty.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},` +
+				`"layers":[{"mediaType":"application/vnd.oci.empty.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}]}`,
+			mimeType:       imgspecv1.MediaTypeImageManifest,
+			expectedFields: []string{"artifactType"},
+		},
+		{
+			name: "embedded data mismatch",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example",` +
+				`"config":{"mediaType":"application/vnd.oci.empty.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","data":"e30="},` +
+				`"layers":[{"mediaType":"application/vnd.example","size":3,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","data":"e30="}]}`,
+			mimeType:       imgspecv1.MediaTypeImageManifest,
+			expectedFields: []string{"layers.0.size"},
+		},
+		{
+			name:           "list entry without platform",
+			manifest:       `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","size":1,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}]}`,
+			mimeType:       DockerV2ListMediaType,
+			expectedFields: []string{"manifests.0"},
+		},
+	} {
+		violations, err := Validate([]byte(c.manifest), c.mimeType)
+		require.NoError(t, err, c.name)
+		fields := []string{}
+		for _, v := range violations {
+			fields = append(fields, v.Field)
+		}
+		assert.Subset(t, fields, c.expectedFields, c.name)
+		assert.NotEmpty(t, violations, c.name)
+	}
+
+	// Manifests which can’t be validated at all
+	_, err = Validate([]byte("not JSON"), imgspecv1.MediaTypeImageManifest)
+	assert.Error(t, err)
+	v2s1, err := os.ReadFile(filepath.Join("fixtures", "v2s1.manifest.json"))
+	require.NoError(t, err)
+	_, err = Validate(v2s1, DockerV2Schema1SignedMediaType)
+	assert.Error(t, err)
+}
@@ -1,49 +1,110 @@
 package archive
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"time"
 
-	"github.com/containers/image/v5/internal/imagedestination"
 	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
-	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/streamdigest"
+	"github.com/containers/image/v5/internal/supporteddigests"
 	"github.com/containers/image/v5/types"
-	"github.com/containers/storage/pkg/archive"
-	"github.com/containers/storage/pkg/idtools"
 	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 )
 
+// ociArchiveImageDestination writes an OCI layout directly into a tar stream, without staging it in a temporary directory.
+// Blobs are written into the stream as they are received; index.json is written last, by Commit.
 type ociArchiveImageDestination struct {
 	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.NoSignaturesInitialize
 
-	ref          ociArchiveReference
-	unpackedDest private.ImageDestination
-	tempDirRef   tempDirOCIRef
+	ref             ociArchiveReference
+	sys             *types.SystemContext
+	digestAlgorithm digest.Algorithm // Used for digests we compute, see types.SystemContext.DigestAlgorithm.
+	file            *os.File         // A temporary file next to ref.resolvedFile, renamed to ref.resolvedFile by Commit.
+	tar             *tar.Writer
+	// The fields below are not thread-safe; callers of PutBlob are serialized because HasThreadSafePutBlob is false.
+	blobs       map[digest.Digest]int64 // Blobs (including manifests) already written to tar, and their sizes.
+	directories map[string]struct{}     // Directories already written to tar.
+	index       imgspecv1.Index
+	// If not nil, a failure has left the tar stream in an unknown state, so the archive can not be completed.
+	broken error
 }
 
-// newImageDestination returns an ImageDestination for writing to an existing directory.
+// newImageDestination returns an ImageDestination for writing an OCI archive to ref.resolvedFile.
+// The archive only replaces any existing file at that path when the destination is committed.
 func newImageDestination(ctx context.Context, sys *types.SystemContext, ref ociArchiveReference) (private.ImageDestination, error) {
-	tempDirRef, err := createOCIRef(sys, ref.image)
+	digestAlgorithm, err := supporteddigests.ForNewObjects(sys)
 	if err != nil {
-		return nil, fmt.Errorf("creating oci reference: %w", err)
+		return nil, err
 	}
-	unpackedDest, err := tempDirRef.ociRefExtracted.NewImageDestination(ctx, sys)
+	file, err := os.CreateTemp(filepath.Dir(ref.resolvedFile), ".oci-archive")
 	if err != nil {
-		if err := tempDirRef.deleteTempDir(); err != nil {
-			return nil, fmt.Errorf("deleting temp directory %q: %w", tempDirRef.tempDirectory, err)
-		}
-		return nil, err
+		return nil, fmt.Errorf("creating temporary file for %q: %w", ref.resolvedFile, err)
+	}
+
+	desiredLayerCompression := types.Compress
+	if sys != nil && sys.OCIAcceptUncompressedLayers {
+		desiredLayerCompression = types.PreserveOriginal
 	}
 	d := &ociArchiveImageDestination{
-		ref:          ref,
-		unpackedDest: imagedestination.FromPublic(unpackedDest),
-		tempDirRef:   tempDirRef,
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes: []string{
+				imgspecv1.MediaTypeImageManifest,
+				imgspecv1.MediaTypeImageIndex,
+			},
+			DesiredLayerCompression:        desiredLayerCompression,
+			AcceptsForeignLayerURLs:        true,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
+			HasThreadSafePutBlob:           false,
+			AcceptsNonImageArtifacts:       true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+		NoSignaturesInitialize:     stubs.NoSignatures("Pushing signatures for OCI images is not supported"),
+
+		ref:             ref,
+		sys:             sys,
+		digestAlgorithm: digestAlgorithm,
+		file:            file,
+		tar:             tar.NewWriter(file),
+		blobs:           map[digest.Digest]int64{},
+		directories:     map[string]struct{}{},
+		index: imgspecv1.Index{
+			Versioned: imgspec.Versioned{
+				SchemaVersion: 2,
+			},
+			Annotations: make(map[string]string),
+		},
 	}
 	d.Compat = impl.AddCompat(d)
+
+	layoutBytes, err := json.Marshal(imgspecv1.ImageLayout{
+		Version: imgspecv1.ImageLayoutVersion,
+	})
+	if err == nil {
+		err = d.sendBytes(imgspecv1.ImageLayoutFile, layoutBytes)
+	}
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
 	return d, nil
 }
 
@@ -52,55 +113,22 @@ func (d *ociArchiveImageDestination) Reference() types.ImageReference {
 	return d.ref
 }
 
-// Close removes resources associated with an initialized ImageDestination, if any
-// Close deletes the temp directory of the oci-archive image
+// Close removes resources associated with an initialized ImageDestination, if any.
+// If the destination has not been committed, the partially written archive is deleted.
 func (d *ociArchiveImageDestination) Close() error {
-	defer func() {
-		err := d.tempDirRef.deleteTempDir()
-		logrus.Debugf("Error deleting temporary directory: %v", err)
-	}()
-	return d.unpackedDest.Close()
-}
-
-func (d *ociArchiveImageDestination) SupportedManifestMIMETypes() []string {
-	return d.unpackedDest.SupportedManifestMIMETypes()
-}
-
-// SupportsSignatures returns an error (to be displayed to the user) if the destination certainly can't store signatures
-func (d *ociArchiveImageDestination) SupportsSignatures(ctx context.Context) error {
-	return d.unpackedDest.SupportsSignatures(ctx)
-}
-
-func (d *ociArchiveImageDestination) DesiredLayerCompression() types.LayerCompression {
-	return d.unpackedDest.DesiredLayerCompression()
-}
-
-// AcceptsForeignLayerURLs returns false iff foreign layers in manifest should be actually
-// uploaded to the image destination, true otherwise.
-func (d *ociArchiveImageDestination) AcceptsForeignLayerURLs() bool {
-	return d.unpackedDest.AcceptsForeignLayerURLs()
-}
-
-// MustMatchRuntimeOS returns true iff the destination can store only images targeted for the current runtime architecture and OS. False otherwise
-func (d *ociArchiveImageDestination) MustMatchRuntimeOS() bool {
-	return d.unpackedDest.MustMatchRuntimeOS()
-}
-
-// IgnoresEmbeddedDockerReference returns true iff the destination does not care about Image.EmbeddedDockerReferenceConflicts(),
-// and would prefer to receive an unmodified manifest instead of one modified for the destination.
-// Does not make a difference if Reference().DockerReference() is nil.
-func (d *ociArchiveImageDestination) IgnoresEmbeddedDockerReference() bool {
-	return d.unpackedDest.IgnoresEmbeddedDockerReference()
-}
-
-// HasThreadSafePutBlob indicates whether PutBlob can be executed concurrently.
-func (d *ociArchiveImageDestination) HasThreadSafePutBlob() bool {
-	return false
+	if d.file == nil { // Committed
+		return nil
+	}
+	err := d.file.Close()
+	if err2 := os.Remove(d.file.Name()); err2 != nil {
+		logrus.Debugf("Error deleting temporary file %q: %v", d.file.Name(), err2)
+	}
+	return err
 }
 
-// SupportsPutBlobPartial returns true if PutBlobPartial is supported.
-func (d *ociArchiveImageDestination) SupportsPutBlobPartial() bool {
-	return d.unpackedDest.SupportsPutBlobPartial()
+// DigestAlgorithm returns the algorithm the destination uses for digests of blobs and manifests it creates.
+func (d *ociArchiveImageDestination) DigestAlgorithm() digest.Algorithm {
+	return d.digestAlgorithm
 }
 
 // PutBlobWithOptions writes contents of stream and returns data representing the result.
@@ -111,16 +139,44 @@ func (d *ociArchiveImageDestination) SupportsPutBlobPartial() bool {
 // to any other readers for download using the supplied digest.
 // If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
 func (d *ociArchiveImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
-	return d.unpackedDest.PutBlobWithOptions(ctx, stream, inputInfo, options)
-}
+	if d.broken != nil {
+		return private.UploadedBlob{}, d.broken
+	}
+	// The tar header must contain the size, and the path contains the digest, so if we don’t know them,
+	// we need to stream the blob into a temporary file first.
+	if inputInfo.Size == -1 || inputInfo.Digest == "" || !supporteddigests.IsSupported(inputInfo.Digest.Algorithm()) {
+		logrus.Debugf("oci-archive: input with unknown size or digest, streaming to disk first ...")
+		streamCopy, cleanup, err := streamdigest.ComputeBlobInfo(d.sys, stream, &inputInfo)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		defer cleanup()
+		stream = streamCopy
+		logrus.Debugf("... streaming done")
+	}
+	if err := inputInfo.Digest.Validate(); err != nil { // digest.Digest.Verifier() panics on failure, so validate explicitly.
+		return private.UploadedBlob{}, fmt.Errorf("invalid digest %q: %w", inputInfo.Digest, err)
+	}
+
+	if size, ok := d.blobs[inputInfo.Digest]; ok {
+		// The blob is already in the archive; we still need to consume stream to validate the digest, and to honor
+		// the PutBlobWithOptions contract if stream fails.
+		if _, err := io.Copy(io.Discard, stream); err != nil {
+			return private.UploadedBlob{}, err
+		}
+		return private.UploadedBlob{Digest: inputInfo.Digest, Size: size}, nil
+	}
 
-// PutBlobPartial attempts to create a blob using the data that is already present
-// at the destination. chunkAccessor is accessed in a non-sequential way to retrieve the missing chunks.
-// It is available only if SupportsPutBlobPartial().
-// Even if SupportsPutBlobPartial() returns true, the call can fail, in which case the caller
-// should fall back to PutBlobWithOptions.
-func (d *ociArchiveImageDestination) PutBlobPartial(ctx context.Context, chunkAccessor private.BlobChunkAccessor, srcInfo types.BlobInfo, options private.PutBlobPartialOptions) (private.UploadedBlob, error) {
-	return d.unpackedDest.PutBlobPartial(ctx, chunkAccessor, srcInfo, options)
+	verifier := inputInfo.Digest.Verifier()
+	if err := d.sendBlob(inputInfo.Digest, inputInfo.Size, io.TeeReader(stream, verifier)); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	if !verifier.Verified() {
+		d.broken = fmt.Errorf("Digest mismatch when copying blob, expected %s", inputInfo.Digest)
+		return private.UploadedBlob{}, d.broken
+	}
+	d.blobs[inputInfo.Digest] = inputInfo.Size
+	return private.UploadedBlob{Digest: inputInfo.Digest, Size: inputInfo.Size}, nil
 }
 
 // TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
@@ -129,7 +185,17 @@ func (d *ociArchiveImageDestination) PutBlobPartial(ctx context.Context, chunkAc
 // If the blob has been successfully reused, returns (true, info, nil).
 // If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
 func (d *ociArchiveImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
-	return d.unpackedDest.TryReusingBlobWithOptions(ctx, info, options)
+	if !impl.OriginalCandidateMatchesTryReusingBlobOptions(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	size, ok := d.blobs[info.Digest]
+	if !ok {
+		return false, private.ReusedBlob{}, nil
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: size}, nil
 }
 
 // PutManifest writes the manifest to the destination.
@@ -138,57 +204,139 @@ func (d *ociArchiveImageDestination) TryReusingBlobWithOptions(ctx context.Conte
 // It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
 // by `manifest.Digest()`.
 func (d *ociArchiveImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
-	return d.unpackedDest.PutManifest(ctx, m, instanceDigest)
-}
+	if d.broken != nil {
+		return d.broken
+	}
+	var manifestDigest digest.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	} else {
+		var err error
+		manifestDigest, err = manifest.DigestWithAlgorithm(m, d.digestAlgorithm)
+		if err != nil {
+			return err
+		}
+	}
+	if err := manifestDigest.Validate(); err != nil {
+		return fmt.Errorf("invalid manifest digest %q: %w", manifestDigest, err)
+	}
+
+	if _, ok := d.blobs[manifestDigest]; !ok {
+		if err := d.sendBlob(manifestDigest, int64(len(m)), bytes.NewReader(m)); err != nil {
+			return err
+		}
+		d.blobs[manifestDigest] = int64(len(m))
+	}
+	if instanceDigest != nil {
+		return nil
+	}
 
-// PutSignaturesWithFormat writes a set of signatures to the destination.
-// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write or overwrite the signatures for
-// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
-// MUST be called after PutManifest (signatures may reference manifest contents).
-func (d *ociArchiveImageDestination) PutSignaturesWithFormat(ctx context.Context, signatures []signature.Signature, instanceDigest *digest.Digest) error {
-	return d.unpackedDest.PutSignaturesWithFormat(ctx, signatures, instanceDigest)
+	desc := imgspecv1.Descriptor{
+		MediaType: manifest.GuessMIMEType(m),
+		Digest:    manifestDigest,
+		Size:      int64(len(m)),
+	}
+	if d.ref.image != "" {
+		desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: d.ref.image}
+	}
+	// The archive contains a single image; if PutManifest is called more than once, the last manifest wins.
+	d.index.Manifests = []imgspecv1.Descriptor{desc}
+	return nil
 }
 
 // Commit marks the process of storing the image as successful and asks for the image to be persisted
 // unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
 // if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
 // original manifest list digest, if desired.
-// after the directory is made, it is tarred up into a file and the directory is deleted
+// The index is written last, and the complete archive then replaces any existing file at the destination path.
 func (d *ociArchiveImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
-	if err := d.unpackedDest.Commit(ctx, unparsedToplevel); err != nil {
+	if d.broken != nil {
+		return d.broken
+	}
+	indexJSON, err := json.Marshal(d.index)
+	if err != nil {
+		return err
+	}
+	if err := d.sendBytes(imgspecv1.ImageIndexFile, indexJSON); err != nil {
+		return err
+	}
+	if err := d.tar.Close(); err != nil {
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	// os.CreateTemp creates files with mode 0600; preserve the mode of a file we are replacing, if any, or make the archive readable.
+	// (On Windows, d.file.Chmod, i.e. syscall.Fchmod, always fails; see also ocilayout’s PutBlobWithOptions.)
+	if runtime.GOOS != "windows" {
+		var mode os.FileMode = 0o644
+		if fi, err := os.Stat(d.ref.resolvedFile); err == nil {
+			mode = fi.Mode().Perm()
+		}
+		if err := d.file.Chmod(mode); err != nil {
+			return err
+		}
+	}
+	if err := d.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(d.file.Name(), d.ref.resolvedFile); err != nil {
+		os.Remove(d.file.Name())
+		d.file = nil
 		return fmt.Errorf("storing image %q: %w", d.ref.image, err)
 	}
-
-	// path of directory to tar up
-	src := d.tempDirRef.tempDirectory
-	// path to save tarred up file
-	dst := d.ref.resolvedFile
-	return tarDirectory(src, dst)
+	d.file = nil
+	return nil
 }
 
-// tar converts the directory at src and saves it to dst
-func tarDirectory(src, dst string) error {
-	// input is a stream of bytes from the archive of the directory at path
-	input, err := archive.TarWithOptions(src, &archive.TarOptions{
-		Compression: archive.Uncompressed,
-		// Don’t include the data about the user account this code is running under.
-		ChownOpts: &idtools.IDPair{UID: 0, GID: 0},
-	})
-	if err != nil {
-		return fmt.Errorf("retrieving stream of bytes from %q: %w", src, err)
+// sendBlob writes a blob with the specified digest and size into the tar stream.
+func (d *ociArchiveImageDestination) sendBlob(blobDigest digest.Digest, size int64, stream io.Reader) error {
+	algorithmDir := imgspecv1.ImageBlobsDir + "/" + blobDigest.Algorithm().String()
+	for _, dir := range []string{imgspecv1.ImageBlobsDir, algorithmDir} {
+		if _, ok := d.directories[dir]; ok {
+			continue
+		}
+		if err := d.sendHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0o755}); err != nil {
+			return err
+		}
+		d.directories[dir] = struct{}{}
 	}
-	defer input.Close()
+	return d.sendFile(algorithmDir+"/"+blobDigest.Encoded(), size, stream)
+}
 
-	// creates the tar file
-	outFile, err := os.Create(dst)
-	if err != nil {
-		return fmt.Errorf("creating tar file %q: %w", dst, err)
-	}
-	defer outFile.Close()
+// sendBytes writes a file with contents b into the tar stream.
+func (d *ociArchiveImageDestination) sendBytes(path string, b []byte) error {
+	return d.sendFile(path, int64(len(b)), bytes.NewReader(b))
+}
 
-	// copies the contents of the directory to the tar file
+// sendFile writes a file with the specified size into the tar stream.
+func (d *ociArchiveImageDestination) sendFile(path string, size int64, stream io.Reader) error {
+	if err := d.sendHeader(&tar.Header{Typeflag: tar.TypeReg, Name: path, Size: size, Mode: 0o644}); err != nil {
+		return err
+	}
+	logrus.Debugf("Sending as tar file %s", path)
 	// TODO: This can take quite some time, and should ideally be cancellable using a context.Context.
-	_, err = io.Copy(outFile, input)
+	written, err := io.Copy(d.tar, stream)
+	if err != nil {
+		d.broken = fmt.Errorf("writing %s: %w", path, err)
+		return d.broken
+	}
+	if written != size {
+		d.broken = fmt.Errorf("Size mismatch when copying %s, expected %d, got %d", path, size, written)
+		return d.broken
+	}
+	return nil
+}
 
-	return err
+// sendHeader writes hdr into the tar stream, after setting fields which must not depend on the user account
+// this code is running under, or on the current time.
+func (d *ociArchiveImageDestination) sendHeader(hdr *tar.Header) error {
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.ModTime = time.Unix(0, 0)
+	if err := d.tar.WriteHeader(hdr); err != nil {
+		d.broken = fmt.Errorf("writing tar header for %s: %w", hdr.Name, err)
+		return d.broken
+	}
+	return nil
 }
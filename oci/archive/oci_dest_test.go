@@ -2,32 +2,80 @@ package archive
 
 import (
 	"archive/tar"
+	"bytes"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var _ private.ImageDestination = (*ociArchiveImageDestination)(nil)
 
-func TestTarDirectory(t *testing.T) {
-	srcDir := t.TempDir()
-	err := os.WriteFile(filepath.Join(srcDir, "regular"), []byte("contents"), 0o600)
+func TestOCIArchiveDestination(t *testing.T) {
+	configBytes := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layerBytes := []byte("not really a layer")
+	manifestBytes := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + digest.FromBytes(configBytes).String() + `","size":37},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + digest.FromBytes(layerBytes).String() + `","size":18}]}`)
+	cache := memory.New()
+
+	archivePath := filepath.Join(t.TempDir(), "archive.tar")
+	err := os.WriteFile(archivePath, []byte("previous contents"), 0o600)
+	require.NoError(t, err)
+	ref, err := NewReference(archivePath, "name")
 	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
 
-	dest := filepath.Join(t.TempDir(), "file.tar")
-	err = tarDirectory(srcDir, dest)
+	// Known digest and size
+	info, err := dest.PutBlob(context.Background(), bytes.NewReader(configBytes), types.BlobInfo{Digest: digest.FromBytes(configBytes), Size: int64(len(configBytes))}, cache, true)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: digest.FromBytes(configBytes), Size: int64(len(configBytes))}, info)
+	// Unknown digest and size
+	info, err = dest.PutBlob(context.Background(), bytes.NewReader(layerBytes), types.BlobInfo{Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: int64(len(layerBytes))}, info)
+	// Reuse
+	reused, info, err := dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: int64(len(layerBytes))}, info)
+	reused, _, err = dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: digest.FromString("unknown"), Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	err = dest.PutManifest(context.Background(), manifestBytes, nil)
+	require.NoError(t, err)
+	// Until Commit, the original file is unmodified
+	contents, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("previous contents"), contents)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	err = dest.Close()
+	require.NoError(t, err)
+	fi, err := os.Stat(archivePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	tempFiles, err := filepath.Glob(filepath.Join(filepath.Dir(archivePath), ".oci-archive*"))
 	require.NoError(t, err)
+	assert.Empty(t, tempFiles)
 
-	f, err := os.Open(dest)
+	f, err := os.Open(archivePath)
 	require.NoError(t, err)
 	defer f.Close()
 	reader := tar.NewReader(f)
-	numItems := 0
+	names := []string{}
 	for {
 		hdr, err := reader.Next()
 		if err == io.EOF {
@@ -39,7 +87,50 @@ func TestTarDirectory(t *testing.T) {
 		assert.Equal(t, 0, hdr.Gid)
 		assert.Empty(t, hdr.Uname)
 		assert.Empty(t, hdr.Gname)
-		numItems++
+		names = append(names, hdr.Name)
 	}
-	assert.Equal(t, 1, numItems)
+	assert.Equal(t, []string{
+		imgspecv1.ImageLayoutFile,
+		"blobs/",
+		"blobs/sha256/",
+		"blobs/sha256/" + digest.FromBytes(configBytes).Encoded(),
+		"blobs/sha256/" + digest.FromBytes(layerBytes).Encoded(),
+		"blobs/sha256/" + digest.FromBytes(manifestBytes).Encoded(),
+		imgspecv1.ImageIndexFile,
+	}, names)
+
+	// The result can be read by the oci-archive source
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	m, _, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifestBytes, m)
+	blob, _, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: -1}, cache)
+	require.NoError(t, err)
+	defer blob.Close()
+	blobContents, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	assert.Equal(t, layerBytes, blobContents)
+}
+
+func TestOCIArchiveDestinationAbandoned(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "archive.tar")
+	ref, err := NewReference(archivePath, "")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader([]byte("contents")), types.BlobInfo{Digest: digest.FromString("other contents"), Size: 8}, memory.New(), false)
+	assert.Error(t, err)
+	// The archive is unusable after a failure.
+	err = dest.Commit(context.Background(), nil)
+	assert.Error(t, err)
+	err = dest.Close()
+	require.NoError(t, err)
+
+	_, err = os.Stat(archivePath)
+	assert.True(t, os.IsNotExist(err))
+	tempFiles, err := filepath.Glob(filepath.Join(filepath.Dir(archivePath), ".oci-archive*"))
+	require.NoError(t, err)
+	assert.Empty(t, tempFiles)
 }
@@ -28,6 +28,11 @@ func (e ImageNotFoundError) Error() string {
 	return fmt.Sprintf("no descriptor found for reference %q", e.ref.image)
 }
 
+// Is returns true if target is types.ErrNotFound, so that errors.Is(err, types.ErrNotFound) works.
+func (e ImageNotFoundError) Is(target error) bool {
+	return target == types.ErrNotFound
+}
+
 // ArchiveFileNotFoundError occurs when the archive file does not exist.
 type ArchiveFileNotFoundError struct {
 	// ref is the image reference
@@ -40,6 +45,11 @@ func (e ArchiveFileNotFoundError) Error() string {
 	return fmt.Sprintf("archive file not found: %q", e.path)
 }
 
+// Is returns true if target is types.ErrNotFound, so that errors.Is(err, types.ErrNotFound) works.
+func (e ArchiveFileNotFoundError) Is(target error) bool {
+	return target == types.ErrNotFound
+}
+
 type ociArchiveImageSource struct {
 	impl.Compat
 
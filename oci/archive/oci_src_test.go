@@ -1,11 +1,15 @@
 package archive
 
 import (
+	"io"
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/archive"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -24,3 +28,26 @@ func TestNewImageSourceNotFound(t *testing.T) {
 	assert.ErrorAs(t, err, &aerr)
 	assert.Equal(t, aerr.path, archivePath)
 }
+
+func TestNewImageSourceCompressedArchive(t *testing.T) {
+	for _, algo := range []compression.Algorithm{compression.Gzip, compression.Xz, compression.Zstd} {
+		archivePath := filepath.Join(t.TempDir(), "image.ociarchive")
+		tarStream, err := archive.Tar("../layout/fixtures/manifest", archive.Uncompressed)
+		require.NoError(t, err, algo.Name())
+		f, err := os.Create(archivePath)
+		require.NoError(t, err, algo.Name())
+		compressor, err := compression.CompressStream(f, algo, nil)
+		require.NoError(t, err, algo.Name())
+		_, err = io.Copy(compressor, tarStream)
+		require.NoError(t, err, algo.Name())
+		require.NoError(t, compressor.Close(), algo.Name())
+		require.NoError(t, f.Close(), algo.Name())
+		require.NoError(t, tarStream.Close(), algo.Name())
+
+		imgref, err := ParseReference(archivePath)
+		require.NoError(t, err, algo.Name())
+		descriptor, err := LoadManifestDescriptorWithContext(&types.SystemContext{}, imgref)
+		require.NoError(t, err, algo.Name())
+		assert.NotEmpty(t, descriptor.Digest, algo.Name())
+	}
+}
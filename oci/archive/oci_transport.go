@@ -14,6 +14,7 @@ import (
 	"github.com/containers/image/v5/internal/tmpdir"
 	"github.com/containers/image/v5/oci/internal"
 	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/archive"
@@ -24,8 +25,8 @@ func init() {
 }
 
 // Transport is an ImageTransport for OCI archive
-// it creates an oci-archive tar file by calling into the OCI transport
-// tarring the directory created by oci and deleting the directory
+// it creates an oci-archive tar file by streaming an OCI layout directly into the tar file,
+// and reads it by extracting it into a temporary directory and calling into the OCI transport
 var Transport = ociArchiveTransport{}
 
 type ociArchiveTransport struct{}
@@ -189,8 +190,18 @@ func createUntarTempDir(sys *types.SystemContext, ref ociArchiveReference) (temp
 	}
 	dst := tempDirRef.tempDirectory
 
+	// Decompress the archive the same way as docker-archive, so that the same compression formats are recognized.
+	uncompressed, _, err := compression.AutoDecompress(arch)
+	if err != nil {
+		if err := tempDirRef.deleteTempDir(); err != nil {
+			return tempDirOCIRef{}, fmt.Errorf("deleting temp directory %q: %w", tempDirRef.tempDirectory, err)
+		}
+		return tempDirOCIRef{}, fmt.Errorf("auto-decompressing %q: %w", src, err)
+	}
+	defer uncompressed.Close()
+
 	// TODO: This can take quite some time, and should ideally be cancellable using a context.Context.
-	if err := archive.NewDefaultArchiver().Untar(arch, dst, &archive.TarOptions{NoLchown: true}); err != nil {
+	if err := archive.NewDefaultArchiver().Untar(uncompressed, dst, &archive.TarOptions{NoLchown: true}); err != nil {
 		if err := tempDirRef.deleteTempDir(); err != nil {
 			return tempDirOCIRef{}, fmt.Errorf("deleting temp directory %q: %w", tempDirRef.tempDirectory, err)
 		}
@@ -2,12 +2,16 @@ package archive
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
 
 	_ "github.com/containers/image/v5/internal/testing/explicitfilepath-tmpdir"
 	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/archive"
+	"github.com/containers/storage/pkg/idtools"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -272,3 +276,24 @@ func TestReferenceDeleteImage(t *testing.T) {
 	err := ref.DeleteImage(context.Background(), nil)
 	assert.Error(t, err)
 }
+
+// tarDirectory converts the directory at src and saves it to dst
+func tarDirectory(src, dst string) error {
+	input, err := archive.TarWithOptions(src, &archive.TarOptions{
+		Compression: archive.Uncompressed,
+		ChownOpts:   &idtools.IDPair{UID: 0, GID: 0},
+	})
+	if err != nil {
+		return fmt.Errorf("retrieving stream of bytes from %q: %w", src, err)
+	}
+	defer input.Close()
+
+	outFile, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("creating tar file %q: %w", dst, err)
+	}
+	defer outFile.Close()
+
+	_, err = io.Copy(outFile, input)
+	return err
+}
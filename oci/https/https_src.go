@@ -0,0 +1,269 @@
+package https
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/timeouts"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/go-connections/tlsconfig"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+type httpsImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.NoSignatures
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.ImplementsGetBlobAt
+
+	ref             httpsReference
+	client          *http.Client
+	maxManifestSize int
+	index           *imgspecv1.Index
+	descriptor      imgspecv1.Descriptor
+}
+
+// newImageSource returns an ImageSource for reading from a layout on a HTTPS server.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref httpsReference) (private.ImageSource, error) {
+	tr := tlsclientconfig.NewTransport()
+	tr.TLSClientConfig = tlsconfig.ServerDefault()
+	if sys != nil && sys.OCICertPath != "" {
+		if err := tlsclientconfig.SetupCertificates(sys.OCICertPath, tr.TLSClientConfig); err != nil {
+			return nil, err
+		}
+	}
+	if sys != nil {
+		tr.TLSClientConfig.InsecureSkipVerify = sys.OCIInsecureSkipTLSVerify
+	}
+	timeouts.ApplyToTransport(tr, sys)
+	s := &httpsImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+
+		ref:             ref,
+		client:          &http.Client{Transport: timeouts.NewRoundTripper(tr, sys)},
+		maxManifestSize: iolimits.MaxManifestBodySizeFor(sys),
+	}
+	s.Compat = impl.AddCompat(s)
+
+	indexBytes, err := s.fetch(ctx, ref.indexURL())
+	if err != nil {
+		return nil, err
+	}
+	index := imgspecv1.Index{}
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", ref.indexURL().Redacted(), err)
+	}
+	descriptor, err := internal.FindManifestDescriptor(&index, ref.image, "https://"+ref.location())
+	if err != nil {
+		return nil, err
+	}
+	s.index = &index
+	s.descriptor = descriptor
+	return s, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *httpsImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *httpsImageSource) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// get sends a GET request for u with the specified headers, and returns the response if its status is one of allowedStatuses.
+// The caller must close the response body.
+func (s *httpsImageSource) get(ctx context.Context, u *url.URL, headers map[string]string, allowedStatuses ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	logrus.Debugf("GET %s", u.Redacted())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range allowedStatuses {
+		if res.StatusCode == status {
+			return res, nil
+		}
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return nil, private.BadPartialRequestError{Status: res.Status}
+	}
+	return nil, errcategory.Wrap(fmt.Errorf("fetching %s: %s", u.Redacted(), res.Status), errcategory.FromHTTPStatus(res.StatusCode))
+}
+
+// fetch returns the contents of u, which must be at most s.maxManifestSize bytes.
+func (s *httpsImageSource) fetch(ctx context.Context, u *url.URL) ([]byte, error) {
+	res, err := s.get(ctx, u, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return iolimits.ReadAtMost(res.Body, s.maxManifestSize)
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *httpsImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	var dig digest.Digest
+	var mimeType string
+	if instanceDigest == nil {
+		dig = s.descriptor.Digest
+		mimeType = s.descriptor.MediaType
+	} else {
+		dig = *instanceDigest
+		for _, md := range s.index.Manifests {
+			if md.Digest == dig {
+				mimeType = md.MediaType
+				break
+			}
+		}
+	}
+
+	u, err := s.ref.blobURL(dig)
+	if err != nil {
+		return nil, "", err
+	}
+	m, err := s.fetch(ctx, u)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			err = errcategory.Wrap(err, types.ErrManifestUnknown)
+		}
+		return nil, "", err
+	}
+	// The server is not trusted; make sure it returned the manifest we asked for.
+	matches, err := manifest.MatchesDigest(m, dig)
+	if err != nil {
+		return nil, "", fmt.Errorf("computing digest of manifest %s: %w", dig.String(), err)
+	}
+	if !matches {
+		return nil, "", fmt.Errorf("manifest fetched from %s does not match digest %s", u.Redacted(), dig.String())
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *httpsImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	u, err := s.ref.blobURL(info.Digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := s.get(ctx, u, nil, http.StatusOK)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			err = errcategory.Wrap(err, types.ErrBlobUnknown)
+		}
+		return nil, 0, err
+	}
+	return res.Body, res.ContentLength, nil
+}
+
+// GetBlobAt returns a sequential channel of readers that contain data for the requested
+// blob chunks, and a channel that might get a single error value.
+// The specified chunks must be not overlapping and sorted by their offset.
+// The readers must be fully consumed, in the order they are returned, before blocking
+// to read the next chunk.
+// If the Length for the last chunk is set to math.MaxUint64, then it
+// fully fetches the remaining data from the offset to the end of the blob.
+func (s *httpsImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+	if len(chunks) == 0 {
+		return nil, nil, errors.New("internal error: GetBlobAt called with no chunks")
+	}
+	for i, c := range chunks {
+		if c.Length == math.MaxUint64 && i != len(chunks)-1 {
+			return nil, nil, fmt.Errorf("internal error: another chunk requested after an util-EOF chunk")
+		}
+	}
+	u, err := s.ref.blobURL(info.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Static servers and CDNs often don’t support multiple ranges in a single request, so use one request per chunk.
+	// The first request is made synchronously so that failures, notably BadPartialRequestError, are reported directly.
+	first, err := s.getChunk(ctx, u, chunks[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	streams := make(chan io.ReadCloser)
+	errs := make(chan error)
+	go func() {
+		defer close(streams)
+		defer close(errs)
+		streams <- first
+		for _, c := range chunks[1:] {
+			stream, err := s.getChunk(ctx, u, c)
+			if err != nil {
+				errs <- err
+				return
+			}
+			streams <- stream
+		}
+	}()
+	return streams, errs, nil
+}
+
+// getChunk returns a stream with the contents of chunk of the file at u.
+func (s *httpsImageSource) getChunk(ctx context.Context, u *url.URL, chunk private.ImageSourceChunk) (io.ReadCloser, error) {
+	rangeVal := fmt.Sprintf("bytes=%d-", chunk.Offset)
+	if chunk.Length != math.MaxUint64 {
+		rangeVal = fmt.Sprintf("bytes=%d-%d", chunk.Offset, chunk.Offset+chunk.Length-1)
+	}
+	res, err := s.get(ctx, u, map[string]string{"Range": rangeVal}, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusPartialContent {
+		return res.Body, nil
+	}
+
+	// The server has ignored the Range header; extract the chunk from the full response.
+	if _, err := io.CopyN(io.Discard, res.Body, int64(chunk.Offset)); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if chunk.Length == math.MaxUint64 {
+		return res.Body, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.LimitReader(res.Body, int64(chunk.Length)),
+		Closer: res.Body,
+	}, nil
+}
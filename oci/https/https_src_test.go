@@ -0,0 +1,176 @@
+package https
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ private.ImageSource = (*httpsImageSource)(nil)
+
+// writeTestLayout creates an OCI layout in dir containing a single image named "name", and returns its manifest and layer.
+func writeTestLayout(t *testing.T, dir string) ([]byte, []byte) {
+	configBytes := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layerBytes := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	manifestBytes := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + digest.FromBytes(configBytes).String() + `","size":37},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + digest.FromBytes(layerBytes).String() + `","size":36}]}`)
+	blobDir := filepath.Join(dir, "blobs", "sha256")
+	err := os.MkdirAll(blobDir, 0o755)
+	require.NoError(t, err)
+	for _, blob := range [][]byte{configBytes, layerBytes, manifestBytes} {
+		err := os.WriteFile(filepath.Join(blobDir, digest.FromBytes(blob).Encoded()), blob, 0o644)
+		require.NoError(t, err)
+	}
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType:   imgspecv1.MediaTypeImageManifest,
+			Digest:      digest.FromBytes(manifestBytes),
+			Size:        int64(len(manifestBytes)),
+			Annotations: map[string]string{imgspecv1.AnnotationRefName: "name"},
+		}},
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, imgspecv1.ImageIndexFile), index, 0o644)
+	require.NoError(t, err)
+	return manifestBytes, layerBytes
+}
+
+// newTestServer returns a HTTPS server serving dir under /layout, and a SystemContext which can access it.
+func newTestServer(t *testing.T, dir string, supportRanges bool) (string, *types.SystemContext) {
+	fileServer := http.StripPrefix("/layout", http.FileServer(http.Dir(dir)))
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !supportRanges {
+			r.Header.Del("Range")
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "https://"), &types.SystemContext{OCIInsecureSkipTLSVerify: true}
+}
+
+func readChunks(t *testing.T, streams chan io.ReadCloser, errs chan error) []string {
+	res := []string{}
+	for streams != nil || errs != nil {
+		select {
+		case s, ok := <-streams:
+			if !ok {
+				streams = nil
+				continue
+			}
+			data, err := io.ReadAll(s)
+			require.NoError(t, err)
+			s.Close()
+			res = append(res, string(data))
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			require.NoError(t, err)
+		}
+	}
+	return res
+}
+
+func TestHTTPSImageSource(t *testing.T) {
+	dir := t.TempDir()
+	manifestBytes, layerBytes := writeTestLayout(t, dir)
+	chunks := []private.ImageSourceChunk{
+		{Offset: 0, Length: 2},
+		{Offset: 10, Length: 3},
+		{Offset: 30, Length: math.MaxUint64},
+	}
+
+	for _, supportRanges := range []bool{true, false} {
+		host, sys := newTestServer(t, dir, supportRanges)
+		ref, err := ParseReference("//" + host + "/layout:name")
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		defer src.Close()
+
+		m, mimeType, err := src.GetManifest(context.Background(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, manifestBytes, m)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+
+		blob, size, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: -1}, memory.New())
+		require.NoError(t, err)
+		defer blob.Close()
+		assert.Equal(t, int64(len(layerBytes)), size)
+		contents, err := io.ReadAll(blob)
+		require.NoError(t, err)
+		assert.Equal(t, layerBytes, contents)
+		_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: digest.FromString("missing"), Size: -1}, memory.New())
+		assert.Error(t, err)
+
+		privateSrc, ok := src.(private.ImageSource)
+		require.True(t, ok)
+		assert.True(t, privateSrc.SupportsGetBlobAt())
+		streams, errs, err := privateSrc.GetBlobAt(context.Background(), types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: -1}, chunks)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"01", "abc", "uvwxyz"}, readChunks(t, streams, errs), supportRanges)
+	}
+
+	// Failures
+	host, sys := newTestServer(t, dir, true)
+	for _, refString := range []string{
+		"//" + host + "/layout:missing", // Unknown image
+		"//" + host + "/missing:name",   // Missing layout
+	} {
+		ref, err := ParseReference(refString)
+		require.NoError(t, err, refString)
+		_, err = ref.NewImageSource(context.Background(), sys)
+		assert.Error(t, err, refString)
+	}
+	// Untrusted certificate
+	ref, err := ParseReference("//" + host + "/layout:name")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(context.Background(), nil)
+	assert.Error(t, err)
+
+	// A manifest which does not match its digest is rejected
+	tamperedDir := t.TempDir()
+	tamperedManifest, _ := writeTestLayout(t, tamperedDir)
+	err = os.WriteFile(filepath.Join(tamperedDir, "blobs", "sha256", digest.FromBytes(tamperedManifest).Encoded()),
+		append(tamperedManifest, ' '), 0o644)
+	require.NoError(t, err)
+	tamperedHost, _ := newTestServer(t, tamperedDir, true)
+	tamperedRef, err := ParseReference("//" + tamperedHost + "/layout:name")
+	require.NoError(t, err)
+	tamperedSrc, err := tamperedRef.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer tamperedSrc.Close()
+	_, _, err = tamperedSrc.GetManifest(context.Background(), nil)
+	assert.ErrorContains(t, err, "does not match digest")
+
+	// A range outside of the blob is reported as a bad partial request
+	src, err := ref.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer src.Close()
+	privateSrc, ok := src.(private.ImageSource)
+	require.True(t, ok)
+	_, _, err = privateSrc.GetBlobAt(context.Background(), types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: -1},
+		[]private.ImageSourceChunk{{Offset: 1000, Length: 10}})
+	var badRequest private.BadPartialRequestError
+	assert.True(t, errors.As(err, &badRequest))
+}
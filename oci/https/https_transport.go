@@ -0,0 +1,204 @@
+package https
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func init() {
+	transports.Register(Transport)
+}
+
+// Transport is an ImageTransport for OCI layouts served by static HTTPS servers.
+var Transport = httpsTransport{}
+
+type httpsTransport struct{}
+
+func (t httpsTransport) Name() string {
+	return "oci-https"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t httpsTransport) ParseReference(reference string) (types.ImageReference, error) {
+	return ParseReference(reference)
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t httpsTransport) ValidatePolicyConfigurationScope(scope string) error {
+	if strings.HasPrefix(scope, "/") || strings.HasSuffix(scope, "/") {
+		return fmt.Errorf("Invalid scope %s: must be a host name, optionally followed by a path, without a leading or trailing slash", scope)
+	}
+	if cleaned := path.Clean(scope); cleaned != scope {
+		return fmt.Errorf(`Invalid scope %s: Uses non-canonical path format, perhaps try with path %s`, scope, cleaned)
+	}
+	return nil
+}
+
+// httpsReference is an ImageReference for OCI layouts served by static HTTPS servers.
+type httpsReference struct {
+	host string // Host name, with an optional port
+	path string // The path of the layout on host, without a leading or trailing slash; "" for the root of the server.
+	// If image=="", it means the "only image" in the index.json is used.
+	image string
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an HTTPS ImageReference.
+// The expected format is //host[:port][/path][:image]; note that image can only be specified if a "/" follows the host.
+func ParseReference(reference string) (types.ImageReference, error) {
+	location, ok := strings.CutPrefix(reference, "//")
+	if !ok {
+		return nil, fmt.Errorf("OCI HTTPS reference %q does not start with //", reference)
+	}
+	host, pathAndImage, _ := strings.Cut(location, "/")
+	path, image, _ := strings.Cut(pathAndImage, ":") // image is set to "" if there is no ":"
+	return NewReference(host, path, image)
+}
+
+// NewReference returns an HTTPS reference for a layout at path on host, and an image.
+func NewReference(host, layoutPath, image string) (types.ImageReference, error) {
+	if host == "" {
+		return nil, errors.New("Invalid OCI HTTPS reference: host name must not be empty")
+	}
+	if u, err := url.Parse("https://" + host); err != nil || u.Host != host || u.User != nil {
+		return nil, fmt.Errorf("Invalid OCI HTTPS reference: invalid host %q", host)
+	}
+	layoutPath = strings.Trim(layoutPath, "/")
+	if layoutPath != "" {
+		if strings.Contains(layoutPath, ":") {
+			return nil, fmt.Errorf("Invalid OCI HTTPS reference: path %s contains a colon", layoutPath)
+		}
+		if cleaned := path.Clean(layoutPath); cleaned != layoutPath || layoutPath == "." || layoutPath == ".." || strings.HasPrefix(layoutPath, "../") {
+			return nil, fmt.Errorf("Invalid OCI HTTPS reference: path %s is not in canonical format", layoutPath)
+		}
+	}
+	if err := internal.ValidateImageName(image); err != nil {
+		return nil, err
+	}
+	return httpsReference{host: host, path: layoutPath, image: image}, nil
+}
+
+func (ref httpsReference) Transport() types.ImageTransport {
+	return Transport
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref httpsReference) StringWithinTransport() string {
+	return fmt.Sprintf("//%s/%s:%s", ref.host, ref.path, ref.image)
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref httpsReference) DockerReference() reference.Named {
+	return nil
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref httpsReference) PolicyConfigurationIdentity() string {
+	// NOTE: ref.image is not a part of the image identity, for the same reasons as in oci/layout.
+	return ref.location()
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref httpsReference) PolicyConfigurationNamespaces() []string {
+	res := []string{}
+	location := ref.location()
+	for {
+		lastSlash := strings.LastIndex(location, "/")
+		if lastSlash == -1 {
+			break
+		}
+		location = location[:lastSlash]
+		res = append(res, location)
+	}
+	return res
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref httpsReference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref httpsReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref httpsReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return nil, errors.New(`The "oci-https" transport is read-only`)
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref httpsReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	return errors.New(`The "oci-https" transport is read-only`)
+}
+
+// location returns the host and path of ref, separated by a slash if the path is not empty.
+func (ref httpsReference) location() string {
+	if ref.path == "" {
+		return ref.host
+	}
+	return ref.host + "/" + ref.path
+}
+
+// fileURL returns the URL of name (a slash-separated path relative to the layout root).
+func (ref httpsReference) fileURL(name string) *url.URL {
+	p := "/" + name
+	if ref.path != "" {
+		p = "/" + ref.path + p
+	}
+	return &url.URL{
+		Scheme: "https",
+		Host:   ref.host,
+		Path:   p,
+	}
+}
+
+// indexURL returns the URL of index.json.
+func (ref httpsReference) indexURL() *url.URL {
+	return ref.fileURL(imgspecv1.ImageIndexFile)
+}
+
+// blobURL returns the URL of a blob using OCI image-layout conventions.
+func (ref httpsReference) blobURL(digest digest.Digest) (*url.URL, error) {
+	if err := digest.Validate(); err != nil {
+		return nil, fmt.Errorf("unexpected digest reference %s: %w", digest, err)
+	}
+	return ref.fileURL(imgspecv1.ImageBlobsDir + "/" + digest.Algorithm().String() + "/" + digest.Encoded()), nil
+}
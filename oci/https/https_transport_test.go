@@ -0,0 +1,132 @@
+package https
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "oci-https", Transport.Name())
+}
+
+func TestTransportParseReference(t *testing.T) {
+	for _, c := range []struct{ input, host, path, image string }{
+		{"//example.com", "example.com", "", ""},
+		{"//example.com:8443", "example.com:8443", "", ""},
+		{"//example.com/", "example.com", "", ""},
+		{"//example.com/:image", "example.com", "", "image"},
+		{"//example.com:8443/some/path", "example.com:8443", "some/path", ""},
+		{"//example.com/some/path/:repo/image:tag", "example.com", "some/path", "repo/image:tag"},
+		{"//[::1]:8443/path:image", "[::1]:8443", "path", "image"},
+	} {
+		ref, err := Transport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		httpsRef, ok := ref.(httpsReference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.host, httpsRef.host, c.input)
+		assert.Equal(t, c.path, httpsRef.path, c.input)
+		assert.Equal(t, c.image, httpsRef.image, c.input)
+	}
+
+	for _, input := range []string{
+		"",
+		"example.com",
+		"/example.com",
+		"//",
+		"///path",
+		"//user@example.com/path",
+		"//example.com:image",
+		"//example.com/a/../b",
+		"//example.com/a//b",
+		"//example.com/..",
+		"//example.com/path:@invalid",
+	} {
+		_, err := Transport.ParseReference(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"example.com",
+		"example.com:8443",
+		"example.com/some/path",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"/example.com",
+		"example.com/",
+		"example.com//path",
+		"example.com/../path",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestReferenceStringWithinTransport(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{"//example.com", "//example.com/:"},
+		{"//example.com:8443/path/:image", "//example.com:8443/path:image"},
+	} {
+		ref, err := Transport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		stringRef := ref.StringWithinTransport()
+		assert.Equal(t, c.expected, stringRef, c.input)
+		// Do one more round to verify that the output can be parsed, to an equal value.
+		ref2, err := Transport.ParseReference(stringRef)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, ref, ref2, c.input)
+	}
+}
+
+func TestReferenceDockerReference(t *testing.T) {
+	ref, err := NewReference("example.com", "path", "image")
+	require.NoError(t, err)
+	assert.Nil(t, ref.DockerReference())
+}
+
+func TestReferencePolicyConfiguration(t *testing.T) {
+	ref, err := NewReference("example.com:8443", "a/b", "image")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:8443/a/b", ref.PolicyConfigurationIdentity())
+	ns := ref.PolicyConfigurationNamespaces()
+	assert.Equal(t, []string{"example.com:8443/a", "example.com:8443"}, ns)
+	for _, n := range ns {
+		assert.NoError(t, Transport.ValidatePolicyConfigurationScope(n), n)
+	}
+}
+
+func TestReferenceReadOnly(t *testing.T) {
+	ref, err := NewReference("example.com", "path", "")
+	require.NoError(t, err)
+	_, err = ref.NewImageDestination(context.Background(), nil)
+	assert.Error(t, err)
+	err = ref.DeleteImage(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+func TestReferenceURLs(t *testing.T) {
+	ref, err := NewReference("example.com", "a/b", "")
+	require.NoError(t, err)
+	httpsRef, ok := ref.(httpsReference)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/a/b/index.json", httpsRef.indexURL().String())
+	u, err := httpsRef.blobURL("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a/b/blobs/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", u.String())
+	_, err = httpsRef.blobURL("sha256:../../../etc/passwd")
+	assert.Error(t, err)
+
+	ref, err = NewReference("example.com", "", "")
+	require.NoError(t, err)
+	httpsRef, ok = ref.(httpsReference)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/index.json", httpsRef.indexURL().String())
+}
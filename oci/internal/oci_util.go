@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // annotation spex from https://github.com/opencontainers/image-spec/blob/master/annotations.md#pre-defined-annotation-keys
@@ -119,3 +121,28 @@ func validateScopeNonWindows(scope string) error {
 
 	return nil
 }
+
+// FindManifestDescriptor returns the descriptor of image within index, which was read from location (used only in error messages).
+// If image is "", index must contain exactly one manifest.
+func FindManifestDescriptor(index *imgspecv1.Index, image, location string) (imgspecv1.Descriptor, error) {
+	if image == "" {
+		// return manifest if only one image is in the layout
+		if len(index.Manifests) != 1 {
+			return imgspecv1.Descriptor{}, fmt.Errorf("more than one image in %s, choose an image", location)
+		}
+		return index.Manifests[0], nil
+	}
+	var unsupportedMIMETypes []string
+	for _, md := range index.Manifests {
+		if refName, ok := md.Annotations[imgspecv1.AnnotationRefName]; ok && refName == image {
+			if md.MediaType == imgspecv1.MediaTypeImageManifest || md.MediaType == imgspecv1.MediaTypeImageIndex {
+				return md, nil
+			}
+			unsupportedMIMETypes = append(unsupportedMIMETypes, md.MediaType)
+		}
+	}
+	if len(unsupportedMIMETypes) != 0 {
+		return imgspecv1.Descriptor{}, fmt.Errorf("reference %q matches unsupported manifest MIME types %q", image, unsupportedMIMETypes)
+	}
+	return imgspecv1.Descriptor{}, fmt.Errorf("no descriptor found for reference %q in %s", image, location)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"testing"
 
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testDataSplitReference struct {
@@ -61,3 +63,31 @@ func TestValidateScopeWindows(t *testing.T) {
 		}
 	}
 }
+
+func TestFindManifestDescriptor(t *testing.T) {
+	named := imgspecv1.Descriptor{
+		MediaType:   imgspecv1.MediaTypeImageManifest,
+		Digest:      "sha256:0000000000000000000000000000000000000000000000000000000000000001",
+		Annotations: map[string]string{imgspecv1.AnnotationRefName: "name"},
+	}
+	unsupported := imgspecv1.Descriptor{
+		MediaType:   "application/unsupported",
+		Digest:      "sha256:0000000000000000000000000000000000000000000000000000000000000002",
+		Annotations: map[string]string{imgspecv1.AnnotationRefName: "unsupported"},
+	}
+
+	desc, err := FindManifestDescriptor(&imgspecv1.Index{Manifests: []imgspecv1.Descriptor{named}}, "", "location")
+	require.NoError(t, err)
+	assert.Equal(t, named, desc)
+
+	index := &imgspecv1.Index{Manifests: []imgspecv1.Descriptor{named, unsupported}}
+	desc, err = FindManifestDescriptor(index, "name", "location")
+	require.NoError(t, err)
+	assert.Equal(t, named, desc)
+	_, err = FindManifestDescriptor(index, "", "location")
+	assert.ErrorContains(t, err, "more than one image in location")
+	_, err = FindManifestDescriptor(index, "unsupported", "location")
+	assert.ErrorContains(t, err, "unsupported manifest MIME types")
+	_, err = FindManifestDescriptor(index, "missing", "location")
+	assert.ErrorContains(t, err, `no descriptor found for reference "missing" in location`)
+}
@@ -0,0 +1,99 @@
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// tryDeduplicatingBlob looks for blobDigest in d.deduplicationDirs, and if found, makes it available at blobPath
+// using d.deduplicationMethod.  It returns the blob size and true on success; failures are not fatal
+// (the caller can always copy the blob instead), so they are only logged.
+func (d *ociImageDestination) tryDeduplicatingBlob(blobDigest digest.Digest, blobPath string) (int64, bool) {
+	for _, dir := range d.deduplicationDirs {
+		candidate := filepath.Join(dir, blobDigest.Algorithm().String(), blobDigest.Encoded())
+		finfo, err := os.Stat(candidate)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logrus.Debugf("Error looking for blob %s in %s: %v", blobDigest, dir, err)
+			}
+			continue
+		}
+		if !finfo.Mode().IsRegular() {
+			continue
+		}
+		if err := ensureParentDirectoryExists(blobPath); err != nil {
+			logrus.Debugf("Error deduplicating blob %s: %v", blobDigest, err)
+			return -1, false
+		}
+		if err := deduplicateFile(d.deduplicationMethod, candidate, blobPath); err != nil {
+			logrus.Debugf("Error deduplicating blob %s from %s: %v", blobDigest, dir, err)
+			continue
+		}
+		logrus.Debugf("Deduplicated blob %s from %s", blobDigest, dir)
+		return finfo.Size(), true
+	}
+	return -1, false
+}
+
+// deduplicateFile makes the contents of src available at dest, which must not exist, using method.
+func deduplicateFile(method types.OCIBlobDeduplicationMethod, src, dest string) error {
+	switch method {
+	case types.OCIBlobDeduplicationHardlink:
+		err := os.Link(src, dest)
+		if err != nil && errors.Is(err, fs.ErrExist) {
+			return nil // Someone else has concurrently created dest, which is just as good.
+		}
+		return err
+	case types.OCIBlobDeduplicationReflink:
+		return reflinkFile(src, dest)
+	default:
+		return fmt.Errorf("unknown blob deduplication method %d", method)
+	}
+}
+
+// reflinkFile creates dest as a copy-on-write clone of src, via a temporary file, so that dest
+// is never visible with incomplete contents.
+func reflinkFile(src, dest string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.CreateTemp(filepath.Dir(dest), "oci-reflink-blob")
+	if err != nil {
+		return err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			destFile.Close()
+			os.Remove(destFile.Name())
+		}
+	}()
+	if err := cloneFile(destFile, srcFile); err != nil {
+		return err
+	}
+	// See the comment in PutBlobWithOptions.
+	if runtime.GOOS != "windows" {
+		if err := destFile.Chmod(0644); err != nil {
+			return err
+		}
+	}
+	if err := destFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(destFile.Name(), dest); err != nil {
+		return err
+	}
+	succeeded = true
+	return nil
+}
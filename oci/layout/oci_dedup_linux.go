@@ -0,0 +1,12 @@
+package layout
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dest a copy-on-write clone of src, if supported by the filesystem.
+func cloneFile(dest, src *os.File) error {
+	return unix.IoctlFileClone(int(dest.Fd()), int(src.Fd()))
+}
@@ -12,11 +12,13 @@ import (
 	"runtime"
 	"slices"
 
+	"github.com/containers/image/v5/internal/durablefile"
 	"github.com/containers/image/v5/internal/imagedestination/impl"
 	"github.com/containers/image/v5/internal/imagedestination/stubs"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/putblobdigest"
+	"github.com/containers/image/v5/internal/supporteddigests"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/fileutils"
 	digest "github.com/opencontainers/go-digest"
@@ -30,16 +32,25 @@ type ociImageDestination struct {
 	stubs.NoPutBlobPartialInitialize
 	stubs.NoSignaturesInitialize
 
-	ref           ociReference
-	index         imgspecv1.Index
-	sharedBlobDir string
+	ref                 ociReference
+	index               imgspecv1.Index
+	sharedBlobDir       string
+	deduplicationDirs   []string                         // Blob directories to search for blobs missing in the destination.
+	deduplicationMethod types.OCIBlobDeduplicationMethod // How to deduplicate blobs found in deduplicationDirs.
+	digestAlgorithm     digest.Algorithm                 // For blobs and manifests written without a known digest
+	durableWrites       bool                             // types.SystemContext.LocalDurableWrites
+	syncDirs            durablefile.DirTracker           // Directories to sync in Commit, if durableWrites
 }
 
 // newImageDestination returns an ImageDestination for writing to an existing directory.
 func newImageDestination(sys *types.SystemContext, ref ociReference) (private.ImageDestination, error) {
+	digestAlgorithm, err := supporteddigests.ForNewObjects(sys)
+	if err != nil {
+		return nil, err
+	}
+
 	var index *imgspecv1.Index
 	if indexExists(ref) {
-		var err error
 		index, err = ref.getIndex()
 		if err != nil {
 			return nil, err
@@ -69,16 +80,21 @@ func newImageDestination(sys *types.SystemContext, ref ociReference) (private.Im
 			MustMatchRuntimeOS:             false,
 			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
 			HasThreadSafePutBlob:           true,
+			AcceptsNonImageArtifacts:       true,
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
 		NoSignaturesInitialize:     stubs.NoSignatures("Pushing signatures for OCI images is not supported"),
 
-		ref:   ref,
-		index: *index,
+		ref:             ref,
+		index:           *index,
+		digestAlgorithm: digestAlgorithm,
 	}
 	d.Compat = impl.AddCompat(d)
 	if sys != nil {
 		d.sharedBlobDir = sys.OCISharedBlobDirPath
+		d.deduplicationDirs = sys.OCIDeduplicationBlobDirPaths
+		d.deduplicationMethod = sys.OCIBlobDeduplicationMethod
+		d.durableWrites = sys.LocalDurableWrites
 	}
 
 	if err := ensureDirectoryExists(d.ref.dir); err != nil {
@@ -104,6 +120,11 @@ func (d *ociImageDestination) Close() error {
 	return nil
 }
 
+// DigestAlgorithm returns the algorithm the destination uses for digests of blobs and manifests it creates.
+func (d *ociImageDestination) DigestAlgorithm() digest.Algorithm {
+	return d.digestAlgorithm
+}
+
 // PutBlobWithOptions writes contents of stream and returns data representing the result.
 // inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
 // inputInfo.Size is the expected length of stream, if known.
@@ -127,7 +148,7 @@ func (d *ociImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		}
 	}()
 
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	digester, stream := putblobdigest.DigestIfSupportedUnknown(stream, inputInfo, d.digestAlgorithm)
 	// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
 	size, err := io.Copy(blobFile, stream)
 	if err != nil {
@@ -166,6 +187,7 @@ func (d *ociImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		return private.UploadedBlob{}, err
 	}
 	succeeded = true
+	d.fileWritten(blobPath)
 	return private.UploadedBlob{Digest: blobDigest, Size: size}, nil
 }
 
@@ -187,7 +209,12 @@ func (d *ociImageDestination) TryReusingBlobWithOptions(ctx context.Context, inf
 	}
 	finfo, err := os.Stat(blobPath)
 	if err != nil && os.IsNotExist(err) {
-		return false, private.ReusedBlob{}, nil
+		size, ok := d.tryDeduplicatingBlob(info.Digest, blobPath)
+		if !ok {
+			return false, private.ReusedBlob{}, nil
+		}
+		d.fileWritten(blobPath)
+		return true, private.ReusedBlob{Digest: info.Digest, Size: size}, nil
 	}
 	if err != nil {
 		return false, private.ReusedBlob{}, err
@@ -212,7 +239,7 @@ func (d *ociImageDestination) PutManifest(ctx context.Context, m []byte, instanc
 	if instanceDigest != nil {
 		digest = *instanceDigest
 	} else {
-		digest, err = manifest.Digest(m)
+		digest, err = manifest.DigestWithAlgorithm(m, d.digestAlgorithm)
 		if err != nil {
 			return err
 		}
@@ -225,9 +252,10 @@ func (d *ociImageDestination) PutManifest(ctx context.Context, m []byte, instanc
 	if err := ensureParentDirectoryExists(blobPath); err != nil {
 		return err
 	}
-	if err := os.WriteFile(blobPath, m, 0644); err != nil {
+	if err := durablefile.WriteFile(blobPath, m, 0644, d.durableWrites); err != nil {
 		return err
 	}
+	d.fileWritten(blobPath)
 
 	if instanceDigest != nil {
 		return nil
@@ -292,14 +320,33 @@ func (d *ociImageDestination) Commit(context.Context, types.UnparsedImage) error
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(d.ref.ociLayoutPath(), layoutBytes, 0644); err != nil {
+	if err := durablefile.WriteFile(d.ref.ociLayoutPath(), layoutBytes, 0644, d.durableWrites); err != nil {
 		return err
 	}
+	if d.durableWrites {
+		// Ensure all blobs are on disk before index.json refers to them.
+		if err := d.syncDirs.Sync(); err != nil {
+			return err
+		}
+	}
 	indexJSON, err := json.Marshal(d.index)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(d.ref.indexPath(), indexJSON, 0644)
+	if err := durablefile.WriteFile(d.ref.indexPath(), indexJSON, 0644, d.durableWrites); err != nil {
+		return err
+	}
+	if d.durableWrites {
+		return durablefile.SyncDir(d.ref.dir)
+	}
+	return nil
+}
+
+// fileWritten records that a file was created at path, so that Commit can sync its directory, if d.durableWrites.
+func (d *ociImageDestination) fileWritten(path string) {
+	if d.durableWrites {
+		d.syncDirs.Add(filepath.Dir(path))
+	}
 }
 
 func ensureDirectoryExists(path string) error {
@@ -178,3 +178,128 @@ func putTestManifest(t *testing.T, ociRef ociReference, tmpDir string) {
 	digest := digest.FromBytes(data).Encoded()
 	assert.Contains(t, paths, filepath.Join(tmpDir, "blobs", "sha256", digest), "The OCI directory does not contain the new manifest data")
 }
+
+func TestTryReusingBlobDeduplication(t *testing.T) {
+	blobBytes := []byte("deduplicated blob contents")
+	blobDigest := digest.FromBytes(blobBytes)
+	cache := memory.New()
+
+	otherDir := t.TempDir()
+	otherRef, err := NewReference(otherDir, "other")
+	require.NoError(t, err)
+	otherDest, err := otherRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = otherDest.PutBlob(context.Background(), bytes.NewReader(blobBytes), types.BlobInfo{Digest: blobDigest, Size: -1}, cache, false)
+	require.NoError(t, err)
+	err = otherDest.Close()
+	require.NoError(t, err)
+	otherBlobPath, err := otherRef.(ociReference).blobPath(blobDigest, "")
+	require.NoError(t, err)
+
+	for _, method := range []types.OCIBlobDeduplicationMethod{types.OCIBlobDeduplicationHardlink, types.OCIBlobDeduplicationReflink} {
+		ref, err := NewReference(t.TempDir(), "image")
+		require.NoError(t, err)
+		blobPath, err := ref.(ociReference).blobPath(blobDigest, "")
+		require.NoError(t, err)
+
+		// Without OCIDeduplicationBlobDirPaths, the blob is not found.
+		dest, err := ref.NewImageDestination(context.Background(), nil)
+		require.NoError(t, err)
+		reused, _, err := dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, cache, false)
+		require.NoError(t, err)
+		assert.False(t, reused)
+		err = dest.Close()
+		require.NoError(t, err)
+
+		dest, err = ref.NewImageDestination(context.Background(), &types.SystemContext{
+			OCIDeduplicationBlobDirPaths: []string{filepath.Join(t.TempDir(), "does-not-exist"), filepath.Join(otherDir, imgspecv1.ImageBlobsDir)},
+			OCIBlobDeduplicationMethod:   method,
+		})
+		require.NoError(t, err)
+		reused, info, err := dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, cache, false)
+		require.NoError(t, err)
+		err = dest.Close()
+		require.NoError(t, err)
+		if method == types.OCIBlobDeduplicationReflink && !reused {
+			// Reflinks are not supported by all filesystems; in that case, there must be no leftover files.
+			_, err := os.Lstat(blobPath)
+			assert.True(t, os.IsNotExist(err))
+			continue
+		}
+		require.True(t, reused, method)
+		assert.Equal(t, types.BlobInfo{Digest: blobDigest, Size: int64(len(blobBytes))}, info)
+		contents, err := os.ReadFile(blobPath)
+		require.NoError(t, err)
+		assert.Equal(t, blobBytes, contents)
+		if method == types.OCIBlobDeduplicationHardlink {
+			fi1, err := os.Stat(blobPath)
+			require.NoError(t, err)
+			fi2, err := os.Stat(otherBlobPath)
+			require.NoError(t, err)
+			assert.True(t, os.SameFile(fi1, fi2))
+		}
+	}
+}
+
+func TestPutDurableWrites(t *testing.T) {
+	ref, tmpDir := refToTempOCI(t)
+	blobBytes := []byte("durable blob contents")
+	manifestBytes, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
+	require.NoError(t, err)
+
+	dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{LocalDurableWrites: true})
+	require.NoError(t, err)
+	defer dest.Close()
+	info, err := dest.PutBlob(context.Background(), bytes.NewReader(blobBytes), types.BlobInfo{Digest: "", Size: -1}, memory.New(), false)
+	require.NoError(t, err)
+	err = dest.PutManifest(context.Background(), manifestBytes, nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(filepath.Join(tmpDir, imgspecv1.ImageBlobsDir, info.Digest.Algorithm().String(), info.Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, blobBytes, contents)
+	index, err := ref.(ociReference).getIndex()
+	require.NoError(t, err)
+	require.NotEmpty(t, index.Manifests)
+	assert.Equal(t, digest.FromBytes(manifestBytes), index.Manifests[len(index.Manifests)-1].Digest)
+	_, err = os.Stat(filepath.Join(tmpDir, imgspecv1.ImageLayoutFile))
+	assert.NoError(t, err)
+}
+
+func TestPutDigestAlgorithm(t *testing.T) {
+	ref, tmpDir := refToTempOCI(t)
+	blobBytes := []byte("sha512 blob contents")
+	manifestBytes, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
+	require.NoError(t, err)
+
+	_, err = ref.NewImageDestination(context.Background(), &types.SystemContext{DigestAlgorithm: "sha384"})
+	assert.Error(t, err)
+
+	dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{DigestAlgorithm: digest.SHA512})
+	require.NoError(t, err)
+	defer dest.Close()
+	info, err := dest.PutBlob(context.Background(), bytes.NewReader(blobBytes), types.BlobInfo{Digest: "", Size: -1}, memory.New(), false)
+	require.NoError(t, err)
+	assert.Equal(t, digest.SHA512.FromBytes(blobBytes), info.Digest)
+	// Known sha256 digests are preserved.
+	sha256Bytes := []byte("sha256 blob contents")
+	info256, err := dest.PutBlob(context.Background(), bytes.NewReader(sha256Bytes), types.BlobInfo{Digest: digest.FromBytes(sha256Bytes), Size: -1}, memory.New(), false)
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(sha256Bytes), info256.Digest)
+	err = dest.PutManifest(context.Background(), manifestBytes, nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(filepath.Join(tmpDir, imgspecv1.ImageBlobsDir, "sha512", info.Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, blobBytes, contents)
+	index, err := ref.(ociReference).getIndex()
+	require.NoError(t, err)
+	require.NotEmpty(t, index.Manifests)
+	assert.Equal(t, digest.SHA512.FromBytes(manifestBytes), index.Manifests[len(index.Manifests)-1].Digest)
+	_, err = os.Stat(filepath.Join(tmpDir, imgspecv1.ImageBlobsDir, "sha512", digest.SHA512.FromBytes(manifestBytes).Encoded()))
+	assert.NoError(t, err)
+}
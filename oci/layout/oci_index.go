@@ -0,0 +1,174 @@
+package layout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/ioutils"
+	"github.com/containers/storage/pkg/lockfile"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// indexLockFile is the name of a lock file, within the layout directory, used to serialize modifications of index.json
+// made by the functions in this file.
+const indexLockFile = imgspecv1.ImageIndexFile + ".lock"
+
+// ListResult is a named image in an OCI layout, as returned by List.
+type ListResult struct {
+	Reference          types.ImageReference
+	ManifestDescriptor imgspecv1.Descriptor
+}
+
+// List returns all named images in the OCI layout at dir, in the order they appear in index.json.
+// Entries of index.json without a name are not included.
+func List(dir string) ([]ListResult, error) {
+	index, err := parseIndex(filepath.Join(dir, imgspecv1.ImageIndexFile))
+	if err != nil {
+		return nil, err
+	}
+	res := []ListResult{}
+	for _, md := range index.Manifests {
+		name := md.Annotations[imgspecv1.AnnotationRefName]
+		if name == "" {
+			continue
+		}
+		ref, err := NewReference(dir, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image name %q in %s: %w", name, dir, err)
+		}
+		res = append(res, ListResult{
+			Reference:          ref,
+			ManifestDescriptor: md,
+		})
+	}
+	return res, nil
+}
+
+// AddReference adds name as an additional name of the image referenced by imgRef, without copying any data.
+// If name already refers to a different image, that image loses the name (but is not deleted).
+func AddReference(imgRef types.ImageReference, name string) error {
+	ref, err := ociReferenceWithNewName(imgRef, name)
+	if err != nil {
+		return err
+	}
+	return modifyIndex(ref.dir, func(index *imgspecv1.Index) error {
+		desc, _, err := ref.findManifestDescriptor(index)
+		if err != nil {
+			return err
+		}
+		if desc.Annotations[imgspecv1.AnnotationRefName] == name {
+			return nil
+		}
+		desc.Annotations = maps.Clone(desc.Annotations)
+		if desc.Annotations == nil {
+			desc.Annotations = map[string]string{}
+		}
+		desc.Annotations[imgspecv1.AnnotationRefName] = name
+		removeName(index, name)
+		index.Manifests = append(index.Manifests, desc)
+		return nil
+	})
+}
+
+// RenameReference renames the image referenced by imgRef to name, without copying any data.
+// If name already refers to a different image, that image loses the name (but is not deleted).
+func RenameReference(imgRef types.ImageReference, name string) error {
+	ref, err := ociReferenceWithNewName(imgRef, name)
+	if err != nil {
+		return err
+	}
+	return modifyIndex(ref.dir, func(index *imgspecv1.Index) error {
+		_, i, err := ref.findManifestDescriptor(index)
+		if err != nil {
+			return err
+		}
+		if index.Manifests[i].Annotations[imgspecv1.AnnotationRefName] == name {
+			return nil
+		}
+		removeName(index, name)
+		if index.Manifests[i].Annotations == nil {
+			index.Manifests[i].Annotations = map[string]string{}
+		}
+		index.Manifests[i].Annotations[imgspecv1.AnnotationRefName] = name
+		return nil
+	})
+}
+
+// DeleteReference removes the image referenced by imgRef from index.json.
+// Unlike imgRef.DeleteImage, it does not delete any blobs, even if they are no longer used
+// by any other image in the layout.
+func DeleteReference(imgRef types.ImageReference) error {
+	ref, ok := imgRef.(ociReference)
+	if !ok {
+		return errors.New("error typecasting, need type ociRef")
+	}
+	return modifyIndex(ref.dir, func(index *imgspecv1.Index) error {
+		_, i, err := ref.findManifestDescriptor(index)
+		if err != nil {
+			return err
+		}
+		index.Manifests = slices.Delete(index.Manifests, i, i+1)
+		return nil
+	})
+}
+
+// ociReferenceWithNewName returns imgRef as an ociReference, after validating that name can be added to it.
+func ociReferenceWithNewName(imgRef types.ImageReference, name string) (ociReference, error) {
+	ref, ok := imgRef.(ociReference)
+	if !ok {
+		return ociReference{}, errors.New("error typecasting, need type ociRef")
+	}
+	if name == "" {
+		return ociReference{}, errors.New("the new image name must not be empty")
+	}
+	if err := internal.ValidateImageName(name); err != nil {
+		return ociReference{}, err
+	}
+	return ref, nil
+}
+
+// removeName removes name from any entry in index which has it.
+func removeName(index *imgspecv1.Index, name string) {
+	for i := range index.Manifests {
+		if index.Manifests[i].Annotations[imgspecv1.AnnotationRefName] == name {
+			delete(index.Manifests[i].Annotations, imgspecv1.AnnotationRefName)
+		}
+	}
+}
+
+// modifyIndex calls modify on the contents of index.json of the layout at dir, and atomically replaces the file
+// with the result.  Modifications made by this function are serialized using a lock file.
+func modifyIndex(dir string, modify func(index *imgspecv1.Index) error) error {
+	lock, err := lockfile.GetLockFile(filepath.Join(dir, indexLockFile))
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+
+	indexPath := filepath.Join(dir, imgspecv1.ImageIndexFile)
+	index, err := parseIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	if err := modify(index); err != nil {
+		return err
+	}
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	var mode fs.FileMode = 0644
+	if fi, err := os.Stat(indexPath); err == nil {
+		mode = fi.Mode()
+	}
+	return ioutils.AtomicWriteFile(indexPath, indexJSON, mode)
+}
@@ -0,0 +1,140 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listNames returns the names of images in dir, and the digests they refer to.
+func listNames(t *testing.T, dir string) map[string]string {
+	res, err := List(dir)
+	require.NoError(t, err)
+	names := map[string]string{}
+	for _, r := range res {
+		ociRef, ok := r.Reference.(ociReference)
+		require.True(t, ok)
+		assert.Equal(t, ociRef.image, r.ManifestDescriptor.Annotations[imgspecv1.AnnotationRefName])
+		names[ociRef.image] = r.ManifestDescriptor.Digest.String()
+	}
+	return names
+}
+
+func TestList(t *testing.T) {
+	names := listNames(t, "fixtures/delete_image_multiple_images")
+	assert.Equal(t, map[string]string{
+		"latest": "sha256:a2f798327b3f25e3eff54badcb769953de235e62e3e32051d57a5e66246de4a1",
+		"3.18.3": "sha256:a2f798327b3f25e3eff54badcb769953de235e62e3e32051d57a5e66246de4a1",
+		"3":      "sha256:93cbd11a4f41467a0409b975499ae711bc6f8222de38d9f1b5a4097583195ad5",
+		"3.18":   "sha256:93cbd11a4f41467a0409b975499ae711bc6f8222de38d9f1b5a4097583195ad5",
+		"3.17.5": "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805",
+		"3.16.7": "sha256:861d3c014b0e3edcf80e6221247d6b2921a4f892feb9bafe9515b9975b78c44f",
+		"1.0.0":  "sha256:0dc27f36a618c110ae851662c13283e9fbc1b5a5de003befc4bcefa5a05d2eef",
+	}, names)
+
+	// Unnamed entries are not included
+	res, err := List("fixtures/two_images_manifest")
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	_, err = List("fixtures/this-does-not-exist")
+	assert.Error(t, err)
+}
+
+func TestAddReference(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_multiple_images")
+	ref, err := NewReference(tmpDir, "3.17.5")
+	require.NoError(t, err)
+
+	err = AddReference(ref, "new")
+	require.NoError(t, err)
+	names := listNames(t, tmpDir)
+	assert.Len(t, names, 8)
+	assert.Equal(t, "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805", names["new"])
+	assert.Equal(t, "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805", names["3.17.5"])
+
+	// Moving an existing name
+	err = AddReference(ref, "latest")
+	require.NoError(t, err)
+	names = listNames(t, tmpDir)
+	assert.Len(t, names, 8)
+	assert.Equal(t, "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805", names["latest"])
+
+	// Adding the same name again is a no-op
+	err = AddReference(ref, "3.17.5")
+	require.NoError(t, err)
+	ociRef, ok := ref.(ociReference)
+	require.True(t, ok)
+	index, err := ociRef.getIndex()
+	require.NoError(t, err)
+	assert.Len(t, index.Manifests, 9)
+
+	for _, c := range []struct {
+		image, name string
+	}{
+		{"3.17.5", ""},            // Empty name
+		{"3.17.5", "@invalid"},    // Invalid name
+		{"does-not-exist", "new"}, // Nonexistent image
+		{"", "new"},               // Ambiguous image
+	} {
+		ref, err := NewReference(tmpDir, c.image)
+		require.NoError(t, err)
+		err = AddReference(ref, c.name)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestRenameReference(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_multiple_images")
+	ref, err := NewReference(tmpDir, "3.17.5")
+	require.NoError(t, err)
+
+	err = RenameReference(ref, "renamed")
+	require.NoError(t, err)
+	names := listNames(t, tmpDir)
+	assert.Len(t, names, 7)
+	assert.NotContains(t, names, "3.17.5")
+	assert.Equal(t, "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805", names["renamed"])
+
+	// Taking over an existing name
+	ref, err = NewReference(tmpDir, "renamed")
+	require.NoError(t, err)
+	err = RenameReference(ref, "1.0.0")
+	require.NoError(t, err)
+	names = listNames(t, tmpDir)
+	assert.Len(t, names, 6)
+	assert.Equal(t, "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805", names["1.0.0"])
+
+	ref, err = NewReference(tmpDir, "does-not-exist")
+	require.NoError(t, err)
+	err = RenameReference(ref, "new")
+	assert.Error(t, err)
+}
+
+func TestDeleteReference(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_multiple_images")
+	ref, err := NewReference(tmpDir, "3.17.5")
+	require.NoError(t, err)
+
+	err = DeleteReference(ref)
+	require.NoError(t, err)
+	names := listNames(t, tmpDir)
+	assert.Len(t, names, 6)
+	assert.NotContains(t, names, "3.17.5")
+	// Blobs are not deleted
+	ociRef, ok := ref.(ociReference)
+	require.True(t, ok)
+	blobPath, err := ociRef.blobPath("sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805", "")
+	require.NoError(t, err)
+	assert.FileExists(t, blobPath)
+
+	err = DeleteReference(ref)
+	assert.Error(t, err)
+
+	var notOCI types.ImageReference
+	err = DeleteReference(notOCI)
+	assert.Error(t, err)
+}
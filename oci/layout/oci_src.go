@@ -5,15 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 
+	"github.com/containers/image/v5/internal/errcategory"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/timeouts"
 	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	"github.com/containers/image/v5/types"
 	"github.com/docker/go-connections/tlsconfig"
@@ -32,6 +35,11 @@ func (e ImageNotFoundError) Error() string {
 	return fmt.Sprintf("no descriptor found for reference %q", e.ref.image)
 }
 
+// Is returns true if target is types.ErrNotFound, so that errors.Is(err, types.ErrNotFound) works.
+func (e ImageNotFoundError) Is(target error) bool {
+	return target == types.ErrNotFound
+}
+
 type ociImageSource struct {
 	impl.Compat
 	impl.PropertyMethodsInitialize
@@ -58,8 +66,10 @@ func newImageSource(sys *types.SystemContext, ref ociReference) (private.ImageSo
 		tr.TLSClientConfig.InsecureSkipVerify = sys.OCIInsecureSkipTLSVerify
 	}
 
+	timeouts.ApplyToTransport(tr, sys)
+
 	client := &http.Client{}
-	client.Transport = tr
+	client.Transport = timeouts.NewRoundTripper(tr, sys)
 	descriptor, _, err := ref.getManifestDescriptor()
 	if err != nil {
 		return nil, err
@@ -156,6 +166,9 @@ func (s *ociImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 
 	r, err := os.Open(path)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errcategory.Wrap(err, types.ErrBlobUnknown)
+		}
 		return nil, 0, err
 	}
 	fi, err := r.Stat()
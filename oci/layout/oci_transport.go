@@ -186,7 +186,11 @@ func (ref ociReference) getManifestDescriptor() (imgspecv1.Descriptor, int, erro
 	if err != nil {
 		return imgspecv1.Descriptor{}, -1, err
 	}
+	return ref.findManifestDescriptor(index)
+}
 
+// findManifestDescriptor returns the descriptor of ref within index, and its position in index.Manifests.
+func (ref ociReference) findManifestDescriptor(index *imgspecv1.Index) (imgspecv1.Descriptor, int, error) {
 	if ref.image == "" {
 		// return manifest if only one image is in the oci directory
 		if len(index.Manifests) != 1 {
@@ -0,0 +1,281 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/timeouts"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	// emptyPayloadHash is the SHA-256 of an empty request body.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// unsignedPayload is used instead of a payload hash when uploading data, so that it can be streamed.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// maxErrorBodySize is the maximum size of an error response we read.
+	maxErrorBodySize = 1 << 16
+)
+
+// client is a minimal client of the S3 API, using path-style URLs and AWS Signature Version 4.
+type client struct {
+	endpoint    *url.URL
+	region      string
+	credentials *types.S3Credentials // nil for anonymous access
+	httpClient  *http.Client
+	now         func() time.Time // Only replaced in tests.
+}
+
+// newClient returns a client configured using sys.
+func newClient(sys *types.SystemContext) (*client, error) {
+	region := os.Getenv("AWS_REGION")
+	if sys != nil && sys.S3Region != "" {
+		region = sys.S3Region
+	}
+	if region == "" {
+		region = defaultRegion
+	}
+	endpoint := "https://s3." + region + ".amazonaws.com"
+	if sys != nil && sys.S3Endpoint != "" {
+		endpoint = sys.S3Endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parsing S3 endpoint %q: %w", endpoint, err)
+	}
+	if (endpointURL.Scheme != "https" && endpointURL.Scheme != "http") || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q, expected an http or https URL", endpoint)
+	}
+
+	var credentials *types.S3Credentials
+	if sys != nil && sys.S3Credentials != nil {
+		credentials = sys.S3Credentials
+	} else if accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyID != "" {
+		credentials = &types.S3Credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+
+	tr := tlsclientconfig.NewTransport()
+	timeouts.ApplyToTransport(tr, sys)
+	return &client{
+		endpoint:    endpointURL,
+		region:      region,
+		credentials: credentials,
+		httpClient:  &http.Client{Transport: timeouts.NewRoundTripper(tr, sys)},
+		now:         time.Now,
+	}, nil
+}
+
+// objectURL returns a path-style URL of key in bucket.
+func (c *client) objectURL(bucket, key string) *url.URL {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + key
+	u.RawPath = ""
+	u.RawQuery = ""
+	return &u
+}
+
+// do sends a request for key in bucket, and returns the response if it is successful.
+// The caller must close the response body.
+func (c *client) do(ctx context.Context, method, bucket, key string, headers map[string]string, body io.Reader, size int64) (*http.Response, error) {
+	u := c.objectURL(bucket, key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody // Otherwise net/http treats the length as unknown.
+		}
+		payloadHash = unsignedPayload
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	c.sign(req, payloadHash)
+
+	logrus.Debugf("%s %s", method, u.Redacted())
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("s3://%s/%s: %w%.0w", bucket, key, fs.ErrNotExist, types.ErrNotFound)
+	}
+	return nil, errcategory.Wrap(fmt.Errorf("%s s3://%s/%s: %w", method, bucket, key, responseError(res)), errcategory.FromHTTPStatus(res.StatusCode))
+}
+
+// responseError returns an error describing an unsuccessful response.
+func responseError(res *http.Response) error {
+	var parsed struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, err := iolimits.ReadAtMost(res.Body, maxErrorBodySize)
+	if err == nil && xml.Unmarshal(body, &parsed) == nil && parsed.Code != "" {
+		return fmt.Errorf("%s: %s (%s)", res.Status, parsed.Message, parsed.Code)
+	}
+	return fmt.Errorf("%s", res.Status)
+}
+
+// getObject returns the contents of key in bucket, and its size (or -1 if unknown).
+func (c *client) getObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, error) {
+	res, err := c.do(ctx, http.MethodGet, bucket, key, nil, nil, 0)
+	if err != nil {
+		return nil, -1, err
+	}
+	return res.Body, res.ContentLength, nil
+}
+
+// headObject returns the size of key in bucket, or an error wrapping fs.ErrNotExist if it does not exist.
+func (c *client) headObject(ctx context.Context, bucket, key string) (int64, error) {
+	res, err := c.do(ctx, http.MethodHead, bucket, key, nil, nil, 0)
+	if err != nil {
+		return -1, err
+	}
+	res.Body.Close()
+	return res.ContentLength, nil
+}
+
+// putObject stores size bytes from body as key in bucket.
+// If contentDigest is not "", and S3 supports its algorithm, S3 verifies that the contents match it before storing them.
+// S3 makes the object visible only if the whole upload succeeds.
+func (c *client) putObject(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string, contentDigest digest.Digest) error {
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	if contentDigest != "" && contentDigest.Algorithm() == digest.SHA256 {
+		// S3 does not support SHA-512 checksums; callers must deal with such uploads on their own.
+		raw, err := hex.DecodeString(contentDigest.Encoded())
+		if err != nil {
+			return fmt.Errorf("invalid digest %q: %w", contentDigest.String(), err)
+		}
+		headers["X-Amz-Checksum-Sha256"] = base64.StdEncoding.EncodeToString(raw)
+	}
+	res, err := c.do(ctx, http.MethodPut, bucket, key, headers, body, size)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// deleteObject deletes key in bucket; it is not an error if key does not exist.
+func (c *client) deleteObject(ctx context.Context, bucket, key string) error {
+	res, err := c.do(ctx, http.MethodDelete, bucket, key, nil, nil, 0)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers to req, which must not be modified afterwards.
+// All headers present in req are signed.
+func (c *client) sign(req *http.Request, payloadHash string) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.credentials == nil {
+		return
+	}
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := strings.Builder{}
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery, // We never send query parameters which would need to be sorted.
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data using key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes s as required by AWS Signature Version 4: all bytes except unreserved characters are percent-encoded,
+// and so is "/" if encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	res := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '.' || b == '_' || b == '~':
+			res.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			res.WriteByte(b)
+		default:
+			fmt.Fprintf(&res, "%%%02X", b)
+		}
+	}
+	return res.String()
+}
@@ -0,0 +1,321 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"sync"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/streamdigest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+type s3ImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.NoSignaturesInitialize
+
+	ref    s3Reference
+	sys    *types.SystemContext
+	client *client
+	index  imgspecv1.Index
+}
+
+// newImageDestination returns an ImageDestination for writing to a layout in a bucket, which may or may not already exist.
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref s3Reference) (private.ImageDestination, error) {
+	c, err := newClient(sys)
+	if err != nil {
+		return nil, err
+	}
+	index, err := getIndex(ctx, c, ref, iolimits.MaxManifestBodySizeFor(sys))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		index = &imgspecv1.Index{
+			Versioned: imgspec.Versioned{
+				SchemaVersion: 2,
+			},
+			Annotations: make(map[string]string),
+		}
+	}
+
+	desiredLayerCompression := types.Compress
+	if sys != nil && sys.OCIAcceptUncompressedLayers {
+		desiredLayerCompression = types.PreserveOriginal
+	}
+
+	d := &s3ImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes: []string{
+				imgspecv1.MediaTypeImageManifest,
+				imgspecv1.MediaTypeImageIndex,
+			},
+			DesiredLayerCompression:        desiredLayerCompression,
+			AcceptsForeignLayerURLs:        true,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
+			HasThreadSafePutBlob:           true,
+			AcceptsNonImageArtifacts:       true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+		NoSignaturesInitialize:     stubs.NoSignatures("Pushing signatures for OCI images is not supported"),
+
+		ref:    ref,
+		sys:    sys,
+		client: c,
+		index:  *index,
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *s3ImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *s3ImageDestination) Close() error {
+	d.client.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *s3ImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	// S3 requires the size of an upload to be known in advance, and the key depends on the digest.
+	if inputInfo.Digest == "" || inputInfo.Size == -1 {
+		logrus.Debugf("Blob digest or size is unknown, buffering the blob to a temporary file")
+		s, cleanup, err := streamdigest.ComputeBlobInfo(d.sys, stream, &inputInfo)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		defer cleanup()
+		stream = s
+	}
+
+	key, err := d.ref.blobKey(inputInfo.Digest)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	// net/http sends the whole body before it notices a failure at the end of input (e.g. when the digest is verified);
+	// S3 verifies SHA-256 digests on its own, and eofCheckingReader withholds the last byte until the end of stream
+	// is confirmed, so that the upload is incomplete and the object is not created.  Still, if anything went wrong with
+	// stream, make sure that no data remains stored under the digest.
+	body := &eofCheckingReader{r: stream, remaining: inputInfo.Size}
+	err = d.client.putObject(ctx, d.ref.bucket, key, body, inputInfo.Size, "", inputInfo.Digest)
+	if streamErr := body.streamError(); streamErr != nil {
+		if err := d.client.deleteObject(ctx, d.ref.bucket, key); err != nil {
+			logrus.Warnf("Error deleting incompletely uploaded blob s3://%s/%s: %v", d.ref.bucket, key, err)
+		}
+		return private.UploadedBlob{}, streamErr
+	}
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	return private.UploadedBlob{Digest: inputInfo.Digest, Size: inputInfo.Size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *s3ImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalCandidateMatchesTryReusingBlobOptions(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	key, err := d.ref.blobKey(info.Digest)
+	if err != nil {
+		return false, private.ReusedBlob{}, err
+	}
+	size, err := d.client.headObject(ctx, d.ref.bucket, key)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, private.ReusedBlob{}, nil
+		}
+		return false, private.ReusedBlob{}, err
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: size}, nil
+}
+
+// PutManifest writes a manifest to the destination.  Per our list of supported manifest MIME types,
+// this should be either an OCI manifest (possibly converted to this format by the caller) or index,
+// neither of which we'll need to modify further.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to overwrite the manifest for (when
+// the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *s3ImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	var digest digest.Digest
+	var err error
+	if instanceDigest != nil {
+		digest = *instanceDigest
+	} else {
+		digest, err = manifest.Digest(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := d.ref.blobKey(digest)
+	if err != nil {
+		return err
+	}
+	mimeType := manifest.GuessMIMEType(m)
+	if err := d.client.putObject(ctx, d.ref.bucket, key, bytes.NewReader(m), int64(len(m)), mimeType, digest); err != nil {
+		return err
+	}
+
+	if instanceDigest != nil {
+		return nil
+	}
+
+	desc := imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    digest,
+		Size:      int64(len(m)),
+	}
+	if d.ref.image != "" {
+		desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: d.ref.image}
+	}
+	d.addManifest(&desc)
+	return nil
+}
+
+// addManifest adds desc to d.index, following the same rules as the oci/layout transport.
+func (d *s3ImageDestination) addManifest(desc *imgspecv1.Descriptor) {
+	// If the new entry has a name, remove any conflicting names which we already have.
+	if desc.Annotations[imgspecv1.AnnotationRefName] != "" {
+		for i, manifest := range d.index.Manifests {
+			if manifest.Annotations[imgspecv1.AnnotationRefName] == desc.Annotations[imgspecv1.AnnotationRefName] {
+				delete(d.index.Manifests[i].Annotations, imgspecv1.AnnotationRefName)
+				break
+			}
+		}
+	}
+	// If it has the same digest as another unnamed entry in the index, just pick up the other information.
+	for i, manifest := range d.index.Manifests {
+		if manifest.Digest == desc.Digest && manifest.Annotations[imgspecv1.AnnotationRefName] == "" {
+			d.index.Manifests[i] = *desc
+			return
+		}
+	}
+	d.index.Manifests = append(slices.Clone(d.index.Manifests), *desc)
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *s3ImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	layoutBytes, err := json.Marshal(imgspecv1.ImageLayout{
+		Version: imgspecv1.ImageLayoutVersion,
+	})
+	if err != nil {
+		return err
+	}
+	if err := d.client.putObject(ctx, d.ref.bucket, d.ref.ociLayoutKey(), bytes.NewReader(layoutBytes), int64(len(layoutBytes)), "application/json", ""); err != nil {
+		return err
+	}
+	// NOTE: S3 provides no locking, so concurrent writers to the same layout may overwrite each other’s index.json updates.
+	indexJSON, err := json.Marshal(d.index)
+	if err != nil {
+		return err
+	}
+	return d.client.putObject(ctx, d.ref.bucket, d.ref.indexKey(), bytes.NewReader(indexJSON), int64(len(indexJSON)), imgspecv1.MediaTypeImageIndex, "")
+}
+
+// eofCheckingReader reads exactly remaining bytes from r, and does not return the last of them until r reports io.EOF.
+// This ensures that a failure at the end of r (notably a digest mismatch) aborts an upload before all of the data is sent.
+type eofCheckingReader struct {
+	r         io.Reader
+	remaining int64
+
+	mutex sync.Mutex // Protects err, which may be read while the HTTP transport is still reading the body.
+	err   error
+}
+
+// Read implements io.Reader.
+func (r *eofCheckingReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r.remaining > 1 {
+		n, err := r.r.Read(p[:min(int64(len(p)), r.remaining-1)])
+		r.remaining -= int64(n)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, r.recordError(err)
+	}
+	var last []byte
+	if r.remaining == 1 {
+		if _, err := io.ReadFull(r.r, p[:1]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, r.recordError(err)
+		}
+		r.remaining = 0
+		last = p[:1]
+	}
+	var probe [1]byte
+	n, err := io.ReadAtLeast(r.r, probe[:], 1)
+	switch {
+	case n > 0:
+		return 0, r.recordError(errors.New("stream is longer than the declared size"))
+	case err != io.EOF:
+		return 0, r.recordError(err)
+	}
+	return len(last), io.EOF
+}
+
+// recordError records err, if any, as the failure of the stream, and returns it.
+func (r *eofCheckingReader) recordError(err error) error {
+	if err != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if r.err == nil {
+			r.err = err
+		}
+	}
+	return err
+}
+
+// streamError returns the error reading the stream reported, if any.
+func (r *eofCheckingReader) streamError() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
@@ -0,0 +1,228 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ private.ImageDestination = (*s3ImageDestination)(nil)
+
+// fakeS3Server is a minimal in-memory implementation of the path-style S3 object API.
+type fakeS3Server struct {
+	mutex   sync.Mutex
+	objects map[string][]byte // Keyed by "/bucket/key"
+}
+
+func newFakeS3Server(t *testing.T) (*fakeS3Server, *httptest.Server) {
+	s := &fakeS3Server{objects: map[string][]byte{}}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(data)) != r.ContentLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if checksum := r.Header.Get("X-Amz-Checksum-Sha256"); checksum != "" {
+			sum := sha256.Sum256(data)
+			if checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>BadDigest</Code><Message>The SHA256 you specified did not match the calculated checksum.</Message></Error>`))
+				return
+			}
+		}
+		s.objects[r.URL.Path] = data
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	s3, server := newFakeS3Server(t)
+	sys := &types.SystemContext{
+		S3Endpoint:    server.URL,
+		S3Credentials: &types.S3Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+	}
+	configBytes := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layerBytes := []byte("not really a layer")
+	manifestBytes := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + digest.FromBytes(configBytes).String() + `","size":37},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + digest.FromBytes(layerBytes).String() + `","size":18}]}`)
+	cache := memory.New()
+
+	ref, err := ParseReference("//bucket/some/prefix:name")
+	require.NoError(t, err)
+
+	// Reading a missing layout fails
+	_, err = ref.NewImageSource(context.Background(), sys)
+	assert.Error(t, err)
+
+	dest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dest.Close()
+	// Known digest and size
+	info, err := dest.PutBlob(context.Background(), bytes.NewReader(configBytes), types.BlobInfo{Digest: digest.FromBytes(configBytes), Size: int64(len(configBytes))}, cache, true)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: digest.FromBytes(configBytes), Size: int64(len(configBytes))}, info)
+	// Unknown digest and size
+	info, err = dest.PutBlob(context.Background(), bytes.NewReader(layerBytes), types.BlobInfo{Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: int64(len(layerBytes))}, info)
+	assert.Equal(t, layerBytes, s3.objects["/bucket/some/prefix/blobs/sha256/"+digest.FromBytes(layerBytes).Encoded()])
+	// Reuse
+	reused, info, err := dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: int64(len(layerBytes))}, info)
+	reused, _, err = dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: digest.FromString("unknown"), Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	err = dest.PutManifest(context.Background(), manifestBytes, nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	err = dest.Close()
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`{"imageLayoutVersion":"1.0.0"}`), s3.objects["/bucket/some/prefix/oci-layout"])
+
+	// A second image is added to the existing index
+	ref2, err := ParseReference("//bucket/some/prefix:other")
+	require.NoError(t, err)
+	dest, err = ref2.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	err = dest.PutManifest(context.Background(), manifestBytes, nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil)
+	require.NoError(t, err)
+	err = dest.Close()
+	require.NoError(t, err)
+	var index imgspecv1.Index
+	err = json.Unmarshal(s3.objects["/bucket/some/prefix/index.json"], &index)
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 2)
+	assert.Equal(t, "name", index.Manifests[0].Annotations[imgspecv1.AnnotationRefName])
+	assert.Equal(t, "other", index.Manifests[1].Annotations[imgspecv1.AnnotationRefName])
+
+	src, err := ref.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer src.Close()
+	m, mimeType, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifestBytes, m)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+	blob, size, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: digest.FromBytes(layerBytes), Size: -1}, cache)
+	require.NoError(t, err)
+	defer blob.Close()
+	assert.Equal(t, int64(len(layerBytes)), size)
+	blobContents, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	assert.Equal(t, layerBytes, blobContents)
+	_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: digest.FromString("unknown"), Size: -1}, cache)
+	assert.Error(t, err)
+
+	// With two images, an unnamed reference is ambiguous
+	ref3, err := ParseReference("//bucket/some/prefix")
+	require.NoError(t, err)
+	_, err = ref3.NewImageSource(context.Background(), sys)
+	assert.Error(t, err)
+
+	// Invalid credentials are reported
+	_, err = ref.NewImageSource(context.Background(), &types.SystemContext{
+		S3Endpoint:    server.URL,
+		S3Credentials: &types.S3Credentials{AccessKeyID: "other", SecretAccessKey: "secret"},
+	})
+	assert.ErrorContains(t, err, "Access Denied")
+}
+
+func TestS3PutBlobFailure(t *testing.T) {
+	s3, server := newFakeS3Server(t)
+	sys := &types.SystemContext{
+		S3Endpoint:    server.URL,
+		S3Credentials: &types.S3Credentials{AccessKeyID: "key", SecretAccessKey: "secret"},
+	}
+	ref, err := NewReference("bucket", "", "")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	// A stream shorter than the declared size is not stored
+	blobDigest := digest.FromString("contents")
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader([]byte("content")), types.BlobInfo{Digest: blobDigest, Size: 8}, memory.New(), false)
+	assert.Error(t, err)
+	assert.NotContains(t, s3.objects, "/bucket/blobs/sha256/"+blobDigest.Encoded())
+
+	// A stream with the wrong contents is rejected by S3
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader([]byte("CONTENTS")), types.BlobInfo{Digest: blobDigest, Size: 8}, memory.New(), false)
+	assert.ErrorContains(t, err, "BadDigest")
+	assert.NotContains(t, s3.objects, "/bucket/blobs/sha256/"+blobDigest.Encoded())
+
+	// A stream which fails at the end of input (e.g. when verifying a digest) is not stored,
+	// even if S3 can't verify the digest.
+	for _, blobDigest := range []digest.Digest{blobDigest, digest.SHA512.FromString("contents")} {
+		_, err = dest.PutBlob(context.Background(), &failingAtEOFReader{r: bytes.NewReader([]byte("contents"))},
+			types.BlobInfo{Digest: blobDigest, Size: 8}, memory.New(), false)
+		assert.ErrorIs(t, err, errFailingAtEOF)
+		assert.NotContains(t, s3.objects, "/bucket/blobs/"+blobDigest.Algorithm().String()+"/"+blobDigest.Encoded())
+	}
+}
+
+var errFailingAtEOF = errors.New("failing at EOF")
+
+// failingAtEOFReader returns data from r, but fails with errFailingAtEOF instead of returning io.EOF.
+type failingAtEOFReader struct {
+	r io.Reader
+}
+
+func (r *failingAtEOFReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		err = errFailingAtEOF
+	}
+	return n, err
+}
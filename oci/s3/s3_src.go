@@ -0,0 +1,154 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type s3ImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.NoSignatures
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.NoGetBlobAtInitialize
+
+	ref             s3Reference
+	client          *client
+	maxManifestSize int
+	index           *imgspecv1.Index
+	descriptor      imgspecv1.Descriptor
+}
+
+// newImageSource returns an ImageSource for reading from an existing layout in a bucket.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref s3Reference) (private.ImageSource, error) {
+	c, err := newClient(sys)
+	if err != nil {
+		return nil, err
+	}
+	maxManifestSize := iolimits.MaxManifestBodySizeFor(sys)
+	index, err := getIndex(ctx, c, ref, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := internal.FindManifestDescriptor(index, ref.image, "s3://"+ref.location())
+	if err != nil {
+		return nil, err
+	}
+	s := &s3ImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
+
+		ref:             ref,
+		client:          c,
+		maxManifestSize: maxManifestSize,
+		index:           index,
+		descriptor:      descriptor,
+	}
+	s.Compat = impl.AddCompat(s)
+	return s, nil
+}
+
+// getIndex reads index.json of ref, which must be at most maxSize bytes, using c.
+func getIndex(ctx context.Context, c *client, ref s3Reference, maxSize int) (*imgspecv1.Index, error) {
+	body, _, err := c.getObject(ctx, ref.bucket, ref.indexKey())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	indexBytes, err := iolimits.ReadAtMost(body, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	index := imgspecv1.Index{}
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("parsing s3://%s/%s: %w", ref.bucket, ref.indexKey(), err)
+	}
+	return &index, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *s3ImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *s3ImageSource) Close() error {
+	s.client.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *s3ImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	var dig digest.Digest
+	var mimeType string
+	if instanceDigest == nil {
+		dig = s.descriptor.Digest
+		mimeType = s.descriptor.MediaType
+	} else {
+		dig = *instanceDigest
+		for _, md := range s.index.Manifests {
+			if md.Digest == dig {
+				mimeType = md.MediaType
+				break
+			}
+		}
+	}
+
+	key, err := s.ref.blobKey(dig)
+	if err != nil {
+		return nil, "", err
+	}
+	body, _, err := s.client.getObject(ctx, s.ref.bucket, key)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			err = errcategory.Wrap(err, types.ErrManifestUnknown)
+		}
+		return nil, "", err
+	}
+	defer body.Close()
+	m, err := iolimits.ReadAtMost(body, s.maxManifestSize)
+	if err != nil {
+		return nil, "", err
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *s3ImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	key, err := s.ref.blobKey(info.Digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	body, size, err := s.client.getObject(ctx, s.ref.bucket, key)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			err = errcategory.Wrap(err, types.ErrBlobUnknown)
+		}
+		return nil, 0, err
+	}
+	return body, size, nil
+}
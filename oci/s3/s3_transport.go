@@ -0,0 +1,205 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func init() {
+	transports.Register(Transport)
+}
+
+// Transport is an ImageTransport for OCI layouts stored in S3-compatible buckets.
+var Transport = s3Transport{}
+
+type s3Transport struct{}
+
+func (t s3Transport) Name() string {
+	return "s3"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t s3Transport) ParseReference(reference string) (types.ImageReference, error) {
+	return ParseReference(reference)
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t s3Transport) ValidatePolicyConfigurationScope(scope string) error {
+	if strings.HasPrefix(scope, "/") || strings.HasSuffix(scope, "/") {
+		return fmt.Errorf("Invalid scope %s: must be a bucket name, optionally followed by a path prefix, without a leading or trailing slash", scope)
+	}
+	if cleaned := path.Clean(scope); cleaned != scope {
+		return fmt.Errorf(`Invalid scope %s: Uses non-canonical path format, perhaps try with path %s`, scope, cleaned)
+	}
+	return nil
+}
+
+// s3Reference is an ImageReference for OCI layouts stored in S3-compatible buckets.
+type s3Reference struct {
+	bucket string
+	prefix string // The key prefix of the layout within bucket, without a leading or trailing slash; "" for the root of the bucket.
+	// If image=="", it means the "only image" in the index.json is used in the case it is a source
+	// for destinations, the image name annotation "image.ref.name" is not added to the index.json
+	image string
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an S3 ImageReference.
+// The expected format is //bucket[/prefix][:image].
+func ParseReference(reference string) (types.ImageReference, error) {
+	location, ok := strings.CutPrefix(reference, "//")
+	if !ok {
+		return nil, fmt.Errorf("S3 reference %q does not start with //", reference)
+	}
+	location, image, _ := strings.Cut(location, ":") // image is set to "" if there is no ":"
+	bucket, prefix, _ := strings.Cut(location, "/")
+	return NewReference(bucket, prefix, image)
+}
+
+// NewReference returns an S3 reference for a layout stored in bucket under prefix, and an image.
+func NewReference(bucket, prefix, image string) (types.ImageReference, error) {
+	if bucket == "" {
+		return nil, errors.New("Invalid S3 reference: bucket name must not be empty")
+	}
+	if strings.ContainsAny(bucket, "/:") {
+		return nil, fmt.Errorf("Invalid S3 reference: bucket name %q contains a slash or a colon", bucket)
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		if strings.Contains(prefix, ":") {
+			return nil, fmt.Errorf("Invalid S3 reference: path %s contains a colon", prefix)
+		}
+		if cleaned := path.Clean(prefix); cleaned != prefix || prefix == "." || prefix == ".." || strings.HasPrefix(prefix, "../") {
+			return nil, fmt.Errorf("Invalid S3 reference: path %s is not in canonical format", prefix)
+		}
+	}
+	if err := internal.ValidateImageName(image); err != nil {
+		return nil, err
+	}
+	return s3Reference{bucket: bucket, prefix: prefix, image: image}, nil
+}
+
+func (ref s3Reference) Transport() types.ImageTransport {
+	return Transport
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref s3Reference) StringWithinTransport() string {
+	return fmt.Sprintf("//%s:%s", ref.location(), ref.image)
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref s3Reference) DockerReference() reference.Named {
+	return nil
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref s3Reference) PolicyConfigurationIdentity() string {
+	// NOTE: ref.image is not a part of the image identity, for the same reasons as in oci/layout.
+	// The endpoint is not a part of the identity either, it is not a part of the reference.
+	return ref.location()
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref s3Reference) PolicyConfigurationNamespaces() []string {
+	res := []string{}
+	location := ref.location()
+	for {
+		lastSlash := strings.LastIndex(location, "/")
+		if lastSlash == -1 {
+			break
+		}
+		location = location[:lastSlash]
+		res = append(res, location)
+	}
+	return res
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref s3Reference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref s3Reference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref s3Reference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return newImageDestination(ctx, sys, ref)
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref s3Reference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	return errors.New("Deleting images not implemented for s3: images")
+}
+
+// location returns the bucket and prefix of ref, separated by a slash if the prefix is not empty.
+func (ref s3Reference) location() string {
+	if ref.prefix == "" {
+		return ref.bucket
+	}
+	return ref.bucket + "/" + ref.prefix
+}
+
+// objectKey returns the key of name (a slash-separated path relative to the layout root) within ref.bucket.
+func (ref s3Reference) objectKey(name string) string {
+	if ref.prefix == "" {
+		return name
+	}
+	return ref.prefix + "/" + name
+}
+
+// indexKey returns the key of index.json.
+func (ref s3Reference) indexKey() string {
+	return ref.objectKey(imgspecv1.ImageIndexFile)
+}
+
+// ociLayoutKey returns the key of the oci-layout file.
+func (ref s3Reference) ociLayoutKey() string {
+	return ref.objectKey(imgspecv1.ImageLayoutFile)
+}
+
+// blobKey returns the key of a blob using OCI image-layout conventions.
+func (ref s3Reference) blobKey(digest digest.Digest) (string, error) {
+	if err := digest.Validate(); err != nil {
+		return "", fmt.Errorf("unexpected digest reference %s: %w", digest, err)
+	}
+	return ref.objectKey(imgspecv1.ImageBlobsDir + "/" + digest.Algorithm().String() + "/" + digest.Encoded()), nil
+}
@@ -0,0 +1,166 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "s3", Transport.Name())
+}
+
+func TestTransportParseReference(t *testing.T) {
+	for _, c := range []struct{ input, bucket, prefix, image string }{
+		{"//bucket", "bucket", "", ""},
+		{"//bucket/", "bucket", "", ""},
+		{"//bucket:", "bucket", "", ""},
+		{"//bucket:image", "bucket", "", "image"},
+		{"//bucket/some/prefix", "bucket", "some/prefix", ""},
+		{"//bucket/some/prefix/:repo/image:tag", "bucket", "some/prefix", "repo/image:tag"},
+	} {
+		ref, err := Transport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		s3Ref, ok := ref.(s3Reference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.bucket, s3Ref.bucket, c.input)
+		assert.Equal(t, c.prefix, s3Ref.prefix, c.input)
+		assert.Equal(t, c.image, s3Ref.image, c.input)
+	}
+
+	for _, input := range []string{
+		"",
+		"bucket",
+		"/bucket",
+		"//",
+		"//:image",
+		"//bucket/a/../b",
+		"//bucket/a//b",
+		"//bucket/..",
+		"//bucket/:@invalid",
+	} {
+		_, err := Transport.ParseReference(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"bucket",
+		"bucket/prefix",
+		"bucket/some/prefix",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"/bucket",
+		"bucket/",
+		"bucket//prefix",
+		"bucket/../prefix",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestNewReference(t *testing.T) {
+	ref, err := NewReference("bucket", "/prefix/", "image")
+	require.NoError(t, err)
+	s3Ref, ok := ref.(s3Reference)
+	require.True(t, ok)
+	assert.Equal(t, s3Reference{bucket: "bucket", prefix: "prefix", image: "image"}, s3Ref)
+
+	for _, c := range []struct{ bucket, prefix, image string }{
+		{"", "prefix", ""},
+		{"a/b", "prefix", ""},
+		{"a:b", "prefix", ""},
+		{"bucket", "a:b", ""},
+		{"bucket", ".", ""},
+		{"bucket", "prefix", "@invalid"},
+	} {
+		_, err := NewReference(c.bucket, c.prefix, c.image)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestReferenceTransport(t *testing.T) {
+	ref, err := NewReference("bucket", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, Transport, ref.Transport())
+}
+
+func TestReferenceStringWithinTransport(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{"//bucket", "//bucket:"},
+		{"//bucket/prefix/:image", "//bucket/prefix:image"},
+	} {
+		ref, err := Transport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		stringRef := ref.StringWithinTransport()
+		assert.Equal(t, c.expected, stringRef, c.input)
+		// Do one more round to verify that the output can be parsed, to an equal value.
+		ref2, err := Transport.ParseReference(stringRef)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, ref, ref2, c.input)
+	}
+}
+
+func TestReferenceDockerReference(t *testing.T) {
+	ref, err := NewReference("bucket", "prefix", "image")
+	require.NoError(t, err)
+	assert.Nil(t, ref.DockerReference())
+}
+
+func TestReferencePolicyConfigurationIdentity(t *testing.T) {
+	ref, err := NewReference("bucket", "a/b", "image")
+	require.NoError(t, err)
+	assert.Equal(t, "bucket/a/b", ref.PolicyConfigurationIdentity())
+	ref, err = NewReference("bucket", "", "image")
+	require.NoError(t, err)
+	assert.Equal(t, "bucket", ref.PolicyConfigurationIdentity())
+}
+
+func TestReferencePolicyConfigurationNamespaces(t *testing.T) {
+	ref, err := NewReference("bucket", "a/b", "image")
+	require.NoError(t, err)
+	ns := ref.PolicyConfigurationNamespaces()
+	assert.Equal(t, []string{"bucket/a", "bucket"}, ns)
+	for _, n := range ns {
+		assert.NoError(t, Transport.ValidatePolicyConfigurationScope(n), n)
+	}
+
+	ref, err = NewReference("bucket", "", "image")
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, ref.PolicyConfigurationNamespaces())
+}
+
+func TestReferenceDeleteImage(t *testing.T) {
+	ref, err := NewReference("bucket", "prefix", "")
+	require.NoError(t, err)
+	err = ref.DeleteImage(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+func TestReferenceKeys(t *testing.T) {
+	ref, err := NewReference("bucket", "a/b", "")
+	require.NoError(t, err)
+	s3Ref, ok := ref.(s3Reference)
+	require.True(t, ok)
+	assert.Equal(t, "a/b/index.json", s3Ref.indexKey())
+	assert.Equal(t, "a/b/oci-layout", s3Ref.ociLayoutKey())
+	key, err := s3Ref.blobKey("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "a/b/blobs/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", key)
+	_, err = s3Ref.blobKey("sha256:../../../etc/passwd")
+	assert.Error(t, err)
+
+	ref, err = NewReference("bucket", "", "")
+	require.NoError(t, err)
+	s3Ref, ok = ref.(s3Reference)
+	require.True(t, ok)
+	assert.Equal(t, "index.json", s3Ref.indexKey())
+}
@@ -111,6 +111,12 @@ func (d *openshiftImageDestination) SupportsPutBlobPartial() bool {
 	return d.docker.SupportsPutBlobPartial()
 }
 
+// AcceptsNonImageArtifacts returns true if the destination can store manifests whose config is not an image configuration
+// (e.g. OCI artifacts like Helm charts), verbatim.
+func (d *openshiftImageDestination) AcceptsNonImageArtifacts() bool {
+	return d.docker.AcceptsNonImageArtifacts()
+}
+
 // PutBlobWithOptions writes contents of stream and returns data representing the result.
 // inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
 // inputInfo.Size is the expected length of stream, if known.
@@ -33,6 +33,7 @@ import (
 	"github.com/containers/storage/pkg/fileutils"
 	"github.com/klauspost/pgzip"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	selinux "github.com/opencontainers/selinux/go-selinux"
 	"github.com/ostreedev/ostree-go/pkg/otbuiltin"
 	"github.com/vbatts/tar-split/tar/asm"
@@ -94,7 +95,8 @@ func newImageDestination(ref ostreeReference, tmpDirPath string) (private.ImageD
 	}
 	d := &ostreeImageDestination{
 		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
-			SupportedManifestMIMETypes:     []string{manifest.DockerV2Schema2MediaType},
+			// OCI manifests are accepted because Docker schema2 can’t represent zstd-compressed layers.
+			SupportedManifestMIMETypes:     []string{manifest.DockerV2Schema2MediaType, imgspecv1.MediaTypeImageManifest},
 			DesiredLayerCompression:        types.PreserveOriginal,
 			AcceptsForeignLayerURLs:        false,
 			MustMatchRuntimeOS:             true,
@@ -307,7 +309,7 @@ func (d *ostreeImageDestination) importBlob(selinuxHnd *C.struct_selabel_handle,
 		}
 	} else {
 		os.MkdirAll(destinationPath, 0755)
-		if err := exec.Command("tar", "-C", destinationPath, "--no-same-owner", "--no-same-permissions", "--delay-directory-restore", "-xf", blob.BlobPath).Run(); err != nil {
+		if err := untarUsermode(blob.BlobPath, destinationPath); err != nil {
 			return err
 		}
 
@@ -322,6 +324,27 @@ func (d *ostreeImageDestination) importBlob(selinuxHnd *C.struct_selabel_handle,
 
 }
 
+// untarUsermode extracts the layer at blobPath, which may be compressed, into destinationPath using tar(1), without preserving ownership.
+// The layer is decompressed here, so that this works for all compression algorithms we support (notably zstd),
+// not only those tar(1) recognizes.
+func untarUsermode(blobPath, destinationPath string) error {
+	stream, err := os.Open(blobPath)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	uncompressed, err := archive.DecompressStream(stream)
+	if err != nil {
+		return err
+	}
+	defer uncompressed.Close()
+
+	cmd := exec.Command("tar", "-C", destinationPath, "--no-same-owner", "--no-same-permissions", "--delay-directory-restore", "-xf", "-")
+	cmd.Stdin = uncompressed
+	return cmd.Run()
+}
+
 func (d *ostreeImageDestination) importConfig(repo *otbuiltin.Repo, blob *blobToImport) error {
 	ostreeBranch := fmt.Sprintf("ociimage/%s", blob.Digest.Encoded())
 	destinationPath := filepath.Dir(blob.BlobPath)
@@ -2,6 +2,7 @@
 package boltdb
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -28,6 +29,13 @@ var (
 	// digestCompressorBucket stores a mapping from any digest to a compressor, or blobinfocache.Uncompressed (not blobinfocache.UnknownCompression).
 	// It may not exist in caches created by older versions, even if uncompressedDigestBucket is present.
 	digestCompressorBucket = []byte("digestCompressor")
+	// digestSpecificVariantCompressorBucket stores a mapping from any digest to a JSON-encoded specificVariantCompressor value,
+	// for digests with a non-base compression variant (e.g. zstd:chunked) recorded in digestCompressorBucket.
+	// It may not exist in caches created by older versions.
+	digestSpecificVariantCompressorBucket = []byte("digestSpecificVariantCompressor")
+	// uncompressedDigestByTOCBucket stores a mapping from a TOC digest to an uncompressed digest.
+	// It may not exist in caches created by older versions.
+	uncompressedDigestByTOCBucket = []byte("uncompressedDigestByTOC")
 	// digestByUncompressedBucket stores a bucket per uncompressed digest, with the bucket containing a set of digests for that uncompressed digest
 	// (as a set of key=digest, value="" pairs)
 	digestByUncompressedBucket = []byte("digestByUncompressed")
@@ -36,6 +44,12 @@ var (
 	knownLocationsBucket = []byte("knownLocations")
 )
 
+// specificVariantCompressor is the value stored in digestSpecificVariantCompressorBucket.
+type specificVariantCompressor struct {
+	Compressor  string            `json:"compressor"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
 // Concurrency:
 // See https://www.sqlite.org/src/artifact/c230a7a24?ln=994-1081 for all the issues with locks, which make it extremely
 // difficult to use a single BoltDB file from multiple threads/goroutines inside a process.  So, we punt and only allow one at a time.
@@ -243,27 +257,100 @@ func (bdc *cache) RecordDigestUncompressedPair(anyDigest digest.Digest, uncompre
 	}) // FIXME? Log error (but throttle the log volume on repeated accesses)?
 }
 
-// RecordDigestCompressorName records that the blob with digest anyDigest was compressed with the specified
-// compressor, or is blobinfocache.Uncompressed.
+// UncompressedDigestForTOC returns an uncompressed digest corresponding to tocDigest.
+// Returns "" if the uncompressed digest is unknown.
+func (bdc *cache) UncompressedDigestForTOC(tocDigest digest.Digest) digest.Digest {
+	var res digest.Digest
+	if err := bdc.view(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(uncompressedDigestByTOCBucket); b != nil {
+			if uncompressedBytes := b.Get([]byte(tocDigest.String())); uncompressedBytes != nil {
+				d, err := digest.Parse(string(uncompressedBytes))
+				if err != nil {
+					return err
+				}
+				res = d
+			}
+		}
+		return nil
+	}); err != nil { // Including os.IsNotExist(err)
+		return "" // FIXME? Log err (but throttle the log volume on repeated accesses)?
+	}
+	return res
+}
+
+// RecordTOCUncompressedPair records that the tocDigest corresponds to uncompressed.
 // WARNING: Only call this for LOCALLY VERIFIED data; don’t record a digest pair just because some remote author claims so (e.g.
 // because a manifest/config pair exists); otherwise the cache could be poisoned and allow substituting unexpected blobs.
 // (Eventually, the DiffIDs in image config could detect the substitution, but that may be too late, and not all image formats contain that data.)
-func (bdc *cache) RecordDigestCompressorName(anyDigest digest.Digest, compressorName string) {
+func (bdc *cache) RecordTOCUncompressedPair(tocDigest digest.Digest, uncompressed digest.Digest) {
+	_ = bdc.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(uncompressedDigestByTOCBucket)
+		if err != nil {
+			return err
+		}
+		key := []byte(tocDigest.String())
+		if previousBytes := b.Get(key); previousBytes != nil {
+			if string(previousBytes) != uncompressed.String() {
+				logrus.Warnf("Uncompressed digest for blob with TOC %q previously recorded as %q, now %q", tocDigest, string(previousBytes), uncompressed)
+			}
+		}
+		return b.Put(key, []byte(uncompressed.String()))
+	}) // FIXME? Log error (but throttle the log volume on repeated accesses)?
+}
+
+// RecordDigestCompressorData records data for the blob with the specified digest.
+// WARNING: Only call this with LOCALLY VERIFIED data:
+//   - don’t record a compressor for a digest just because some remote author claims so
+//     (e.g. because a manifest says so);
+//   - don’t record the non-base variant or annotations if we are not _sure_ that the base variant
+//     and the blob’s digest match the non-base variant’s annotations (e.g. because we saw them
+//     in a manifest)
+//
+// otherwise the cache could be poisoned and cause us to make incorrect edits to type
+// information in a manifest.
+func (bdc *cache) RecordDigestCompressorData(anyDigest digest.Digest, data blobinfocache.DigestCompressorData) {
 	_ = bdc.update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists(digestCompressorBucket)
 		if err != nil {
 			return err
 		}
+		specificVariantBucket, err := tx.CreateBucketIfNotExists(digestSpecificVariantCompressorBucket)
+		if err != nil {
+			return err
+		}
 		key := []byte(anyDigest.String())
 		if previousBytes := b.Get(key); previousBytes != nil {
-			if string(previousBytes) != compressorName {
-				logrus.Warnf("Compressor for blob with digest %s previously recorded as %s, now %s", anyDigest, string(previousBytes), compressorName)
+			if string(previousBytes) != data.BaseVariantCompressor {
+				logrus.Warnf("Base compressor for blob with digest %s previously recorded as %s, now %s", anyDigest, string(previousBytes), data.BaseVariantCompressor)
+				// The previous specific variant does not match the new base variant
+				if err := specificVariantBucket.Delete(key); err != nil {
+					return err
+				}
 			}
 		}
-		if compressorName == blobinfocache.UnknownCompression {
+		if data.BaseVariantCompressor == blobinfocache.UnknownCompression {
+			if err := specificVariantBucket.Delete(key); err != nil {
+				return err
+			}
 			return b.Delete(key)
 		}
-		return b.Put(key, []byte(compressorName))
+		if err := b.Put(key, []byte(data.BaseVariantCompressor)); err != nil {
+			return err
+		}
+		if data.SpecificVariantCompressor != "" && data.SpecificVariantCompressor != blobinfocache.UnknownCompression &&
+			data.BaseVariantCompressor != blobinfocache.Uncompressed {
+			value, err := json.Marshal(specificVariantCompressor{
+				Compressor:  data.SpecificVariantCompressor,
+				Annotations: data.SpecificVariantAnnotations,
+			})
+			if err != nil {
+				return err
+			}
+			if err := specificVariantBucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
 	}) // FIXME? Log error (but throttle the log volume on repeated accesses)?
 }
 
@@ -300,22 +387,34 @@ func (bdc *cache) RecordKnownLocation(transport types.ImageTransport, scope type
 
 // appendReplacementCandidates creates prioritize.CandidateWithTime values for digest in scopeBucket
 // (which might be nil) with corresponding compression
-// info from compressionBucket (which might be nil), and returns the result of appending them
+// info from compressionBucket and specificVariantCompressionBucket (which might be nil), and returns the result of appending them
 // to candidates.
 // v2Options is not nil if the caller is CandidateLocations2: this allows including candidates with unknown location, and filters out candidates
 // with unknown compression.
-func (bdc *cache) appendReplacementCandidates(candidates []prioritize.CandidateWithTime, scopeBucket, compressionBucket *bolt.Bucket, digest digest.Digest,
-	v2Options *blobinfocache.CandidateLocations2Options) []prioritize.CandidateWithTime {
+func (bdc *cache) appendReplacementCandidates(candidates []prioritize.CandidateWithTime, scopeBucket, compressionBucket, specificVariantCompressionBucket *bolt.Bucket,
+	digest digest.Digest, v2Options *blobinfocache.CandidateLocations2Options) []prioritize.CandidateWithTime {
 	digestKey := []byte(digest.String())
-	compressorName := blobinfocache.UnknownCompression
+	compressorData := blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     blobinfocache.UnknownCompression,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	}
 	if compressionBucket != nil {
 		// the bucket won't exist if the cache was created by a v1 implementation and
 		// hasn't yet been updated by a v2 implementation
 		if compressorNameValue := compressionBucket.Get(digestKey); len(compressorNameValue) > 0 {
-			compressorName = string(compressorNameValue)
+			compressorData.BaseVariantCompressor = string(compressorNameValue)
+		}
+	}
+	if specificVariantCompressionBucket != nil {
+		if value := specificVariantCompressionBucket.Get(digestKey); len(value) > 0 {
+			var sv specificVariantCompressor
+			if err := json.Unmarshal(value, &sv); err == nil { // FIXME? Log error (but throttle the log volume on repeated accesses)?
+				compressorData.SpecificVariantCompressor = sv.Compressor
+				compressorData.SpecificVariantAnnotations = sv.Annotations
+			}
 		}
 	}
-	ok, compressionOp, compressionAlgo := prioritize.CandidateCompression(v2Options, digest, compressorName)
+	ok, compressionOp, compressionAlgo, compressionAnnotations := prioritize.CandidateCompression(v2Options, digest, compressorData)
 	if !ok {
 		return candidates
 	}
@@ -332,10 +431,11 @@ func (bdc *cache) appendReplacementCandidates(candidates []prioritize.CandidateW
 			}
 			candidates = append(candidates, prioritize.CandidateWithTime{
 				Candidate: blobinfocache.BICReplacementCandidate2{
-					Digest:               digest,
-					CompressionOperation: compressionOp,
-					CompressionAlgorithm: compressionAlgo,
-					Location:             types.BICLocationReference{Opaque: string(k)},
+					Digest:                 digest,
+					CompressionOperation:   compressionOp,
+					CompressionAlgorithm:   compressionAlgo,
+					CompressionAnnotations: compressionAnnotations,
+					Location:               types.BICLocationReference{Opaque: string(k)},
 				},
 				LastSeen: t,
 			})
@@ -344,11 +444,12 @@ func (bdc *cache) appendReplacementCandidates(candidates []prioritize.CandidateW
 	} else if v2Options != nil {
 		candidates = append(candidates, prioritize.CandidateWithTime{
 			Candidate: blobinfocache.BICReplacementCandidate2{
-				Digest:               digest,
-				CompressionOperation: compressionOp,
-				CompressionAlgorithm: compressionAlgo,
-				UnknownLocation:      true,
-				Location:             types.BICLocationReference{Opaque: ""},
+				Digest:                 digest,
+				CompressionOperation:   compressionOp,
+				CompressionAlgorithm:   compressionAlgo,
+				CompressionAnnotations: compressionAnnotations,
+				UnknownLocation:        true,
+				Location:               types.BICLocationReference{Opaque: ""},
 			},
 			LastSeen: time.Time{},
 		})
@@ -380,8 +481,9 @@ func (bdc *cache) candidateLocations(transport types.ImageTransport, scope types
 		// compressionBucket won't have been created if previous writers never recorded info about compression,
 		// and we don't want to fail just because of that
 		compressionBucket := tx.Bucket(digestCompressorBucket)
+		specificVariantCompressionBucket := tx.Bucket(digestSpecificVariantCompressorBucket)
 
-		res = bdc.appendReplacementCandidates(res, scopeBucket, compressionBucket, primaryDigest, v2Options)
+		res = bdc.appendReplacementCandidates(res, scopeBucket, compressionBucket, specificVariantCompressionBucket, primaryDigest, v2Options)
 		if canSubstitute {
 			if uncompressedDigestValue = bdc.uncompressedDigest(tx, primaryDigest); uncompressedDigestValue != "" {
 				b := tx.Bucket(digestByUncompressedBucket)
@@ -394,7 +496,7 @@ func (bdc *cache) candidateLocations(transport types.ImageTransport, scope types
 								return err
 							}
 							if d != primaryDigest && d != uncompressedDigestValue {
-								res = bdc.appendReplacementCandidates(res, scopeBucket, compressionBucket, d, v2Options)
+								res = bdc.appendReplacementCandidates(res, scopeBucket, compressionBucket, specificVariantCompressionBucket, d, v2Options)
 							}
 							return nil
 						}); err != nil {
@@ -403,7 +505,7 @@ func (bdc *cache) candidateLocations(transport types.ImageTransport, scope types
 					}
 				}
 				if uncompressedDigestValue != primaryDigest {
-					res = bdc.appendReplacementCandidates(res, scopeBucket, compressionBucket, uncompressedDigestValue, v2Options)
+					res = bdc.appendReplacementCandidates(res, scopeBucket, compressionBucket, specificVariantCompressionBucket, uncompressedDigestValue, v2Options)
 				}
 			}
 		}
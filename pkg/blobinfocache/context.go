@@ -0,0 +1,86 @@
+package blobinfocache
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// ToBlobInfoCache3 returns a types.BlobInfoCache3 which uses cache.
+// The contexts passed to the returned object are ignored, and its operations never fail.
+func ToBlobInfoCache3(cache types.BlobInfoCache) types.BlobInfoCache3 {
+	if v1, ok := cache.(*v3AsV1Cache); ok {
+		return v1.cache
+	}
+	return &v1AsV3Cache{cache: cache}
+}
+
+// v1AsV3Cache is a types.BlobInfoCache3 which uses a types.BlobInfoCache.
+type v1AsV3Cache struct {
+	cache types.BlobInfoCache
+}
+
+func (bic *v1AsV3Cache) UncompressedDigest(ctx context.Context, anyDigest digest.Digest) (digest.Digest, error) {
+	return bic.cache.UncompressedDigest(anyDigest), nil
+}
+
+func (bic *v1AsV3Cache) RecordDigestUncompressedPair(ctx context.Context, anyDigest digest.Digest, uncompressed digest.Digest) error {
+	bic.cache.RecordDigestUncompressedPair(anyDigest, uncompressed)
+	return nil
+}
+
+func (bic *v1AsV3Cache) RecordKnownLocation(ctx context.Context, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, location types.BICLocationReference) error {
+	bic.cache.RecordKnownLocation(transport, scope, digest, location)
+	return nil
+}
+
+func (bic *v1AsV3Cache) CandidateLocations(ctx context.Context, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, canSubstitute bool) ([]types.BICReplacementCandidate, error) {
+	return bic.cache.CandidateLocations(transport, scope, digest, canSubstitute), nil
+}
+
+// FromBlobInfoCache3 returns a types.BlobInfoCache which uses cache, e.g. to use it in copy.Options.
+// The returned object calls cache using context.Background(), so cache should enforce its own time limits;
+// failures are logged, and otherwise treated as if the data were not present.
+func FromBlobInfoCache3(cache types.BlobInfoCache3) types.BlobInfoCache {
+	if v3, ok := cache.(*v1AsV3Cache); ok {
+		return v3.cache
+	}
+	return &v3AsV1Cache{cache: cache}
+}
+
+// v3AsV1Cache is a types.BlobInfoCache which uses a types.BlobInfoCache3.
+type v3AsV1Cache struct {
+	cache types.BlobInfoCache3
+}
+
+func (bic *v3AsV1Cache) UncompressedDigest(anyDigest digest.Digest) digest.Digest {
+	res, err := bic.cache.UncompressedDigest(context.Background(), anyDigest)
+	if err != nil {
+		logrus.Debugf("Error looking up uncompressed digest of %s in blob info cache: %v", anyDigest, err)
+		return ""
+	}
+	return res
+}
+
+func (bic *v3AsV1Cache) RecordDigestUncompressedPair(anyDigest digest.Digest, uncompressed digest.Digest) {
+	if err := bic.cache.RecordDigestUncompressedPair(context.Background(), anyDigest, uncompressed); err != nil {
+		logrus.Debugf("Error recording uncompressed digest %s of %s in blob info cache: %v", uncompressed, anyDigest, err)
+	}
+}
+
+func (bic *v3AsV1Cache) RecordKnownLocation(transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, location types.BICLocationReference) {
+	if err := bic.cache.RecordKnownLocation(context.Background(), transport, scope, digest, location); err != nil {
+		logrus.Debugf("Error recording location of %s in blob info cache: %v", digest, err)
+	}
+}
+
+func (bic *v3AsV1Cache) CandidateLocations(transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, canSubstitute bool) []types.BICReplacementCandidate {
+	res, err := bic.cache.CandidateLocations(context.Background(), transport, scope, digest, canSubstitute)
+	if err != nil {
+		logrus.Debugf("Error looking up candidate locations of %s in blob info cache: %v", digest, err)
+		return []types.BICReplacementCandidate{}
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package blobinfocache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingCache is a types.BlobInfoCache3 which fails all operations.
+type failingCache struct{}
+
+var errFailingCache = errors.New("failingCache failure")
+
+func (failingCache) UncompressedDigest(ctx context.Context, anyDigest digest.Digest) (digest.Digest, error) {
+	return "", errFailingCache
+}
+
+func (failingCache) RecordDigestUncompressedPair(ctx context.Context, anyDigest digest.Digest, uncompressed digest.Digest) error {
+	return errFailingCache
+}
+
+func (failingCache) RecordKnownLocation(ctx context.Context, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, location types.BICLocationReference) error {
+	return errFailingCache
+}
+
+func (failingCache) CandidateLocations(ctx context.Context, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, canSubstitute bool) ([]types.BICReplacementCandidate, error) {
+	return nil, errFailingCache
+}
+
+func TestToBlobInfoCache3(t *testing.T) {
+	ctx := context.Background()
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	compressed := digest.FromString("compressed")
+	uncompressed := digest.FromString("uncompressed")
+
+	v1 := memory.New()
+	v3 := ToBlobInfoCache3(v1)
+	err := v3.RecordDigestUncompressedPair(ctx, compressed, uncompressed)
+	require.NoError(t, err)
+	err = v3.RecordKnownLocation(ctx, transport, scope, compressed, types.BICLocationReference{Opaque: "location"})
+	require.NoError(t, err)
+	res, err := v3.UncompressedDigest(ctx, compressed)
+	require.NoError(t, err)
+	assert.Equal(t, uncompressed, res)
+	candidates, err := v3.CandidateLocations(ctx, transport, scope, compressed, false)
+	require.NoError(t, err)
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: compressed, Location: types.BICLocationReference{Opaque: "location"}}}, candidates)
+	// The data is visible through the original object.
+	assert.Equal(t, uncompressed, v1.UncompressedDigest(compressed))
+
+	// Converting back returns the original object.
+	assert.Same(t, v1, FromBlobInfoCache3(v3))
+}
+
+func TestFromBlobInfoCache3(t *testing.T) {
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	d := digest.FromString("blob")
+
+	v3 := failingCache{}
+	v1 := FromBlobInfoCache3(v3)
+	// Failures are treated as missing data.
+	assert.Equal(t, digest.Digest(""), v1.UncompressedDigest(d))
+	assert.Empty(t, v1.CandidateLocations(transport, scope, d, true))
+	// Recording does not panic
+	v1.RecordDigestUncompressedPair(d, d)
+	v1.RecordKnownLocation(transport, scope, d, types.BICLocationReference{Opaque: "location"})
+
+	// Converting back returns the original object.
+	assert.Equal(t, v3, ToBlobInfoCache3(v1))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/pkg/blobinfocache/sqlite"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
@@ -132,3 +133,16 @@ func TestDefaultCache(t *testing.T) {
 	c = DefaultCache(&types.SystemContext{BlobInfoCacheDir: filepath.Join(unwritableDir, "subdirectory")})
 	assert.IsType(t, memory.New(), c)
 }
+
+func TestPrune(t *testing.T) {
+	// The various implementations are tested in their subpackages; just test the wrapper.
+	cache := memory.New()
+	err := Prune(cache, PruneOptions{MaxLocations: 10})
+	assert.NoError(t, err)
+	err = Prune(cache, PruneOptions{MaxLocations: -1})
+	assert.Error(t, err)
+	err = Prune(cache, PruneOptions{MaxLocationAge: -1})
+	assert.Error(t, err)
+	err = Prune(none.NoCache, PruneOptions{MaxLocations: 10})
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ package prioritize
 
 import (
 	"cmp"
+	"maps"
 	"slices"
 	"time"
 
@@ -25,34 +26,55 @@ const replacementAttempts = 5
 // This is a heuristic/guess, and could well use a different value.
 const replacementUnknownLocationAttempts = 2
 
-// CandidateCompression returns (true, compressionOp, compressionAlgo) if a blob
-// with compressionName (which can be Uncompressed or UnknownCompression) is acceptable for a CandidateLocations* call with v2Options.
+// CandidateCompression returns (true, compressionOp, compressionAlgo, compressionAnnotations) if a blob
+// with data is acceptable for a CandidateLocations* call with v2Options.
 //
 // v2Options can be set to nil if the call is CandidateLocations (i.e. compression is not required to be known);
 // if not nil, the call is assumed to be CandidateLocations2.
 //
-// The (compressionOp, compressionAlgo) values are suitable for BICReplacementCandidate2
-func CandidateCompression(v2Options *blobinfocache.CandidateLocations2Options, digest digest.Digest, compressorName string) (bool, types.LayerCompression, *compression.Algorithm) {
+// The (compressionOp, compressionAlgo, compressionAnnotations) values are suitable for BICReplacementCandidate2
+func CandidateCompression(v2Options *blobinfocache.CandidateLocations2Options, digest digest.Digest, data blobinfocache.DigestCompressorData) (bool, types.LayerCompression, *compression.Algorithm, map[string]string) {
 	if v2Options == nil {
-		return true, types.PreserveOriginal, nil // Anything goes. The (compressionOp, compressionAlgo) values are not used.
+		return true, types.PreserveOriginal, nil, nil // Anything goes. The (compressionOp, compressionAlgo, compressionAnnotations) values are not used.
+	}
+
+	requiredCompression := "nil"
+	if v2Options.RequiredCompression != nil {
+		requiredCompression = v2Options.RequiredCompression.Name()
+	}
+	// If the specific variant is known, and acceptable, prefer it: it may carry more data (e.g. a zstd:chunked TOC).
+	if data.SpecificVariantCompressor != "" && data.SpecificVariantCompressor != blobinfocache.UnknownCompression {
+		algo, err := compression.AlgorithmByName(data.SpecificVariantCompressor)
+		if err != nil {
+			logrus.Debugf("Not considering unrecognized specific compression variant %q for BlobInfoCache record of digest %q: %v",
+				data.SpecificVariantCompressor, digest.String(), err)
+		} else if !manifest.CandidateCompressionMatchesReuseConditions(manifest.ReuseConditions{
+			PossibleManifestFormats: v2Options.PossibleManifestFormats,
+			RequiredCompression:     v2Options.RequiredCompression,
+		}, &algo) {
+			logrus.Debugf("Ignoring specific compression variant %q for BlobInfoCache record of digest %q, it does not match required %s or MIME types %#v",
+				data.SpecificVariantCompressor, digest.String(), requiredCompression, v2Options.PossibleManifestFormats)
+		} else {
+			return true, types.Compress, &algo, maps.Clone(data.SpecificVariantAnnotations)
+		}
 	}
 
 	var op types.LayerCompression
 	var algo *compression.Algorithm
-	switch compressorName {
+	switch data.BaseVariantCompressor {
 	case blobinfocache.Uncompressed:
 		op = types.Decompress
 		algo = nil
 	case blobinfocache.UnknownCompression:
 		logrus.Debugf("Ignoring BlobInfoCache record of digest %q with unknown compression", digest.String())
-		return false, types.PreserveOriginal, nil // Not allowed with CandidateLocations2
+		return false, types.PreserveOriginal, nil, nil // Not allowed with CandidateLocations2
 	default:
 		op = types.Compress
-		algo_, err := compression.AlgorithmByName(compressorName)
+		algo_, err := compression.AlgorithmByName(data.BaseVariantCompressor)
 		if err != nil {
 			logrus.Debugf("Ignoring BlobInfoCache record of digest %q with unrecognized compression %q: %v",
-				digest.String(), compressorName, err)
-			return false, types.PreserveOriginal, nil // The BICReplacementCandidate2.CompressionAlgorithm field is required
+				digest.String(), data.BaseVariantCompressor, err)
+			return false, types.PreserveOriginal, nil, nil // The BICReplacementCandidate2.CompressionAlgorithm field is required
 		}
 		algo = &algo_
 	}
@@ -60,16 +82,12 @@ func CandidateCompression(v2Options *blobinfocache.CandidateLocations2Options, d
 		PossibleManifestFormats: v2Options.PossibleManifestFormats,
 		RequiredCompression:     v2Options.RequiredCompression,
 	}, algo) {
-		requiredCompresssion := "nil"
-		if v2Options.RequiredCompression != nil {
-			requiredCompresssion = v2Options.RequiredCompression.Name()
-		}
 		logrus.Debugf("Ignoring BlobInfoCache record of digest %q, compression %q does not match required %s or MIME types %#v",
-			digest.String(), compressorName, requiredCompresssion, v2Options.PossibleManifestFormats)
-		return false, types.PreserveOriginal, nil
+			digest.String(), data.BaseVariantCompressor, requiredCompression, v2Options.PossibleManifestFormats)
+		return false, types.PreserveOriginal, nil, nil
 	}
 
-	return true, op, algo
+	return true, op, algo, nil
 }
 
 // CandidateWithTime is the input to types.BICReplacementCandidate prioritization.
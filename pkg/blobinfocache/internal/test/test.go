@@ -3,6 +3,7 @@ package test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/internal/blobinfocache"
 	"github.com/containers/image/v5/internal/testing/mocks"
@@ -32,6 +33,9 @@ const (
 	digestGzip                  = digest.Digest("sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
 	digestZstd                  = digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc")
 	digestZstdChunked           = digest.Digest("sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd")
+
+	tocDigestA = digest.Digest("sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")
+	tocDigestB = digest.Digest("sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
 )
 
 // GenericCache runs an implementation-independent set of tests, given a
@@ -46,6 +50,8 @@ func GenericCache(t *testing.T, newTestCache func(t *testing.T) blobinfocache.Bl
 		{"RecordKnownLocations", testGenericRecordKnownLocations},
 		{"CandidateLocations", testGenericCandidateLocations},
 		{"CandidateLocations2", testGenericCandidateLocations2},
+		{"UncompressedDigestForTOC", testGenericUncompressedDigestForTOC},
+		{"RecordDigestCompressorData", testGenericRecordDigestCompressorData},
 	}
 
 	// Without Open()/Close()
@@ -122,6 +128,117 @@ func testGenericRecordKnownLocations(t *testing.T, cache blobinfocache.BlobInfoC
 	}
 }
 
+func testGenericUncompressedDigestForTOC(t *testing.T, cache blobinfocache.BlobInfoCache2) {
+	// Nothing is known.
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigestForTOC(tocDigestA))
+
+	for i := 0; i < 2; i++ { // Record the same data twice to ensure redundant writes don’t break things.
+		cache.RecordTOCUncompressedPair(tocDigestA, digestUncompressed)
+		cache.RecordTOCUncompressedPair(tocDigestB, digestCompressedUnrelated)
+		assert.Equal(t, digestUncompressed, cache.UncompressedDigestForTOC(tocDigestA))
+		assert.Equal(t, digestCompressedUnrelated, cache.UncompressedDigestForTOC(tocDigestB))
+	}
+	// TOC digests and blob digests are separate namespaces.
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigest(tocDigestA))
+	cache.RecordDigestUncompressedPair(digestCompressedA, digestUncompressed)
+	assert.Equal(t, digest.Digest(""), cache.UncompressedDigestForTOC(digestCompressedA))
+
+	// A newer record replaces an older one.
+	cache.RecordTOCUncompressedPair(tocDigestA, digestCompressedUnrelated)
+	assert.Equal(t, digestCompressedUnrelated, cache.UncompressedDigestForTOC(tocDigestA))
+}
+
+func testGenericRecordDigestCompressorData(t *testing.T, cache blobinfocache.BlobInfoCache2) {
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "A"}
+	cache.RecordKnownLocation(transport, scope, digestCompressedA, types.BICLocationReference{Opaque: "A1"})
+	lookup := func(requiredCompression *compressiontypes.Algorithm) []blobinfocache.BICReplacementCandidate2 {
+		return cache.CandidateLocations2(transport, scope, digestCompressedA, blobinfocache.CandidateLocations2Options{
+			CanSubstitute:       false,
+			RequiredCompression: requiredCompression,
+		})
+	}
+	chunkedAnnotations := map[string]string{"ann-A": "value-A"}
+
+	// Only the base variant is known
+	cache.RecordDigestCompressorData(digestCompressedA, blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     compressiontypes.ZstdAlgorithmName,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	})
+	assertCandidatesMatch2Native(t, []blobinfocache.BICReplacementCandidate2{
+		{Digest: digestCompressedA, CompressionOperation: types.Compress, CompressionAlgorithm: &compression.Zstd, Location: types.BICLocationReference{Opaque: "A1"}},
+	}, lookup(nil))
+	assert.Empty(t, lookup(&compression.ZstdChunked))
+
+	// The specific variant, with annotations, is preferred when it is acceptable
+	for i := 0; i < 2; i++ { // Record the same data twice to ensure redundant writes don’t break things.
+		cache.RecordDigestCompressorData(digestCompressedA, blobinfocache.DigestCompressorData{
+			BaseVariantCompressor:      compressiontypes.ZstdAlgorithmName,
+			SpecificVariantCompressor:  compressiontypes.ZstdChunkedAlgorithmName,
+			SpecificVariantAnnotations: chunkedAnnotations,
+		})
+		for _, required := range []*compressiontypes.Algorithm{nil, &compression.Zstd, &compression.ZstdChunked} {
+			assertCandidatesMatch2Native(t, []blobinfocache.BICReplacementCandidate2{
+				{Digest: digestCompressedA, CompressionOperation: types.Compress, CompressionAlgorithm: &compression.ZstdChunked,
+					CompressionAnnotations: chunkedAnnotations, Location: types.BICLocationReference{Opaque: "A1"}},
+			}, lookup(required))
+		}
+	}
+
+	// Recording only the base variant again does not lose the specific variant data
+	cache.RecordDigestCompressorData(digestCompressedA, blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     compressiontypes.ZstdAlgorithmName,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	})
+	assertCandidatesMatch2Native(t, []blobinfocache.BICReplacementCandidate2{
+		{Digest: digestCompressedA, CompressionOperation: types.Compress, CompressionAlgorithm: &compression.ZstdChunked,
+			CompressionAnnotations: chunkedAnnotations, Location: types.BICLocationReference{Opaque: "A1"}},
+	}, lookup(&compression.ZstdChunked))
+
+	// Changing the base variant discards the specific variant data.
+	// This probably triggers “Compressor for blob with digest … previously recorded as …, now …” warnings here, for test purposes;
+	// that shouldn’t happen in real-world usage.
+	cache.RecordDigestCompressorData(digestCompressedA, blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     compressiontypes.GzipAlgorithmName,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	})
+	assertCandidatesMatch2Native(t, []blobinfocache.BICReplacementCandidate2{
+		{Digest: digestCompressedA, CompressionOperation: types.Compress, CompressionAlgorithm: &compression.Gzip, Location: types.BICLocationReference{Opaque: "A1"}},
+	}, lookup(nil))
+	assert.Empty(t, lookup(&compression.ZstdChunked))
+
+	// Forgetting the compression
+	cache.RecordDigestCompressorData(digestCompressedA, blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     blobinfocache.UnknownCompression,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	})
+	assert.Empty(t, lookup(nil))
+}
+
+// compressorDataForName returns the blobinfocache.DigestCompressorData tests record for a compressor name,
+// which may be a base variant, a non-base variant, or Uncompressed or UnknownCompression.
+func compressorDataForName(t *testing.T, name string) blobinfocache.DigestCompressorData {
+	if name == blobinfocache.Uncompressed || name == blobinfocache.UnknownCompression {
+		return blobinfocache.DigestCompressorData{
+			BaseVariantCompressor:     name,
+			SpecificVariantCompressor: blobinfocache.UnknownCompression,
+		}
+	}
+	algo, err := compression.AlgorithmByName(name)
+	require.NoError(t, err)
+	if algo.BaseVariantName() == algo.Name() {
+		return blobinfocache.DigestCompressorData{
+			BaseVariantCompressor:     name,
+			SpecificVariantCompressor: blobinfocache.UnknownCompression,
+		}
+	}
+	return blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:      algo.BaseVariantName(),
+		SpecificVariantCompressor:  name,
+		SpecificVariantAnnotations: map[string]string{"annotation-" + name: "value"},
+	}
+}
+
 // candidate is a shorthand for types.BICReplacementCandidate
 type candidate struct {
 	d  digest.Digest
@@ -170,11 +287,12 @@ func assertCandidatesMatch2(t *testing.T, scopeName string, expected []candidate
 			algo = &algo_
 		}
 		e[i] = blobinfocache.BICReplacementCandidate2{
-			Digest:               ev.d,
-			CompressionOperation: op,
-			CompressionAlgorithm: algo,
-			UnknownLocation:      false,
-			Location:             types.BICLocationReference{Opaque: scopeName + ev.lr},
+			Digest:                 ev.d,
+			CompressionOperation:   op,
+			CompressionAlgorithm:   algo,
+			CompressionAnnotations: compressorDataForName(t, ev.cn).SpecificVariantAnnotations,
+			UnknownLocation:        false,
+			Location:               types.BICLocationReference{Opaque: scopeName + ev.lr},
 		}
 	}
 	assertCandidatesMatch2Native(t, e, actual)
@@ -290,7 +408,7 @@ func testGenericCandidateLocations2(t *testing.T, cache blobinfocache.BlobInfoCa
 		// ----------------------------
 		// If a record exists with compression without Location then
 		// then return a record without location and with `UnknownLocation: true`
-		cache.RecordDigestCompressorName(digestUnknownLocation, compressiontypes.Bzip2AlgorithmName)
+		cache.RecordDigestCompressorData(digestUnknownLocation, compressorDataForName(t, compressiontypes.Bzip2AlgorithmName))
 		res = cache.CandidateLocations2(transport, scope, digestUnknownLocation, blobinfocache.CandidateLocations2Options{
 			CanSubstitute: true,
 		})
@@ -331,7 +449,7 @@ func testGenericCandidateLocations2(t *testing.T, cache blobinfocache.BlobInfoCa
 		// that shouldn’t happen in real-world usage.
 		if scopeIndex != 0 {
 			for _, e := range digestNameSetPrioritization {
-				cache.RecordDigestCompressorName(e.d, blobinfocache.UnknownCompression)
+				cache.RecordDigestCompressorData(e.d, compressorDataForName(t, blobinfocache.UnknownCompression))
 			}
 		}
 
@@ -399,7 +517,7 @@ func testGenericCandidateLocations2(t *testing.T, cache blobinfocache.BlobInfoCa
 
 		// Set the "known" compression values
 		for _, e := range digestNameSetPrioritization {
-			cache.RecordDigestCompressorName(e.d, e.m)
+			cache.RecordDigestCompressorData(e.d, compressorDataForName(t, e.m))
 		}
 
 		// No substitutions allowed:
@@ -481,7 +599,7 @@ func testGenericCandidateLocations2(t *testing.T, cache blobinfocache.BlobInfoCa
 			cache.RecordKnownLocation(transport, scope, e.d, types.BICLocationReference{Opaque: scopeName + e.n})
 		}
 		for _, e := range digestNameSetFiltering {
-			cache.RecordDigestCompressorName(e.d, e.m)
+			cache.RecordDigestCompressorData(e.d, compressorDataForName(t, e.m))
 		}
 
 		// No filtering
@@ -524,8 +642,10 @@ func testGenericCandidateLocations2(t *testing.T, cache blobinfocache.BlobInfoCa
 			CanSubstitute:       true,
 			RequiredCompression: &compression.ZstdChunked,
 		})
-		// Right now, zstd:chunked requests never match a candidate, see CandidateCompressionMatchesReuseConditions().
-		assertCandidatesMatch2(t, scopeName, []candidate{}, res)
+		// zstd:chunked requests only match candidates recorded as zstd:chunked, which come with the necessary annotations.
+		assertCandidatesMatch2(t, scopeName, []candidate{
+			{d: digestZstdChunked, cn: compressiontypes.ZstdChunkedAlgorithmName, lr: "zstdChunked"},
+		}, res)
 		res = cache.CandidateLocations2(transport, scope, digestFilteringUncompressed, blobinfocache.CandidateLocations2Options{
 			CanSubstitute:       true,
 			RequiredCompression: &compression.Zstd,
@@ -536,3 +656,77 @@ func testGenericCandidateLocations2(t *testing.T, cache blobinfocache.BlobInfoCa
 		}, res)
 	}
 }
+
+// GenericPrune runs an implementation-independent set of tests of blobinfocache.Pruner, given a
+// newTestCache, which can be called repeatedly and always returns a fresh cache instance
+func GenericPrune(t *testing.T, newTestCache func(t *testing.T) blobinfocache.BlobInfoCache2) {
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	lr1 := types.BICLocationReference{Opaque: "1"}
+	lr2 := types.BICLocationReference{Opaque: "2"}
+	lr3 := types.BICLocationReference{Opaque: "3"}
+
+	// recordInOrder records known locations, ensuring each of them has a distinct time.
+	recordInOrder := func(cache blobinfocache.BlobInfoCache2, locations []struct {
+		digest   digest.Digest
+		location types.BICLocationReference
+	}) {
+		for _, l := range locations {
+			cache.RecordKnownLocation(transport, scope, l.digest, l.location)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	cache := newTestCache(t)
+	pruner, ok := cache.(blobinfocache.Pruner)
+	require.True(t, ok)
+	recordInOrder(cache, []struct {
+		digest   digest.Digest
+		location types.BICLocationReference
+	}{
+		{digestCompressedA, lr1},
+		{digestCompressedB, lr2},
+		{digestCompressedA, lr3},
+	})
+	// No limits
+	err := pruner.Prune(blobinfocache.PruneOptions{})
+	require.NoError(t, err)
+	assert.Len(t, cache.CandidateLocations(transport, scope, digestCompressedA, false), 2)
+	assert.Len(t, cache.CandidateLocations(transport, scope, digestCompressedB, false), 1)
+	// Limits which are not exceeded
+	err = pruner.Prune(blobinfocache.PruneOptions{MaxLocationAge: time.Hour, MaxLocations: 3})
+	require.NoError(t, err)
+	assert.Len(t, cache.CandidateLocations(transport, scope, digestCompressedA, false), 2)
+	assert.Len(t, cache.CandidateLocations(transport, scope, digestCompressedB, false), 1)
+	// MaxLocations removes the least recently recorded locations
+	err = pruner.Prune(blobinfocache.PruneOptions{MaxLocations: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: digestCompressedA, Location: lr3}},
+		cache.CandidateLocations(transport, scope, digestCompressedA, false))
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: digestCompressedB, Location: lr2}},
+		cache.CandidateLocations(transport, scope, digestCompressedB, false))
+	// Re-recording a location makes it the most recently recorded one
+	recordInOrder(cache, []struct {
+		digest   digest.Digest
+		location types.BICLocationReference
+	}{
+		{digestCompressedB, lr2},
+	})
+	err = pruner.Prune(blobinfocache.PruneOptions{MaxLocations: 1})
+	require.NoError(t, err)
+	assert.Empty(t, cache.CandidateLocations(transport, scope, digestCompressedA, false))
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: digestCompressedB, Location: lr2}},
+		cache.CandidateLocations(transport, scope, digestCompressedB, false))
+
+	// MaxLocationAge
+	cache = newTestCache(t)
+	pruner, ok = cache.(blobinfocache.Pruner)
+	require.True(t, ok)
+	cache.RecordKnownLocation(transport, scope, digestCompressedA, lr1)
+	time.Sleep(200 * time.Millisecond)
+	cache.RecordKnownLocation(transport, scope, digestCompressedA, lr2)
+	err = pruner.Prune(blobinfocache.PruneOptions{MaxLocationAge: 100 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: digestCompressedA, Location: lr2}},
+		cache.CandidateLocations(transport, scope, digestCompressedA, false))
+}
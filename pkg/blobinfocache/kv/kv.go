@@ -0,0 +1,483 @@
+// Package kv implements a BlobInfoCache backed by a generic key-value store, e.g. a Redis server,
+// so that several machines can share the cache.
+//
+// Sharing the cache allows e.g. a fleet of build machines to reuse blobs (using cross-repository
+// mounts) that another machine has already pushed, instead of uploading them again.
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/pkg/blobinfocache/internal/prioritize"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// Store is a key-value store used by the cache. It consists of hashes (maps of field names to values),
+// identified by keys; this directly corresponds to the Redis HSET / HGET / HGETALL / HDEL commands.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// HashSet sets field in the hash at key to value, creating the hash if it does not exist.
+	HashSet(ctx context.Context, key, field, value string) error
+	// HashGet returns the value of field in the hash at key, and true; or "", false if it does not exist.
+	HashGet(ctx context.Context, key, field string) (string, bool, error)
+	// HashGetAll returns all fields of the hash at key; if the hash does not exist, it returns an empty map.
+	HashGetAll(ctx context.Context, key string) (map[string]string, error)
+	// HashDelete removes field from the hash at key, if it exists.
+	HashDelete(ctx context.Context, key, field string) error
+}
+
+// Key names (following the key prefix):
+const (
+	uncompressedDigestsKey         = "uncompressed"               // Fields: anyDigest; values: the uncompressed digest
+	digestsByUncompressedKeyPrefix = "byUncompressed/"            // + uncompressed digest; fields: anyDigest; values: ""
+	compressorsKey                 = "compressors"                // Fields: digest; values: base variant compressor name (never blobinfocache.UnknownCompression)
+	specificVariantCompressorsKey  = "specificVariantCompressors" // Fields: digest; values: JSON-encoded specificVariantCompressor
+	tocUncompressedDigestsKey      = "tocUncompressed"            // Fields: TOC digest; values: the uncompressed digest
+	knownLocationsKeyPrefix        = "locations/"                 // + knownLocationsKey(…); fields: opaque location; values: time, in knownLocationsTimeFormat
+)
+
+const (
+	// knownLocationsTimeFormat is the format of times of known locations.
+	knownLocationsTimeFormat = time.RFC3339Nano
+	// defaultStoreOperationTimeout is the time limit for a single store operation.
+	defaultStoreOperationTimeout = 10 * time.Second
+)
+
+// specificVariantCompressor is the value stored in specificVariantCompressorsKey.
+type specificVariantCompressor struct {
+	Compressor  string            `json:"compressor"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// cache is a BlobInfoCache implementation which uses a Store.
+type cache struct {
+	store     Store
+	keyPrefix string
+	timeout   time.Duration
+}
+
+// New returns a BlobInfoCache implementation which stores data in store, using keys starting with keyPrefix
+// (e.g. "containers-image-bic/"); this allows sharing a single store with other users.
+//
+// Failures to access the store are logged, and otherwise treated as if the data were not present
+// (i.e. they may make copies slower, but not fail).
+func New(store Store, keyPrefix string) types.BlobInfoCache {
+	return new2(store, keyPrefix)
+}
+
+// New3 returns a types.BlobInfoCache3 implementation which stores data in store, using keys starting with keyPrefix,
+// sharing data with caches returned by New for the same store and keyPrefix.
+// Unlike the cache returned by New, it uses the callers’ contexts to access the store, and returns failures to the callers.
+func New3(store Store, keyPrefix string) types.BlobInfoCache3 {
+	return &contextCache{cache: new2(store, keyPrefix)}
+}
+
+func new2(store Store, keyPrefix string) *cache {
+	return &cache{
+		store:     store,
+		keyPrefix: keyPrefix,
+		timeout:   defaultStoreOperationTimeout,
+	}
+}
+
+// Open() sets up the cache for future accesses, potentially acquiring costly state. Each Open() must be paired with a Close().
+// Note that public callers may call the types.BlobInfoCache operations without Open()/Close().
+func (kvc *cache) Open() {
+}
+
+// Close destroys state created by Open().
+func (kvc *cache) Close() {
+}
+
+// operationContext returns a context to use for a single store operation within ctx, and a function to release it.
+func (kvc *cache) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, kvc.timeout)
+}
+
+// hashGet is a wrapper for kvc.store.HashGet.
+func (kvc *cache) hashGet(ctx context.Context, key, field string) (string, bool, error) {
+	ctx, cancel := kvc.operationContext(ctx)
+	defer cancel()
+	return kvc.store.HashGet(ctx, kvc.keyPrefix+key, field)
+}
+
+// hashGetAll is a wrapper for kvc.store.HashGetAll.
+func (kvc *cache) hashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	ctx, cancel := kvc.operationContext(ctx)
+	defer cancel()
+	return kvc.store.HashGetAll(ctx, kvc.keyPrefix+key)
+}
+
+// hashSet is a wrapper for kvc.store.HashSet.
+func (kvc *cache) hashSet(ctx context.Context, key, field, value string) error {
+	ctx, cancel := kvc.operationContext(ctx)
+	defer cancel()
+	if err := kvc.store.HashSet(ctx, kvc.keyPrefix+key, field, value); err != nil {
+		return fmt.Errorf("recording %q = %q in blob info cache key %q: %w", field, value, kvc.keyPrefix+key, err)
+	}
+	return nil
+}
+
+// hashSetLogged is a wrapper for kvc.store.HashSet, which logs failures.
+// (The BlobInfoCache API does not provide a context, nor a way to report failures.)
+func (kvc *cache) hashSetLogged(key, field, value string) {
+	if err := kvc.hashSet(context.Background(), key, field, value); err != nil {
+		logrus.Debugf("Error %v", err)
+	}
+}
+
+// hashDeleteLogged is a wrapper for kvc.store.HashDelete, which logs failures.
+// (The BlobInfoCache API does not provide a context, nor a way to report failures.)
+func (kvc *cache) hashDeleteLogged(key, field string) {
+	ctx, cancel := kvc.operationContext(context.Background())
+	defer cancel()
+	if err := kvc.store.HashDelete(ctx, kvc.keyPrefix+key, field); err != nil {
+		logrus.Debugf("Error deleting %q from blob info cache key %q: %v", field, kvc.keyPrefix+key, err)
+	}
+}
+
+// knownLocationsKey returns the key used to store known locations of blobDigest in (transport, scope).
+func knownLocationsKey(transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest) string {
+	// Escape the components so that the key is unambiguous even if the components contain the separator.
+	return knownLocationsKeyPrefix + url.PathEscape(transport.Name()) + "/" + url.PathEscape(scope.Opaque) + "/" + blobDigest.String()
+}
+
+// UncompressedDigest returns an uncompressed digest corresponding to anyDigest.
+// May return anyDigest if it is known to be uncompressed.
+// Returns "" if nothing is known about the digest (it may be compressed or uncompressed).
+func (kvc *cache) UncompressedDigest(anyDigest digest.Digest) digest.Digest {
+	res, err := kvc.uncompressedDigest(context.Background(), anyDigest)
+	if err != nil {
+		logrus.Debugf("Error looking up uncompressed digest of %s in blob info cache: %v", anyDigest, err)
+		return ""
+	}
+	return res
+}
+
+// uncompressedDigest implements UncompressedDigest.
+func (kvc *cache) uncompressedDigest(ctx context.Context, anyDigest digest.Digest) (digest.Digest, error) {
+	uncompressedString, found, err := kvc.hashGet(ctx, uncompressedDigestsKey, anyDigest.String())
+	if err != nil {
+		return "", err
+	}
+	if found {
+		d, err := digest.Parse(uncompressedString)
+		if err != nil {
+			return "", err
+		}
+		return d, nil
+	}
+	// Presence in digestsByUncompressed implies that anyDigest must already refer to an uncompressed digest.
+	// This way we don't have to waste storage space with trivial (uncompressed, uncompressed) mappings
+	// when we already record a (compressed, uncompressed) pair.
+	others, err := kvc.hashGetAll(ctx, digestsByUncompressedKeyPrefix+anyDigest.String())
+	if err != nil {
+		return "", err
+	}
+	if len(others) > 0 {
+		return anyDigest, nil
+	}
+	return "", nil
+}
+
+// RecordDigestUncompressedPair records that the uncompressed version of anyDigest is uncompressed.
+// It’s allowed for anyDigest == uncompressed.
+// WARNING: Only call this for LOCALLY VERIFIED data; don’t record a digest pair just because some remote author claims so (e.g.
+// because a manifest/config pair exists); otherwise the cache could be poisoned and allow substituting unexpected blobs.
+// (Eventually, the DiffIDs in image config could detect the substitution, but that may be too late, and not all image formats contain that data.)
+func (kvc *cache) RecordDigestUncompressedPair(anyDigest digest.Digest, uncompressed digest.Digest) {
+	if err := kvc.recordDigestUncompressedPair(context.Background(), anyDigest, uncompressed); err != nil {
+		logrus.Debugf("Error %v", err)
+	}
+}
+
+// recordDigestUncompressedPair implements RecordDigestUncompressedPair.
+func (kvc *cache) recordDigestUncompressedPair(ctx context.Context, anyDigest digest.Digest, uncompressed digest.Digest) error {
+	if previous, found, err := kvc.hashGet(ctx, uncompressedDigestsKey, anyDigest.String()); err == nil && found && previous != uncompressed.String() {
+		logrus.Warnf("Uncompressed digest for blob %s previously recorded as %s, now %s", anyDigest, previous, uncompressed)
+	}
+	if err := kvc.hashSet(ctx, uncompressedDigestsKey, anyDigest.String(), uncompressed.String()); err != nil {
+		return err
+	}
+	return kvc.hashSet(ctx, digestsByUncompressedKeyPrefix+uncompressed.String(), anyDigest.String(), "")
+}
+
+// RecordKnownLocation records that a blob with the specified digest exists within the specified (transport, scope) scope,
+// and can be reused given the opaque location data.
+func (kvc *cache) RecordKnownLocation(transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest, location types.BICLocationReference) {
+	// Possibly overwriting an older entry.
+	kvc.hashSetLogged(knownLocationsKey(transport, scope, blobDigest), location.Opaque, time.Now().Format(knownLocationsTimeFormat))
+}
+
+// UncompressedDigestForTOC returns an uncompressed digest corresponding to tocDigest.
+// Returns "" if the uncompressed digest is unknown.
+func (kvc *cache) UncompressedDigestForTOC(tocDigest digest.Digest) digest.Digest {
+	uncompressedString, found, err := kvc.hashGet(context.Background(), tocUncompressedDigestsKey, tocDigest.String())
+	if err != nil {
+		logrus.Debugf("Error looking up uncompressed digest of blob with TOC %s in blob info cache: %v", tocDigest, err)
+		return ""
+	}
+	if !found {
+		return ""
+	}
+	d, err := digest.Parse(uncompressedString)
+	if err != nil {
+		logrus.Debugf("Ignoring invalid uncompressed digest %q of blob with TOC %s in blob info cache: %v", uncompressedString, tocDigest, err)
+		return ""
+	}
+	return d
+}
+
+// RecordTOCUncompressedPair records that the tocDigest corresponds to uncompressed.
+// WARNING: Only call this for LOCALLY VERIFIED data; don’t record a digest pair just because some remote author claims so (e.g.
+// because a manifest/config pair exists); otherwise the cache could be poisoned and allow substituting unexpected blobs.
+// (Eventually, the DiffIDs in image config could detect the substitution, but that may be too late, and not all image formats contain that data.)
+func (kvc *cache) RecordTOCUncompressedPair(tocDigest digest.Digest, uncompressed digest.Digest) {
+	if previous, found, err := kvc.hashGet(context.Background(), tocUncompressedDigestsKey, tocDigest.String()); err == nil && found && previous != uncompressed.String() {
+		logrus.Warnf("Uncompressed digest for blob with TOC %q previously recorded as %q, now %q", tocDigest, previous, uncompressed)
+	}
+	kvc.hashSetLogged(tocUncompressedDigestsKey, tocDigest.String(), uncompressed.String())
+}
+
+// RecordDigestCompressorData records data for the blob with the specified digest.
+// WARNING: Only call this with LOCALLY VERIFIED data:
+//   - don’t record a compressor for a digest just because some remote author claims so
+//     (e.g. because a manifest says so);
+//   - don’t record the non-base variant or annotations if we are not _sure_ that the base variant
+//     and the blob’s digest match the non-base variant’s annotations (e.g. because we saw them
+//     in a manifest)
+//
+// otherwise the cache could be poisoned and cause us to make incorrect edits to type
+// information in a manifest.
+func (kvc *cache) RecordDigestCompressorData(anyDigest digest.Digest, data blobinfocache.DigestCompressorData) {
+	previous, found, err := kvc.hashGet(context.Background(), compressorsKey, anyDigest.String())
+	baseVariantChanged := err == nil && found && previous != data.BaseVariantCompressor
+	if baseVariantChanged {
+		logrus.Warnf("Base compressor for blob with digest %s previously recorded as %s, now %s", anyDigest, previous, data.BaseVariantCompressor)
+	}
+	if baseVariantChanged || data.BaseVariantCompressor == blobinfocache.UnknownCompression {
+		// The previous specific variant, if any, does not match the new base variant
+		kvc.hashDeleteLogged(specificVariantCompressorsKey, anyDigest.String())
+	}
+	if data.BaseVariantCompressor == blobinfocache.UnknownCompression {
+		kvc.hashDeleteLogged(compressorsKey, anyDigest.String())
+		return
+	}
+	kvc.hashSetLogged(compressorsKey, anyDigest.String(), data.BaseVariantCompressor)
+	if data.SpecificVariantCompressor != "" && data.SpecificVariantCompressor != blobinfocache.UnknownCompression &&
+		data.BaseVariantCompressor != blobinfocache.Uncompressed {
+		value, err := json.Marshal(specificVariantCompressor{
+			Compressor:  data.SpecificVariantCompressor,
+			Annotations: data.SpecificVariantAnnotations,
+		})
+		if err != nil {
+			logrus.Debugf("Error encoding specific variant compressor %q for blob info cache: %v", data.SpecificVariantCompressor, err)
+			return
+		}
+		kvc.hashSetLogged(specificVariantCompressorsKey, anyDigest.String(), string(value))
+	}
+}
+
+// appendReplacementCandidates creates prioritize.CandidateWithTime values for (transport, scope, digest),
+// and returns the result of appending them to candidates.
+// v2Options is not nil if the caller is CandidateLocations2: this allows including candidates with unknown location, and filters out candidates
+// with unknown compression.
+func (kvc *cache) appendReplacementCandidates(ctx context.Context, candidates []prioritize.CandidateWithTime, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest,
+	v2Options *blobinfocache.CandidateLocations2Options) ([]prioritize.CandidateWithTime, error) {
+	compressorData := blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     blobinfocache.UnknownCompression,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	}
+	if v2Options != nil {
+		compressor, found, err := kvc.hashGet(ctx, compressorsKey, digest.String())
+		if err != nil {
+			return nil, fmt.Errorf("looking up compressor: %w", err)
+		}
+		if found {
+			compressorData.BaseVariantCompressor = compressor
+		}
+		value, found, err := kvc.hashGet(ctx, specificVariantCompressorsKey, digest.String())
+		if err != nil {
+			return nil, fmt.Errorf("looking up specific variant compressor: %w", err)
+		}
+		if found {
+			var sv specificVariantCompressor
+			if err := json.Unmarshal([]byte(value), &sv); err != nil {
+				logrus.Debugf("Ignoring invalid specific variant compressor %q of %s in blob info cache: %v", value, digest, err)
+			} else {
+				compressorData.SpecificVariantCompressor = sv.Compressor
+				compressorData.SpecificVariantAnnotations = sv.Annotations
+			}
+		}
+	}
+	ok, compressionOp, compressionAlgo, compressionAnnotations := prioritize.CandidateCompression(v2Options, digest, compressorData)
+	if !ok {
+		return candidates, nil
+	}
+
+	locations, err := kvc.hashGetAll(ctx, knownLocationsKey(transport, scope, digest))
+	if err != nil {
+		return nil, fmt.Errorf("looking up candidate locations: %w", err)
+	}
+	added := false
+	for location, timeString := range locations {
+		t, err := time.Parse(knownLocationsTimeFormat, timeString)
+		if err != nil {
+			logrus.Debugf("Ignoring invalid time %q of location %q in blob info cache: %v", timeString, location, err)
+			continue
+		}
+		candidates = append(candidates, prioritize.CandidateWithTime{
+			Candidate: blobinfocache.BICReplacementCandidate2{
+				Digest:                 digest,
+				CompressionOperation:   compressionOp,
+				CompressionAlgorithm:   compressionAlgo,
+				CompressionAnnotations: compressionAnnotations,
+				Location:               types.BICLocationReference{Opaque: location},
+			},
+			LastSeen: t,
+		})
+		added = true
+	}
+	if !added && v2Options != nil {
+		candidates = append(candidates, prioritize.CandidateWithTime{
+			Candidate: blobinfocache.BICReplacementCandidate2{
+				Digest:                 digest,
+				CompressionOperation:   compressionOp,
+				CompressionAlgorithm:   compressionAlgo,
+				CompressionAnnotations: compressionAnnotations,
+				UnknownLocation:        true,
+				Location:               types.BICLocationReference{Opaque: ""},
+			},
+			LastSeen: time.Time{},
+		})
+	}
+	return candidates, nil
+}
+
+// CandidateLocations returns a prioritized, limited, number of blobs and their locations that could possibly be reused
+// within the specified (transport scope) (if they still exist, which is not guaranteed).
+//
+// If !canSubstitute, the returned candidates will match the submitted digest exactly; if canSubstitute,
+// data from previous RecordDigestUncompressedPair calls is used to also look up variants of the blob which have the same
+// uncompressed digest.
+func (kvc *cache) CandidateLocations(transport types.ImageTransport, scope types.BICTransportScope, primaryDigest digest.Digest, canSubstitute bool) []types.BICReplacementCandidate {
+	return blobinfocache.CandidateLocationsFromV2(kvc.candidateLocationsLogged(transport, scope, primaryDigest, canSubstitute, nil))
+}
+
+// CandidateLocations2 returns a prioritized, limited, number of blobs and their locations (if known)
+// that could possibly be reused within the specified (transport scope) (if they still
+// exist, which is not guaranteed).
+func (kvc *cache) CandidateLocations2(transport types.ImageTransport, scope types.BICTransportScope, primaryDigest digest.Digest, options blobinfocache.CandidateLocations2Options) []blobinfocache.BICReplacementCandidate2 {
+	return kvc.candidateLocationsLogged(transport, scope, primaryDigest, options.CanSubstitute, &options)
+}
+
+// candidateLocationsLogged is a wrapper for candidateLocations, which logs failures.
+// (The BlobInfoCache API does not provide a context, nor a way to report failures.)
+func (kvc *cache) candidateLocationsLogged(transport types.ImageTransport, scope types.BICTransportScope, primaryDigest digest.Digest, canSubstitute bool,
+	v2Options *blobinfocache.CandidateLocations2Options) []blobinfocache.BICReplacementCandidate2 {
+	res, err := kvc.candidateLocations(context.Background(), transport, scope, primaryDigest, canSubstitute, v2Options)
+	if err != nil {
+		logrus.Debugf("Error looking up candidate locations of %s in blob info cache: %v", primaryDigest, err)
+		return []blobinfocache.BICReplacementCandidate2{}
+	}
+	return res
+}
+
+// candidateLocations implements CandidateLocations / CandidateLocations2.
+// v2Options is not nil if the caller is CandidateLocations2.
+func (kvc *cache) candidateLocations(ctx context.Context, transport types.ImageTransport, scope types.BICTransportScope, primaryDigest digest.Digest, canSubstitute bool,
+	v2Options *blobinfocache.CandidateLocations2Options) ([]blobinfocache.BICReplacementCandidate2, error) {
+	var uncompressedDigest digest.Digest // = ""
+	res, err := func() ([]prioritize.CandidateWithTime, error) {
+		res := []prioritize.CandidateWithTime{}
+		res, err := kvc.appendReplacementCandidates(ctx, res, transport, scope, primaryDigest, v2Options)
+		if err != nil {
+			return nil, err
+		}
+		if canSubstitute {
+			uncompressedDigest, err = kvc.uncompressedDigest(ctx, primaryDigest)
+			if err != nil {
+				return nil, err
+			}
+			if uncompressedDigest != "" {
+				otherDigests, err := kvc.hashGetAll(ctx, digestsByUncompressedKeyPrefix+uncompressedDigest.String())
+				if err != nil {
+					return nil, fmt.Errorf("looking up other digests: %w", err)
+				}
+				for otherDigestString := range otherDigests {
+					otherDigest, err := digest.Parse(otherDigestString)
+					if err != nil {
+						return nil, err
+					}
+					if otherDigest != primaryDigest && otherDigest != uncompressedDigest {
+						res, err = kvc.appendReplacementCandidates(ctx, res, transport, scope, otherDigest, v2Options)
+						if err != nil {
+							return nil, err
+						}
+					}
+				}
+				if uncompressedDigest != primaryDigest {
+					res, err = kvc.appendReplacementCandidates(ctx, res, transport, scope, uncompressedDigest, v2Options)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		return res, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return prioritize.DestructivelyPrioritizeReplacementCandidates(res, primaryDigest, uncompressedDigest), nil
+}
+
+// contextCache is a types.BlobInfoCache3 implementation which uses a Store.
+type contextCache struct {
+	cache *cache
+}
+
+// UncompressedDigest returns an uncompressed digest corresponding to anyDigest.
+// May return anyDigest if it is known to be uncompressed.
+// Returns "" if nothing is known about the digest (it may be compressed or uncompressed).
+func (kvc *contextCache) UncompressedDigest(ctx context.Context, anyDigest digest.Digest) (digest.Digest, error) {
+	return kvc.cache.uncompressedDigest(ctx, anyDigest)
+}
+
+// RecordDigestUncompressedPair records that the uncompressed version of anyDigest is uncompressed.
+// It’s allowed for anyDigest == uncompressed.
+// WARNING: Only call this for LOCALLY VERIFIED data; don’t record a digest pair just because some remote author claims so (e.g.
+// because a manifest/config pair exists); otherwise the cache could be poisoned and allow substituting unexpected blobs.
+// (Eventually, the DiffIDs in image config could detect the substitution, but that may be too late, and not all image formats contain that data.)
+func (kvc *contextCache) RecordDigestUncompressedPair(ctx context.Context, anyDigest digest.Digest, uncompressed digest.Digest) error {
+	return kvc.cache.recordDigestUncompressedPair(ctx, anyDigest, uncompressed)
+}
+
+// RecordKnownLocation records that a blob with the specified digest exists within the specified (transport, scope) scope,
+// and can be reused given the opaque location data.
+func (kvc *contextCache) RecordKnownLocation(ctx context.Context, transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest, location types.BICLocationReference) error {
+	// Possibly overwriting an older entry.
+	return kvc.cache.hashSet(ctx, knownLocationsKey(transport, scope, blobDigest), location.Opaque, time.Now().Format(knownLocationsTimeFormat))
+}
+
+// CandidateLocations returns a prioritized, limited, number of blobs and their locations that could possibly be reused
+// within the specified (transport scope) (if they still exist, which is not guaranteed).
+//
+// If !canSubstitute, the returned candidates will match the submitted digest exactly; if canSubstitute,
+// data from previous RecordDigestUncompressedPair calls is used to also look up variants of the blob which have the same
+// uncompressed digest.
+func (kvc *contextCache) CandidateLocations(ctx context.Context, transport types.ImageTransport, scope types.BICTransportScope, primaryDigest digest.Digest, canSubstitute bool) ([]types.BICReplacementCandidate, error) {
+	res, err := kvc.cache.candidateLocations(ctx, transport, scope, primaryDigest, canSubstitute, nil)
+	if err != nil {
+		return nil, fmt.Errorf("looking up candidate locations of %s in blob info cache: %w", primaryDigest, err)
+	}
+	return blobinfocache.CandidateLocationsFromV2(res), nil
+}
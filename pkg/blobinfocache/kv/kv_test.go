@@ -0,0 +1,190 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/containers/image/v5/pkg/blobinfocache/internal/test"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ blobinfocache.BlobInfoCache2 = &cache{}
+
+// mapStore is a Store implementation for tests.
+type mapStore struct {
+	mutex  sync.Mutex
+	hashes map[string]map[string]string
+	fail   bool // Fail all operations
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{hashes: map[string]map[string]string{}}
+}
+
+var errMapStoreFailure = errors.New("mapStore failure")
+
+// check returns an error if an operation using ctx should fail.
+func (s *mapStore) check(ctx context.Context) error {
+	if s.fail {
+		return errMapStoreFailure
+	}
+	return ctx.Err()
+}
+
+func (s *mapStore) HashSet(ctx context.Context, key, field, value string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	h, ok := s.hashes[key]
+	if !ok {
+		h = map[string]string{}
+		s.hashes[key] = h
+	}
+	h[field] = value
+	return nil
+}
+
+func (s *mapStore) HashGet(ctx context.Context, key, field string) (string, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.check(ctx); err != nil {
+		return "", false, err
+	}
+	v, ok := s.hashes[key][field]
+	return v, ok, nil
+}
+
+func (s *mapStore) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+	res := map[string]string{}
+	for k, v := range s.hashes[key] {
+		res[k] = v
+	}
+	return res, nil
+}
+
+func (s *mapStore) HashDelete(ctx context.Context, key, field string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	delete(s.hashes[key], field)
+	return nil
+}
+
+func newTestCache(t *testing.T) blobinfocache.BlobInfoCache2 {
+	return new2(newMapStore(), "prefix/")
+}
+
+func TestNew(t *testing.T) {
+	test.GenericCache(t, newTestCache)
+}
+
+func TestSharedStore(t *testing.T) {
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	d := digest.FromString("blob")
+	store := newMapStore()
+
+	// Data recorded by one cache is visible in another one using the same store and prefix, but not with a different prefix.
+	c1 := new2(store, "prefix/")
+	c1.RecordKnownLocation(transport, scope, d, types.BICLocationReference{Opaque: "location"})
+	c2 := new2(store, "prefix/")
+	res := c2.CandidateLocations(transport, scope, d, false)
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: d, Location: types.BICLocationReference{Opaque: "location"}}}, res)
+	c3 := new2(store, "other-prefix/")
+	res = c3.CandidateLocations(transport, scope, d, false)
+	assert.Empty(t, res)
+
+	// Scope values containing the key separator don’t collide with other keys.
+	c1.RecordKnownLocation(transport, types.BICTransportScope{Opaque: "a/b"}, d, types.BICLocationReference{Opaque: "ab"})
+	res = c1.CandidateLocations(transport, types.BICTransportScope{Opaque: "a"}, d, false)
+	assert.Empty(t, res)
+}
+
+func TestStoreFailures(t *testing.T) {
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	d := digest.FromString("blob")
+	store := newMapStore()
+	c := new2(store, "prefix/")
+	c.RecordDigestUncompressedPair(d, d)
+	c.RecordKnownLocation(transport, scope, d, types.BICLocationReference{Opaque: "location"})
+
+	// Failures are treated as missing data.
+	store.fail = true
+	assert.Equal(t, digest.Digest(""), c.UncompressedDigest(d))
+	assert.Empty(t, c.CandidateLocations(transport, scope, d, true))
+	assert.Empty(t, c.CandidateLocations2(transport, scope, d, blobinfocache.CandidateLocations2Options{CanSubstitute: true}))
+	// Recording does not panic
+	c.RecordDigestUncompressedPair(d, d)
+	c.RecordKnownLocation(transport, scope, d, types.BICLocationReference{Opaque: "location"})
+	c.RecordDigestCompressorData(d, blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     blobinfocache.Uncompressed,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	})
+	c.RecordDigestCompressorData(d, blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     blobinfocache.UnknownCompression,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	})
+	c.RecordTOCUncompressedPair(d, d)
+	assert.Equal(t, digest.Digest(""), c.UncompressedDigestForTOC(d))
+}
+
+func TestNew3(t *testing.T) {
+	ctx := context.Background()
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	compressed := digest.FromString("compressed")
+	uncompressed := digest.FromString("uncompressed")
+	store := newMapStore()
+	c := New3(store, "prefix/")
+
+	err := c.RecordDigestUncompressedPair(ctx, compressed, uncompressed)
+	require.NoError(t, err)
+	err = c.RecordKnownLocation(ctx, transport, scope, compressed, types.BICLocationReference{Opaque: "location"})
+	require.NoError(t, err)
+	res, err := c.UncompressedDigest(ctx, compressed)
+	require.NoError(t, err)
+	assert.Equal(t, uncompressed, res)
+	candidates, err := c.CandidateLocations(ctx, transport, scope, uncompressed, true)
+	require.NoError(t, err)
+	assert.Equal(t, []types.BICReplacementCandidate{{Digest: compressed, Location: types.BICLocationReference{Opaque: "location"}}}, candidates)
+
+	// The data is shared with caches returned by New.
+	assert.Equal(t, uncompressed, New(store, "prefix/").UncompressedDigest(compressed))
+
+	// Failures are reported.
+	store.fail = true
+	_, err = c.UncompressedDigest(ctx, compressed)
+	assert.ErrorIs(t, err, errMapStoreFailure)
+	_, err = c.CandidateLocations(ctx, transport, scope, compressed, true)
+	assert.ErrorIs(t, err, errMapStoreFailure)
+	err = c.RecordDigestUncompressedPair(ctx, compressed, uncompressed)
+	assert.ErrorIs(t, err, errMapStoreFailure)
+	err = c.RecordKnownLocation(ctx, transport, scope, compressed, types.BICLocationReference{Opaque: "location"})
+	assert.ErrorIs(t, err, errMapStoreFailure)
+	store.fail = false
+
+	// The caller’s context is passed to the store.
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.UncompressedDigest(canceledCtx, compressed)
+	assert.ErrorIs(t, err, context.Canceled)
+	err = c.RecordKnownLocation(canceledCtx, transport, scope, compressed, types.BICLocationReference{Opaque: "location"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,6 +2,8 @@
 package memory
 
 import (
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -24,10 +26,18 @@ type locationKey struct {
 type cache struct {
 	mutex sync.Mutex
 	// The following fields can only be accessed with mutex held.
-	uncompressedDigests   map[digest.Digest]digest.Digest
-	digestsByUncompressed map[digest.Digest]*set.Set[digest.Digest]                // stores a set of digests for each uncompressed digest
-	knownLocations        map[locationKey]map[types.BICLocationReference]time.Time // stores last known existence time for each location reference
-	compressors           map[digest.Digest]string                                 // stores a compressor name, or blobinfocache.Unknown (not blobinfocache.UnknownCompression), for each digest
+	uncompressedDigests        map[digest.Digest]digest.Digest
+	uncompressedDigestsByTOC   map[digest.Digest]digest.Digest
+	digestsByUncompressed      map[digest.Digest]*set.Set[digest.Digest]                // stores a set of digests for each uncompressed digest
+	knownLocations             map[locationKey]map[types.BICLocationReference]time.Time // stores last known existence time for each location reference
+	compressors                map[digest.Digest]string                                 // stores a base variant compressor name, or blobinfocache.Uncompressed, for each digest
+	specificVariantCompressors map[digest.Digest]specificVariantCompressor              // stores a non-base variant, if known, for digests with a known compressor
+}
+
+// specificVariantCompressor is a non-base compression variant, and the annotations required to use it.
+type specificVariantCompressor struct {
+	compressor  string
+	annotations map[string]string
 }
 
 // New returns a BlobInfoCache implementation which is in-memory only.
@@ -44,10 +54,12 @@ func New() types.BlobInfoCache {
 
 func new2() *cache {
 	return &cache{
-		uncompressedDigests:   map[digest.Digest]digest.Digest{},
-		digestsByUncompressed: map[digest.Digest]*set.Set[digest.Digest]{},
-		knownLocations:        map[locationKey]map[types.BICLocationReference]time.Time{},
-		compressors:           map[digest.Digest]string{},
+		uncompressedDigests:        map[digest.Digest]digest.Digest{},
+		digestsByUncompressed:      map[digest.Digest]*set.Set[digest.Digest]{},
+		knownLocations:             map[locationKey]map[types.BICLocationReference]time.Time{},
+		compressors:                map[digest.Digest]string{},
+		uncompressedDigestsByTOC:   map[digest.Digest]digest.Digest{},
+		specificVariantCompressors: map[digest.Digest]specificVariantCompressor{},
 	}
 }
 
@@ -104,6 +116,30 @@ func (mem *cache) RecordDigestUncompressedPair(anyDigest digest.Digest, uncompre
 	anyDigestSet.Add(anyDigest)
 }
 
+// UncompressedDigestForTOC returns an uncompressed digest corresponding to tocDigest.
+// Returns "" if the uncompressed digest is unknown.
+func (mem *cache) UncompressedDigestForTOC(tocDigest digest.Digest) digest.Digest {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	if d, ok := mem.uncompressedDigestsByTOC[tocDigest]; ok {
+		return d
+	}
+	return ""
+}
+
+// RecordTOCUncompressedPair records that the tocDigest corresponds to uncompressed.
+// WARNING: Only call this for LOCALLY VERIFIED data; don’t record a digest pair just because some remote author claims so (e.g.
+// because a manifest/config pair exists); otherwise the cache could be poisoned and allow substituting unexpected blobs.
+// (Eventually, the DiffIDs in image config could detect the substitution, but that may be too late, and not all image formats contain that data.)
+func (mem *cache) RecordTOCUncompressedPair(tocDigest digest.Digest, uncompressed digest.Digest) {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	if previous, ok := mem.uncompressedDigestsByTOC[tocDigest]; ok && previous != uncompressed {
+		logrus.Warnf("Uncompressed digest for blob with TOC %q previously recorded as %q, now %q", tocDigest, previous, uncompressed)
+	}
+	mem.uncompressedDigestsByTOC[tocDigest] = uncompressed
+}
+
 // RecordKnownLocation records that a blob with the specified digest exists within the specified (transport, scope) scope,
 // and can be reused given the opaque location data.
 func (mem *cache) RecordKnownLocation(transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest, location types.BICLocationReference) {
@@ -118,19 +154,36 @@ func (mem *cache) RecordKnownLocation(transport types.ImageTransport, scope type
 	locationScope[location] = time.Now() // Possibly overwriting an older entry.
 }
 
-// RecordDigestCompressorName records that the blob with the specified digest is either compressed with the specified
-// algorithm, or uncompressed, or that we no longer know.
-func (mem *cache) RecordDigestCompressorName(blobDigest digest.Digest, compressorName string) {
+// RecordDigestCompressorData records data for the blob with the specified digest.
+// WARNING: Only call this with LOCALLY VERIFIED data:
+//   - don’t record a compressor for a digest just because some remote author claims so
+//     (e.g. because a manifest says so);
+//   - don’t record the non-base variant or annotations if we are not _sure_ that the base variant
+//     and the blob’s digest match the non-base variant’s annotations (e.g. because we saw them
+//     in a manifest)
+//
+// otherwise the cache could be poisoned and cause us to make incorrect edits to type
+// information in a manifest.
+func (mem *cache) RecordDigestCompressorData(anyDigest digest.Digest, data blobinfocache.DigestCompressorData) {
 	mem.mutex.Lock()
 	defer mem.mutex.Unlock()
-	if previous, ok := mem.compressors[blobDigest]; ok && previous != compressorName {
-		logrus.Warnf("Compressor for blob with digest %s previously recorded as %s, now %s", blobDigest, previous, compressorName)
+	if previous, ok := mem.compressors[anyDigest]; ok && previous != data.BaseVariantCompressor {
+		logrus.Warnf("Base compressor for blob with digest %s previously recorded as %s, now %s", anyDigest, previous, data.BaseVariantCompressor)
+		delete(mem.specificVariantCompressors, anyDigest) // The previous specific variant does not match the new base variant
 	}
-	if compressorName == blobinfocache.UnknownCompression {
-		delete(mem.compressors, blobDigest)
+	if data.BaseVariantCompressor == blobinfocache.UnknownCompression {
+		delete(mem.compressors, anyDigest)
+		delete(mem.specificVariantCompressors, anyDigest)
 		return
 	}
-	mem.compressors[blobDigest] = compressorName
+	mem.compressors[anyDigest] = data.BaseVariantCompressor
+	if data.SpecificVariantCompressor != "" && data.SpecificVariantCompressor != blobinfocache.UnknownCompression &&
+		data.BaseVariantCompressor != blobinfocache.Uncompressed {
+		mem.specificVariantCompressors[anyDigest] = specificVariantCompressor{
+			compressor:  data.SpecificVariantCompressor,
+			annotations: maps.Clone(data.SpecificVariantAnnotations),
+		}
+	}
 }
 
 // appendReplacementCandidates creates prioritize.CandidateWithTime values for digest in memory
@@ -140,11 +193,18 @@ func (mem *cache) RecordDigestCompressorName(blobDigest digest.Digest, compresso
 // with unknown compression.
 func (mem *cache) appendReplacementCandidates(candidates []prioritize.CandidateWithTime, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest,
 	v2Options *blobinfocache.CandidateLocations2Options) []prioritize.CandidateWithTime {
-	compressorName := blobinfocache.UnknownCompression
+	data := blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     blobinfocache.UnknownCompression,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	}
 	if v, ok := mem.compressors[digest]; ok {
-		compressorName = v
+		data.BaseVariantCompressor = v
+		if sv, ok := mem.specificVariantCompressors[digest]; ok {
+			data.SpecificVariantCompressor = sv.compressor
+			data.SpecificVariantAnnotations = sv.annotations
+		}
 	}
-	ok, compressionOp, compressionAlgo := prioritize.CandidateCompression(v2Options, digest, compressorName)
+	ok, compressionOp, compressionAlgo, compressionAnnotations := prioritize.CandidateCompression(v2Options, digest, data)
 	if !ok {
 		return candidates
 	}
@@ -153,10 +213,11 @@ func (mem *cache) appendReplacementCandidates(candidates []prioritize.CandidateW
 		for l, t := range locations {
 			candidates = append(candidates, prioritize.CandidateWithTime{
 				Candidate: blobinfocache.BICReplacementCandidate2{
-					Digest:               digest,
-					CompressionOperation: compressionOp,
-					CompressionAlgorithm: compressionAlgo,
-					Location:             l,
+					Digest:                 digest,
+					CompressionOperation:   compressionOp,
+					CompressionAlgorithm:   compressionAlgo,
+					CompressionAnnotations: compressionAnnotations,
+					Location:               l,
 				},
 				LastSeen: t,
 			})
@@ -164,11 +225,12 @@ func (mem *cache) appendReplacementCandidates(candidates []prioritize.CandidateW
 	} else if v2Options != nil {
 		candidates = append(candidates, prioritize.CandidateWithTime{
 			Candidate: blobinfocache.BICReplacementCandidate2{
-				Digest:               digest,
-				CompressionOperation: compressionOp,
-				CompressionAlgorithm: compressionAlgo,
-				UnknownLocation:      true,
-				Location:             types.BICLocationReference{Opaque: ""},
+				Digest:                 digest,
+				CompressionOperation:   compressionOp,
+				CompressionAlgorithm:   compressionAlgo,
+				CompressionAnnotations: compressionAnnotations,
+				UnknownLocation:        true,
+				Location:               types.BICLocationReference{Opaque: ""},
 			},
 			LastSeen: time.Time{},
 		})
@@ -219,3 +281,43 @@ func (mem *cache) candidateLocations(transport types.ImageTransport, scope types
 	}
 	return prioritize.DestructivelyPrioritizeReplacementCandidates(res, primaryDigest, uncompressedDigest)
 }
+
+// Prune removes known locations from the cache as specified by options.
+func (mem *cache) Prune(options blobinfocache.PruneOptions) error {
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+
+	type locationEntry struct {
+		key      locationKey
+		location types.BICLocationReference
+		time     time.Time
+	}
+	locations := []locationEntry{}
+	var threshold time.Time // The zero value if there is no age limit
+	if options.MaxLocationAge != 0 {
+		threshold = time.Now().Add(-options.MaxLocationAge)
+	}
+	for key, locationScope := range mem.knownLocations {
+		for l, t := range locationScope {
+			if t.Before(threshold) {
+				delete(locationScope, l)
+				continue
+			}
+			locations = append(locations, locationEntry{key: key, location: l, time: t})
+		}
+	}
+	if options.MaxLocations != 0 && len(locations) > options.MaxLocations {
+		slices.SortFunc(locations, func(a, b locationEntry) int {
+			return a.time.Compare(b.time)
+		})
+		for _, e := range locations[:len(locations)-options.MaxLocations] {
+			delete(mem.knownLocations[e.key], e.location)
+		}
+	}
+	for key, locationScope := range mem.knownLocations {
+		if len(locationScope) == 0 {
+			delete(mem.knownLocations, key)
+		}
+	}
+	return nil
+}
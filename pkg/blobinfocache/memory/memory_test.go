@@ -16,3 +16,7 @@ func newTestCache(t *testing.T) blobinfocache.BlobInfoCache2 {
 func TestNew(t *testing.T) {
 	test.GenericCache(t, newTestCache)
 }
+
+func TestPrune(t *testing.T) {
+	test.GenericPrune(t, newTestCache)
+}
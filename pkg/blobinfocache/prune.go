@@ -0,0 +1,27 @@
+package blobinfocache
+
+import (
+	"errors"
+	"fmt"
+
+	internalBIC "github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/types"
+)
+
+// PruneOptions specify which data to remove in Prune.
+type PruneOptions = internalBIC.PruneOptions
+
+// Prune removes known locations from cache as specified by options, to limit the size of long-lived caches.
+// Caches never prune data on their own, and no other data is removed; callers which want to bound the size of a cache
+// must call Prune periodically.
+// It fails if cache does not support pruning (currently, only the SQLite and memory implementations do).
+func Prune(cache types.BlobInfoCache, options PruneOptions) error {
+	if options.MaxLocationAge < 0 || options.MaxLocations < 0 {
+		return errors.New("invalid blob info cache pruning options: limits must not be negative")
+	}
+	pruner, ok := cache.(internalBIC.Pruner)
+	if !ok {
+		return fmt.Errorf("blob info cache %T does not support pruning", cache)
+	}
+	return pruner.Prune(options)
+}
@@ -3,8 +3,10 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -39,7 +41,7 @@ const (
 		// i.e. obtain a write lock for _all_ transactions at the transaction start (never use a read lock,
 		// never upgrade from a read to a write lock - that can fail if multiple read lock owners try to do that simultaneously).
 		//
-		// This, together with go-sqlite3’s default for _busy_timeout=5000, means that we should never see a “database is locked” error,
+		// This, together with _busy_timeout below, means that we should never see a “database is locked” error,
 		// the database should block on the exclusive lock when starting a transaction, and the problematic case of two simultaneous
 		// holders of a read lock trying to upgrade to a write lock (and one necessarily failing) is prevented.
 		// Compare https://github.com/mattn/go-sqlite3/issues/274 .
@@ -48,12 +50,22 @@ const (
 		// or https://github.com/mattn/go-sqlite3/issues/400 .
 		// The currently-proposed  workaround is to create two different SQL “databases” (= connection pools) with different _txlock settings,
 		// which seems rather wasteful.
-		"&_txlock=exclusive"
+		"&_txlock=exclusive" +
+		// Use a write-ahead log (https://www.sqlite.org/wal.html). With the default rollback journal, a writer excludes all readers,
+		// so concurrent pulls on a shared host, from several processes, would be serialized on the cache; with WAL, readers
+		// never block writers, and writers never block readers, only other writers (and write transactions are short).
+		// The setting is persistent in the database file. WAL does not work on network filesystems, but the cache is expected to be
+		// stored locally anyway (and on an error, DefaultCache falls back to a memory-only cache).
+		"&_journal_mode=WAL" +
+		// Wait for up to 10 seconds (instead of go-sqlite3’s default 5) if another process holds the write lock, before
+		// failing with “database is locked”; with many concurrent writers, the default has been observed to be insufficient.
+		"&_busy_timeout=10000"
 )
 
 // cache is a BlobInfoCache implementation which uses a SQLite file at the specified path.
 type cache struct {
-	path string
+	path    string
+	options Options
 
 	// The database/sql package says “It is rarely necessary to close a DB.”, and steers towards a long-term *sql.DB connection pool.
 	// That’s probably very applicable for database-backed services, where the database is the primary data store. That’s not necessarily
@@ -74,14 +86,29 @@ type cache struct {
 	db       *sql.DB // nil if not set (may happen even if refCount > 0 on errors)
 }
 
+// Options allow customizing the behavior of the cache.
+type Options struct {
+	// If not 0, known locations last recorded more than LocationTTL ago are ignored when looking for candidates
+	// (they can be removed using blobinfocache.Prune).
+	LocationTTL time.Duration
+}
+
 // New returns BlobInfoCache implementation which uses a SQLite file at path.
 //
 // Most users should call blobinfocache.DefaultCache instead.
 func New(path string) (types.BlobInfoCache, error) {
-	return new2(path)
+	return new2(path, Options{})
+}
+
+// NewWithOptions returns BlobInfoCache implementation which uses a SQLite file at path, customized by options.
+func NewWithOptions(path string, options Options) (types.BlobInfoCache, error) {
+	if options.LocationTTL < 0 {
+		return nil, fmt.Errorf("invalid blob info cache location TTL %v", options.LocationTTL)
+	}
+	return new2(path, options)
 }
 
-func new2(path string) (*cache, error) {
+func new2(path string, options Options) (*cache, error) {
 	db, err := rawOpen(path)
 	if err != nil {
 		return nil, fmt.Errorf("initializing blob info cache at %q: %w", path, err)
@@ -96,6 +123,7 @@ func new2(path string) (*cache, error) {
 
 	return &cache{
 		path:     path,
+		options:  options,
 		refCount: 0,
 		db:       nil,
 	}, nil
@@ -295,6 +323,27 @@ func ensureDBHasCurrentSchema(db *sql.DB) error {
 				`PRIMARY KEY (transport, scope, digest, location)
 			)`,
 		},
+		// Items below were added after the initial schema; all items use IF NOT EXISTS, so re-running the whole list
+		// on a database which only contains the older items is safe.
+		{
+			"DigestSpecificVariantCompressors",
+			`CREATE TABLE IF NOT EXISTS DigestSpecificVariantCompressors(` +
+				// index implied by PRIMARY KEY
+				`digest				TEXT PRIMARY KEY NOT NULL,` +
+				// A non-base variant of the compressor recorded in DigestCompressors.
+				`specificVariant	TEXT NOT NULL,` +
+				// JSON-encoded map[string]string
+				`annotations		BLOB NOT NULL
+			)`,
+		},
+		{
+			"DigestTOCUncompressedPairs",
+			`CREATE TABLE IF NOT EXISTS DigestTOCUncompressedPairs(` +
+				// index implied by PRIMARY KEY
+				`tocDigest			TEXT PRIMARY KEY NOT NULL,
+				uncompressedDigest	TEXT NOT NULL
+			)`,
+		},
 	}
 
 	_, err := dbTransaction(db, func(tx *sql.Tx) (void, error) {
@@ -398,29 +447,91 @@ func (sqc *cache) RecordKnownLocation(transport types.ImageTransport, scope type
 	}) // FIXME? Log error (but throttle the log volume on repeated accesses)?
 }
 
-// RecordDigestCompressorName records a compressor for the blob with the specified digest,
-// or Uncompressed or UnknownCompression.
-// WARNING: Only call this with LOCALLY VERIFIED data; don’t record a compressor for a
-// digest just because some remote author claims so (e.g. because a manifest says so);
+// UncompressedDigestForTOC returns an uncompressed digest corresponding to tocDigest.
+// Returns "" if the uncompressed digest is unknown.
+func (sqc *cache) UncompressedDigestForTOC(tocDigest digest.Digest) digest.Digest {
+	res, err := transaction(sqc, func(tx *sql.Tx) (digest.Digest, error) {
+		uncompressedString, found, err := querySingleValue[string](tx, "SELECT uncompressedDigest FROM DigestTOCUncompressedPairs WHERE tocDigest = ?", tocDigest.String())
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", nil
+		}
+		return digest.Parse(uncompressedString)
+	})
+	if err != nil {
+		return "" // FIXME? Log err (but throttle the log volume on repeated accesses)?
+	}
+	return res
+}
+
+// RecordTOCUncompressedPair records that the tocDigest corresponds to uncompressed.
+// WARNING: Only call this for LOCALLY VERIFIED data; don’t record a digest pair just because some remote author claims so (e.g.
+// because a manifest/config pair exists); otherwise the cache could be poisoned and allow substituting unexpected blobs.
+// (Eventually, the DiffIDs in image config could detect the substitution, but that may be too late, and not all image formats contain that data.)
+func (sqc *cache) RecordTOCUncompressedPair(tocDigest digest.Digest, uncompressed digest.Digest) {
+	_, _ = transaction(sqc, func(tx *sql.Tx) (void, error) {
+		previousString, gotPrevious, err := querySingleValue[string](tx, "SELECT uncompressedDigest FROM DigestTOCUncompressedPairs WHERE tocDigest = ?", tocDigest.String())
+		if err != nil {
+			return void{}, fmt.Errorf("looking for uncompressed digest for blob with TOC %q", tocDigest)
+		}
+		if gotPrevious && previousString != uncompressed.String() {
+			logrus.Warnf("Uncompressed digest for blob with TOC %q previously recorded as %q, now %q", tocDigest, previousString, uncompressed)
+		}
+		if _, err := tx.Exec("INSERT OR REPLACE INTO DigestTOCUncompressedPairs(tocDigest, uncompressedDigest) VALUES (?, ?)",
+			tocDigest.String(), uncompressed.String()); err != nil {
+			return void{}, fmt.Errorf("recording uncompressed digest %q for blob with TOC %q: %w", uncompressed, tocDigest, err)
+		}
+		return void{}, nil
+	}) // FIXME? Log error (but throttle the log volume on repeated accesses)?
+}
+
+// RecordDigestCompressorData records data for the blob with the specified digest.
+// WARNING: Only call this with LOCALLY VERIFIED data:
+//   - don’t record a compressor for a digest just because some remote author claims so
+//     (e.g. because a manifest says so);
+//   - don’t record the non-base variant or annotations if we are not _sure_ that the base variant
+//     and the blob’s digest match the non-base variant’s annotations (e.g. because we saw them
+//     in a manifest)
+//
 // otherwise the cache could be poisoned and cause us to make incorrect edits to type
 // information in a manifest.
-func (sqc *cache) RecordDigestCompressorName(anyDigest digest.Digest, compressorName string) {
+func (sqc *cache) RecordDigestCompressorData(anyDigest digest.Digest, data blobinfocache.DigestCompressorData) {
 	_, _ = transaction(sqc, func(tx *sql.Tx) (void, error) {
 		previous, gotPrevious, err := querySingleValue[string](tx, "SELECT compressor FROM DigestCompressors WHERE digest = ?", anyDigest.String())
 		if err != nil {
 			return void{}, fmt.Errorf("looking for compressor of for %q", anyDigest)
 		}
-		if gotPrevious && previous != compressorName {
-			logrus.Warnf("Compressor for blob with digest %s previously recorded as %s, now %s", anyDigest, previous, compressorName)
+		baseVariantChanged := gotPrevious && previous != data.BaseVariantCompressor
+		if baseVariantChanged {
+			logrus.Warnf("Base compressor for blob with digest %s previously recorded as %s, now %s", anyDigest, previous, data.BaseVariantCompressor)
 		}
-		if compressorName == blobinfocache.UnknownCompression {
+		if baseVariantChanged || data.BaseVariantCompressor == blobinfocache.UnknownCompression {
+			// The previous specific variant, if any, does not match the new base variant
+			if _, err := tx.Exec("DELETE FROM DigestSpecificVariantCompressors WHERE digest = ?", anyDigest.String()); err != nil {
+				return void{}, fmt.Errorf("deleting specific variant compressor for digest %q: %w", anyDigest, err)
+			}
+		}
+		if data.BaseVariantCompressor == blobinfocache.UnknownCompression {
 			if _, err := tx.Exec("DELETE FROM DigestCompressors WHERE digest = ?", anyDigest.String()); err != nil {
 				return void{}, fmt.Errorf("deleting compressor for digest %q: %w", anyDigest, err)
 			}
-		} else {
-			if _, err := tx.Exec("INSERT OR REPLACE INTO DigestCompressors(digest, compressor) VALUES (?, ?)",
-				anyDigest.String(), compressorName); err != nil {
-				return void{}, fmt.Errorf("recording compressor %q for %q: %w", compressorName, anyDigest, err)
+			return void{}, nil
+		}
+		if _, err := tx.Exec("INSERT OR REPLACE INTO DigestCompressors(digest, compressor) VALUES (?, ?)",
+			anyDigest.String(), data.BaseVariantCompressor); err != nil {
+			return void{}, fmt.Errorf("recording compressor %q for %q: %w", data.BaseVariantCompressor, anyDigest, err)
+		}
+		if data.SpecificVariantCompressor != "" && data.SpecificVariantCompressor != blobinfocache.UnknownCompression &&
+			data.BaseVariantCompressor != blobinfocache.Uncompressed {
+			annotations, err := json.Marshal(data.SpecificVariantAnnotations)
+			if err != nil {
+				return void{}, err
+			}
+			if _, err := tx.Exec("INSERT OR REPLACE INTO DigestSpecificVariantCompressors(digest, specificVariant, annotations) VALUES (?, ?, ?)",
+				anyDigest.String(), data.SpecificVariantCompressor, annotations); err != nil {
+				return void{}, fmt.Errorf("recording specific variant compressor %q for %q: %w", data.SpecificVariantCompressor, anyDigest, err)
 			}
 		}
 		return void{}, nil
@@ -433,17 +544,36 @@ func (sqc *cache) RecordDigestCompressorName(anyDigest digest.Digest, compressor
 // with unknown compression.
 func (sqc *cache) appendReplacementCandidates(candidates []prioritize.CandidateWithTime, tx *sql.Tx, transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest,
 	v2Options *blobinfocache.CandidateLocations2Options) ([]prioritize.CandidateWithTime, error) {
-	compressorName := blobinfocache.UnknownCompression
+	compressorData := blobinfocache.DigestCompressorData{
+		BaseVariantCompressor:     blobinfocache.UnknownCompression,
+		SpecificVariantCompressor: blobinfocache.UnknownCompression,
+	}
 	if v2Options != nil {
 		compressor, found, err := querySingleValue[string](tx, "SELECT compressor FROM DigestCompressors WHERE digest = ?", digest.String())
 		if err != nil {
 			return nil, fmt.Errorf("scanning compressorName: %w", err)
 		}
 		if found {
-			compressorName = compressor
+			compressorData.BaseVariantCompressor = compressor
+		}
+		var specificVariant string
+		var annotationBytes []byte
+		switch err := tx.QueryRow("SELECT specificVariant, annotations FROM DigestSpecificVariantCompressors WHERE digest = ?", digest.String()).
+			Scan(&specificVariant, &annotationBytes); {
+		case errors.Is(err, sql.ErrNoRows):
+			// Nothing is known
+		case err != nil:
+			return nil, fmt.Errorf("scanning specific variant compressor: %w", err)
+		default:
+			var annotations map[string]string
+			if err := json.Unmarshal(annotationBytes, &annotations); err != nil {
+				return nil, fmt.Errorf("parsing annotations of specific variant compressor %q: %w", specificVariant, err)
+			}
+			compressorData.SpecificVariantCompressor = specificVariant
+			compressorData.SpecificVariantAnnotations = annotations
 		}
 	}
-	ok, compressionOp, compressionAlgo := prioritize.CandidateCompression(v2Options, digest, compressorName)
+	ok, compressionOp, compressionAlgo, compressionAnnotations := prioritize.CandidateCompression(v2Options, digest, compressorData)
 	if !ok {
 		return candidates, nil
 	}
@@ -456,6 +586,10 @@ func (sqc *cache) appendReplacementCandidates(candidates []prioritize.CandidateW
 	}
 	defer rows.Close()
 
+	var expiryThreshold time.Time // The zero value if no locations expire
+	if sqc.options.LocationTTL != 0 {
+		expiryThreshold = time.Now().Add(-sqc.options.LocationTTL)
+	}
 	rowAdded := false
 	for rows.Next() {
 		var location string
@@ -463,12 +597,16 @@ func (sqc *cache) appendReplacementCandidates(candidates []prioritize.CandidateW
 		if err := rows.Scan(&location, &time); err != nil {
 			return nil, fmt.Errorf("scanning candidate: %w", err)
 		}
+		if time.Before(expiryThreshold) {
+			continue
+		}
 		candidates = append(candidates, prioritize.CandidateWithTime{
 			Candidate: blobinfocache.BICReplacementCandidate2{
-				Digest:               digest,
-				CompressionOperation: compressionOp,
-				CompressionAlgorithm: compressionAlgo,
-				Location:             types.BICLocationReference{Opaque: location},
+				Digest:                 digest,
+				CompressionOperation:   compressionOp,
+				CompressionAlgorithm:   compressionAlgo,
+				CompressionAnnotations: compressionAnnotations,
+				Location:               types.BICLocationReference{Opaque: location},
 			},
 			LastSeen: time,
 		})
@@ -481,11 +619,12 @@ func (sqc *cache) appendReplacementCandidates(candidates []prioritize.CandidateW
 	if !rowAdded && v2Options != nil {
 		candidates = append(candidates, prioritize.CandidateWithTime{
 			Candidate: blobinfocache.BICReplacementCandidate2{
-				Digest:               digest,
-				CompressionOperation: compressionOp,
-				CompressionAlgorithm: compressionAlgo,
-				UnknownLocation:      true,
-				Location:             types.BICLocationReference{Opaque: ""},
+				Digest:                 digest,
+				CompressionOperation:   compressionOp,
+				CompressionAlgorithm:   compressionAlgo,
+				CompressionAnnotations: compressionAnnotations,
+				UnknownLocation:        true,
+				Location:               types.BICLocationReference{Opaque: ""},
 			},
 			LastSeen: time.Time{},
 		})
@@ -571,3 +710,69 @@ func (sqc *cache) candidateLocations(transport types.ImageTransport, scope types
 func (sqc *cache) CandidateLocations(transport types.ImageTransport, scope types.BICTransportScope, digest digest.Digest, canSubstitute bool) []types.BICReplacementCandidate {
 	return blobinfocache.CandidateLocationsFromV2(sqc.candidateLocations(transport, scope, digest, canSubstitute, nil))
 }
+
+// Prune removes known locations from the cache as specified by options.
+func (sqc *cache) Prune(options blobinfocache.PruneOptions) error {
+	_, err := transaction(sqc, func(tx *sql.Tx) (void, error) {
+		// The times are stored as text including a time zone offset, so they can’t be reliably compared in SQL;
+		// do the filtering here. The KnownLocations table is not WITHOUT ROWID, so each row has a rowid.
+		type locationRow struct {
+			rowid int64
+			time  time.Time
+		}
+		rows, err := tx.Query("SELECT rowid, time FROM KnownLocations")
+		if err != nil {
+			return void{}, fmt.Errorf("listing known locations: %w", err)
+		}
+		defer rows.Close()
+		locations := []locationRow{}
+		for rows.Next() {
+			var l locationRow
+			if err := rows.Scan(&l.rowid, &l.time); err != nil {
+				return void{}, fmt.Errorf("scanning known location: %w", err)
+			}
+			locations = append(locations, l)
+		}
+		if err := rows.Err(); err != nil {
+			return void{}, fmt.Errorf("iterating through known locations: %w", err)
+		}
+
+		toDelete := []int64{}
+		if options.MaxLocationAge != 0 {
+			threshold := time.Now().Add(-options.MaxLocationAge)
+			kept := locations[:0]
+			for _, l := range locations {
+				if l.time.Before(threshold) {
+					toDelete = append(toDelete, l.rowid)
+				} else {
+					kept = append(kept, l)
+				}
+			}
+			locations = kept
+		}
+		if options.MaxLocations != 0 && len(locations) > options.MaxLocations {
+			slices.SortFunc(locations, func(a, b locationRow) int {
+				return a.time.Compare(b.time)
+			})
+			for _, l := range locations[:len(locations)-options.MaxLocations] {
+				toDelete = append(toDelete, l.rowid)
+			}
+		}
+
+		if len(toDelete) == 0 {
+			return void{}, nil
+		}
+		stmt, err := tx.Prepare("DELETE FROM KnownLocations WHERE rowid = ?")
+		if err != nil {
+			return void{}, fmt.Errorf("preparing to delete known locations: %w", err)
+		}
+		defer stmt.Close()
+		for _, rowid := range toDelete {
+			if _, err := stmt.Exec(rowid); err != nil {
+				return void{}, fmt.Errorf("deleting a known location: %w", err)
+			}
+		}
+		return void{}, nil
+	})
+	return err
+}
@@ -1,11 +1,18 @@
 package sqlite
 
 import (
+	"fmt"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/pkg/blobinfocache/internal/test"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,7 +20,7 @@ var _ blobinfocache.BlobInfoCache2 = &cache{}
 
 func newTestCache(t *testing.T) blobinfocache.BlobInfoCache2 {
 	dir := t.TempDir()
-	cache, err := new2(filepath.Join(dir, "db.sqlite"))
+	cache, err := new2(filepath.Join(dir, "db.sqlite"), Options{})
 	require.NoError(t, err)
 	return cache
 }
@@ -22,4 +29,103 @@ func TestNew(t *testing.T) {
 	test.GenericCache(t, newTestCache)
 }
 
+func TestPrune(t *testing.T) {
+	test.GenericPrune(t, newTestCache)
+}
+
+func TestLocationTTL(t *testing.T) {
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	d := digest.FromString("blob")
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+
+	c, err := NewWithOptions(path, Options{LocationTTL: 100 * time.Millisecond})
+	require.NoError(t, err)
+	c.RecordKnownLocation(transport, scope, d, types.BICLocationReference{Opaque: "location"})
+	assert.Len(t, c.CandidateLocations(transport, scope, d, false), 1)
+	time.Sleep(200 * time.Millisecond)
+	// The expired location is ignored, but still present in the database.
+	assert.Empty(t, c.CandidateLocations(transport, scope, d, false))
+	c2, err := New(path)
+	require.NoError(t, err)
+	assert.Len(t, c2.CandidateLocations(transport, scope, d, false), 1)
+
+	_, err = NewWithOptions(path, Options{LocationTTL: -1})
+	assert.Error(t, err)
+}
+
+func TestJournalMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	_, err := new2(path, Options{})
+	require.NoError(t, err)
+
+	db, err := rawOpen(path)
+	require.NoError(t, err)
+	defer db.Close()
+	var mode string
+	err = db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+	require.NoError(t, err)
+	assert.Equal(t, "wal", mode)
+}
+
+func TestSchemaUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	_, err := new2(path, Options{})
+	require.NoError(t, err)
+	// Simulate a database created by an older version, without the tables added later.
+	db, err := rawOpen(path)
+	require.NoError(t, err)
+	for _, table := range []string{"DigestSpecificVariantCompressors", "DigestTOCUncompressedPairs"} {
+		_, err := db.Exec("DROP TABLE " + table)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	c, err := new2(path, Options{})
+	require.NoError(t, err)
+	tocDigest := digest.FromString("toc")
+	uncompressed := digest.FromString("uncompressed")
+	c.RecordTOCUncompressedPair(tocDigest, uncompressed)
+	assert.Equal(t, uncompressed, c.UncompressedDigestForTOC(tocDigest))
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	// Each cache object uses a separate connection pool, similar to separate processes sharing a cache file.
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	const numCaches = 4
+	const numRecords = 25
+	caches := []*cache{}
+	for i := 0; i < numCaches; i++ {
+		c, err := new2(path, Options{})
+		require.NoError(t, err)
+		c.Open()
+		defer c.Close()
+		caches = append(caches, c)
+	}
+
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	var wg sync.WaitGroup
+	for i, c := range caches {
+		wg.Add(1)
+		go func(i int, c *cache) {
+			defer wg.Done()
+			for j := 0; j < numRecords; j++ {
+				d := digest.FromString(fmt.Sprintf("%d-%d", i, j))
+				c.RecordKnownLocation(transport, scope, d, types.BICLocationReference{Opaque: "location"})
+				_ = c.CandidateLocations(transport, scope, d, false)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i := range caches {
+		for j := 0; j < numRecords; j++ {
+			d := digest.FromString(fmt.Sprintf("%d-%d", i, j))
+			res := caches[0].CandidateLocations(transport, scope, d, false)
+			assert.Len(t, res, 1, d.String())
+		}
+	}
+}
+
 // FIXME: Tests for the various corner cases / failure cases of sqlite.cache should be added here.
@@ -3,12 +3,14 @@ package compression
 import (
 	"bytes"
 	"compress/bzip2"
+	"compress/gzip"
 	"fmt"
 	"io"
 
 	"github.com/containers/image/v5/pkg/compression/internal"
 	"github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/storage/pkg/chunked/compressor"
+	dsnetbzip2 "github.com/dsnet/compress/bzip2"
 	"github.com/klauspost/pgzip"
 	"github.com/sirupsen/logrus"
 	"github.com/ulikunitz/xz"
@@ -84,13 +86,31 @@ func gzipCompressor(r io.Writer, metadata map[string]string, level *int) (io.Wri
 }
 
 // bzip2Compressor is a CompressorFunc for the bzip2 compression algorithm.
+// The level (1…9) selects the block size, in units of 100 kB.
 func bzip2Compressor(r io.Writer, metadata map[string]string, level *int) (io.WriteCloser, error) {
-	return nil, fmt.Errorf("bzip2 compression not supported")
+	if level == nil {
+		return dsnetbzip2.NewWriter(r, nil)
+	}
+	// dsnetbzip2 treats 0 as the default level, reject it explicitly.
+	if *level < dsnetbzip2.BestSpeed || *level > dsnetbzip2.BestCompression {
+		return nil, fmt.Errorf("invalid bzip2 compression level %d, must be between %d and %d", *level, dsnetbzip2.BestSpeed, dsnetbzip2.BestCompression)
+	}
+	return dsnetbzip2.NewWriter(r, &dsnetbzip2.WriterConfig{Level: *level})
 }
 
+// xzDictionarySizes are the dictionary sizes used for xz compression levels 0…9, matching the presets of xz(1).
+var xzDictionarySizes = []int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
 // xzCompressor is a CompressorFunc for the xz compression algorithm.
+// The level (0…9) selects the dictionary size.
 func xzCompressor(r io.Writer, metadata map[string]string, level *int) (io.WriteCloser, error) {
-	return xz.NewWriter(r)
+	if level == nil {
+		return xz.NewWriter(r)
+	}
+	if *level < 0 || *level >= len(xzDictionarySizes) {
+		return nil, fmt.Errorf("invalid xz compression level %d, must be between 0 and %d", *level, len(xzDictionarySizes)-1)
+	}
+	return xz.WriterConfig{DictCap: xzDictionarySizes[*level]}.NewWriter(r)
 }
 
 // CompressStream returns the compressor by its name
@@ -105,6 +125,80 @@ func CompressStreamWithMetadata(dest io.Writer, metadata map[string]string, algo
 	return internal.AlgorithmCompressor(algo)(dest, metadata, level)
 }
 
+// CompressorOptions are options for CompressStreamWithOptions.
+type CompressorOptions struct {
+	Level *int // Compression level, or nil to use the algorithm’s default.
+
+	// The following options are only used by the Zstd algorithm, and ignored by others:
+
+	// ZstdWindowSize, if not 0, is the maximum window size, in bytes; it must be a power of two, between 1 KiB and 512 MiB.
+	// Larger values may improve compression, but use more memory both when compressing and decompressing.
+	ZstdWindowSize int
+	// ZstdConcurrency, if not 0, is the maximum number of goroutines used to compress a single stream.
+	// The default is GOMAXPROCS.
+	ZstdConcurrency int
+}
+
+// CompressStreamWithOptions returns a compressor for algo, configured using options.  If the compression
+// generates any metadata, it is written to the provided metadata map.
+func CompressStreamWithOptions(dest io.Writer, metadata map[string]string, algo Algorithm, options CompressorOptions) (io.WriteCloser, error) {
+	if options.ZstdWindowSize < 0 {
+		return nil, fmt.Errorf("invalid zstd window size %d", options.ZstdWindowSize)
+	}
+	if options.ZstdConcurrency < 0 {
+		return nil, fmt.Errorf("invalid zstd concurrency %d", options.ZstdConcurrency)
+	}
+	if algo.Name() == types.ZstdAlgorithmName && (options.ZstdWindowSize != 0 || options.ZstdConcurrency != 0) {
+		return zstdWriterWithOptions(dest, options)
+	}
+	return internal.AlgorithmCompressor(algo)(dest, metadata, options.Level)
+}
+
+// DecompressorOptions are options for DecompressorWithOptions.
+type DecompressorOptions struct {
+	// The following options are only used by the Gzip algorithm, and ignored by others:
+
+	// GzipBlockSize, if not 0, is the size, in bytes, of blocks read ahead and decompressed in parallel.
+	// It must be larger than 512; the default is 1 MiB.
+	GzipBlockSize int
+	// GzipBlocks, if not 0, is the number of blocks read ahead and decompressed in parallel.
+	// Memory usage is roughly GzipBlockSize × GzipBlocks. The default is 4; 1 disables parallel decompression.
+	GzipBlocks int
+	// GzipDecompressor, if not nil, is used instead of the default parallel implementation;
+	// GzipBlockSize and GzipBlocks are then ignored.
+	GzipDecompressor DecompressorFunc
+}
+
+// DecompressorWithOptions returns a DecompressorFunc for algo, configured using options.
+func DecompressorWithOptions(algo Algorithm, options DecompressorOptions) (DecompressorFunc, error) {
+	if options.GzipBlockSize < 0 || (options.GzipBlockSize != 0 && options.GzipBlockSize <= 512) {
+		return nil, fmt.Errorf("invalid gzip block size %d, must be larger than 512", options.GzipBlockSize)
+	}
+	if options.GzipBlocks < 0 {
+		return nil, fmt.Errorf("invalid number of gzip blocks %d", options.GzipBlocks)
+	}
+	if algo.Name() == types.GzipAlgorithmName {
+		if options.GzipDecompressor != nil {
+			return options.GzipDecompressor, nil
+		}
+		if options.GzipBlocks == 1 {
+			return func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			}, nil
+		}
+		if options.GzipBlockSize != 0 || options.GzipBlocks != 0 {
+			return func(r io.Reader) (io.ReadCloser, error) {
+				return pgzip.NewReaderN(r, options.GzipBlockSize, options.GzipBlocks)
+			}, nil
+		}
+	}
+	decompressor := internal.AlgorithmDecompressor(algo)
+	if decompressor == nil {
+		return nil, fmt.Errorf("decompression of %q is not supported", algo.Name())
+	}
+	return decompressor, nil
+}
+
 // DetectCompressionFormat returns an Algorithm and DecompressorFunc if the input is recognized as a compressed format, an invalid
 // value and nil otherwise.
 // Because it consumes the start of input, other consumers must use the returned io.Reader instead to also read from the beginning.
@@ -126,3 +126,155 @@ func TestAutoDecompress(t *testing.T) {
 	_, _, err = AutoDecompress(reader)
 	assert.Error(t, err)
 }
+
+func TestCompressStreamWithOptions(t *testing.T) {
+	level := 19
+	for _, c := range []struct {
+		algo    Algorithm
+		options CompressorOptions
+	}{
+		{Zstd, CompressorOptions{}},
+		{Zstd, CompressorOptions{Level: &level}},
+		{Zstd, CompressorOptions{ZstdWindowSize: 1 << 20}},
+		{Zstd, CompressorOptions{Level: &level, ZstdWindowSize: 1 << 20, ZstdConcurrency: 1}},
+		{Gzip, CompressorOptions{ZstdWindowSize: 1 << 20, ZstdConcurrency: 2}}, // zstd options are ignored
+	} {
+		var compressed bytes.Buffer
+		compressor, err := CompressStreamWithOptions(&compressed, map[string]string{}, c.algo, c.options)
+		require.NoError(t, err, c.algo.Name())
+		_, err = compressor.Write([]byte("Hello"))
+		require.NoError(t, err)
+		err = compressor.Close()
+		require.NoError(t, err)
+
+		algo, _, _, err := DetectCompressionFormat(bytes.NewReader(compressed.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, c.algo.Name(), algo.Name())
+		uncompressedStream, _, err := AutoDecompress(&compressed)
+		require.NoError(t, err)
+		defer uncompressedStream.Close()
+		uncompressedContents, err := io.ReadAll(uncompressedStream)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("Hello"), uncompressedContents)
+	}
+
+	for _, options := range []CompressorOptions{
+		{ZstdWindowSize: -1},
+		{ZstdWindowSize: 1000}, // Not a power of two
+		{ZstdWindowSize: 1 << 10 >> 1},
+		{ZstdConcurrency: -1},
+	} {
+		_, err := CompressStreamWithOptions(io.Discard, map[string]string{}, Zstd, options)
+		assert.Error(t, err, "%#v", options)
+	}
+}
+
+func TestCompressStreamLevels(t *testing.T) {
+	data := bytes.Repeat([]byte("Hello, world! "), 10000)
+	for _, c := range []struct {
+		algo   Algorithm
+		levels []int
+	}{
+		{Bzip2, []int{1, 9}},
+		{Xz, []int{0, 6, 9}},
+	} {
+		for _, level := range append([]*int{nil}, intPointers(c.levels)...) {
+			var compressed bytes.Buffer
+			compressor, err := CompressStream(&compressed, c.algo, level)
+			require.NoError(t, err, c.algo.Name())
+			_, err = compressor.Write(data)
+			require.NoError(t, err)
+			err = compressor.Close()
+			require.NoError(t, err)
+
+			algo, _, _, err := DetectCompressionFormat(bytes.NewReader(compressed.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, c.algo.Name(), algo.Name())
+			uncompressedStream, _, err := AutoDecompress(&compressed)
+			require.NoError(t, err)
+			uncompressedContents, err := io.ReadAll(uncompressedStream)
+			require.NoError(t, err)
+			uncompressedStream.Close()
+			assert.Equal(t, data, uncompressedContents)
+		}
+	}
+
+	for _, c := range []struct {
+		algo  Algorithm
+		level int
+	}{
+		{Bzip2, 0},
+		{Bzip2, 10},
+		{Xz, -1},
+		{Xz, 10},
+	} {
+		_, err := CompressStream(io.Discard, c.algo, &c.level)
+		assert.Error(t, err, "%s %d", c.algo.Name(), c.level)
+	}
+}
+
+func intPointers(values []int) []*int {
+	res := []*int{}
+	for i := range values {
+		res = append(res, &values[i])
+	}
+	return res
+}
+
+func TestDecompressorWithOptions(t *testing.T) {
+	data := bytes.Repeat([]byte("Hello, world! "), 100000)
+	var compressed bytes.Buffer
+	compressor, err := CompressStream(&compressed, Gzip, nil)
+	require.NoError(t, err)
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	usedCustom := false
+	custom := func(r io.Reader) (io.ReadCloser, error) {
+		usedCustom = true
+		return GzipDecompressor(r)
+	}
+	for _, c := range []struct {
+		options    DecompressorOptions
+		usesCustom bool
+	}{
+		{DecompressorOptions{}, false},
+		{DecompressorOptions{GzipBlockSize: 64 << 10}, false},
+		{DecompressorOptions{GzipBlocks: 1}, false},
+		{DecompressorOptions{GzipBlockSize: 64 << 10, GzipBlocks: 16}, false},
+		{DecompressorOptions{GzipBlockSize: 64 << 10, GzipDecompressor: custom}, true},
+	} {
+		usedCustom = false
+		decompressor, err := DecompressorWithOptions(Gzip, c.options)
+		require.NoError(t, err)
+		s, err := decompressor(bytes.NewReader(compressed.Bytes()))
+		require.NoError(t, err)
+		decompressed, err := io.ReadAll(s)
+		require.NoError(t, err)
+		s.Close()
+		assert.Equal(t, data, decompressed)
+		assert.Equal(t, c.usesCustom, usedCustom)
+	}
+
+	// Gzip options are ignored for other algorithms
+	usedCustom = false
+	decompressor, err := DecompressorWithOptions(Zstd, DecompressorOptions{GzipBlocks: 1, GzipDecompressor: custom})
+	require.NoError(t, err)
+	s, err := decompressor(bytes.NewReader(compressed.Bytes()))
+	if err == nil {
+		_, err = io.ReadAll(s)
+		s.Close()
+	}
+	assert.Error(t, err) // The zstd decompressor can’t read gzip data
+	assert.False(t, usedCustom)
+
+	for _, options := range []DecompressorOptions{
+		{GzipBlockSize: -1},
+		{GzipBlockSize: 512},
+		{GzipBlocks: -1},
+	} {
+		_, err := DecompressorWithOptions(Gzip, options)
+		assert.Error(t, err, "%#v", options)
+	}
+}
@@ -45,6 +45,21 @@ func zstdWriterWithLevel(dest io.Writer, level int) (*zstd.Encoder, error) {
 	return zstd.NewWriter(dest, zstd.WithEncoderLevel(el))
 }
 
+// zstdWriterWithOptions returns a zstd compressor configured using options.
+func zstdWriterWithOptions(dest io.Writer, options CompressorOptions) (*zstd.Encoder, error) {
+	zstdOptions := []zstd.EOption{}
+	if options.Level != nil {
+		zstdOptions = append(zstdOptions, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(*options.Level)))
+	}
+	if options.ZstdWindowSize != 0 {
+		zstdOptions = append(zstdOptions, zstd.WithWindowSize(options.ZstdWindowSize))
+	}
+	if options.ZstdConcurrency != 0 {
+		zstdOptions = append(zstdOptions, zstd.WithEncoderConcurrency(options.ZstdConcurrency))
+	}
+	return zstd.NewWriter(dest, zstdOptions...)
+}
+
 // zstdCompressor is a CompressorFunc for the zstd compression algorithm.
 func zstdCompressor(r io.Writer, metadata map[string]string, level *int) (io.WriteCloser, error) {
 	if level == nil {
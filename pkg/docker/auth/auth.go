@@ -0,0 +1,78 @@
+// Package auth implements obtaining identity tokens for container registries which use OAuth 2.0,
+// using the device authorization grant (RFC 8628).
+//
+// The resulting identity token can be stored using pkg/docker/config.SetIdentityToken; the docker transport
+// then uses it to obtain access tokens, renewing them transparently as they expire.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// DeviceAuthorizationOptions are options for DeviceAuthorizationIdentityToken.
+type DeviceAuthorizationOptions struct {
+	DeviceAuthorizationURL string   // The device authorization endpoint of the authorization server.
+	TokenURL               string   // The token endpoint of the authorization server.
+	ClientID               string   // The client identifier registered with the authorization server.
+	ClientSecret           string   // The client secret, if any.
+	Scopes                 []string // Scopes to request, if any.
+	// InteractiveOutput receives instructions for the user.
+	// It must be directly accessible to a human user in real time (i.e. not be just a log file).
+	InteractiveOutput io.Writer
+	// HTTPClient, if not nil, is used for all requests to the authorization server.
+	HTTPClient *http.Client
+}
+
+// DeviceAuthorizationIdentityToken asks the user to authorize this device, waits until they do so
+// (or until the request expires, or ctx is canceled), and returns the issued identity token
+// (an OAuth 2.0 refresh token).
+func DeviceAuthorizationIdentityToken(ctx context.Context, options DeviceAuthorizationOptions) (string, error) {
+	if options.DeviceAuthorizationURL == "" || options.TokenURL == "" {
+		return "", errors.New("both a device authorization URL and a token URL must be specified")
+	}
+	if options.ClientID == "" {
+		return "", errors.New("a client ID must be specified")
+	}
+	if options.InteractiveOutput == nil {
+		return "", errors.New("the device authorization grant requires an interactive output")
+	}
+	if options.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, options.HTTPClient)
+	}
+	config := oauth2.Config{
+		ClientID:     options.ClientID,
+		ClientSecret: options.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: options.DeviceAuthorizationURL,
+			TokenURL:      options.TokenURL,
+		},
+		Scopes: options.Scopes,
+	}
+
+	logrus.Debugf("Starting a device authorization grant at %s", options.DeviceAuthorizationURL)
+	authorization, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return "", fmt.Errorf("requesting device authorization: %w", err)
+	}
+	if authorization.VerificationURIComplete != "" {
+		fmt.Fprintf(options.InteractiveOutput, "To log in, visit %s\nand confirm the code %s\n", authorization.VerificationURIComplete, authorization.UserCode)
+	} else {
+		fmt.Fprintf(options.InteractiveOutput, "To log in, visit %s\nand enter the code %s\n", authorization.VerificationURI, authorization.UserCode)
+	}
+
+	token, err := config.DeviceAccessToken(ctx, authorization)
+	if err != nil {
+		return "", fmt.Errorf("waiting for device authorization: %w", err)
+	}
+	if token.RefreshToken == "" {
+		return "", errors.New("the authorization server did not issue a refresh token")
+	}
+	return token.RefreshToken, nil
+}
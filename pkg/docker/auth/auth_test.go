@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceAuthorizationIdentityToken(t *testing.T) {
+	for _, c := range []struct {
+		name          string
+		tokenResponse string
+		expected      string // "" if an error is expected
+	}{
+		{"success", `{"access_token":"access","token_type":"bearer","refresh_token":"refresh"}`, "refresh"},
+		{"no refresh token", `{"access_token":"access","token_type":"bearer"}`, ""},
+		{"denied", `{"error":"access_denied"}`, ""},
+	} {
+		polls := 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "client", r.PostForm.Get("client_id"))
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"device_code":"device","user_code":"USER-CODE","verification_uri":"https://example.com/verify","expires_in":60,"interval":1}`)
+		})
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:device_code", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "device", r.PostForm.Get("device_code"))
+			w.Header().Set("Content-Type", "application/json")
+			polls++
+			if polls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"authorization_pending"}`)
+				return
+			}
+			if c.expected == "" && c.tokenResponse == `{"error":"access_denied"}` {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			fmt.Fprint(w, c.tokenResponse)
+		})
+		s := httptest.NewServer(mux)
+		defer s.Close()
+
+		var output bytes.Buffer
+		res, err := DeviceAuthorizationIdentityToken(context.Background(), DeviceAuthorizationOptions{
+			DeviceAuthorizationURL: s.URL + "/device",
+			TokenURL:               s.URL + "/token",
+			ClientID:               "client",
+			InteractiveOutput:      &output,
+			HTTPClient:             s.Client(),
+		})
+		if c.expected == "" {
+			assert.Error(t, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+			assert.Equal(t, c.expected, res, c.name)
+		}
+		assert.Contains(t, output.String(), "https://example.com/verify", c.name)
+		assert.Contains(t, output.String(), "USER-CODE", c.name)
+		assert.Equal(t, 2, polls, c.name)
+	}
+
+	for _, options := range []DeviceAuthorizationOptions{
+		{TokenURL: "https://example.com/token", ClientID: "client", InteractiveOutput: &bytes.Buffer{}},
+		{DeviceAuthorizationURL: "https://example.com/device", ClientID: "client", InteractiveOutput: &bytes.Buffer{}},
+		{DeviceAuthorizationURL: "https://example.com/device", TokenURL: "https://example.com/token", InteractiveOutput: &bytes.Buffer{}},
+		{DeviceAuthorizationURL: "https://example.com/device", TokenURL: "https://example.com/token", ClientID: "client"},
+	} {
+		_, err := DeviceAuthorizationIdentityToken(context.Background(), options)
+		assert.Error(t, err)
+	}
+}
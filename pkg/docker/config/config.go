@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
@@ -33,6 +34,7 @@ type dockerAuthConfig struct {
 type dockerConfigFile struct {
 	AuthConfigs map[string]dockerAuthConfig `json:"auths"`
 	CredHelpers map[string]string           `json:"credHelpers,omitempty"`
+	CredsStore  string                      `json:"credsStore,omitempty"`
 }
 
 var (
@@ -96,6 +98,19 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 				for registry := range fileContents.CredHelpers {
 					allKeys.Add(registry)
 				}
+				if credsStoreAvailable(fileContents.CredsStore) {
+					creds, err := listCredsInCredHelper(fileContents.CredsStore)
+					if err != nil {
+						return nil, fmt.Errorf("listing credentials stored in credential store %s: %w", fileContents.CredsStore, err)
+					}
+					for serverURL := range creds {
+						key := normalizeAuthFileKey(serverURL, false)
+						if key == normalizedDockerIORegistry {
+							key = "docker.io"
+						}
+						allKeys.Add(key)
+					}
+				}
 				for key := range fileContents.AuthConfigs {
 					key := normalizeAuthFileKey(key, path.legacyFormat)
 					if key == normalizedDockerIORegistry {
@@ -138,12 +153,28 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 	return allCreds, nil
 }
 
+// AuthFilePaths returns the paths of the registry authentication files used when reading credentials,
+// in the order they are searched. Note that some paths may not exist.
+func AuthFilePaths(sys *types.SystemContext) []string {
+	res := []string{}
+	for _, path := range getAuthFilePaths(sys, homedir.Get()) {
+		res = append(res, path.path)
+	}
+	return res
+}
+
 // getAuthFilePaths returns a slice of authPaths based on the system context
 // in the order they should be searched. Note that some paths may not exist.
 // The homeDir parameter should always be homedir.Get(), and is only intended to be overridden
 // by tests.
 func getAuthFilePaths(sys *types.SystemContext, homeDir string) []authPath {
 	paths := []authPath{}
+	if sys != nil && sys.AuthFileSearchPaths != nil {
+		for _, path := range sys.AuthFileSearchPaths {
+			paths = append(paths, authPath{path: path, legacyFormat: filepath.Base(path) == dockerLegacyHomePath})
+		}
+		return paths
+	}
 	pathToAuth, userSpecifiedPath, err := getPathToAuth(sys)
 	if err == nil {
 		paths = append(paths, pathToAuth)
@@ -173,16 +204,43 @@ func getAuthFilePaths(sys *types.SystemContext, homeDir string) []authPath {
 	return paths
 }
 
+// CredentialsSource describes where credentials returned by LookupCredentials or LookupCredentialsForRef were found.
+type CredentialsSource struct {
+	// The credential helper which returned the credentials; sysregistriesv2.AuthenticationFileHelper for auth files,
+	// or "" if the credentials were provided in types.SystemContext.DockerAuthConfig.
+	Helper string
+	// If Helper is sysregistriesv2.AuthenticationFileHelper, the auth file which contains the credentials
+	// (or which configures the credential helper storing them).
+	Path string
+	// If Helper is sysregistriesv2.AuthenticationFileHelper, the auth file key which matched:
+	// a repository, a namespace within a registry, or a registry hostname.
+	Key string
+}
+
 // GetCredentials returns the registry credentials matching key, appropriate for
 // sys and the users’ configuration.
 // If an entry is not found, an empty struct is returned.
-// A valid key is a repository, a namespace within a registry, or a registry hostname.
+// A valid key is a repository, a namespace within a registry, or a registry hostname;
+// auth files may contain credentials for any of those, and credentials for the most specific
+// matching key are used, e.g. quay.io/teamA rather than quay.io for quay.io/teamA/image.
 //
 // GetCredentialsForRef should almost always be used in favor of this API.
 func GetCredentials(sys *types.SystemContext, key string) (types.DockerAuthConfig, error) {
 	return getCredentialsWithHomeDir(sys, key, homedir.Get())
 }
 
+// LookupCredentials is like GetCredentials, and also returns where the credentials were found,
+// or nil if no credentials were found.
+func LookupCredentials(sys *types.SystemContext, key string) (types.DockerAuthConfig, *CredentialsSource, error) {
+	return lookupCredentialsWithHomeDir(sys, key, homedir.Get())
+}
+
+// LookupCredentialsForRef is like GetCredentialsForRef, and also returns where the credentials were found,
+// or nil if no credentials were found.
+func LookupCredentialsForRef(sys *types.SystemContext, ref reference.Named) (types.DockerAuthConfig, *CredentialsSource, error) {
+	return lookupCredentialsWithHomeDir(sys, ref.Name(), homedir.Get())
+}
+
 // GetCredentialsForRef returns the registry credentials necessary for
 // accessing ref on the registry ref points to,
 // appropriate for sys and the users’ configuration.
@@ -195,14 +253,22 @@ func GetCredentialsForRef(sys *types.SystemContext, ref reference.Named) (types.
 // GetCredentialsForRef and GetCredentials. It exists only to allow testing it
 // with an artificial home directory.
 func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (types.DockerAuthConfig, error) {
+	creds, _, err := lookupCredentialsWithHomeDir(sys, key, homeDir)
+	return creds, err
+}
+
+// lookupCredentialsWithHomeDir is an internal implementation detail of
+// LookupCredentialsForRef, LookupCredentials and getCredentialsWithHomeDir.
+// It exists only to allow testing it with an artificial home directory.
+func lookupCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (types.DockerAuthConfig, *CredentialsSource, error) {
 	_, err := validateKey(key)
 	if err != nil {
-		return types.DockerAuthConfig{}, err
+		return types.DockerAuthConfig{}, nil, err
 	}
 
 	if sys != nil && sys.DockerAuthConfig != nil {
 		logrus.Debugf("Returning credentials for %s from DockerAuthConfig", key)
-		return *sys.DockerAuthConfig, nil
+		return *sys.DockerAuthConfig, &CredentialsSource{}, nil
 	}
 
 	var registry string // We compute this once because it is used in several places.
@@ -213,23 +279,41 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 	}
 
 	// Anonymous function to query credentials from auth files.
-	getCredentialsFromAuthFiles := func() (types.DockerAuthConfig, string, error) {
+	// Credentials for the most specific matching key win, regardless of the file containing them;
+	// if several files contain credentials for that key, the first one wins.
+	getCredentialsFromAuthFiles := func() (types.DockerAuthConfig, string, string, error) {
+		keys := authKeysForKey(key)
+		var (
+			bestCreds types.DockerAuthConfig
+			bestPath  string
+			bestKey   string
+		)
 		for _, path := range getAuthFilePaths(sys, homeDir) {
-			creds, err := findCredentialsInFile(key, registry, path)
+			creds, matchedKey, err := findCredentialsInFile(keys, registry, path)
 			if err != nil {
-				return types.DockerAuthConfig{}, "", err
+				if bestPath != "" {
+					// We already have credentials; don’t fail just because a less preferred file is unusable.
+					logrus.Debugf("Ignoring error looking for credentials more specific than %s: %v", bestKey, err)
+					continue
+				}
+				return types.DockerAuthConfig{}, "", "", err
 			}
 
 			if creds != (types.DockerAuthConfig{}) {
-				return creds, path.path, nil
+				bestCreds, bestPath, bestKey = creds, path.path, matchedKey
+				i := slices.Index(keys, matchedKey)
+				if i <= 0 { // Nothing can be more specific.
+					break
+				}
+				keys = keys[:i]
 			}
 		}
-		return types.DockerAuthConfig{}, "", nil
+		return bestCreds, bestPath, bestKey, nil
 	}
 
 	helpers, err := sysregistriesv2.CredentialHelpers(sys)
 	if err != nil {
-		return types.DockerAuthConfig{}, err
+		return types.DockerAuthConfig{}, nil, err
 	}
 
 	var multiErr []error
@@ -238,13 +322,14 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 			creds          types.DockerAuthConfig
 			helperKey      string
 			credHelperPath string
+			matchedKey     string
 			err            error
 		)
 		switch helper {
 		// Special-case the built-in helper for auth files.
 		case sysregistriesv2.AuthenticationFileHelper:
 			helperKey = key
-			creds, credHelperPath, err = getCredentialsFromAuthFiles()
+			creds, credHelperPath, matchedKey, err = getCredentialsFromAuthFiles()
 		// External helpers.
 		default:
 			// This intentionally uses "registry", not "key"; we don't support namespaced
@@ -263,15 +348,15 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 				msg = fmt.Sprintf("%s in file %s", msg, credHelperPath)
 			}
 			logrus.Debug(msg)
-			return creds, nil
+			return creds, &CredentialsSource{Helper: helper, Path: credHelperPath, Key: matchedKey}, nil
 		}
 	}
 	if multiErr != nil {
-		return types.DockerAuthConfig{}, multierr.Format("errors looking up credentials:\n\t* ", "\nt* ", "\n", multiErr)
+		return types.DockerAuthConfig{}, nil, multierr.Format("errors looking up credentials:\n\t* ", "\nt* ", "\n", multiErr)
 	}
 
 	logrus.Debugf("No credentials for %s found", key)
-	return types.DockerAuthConfig{}, nil
+	return types.DockerAuthConfig{}, nil, nil
 }
 
 // GetAuthentication returns the registry credentials matching key, appropriate for
@@ -308,6 +393,19 @@ func getAuthenticationWithHomeDir(sys *types.SystemContext, key, homeDir string)
 // NOTE: The return value is only intended to be read by humans; its form is not an API,
 // it may change (or new forms can be added) any time.
 func SetCredentials(sys *types.SystemContext, key, username, password string) (string, error) {
+	return setCredentials(sys, key, types.DockerAuthConfig{Username: username, Password: password})
+}
+
+// SetIdentityToken stores an identity token (an OAuth 2.0 refresh token, e.g. as obtained by pkg/docker/auth)
+// in a location appropriate for sys and the users’ configuration, replacing any other credentials for key.
+// See the documentation of SetCredentials for the format of "key" and of the return value.
+func SetIdentityToken(sys *types.SystemContext, key, identityToken string) (string, error) {
+	return setCredentials(sys, key, types.DockerAuthConfig{IdentityToken: identityToken})
+}
+
+// setCredentials is the implementation of SetCredentials and SetIdentityToken.
+// creds must contain either a username and password, or an identity token.
+func setCredentials(sys *types.SystemContext, key string, creds types.DockerAuthConfig) (string, error) {
 	helpers, jsonEditor, key, isNamespaced, err := prepareForEdit(sys, key, true)
 	if err != nil {
 		return "", err
@@ -326,14 +424,18 @@ func SetCredentials(sys *types.SystemContext, key, username, password string) (s
 					if isNamespaced {
 						return false, "", unsupportedNamespaceErr(ch)
 					}
-					desc, err := setCredsInCredHelper(ch, key, username, password)
+					desc, err := setCredsInCredHelper(ch, key, creds)
 					if err != nil {
 						return false, "", err
 					}
 					return false, desc, nil
 				}
-				creds := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
-				newCreds := dockerAuthConfig{Auth: creds}
+				var newCreds dockerAuthConfig
+				if creds.IdentityToken != "" {
+					newCreds.IdentityToken = creds.IdentityToken
+				} else {
+					newCreds.Auth = base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))
+				}
 				fileContents.AuthConfigs[key] = newCreds
 				return true, "", nil
 			})
@@ -342,7 +444,7 @@ func SetCredentials(sys *types.SystemContext, key, username, password string) (s
 			if isNamespaced {
 				err = unsupportedNamespaceErr(helper)
 			} else {
-				desc, err = setCredsInCredHelper(helper, key, username, password)
+				desc, err = setCredsInCredHelper(helper, key, creds)
 			}
 		}
 		if err != nil {
@@ -536,6 +638,17 @@ func prepareForEdit(sys *types.SystemContext, key string, keyRelevant bool) ([]s
 }
 
 func listCredsInCredHelper(credHelper string) (map[string]string, error) {
+	if store, ok := registeredCredentialStore(credHelper); ok {
+		registries, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		res := map[string]string{}
+		for _, registry := range registries {
+			res[registry] = ""
+		}
+		return res, nil
+	}
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
 	return helperclient.List(p)
@@ -753,6 +866,9 @@ func modifyDockerConfigJSON(sys *types.SystemContext, editor func(fileContents *
 }
 
 func getCredsFromCredHelper(credHelper, registry string) (types.DockerAuthConfig, error) {
+	if store, ok := registeredCredentialStore(credHelper); ok {
+		return store.Get(registry)
+	}
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
 	creds, err := helperclient.Get(p, registry)
@@ -777,51 +893,91 @@ func getCredsFromCredHelper(credHelper, registry string) (types.DockerAuthConfig
 	}
 }
 
-// setCredsInCredHelper stores (username, password) for registry in credHelper.
+// setCredsInCredHelper stores creds (either a username and password, or an identity token) for registry in credHelper.
 // Returns a human-readable description of the destination, to be returned by SetCredentials.
-func setCredsInCredHelper(credHelper, registry, username, password string) (string, error) {
+func setCredsInCredHelper(credHelper, registry string, creds types.DockerAuthConfig) (string, error) {
+	if store, ok := registeredCredentialStore(credHelper); ok {
+		if err := store.Store(registry, creds); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("credential store: %s", credHelper), nil
+	}
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
-	creds := &credentials.Credentials{
+	helperCreds := &credentials.Credentials{
 		ServerURL: registry,
-		Username:  username,
-		Secret:    password,
+		Username:  creds.Username,
+		Secret:    creds.Password,
+	}
+	if creds.IdentityToken != "" {
+		// The convention understood by getCredsFromCredHelper, and by Docker.
+		helperCreds.Username = "<token>"
+		helperCreds.Secret = creds.IdentityToken
 	}
-	if err := helperclient.Store(p, creds); err != nil {
+	if err := helperclient.Store(p, helperCreds); err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("credential helper: %s", credHelper), nil
 }
 
 func deleteCredsFromCredHelper(credHelper, registry string) error {
+	if store, ok := registeredCredentialStore(credHelper); ok {
+		err := store.Erase(registry)
+		if errors.Is(err, ErrNotLoggedIn) {
+			// Callers recognize this error by its message, as if it came from an external helper.
+			err = credentials.NewErrCredentialsNotFound()
+		}
+		return err
+	}
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
 	return helperclient.Erase(p, registry)
 }
 
-// findCredentialsInFile looks for credentials matching "key"
-// (which is "registry" or a namespace in "registry") in "path".
-func findCredentialsInFile(key, registry string, path authPath) (types.DockerAuthConfig, error) {
+// findCredentialsInFile looks for credentials matching one of "keys"
+// (namespaces in "registry" or "registry" itself, as returned by authKeysForKey, possibly
+// truncated to omit the least specific ones) in "path".
+// It returns the credentials and the matching element of keys, or "" if no credentials were found.
+func findCredentialsInFile(keys []string, registry string, path authPath) (types.DockerAuthConfig, string, error) {
 	fileContents, err := path.parse()
 	if err != nil {
-		return types.DockerAuthConfig{}, fmt.Errorf("reading JSON file %q: %w", path.path, err)
-	}
+		return types.DockerAuthConfig{}, "", fmt.Errorf("reading JSON file %q: %w", path.path, err)
+	}
+	// Credential helpers, the credential store, and legacy files only support registry keys.
+	registryRelevant := len(keys) != 0 && keys[len(keys)-1] == registry
+
+	if registryRelevant {
+		// First try cred helpers. They should always be normalized.
+		// This intentionally uses "registry", not "key"; we don't support namespaced
+		// credentials in helpers.
+		if ch, exists := fileContents.CredHelpers[registry]; exists {
+			logrus.Debugf("Looking up in credential helper %s based on credHelpers entry in %s", ch, path.path)
+			creds, err := getCredsFromCredHelper(ch, registry)
+			return creds, registry, err
+		}
 
-	// First try cred helpers. They should always be normalized.
-	// This intentionally uses "registry", not "key"; we don't support namespaced
-	// credentials in helpers.
-	if ch, exists := fileContents.CredHelpers[registry]; exists {
-		logrus.Debugf("Looking up in credential helper %s based on credHelpers entry in %s", ch, path.path)
-		return getCredsFromCredHelper(ch, registry)
+		// Then try the default credential store, if any.
+		// Unlike Docker, fall back to "auths" if the store has no credentials for the registry;
+		// the file may be shared with tools which don’t use the store.
+		if credsStoreAvailable(fileContents.CredsStore) {
+			logrus.Debugf("Looking up in credential store %s based on credsStore entry in %s", fileContents.CredsStore, path.path)
+			creds, err := getCredsFromCredHelper(fileContents.CredsStore, credsStoreServerURL(registry))
+			if err != nil {
+				return types.DockerAuthConfig{}, "", err
+			}
+			if creds != (types.DockerAuthConfig{}) {
+				return creds, registry, nil
+			}
+		}
 	}
 
 	// Support sub-registry namespaces in auth.
 	// (This is not a feature of ~/.docker/config.json; we support it even for
 	// those files as an extension.)
-	var keys []string
-	if !path.legacyFormat {
-		keys = authKeysForKey(key)
-	} else {
+	if path.legacyFormat {
+		if !registryRelevant {
+			return types.DockerAuthConfig{}, "", nil
+		}
 		keys = []string{registry}
 	}
 
@@ -829,9 +985,13 @@ func findCredentialsInFile(key, registry string, path authPath) (types.DockerAut
 	// keys we prefer exact matches as well.
 	for _, key := range keys {
 		if val, exists := fileContents.AuthConfigs[key]; exists {
-			return decodeDockerAuth(path.path, key, val)
+			creds, err := decodeDockerAuth(path.path, key, val)
+			return creds, key, err
 		}
 	}
+	if !registryRelevant {
+		return types.DockerAuthConfig{}, "", nil
+	}
 
 	// bad luck; let's normalize the entries first
 	// This primarily happens for legacyFormat, which for a time used API URLs
@@ -841,17 +1001,18 @@ func findCredentialsInFile(key, registry string, path authPath) (types.DockerAut
 	// those entries even in non-legacyFormat ~/.docker/config.json.
 	// The docker.io registry still uses the /v1/ key with a special host name,
 	// so account for that as well.
-	registry = normalizeRegistry(registry)
+	normalizedRegistry := normalizeRegistry(registry)
 	for k, v := range fileContents.AuthConfigs {
-		if normalizeAuthFileKey(k, path.legacyFormat) == registry {
-			return decodeDockerAuth(path.path, k, v)
+		if normalizeAuthFileKey(k, path.legacyFormat) == normalizedRegistry {
+			creds, err := decodeDockerAuth(path.path, k, v)
+			return creds, registry, err
 		}
 	}
 
 	// Only log this if we found nothing; getCredentialsWithHomeDir logs the
 	// source of found data.
-	logrus.Debugf("No credentials matching %s found in %s", key, path.path)
-	return types.DockerAuthConfig{}, nil
+	logrus.Debugf("No credentials matching %s found in %s", keys[0], path.path)
+	return types.DockerAuthConfig{}, "", nil
 }
 
 // authKeysForKey returns the keys matching a provided auth file key, in order
@@ -878,6 +1039,10 @@ func authKeysForKey(key string) (res []string) {
 // decodeDockerAuth decodes the username and password from conf,
 // which is entry key in path.
 func decodeDockerAuth(path, key string, conf dockerAuthConfig) (types.DockerAuthConfig, error) {
+	if conf.Auth == "" && conf.IdentityToken != "" {
+		// Written by SetIdentityToken.
+		return types.DockerAuthConfig{IdentityToken: conf.IdentityToken}, nil
+	}
 	decoded, err := base64.StdEncoding.DecodeString(conf.Auth)
 	if err != nil {
 		return types.DockerAuthConfig{}, err
@@ -915,6 +1080,31 @@ func normalizeAuthFileKey(key string, legacyFormat bool) string {
 	return normalizeRegistry(stripped)
 }
 
+// credsStoreAvailable returns true if credsStore is set and the corresponding helper is installed (or registered
+// using RegisterCredentialStore).
+// A missing helper is not an error; configuration files are sometimes copied between machines.
+func credsStoreAvailable(credsStore string) bool {
+	if credsStore == "" {
+		return false
+	}
+	if _, ok := registeredCredentialStore(credsStore); ok {
+		return true
+	}
+	if _, err := exec.LookPath(fmt.Sprintf("docker-credential-%s", credsStore)); err != nil {
+		logrus.Debugf("Ignoring credential store %s: %v", credsStore, err)
+		return false
+	}
+	return true
+}
+
+// credsStoreServerURL returns the server URL Docker uses as a key for registry in credential stores.
+func credsStoreServerURL(registry string) string {
+	if normalizeRegistry(registry) == "index.docker.io" {
+		return "https://index.docker.io/v1/"
+	}
+	return registry
+}
+
 // normalizeRegistry converts the provided registry if a known docker.io host
 // is provided.
 func normalizeRegistry(registry string) string {
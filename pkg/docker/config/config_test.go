@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -404,6 +405,104 @@ func TestGetAuthPreferNewConfig(t *testing.T) {
 	assert.Equal(t, "io", auth.Password)
 }
 
+func TestAuthFileSearchPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	systemDir := filepath.Join(tmpDir, "system")
+	err := os.Mkdir(systemDir, 0755)
+	require.NoError(t, err)
+	for _, data := range []struct {
+		source string
+		target string
+	}{
+		{filepath.Join("testdata", "example.json"), filepath.Join(tmpDir, "auth.json")},
+		{filepath.Join("testdata", "full.json"), filepath.Join(systemDir, "auth.json")},
+		{filepath.Join("testdata", "legacy.json"), filepath.Join(tmpDir, ".dockercfg")},
+	} {
+		contents, err := os.ReadFile(data.source)
+		require.NoError(t, err)
+		err = os.WriteFile(data.target, contents, 0640)
+		require.NoError(t, err)
+	}
+	sys := &types.SystemContext{
+		AuthFileSearchPaths: []string{
+			filepath.Join(tmpDir, "missing.json"),
+			filepath.Join(tmpDir, "auth.json"),
+			filepath.Join(tmpDir, ".dockercfg"),
+			filepath.Join(systemDir, "auth.json"),
+		},
+	}
+	assert.Equal(t, sys.AuthFileSearchPaths, AuthFilePaths(sys))
+
+	for _, c := range []struct {
+		key          string
+		expectedPass string
+		expectedPath string
+	}{
+		{"example.org", "org", filepath.Join(tmpDir, "auth.json")},
+		{"docker.io", "io-legacy", filepath.Join(tmpDir, ".dockercfg")},
+		{"10.10.30.45", "30.45", filepath.Join(systemDir, "auth.json")},
+		{"unknown.example.com", "", ""},
+	} {
+		creds, source, err := LookupCredentials(sys, c.key)
+		require.NoError(t, err, c.key)
+		assert.Equal(t, c.expectedPass, creds.Password, c.key)
+		if c.expectedPath == "" {
+			assert.Nil(t, source, c.key)
+		} else {
+			require.NotNil(t, source, c.key)
+			assert.Equal(t, c.expectedPath, source.Path, c.key)
+		}
+	}
+
+	// Credentials in DockerAuthConfig take precedence over all files.
+	sys.DockerAuthConfig = &types.DockerAuthConfig{Username: "override"}
+	creds, source, err := LookupCredentials(sys, "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "override", creds.Username)
+	assert.Equal(t, &CredentialsSource{}, source)
+}
+
+func TestNamespacedCredentialsAcrossFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	userPath := filepath.Join(tmpDir, "user.json")
+	mountedPath := filepath.Join(tmpDir, "mounted.json")
+	brokenPath := filepath.Join(tmpDir, "broken.json")
+	for path, contents := range map[string]string{
+		userPath: `{"auths":{` +
+			`"quay.io":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("registry:user")) + `"},` +
+			`"quay.io/team-b":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("team-b:user")) + `"}}}`,
+		mountedPath: `{"auths":{` +
+			`"quay.io/team-a":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("team-a:mounted")) + `"},` +
+			`"quay.io/team-b":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("team-b:mounted")) + `"}}}`,
+		brokenPath: "this is not JSON",
+	} {
+		err := os.WriteFile(path, []byte(contents), 0600)
+		require.NoError(t, err)
+	}
+	sys := &types.SystemContext{AuthFileSearchPaths: []string{userPath, mountedPath, brokenPath}}
+
+	for _, c := range []struct {
+		ref, expectedUser, expectedPass, expectedPath, expectedKey string
+	}{
+		{"quay.io/team-a/image", "team-a", "mounted", mountedPath, "quay.io/team-a"},
+		{"quay.io/team-b/image", "team-b", "user", userPath, "quay.io/team-b"},
+		{"quay.io/team-c/image", "registry", "user", userPath, "quay.io"},
+	} {
+		ref, err := reference.ParseNamed(c.ref)
+		require.NoError(t, err)
+		creds, source, err := LookupCredentialsForRef(sys, ref)
+		require.NoError(t, err, c.ref)
+		assert.Equal(t, types.DockerAuthConfig{Username: c.expectedUser, Password: c.expectedPass}, creds, c.ref)
+		assert.Equal(t, &CredentialsSource{Helper: "containers-auth.json", Path: c.expectedPath, Key: c.expectedKey}, source, c.ref)
+	}
+
+	// If the most specific key can’t be found, an unusable file is an error.
+	ref, err := reference.ParseNamed("example.com/image")
+	require.NoError(t, err)
+	_, _, err = LookupCredentialsForRef(sys, ref)
+	assert.Error(t, err)
+}
+
 func TestGetAuthFailsOnBadInput(t *testing.T) {
 	tmpXDGRuntimeDir := t.TempDir()
 	t.Logf("using temporary XDG_RUNTIME_DIR directory: %q", tmpXDGRuntimeDir)
@@ -629,6 +728,64 @@ func TestGetAllCredentials(t *testing.T) {
 	}
 }
 
+func TestGetCredentialsFromCredsStore(t *testing.T) {
+	// override PATH for executing credHelper
+	path, err := os.Getwd()
+	require.NoError(t, err)
+	origPath := os.Getenv("PATH")
+	newPath := fmt.Sprintf("%s:%s", filepath.Join(path, "testdata"), origPath)
+	t.Setenv("PATH", newPath)
+	t.Logf("using PATH: %q", newPath)
+	err = os.Chmod(filepath.Join(path, "testdata", "docker-credential-helper-registry"), os.ModePerm)
+	require.NoError(t, err)
+	registriesConfPath := filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(registriesConfPath, []byte{}, 0o600) // Use the default credential helpers
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		credsStore string
+		key        string
+		expected   types.DockerAuthConfig
+	}{
+		{"helper-registry", "registry-a.com", types.DockerAuthConfig{Username: "foo", Password: "bar"}},
+		{"helper-registry", "registry-b.com/repo", types.DockerAuthConfig{IdentityToken: "fizzbuzz"}},
+		{"helper-registry", "docker.io/library/busybox", types.DockerAuthConfig{Username: "docker-user", Password: "docker-password"}},
+		// Fall back to "auths" if the store has no credentials
+		{"helper-registry", "example.org", types.DockerAuthConfig{Username: "example", Password: "org"}},
+		{"helper-registry", "registry-no-creds.com", types.DockerAuthConfig{}},
+		// A missing helper is ignored
+		{"does-not-exist", "registry-a.com", types.DockerAuthConfig{}},
+		{"does-not-exist", "example.org", types.DockerAuthConfig{Username: "example", Password: "org"}},
+	} {
+		authFilePath := filepath.Join(t.TempDir(), "config.json")
+		err := os.WriteFile(authFilePath, []byte(`{"credsStore":"`+c.credsStore+`","auths":{"example.org":{"auth":"ZXhhbXBsZTpvcmc="}}}`), 0o600)
+		require.NoError(t, err)
+		sys := &types.SystemContext{
+			AuthFilePath:                authFilePath,
+			SystemRegistriesConfPath:    registriesConfPath,
+			SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+		}
+
+		auth, err := GetCredentials(sys, c.key)
+		require.NoError(t, err, c.key)
+		assert.Equal(t, c.expected, auth, "%s in %s", c.key, c.credsStore)
+	}
+
+	authFilePath := filepath.Join(t.TempDir(), "config.json")
+	err = os.WriteFile(authFilePath, []byte(`{"credsStore":"helper-registry","auths":{"example.org":{"auth":"ZXhhbXBsZTpvcmc="}}}`), 0o600)
+	require.NoError(t, err)
+	authConfigs, err := GetAllCredentials(&types.SystemContext{
+		AuthFilePath:                authFilePath,
+		SystemRegistriesConfPath:    registriesConfPath,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.DockerAuthConfig{
+		"registry-a.com": {Username: "foo", Password: "bar"},
+		"example.org":    {Username: "example", Password: "org"},
+	}, authConfigs)
+}
+
 func TestAuthKeysForKey(t *testing.T) {
 	for _, tc := range []struct {
 		name, input string
@@ -764,6 +921,32 @@ func TestSetCredentials(t *testing.T) {
 	}
 }
 
+func TestSetIdentityToken(t *testing.T) {
+	registriesConfPath := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConfPath, []byte{}, 0o600) // Use the default credential helpers
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		AuthFilePath:                filepath.Join(t.TempDir(), "auth.json"),
+		SystemRegistriesConfPath:    registriesConfPath,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+	_, err = SetCredentials(sys, "registry.example.com", "user", "password")
+	require.NoError(t, err)
+	_, err = SetIdentityToken(sys, "registry.example.com", "token")
+	require.NoError(t, err)
+
+	creds, err := GetCredentials(sys, "registry.example.com/repo")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{IdentityToken: "token"}, creds)
+
+	contents, err := os.ReadFile(sys.AuthFilePath)
+	require.NoError(t, err)
+	var fileContents dockerConfigFile
+	err = json.Unmarshal(contents, &fileContents)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]dockerAuthConfig{"registry.example.com": {IdentityToken: "token"}}, fileContents.AuthConfigs)
+}
+
 func TestRemoveAuthentication(t *testing.T) {
 	testAuth := dockerAuthConfig{Auth: "ZXhhbXBsZTpvcmc="}
 	for _, tc := range []struct {
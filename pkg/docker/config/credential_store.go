@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+)
+
+// CredentialStore is a store of registry credentials, implemented within this process.
+// Once registered using RegisterCredentialStore, it can be used everywhere the name of an external
+// docker-credential-* helper is accepted.
+type CredentialStore interface {
+	// Get returns the credentials stored for registry, or an empty types.DockerAuthConfig if there are none.
+	Get(registry string) (types.DockerAuthConfig, error)
+	// Store stores creds for registry, replacing any previously stored credentials.
+	Store(registry string, creds types.DockerAuthConfig) error
+	// Erase removes the credentials stored for registry, or returns ErrNotLoggedIn if there are none.
+	Erase(registry string) error
+	// List returns all registries with stored credentials.
+	List() ([]string, error)
+}
+
+var (
+	credentialStoresLock sync.Mutex
+	credentialStores     = map[string]CredentialStore{}
+)
+
+// RegisterCredentialStore makes store available under name. The name can then be used like the name
+// of an external credential helper (i.e. everything after docker-credential-), both in the
+// credential-helpers option of registries.conf and in credHelpers and credsStore entries of auth files.
+// It panics if a store with the same name is already registered.
+func RegisterCredentialStore(name string, store CredentialStore) {
+	credentialStoresLock.Lock()
+	defer credentialStoresLock.Unlock()
+	if _, ok := credentialStores[name]; ok {
+		panic(fmt.Sprintf("Duplicate credential store name %s", name))
+	}
+	credentialStores[name] = store
+}
+
+// registeredCredentialStore returns the credential store registered as name, if any.
+func registeredCredentialStore(name string) (CredentialStore, bool) {
+	credentialStoresLock.Lock()
+	defer credentialStoresLock.Unlock()
+	store, ok := credentialStores[name]
+	return store, ok
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCredentialStore is a CredentialStore for tests.
+type memoryCredentialStore struct {
+	mutex sync.Mutex
+	creds map[string]types.DockerAuthConfig
+}
+
+func (s *memoryCredentialStore) Get(registry string) (types.DockerAuthConfig, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.creds[registry], nil
+}
+
+func (s *memoryCredentialStore) Store(registry string, creds types.DockerAuthConfig) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.creds[registry] = creds
+	return nil
+}
+
+func (s *memoryCredentialStore) Erase(registry string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.creds[registry]; !ok {
+		return ErrNotLoggedIn
+	}
+	delete(s.creds, registry)
+	return nil
+}
+
+func (s *memoryCredentialStore) List() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res := []string{}
+	for registry := range s.creds {
+		res = append(res, registry)
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+var testCredentialStore = &memoryCredentialStore{creds: map[string]types.DockerAuthConfig{}}
+
+func init() {
+	RegisterCredentialStore("containers-test-store", testCredentialStore)
+}
+
+func TestRegisterCredentialStore(t *testing.T) {
+	assert.Panics(t, func() { RegisterCredentialStore("containers-test-store", &memoryCredentialStore{}) })
+
+	registriesConfPath := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConfPath, []byte(`credential-helpers = [ "containers-test-store" ]`), 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		AuthFilePath:                filepath.Join(t.TempDir(), "auth.json"),
+		SystemRegistriesConfPath:    registriesConfPath,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+
+	desc, err := SetCredentials(sys, "registry.example.com", "user", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "credential store: containers-test-store", desc)
+	_, err = SetCredentials(sys, "registry.example.com/namespace", "user", "password")
+	assert.Error(t, err) // Namespaced credentials are not supported in credential stores
+	_, err = os.Stat(sys.AuthFilePath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	creds, err := GetCredentials(sys, "registry.example.com/repo")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password"}, creds)
+	all, err := GetAllCredentials(sys)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.DockerAuthConfig{
+		"registry.example.com": {Username: "user", Password: "password"},
+	}, all)
+
+	err = RemoveAuthentication(sys, "registry.example.com")
+	require.NoError(t, err)
+	err = RemoveAuthentication(sys, "registry.example.com")
+	assert.ErrorIs(t, err, ErrNotLoggedIn)
+	creds, err = GetCredentials(sys, "registry.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{}, creds)
+
+	// The store can also be referenced from auth files.
+	err = os.WriteFile(sys.AuthFilePath, []byte(`{"credHelpers":{"registry.example.com":"containers-test-store"}}`), 0o600)
+	require.NoError(t, err)
+	sys.SystemRegistriesConfPath = filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(sys.SystemRegistriesConfPath, []byte{}, 0o600) // Use the default credential helpers
+	require.NoError(t, err)
+	require.NoError(t, testCredentialStore.Store("registry.example.com", types.DockerAuthConfig{IdentityToken: "token"}))
+	defer func() { _ = testCredentialStore.Erase("registry.example.com") }()
+	creds, err = GetCredentials(sys, "registry.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{IdentityToken: "token"}, creds)
+}
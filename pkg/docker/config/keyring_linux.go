@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/types"
+	"golang.org/x/sys/unix"
+)
+
+// KernelKeyringCredentialStore is the name of a CredentialStore which keeps credentials in the user keyring
+// of the Linux kernel (see keyrings(7)), instead of a plaintext file. Credentials in the kernel keyring
+// are not persisted across reboots.
+const KernelKeyringCredentialStore = "containers-kernel-keyring"
+
+const (
+	// keyringDescriptionPrefix is the prefix of descriptions of keys we create.
+	keyringDescriptionPrefix = "container-registry-login:"
+	// keyPermissions allows both possessors of the key and the user to access it, so that the
+	// key can be found regardless of the session keyring in use.
+	keyPermissions = 0x3f3f0000 // KEY_POS_ALL | KEY_USR_ALL
+)
+
+func init() {
+	RegisterCredentialStore(KernelKeyringCredentialStore, kernelKeyring{})
+}
+
+// kernelKeyring is a CredentialStore using the Linux kernel keyring.
+type kernelKeyring struct{}
+
+// keyringPayload is the payload of keys we create.
+type keyringPayload struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// keyDescription returns the description of the key containing credentials for registry.
+func keyDescription(registry string) string {
+	return keyringDescriptionPrefix + registry
+}
+
+// Get returns the credentials stored for registry, or an empty types.DockerAuthConfig if there are none.
+func (kernelKeyring) Get(registry string) (types.DockerAuthConfig, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", keyDescription(registry), 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOKEY) {
+			return types.DockerAuthConfig{}, nil
+		}
+		return types.DockerAuthConfig{}, fmt.Errorf("searching for credentials for %s in the kernel keyring: %w", registry, err)
+	}
+	payload, err := readKey(id)
+	if err != nil {
+		return types.DockerAuthConfig{}, fmt.Errorf("reading credentials for %s from the kernel keyring: %w", registry, err)
+	}
+	var creds keyringPayload
+	if err := json.Unmarshal(payload, &creds); err != nil {
+		return types.DockerAuthConfig{}, fmt.Errorf("parsing credentials for %s from the kernel keyring: %w", registry, err)
+	}
+	return types.DockerAuthConfig{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		IdentityToken: creds.IdentityToken,
+	}, nil
+}
+
+// Store stores creds for registry, replacing any previously stored credentials.
+func (kernelKeyring) Store(registry string, creds types.DockerAuthConfig) error {
+	payload, err := json.Marshal(keyringPayload{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		IdentityToken: creds.IdentityToken,
+	})
+	if err != nil {
+		return err
+	}
+	id, err := unix.AddKey("user", keyDescription(registry), payload, unix.KEY_SPEC_USER_KEYRING)
+	if err != nil {
+		return fmt.Errorf("storing credentials for %s in the kernel keyring: %w", registry, err)
+	}
+	if err := unix.KeyctlSetperm(id, keyPermissions); err != nil {
+		return fmt.Errorf("setting permissions of credentials for %s in the kernel keyring: %w", registry, err)
+	}
+	return nil
+}
+
+// Erase removes the credentials stored for registry, or returns ErrNotLoggedIn if there are none.
+func (kernelKeyring) Erase(registry string) error {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", keyDescription(registry), 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOKEY) {
+			return ErrNotLoggedIn
+		}
+		return fmt.Errorf("searching for credentials for %s in the kernel keyring: %w", registry, err)
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0); err != nil {
+		return fmt.Errorf("removing credentials for %s from the kernel keyring: %w", registry, err)
+	}
+	return nil
+}
+
+// List returns all registries with stored credentials.
+func (kernelKeyring) List() ([]string, error) {
+	payload, err := readKey(unix.KEY_SPEC_USER_KEYRING)
+	if err != nil {
+		return nil, fmt.Errorf("listing the kernel keyring: %w", err)
+	}
+	res := []string{}
+	for len(payload) >= 4 {
+		id := int(int32(binary.NativeEndian.Uint32(payload)))
+		payload = payload[4:]
+		// The format is "type;uid;gid;perm;description".
+		desc, err := unix.KeyctlString(unix.KEYCTL_DESCRIBE, id)
+		if err != nil {
+			continue // The key may have been removed concurrently, or we may not be allowed to view it; either way, it is not ours.
+		}
+		fields := strings.SplitN(desc, ";", 5)
+		if len(fields) != 5 || fields[0] != "user" {
+			continue
+		}
+		if registry, ok := strings.CutPrefix(fields[4], keyringDescriptionPrefix); ok {
+			res = append(res, registry)
+		}
+	}
+	return res, nil
+}
+
+// readKey returns the payload of the key (or the contents of the keyring) with id.
+func readKey(id int) ([]byte, error) {
+	buf := make([]byte, 512)
+	for {
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n <= len(buf) {
+			return buf[:n], nil
+		}
+		buf = make([]byte, n)
+	}
+}
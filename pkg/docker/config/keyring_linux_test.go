@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestKernelKeyring(t *testing.T) {
+	if _, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_USER_KEYRING, true); err != nil {
+		t.Skipf("The kernel keyring is not available: %v", err)
+	}
+
+	store := kernelKeyring{}
+	registry := fmt.Sprintf("registry-%d.example.com", os.Getpid())
+	defer func() { _ = store.Erase(registry) }()
+
+	creds, err := store.Get(registry)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{}, creds)
+	err = store.Erase(registry)
+	assert.ErrorIs(t, err, ErrNotLoggedIn)
+
+	for _, c := range []types.DockerAuthConfig{
+		{Username: "user", Password: "password"},
+		{IdentityToken: "token"}, // Replaces the previous value
+	} {
+		err = store.Store(registry, c)
+		require.NoError(t, err)
+		creds, err = store.Get(registry)
+		require.NoError(t, err)
+		assert.Equal(t, c, creds)
+	}
+	registries, err := store.List()
+	require.NoError(t, err)
+	assert.Contains(t, registries, registry)
+
+	err = store.Erase(registry)
+	require.NoError(t, err)
+	creds, err = store.Get(registry)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{}, creds)
+	registries, err = store.List()
+	require.NoError(t, err)
+	assert.NotContains(t, registries, registry)
+}
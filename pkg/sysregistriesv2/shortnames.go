@@ -131,6 +131,47 @@ func ResolveShortNameAlias(ctx *types.SystemContext, name string) (reference.Nam
 	return nil, "", nil
 }
 
+// ShortNameAlias is a short-name alias, as returned by ShortNameAliases.
+type ShortNameAlias struct {
+	// Value is the fully-qualified reference the short name resolves to.
+	// It is nil iff the alias is set to an empty string, which disables it.
+	Value reference.Named
+	// ConfigOrigin is a human-readable description of the config where the alias is specified.
+	ConfigOrigin string
+}
+
+// ShortNameAliases returns all configured short-name aliases, indexed by the short name.
+// As in ResolveShortNameAlias, aliases in the user-specific short-name-aliases.conf
+// have precedence over aliases in the assembled registries.conf.
+// Almost all callers should use pkg/shortnames instead; this is primarily useful to
+// display the configuration to users.
+func ShortNameAliases(ctx *types.SystemContext) (map[string]ShortNameAlias, error) {
+	confPath, lock, err := shortNameAliasesConfPathAndLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lock.RLock()
+	defer lock.Unlock()
+
+	_, aliasCache, err := loadShortNameAliasConf(confPath)
+	if err != nil {
+		return nil, err
+	}
+	config, err := getConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]ShortNameAlias{}
+	for _, c := range []*shortNameAliasCache{config.aliasCache, aliasCache} {
+		for name, alias := range c.namedAliases {
+			res[name] = ShortNameAlias{Value: alias.value, ConfigOrigin: alias.configOrigin}
+		}
+	}
+	return res, nil
+}
+
 // editShortNameAlias loads the aliases.conf file and changes it. If value is
 // set, it adds the name-value pair as a new alias. Otherwise, it will remove
 // name from the config.
@@ -160,6 +160,50 @@ func TestResolveShortNameAlias(t *testing.T) {
 	assert.Equal(t, "testdata/aliases.conf", path)
 }
 
+func TestShortNameAliases(t *testing.T) {
+	tmp, err := os.CreateTemp("", "aliases.conf")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/aliases.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+		UserShortNameAliasConfPath:  tmp.Name(),
+	}
+	InvalidateCache()
+
+	// User-specific aliases are added to, and override, aliases in registries.conf.
+	require.NoError(t, AddShortNameAlias(sys, "docker", "docker.io/user/foo"))
+	require.NoError(t, AddShortNameAlias(sys, "user", "registry.example.com/user/bar"))
+
+	aliases, err := ShortNameAliases(sys)
+	require.NoError(t, err)
+	values := map[string]string{}
+	origins := map[string]string{}
+	for name, alias := range aliases {
+		if alias.Value != nil {
+			values[name] = alias.Value.String()
+		} else {
+			values[name] = ""
+		}
+		origins[name] = alias.ConfigOrigin
+	}
+	assert.Equal(t, map[string]string{
+		"docker":   "docker.io/user/foo",
+		"quay/foo": "quay.io/library/foo",
+		"example":  "example.com/library/foo",
+		"empty":    "",
+		"user":     "registry.example.com/user/bar",
+	}, values)
+	assert.Equal(t, map[string]string{
+		"docker":   tmp.Name(),
+		"quay/foo": "testdata/aliases.conf",
+		"example":  "testdata/aliases.conf",
+		"empty":    "testdata/aliases.conf",
+		"user":     tmp.Name(),
+	}, origins)
+}
+
 func TestAliasesWithDropInConfigs(t *testing.T) {
 	tmp, err := os.CreateTemp("", "aliases.conf")
 	require.NoError(t, err)
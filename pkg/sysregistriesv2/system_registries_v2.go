@@ -1,8 +1,10 @@
 package sysregistriesv2
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -57,6 +59,9 @@ type Endpoint struct {
 	// If true, certs verification will be skipped and HTTP (non-TLS)
 	// connections will be allowed.
 	Insecure bool `toml:"insecure,omitempty"`
+	// If not empty, the URL of a proxy used to connect to the endpoint instead of the one specified by environment variables,
+	// using the "http", "https", "socks5" or "socks5h" scheme, and possibly containing credentials for the proxy.
+	Proxy string `toml:"proxy,omitempty"`
 	// PullFromMirror is used for adding restrictions to image pull through the mirror.
 	// Set to "all", "digest-only", or "tag-only".
 	// If "digest-only"， mirrors will only be used for digest pulls. Pulling images by
@@ -393,6 +398,27 @@ func (config *V1RegistriesConf) ConvertToV2() (*V2RegistriesConf, error) {
 // anchoredDomainRegexp is an internal implementation detail of postProcess, defining the valid values of elements of UnqualifiedSearchRegistries.
 var anchoredDomainRegexp = regexp.Delayed("^" + reference.DomainRegexp.String() + "$")
 
+// validateProxy returns an error if proxy is neither empty nor a valid proxy URL.
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		// Don’t include err, it contains the URL, which may contain a password.
+		return errors.New("proxy is not a valid URL")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy %q has no host", u.Redacted())
+	}
+	return nil
+}
+
 // postProcess checks the consistency of all the configuration, looks for conflicts,
 // and normalizes the configuration (e.g., sets the Prefix to Location if not set).
 func (config *V2RegistriesConf) postProcessRegistries() error {
@@ -424,9 +450,12 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 			}
 		}
 
+		if err := validateProxy(reg.Proxy); err != nil {
+			return &InvalidRegistries{s: fmt.Sprintf("invalid proxy for registry %q: %v", reg.Prefix, err)}
+		}
 		// validate the mirror usage settings does not apply to primary registry
 		if reg.PullFromMirror != "" {
-			return fmt.Errorf("pull-from-mirror must not be set for a non-mirror registry %q", reg.Prefix)
+			return &InvalidRegistries{s: fmt.Sprintf("pull-from-mirror must not be set for a non-mirror registry %q", reg.Prefix)}
 		}
 		// make sure mirrors are valid
 		for _, mir := range reg.Mirrors {
@@ -442,6 +471,9 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 				return &InvalidRegistries{s: "invalid condition: mirror location is unset"}
 			}
 
+			if err := validateProxy(mir.Proxy); err != nil {
+				return &InvalidRegistries{s: fmt.Sprintf("invalid proxy for mirror %q: %v", mir.Location, err)}
+			}
 			if reg.MirrorByDigestOnly && mir.PullFromMirror != "" {
 				return &InvalidRegistries{s: fmt.Sprintf("cannot set mirror usage mirror-by-digest-only for the registry (%q) and pull-from-mirror for per-mirror (%q) at the same time", reg.Prefix, mir.Location)}
 			}
@@ -484,6 +516,11 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'blocked' setting", reg.Location)
 				return &InvalidRegistries{s: msg}
 			}
+
+			if reg.Proxy != other.Proxy {
+				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'proxy' setting", reg.Location)
+				return &InvalidRegistries{s: msg}
+			}
 		}
 	}
 
@@ -3,6 +3,7 @@ package tlsclientconfig
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -80,6 +81,36 @@ func SetupCertificates(dir string, tlsc *tls.Config) error {
 	return nil
 }
 
+// SetupPEMCertificates adds PEM-encoded CA certificates in caCerts, and a PEM-encoded client certificate and key pair, to tlsc.
+// Each of the inputs may be empty; clientCert and clientKey must either both be set, or both be empty.
+func SetupPEMCertificates(caCerts, clientCert, clientKey []byte, tlsc *tls.Config) error {
+	if len(caCerts) != 0 {
+		if tlsc.RootCAs == nil {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				return fmt.Errorf("unable to get system cert pool: %w", err)
+			}
+			tlsc.RootCAs = systemPool
+		}
+		if !tlsc.RootCAs.AppendCertsFromPEM(caCerts) {
+			return errors.New("no valid PEM-encoded CA certificates found")
+		}
+	}
+	switch {
+	case len(clientCert) != 0 && len(clientKey) != 0:
+		cert, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return err
+		}
+		tlsc.Certificates = append(slices.Clone(tlsc.Certificates), cert)
+	case len(clientCert) != 0:
+		return errors.New("missing key for client certificate")
+	case len(clientKey) != 0:
+		return errors.New("missing client certificate for key")
+	}
+	return nil
+}
+
 func hasFile(files []os.DirEntry, name string) bool {
 	return slices.ContainsFunc(files, func(f os.DirEntry) bool {
 		return f.Name() == name
@@ -132,3 +132,50 @@ func TestSetupCertificates(t *testing.T) {
 	err = SetupCertificates("testdata/unreadable-cert", &tlsc)
 	assert.Error(t, err)
 }
+
+func TestSetupPEMCertificates(t *testing.T) {
+	caCert, err := os.ReadFile("testdata/full/ca-cert-1.crt")
+	require.NoError(t, err)
+	clientCert, err := os.ReadFile("testdata/full/client-cert-1.cert")
+	require.NoError(t, err)
+	clientKey, err := os.ReadFile("testdata/full/client-cert-1.key")
+	require.NoError(t, err)
+
+	// Success
+	tlsc := tls.Config{}
+	err = SetupPEMCertificates(caCert, clientCert, clientKey, &tlsc)
+	require.NoError(t, err)
+	require.NotNil(t, tlsc.RootCAs)
+	require.Len(t, tlsc.Certificates, 1)
+	parsed, err := x509.ParseCertificate(tlsc.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, "containers/image test client certificate 1", parsed.Subject.CommonName)
+
+	// Certificates are added to existing ones
+	err = SetupCertificates("testdata/full", &tlsc)
+	require.NoError(t, err)
+	assert.Len(t, tlsc.Certificates, 3)
+
+	// No input
+	tlsc = tls.Config{}
+	err = SetupPEMCertificates(nil, nil, nil, &tlsc)
+	require.NoError(t, err)
+	assert.Equal(t, &tls.Config{}, &tlsc)
+
+	// Invalid CA certificates
+	tlsc = tls.Config{}
+	err = SetupPEMCertificates([]byte("not PEM"), nil, nil, &tlsc)
+	assert.Error(t, err)
+
+	// Missing key or certificate
+	tlsc = tls.Config{}
+	err = SetupPEMCertificates(nil, clientCert, nil, &tlsc)
+	assert.Error(t, err)
+	err = SetupPEMCertificates(nil, nil, clientKey, &tlsc)
+	assert.Error(t, err)
+	// Mismatched key and certificate
+	otherKey, err := os.ReadFile("testdata/full/client-cert-2.key")
+	require.NoError(t, err)
+	err = SetupPEMCertificates(nil, clientCert, otherKey, &tlsc)
+	assert.Error(t, err)
+}
@@ -0,0 +1,300 @@
+// Package reposync copies all, or a filtered subset, of the tagged images of repositories between transports,
+// similar to "skopeo sync".
+package reposync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/supporteddigests"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+)
+
+// Source is a set of tagged images to copy.
+type Source interface {
+	// Tags returns the tags of all images in the source.
+	Tags(ctx context.Context, sys *types.SystemContext) ([]string, error)
+	// Reference returns a reference to the image with tag in the source.
+	Reference(tag string) (types.ImageReference, error)
+	// String returns a human-readable description of the source.
+	String() string
+}
+
+// Destination returns the reference to copy the source image with tag to.
+type Destination func(tag string) (types.ImageReference, error)
+
+// Repository describes images to copy from a single source.
+type Repository struct {
+	Source      Source
+	Destination Destination
+	// If not nil, only tags matching TagRegexp are copied; use ^ and $ to match the whole tag.
+	TagRegexp *regexp.Regexp
+}
+
+// Options allows supplying non-default configuration modifying the behavior of Sync.
+type Options struct {
+	// Options used for every copy.Image call; SourceCtx is also used to list tags, and DestinationCtx to check destinations.
+	// Note that copies may run concurrently, e.g. writing to ReportWriter at the same time.
+	CopyOptions *copy.Options
+	// The maximum number of images copied at the same time; images are copied one at a time if this is 0.
+	MaxParallelCopies int
+	// If set, images are not copied if the destination already contains an image with the same manifest digest.
+	// This is only effective if copying does not modify the images (e.g. by converting manifest formats or compressing layers).
+	SkipUnchanged bool
+}
+
+// ResultStatus describes the outcome of syncing a single tag.
+type ResultStatus int
+
+const (
+	// ResultCopied indicates that the image was copied.
+	ResultCopied ResultStatus = iota
+	// ResultSkipped indicates that the image was not copied because the destination already contained it, see Options.SkipUnchanged.
+	ResultSkipped
+	// ResultFailed indicates that the image could not be copied; see Result.Err.
+	ResultFailed
+)
+
+// Result describes the outcome of syncing a single tag.
+type Result struct {
+	Tag         string
+	Source      types.ImageReference
+	Destination types.ImageReference // nil if the destination could not be determined
+	Status      ResultStatus
+	Digest      digest.Digest // The digest of the manifest at the destination, using DestinationCtx.DigestAlgorithm, if Status is not ResultFailed
+	Err         error         // Set if Status is ResultFailed
+}
+
+// Sync copies the tagged images of repos, as described by options.
+// It first lists the tags of all repos, failing if that is not possible; then it copies all images, even if some
+// of the copies fail, and returns a result for each tag, in the order of repos and of tags returned by their sources.
+func Sync(ctx context.Context, policyContext *signature.PolicyContext, repos []Repository, options *Options) ([]Result, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	copyOptions := options.CopyOptions
+	if copyOptions == nil {
+		copyOptions = &copy.Options{}
+	}
+	digestAlgorithm, err := supporteddigests.ForNewObjects(copyOptions.DestinationCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, repo := range repos {
+		tags, err := repo.Source.Tags(ctx, copyOptions.SourceCtx)
+		if err != nil {
+			return nil, fmt.Errorf("listing tags of %s: %w", repo.Source.String(), err)
+		}
+		for _, tag := range tags {
+			if repo.TagRegexp != nil && !repo.TagRegexp.MatchString(tag) {
+				continue
+			}
+			res := Result{Tag: tag}
+			res.Source, err = repo.Source.Reference(tag)
+			if err != nil {
+				return nil, fmt.Errorf("creating a reference for tag %q of %s: %w", tag, repo.Source.String(), err)
+			}
+			res.Destination, err = repo.Destination(tag)
+			if err != nil {
+				res.Status = ResultFailed
+				res.Err = fmt.Errorf("determining the destination for %s: %w", transports.ImageName(res.Source), err)
+			}
+			results = append(results, res)
+		}
+	}
+
+	var group errgroup.Group
+	group.SetLimit(max(1, options.MaxParallelCopies))
+	for i := range results {
+		if results[i].Status == ResultFailed {
+			continue
+		}
+		res := &results[i] // Each goroutine only modifies its own element.
+		group.Go(func() error {
+			syncImage(ctx, policyContext, res, copyOptions, options.SkipUnchanged, digestAlgorithm)
+			return nil
+		})
+	}
+	_ = group.Wait() // The goroutines never fail, errors are recorded in results.
+	return results, nil
+}
+
+// syncImage copies res.Source to res.Destination, and records the outcome in res.
+// digestAlgorithm is the algorithm used for digests by the destination.
+func syncImage(ctx context.Context, policyContext *signature.PolicyContext, res *Result, copyOptions *copy.Options, skipUnchanged bool,
+	digestAlgorithm digest.Algorithm) {
+	if skipUnchanged {
+		srcDigest, err := manifestDigest(ctx, copyOptions.SourceCtx, res.Source, digestAlgorithm)
+		if err != nil {
+			res.Status = ResultFailed
+			res.Err = fmt.Errorf("reading manifest digest of %s: %w", transports.ImageName(res.Source), err)
+			return
+		}
+		destDigest, err := manifestDigest(ctx, copyOptions.DestinationCtx, res.Destination, digestAlgorithm)
+		if err != nil && !errors.Is(err, types.ErrNotFound) && !errors.Is(err, fs.ErrNotExist) {
+			res.Status = ResultFailed
+			res.Err = fmt.Errorf("reading manifest digest of %s: %w", transports.ImageName(res.Destination), err)
+			return
+		}
+		// A registry may report a digest using a different algorithm; then copy the image, so that Digest uses the expected one.
+		if err == nil && destDigest == srcDigest && destDigest.Algorithm() == digestAlgorithm {
+			res.Status = ResultSkipped
+			res.Digest = destDigest
+			return
+		}
+	}
+
+	// A PolicyContext can't be used concurrently, so use a separate one for every copy.
+	pc, err := signature.NewPolicyContext(policyContext.Policy)
+	if err != nil {
+		res.Status = ResultFailed
+		res.Err = err
+		return
+	}
+	defer func() {
+		if err := pc.Destroy(); err != nil && res.Err == nil {
+			res.Status = ResultFailed
+			res.Err = err
+		}
+	}()
+	copied, err := copy.Image(ctx, pc, res.Destination, res.Source, copyOptions)
+	if err != nil {
+		res.Status = ResultFailed
+		res.Err = fmt.Errorf("copying %s to %s: %w", transports.ImageName(res.Source), transports.ImageName(res.Destination), err)
+		return
+	}
+	res.Status = ResultCopied
+	res.Digest, err = manifest.DigestWithAlgorithm(copied, digestAlgorithm)
+	if err != nil {
+		res.Status = ResultFailed
+		res.Err = err
+	}
+}
+
+// manifestDigest returns the digest of the top-level manifest at ref, using algorithm
+// (except for registries, which report the digest on their own).
+func manifestDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, algorithm digest.Algorithm) (digest.Digest, error) {
+	if ref.Transport().Name() == docker.Transport.Name() {
+		// Don’t use NewImageSource, which could read the image from a pull mirror instead of the registry.
+		return docker.GetDigest(ctx, sys, ref)
+	}
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	m, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	return manifest.DigestWithAlgorithm(m, algorithm)
+}
+
+// dockerRepository is a Source for a repository in a registry.
+type dockerRepository struct {
+	repo reference.Named
+}
+
+// DockerRepository returns a Source for all tags of repo, which must not contain a tag or a digest, in a registry.
+func DockerRepository(repo reference.Named) (Source, error) {
+	if !reference.IsNameOnly(repo) {
+		return nil, fmt.Errorf("repository %s must not contain a tag or a digest", reference.FamiliarString(repo))
+	}
+	return dockerRepository{repo: repo}, nil
+}
+
+func (s dockerRepository) Tags(ctx context.Context, sys *types.SystemContext) ([]string, error) {
+	ref, err := docker.NewReference(reference.TagNameOnly(s.repo))
+	if err != nil {
+		return nil, err
+	}
+	return docker.GetRepositoryTags(ctx, sys, ref)
+}
+
+func (s dockerRepository) Reference(tag string) (types.ImageReference, error) {
+	tagged, err := reference.WithTag(s.repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewReference(tagged)
+}
+
+func (s dockerRepository) String() string {
+	return "docker://" + s.repo.Name()
+}
+
+// ociLayout is a Source for the named images in an OCI layout.
+type ociLayout struct {
+	dir string
+}
+
+// OCILayout returns a Source for all named images in the OCI layout at dir; the names are used as tags.
+// Images without a name are ignored.
+func OCILayout(dir string) Source {
+	return ociLayout{dir: dir}
+}
+
+func (s ociLayout) Tags(ctx context.Context, sys *types.SystemContext) ([]string, error) {
+	images, err := layout.List(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(images))
+	for _, image := range images {
+		// Entries without a name can't be referenced individually; layout.NewReference(s.dir, "") would refer to
+		// the only image in the layout instead.
+		if name := image.ManifestDescriptor.Annotations[imgspecv1.AnnotationRefName]; name != "" {
+			res = append(res, name)
+		}
+	}
+	return res, nil
+}
+
+func (s ociLayout) Reference(tag string) (types.ImageReference, error) {
+	return layout.NewReference(s.dir, tag)
+}
+
+func (s ociLayout) String() string {
+	return "oci:" + s.dir
+}
+
+// ToDockerRepository returns a Destination which copies images to tags of repo, which must not contain a tag or a digest, in a registry.
+func ToDockerRepository(repo reference.Named) (Destination, error) {
+	if !reference.IsNameOnly(repo) {
+		return nil, fmt.Errorf("repository %s must not contain a tag or a digest", reference.FamiliarString(repo))
+	}
+	return func(tag string) (types.ImageReference, error) {
+		tagged, err := reference.WithTag(repo, tag)
+		if err != nil {
+			return nil, err
+		}
+		return docker.NewReference(tagged)
+	}, nil
+}
+
+// ToDirectories returns a Destination which copies every image to a separate "dir:" directory, named after the tag, within parent.
+func ToDirectories(parent string) Destination {
+	return func(tag string) (types.ImageReference, error) {
+		if tag == "" || tag == "." || tag == ".." || filepath.Base(tag) != tag {
+			return nil, fmt.Errorf("tag %q can not be used as a directory name", tag)
+		}
+		return directory.NewReference(filepath.Join(parent, tag))
+	}
+}
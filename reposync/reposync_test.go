@@ -0,0 +1,238 @@
+package reposync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putTestImage writes a single-layer image with the specified layer contents to an OCI layout at dir, with name tag,
+// and returns the manifest digest.
+func putTestImage(t *testing.T, dir, tag string, layer []byte) digest.Digest {
+	ctx := context.Background()
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`)
+	manifestBlob := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%s",`+
+		`"config":{"mediaType":"%s","digest":"%s","size":%d},`+
+		`"layers":[{"mediaType":"%s","digest":"%s","size":%d}]}`,
+		imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageConfig, digest.FromBytes(config), len(config),
+		imgspecv1.MediaTypeImageLayer, digest.FromBytes(layer), len(layer)))
+
+	ref, err := layout.NewReference(dir, tag)
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	for _, blob := range [][]byte{config, layer} {
+		_, err = dest.PutBlob(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}, none.NoCache, false)
+		require.NoError(t, err)
+	}
+	err = dest.PutManifest(ctx, manifestBlob, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+	return digest.FromBytes(manifestBlob)
+}
+
+// concurrencyBarrier makes the first two callers of wait block until both have arrived, or until a timeout.
+type concurrencyBarrier struct {
+	mutex   sync.Mutex
+	arrived int
+	done    chan struct{}
+}
+
+func (b *concurrencyBarrier) wait() {
+	b.mutex.Lock()
+	b.arrived++
+	if b.arrived == 2 {
+		close(b.done)
+	}
+	b.mutex.Unlock()
+	select {
+	case <-b.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// barrierReference is a types.ImageReference which calls barrier.wait when evaluating the signature policy.
+type barrierReference struct {
+	types.ImageReference
+	barrier *concurrencyBarrier
+}
+
+func (ref barrierReference) PolicyConfigurationIdentity() string {
+	ref.barrier.wait()
+	return ref.ImageReference.PolicyConfigurationIdentity()
+}
+
+func (ref barrierReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return barrierImageSource{ImageSource: src, ref: ref}, nil
+}
+
+// barrierImageSource is a types.ImageSource for a barrierReference.
+type barrierImageSource struct {
+	types.ImageSource
+	ref barrierReference
+}
+
+func (src barrierImageSource) Reference() types.ImageReference {
+	return src.ref
+}
+
+// barrierSource is a Source returning barrierReferences.
+type barrierSource struct {
+	Source
+	barrier *concurrencyBarrier
+}
+
+func (s barrierSource) Reference(tag string) (types.ImageReference, error) {
+	ref, err := s.Source.Reference(tag)
+	if err != nil {
+		return nil, err
+	}
+	return barrierReference{ImageReference: ref, barrier: s.barrier}, nil
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	srcDir := t.TempDir()
+	digest1 := putTestImage(t, srcDir, "v1", []byte("layer 1"))
+	digest2 := putTestImage(t, srcDir, "v2", []byte("layer 2"))
+	putTestImage(t, srcDir, "latest", []byte("layer 3"))
+	putTestImage(t, srcDir, "", []byte("unnamed layer"))
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	tags, err := OCILayout(srcDir).Tags(ctx, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"v1", "v2", "latest"}, tags) // The unnamed image is ignored
+
+	destDir := t.TempDir()
+	parallelDestDir := t.TempDir()
+	for _, c := range []struct {
+		destDir    string
+		options    *Options
+		expected   ResultStatus
+		concurrent bool // Ensure that the policy of parallel copies is evaluated concurrently
+	}{
+		{destDir, nil, ResultCopied, false},
+		{destDir, &Options{SkipUnchanged: true, MaxParallelCopies: 2}, ResultSkipped, false},
+		{parallelDestDir, &Options{MaxParallelCopies: 2}, ResultCopied, true},
+	} {
+		src := OCILayout(srcDir)
+		if c.concurrent {
+			src = barrierSource{Source: src, barrier: &concurrencyBarrier{done: make(chan struct{})}}
+		}
+		repos := []Repository{{
+			Source:      src,
+			Destination: ToDirectories(c.destDir),
+			TagRegexp:   regexp.MustCompile(`^v[0-9]+$`),
+		}}
+		results, err := Sync(ctx, policyContext, repos, c.options)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for i, expected := range []struct {
+			tag    string
+			digest digest.Digest
+		}{{"v1", digest1}, {"v2", digest2}} {
+			res := results[i]
+			assert.Equal(t, expected.tag, res.Tag)
+			assert.Equal(t, c.expected, res.Status)
+			assert.NoError(t, res.Err)
+			assert.Equal(t, expected.digest, res.Digest)
+			assert.Equal(t, filepath.Join(c.destDir, expected.tag), res.Destination.StringWithinTransport())
+			assert.Equal(t, filepath.Join(srcDir)+":"+expected.tag, res.Source.StringWithinTransport())
+		}
+	}
+
+	// Digests use the destination’s digest algorithm
+	sha512DestDir := t.TempDir()
+	sha512Options := &copy.Options{DestinationCtx: &types.SystemContext{DigestAlgorithm: digest.SHA512}}
+	for _, expected := range []ResultStatus{ResultCopied, ResultSkipped} {
+		results, err := Sync(ctx, policyContext, []Repository{{
+			Source:      OCILayout(srcDir),
+			Destination: ToDirectories(sha512DestDir),
+			TagRegexp:   regexp.MustCompile(`^v1$`),
+		}}, &Options{CopyOptions: sha512Options, SkipUnchanged: true})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, expected, results[0].Status)
+		require.NoError(t, results[0].Err)
+		copiedManifest, err := os.ReadFile(filepath.Join(sha512DestDir, "v1", "manifest.json"))
+		require.NoError(t, err)
+		assert.Equal(t, digest.SHA512.FromBytes(copiedManifest), results[0].Digest)
+	}
+	// An unsupported algorithm is rejected
+	_, err = Sync(ctx, policyContext, []Repository{{Source: OCILayout(srcDir), Destination: ToDirectories(t.TempDir())}},
+		&Options{CopyOptions: &copy.Options{DestinationCtx: &types.SystemContext{DigestAlgorithm: digest.SHA384}}})
+	assert.Error(t, err)
+
+	// A missing source
+	_, err = Sync(ctx, policyContext, []Repository{{
+		Source:      OCILayout(filepath.Join(t.TempDir(), "missing")),
+		Destination: ToDirectories(destDir),
+	}}, nil)
+	assert.Error(t, err)
+}
+
+func TestToDirectories(t *testing.T) {
+	parent := t.TempDir()
+	dest := ToDirectories(parent)
+	ref, err := dest("tag")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(parent, "tag"), ref.StringWithinTransport())
+	for _, tag := range []string{"", ".", "..", "a/b"} {
+		_, err := dest(tag)
+		assert.Error(t, err, tag)
+	}
+}
+
+func TestDockerRepository(t *testing.T) {
+	repo, err := reference.ParseNormalizedNamed("example.com/ns/repo")
+	require.NoError(t, err)
+	src, err := DockerRepository(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "docker://example.com/ns/repo", src.String())
+	ref, err := src.Reference("v1")
+	require.NoError(t, err)
+	assert.Equal(t, "//example.com/ns/repo:v1", ref.StringWithinTransport())
+
+	dest, err := ToDockerRepository(repo)
+	require.NoError(t, err)
+	ref, err = dest("v2")
+	require.NoError(t, err)
+	assert.Equal(t, "//example.com/ns/repo:v2", ref.StringWithinTransport())
+
+	tagged, err := reference.ParseNormalizedNamed("example.com/ns/repo:tag")
+	require.NoError(t, err)
+	_, err = DockerRepository(tagged)
+	assert.Error(t, err)
+	_, err = ToDockerRepository(tagged)
+	assert.Error(t, err)
+}
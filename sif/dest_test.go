@@ -0,0 +1,153 @@
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sylabs/sif/v2/pkg/sif"
+)
+
+var _ private.ImageDestination = (*sifImageDestination)(nil)
+
+func TestDestinationPutBlob(t *testing.T) {
+	ref, err := NewReference(filepath.Join(t.TempDir(), "image.sif"))
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	cache := memory.New()
+
+	blob := []byte("blob contents")
+	blobDigest := digest.FromBytes(blob)
+	reused, _, err := dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	info, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.Equal(t, blobDigest, info.Digest)
+	assert.Equal(t, int64(len(blob)), info.Size)
+
+	reused, info, err = dest.TryReusingBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, blobDigest, info.Digest)
+	assert.Equal(t, int64(len(blob)), info.Size)
+
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: 1}, cache, false)
+	assert.Error(t, err)
+
+	// Manifest lists are not supported.
+	err = dest.PutManifest(context.Background(), []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`), nil)
+	assert.Error(t, err)
+}
+
+func TestDestinationCommit(t *testing.T) {
+	for _, tool := range []string{"fakeroot", "tar", "mksquashfs", "unsquashfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "image.sif")
+	ref, err := NewReference(path)
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	cache := memory.New()
+
+	layers := [][]struct{ name, contents string }{
+		{{"etc/hostname", "container"}, {"etc/removed", "x"}, {"data/old", "x"}},
+		{{"etc/.wh.removed", ""}, {"data/.wh..wh..opq", ""}, {"data/new", "y"}},
+	}
+	layerDescriptors := []imgspecv1.Descriptor{}
+	diffIDs := []digest.Digest{}
+	for _, files := range layers {
+		var layer bytes.Buffer
+		tw := tar.NewWriter(&layer)
+		for _, f := range files {
+			err := tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f.contents))})
+			require.NoError(t, err)
+			_, err = tw.Write([]byte(f.contents))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		info, err := dest.PutBlob(ctx, bytes.NewReader(layer.Bytes()), types.BlobInfo{Size: -1}, cache, false)
+		require.NoError(t, err)
+		layerDescriptors = append(layerDescriptors, imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageLayer, Digest: info.Digest, Size: info.Size})
+		diffIDs = append(diffIDs, info.Digest)
+	}
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{Architecture: "amd64", OS: "linux"},
+		Config:   imgspecv1.ImageConfig{Env: []string{"FOO=bar"}, Cmd: []string{"cat", "/etc/hostname"}},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	require.NoError(t, err)
+	configInfo, err := dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Size: -1}, cache, true)
+	require.NoError(t, err)
+	m, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configInfo.Digest, Size: configInfo.Size},
+		Layers:    layerDescriptors,
+	})
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, m, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+
+	sifImage, err := sif.LoadContainerFromPath(path, sif.OptLoadWithFlag(os.O_RDONLY))
+	require.NoError(t, err)
+	defer func() {
+		_ = sifImage.UnloadContainer()
+	}()
+	assert.Equal(t, "amd64", sifImage.PrimaryArch())
+	deffile, err := sifImage.GetDescriptor(sif.WithDataType(sif.DataDeffile))
+	require.NoError(t, err)
+	environment, runscript, err := parseDefFile(deffile.GetReader())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"export FOO='bar'"}, environment)
+	assert.Contains(t, runscript, "exec 'cat' '/etc/hostname'")
+
+	rootFS, err := sifImage.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+	require.NoError(t, err)
+	squashFSPath := filepath.Join(t.TempDir(), "rootfs.squashfs")
+	squashFS, err := os.Create(squashFSPath)
+	require.NoError(t, err)
+	_, err = io.Copy(squashFS, rootFS.GetReader())
+	require.NoError(t, err)
+	require.NoError(t, squashFS.Close())
+	extracted := filepath.Join(t.TempDir(), "rootfs")
+	out, err := exec.Command("unsquashfs", "-no-progress", "-d", extracted, squashFSPath).CombinedOutput()
+	require.NoError(t, err, string(out))
+	for _, c := range []struct{ path, contents string }{
+		{"etc/hostname", "container"},
+		{"data/new", "y"},
+		{".singularity.d/env/10-docker2singularity.sh", "#!/bin/sh\nexport FOO='bar'\n"},
+	} {
+		contents, err := os.ReadFile(filepath.Join(extracted, c.path))
+		require.NoError(t, err, c.path)
+		assert.Equal(t, c.contents, string(contents), c.path)
+	}
+	for _, removed := range []string{"etc/removed", "data/old", "etc/.wh.removed", "data/.wh..wh..opq"} {
+		_, err := os.Lstat(filepath.Join(extracted, removed))
+		assert.ErrorIs(t, err, os.ErrNotExist, removed)
+	}
+}
@@ -0,0 +1,484 @@
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/containers/image/v5/pkg/compression"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/sylabs/sif/v2/pkg/sif"
+)
+
+const (
+	// whiteoutPrefix and whiteoutOpaqueDir mark removed files and directories in OCI layers.
+	whiteoutPrefix    = ".wh."
+	whiteoutOpaqueDir = ".wh..wh..opq"
+	// sifLaunchScript is the launch script Apptainer and Singularity use for SIF files.
+	sifLaunchScript = "#!/usr/bin/env run-singularity\n"
+)
+
+// shellQuote returns s quoted for use in a POSIX shell script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellQuoteArgs returns args quoted for use in a POSIX shell script, separated by spaces.
+func shellQuoteArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		quoted = append(quoted, shellQuote(a))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// generateEnvironment returns the lines of a shell script setting the environment variables from config.
+func generateEnvironment(config *imgspecv1.ImageConfig) []string {
+	environment := []string{}
+	for _, env := range config.Env {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || name == "" {
+			logrus.Debugf("Ignoring invalid environment variable %q", env)
+			continue
+		}
+		environment = append(environment, fmt.Sprintf("export %s=%s", name, shellQuote(value)))
+	}
+	return environment
+}
+
+// generateRunscript returns the lines of a shell script which runs the entrypoint and command from config,
+// with the command replaced by the script's arguments, if any.
+func generateRunscript(config *imgspecv1.ImageConfig) []string {
+	runscript := []string{}
+	if config.WorkingDir != "" {
+		runscript = append(runscript, "cd "+shellQuote(config.WorkingDir))
+	}
+	entrypoint := shellQuoteArgs(config.Entrypoint)
+	runscript = append(runscript, "if [ $# -gt 0 ]; then")
+	if entrypoint != "" {
+		runscript = append(runscript, fmt.Sprintf(`	exec %s "$@"`, entrypoint))
+	} else {
+		runscript = append(runscript, `	exec "$@"`)
+	}
+	runscript = append(runscript, "fi")
+	command := strings.TrimSpace(entrypoint + " " + shellQuoteArgs(config.Cmd))
+	if command == "" {
+		command = "/bin/sh"
+	}
+	runscript = append(runscript, "exec "+command)
+	return runscript
+}
+
+// generateDefFile returns a SIF definition file with the specified %environment and %runscript sections.
+func generateDefFile(environment []string, runscript []string) []byte {
+	var def bytes.Buffer
+	for _, section := range []struct {
+		name  string
+		lines []string
+	}{
+		{"%environment", environment},
+		{"%runscript", runscript},
+	} {
+		def.WriteString(section.name + "\n")
+		for _, line := range section.lines {
+			def.WriteString("\t" + line + "\n")
+		}
+	}
+	return def.Bytes()
+}
+
+// writeSingularityMetadata writes the files Apptainer and Singularity use to run a container
+// into metadataPath, which is later copied to the root of the container filesystem.
+func writeSingularityMetadata(metadataPath string, config *imgspecv1.ImageConfig, environment, runscript []string) error {
+	dir := filepath.Join(metadataPath, ".singularity.d")
+	if err := os.MkdirAll(filepath.Join(dir, "env"), 0755); err != nil {
+		return err
+	}
+	labels := config.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	for _, file := range []struct {
+		path     string
+		contents []byte
+		mode     os.FileMode
+	}{
+		{"runscript", []byte("#!/bin/sh\n" + strings.Join(runscript, "\n") + "\n"), 0755},
+		{"env/10-docker2singularity.sh", []byte("#!/bin/sh\n" + strings.Join(environment, "\n") + "\n"), 0755},
+		{"labels.json", labelsJSON, 0644},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file.path), file.contents, file.mode); err != nil {
+			return fmt.Errorf("writing %s: %w", file.path, err)
+		}
+	}
+	return os.Symlink(".singularity.d/runscript", filepath.Join(metadataPath, "singularity"))
+}
+
+// layerWhiteouts lists the paths a layer removes from the layers below it.
+type layerWhiteouts struct {
+	removed    []string // Files or directories which are removed.
+	opaqueDirs []string // Directories whose contents are removed.
+}
+
+// decompressLayer writes an uncompressed version of the layer at blobPath to tarPath, and returns the whiteouts it contains.
+// All returned paths are absolute, cleaned, and relative to the root of the container filesystem.
+func decompressLayer(blobPath, tarPath string) (layerWhiteouts, error) {
+	blob, err := os.Open(blobPath)
+	if err != nil {
+		return layerWhiteouts{}, err
+	}
+	defer blob.Close()
+	stream, _, err := compression.AutoDecompress(blob)
+	if err != nil {
+		return layerWhiteouts{}, err
+	}
+	defer stream.Close()
+	out, err := os.Create(tarPath)
+	if err != nil {
+		return layerWhiteouts{}, err
+	}
+	defer out.Close()
+
+	whiteouts := layerWhiteouts{}
+	tee := io.TeeReader(stream, out)
+	tr := tar.NewReader(tee)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return layerWhiteouts{}, fmt.Errorf("reading layer %s: %w", blobPath, err)
+		}
+		name := path.Clean("/" + hdr.Name) // Also resolves any ".." components.
+		base := path.Base(name)
+		switch {
+		case base == whiteoutOpaqueDir:
+			whiteouts.opaqueDirs = append(whiteouts.opaqueDirs, path.Dir(name))
+		case strings.HasPrefix(base, whiteoutPrefix):
+			whiteouts.removed = append(whiteouts.removed, path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)))
+		}
+	}
+	// Copy any padding after the end of the archive as well, it does not matter much but it is cheap.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return layerWhiteouts{}, err
+	}
+	return whiteouts, out.Close()
+}
+
+// layerOverlay is a securejoin.VFS which reflects the entries of a layer processed so far on top of the
+// filesystem extracted from the previous layers.
+type layerOverlay struct {
+	entries map[string]*tar.Header // Entries of the layer, indexed by their resolved path on the host.
+}
+
+// Lstat implements securejoin.VFS.
+func (o *layerOverlay) Lstat(name string) (os.FileInfo, error) {
+	if hdr, ok := o.entries[filepath.Clean(name)]; ok {
+		return hdr.FileInfo(), nil
+	}
+	return os.Lstat(name)
+}
+
+// Readlink implements securejoin.VFS.
+func (o *layerOverlay) Readlink(name string) (string, error) {
+	if hdr, ok := o.entries[filepath.Clean(name)]; ok {
+		if hdr.Typeflag != tar.TypeSymlink {
+			return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+		}
+		return hdr.Linkname, nil
+	}
+	return os.Readlink(name)
+}
+
+// resolveLayerPath returns the path within rootfsPath where an entry called name should be created:
+// symbolic links in the parent directories are resolved as if rootfsPath were the root directory, using overlay.
+func resolveLayerPath(rootfsPath string, overlay *layerOverlay, name string) (string, error) {
+	cleaned := path.Clean("/" + name)
+	if cleaned == "/" {
+		return rootfsPath, nil
+	}
+	parent, err := securejoin.SecureJoinVFS(rootfsPath, path.Dir(cleaned), overlay)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, path.Base(cleaned)), nil
+}
+
+// resolveLayer writes a copy of the uncompressed layer at tarPath to resolvedTarPath, with whiteouts removed,
+// and with all entry names and hard link targets rewritten so that they don’t pass through symbolic links,
+// neither those extracted from previous layers into rootfsPath, nor those created by the layer itself.
+// Extracting the result with tar therefore can’t create files outside of rootfsPath.
+func resolveLayer(tarPath, resolvedTarPath, rootfsPath string) error {
+	in, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(resolvedTarPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	overlay := &layerOverlay{entries: map[string]*tar.Header{}}
+	relativeName := func(name string) (string, error) {
+		resolved, err := resolveLayerPath(rootfsPath, overlay, name)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(rootfsPath, resolved)
+		if err != nil {
+			return "", err
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	tr := tar.NewReader(in)
+	tw := tar.NewWriter(out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading layer: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader || strings.HasPrefix(path.Base(path.Clean("/"+hdr.Name)), whiteoutPrefix) {
+			continue
+		}
+		name, err := relativeName(hdr.Name)
+		if err != nil {
+			return fmt.Errorf("resolving %q: %w", hdr.Name, err)
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname, err = relativeName(hdr.Linkname)
+			if err != nil {
+				return fmt.Errorf("resolving hard link target %q: %w", hdr.Linkname, err)
+			}
+		}
+		if hdr.Typeflag == tar.TypeGNUSparse {
+			hdr.Typeflag = tar.TypeReg // tar.Reader has already expanded the contents.
+		}
+		hdr.Name = name
+		hdr.Format = tar.FormatUnknown // The rewritten names might not fit into the original format.
+		overlay.entries[filepath.Join(rootfsPath, name)] = hdr
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// checkExternalTools returns an error if any of the external programs used to create a SquashFS image is missing.
+func checkExternalTools() error {
+	for _, tool := range []string{"fakeroot", "tar", "mksquashfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("writing SIF files requires %s to be installed: %w", tool, err)
+		}
+	}
+	return nil
+}
+
+// fakerootSession runs commands in a fakeroot environment which persists across invocations,
+// so that file ownership set when extracting layers is visible when creating the squashfs image.
+type fakerootSession struct {
+	stateFile string
+	started   bool
+}
+
+// run runs args in the fakeroot environment.
+func (f *fakerootSession) run(ctx context.Context, args ...string) error {
+	fakerootArgs := []string{"-s", f.stateFile}
+	if f.started {
+		fakerootArgs = append(fakerootArgs, "-i", f.stateFile)
+	}
+	fakerootArgs = append(append(fakerootArgs, "--"), args...)
+	logrus.Debugf("Running fakeroot %s", strings.Join(fakerootArgs, " "))
+	cmd := exec.CommandContext(ctx, "fakeroot", fakerootArgs...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("running %s: %w, output: %s", args[0], err, string(output))
+	}
+	f.started = true
+	return nil
+}
+
+// resolveWithinRoot returns the path of p, an absolute path within rootfsPath, if all of its parent directories exist
+// and are not symbolic links; otherwise it returns "", because p can not exist within the container filesystem.
+func resolveWithinRoot(rootfsPath, p string) (string, error) {
+	current := rootfsPath
+	components := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for _, c := range components[:len(components)-1] {
+		current = filepath.Join(current, c)
+		fi, err := os.Lstat(current)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return "", nil
+			}
+			return "", err
+		}
+		if !fi.IsDir() {
+			return "", nil
+		}
+	}
+	return filepath.Join(current, components[len(components)-1]), nil
+}
+
+// whiteoutTargets returns the paths within rootfsPath which must be removed to apply whiteouts.
+func whiteoutTargets(rootfsPath string, whiteouts layerWhiteouts) ([]string, error) {
+	res := []string{}
+	for _, dir := range whiteouts.opaqueDirs {
+		if dir == "/" {
+			continue // Nothing below the root can be hidden by an opaque whiteout; it would also be an invalid layer.
+		}
+		dirPath, err := resolveWithinRoot(rootfsPath, dir)
+		if err != nil {
+			return nil, err
+		}
+		if dirPath == "" {
+			continue
+		}
+		fi, err := os.Lstat(dirPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			res = append(res, filepath.Join(dirPath, e.Name()))
+		}
+	}
+	for _, p := range whiteouts.removed {
+		if p == "/" {
+			continue
+		}
+		path, err := resolveWithinRoot(rootfsPath, p)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" {
+			res = append(res, path)
+		}
+	}
+	return res, nil
+}
+
+// createSquashFSFromLayers creates a squashfs image at squashFSPath from the layers at layerBlobPaths,
+// adding the contents of metadataPath.
+// The layers are uncompressed and extracted into tempDir, which can be assumed to be empty at start, and is
+// exclusively used by the current process (i.e. it is safe to use hard-coded relative paths within it).
+func createSquashFSFromLayers(ctx context.Context, layerBlobPaths []string, metadataPath, squashFSPath, tempDir string) error {
+	rootfsPath := filepath.Join(tempDir, "rootfs")
+	layerPath := filepath.Join(tempDir, "layer.tar")
+	resolvedLayerPath := filepath.Join(tempDir, "layer-resolved.tar")
+	session := fakerootSession{stateFile: filepath.Join(tempDir, "fakeroot-state")}
+	// It's safe for the Remove calls to happen even before we create the files, because tempDir is exclusive
+	// for our use.
+	defer os.RemoveAll(rootfsPath)
+	defer os.Remove(layerPath)
+	defer os.Remove(resolvedLayerPath)
+	defer os.Remove(session.stateFile)
+
+	if err := session.run(ctx, "mkdir", "-p", rootfsPath); err != nil {
+		return err
+	}
+	for _, blobPath := range layerBlobPaths {
+		logrus.Debugf("Extracting layer %s ...", blobPath)
+		whiteouts, err := decompressLayer(blobPath, layerPath)
+		if err != nil {
+			return err
+		}
+		// Whiteouts only affect lower layers, so process them before extracting the layer’s own contents.
+		// The paths are checked here, and not by a shell script, so that we never follow symbolic links out of rootfsPath.
+		removed, err := whiteoutTargets(rootfsPath, whiteouts)
+		if err != nil {
+			return err
+		}
+		if len(removed) > 0 {
+			if err := session.run(ctx, append([]string{"rm", "-rf", "--"}, removed...)...); err != nil {
+				return err
+			}
+		}
+		// Symbolic links in the paths of the layer’s entries must be resolved within rootfsPath, as they would be in the
+		// container, and not followed by tar; otherwise a layer could create a symbolic link pointing outside of
+		// rootfsPath, and a later layer could write through it.
+		if err := resolveLayer(layerPath, resolvedLayerPath, rootfsPath); err != nil {
+			return fmt.Errorf("processing layer %s: %w", blobPath, err)
+		}
+		if err := session.run(ctx, "tar", "--acls", "--xattrs", "-C", rootfsPath, "-xpf", resolvedLayerPath); err != nil {
+			return err
+		}
+		logrus.Debugf("... finished extracting layer %s", blobPath)
+	}
+	if err := session.run(ctx, "cp", "-R", metadataPath+"/.", rootfsPath+"/"); err != nil {
+		return err
+	}
+
+	logrus.Debugf("Creating squashfs image %s ...", squashFSPath)
+	if err := session.run(ctx, "mksquashfs", rootfsPath, squashFSPath, "-noappend", "-no-progress"); err != nil {
+		return err
+	}
+	logrus.Debugf("... finished creating squashfs image")
+	return nil
+}
+
+// writeSIFFile creates a SIF file at path with a squashfs root filesystem at squashFSPath for arch,
+// and the definition file defFile.
+func writeSIFFile(path, squashFSPath, arch string, defFile []byte) error {
+	squashFS, err := os.Open(squashFSPath)
+	if err != nil {
+		return err
+	}
+	defer squashFS.Close()
+
+	defInput, err := sif.NewDescriptorInput(sif.DataDeffile, bytes.NewReader(defFile))
+	if err != nil {
+		return err
+	}
+	rootFSInput, err := sif.NewDescriptorInput(sif.DataPartition, squashFS,
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, arch))
+	if err != nil {
+		return fmt.Errorf("creating a SIF root filesystem partition: %w", err)
+	}
+	sifImage, err := sif.CreateContainerAtPath(path,
+		sif.OptCreateWithLaunchScript(sifLaunchScript),
+		sif.OptCreateWithDescriptors(defInput, rootFSInput))
+	if err != nil {
+		return fmt.Errorf("creating SIF file: %w", err)
+	}
+	if err := sifImage.UnloadContainer(); err != nil {
+		return fmt.Errorf("writing SIF file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'simple'`, shellQuote("simple"))
+	assert.Equal(t, `''`, shellQuote(""))
+	assert.Equal(t, `'it'\''s $HOME'`, shellQuote("it's $HOME"))
+	assert.Equal(t, `'a' 'b c'`, shellQuoteArgs([]string{"a", "b c"}))
+}
+
+func TestGenerateEnvironment(t *testing.T) {
+	env := generateEnvironment(&imgspecv1.ImageConfig{
+		Env: []string{"PATH=/usr/bin:/bin", "EMPTY=", "QUOTED=it's", "=invalid", "INVALID"},
+	})
+	assert.Equal(t, []string{
+		"export PATH='/usr/bin:/bin'",
+		"export EMPTY=''",
+		`export QUOTED='it'\''s'`,
+	}, env)
+}
+
+func TestGenerateRunscript(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		config   imgspecv1.ImageConfig
+		expected []string
+	}{
+		{
+			name:   "Empty config",
+			config: imgspecv1.ImageConfig{},
+			expected: []string{
+				"if [ $# -gt 0 ]; then",
+				`	exec "$@"`,
+				"fi",
+				"exec /bin/sh",
+			},
+		},
+		{
+			name:   "Cmd only",
+			config: imgspecv1.ImageConfig{Cmd: []string{"echo", "hello world"}},
+			expected: []string{
+				"if [ $# -gt 0 ]; then",
+				`	exec "$@"`,
+				"fi",
+				"exec 'echo' 'hello world'",
+			},
+		},
+		{
+			name: "Entrypoint, Cmd and WorkingDir",
+			config: imgspecv1.ImageConfig{
+				Entrypoint: []string{"/entrypoint.sh"},
+				Cmd:        []string{"--serve"},
+				WorkingDir: "/srv",
+			},
+			expected: []string{
+				"cd '/srv'",
+				"if [ $# -gt 0 ]; then",
+				`	exec '/entrypoint.sh' "$@"`,
+				"fi",
+				"exec '/entrypoint.sh' '--serve'",
+			},
+		},
+	} {
+		assert.Equal(t, c.expected, generateRunscript(&c.config), c.name)
+	}
+}
+
+func TestGenerateDefFile(t *testing.T) {
+	environment := []string{"export FOO='bar'"}
+	runscript := []string{"if [ $# -gt 0 ]; then", `	exec "$@"`, "fi", "exec 'echo'"}
+	def := generateDefFile(environment, runscript)
+	assert.Equal(t, "%environment\n"+
+		"\texport FOO='bar'\n"+
+		"%runscript\n"+
+		"\tif [ $# -gt 0 ]; then\n"+
+		"\t\texec \"$@\"\n"+
+		"\tfi\n"+
+		"\texec 'echo'\n", string(def))
+
+	// The sif source can read the generated file.
+	env2, runscript2, err := parseDefFile(bytes.NewReader(def))
+	require.NoError(t, err)
+	assert.Equal(t, environment, env2)
+	assert.Equal(t, []string{"if [ $# -gt 0 ]; then", `exec "$@"`, "fi", "exec 'echo'"}, runscript2)
+}
+
+func TestDecompressLayer(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var uncompressed bytes.Buffer
+	tw := tar.NewWriter(&uncompressed)
+	err := tw.WriteHeader(&tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755})
+	require.NoError(t, err)
+	for _, name := range []string{"etc/.wh.passwd", "usr/lib/.wh..wh..opq", "../../.wh.escape", "usr/bin/tool"} {
+		err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644})
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	var compressed bytes.Buffer
+	gzw := gzip.NewWriter(&compressed)
+	_, err = gzw.Write(uncompressed.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	blobPath := filepath.Join(tmpDir, "blob")
+	err = os.WriteFile(blobPath, compressed.Bytes(), 0600)
+	require.NoError(t, err)
+	tarPath := filepath.Join(tmpDir, "layer.tar")
+	whiteouts, err := decompressLayer(blobPath, tarPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/etc/passwd", "/escape"}, whiteouts.removed)
+	assert.Equal(t, []string{"/usr/lib"}, whiteouts.opaqueDirs)
+	tarContents, err := os.ReadFile(tarPath)
+	require.NoError(t, err)
+	assert.Equal(t, uncompressed.Bytes(), tarContents)
+}
+
+func TestWhiteoutTargets(t *testing.T) {
+	rootfs := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{"etc", "usr/lib/sub"} {
+		err := os.MkdirAll(filepath.Join(rootfs, dir), 0755)
+		require.NoError(t, err)
+	}
+	for _, file := range []string{"etc/passwd", "usr/lib/a", filepath.Join(outside, "victim")} {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(rootfs, file)
+		}
+		err := os.WriteFile(file, nil, 0644)
+		require.NoError(t, err)
+	}
+	err := os.Symlink(outside, filepath.Join(rootfs, "link"))
+	require.NoError(t, err)
+
+	targets, err := whiteoutTargets(rootfs, layerWhiteouts{
+		removed: []string{
+			"/etc/passwd",
+			"/etc/missing",    // Missing files are irrelevant to rm -rf
+			"/missing/file",   // The parent does not exist
+			"/link/victim",    // The parent is a symlink, must not be followed
+			"/etc/passwd/foo", // The parent is not a directory
+			"/link",           // Removing the symlink itself is fine
+			"/",               // Never remove the root
+		},
+		opaqueDirs: []string{"/usr/lib", "/link", "/missing", "/"},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(rootfs, "usr/lib/a"),
+		filepath.Join(rootfs, "usr/lib/sub"),
+		filepath.Join(rootfs, "etc/passwd"),
+		filepath.Join(rootfs, "etc/missing"),
+		filepath.Join(rootfs, "link"),
+	}, targets)
+}
+
+func TestResolveLayer(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootfs := filepath.Join(tmpDir, "rootfs")
+	err := os.MkdirAll(filepath.Join(rootfs, "usr/lib"), 0755)
+	require.NoError(t, err)
+	// Symbolic links created by a previous layer.
+	err = os.Symlink("/home/user", filepath.Join(rootfs, "evil"))
+	require.NoError(t, err)
+	err = os.Symlink("usr/lib", filepath.Join(rootfs, "lib"))
+	require.NoError(t, err)
+
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	for _, hdr := range []tar.Header{
+		{Name: "evil/x", Typeflag: tar.TypeReg},
+		{Name: "lib/libc.so", Typeflag: tar.TypeReg},
+		{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "/tmp"},
+		{Name: "etc/passwd", Typeflag: tar.TypeReg},
+		{Name: "indirect", Typeflag: tar.TypeSymlink, Linkname: "evil/../../.."},
+		{Name: "indirect/y", Typeflag: tar.TypeReg},
+		{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "lib/libc.so"},
+		{Name: "../../escape", Typeflag: tar.TypeReg},
+		{Name: "usr/.wh.removed", Typeflag: tar.TypeReg},
+	} {
+		hdr.Mode = 0644
+		err := tw.WriteHeader(&hdr)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	tarPath := filepath.Join(tmpDir, "layer.tar")
+	err = os.WriteFile(tarPath, layer.Bytes(), 0600)
+	require.NoError(t, err)
+
+	resolvedPath := filepath.Join(tmpDir, "layer-resolved.tar")
+	err = resolveLayer(tarPath, resolvedPath, rootfs)
+	require.NoError(t, err)
+	resolved, err := os.Open(resolvedPath)
+	require.NoError(t, err)
+	defer resolved.Close()
+	type entry struct{ name, linkname string }
+	entries := []entry{}
+	tr := tar.NewReader(resolved)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		entries = append(entries, entry{hdr.Name, hdr.Linkname})
+	}
+	assert.Equal(t, []entry{
+		{"home/user/x", ""},
+		{"usr/lib/libc.so", ""},
+		{"etc", "/tmp"},
+		{"tmp/passwd", ""},
+		{"indirect", "evil/../../.."},
+		{"y", ""},
+		{"hardlink", "usr/lib/libc.so"},
+		{"escape", ""},
+	}, entries)
+}
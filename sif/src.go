@@ -190,7 +190,7 @@ func (s *sifImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 		}
 		return reader, s.layerSize, nil
 	default:
-		return nil, -1, fmt.Errorf("no blob with digest %q found", info.Digest.String())
+		return nil, -1, fmt.Errorf("no blob with digest %q found%.0w", info.Digest.String(), types.ErrBlobUnknown)
 	}
 }
 
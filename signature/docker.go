@@ -18,6 +18,10 @@ import (
 type SignOptions struct {
 	// Passphare to use when signing with the key identity.
 	Passphrase string
+	// PassphraseCallback, if not nil, is called to obtain the passphrase when signing with the key identity,
+	// e.g. by a headless service which can’t rely on an interactive gpg-agent / pinentry.
+	// It is given a human-readable description of the key. At most one of Passphrase and PassphraseCallback may be set.
+	PassphraseCallback func(keyDescription string) (string, error)
 }
 
 // SignDockerManifest returns a signature for manifest as the specified dockerReference,
@@ -29,16 +33,26 @@ func SignDockerManifestWithOptions(m []byte, dockerReference string, mech Signin
 	}
 	sig := newUntrustedSignature(manifestDigest, dockerReference)
 
-	var passphrase string
+	var getPassphrase passphraseCallback
 	if options != nil {
-		passphrase = options.Passphrase
-		// The gpgme implementation can’t use passphrase with \n; reject it here for consistent behavior.
-		if strings.Contains(passphrase, "\n") {
-			return nil, errors.New("invalid passphrase: must not contain a line break")
+		if options.Passphrase != "" && options.PassphraseCallback != nil {
+			return nil, errors.New("both a passphrase and a passphrase callback specified")
+		}
+		if options.Passphrase != "" {
+			passphrase := options.Passphrase
+			// The gpgme implementation can’t use passphrase with \n; reject it here for consistent behavior.
+			if strings.Contains(passphrase, "\n") {
+				return nil, errors.New("invalid passphrase: must not contain a line break")
+			}
+			getPassphrase = func(string) (string, error) {
+				return passphrase, nil
+			}
+		} else {
+			getPassphrase = options.PassphraseCallback
 		}
 	}
 
-	return sig.sign(mech, keyIdentity, passphrase)
+	return sig.sign(mech, keyIdentity, getPassphrase)
 }
 
 // SignDockerManifest returns a signature for manifest as the specified dockerReference,
@@ -1,6 +1,7 @@
 package signature
 
 import (
+	"errors"
 	"os"
 	"testing"
 
@@ -72,6 +73,25 @@ func TestSignDockerManifestWithPassphrase(t *testing.T) {
 	_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprintWithPassphrase, nil)
 	require.Error(t, err)
 
+	// Both a passphrase and a passphrase callback
+	_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprintWithPassphrase, &SignOptions{
+		Passphrase:         TestPassphrase,
+		PassphraseCallback: func(string) (string, error) { return TestPassphrase, nil },
+	})
+	assert.ErrorContains(t, err, "both a passphrase and a passphrase callback")
+
+	// Passphrase callback fails
+	_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprintWithPassphrase, &SignOptions{
+		PassphraseCallback: func(string) (string, error) { return "", errors.New("no passphrase available") },
+	})
+	require.Error(t, err)
+
+	// Wrong passphrase from a passphrase callback
+	_, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprintWithPassphrase, &SignOptions{
+		PassphraseCallback: func(string) (string, error) { return "wrong", nil },
+	})
+	require.Error(t, err)
+
 	// Successful signing
 	signature, err := SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprintWithPassphrase, &SignOptions{Passphrase: TestPassphrase})
 	require.NoError(t, err)
@@ -81,6 +101,15 @@ func TestSignDockerManifestWithPassphrase(t *testing.T) {
 	assert.Equal(t, TestImageSignatureReference, verified.DockerReference)
 	assert.Equal(t, TestImageManifestDigest, verified.DockerManifestDigest)
 
+	// Successful signing with a passphrase callback
+	signature, err = SignDockerManifestWithOptions(manifest, TestImageSignatureReference, mech, TestKeyFingerprintWithPassphrase, &SignOptions{
+		PassphraseCallback: func(string) (string, error) { return TestPassphrase, nil },
+	})
+	require.NoError(t, err)
+	verified, err = VerifyDockerManifestSignature(signature, manifest, TestImageSignatureReference, mech, TestKeyFingerprintWithPassphrase)
+	assert.NoError(t, err)
+	assert.Equal(t, TestImageSignatureReference, verified.DockerReference)
+
 	// Error computing Docker manifest
 	invalidManifest, err := os.ReadFile("fixtures/v2s1-invalid-signatures.manifest.json")
 	require.NoError(t, err)
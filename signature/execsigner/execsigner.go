@@ -0,0 +1,139 @@
+// Package execsigner creates signatures using an external signer plugin, an executable implementing
+// a simple JSON-over-stdio protocol, so that signing services can be used by copy.Image
+// without linking their code into this package.
+package execsigner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	internalSig "github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/signature/signer"
+)
+
+// execSigner is a signer.SignerImplementation implementation using an external signer plugin.
+type execSigner struct {
+	path string
+	args []string
+	env  []string // nil to inherit the environment of this process
+}
+
+type Option func(*execSigner) error
+
+// WithArgs returns an Option for NewSigner, specifying arguments to pass to the plugin.
+func WithArgs(args ...string) Option {
+	return func(s *execSigner) error {
+		s.args = append(s.args, args...)
+		return nil
+	}
+}
+
+// WithEnv returns an Option for NewSigner, specifying the environment of the plugin,
+// in the format used by os.Environ; by default, the plugin inherits the environment of this process.
+func WithEnv(env []string) Option {
+	return func(s *execSigner) error {
+		s.env = append([]string{}, env...)
+		return nil
+	}
+}
+
+// NewSigner returns a signature.Signer which creates signatures by running the plugin executable at path
+// (looked up in $PATH if it does not contain a path separator), using the protocol described in this package.
+//
+// The caller must call Close() on the returned Signer.
+func NewSigner(path string, opts ...Option) (*signer.Signer, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("finding signer plugin %q: %w", path, err)
+	}
+	s := execSigner{path: resolved}
+	for _, o := range opts {
+		if err := o(&s); err != nil {
+			return nil, err
+		}
+	}
+	return internalSigner.NewSigner(&s), nil
+}
+
+// ProgressMessage returns a human-readable sentence that makes sense to write before starting to create a single signature.
+func (s *execSigner) ProgressMessage() string {
+	return fmt.Sprintf("Signing image using signer plugin %s", filepath.Base(s.path))
+}
+
+// SignImageManifest creates a new signature for manifest m as dockerReference.
+func (s *execSigner) SignImageManifest(ctx context.Context, m []byte, dockerReference reference.Named) (internalSig.Signature, error) {
+	if reference.IsNameOnly(dockerReference) {
+		return nil, fmt.Errorf("reference %s can’t be signed, it has neither a tag nor a digest", dockerReference.String())
+	}
+	req, err := json.Marshal(Request{
+		Version:         ProtocolVersion,
+		DockerReference: dockerReference.String(),
+		Manifest:        m,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding signer plugin request: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, s.path, s.args...)
+	cmd.Env = s.env
+	cmd.Stdin = bytes.NewReader(req)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	var res Response
+	decodeErr := json.Unmarshal(stdout.Bytes(), &res)
+	switch {
+	case decodeErr == nil && res.Error != "":
+		return nil, fmt.Errorf("signer plugin %s failed: %s", s.path, res.Error)
+	case runErr != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("running signer plugin %s: %w: %s", s.path, runErr, msg)
+		}
+		return nil, fmt.Errorf("running signer plugin %s: %w", s.path, runErr)
+	case decodeErr != nil:
+		return nil, fmt.Errorf("parsing response of signer plugin %s: %w", s.path, decodeErr)
+	}
+	if res.Version != ProtocolVersion {
+		return nil, fmt.Errorf("signer plugin %s uses unsupported protocol version %d", s.path, res.Version)
+	}
+	sig, err := res.Signature.toSignature()
+	if err != nil {
+		return nil, fmt.Errorf("invalid response of signer plugin %s: %w", s.path, err)
+	}
+	return sig, nil
+}
+
+// toSignature converts a ResponseSignature, which may be nil, into a signature.Signature.
+func (rs *ResponseSignature) toSignature() (internalSig.Signature, error) {
+	if rs == nil {
+		return nil, errors.New("neither a signature nor an error returned")
+	}
+	switch rs.Format {
+	case FormatSimpleSigning:
+		if len(rs.Blob) == 0 {
+			return nil, errors.New("simple signing signature is empty")
+		}
+		return internalSig.SimpleSigningFromBlob(rs.Blob), nil
+	case FormatSigstore:
+		if rs.MIMEType == "" || len(rs.Payload) == 0 {
+			return nil, errors.New("sigstore signature is missing a MIME type or a payload")
+		}
+		return internalSig.SigstoreFromComponents(rs.MIMEType, rs.Payload, rs.Annotations), nil
+	default:
+		return nil, fmt.Errorf("unknown signature format %q", rs.Format)
+	}
+}
+
+func (s *execSigner) Close() error {
+	return nil
+}
@@ -0,0 +1,178 @@
+package execsigner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	internalSig "github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPlugin = "./testdata/signer-plugin"
+
+func TestNewSigner(t *testing.T) {
+	s, err := NewSigner(testPlugin, WithArgs("simple-signing"))
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, "Signing image using signer plugin signer-plugin", internalSigner.ProgressMessage(s))
+
+	// Plugin not found
+	_, err = NewSigner("./testdata/this-does-not-exist")
+	assert.Error(t, err)
+	_, err = NewSigner("this-plugin-does-not-exist-in-path")
+	assert.Error(t, err)
+}
+
+func TestSignImageManifest(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+	ref, err := reference.ParseNormalizedNamed("example.com/ns/repo:tag")
+	require.NoError(t, err)
+
+	// Successful signing, including the contents of the request
+	requestFile := filepath.Join(t.TempDir(), "request.json")
+	s, err := NewSigner(testPlugin, WithArgs("simple-signing"), WithEnv([]string{"REQUEST_FILE=" + requestFile}))
+	require.NoError(t, err)
+	defer s.Close()
+	sig, err := internalSigner.SignImageManifest(context.Background(), s, manifest, ref)
+	require.NoError(t, err)
+	assert.Equal(t, internalSig.SimpleSigningFromBlob([]byte("signature")), sig)
+	reqBytes, err := os.ReadFile(requestFile)
+	require.NoError(t, err)
+	var req Request
+	err = json.Unmarshal(reqBytes, &req)
+	require.NoError(t, err)
+	assert.Equal(t, Request{
+		Version:         ProtocolVersion,
+		DockerReference: "example.com/ns/repo:tag",
+		Manifest:        manifest,
+	}, req)
+
+	s2, err := NewSigner(testPlugin, WithArgs("sigstore"))
+	require.NoError(t, err)
+	defer s2.Close()
+	sig, err = internalSigner.SignImageManifest(context.Background(), s2, manifest, ref)
+	require.NoError(t, err)
+	assert.Equal(t, internalSig.SigstoreFromComponents("application/vnd.dev.cosign.simplesigning.v1+json", []byte("payload"),
+		map[string]string{"dev.cosignproject.cosign/signature": "c2lnbmF0dXJl"}), sig)
+
+	// Name-only references are rejected
+	nameOnly, err := reference.ParseNormalizedNamed("example.com/ns/repo")
+	require.NoError(t, err)
+	_, err = internalSigner.SignImageManifest(context.Background(), s, manifest, nameOnly)
+	assert.Error(t, err)
+
+	// Failures
+	for _, c := range []struct{ mode, errorContains string }{
+		{"error", "signing service unavailable"},
+		{"exit", "something went wrong"},
+		{"garbage", "parsing response"},
+		{"version", "unsupported protocol version 2"},
+		{"no-signature", "neither a signature nor an error"},
+		{"unknown-format", `unknown signature format "unknown"`},
+		{"empty-simple-signing", "empty"},
+		{"empty-sigstore", "payload"},
+	} {
+		s, err := NewSigner(testPlugin, WithArgs(c.mode))
+		require.NoError(t, err, c.mode)
+		defer s.Close()
+		_, err = internalSigner.SignImageManifest(context.Background(), s, manifest, ref)
+		assert.ErrorContains(t, err, c.errorContains, c.mode)
+	}
+}
+
+// testPluginImplementation is a Plugin implementation for tests.
+type testPluginImplementation struct {
+	sig *ResponseSignature
+	err error
+}
+
+func (p testPluginImplementation) Sign(ctx context.Context, manifest []byte, dockerReference string) (*ResponseSignature, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.sig, nil
+}
+
+func TestServe(t *testing.T) {
+	validRequest := `{"version":1,"dockerReference":"example.com/ns/repo:tag","manifest":"e30="}`
+	validSig := &ResponseSignature{Format: FormatSimpleSigning, Blob: []byte("signature")}
+
+	for _, c := range []struct {
+		name     string
+		request  string
+		plugin   Plugin
+		response *Response // nil if no response is expected
+		failed   bool
+	}{
+		{
+			name:     "success",
+			request:  validRequest,
+			plugin:   testPluginImplementation{sig: validSig},
+			response: &Response{Version: ProtocolVersion, Signature: validSig},
+		},
+		{
+			name:     "signing failed",
+			request:  validRequest,
+			plugin:   testPluginImplementation{err: errors.New("signing failed")},
+			response: &Response{Version: ProtocolVersion, Error: "signing failed"},
+			failed:   true,
+		},
+		{
+			name:     "no signature",
+			request:  validRequest,
+			plugin:   testPluginImplementation{},
+			response: &Response{Version: ProtocolVersion, Error: "internal error: signer plugin returned neither a signature nor an error"},
+			failed:   true,
+		},
+		{
+			name:     "unsupported version",
+			request:  `{"version":2,"dockerReference":"example.com/ns/repo:tag","manifest":"e30="}`,
+			plugin:   testPluginImplementation{sig: validSig},
+			response: &Response{Version: ProtocolVersion, Error: "unsupported signer plugin protocol version 2"},
+			failed:   true,
+		},
+		{
+			name:    "invalid request",
+			request: "this is not JSON",
+			plugin:  testPluginImplementation{sig: validSig},
+			failed:  true,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := Serve(context.Background(), c.plugin, bytes.NewBufferString(c.request), &stdout)
+			if c.failed {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if c.response == nil {
+				assert.Zero(t, stdout.Len())
+			} else {
+				var res Response
+				err := json.Unmarshal(stdout.Bytes(), &res)
+				require.NoError(t, err)
+				assert.Equal(t, *c.response, res)
+			}
+		})
+	}
+
+	// The response of Serve is accepted by the client side.
+	var stdout bytes.Buffer
+	err := Serve(context.Background(), testPluginImplementation{sig: validSig}, bytes.NewBufferString(validRequest), &stdout)
+	require.NoError(t, err)
+	var res Response
+	err = json.Unmarshal(stdout.Bytes(), &res)
+	require.NoError(t, err)
+	sig, err := res.Signature.toSignature()
+	require.NoError(t, err)
+	assert.Equal(t, internalSig.SimpleSigningFromBlob([]byte("signature")), sig)
+}
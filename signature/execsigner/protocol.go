@@ -0,0 +1,88 @@
+package execsigner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersion is the version of the plugin protocol implemented by this package.
+const ProtocolVersion = 1
+
+// The plugin protocol:
+//
+// For every signature to be created, the plugin executable is run once (with the arguments configured
+// by the caller of NewSigner). A single Request, encoded as JSON, is written to its standard input,
+// and the plugin must write a single Response, encoded as JSON, to its standard output, and exit.
+// If the plugin exits with a non-zero status, signing fails; the contents of the standard error, and
+// Response.Error if any, are included in the error message.
+
+// Request is a request sent to a signer plugin.
+type Request struct {
+	Version         int    `json:"version"`         // ProtocolVersion
+	DockerReference string `json:"dockerReference"` // The reference to sign the manifest as, e.g. "registry.example.com/ns/repo:tag"
+	Manifest        []byte `json:"manifest"`        // The manifest to sign (base64-encoded in JSON)
+}
+
+// Response is a response sent by a signer plugin.
+// Exactly one of Error and Signature must be set.
+type Response struct {
+	Version   int                `json:"version"`             // ProtocolVersion
+	Error     string             `json:"error,omitempty"`     // Set if signing failed
+	Signature *ResponseSignature `json:"signature,omitempty"` // Set if signing succeeded
+}
+
+// Signature formats that can be used in ResponseSignature.Format.
+const (
+	FormatSimpleSigning = "simple-signing" // A “simple signing” signature; ResponseSignature.Blob must be set.
+	FormatSigstore      = "sigstore"       // A sigstore signature; ResponseSignature.MIMEType, Payload and Annotations must be set.
+)
+
+// ResponseSignature is a signature created by a signer plugin.
+type ResponseSignature struct {
+	Format string `json:"format"` // FormatSimpleSigning or FormatSigstore
+
+	// Used with FormatSimpleSigning:
+	Blob []byte `json:"blob,omitempty"` // The signature, as created e.g. by signature.SignDockerManifest (base64-encoded in JSON)
+
+	// Used with FormatSigstore:
+	MIMEType    string            `json:"mimeType,omitempty"`    // e.g. "application/vnd.dev.cosign.simplesigning.v1+json"
+	Payload     []byte            `json:"payload,omitempty"`     // base64-encoded in JSON
+	Annotations map[string]string `json:"annotations,omitempty"` // e.g. "dev.cosignproject.cosign/signature"
+}
+
+// Plugin is a signer plugin implementation, which can be used with Serve.
+type Plugin interface {
+	// Sign creates a signature of manifest as dockerReference.
+	Sign(ctx context.Context, manifest []byte, dockerReference string) (*ResponseSignature, error)
+}
+
+// Serve implements the plugin side of the protocol: it reads a request from stdin,
+// uses plugin to create a signature, and writes a response to stdout.
+// If it returns an error, signing has failed, and the plugin should exit with a non-zero status.
+func Serve(ctx context.Context, plugin Plugin, stdin io.Reader, stdout io.Writer) error {
+	var req Request
+	if err := json.NewDecoder(stdin).Decode(&req); err != nil {
+		return fmt.Errorf("reading signer plugin request: %w", err)
+	}
+	res := Response{Version: ProtocolVersion}
+	var signingErr error
+	if req.Version != ProtocolVersion {
+		signingErr = fmt.Errorf("unsupported signer plugin protocol version %d", req.Version)
+	} else if sig, err := plugin.Sign(ctx, req.Manifest, req.DockerReference); err != nil {
+		signingErr = err
+	} else if sig == nil {
+		signingErr = errors.New("internal error: signer plugin returned neither a signature nor an error")
+	} else {
+		res.Signature = sig
+	}
+	if signingErr != nil {
+		res.Error = signingErr.Error()
+	}
+	if err := json.NewEncoder(stdout).Encode(res); err != nil {
+		return fmt.Errorf("writing signer plugin response: %w", err)
+	}
+	return signingErr
+}
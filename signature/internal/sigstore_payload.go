@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/containers/image/v5/internal/multierr"
 	"github.com/containers/image/v5/version"
 	digest "github.com/opencontainers/go-digest"
 	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
@@ -171,14 +172,27 @@ type SigstorePayloadAcceptanceRules struct {
 	ValidateSignedDockerManifestDigest func(digest.Digest) error
 }
 
-// VerifySigstorePayload verifies unverifiedBase64Signature of unverifiedPayload was correctly created by publicKey, and that its principal components
+// VerifySigstorePayload verifies unverifiedBase64Signature of unverifiedPayload was correctly created by any of publicKeys, and that its principal components
 // match expected values, both as specified by rules, and returns it.
 // We return an *UntrustedSigstorePayload, although nothing actually uses it,
 // just to double-check against stupid typos.
-func VerifySigstorePayload(publicKey crypto.PublicKey, unverifiedPayload []byte, unverifiedBase64Signature string, rules SigstorePayloadAcceptanceRules) (*UntrustedSigstorePayload, error) {
-	verifier, err := sigstoreSignature.LoadVerifier(publicKey, sigstoreHarcodedHashAlgorithm)
-	if err != nil {
-		return nil, fmt.Errorf("creating verifier: %w", err)
+func VerifySigstorePayload(publicKeys []crypto.PublicKey, unverifiedPayload []byte, unverifiedBase64Signature string, rules SigstorePayloadAcceptanceRules) (*UntrustedSigstorePayload, error) {
+	if len(publicKeys) == 0 {
+		return nil, errors.New("Need at least one public key to verify the sigstore payload, but got 0")
+	}
+
+	verifiers := make([]sigstoreSignature.Verifier, 0, len(publicKeys))
+	for _, key := range publicKeys {
+		// Failing to load a verifier indicates that something is really, really
+		// invalid about the public key; prefer to fail even if the signature might be
+		// valid with other keys, so that users fix their fallback keys before they need them.
+		// For that reason, we even initialize all verifiers before trying to validate the signature
+		// with any key.
+		verifier, err := sigstoreSignature.LoadVerifier(key, sigstoreHarcodedHashAlgorithm)
+		if err != nil {
+			return nil, fmt.Errorf("creating verifier: %w", err)
+		}
+		verifiers = append(verifiers, verifier)
 	}
 
 	unverifiedSignature, err := base64.StdEncoding.DecodeString(unverifiedBase64Signature)
@@ -187,8 +201,19 @@ func VerifySigstorePayload(publicKey crypto.PublicKey, unverifiedPayload []byte,
 	}
 	// github.com/sigstore/cosign/pkg/cosign.verifyOCISignature uses signatureoptions.WithContext(),
 	// which seems to be not used by anything. So we don’t bother.
-	if err := verifier.VerifySignature(bytes.NewReader(unverifiedSignature), bytes.NewReader(unverifiedPayload)); err != nil {
-		return nil, NewInvalidSignatureError(fmt.Sprintf("cryptographic signature verification failed: %v", err))
+	var verifierErrors []error
+	verified := false
+	for _, verifier := range verifiers {
+		if err := verifier.VerifySignature(bytes.NewReader(unverifiedSignature), bytes.NewReader(unverifiedPayload)); err != nil {
+			verifierErrors = append(verifierErrors, err)
+			continue
+		}
+		verified = true
+		break
+	}
+	if !verified {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("cryptographic signature verification failed: %v",
+			multierr.Format("none of the public keys match: ", "; ", "", verifierErrors)))
 	}
 
 	var unmatchedPayload UntrustedSigstorePayload
@@ -37,6 +37,9 @@ type SigningMechanism interface {
 	UntrustedSignatureContents(untrustedSignature []byte) (untrustedContents []byte, shortKeyIdentifier string, err error)
 }
 
+// passphraseCallback returns a passphrase for the key described by uidHint (a human-readable description of the key).
+type passphraseCallback func(uidHint string) (string, error)
+
 // signingMechanismWithPassphrase is an internal extension of SigningMechanism.
 type signingMechanismWithPassphrase interface {
 	SigningMechanism
@@ -44,6 +47,11 @@ type signingMechanismWithPassphrase interface {
 	// Sign creates a (non-detached) signature of input using keyIdentity and passphrase.
 	// Fails with a SigningNotSupportedError if the mechanism does not support signing.
 	SignWithPassphrase(input []byte, keyIdentity string, passphrase string) ([]byte, error)
+	// SignWithPassphraseCallback creates a (non-detached) signature of input using keyIdentity,
+	// using getPassphrase to obtain the passphrase of the key, if necessary.
+	// If getPassphrase is nil, the system may interactively prompt using a gpg-agent / pinentry.
+	// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+	SignWithPassphraseCallback(input []byte, keyIdentity string, getPassphrase passphraseCallback) ([]byte, error)
 }
 
 // SigningNotSupportedError is returned when trying to sign using a mechanism which does not support that.
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/containers/image/v5/signature/internal"
 	"github.com/proglottis/gpgme"
@@ -125,6 +126,20 @@ func (m *gpgmeSigningMechanism) SupportsSigning() error {
 // Sign creates a (non-detached) signature of input using keyIdentity and passphrase.
 // Fails with a SigningNotSupportedError if the mechanism does not support signing.
 func (m *gpgmeSigningMechanism) SignWithPassphrase(input []byte, keyIdentity string, passphrase string) ([]byte, error) {
+	var getPassphrase passphraseCallback
+	if passphrase != "" {
+		getPassphrase = func(string) (string, error) {
+			return passphrase, nil
+		}
+	}
+	return m.SignWithPassphraseCallback(input, keyIdentity, getPassphrase)
+}
+
+// SignWithPassphraseCallback creates a (non-detached) signature of input using keyIdentity,
+// using getPassphrase to obtain the passphrase of the key, if necessary.
+// If getPassphrase is nil, the system may interactively prompt using a gpg-agent / pinentry.
+// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+func (m *gpgmeSigningMechanism) SignWithPassphraseCallback(input []byte, keyIdentity string, getPassphrase passphraseCallback) ([]byte, error) {
 	key, err := m.ctx.GetKey(keyIdentity, true)
 	if err != nil {
 		return nil, err
@@ -139,13 +154,21 @@ func (m *gpgmeSigningMechanism) SignWithPassphrase(input []byte, keyIdentity str
 		return nil, err
 	}
 
-	if passphrase != "" {
+	if getPassphrase != nil {
 		// Callback to write the passphrase to the specified file descriptor.
 		callback := func(uidHint string, prevWasBad bool, gpgmeFD *os.File) error {
 			if prevWasBad {
 				return errors.New("bad passphrase")
 			}
-			_, err := gpgmeFD.WriteString(passphrase + "\n")
+			passphrase, err := getPassphrase(uidHint)
+			if err != nil {
+				return fmt.Errorf("obtaining passphrase: %w", err)
+			}
+			// The passphrase is terminated by \n, so it can’t contain one.
+			if strings.Contains(passphrase, "\n") {
+				return errors.New("invalid passphrase: must not contain a line break")
+			}
+			_, err = gpgmeFD.WriteString(passphrase + "\n")
 			return err
 		}
 		if err := m.ctx.SetCallback(callback); err != nil {
@@ -121,6 +121,13 @@ func (m *openpgpSigningMechanism) SignWithPassphrase(input []byte, keyIdentity s
 	return nil, SigningNotSupportedError("signing is not supported in github.com/containers/image built with the containers_image_openpgp build tag")
 }
 
+// SignWithPassphraseCallback creates a (non-detached) signature of input using keyIdentity,
+// using getPassphrase to obtain the passphrase of the key, if necessary.
+// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+func (m *openpgpSigningMechanism) SignWithPassphraseCallback(input []byte, keyIdentity string, getPassphrase passphraseCallback) ([]byte, error) {
+	return nil, SigningNotSupportedError("signing is not supported in github.com/containers/image built with the containers_image_openpgp build tag")
+}
+
 // Sign creates a (non-detached) signature of input using keyIdentity.
 // Fails with a SigningNotSupportedError if the mechanism does not support signing.
 func (m *openpgpSigningMechanism) Sign(input []byte, keyIdentity string) ([]byte, error) {
@@ -246,6 +246,8 @@ func newPolicyRequirementFromJSON(data []byte) (PolicyRequirement, error) {
 		res = &prSignedBaseLayer{}
 	case prTypeSigstoreSigned:
 		res = &prSigstoreSigned{}
+	case prTypeThresholdSigned:
+		res = &prThresholdSigned{}
 	default:
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("Unknown policy requirement type %q", typeField.Type))
 	}
@@ -519,6 +521,60 @@ func (pr *prSignedBaseLayer) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// newPRThresholdSigned is NewPRThresholdSigned, except it returns the private type.
+func newPRThresholdSigned(threshold int, signers PolicyRequirements) (*prThresholdSigned, error) {
+	if len(signers) == 0 {
+		return nil, InvalidPolicyFormatError("signers not specified")
+	}
+	for i, signer := range signers {
+		switch signer.(type) {
+		case *prSignedBy, *prSigstoreSigned:
+		default:
+			return nil, InvalidPolicyFormatError(fmt.Sprintf(`signer %d is not a "signedBy" or "sigstoreSigned" requirement`, i))
+		}
+	}
+	if threshold < 1 || threshold > len(signers) {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("threshold %d is not between 1 and the number of signers, %d", threshold, len(signers)))
+	}
+	return &prThresholdSigned{
+		prCommon:  prCommon{Type: prTypeThresholdSigned},
+		Threshold: threshold,
+		Signers:   signers,
+	}, nil
+}
+
+// NewPRThresholdSigned returns a new "thresholdSigned" PolicyRequirement, accepting images signed by at least threshold of signers.
+// Each of signers must be a "signedBy" or "sigstoreSigned" PolicyRequirement.
+func NewPRThresholdSigned(threshold int, signers PolicyRequirements) (PolicyRequirement, error) {
+	return newPRThresholdSigned(threshold, signers)
+}
+
+// Compile-time check that prThresholdSigned implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prThresholdSigned)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prThresholdSigned) UnmarshalJSON(data []byte) error {
+	*pr = prThresholdSigned{}
+	var tmp prThresholdSigned
+	if err := internal.ParanoidUnmarshalJSONObjectExactFields(data, map[string]any{
+		"type":      &tmp.Type,
+		"threshold": &tmp.Threshold,
+		"signers":   &tmp.Signers,
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeThresholdSigned {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type %q", tmp.Type))
+	}
+	res, err := newPRThresholdSigned(tmp.Threshold, tmp.Signers)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
 // newPolicyReferenceMatchFromJSON parses JSON data into a PolicyReferenceMatch implementation.
 func newPolicyReferenceMatchFromJSON(data []byte) (PolicyReferenceMatch, error) {
 	var typeField prmCommon
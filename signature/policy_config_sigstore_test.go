@@ -20,7 +20,9 @@ func xNewPRSigstoreSigned(options ...PRSigstoreSignedOption) PolicyRequirement {
 
 func TestNewPRSigstoreSigned(t *testing.T) {
 	const testKeyPath = "/foo/bar"
+	testKeyPaths := []string{"/foo/bar", "/foo/baz"}
 	testKeyData := []byte("abc")
+	testKeyDatas := [][]byte{[]byte("abc"), []byte("def")}
 	testFulcio, err := NewPRSigstoreSignedFulcio(
 		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
 		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
@@ -63,6 +65,28 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 				SignedIdentity: testIdentity,
 			},
 		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyPaths(testKeyPaths),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+			},
+			expected: prSigstoreSigned{
+				prCommon:       prCommon{prTypeSigstoreSigned},
+				KeyPaths:       testKeyPaths,
+				SignedIdentity: testIdentity,
+			},
+		},
+		{
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyDatas(testKeyDatas),
+				PRSigstoreSignedWithSignedIdentity(testIdentity),
+			},
+			expected: prSigstoreSigned{
+				prCommon:       prCommon{prTypeSigstoreSigned},
+				KeyDatas:       testKeyDatas,
+				SignedIdentity: testIdentity,
+			},
+		},
 		{
 			options: []PRSigstoreSignedOption{
 				PRSigstoreSignedWithFulcio(testFulcio),
@@ -129,6 +153,29 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 			PRSigstoreSignedWithKeyData(testKeyData),
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 		},
+		{ // Both keyPath and keyPaths specified
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Both keyData and keyDatas specified
+			PRSigstoreSignedWithKeyData(testKeyData),
+			PRSigstoreSignedWithKeyDatas(testKeyDatas),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Both keyPaths and keyDatas specified
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithKeyDatas(testKeyDatas),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Empty keyPaths
+			PRSigstoreSignedWithKeyPaths([]string{}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Empty keyDatas
+			PRSigstoreSignedWithKeyDatas(nil),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
 		{ // both keyPath and fulcio specified
 			PRSigstoreSignedWithKeyPath(testKeyPath),
 			PRSigstoreSignedWithFulcio(testFulcio),
@@ -151,6 +198,16 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 			PRSigstoreSignedWithKeyData([]byte("def")),
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 		},
+		{ // Duplicate keyPaths
+			PRSigstoreSignedWithKeyPaths(testKeyPaths),
+			PRSigstoreSignedWithKeyPaths([]string{"/1", "/2"}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate keyDatas
+			PRSigstoreSignedWithKeyDatas(testKeyDatas),
+			PRSigstoreSignedWithKeyDatas([][]byte{[]byte("1"), []byte("2")}),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
 		{ // Duplicate fulcio
 			PRSigstoreSignedWithFulcio(testFulcio),
 			PRSigstoreSignedWithFulcio(testFulcio2),
@@ -207,6 +264,20 @@ func TestNewPRSigstoreSignedKeyPath(t *testing.T) {
 	}, pr)
 }
 
+func TestNewPRSigstoreSignedKeyPaths(t *testing.T) {
+	testPaths := []string{"/foo/bar", "/foo/baz"}
+	signedIdentity := NewPRMMatchRepoDigestOrExact()
+	_pr, err := NewPRSigstoreSignedKeyPaths(testPaths, signedIdentity)
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSigstoreSigned)
+	require.True(t, ok)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:       prCommon{Type: prTypeSigstoreSigned},
+		KeyPaths:       testPaths,
+		SignedIdentity: NewPRMMatchRepoDigestOrExact(),
+	}, pr)
+}
+
 func TestNewPRSigstoreSignedKeyData(t *testing.T) {
 	testData := []byte("abc")
 	signedIdentity := NewPRMMatchRepoDigestOrExact()
@@ -221,6 +292,20 @@ func TestNewPRSigstoreSignedKeyData(t *testing.T) {
 	}, pr)
 }
 
+func TestNewPRSigstoreSignedKeyDatas(t *testing.T) {
+	testData := [][]byte{[]byte("abc"), []byte("def")}
+	signedIdentity := NewPRMMatchRepoDigestOrExact()
+	_pr, err := NewPRSigstoreSignedKeyDatas(testData, signedIdentity)
+	require.NoError(t, err)
+	pr, ok := _pr.(*prSigstoreSigned)
+	require.True(t, ok)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:       prCommon{Type: prTypeSigstoreSigned},
+		KeyDatas:       testData,
+		SignedIdentity: NewPRMMatchRepoDigestOrExact(),
+	}, pr)
+}
+
 // Return the result of modifying validJSON with fn and unmarshaling it into *pr
 func tryUnmarshalModifiedSigstoreSigned(t *testing.T, pr *prSigstoreSigned, validJSON []byte, modifyFn func(mSA)) error {
 	var tmp mSA
@@ -252,6 +337,10 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 			func(v mSA) { delete(v, "keyData") },
 			// Both "keyPath" and "keyData" is present
 			func(v mSA) { v["keyPath"] = "/foo/bar" },
+			// Both "keyPaths" and "keyData" is present
+			func(v mSA) { v["keyPaths"] = []string{"/foo/bar", "/foo/baz"} },
+			// Both "keyData" and "keyDatas" is present
+			func(v mSA) { v["keyDatas"] = [][]byte{[]byte("abc")} },
 			// Both "keyData" and "fulcio" is present
 			func(v mSA) {
 				v["fulcio"] = mSA{
@@ -262,9 +351,19 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 			},
 			// Invalid "keyPath" field
 			func(v mSA) { delete(v, "keyData"); v["keyPath"] = 1 },
+			// Invalid "keyPaths" field
+			func(v mSA) { delete(v, "keyData"); v["keyPaths"] = 1 },
+			func(v mSA) { delete(v, "keyData"); v["keyPaths"] = []int{1} },
+			// Empty "keyPaths" field
+			func(v mSA) { delete(v, "keyData"); v["keyPaths"] = []string{} },
 			// Invalid "keyData" field
 			func(v mSA) { v["keyData"] = 1 },
 			func(v mSA) { v["keyData"] = "this is invalid base64" },
+			// Invalid "keyDatas" field
+			func(v mSA) { delete(v, "keyData"); v["keyDatas"] = 1 },
+			func(v mSA) { delete(v, "keyData"); v["keyDatas"] = []string{"this is invalid base64"} },
+			// Empty "keyDatas" field
+			func(v mSA) { delete(v, "keyData"); v["keyDatas"] = []string{} },
 			// Invalid "fulcio" field
 			func(v mSA) { v["fulcio"] = 1 },
 			func(v mSA) { v["fulcio"] = mSA{} },
@@ -297,6 +396,24 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 		otherJSONParser: newPolicyRequirementFromJSON,
 		duplicateFields: []string{"type", "keyPath", "signedIdentity"},
 	}.run(t)
+	// Test keyPaths-specific duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSignedKeyPaths([]string{"/foo/bar", "/foo/baz"}, NewPRMMatchRepoDigestOrExact())
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPaths", "signedIdentity"},
+	}.run(t)
+	// Test keyDatas-specific duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSignedKeyDatas([][]byte{[]byte("abc"), []byte("def")}, NewPRMMatchRepoDigestOrExact())
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyDatas", "signedIdentity"},
+	}.run(t)
 	// Test Fulcio and rekorPublicKeyPath duplicate fields
 	testFulcio, err := NewPRSigstoreSignedFulcio(
 		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
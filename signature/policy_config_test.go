@@ -115,6 +115,16 @@ var policyFixtureContents = &Policy{
 					PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
 				),
 			},
+			"example.com/threshold-example": {
+				xNewPRThresholdSigned(2, PolicyRequirements{
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/keys/release-key-1.gpg", NewPRMMatchRepoDigestOrExact()),
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/keys/release-key-2.gpg", NewPRMMatchRepoDigestOrExact()),
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPath("/keys/release-key-3.pub"),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+					),
+				}),
+			},
 		},
 	},
 }
@@ -1009,6 +1019,100 @@ func TestPRSignedBaseLayerUnmarshalJSON(t *testing.T) {
 	}.run(t)
 }
 
+// xNewPRThresholdSigned is like NewPRThresholdSigned, except it must not fail.
+func xNewPRThresholdSigned(threshold int, signers PolicyRequirements) PolicyRequirement {
+	pr, err := NewPRThresholdSigned(threshold, signers)
+	if err != nil {
+		panic("xNewPRThresholdSigned failed")
+	}
+	return pr
+}
+
+func TestNewPRThresholdSigned(t *testing.T) {
+	testSigners := PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/foo/bar", NewPRMMatchRepoDigestOrExact()),
+		xNewPRSignedByKeyData(SBKeyTypeGPGKeys, []byte("abc"), NewPRMMatchRepoDigestOrExact()),
+		xNewPRSigstoreSigned(
+			PRSigstoreSignedWithKeyPath("/foo/baz"),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+		),
+	}
+
+	// Success
+	for _, threshold := range []int{1, 2, 3} {
+		_pr, err := NewPRThresholdSigned(threshold, testSigners)
+		require.NoError(t, err)
+		pr, ok := _pr.(*prThresholdSigned)
+		require.True(t, ok)
+		assert.Equal(t, &prThresholdSigned{
+			prCommon:  prCommon{prTypeThresholdSigned},
+			Threshold: threshold,
+			Signers:   testSigners,
+		}, pr)
+	}
+
+	// Invalid threshold
+	for _, threshold := range []int{-1, 0, 4} {
+		_, err := NewPRThresholdSigned(threshold, testSigners)
+		assert.Error(t, err)
+	}
+	// No signers
+	_, err := NewPRThresholdSigned(1, PolicyRequirements{})
+	assert.Error(t, err)
+	_, err = NewPRThresholdSigned(1, nil)
+	assert.Error(t, err)
+	// Signers which are not signature requirements
+	for _, signer := range []PolicyRequirement{
+		NewPRInsecureAcceptAnything(),
+		NewPRReject(),
+		xNewPRThresholdSigned(1, testSigners),
+	} {
+		_, err := NewPRThresholdSigned(1, PolicyRequirements{testSigners[0], signer})
+		assert.Error(t, err)
+	}
+}
+
+func TestPRThresholdSignedUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prThresholdSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRThresholdSigned(2, PolicyRequirements{
+				xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/foo/bar", NewPRMMatchRepoDigestOrExact()),
+				xNewPRSigstoreSigned(
+					PRSigstoreSignedWithKeyPath("/foo/baz"),
+					PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+				),
+			})
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// The "threshold" field is missing
+			func(v mSA) { delete(v, "threshold") },
+			// Invalid "threshold" field
+			func(v mSA) { v["threshold"] = "this is invalid" },
+			func(v mSA) { v["threshold"] = 0 },
+			func(v mSA) { v["threshold"] = 3 },
+			// The "signers" field is missing
+			func(v mSA) { delete(v, "signers") },
+			// Invalid "signers" field
+			func(v mSA) { v["signers"] = "this is invalid" },
+			func(v mSA) { v["signers"] = []any{} },
+			func(v mSA) { v["signers"] = nil },
+			func(v mSA) { v["signers"] = []any{mSA{"type": "this is invalid"}, mSA{"type": "reject"}} },
+			// A signer which is not a signature requirement
+			func(v mSA) { v["signers"] = []any{mSA{"type": "reject"}, mSA{"type": "insecureAcceptAnything"}} },
+		},
+		duplicateFields: []string{"type", "threshold", "signers"},
+	}.run(t)
+}
+
 func TestNewPolicyReferenceMatchFromJSON(t *testing.T) {
 	// Sample success. Others tested in the individual PolicyReferenceMatch.UnmarshalJSON implementations.
 	validPRM := NewPRMMatchRepoDigestOrExact()
@@ -118,7 +118,26 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 		require.NoError(t, err)
 		res, err := pr.prepareTrustRoot()
 		require.NoError(t, err)
-		assert.NotNil(t, res.publicKey)
+		assert.Len(t, res.publicKeys, 1)
+		assert.Nil(t, res.fulcio)
+		assert.Nil(t, res.rekorPublicKey)
+	}
+	// Success with multiple public keys
+	for _, c := range [][]PRSigstoreSignedOption{
+		{
+			PRSigstoreSignedWithKeyPaths([]string{testKeyPath, "fixtures/cosign2.pub"}),
+			testIdentityOption,
+		},
+		{
+			PRSigstoreSignedWithKeyDatas([][]byte{testKeyData, testKeyData}),
+			testIdentityOption,
+		},
+	} {
+		pr, err := newPRSigstoreSigned(c...)
+		require.NoError(t, err)
+		res, err := pr.prepareTrustRoot()
+		require.NoError(t, err)
+		assert.Len(t, res.publicKeys, 2)
 		assert.Nil(t, res.fulcio)
 		assert.Nil(t, res.rekorPublicKey)
 	}
@@ -131,7 +150,7 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 	require.NoError(t, err)
 	res, err := pr.prepareTrustRoot()
 	require.NoError(t, err)
-	assert.Nil(t, res.publicKey)
+	assert.Nil(t, res.publicKeys)
 	assert.NotNil(t, res.fulcio)
 	assert.NotNil(t, res.rekorPublicKey)
 	// Success with Rekor public key
@@ -151,7 +170,7 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 		require.NoError(t, err)
 		res, err := pr.prepareTrustRoot()
 		require.NoError(t, err)
-		assert.NotNil(t, res.publicKey)
+		assert.Len(t, res.publicKeys, 1)
 		assert.Nil(t, res.fulcio)
 		assert.NotNil(t, res.rekorPublicKey)
 	}
@@ -175,6 +194,18 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 			KeyData:        []byte("this is invalid"),
 			SignedIdentity: testIdentity,
 		},
+		{ // Invalid public key in KeyPaths
+			KeyPaths:       []string{testKeyPath, "fixtures/image.signature"},
+			SignedIdentity: testIdentity,
+		},
+		{ // Unusable public key path in KeyPaths
+			KeyPaths:       []string{testKeyPath, "fixtures/this/does/not/exist"},
+			SignedIdentity: testIdentity,
+		},
+		{ // Invalid public key in KeyDatas
+			KeyDatas:       [][]byte{testKeyData, []byte("this is invalid")},
+			SignedIdentity: testIdentity,
+		},
 		{ // Invalid Fulcio configuration
 			Fulcio:             &prSigstoreSignedFulcio{},
 			RekorPublicKeyData: testKeyData,
@@ -328,6 +359,31 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	sar, err = pr.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
 	assertAccepted(sar, err)
 
+	// Successful key+Rekor use, with multiple keys
+	for _, keyPaths := range [][]string{
+		{"fixtures/cosign.pub", "fixtures/cosign2.pub"},
+		{"fixtures/cosign2.pub", "fixtures/cosign.pub"},
+	} {
+		pr2, err := newPRSigstoreSigned(
+			PRSigstoreSignedWithKeyPaths(keyPaths),
+			PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+			PRSigstoreSignedWithSignedIdentity(prm),
+		)
+		require.NoError(t, err)
+		sar, err = pr2.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
+		assertAccepted(sar, err)
+	}
+	// key+Rekor, the Rekor SET does not match any of the keys
+	pr2, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign.pub"}),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = pr2.isSignatureAccepted(context.Background(), nil, testKeyRekorImageSig)
+	assertRejected(sar, err)
+
 	// key+Rekor, missing Rekor SET annotation
 	sar, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithoutAnnotation(t, testKeyRekorImageSig, signature.SigstoreSETAnnotationKey))
@@ -340,7 +396,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 			"this is not a valid SET"))
 	assertRejected(sar, err)
 	// Fulcio: A Rekor SET which we don’t accept (one of many reasons)
-	pr2, err := newPRSigstoreSigned(
+	pr2, err = newPRSigstoreSigned(
 		PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
 		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/cosign.pub"), // not rekor.pub = a key mismatch
 		PRSigstoreSignedWithSignedIdentity(prm),
@@ -466,6 +522,21 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
 	assertAccepted(sar, err)
 
+	// Successful validation, with KeyPaths and KeyDatas, with the matching key in any position
+	keyData2, err := os.ReadFile("fixtures/cosign2.pub")
+	require.NoError(t, err)
+	for _, opt := range []PRSigstoreSignedOption{
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign2.pub"}),
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign2.pub", "fixtures/cosign.pub"}),
+		PRSigstoreSignedWithKeyDatas([][]byte{keyData, keyData2}),
+		PRSigstoreSignedWithKeyDatas([][]byte{keyData2, keyData}),
+	} {
+		pr, err = newPRSigstoreSigned(opt, PRSigstoreSignedWithSignedIdentity(prm))
+		require.NoError(t, err)
+		sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+		assertAccepted(sar, err)
+	}
+
 	// A signature which does not verify
 	pr, err = newPRSigstoreSigned(
 		PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
@@ -488,6 +559,15 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
 	sar, err = pr.isSignatureAccepted(context.Background(), nil, sigstoreSignatureFromFile(t, "fixtures/unknown-cosign-key.signature"))
 	assertRejected(sar, err)
+	// … also with multiple keys
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPaths([]string{"fixtures/cosign.pub", "fixtures/cosign2.pub"}),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = pr.isSignatureAccepted(context.Background(), nil, sigstoreSignatureFromFile(t, "fixtures/unknown-cosign-key.signature"))
+	assertRejected(sar, err)
 
 	// A valid signature with a rejected identity.
 	nonmatchingPRM, err := NewPRMExactReference("this/doesnt:match")
@@ -0,0 +1,123 @@
+// Policy evaluation for prThresholdSigned.
+
+package signature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/multierr"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+)
+
+func (pr *prThresholdSigned) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	// A single signature can’t satisfy the threshold on its own, but it is made by an accepted author if any of the signers accepts it.
+	var rejections []error
+	for _, signer := range pr.Signers {
+		switch res, as, err := signer.isSignatureAuthorAccepted(ctx, image, sig); res {
+		case sarAccepted:
+			return sarAccepted, as, nil
+		case sarRejected:
+			rejections = append(rejections, err)
+		default:
+			rejections = append(rejections, fmt.Errorf(`Internal error: Unexpected signature verification result %q`, string(res)))
+		}
+	}
+	if len(rejections) == 0 { // Coverage: newPRThresholdSigned rejects requirements without signers.
+		return sarRejected, nil, errors.New("Internal inconsistency: no signers specified")
+	}
+	return sarRejected, nil, PolicyRequirementError(multierr.Format("None of the signers accepted the signature, reasons: ", "; ", "", rejections).Error())
+}
+
+// signerAcceptsSignature returns true if signer, one of pr.Signers, accepts sig as a signature of image.
+// If it returns false, err must be non-nil.
+func (pr *prThresholdSigned) signerAcceptsSignature(ctx context.Context, image private.UnparsedImage, signer PolicyRequirement, sig signature.Signature) (bool, error) {
+	var res signatureAcceptanceResult
+	var err error
+	switch signer := signer.(type) {
+	case *prSignedBy:
+		simpleSig, ok := sig.(signature.SimpleSigning)
+		if !ok {
+			return false, PolicyRequirementError("Not a simple signing signature")
+		}
+		res, _, err = signer.isSignatureAuthorAccepted(ctx, image, simpleSig.UntrustedSignature())
+	case *prSigstoreSigned:
+		sigstoreSig, ok := sig.(signature.Sigstore)
+		if !ok || sigstoreSig.UntrustedMIMEType() != signature.SigstoreSignatureMIMEType {
+			return false, PolicyRequirementError("Not a sigstore signature")
+		}
+		res, err = signer.isSignatureAccepted(ctx, image, sigstoreSig)
+	default: // Coverage: newPRThresholdSigned rejects such signers.
+		return false, fmt.Errorf("Internal inconsistency: unexpected signer type %T", signer)
+	}
+	switch res {
+	case sarAccepted:
+		return true, nil
+	case sarRejected:
+		return false, err
+	default:
+		return false, fmt.Errorf(`Internal error: Unexpected signature verification result %q`, string(res))
+	}
+}
+
+func (pr *prThresholdSigned) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	sigs, err := image.UntrustedSignatures(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// accepted[i] lists the indices of signatures accepted by pr.Signers[i].
+	accepted := make([][]int, len(pr.Signers))
+	var rejections []error
+	for i, signer := range pr.Signers {
+		for j, sig := range sigs {
+			ok, err := pr.signerAcceptsSignature(ctx, image, signer, sig)
+			if !ok {
+				rejections = append(rejections, fmt.Errorf("signer %d, signature %d: %w", i, j, err))
+				continue
+			}
+			accepted[i] = append(accepted[i], j)
+		}
+	}
+
+	// A single signature must not count towards more than one signer, e.g. if the same key is trusted by two of the signers,
+	// so find the largest number of signers which can be assigned distinct signatures (a maximum bipartite matching).
+	signerForSignature := make([]int, len(sigs)) // Index into pr.Signers, or -1
+	for j := range signerForSignature {
+		signerForSignature[j] = -1
+	}
+	var assignSigner func(signer int, visited []bool) bool
+	assignSigner = func(signer int, visited []bool) bool {
+		for _, sig := range accepted[signer] {
+			if visited[sig] {
+				continue
+			}
+			visited[sig] = true
+			if signerForSignature[sig] == -1 || assignSigner(signerForSignature[sig], visited) {
+				signerForSignature[sig] = signer
+				return true
+			}
+		}
+		return false
+	}
+	satisfied := 0
+	for signer := range pr.Signers {
+		if assignSigner(signer, make([]bool, len(sigs))) {
+			satisfied++
+			if satisfied >= pr.Threshold {
+				return true, nil
+			}
+		}
+	}
+
+	if len(sigs) == 0 {
+		return false, PolicyRequirementError(fmt.Sprintf("Signatures by %d signers were required, but no signature exists", pr.Threshold))
+	}
+	summary := fmt.Sprintf("Signatures by %d signers were required, but only %d were accepted", pr.Threshold, satisfied)
+	if len(rejections) > 0 {
+		summary = fmt.Sprintf("%s, rejection reasons: %v", summary, multierr.Format("", "; ", "", rejections))
+	}
+	return false, PolicyRequirementError(summary)
+}
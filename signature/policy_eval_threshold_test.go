@@ -0,0 +1,198 @@
+package signature
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/signature/sigstore"
+	"github.com/stretchr/testify/require"
+)
+
+const thresholdTestDockerReference = "testing/manifest:latest"
+
+// thresholdTestSigstoreKey is a sigstore key usable in tests of prThresholdSigned.
+type thresholdTestSigstoreKey struct {
+	publicKey []byte
+	signature []byte // A signature of fixtures/dir-img-valid/manifest.json, for thresholdTestDockerReference
+}
+
+// newThresholdTestSigstoreKey generates a sigstore key, and uses it to sign fixtures/dir-img-valid/manifest.json.
+func newThresholdTestSigstoreKey(t *testing.T) thresholdTestSigstoreKey {
+	passphrase := []byte("some passphrase")
+	keyPair, err := sigstore.GenerateKeyPair(passphrase)
+	require.NoError(t, err)
+	privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+	require.NoError(t, err)
+
+	signer, err := sigstore.NewSigner(sigstore.WithPrivateKeyFile(privateKeyFile, passphrase))
+	require.NoError(t, err)
+	defer signer.Close()
+	manifest, err := os.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	ref, err := reference.ParseNormalizedNamed(thresholdTestDockerReference)
+	require.NoError(t, err)
+	sig, err := internalSigner.SignImageManifest(context.Background(), signer, manifest, ref)
+	require.NoError(t, err)
+	blob, err := signature.Blob(sig)
+	require.NoError(t, err)
+	return thresholdTestSigstoreKey{publicKey: keyPair.PublicKey, signature: blob}
+}
+
+// thresholdTestImage returns an image with the manifest of fixtures/dir-img-valid and signatures.
+func thresholdTestImage(t *testing.T, signatures ...[]byte) private.UnparsedImage {
+	dir := t.TempDir()
+	manifest, err := os.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0o644)
+	require.NoError(t, err)
+	for i, sig := range signatures {
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("signature-%d", i+1)), sig, 0o644)
+		require.NoError(t, err)
+	}
+	return dirImageMock(t, dir, thresholdTestDockerReference)
+}
+
+func TestPRThresholdSignedIsSignatureAuthorAccepted(t *testing.T) {
+	gpgSig, err := os.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	sigstoreKey := newThresholdTestSigstoreKey(t)
+	testImage := thresholdTestImage(t, gpgSig)
+	gpgSigner := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepoDigestOrExact())
+	otherGPGSigner := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-2.gpg", NewPRMMatchRepoDigestOrExact())
+	sigstoreSigner := xNewPRSigstoreSigned(
+		PRSigstoreSignedWithKeyData(sigstoreKey.publicKey),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+	)
+
+	// A signature accepted by one of the signers
+	for _, signers := range []PolicyRequirements{
+		{gpgSigner, sigstoreSigner},
+		{sigstoreSigner, otherGPGSigner, gpgSigner},
+	} {
+		pr := xNewPRThresholdSigned(2, signers)
+		sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, gpgSig)
+		assertSARAccepted(t, sar, parsedSig, err, Signature{
+			DockerManifestDigest: TestImageManifestDigest,
+			DockerReference:      thresholdTestDockerReference,
+		})
+	}
+
+	// A signature not accepted by any of the signers
+	pr := xNewPRThresholdSigned(1, PolicyRequirements{otherGPGSigner, sigstoreSigner})
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, gpgSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+}
+
+func TestPRThresholdSignedIsRunningImageAllowed(t *testing.T) {
+	gpgSig, err := os.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	sigstoreKey1 := newThresholdTestSigstoreKey(t)
+	sigstoreKey2 := newThresholdTestSigstoreKey(t)
+	unusedSigstoreKey := newThresholdTestSigstoreKey(t)
+
+	gpgSigner := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepoDigestOrExact())
+	otherGPGSigner := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-2.gpg", NewPRMMatchRepoDigestOrExact())
+	sigstoreSigner := func(keys ...thresholdTestSigstoreKey) PolicyRequirement {
+		keyDatas := [][]byte{}
+		for _, k := range keys {
+			keyDatas = append(keyDatas, k.publicKey)
+		}
+		return xNewPRSigstoreSigned(
+			PRSigstoreSignedWithKeyDatas(keyDatas),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+		)
+	}
+	signer1 := sigstoreSigner(sigstoreKey1)
+	signer2 := sigstoreSigner(sigstoreKey2)
+	unusedSigner := sigstoreSigner(unusedSigstoreKey)
+	signer1Or2 := sigstoreSigner(sigstoreKey1, sigstoreKey2)
+
+	allSigned := thresholdTestImage(t, gpgSig, sigstoreKey1.signature, sigstoreKey2.signature)
+	for _, c := range []struct {
+		name      string
+		image     private.UnparsedImage
+		threshold int
+		signers   PolicyRequirements
+		allowed   bool
+	}{
+		{
+			name:      "all signers, simple signing and sigstore",
+			image:     allSigned,
+			threshold: 3,
+			signers:   PolicyRequirements{gpgSigner, signer1, signer2},
+			allowed:   true,
+		},
+		{
+			name:      "2 of 3",
+			image:     allSigned,
+			threshold: 2,
+			signers:   PolicyRequirements{otherGPGSigner, signer2, gpgSigner},
+			allowed:   true,
+		},
+		{
+			name:      "2 of 3, only one signed",
+			image:     allSigned,
+			threshold: 2,
+			signers:   PolicyRequirements{otherGPGSigner, unusedSigner, signer1},
+			allowed:   false,
+		},
+		{
+			name:      "2 of 2, one signature missing",
+			image:     thresholdTestImage(t, gpgSig, sigstoreKey1.signature),
+			threshold: 2,
+			signers:   PolicyRequirements{signer2, gpgSigner},
+			allowed:   false,
+		},
+		{
+			name:      "a single signature does not satisfy two signers",
+			image:     thresholdTestImage(t, sigstoreKey1.signature),
+			threshold: 2,
+			signers:   PolicyRequirements{signer1, signer1Or2},
+			allowed:   false,
+		},
+		{
+			name:      "signers with overlapping keys, each satisfied by a different signature",
+			image:     thresholdTestImage(t, sigstoreKey1.signature, sigstoreKey2.signature),
+			threshold: 2,
+			signers:   PolicyRequirements{signer1Or2, signer1},
+			allowed:   true,
+		},
+		{
+			name:      "duplicate signatures",
+			image:     thresholdTestImage(t, sigstoreKey1.signature, sigstoreKey1.signature),
+			threshold: 2,
+			signers:   PolicyRequirements{signer1, signer2},
+			allowed:   false,
+		},
+		{
+			name:      "unsigned",
+			image:     thresholdTestImage(t),
+			threshold: 1,
+			signers:   PolicyRequirements{gpgSigner, signer1},
+			allowed:   false,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			pr := xNewPRThresholdSigned(c.threshold, c.signers)
+			allowed, err := pr.isRunningImageAllowed(context.Background(), c.image)
+			if c.allowed {
+				assertRunningAllowed(t, allowed, err)
+			} else {
+				assertRunningRejectedPolicyRequirement(t, allowed, err)
+			}
+		})
+	}
+
+	// Error reading signatures.
+	pr := xNewPRThresholdSigned(1, PolicyRequirements{gpgSigner})
+	allowed, err := pr.isRunningImageAllowed(context.Background(), dirImageMock(t, createInvalidSigDir(t), thresholdTestDockerReference))
+	assertRunningRejected(t, allowed, err)
+}
@@ -4,16 +4,23 @@
 package fulcio
 
 import (
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"strings"
 
+	"github.com/containers/image/v5/internal/iolimits"
 	"github.com/containers/image/v5/internal/useragent"
 	"github.com/containers/image/v5/signature/sigstore/internal"
 	"github.com/sigstore/fulcio/pkg/api"
@@ -160,3 +167,101 @@ func WithFulcioAndInteractiveOIDC(fulcioURL *url.URL, oidcIssuerURL *url.URL, oi
 		return setupSignerWithFulcio(s, fulcioURL, oidcIDToken)
 	}
 }
+
+// ambientOIDCIDTokenFile is the path of an OIDC ID token which may be provided by the environment,
+// the same path as used by cosign (e.g. when running in a Kubernetes pod with a projected service account token).
+var ambientOIDCIDTokenFile = "/var/run/sigstore/cosign/oidc-token"
+
+// ambientOIDCIDTokenAudience is the audience requested for ambient OIDC ID tokens, as expected by Fulcio.
+const ambientOIDCIDTokenAudience = "sigstore"
+
+// WithFulcioAndAmbientOIDCIDToken sets up signing to use a short-lived key and a Fulcio-issued certificate
+// based on an OIDC ID token provided by the environment, typically by a CI system, without any user interaction.
+// The token is obtained, in this order of preference,
+//   - from the SIGSTORE_ID_TOKEN environment variable,
+//   - from GitHub Actions (using ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN; the workflow
+//     must have the "id-token: write" permission),
+//   - or from /var/run/sigstore/cosign/oidc-token.
+//
+// ctx is used when requesting the token.
+func WithFulcioAndAmbientOIDCIDToken(ctx context.Context, fulcioURL *url.URL) internal.Option {
+	return func(s *internal.SigstoreSigner) error {
+		if s.PrivateKey != nil {
+			return fmt.Errorf("multiple private key sources specified when preparing to create sigstore signatures")
+		}
+
+		rawToken, err := ambientOIDCIDToken(ctx)
+		if err != nil {
+			return err
+		}
+		staticTokenGetter := oauthflow.StaticTokenGetter{RawToken: rawToken}
+		oidcIDToken, err := staticTokenGetter.GetIDToken(nil, oauth2.Config{})
+		if err != nil {
+			return fmt.Errorf("parsing OIDC token: %w", err)
+		}
+
+		return setupSignerWithFulcio(s, fulcioURL, oidcIDToken)
+	}
+}
+
+// ambientOIDCIDToken returns a raw OIDC ID token provided by the environment, as described in WithFulcioAndAmbientOIDCIDToken.
+func ambientOIDCIDToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("SIGSTORE_ID_TOKEN"); token != "" {
+		logrus.Debugf("Using an OIDC token from SIGSTORE_ID_TOKEN")
+		return token, nil
+	}
+
+	if requestURL, requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"); requestURL != "" && requestToken != "" {
+		logrus.Debugf("Requesting an OIDC token from GitHub Actions")
+		return gitHubActionsOIDCIDToken(ctx, requestURL, requestToken)
+	}
+
+	token, err := os.ReadFile(ambientOIDCIDTokenFile)
+	if err == nil {
+		logrus.Debugf("Using an OIDC token from %s", ambientOIDCIDTokenFile)
+		return strings.TrimSpace(string(token)), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("reading OIDC token: %w", err)
+	}
+	return "", errors.New("no OIDC token is provided by the environment")
+}
+
+// gitHubActionsOIDCIDToken requests an OIDC ID token from GitHub Actions, using requestURL and requestToken.
+func gitHubActionsOIDCIDToken(ctx context.Context, requestURL, requestToken string) (string, error) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("audience", ambientOIDCIDTokenAudience)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	req.Header.Set("User-Agent", useragent.DefaultUserAgent)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting OIDC token from GitHub Actions: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting OIDC token from GitHub Actions: HTTP status %s", res.Status)
+	}
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxAuthTokenBodySize)
+	if err != nil {
+		return "", err
+	}
+	var parsed struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("parsing OIDC token response from GitHub Actions: %w", err)
+	}
+	if parsed.Value == "" {
+		return "", errors.New("GitHub Actions did not return an OIDC token")
+	}
+	return parsed.Value, nil
+}
@@ -4,6 +4,7 @@
 package fulcio
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/url"
@@ -43,3 +44,18 @@ func WithFulcioAndInteractiveOIDC(fulcioURL *url.URL, oidcIssuerURL *url.URL, oi
 		return fmt.Errorf("fulcio disabled at compile time")
 	}
 }
+
+// WithFulcioAndAmbientOIDCIDToken sets up signing to use a short-lived key and a Fulcio-issued certificate
+// based on an OIDC ID token provided by the environment, typically by a CI system, without any user interaction.
+// The token is obtained, in this order of preference,
+//   - from the SIGSTORE_ID_TOKEN environment variable,
+//   - from GitHub Actions (using ACTIONS_ID_TOKEN_REQUEST_URL and ACTIONS_ID_TOKEN_REQUEST_TOKEN; the workflow
+//     must have the "id-token: write" permission),
+//   - or from /var/run/sigstore/cosign/oidc-token.
+//
+// ctx is used when requesting the token.
+func WithFulcioAndAmbientOIDCIDToken(ctx context.Context, fulcioURL *url.URL) internal.Option {
+	return func(s *internal.SigstoreSigner) error {
+		return fmt.Errorf("fulcio disabled at compile time")
+	}
+}
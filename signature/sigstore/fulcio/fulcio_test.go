@@ -0,0 +1,59 @@
+//go:build !containers_image_fulcio_stub
+// +build !containers_image_fulcio_stub
+
+package fulcio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmbientOIDCIDToken(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer request-token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "sigstore", r.URL.Query().Get("audience"))
+		assert.Equal(t, "value", r.URL.Query().Get("existing"))
+		_, err := rw.Write([]byte(`{"value":"github-token"}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	tokenFile := filepath.Join(t.TempDir(), "oidc-token")
+	err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600)
+	require.NoError(t, err)
+	defer func(original string) { ambientOIDCIDTokenFile = original }(ambientOIDCIDTokenFile)
+
+	for _, c := range []struct {
+		sigstoreIDToken, requestURL, requestToken, tokenFile string
+		expected                                             string // "" if an error is expected
+	}{
+		{"env-token", server.URL + "?existing=value", "request-token", tokenFile, "env-token"},
+		{"", server.URL + "?existing=value", "request-token", tokenFile, "github-token"},
+		{"", server.URL + "?existing=value", "invalid-token", tokenFile, ""},
+		{"", server.URL + "?existing=value", "", tokenFile, "file-token"},
+		{"", "", "", tokenFile, "file-token"},
+		{"", "", "", filepath.Join(t.TempDir(), "does-not-exist"), ""},
+	} {
+		t.Setenv("SIGSTORE_ID_TOKEN", c.sigstoreIDToken)
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", c.requestURL)
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", c.requestToken)
+		ambientOIDCIDTokenFile = c.tokenFile
+		token, err := ambientOIDCIDToken(ctx)
+		if c.expected == "" {
+			assert.Error(t, err, "%#v", c)
+		} else {
+			require.NoError(t, err, "%#v", c)
+			assert.Equal(t, c.expected, token, "%#v", c)
+		}
+	}
+}
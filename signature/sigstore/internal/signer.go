@@ -23,6 +23,7 @@ type Option func(*SigstoreSigner) error
 type SigstoreSigner struct {
 	PrivateKey       sigstoreSignature.Signer // May be nil during initialization
 	SigningKeyOrCert []byte                   // For possible Rekor upload; always initialized together with PrivateKey
+	PrivateKeyCloser func() error             // Or nil; releases resources used by PrivateKey (e.g. a hardware token session)
 
 	// Fulcio results to include
 	FulcioGeneratedCertificate      []byte // Or nil
@@ -91,5 +92,8 @@ func (s *SigstoreSigner) SignImageManifest(ctx context.Context, m []byte, docker
 }
 
 func (s *SigstoreSigner) Close() error {
+	if s.PrivateKeyCloser != nil {
+		return s.PrivateKeyCloser()
+	}
 	return nil
 }
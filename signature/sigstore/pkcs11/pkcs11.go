@@ -0,0 +1,428 @@
+//go:build cgo
+// +build cgo
+
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/signature/sigstore/internal"
+	ocipkcs11 "github.com/containers/ocicrypt/crypto/pkcs11"
+	p11 "github.com/miekg/pkcs11"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	pkcs11uri "github.com/stefanberger/go-pkcs11uri"
+)
+
+// PINCallback is called to obtain the PIN of a PKCS#11 token, described by tokenDescription (typically the token label),
+// e.g. by prompting the user.
+type PINCallback func(tokenDescription string) (string, error)
+
+// WithPKCS11Key returns a sigstore.Option which signs using a private key held in a PKCS#11 token (e.g. a HSM or a YubiKey),
+// identified by keyURI, an RFC 7512 "pkcs11:" URI, e.g.
+// "pkcs11:token=YubiKey%20PIV;object=Private%20key%20for%20Digital%20Signature?module-path=/usr/lib64/libykcs11.so".
+// The URI must identify the PKCS#11 module using a "module-path" or "module-name" attribute; a "module-name" is looked up
+// in the usual system directories.
+//
+// If the token requires logging in and keyURI contains neither a "pin-value" nor a "pin-source" attribute,
+// pinCallback is called with a description of the token to obtain the PIN; if pinCallback is nil, using the key fails.
+//
+// The token session stays open until the returned signer is closed.
+func WithPKCS11Key(keyURI string, pinCallback PINCallback) internal.Option {
+	return func(s *internal.SigstoreSigner) error {
+		if s.PrivateKey != nil {
+			return fmt.Errorf("multiple private key sources specified when preparing to create sigstore signatures")
+		}
+
+		key, err := openTokenKey(keyURI, pinCallback)
+		if err != nil {
+			return err
+		}
+		publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(key.publicKey)
+		if err != nil {
+			key.close()
+			return fmt.Errorf("converting public key to PEM: %w", err)
+		}
+		s.PrivateKey = key
+		s.SigningKeyOrCert = publicKeyPEM
+		s.PrivateKeyCloser = key.close
+		return nil
+	}
+}
+
+// tokenKey is a sigstoreSignature.Signer using a private key in a PKCS#11 token.
+type tokenKey struct {
+	mutex      sync.Mutex // Protects the session; PKCS#11 sessions must not be used concurrently.
+	ctx        *p11.Ctx
+	session    p11.SessionHandle
+	privateKey p11.ObjectHandle
+	publicKey  crypto.PublicKey // *ecdsa.PublicKey or *rsa.PublicKey
+}
+
+// openTokenKey opens a session to the token containing the key identified by keyURI, logs in if necessary,
+// and returns the key.
+func openTokenKey(keyURI string, pinCallback PINCallback) (*tokenKey, error) {
+	uri := pkcs11uri.New()
+	if err := uri.Parse(keyURI); err != nil {
+		return nil, fmt.Errorf("parsing PKCS#11 URI %q: %w", keyURI, err)
+	}
+	if objectType, ok := uri.GetPathAttribute("type", false); ok && objectType != "private" {
+		return nil, fmt.Errorf("PKCS#11 URI %q refers to a %q object, not a private key", keyURI, objectType)
+	}
+	id, _ := uri.GetPathAttribute("id", false)
+	label, _ := uri.GetPathAttribute("object", false)
+	if id == "" && label == "" {
+		return nil, fmt.Errorf(`PKCS#11 URI %q must identify a key using an "id" or "object" attribute`, keyURI)
+	}
+	uri.SetModuleDirectories(ocipkcs11.GetDefaultModuleDirectories())
+	uri.SetAllowAnyModule(true) // The URI is provided by the caller, not by an untrusted party.
+	module, err := uri.GetModule()
+	if err != nil {
+		return nil, fmt.Errorf("finding PKCS#11 module: %w", err)
+	}
+
+	ctx := p11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("loading PKCS#11 module %s failed", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("initializing PKCS#11 module %s: %w", module, err)
+	}
+	key := &tokenKey{ctx: ctx}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			key.close()
+		}
+	}()
+
+	slot, tokenInfo, err := findSlot(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("opening a session to PKCS#11 token %q: %w", tokenInfo.Label, err)
+	}
+	key.session = session
+	if tokenInfo.Flags&p11.CKF_LOGIN_REQUIRED != 0 {
+		if err := login(ctx, session, uri, tokenInfo, pinCallback); err != nil {
+			return nil, err
+		}
+	}
+
+	privateKeys, err := findObjects(ctx, session, p11.CKO_PRIVATE_KEY, id, label)
+	if err != nil {
+		return nil, err
+	}
+	switch len(privateKeys) {
+	case 0:
+		return nil, fmt.Errorf("private key %q not found in PKCS#11 token %q", keyURI, tokenInfo.Label)
+	case 1:
+		key.privateKey = privateKeys[0]
+	default:
+		return nil, fmt.Errorf("PKCS#11 URI %q matches more than one private key in token %q", keyURI, tokenInfo.Label)
+	}
+	publicKey, err := findPublicKey(ctx, session, id, label)
+	if err != nil {
+		return nil, err
+	}
+	key.publicKey = publicKey
+
+	succeeded = true
+	return key, nil
+}
+
+// findSlot returns the slot, and information about its token, of the single token matching uri.
+func findSlot(ctx *p11.Ctx, uri *pkcs11uri.Pkcs11URI) (uint, p11.TokenInfo, error) {
+	var wantedSlotID *uint
+	if v, ok := uri.GetPathAttribute("slot-id", false); ok {
+		id, err := strconv.ParseUint(v, 10, 0)
+		if err != nil {
+			return 0, p11.TokenInfo{}, fmt.Errorf("invalid PKCS#11 slot-id %q: %w", v, err)
+		}
+		slotID := uint(id)
+		wantedSlotID = &slotID
+	}
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, p11.TokenInfo{}, fmt.Errorf("listing PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		if wantedSlotID != nil && slot != *wantedSlotID {
+			continue
+		}
+		tokenInfo, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, p11.TokenInfo{}, fmt.Errorf("reading information about PKCS#11 slot %d: %w", slot, err)
+		}
+		if tokenMatches(uri, tokenInfo) {
+			return slot, tokenInfo, nil
+		}
+	}
+	return 0, p11.TokenInfo{}, errors.New("no matching PKCS#11 token found")
+}
+
+// tokenMatches returns true if tokenInfo matches the token attributes of uri.
+func tokenMatches(uri *pkcs11uri.Pkcs11URI, tokenInfo p11.TokenInfo) bool {
+	for _, a := range []struct {
+		attribute string
+		value     string
+	}{
+		{"token", tokenInfo.Label},
+		{"manufacturer", tokenInfo.ManufacturerID},
+		{"model", tokenInfo.Model},
+		{"serial", tokenInfo.SerialNumber},
+	} {
+		// The values in TokenInfo are padded with spaces.
+		if v, ok := uri.GetPathAttribute(a.attribute, false); ok && v != strings.TrimRight(a.value, " ") {
+			return false
+		}
+	}
+	return true
+}
+
+// login logs into session as a user, using a PIN from uri or from pinCallback.
+func login(ctx *p11.Ctx, session p11.SessionHandle, uri *pkcs11uri.Pkcs11URI, tokenInfo p11.TokenInfo, pinCallback PINCallback) error {
+	tokenDescription := strings.TrimRight(tokenInfo.Label, " ")
+	var pin string
+	switch {
+	case uri.HasPIN():
+		p, err := uri.GetPIN()
+		if err != nil {
+			return fmt.Errorf("reading PIN for PKCS#11 token %q: %w", tokenDescription, err)
+		}
+		pin = p
+	case tokenInfo.Flags&p11.CKF_PROTECTED_AUTHENTICATION_PATH != 0:
+		// The PIN is entered e.g. using a PIN pad on the reader, not passed by us.
+	case pinCallback != nil:
+		p, err := pinCallback(tokenDescription)
+		if err != nil {
+			return fmt.Errorf("obtaining PIN for PKCS#11 token %q: %w", tokenDescription, err)
+		}
+		pin = p
+	default:
+		return fmt.Errorf("PKCS#11 token %q requires a PIN, but none was provided", tokenDescription)
+	}
+	if err := ctx.Login(session, p11.CKU_USER, pin); err != nil && !errors.Is(err, p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN)) {
+		return fmt.Errorf("logging into PKCS#11 token %q: %w", tokenDescription, err)
+	}
+	return nil
+}
+
+// findObjects returns objects of class with the specified id and label; "" matches any value.
+func findObjects(ctx *p11.Ctx, session p11.SessionHandle, class uint, id, label string) ([]p11.ObjectHandle, error) {
+	template := []*p11.Attribute{p11.NewAttribute(p11.CKA_CLASS, class)}
+	if id != "" {
+		template = append(template, p11.NewAttribute(p11.CKA_ID, []byte(id)))
+	}
+	if label != "" {
+		template = append(template, p11.NewAttribute(p11.CKA_LABEL, label))
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return nil, fmt.Errorf("searching PKCS#11 objects: %w", err)
+	}
+	objects, _, err := ctx.FindObjects(session, 2) // We only care whether there are 0, 1 or more.
+	if err2 := ctx.FindObjectsFinal(session); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, fmt.Errorf("searching PKCS#11 objects: %w", err)
+	}
+	return objects, nil
+}
+
+// findPublicKey returns the public key corresponding to the private key with id and label,
+// reading it from a public key object or, if there is none, from a certificate.
+func findPublicKey(ctx *p11.Ctx, session p11.SessionHandle, id, label string) (crypto.PublicKey, error) {
+	publicKeys, err := findObjects(ctx, session, p11.CKO_PUBLIC_KEY, id, label)
+	if err != nil {
+		return nil, err
+	}
+	if len(publicKeys) > 0 {
+		if attrs, err := ctx.GetAttributeValue(session, publicKeys[0], []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_EC_PARAMS, nil),
+			p11.NewAttribute(p11.CKA_EC_POINT, nil),
+		}); err == nil {
+			return ecPublicKeyFromAttributes(attrs[0].Value, attrs[1].Value)
+		}
+		attrs, err := ctx.GetAttributeValue(session, publicKeys[0], []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_MODULUS, nil),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading PKCS#11 public key: the key is neither an EC nor a RSA key: %w", err)
+		}
+		return rsaPublicKeyFromAttributes(attrs[0].Value, attrs[1].Value)
+	}
+
+	certificates, err := findObjects(ctx, session, p11.CKO_CERTIFICATE, id, label)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("neither a public key nor a certificate found for the PKCS#11 private key")
+	}
+	attrs, err := ctx.GetAttributeValue(session, certificates[0], []*p11.Attribute{p11.NewAttribute(p11.CKA_VALUE, nil)})
+	if err != nil {
+		return nil, fmt.Errorf("reading PKCS#11 certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(attrs[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PKCS#11 certificate: %w", err)
+	}
+	switch cert.PublicKey.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T in PKCS#11 certificate", cert.PublicKey)
+	}
+}
+
+// oidPublicKeyECDSA is the algorithm identifier of EC public keys, per RFC 5480.
+var oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+// ecPublicKeyFromAttributes returns an EC public key from the values of CKA_EC_PARAMS and CKA_EC_POINT.
+func ecPublicKeyFromAttributes(ecParams, ecPoint []byte) (*ecdsa.PublicKey, error) {
+	// CKA_EC_POINT is a DER-encoded OCTET STRING containing the point; some modules incorrectly return the raw point.
+	var point []byte
+	if rest, err := asn1.Unmarshal(ecPoint, &point); err != nil || len(rest) != 0 {
+		point = ecPoint
+	}
+	// Let crypto/x509 do the validation, by building a SubjectPublicKeyInfo; CKA_EC_PARAMS uses the same encoding
+	// as the algorithm parameters there.
+	spki, err := asn1.Marshal(struct {
+		Algorithm struct {
+			Algorithm  asn1.ObjectIdentifier
+			Parameters asn1.RawValue
+		}
+		PublicKey asn1.BitString
+	}{
+		Algorithm: struct {
+			Algorithm  asn1.ObjectIdentifier
+			Parameters asn1.RawValue
+		}{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: ecParams},
+		},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding PKCS#11 EC public key: %w", err)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PKCS#11 EC public key: %w", err)
+	}
+	ecPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok { // Coverage: This should never happen, the algorithm is always oidPublicKeyECDSA.
+		return nil, fmt.Errorf("unexpected public key type %T for a PKCS#11 EC public key", publicKey)
+	}
+	return ecPublicKey, nil
+}
+
+// rsaPublicKeyFromAttributes returns a RSA public key from the values of CKA_MODULUS and CKA_PUBLIC_EXPONENT.
+func rsaPublicKeyFromAttributes(modulus, publicExponent []byte) (*rsa.PublicKey, error) {
+	e := new(big.Int).SetBytes(publicExponent)
+	if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid PKCS#11 RSA public exponent %s", e.String())
+	}
+	n := new(big.Int).SetBytes(modulus)
+	if n.Sign() <= 0 {
+		return nil, errors.New("invalid PKCS#11 RSA modulus")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// PublicKey returns the public key of the token key.
+func (k *tokenKey) PublicKey(opts ...sigstoreSignature.PublicKeyOption) (crypto.PublicKey, error) {
+	return k.publicKey, nil
+}
+
+// rsaSHA256DigestInfoPrefix is the DER-encoded DigestInfo prefix for SHA-256, per RFC 8017 section 9.2.
+var rsaSHA256DigestInfoPrefix = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+// SignMessage signs message using the token key, using SHA-256, and returns a signature in the format used by
+// github.com/sigstore/sigstore/pkg/signature verifiers (ASN.1 for ECDSA, PKCS #1 v1.5 for RSA).
+func (k *tokenKey) SignMessage(message io.Reader, opts ...sigstoreSignature.SignOption) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	digest := h.Sum(nil)
+
+	var mechanism uint
+	var input []byte
+	switch k.publicKey.(type) {
+	case *ecdsa.PublicKey:
+		mechanism = p11.CKM_ECDSA
+		input = digest
+	case *rsa.PublicKey:
+		mechanism = p11.CKM_RSA_PKCS
+		input = append(bytes.Clone(rsaSHA256DigestInfoPrefix), digest...)
+	default: // Coverage: This should never happen, openTokenKey only returns ECDSA and RSA keys.
+		return nil, fmt.Errorf("internal error: unexpected public key type %T", k.publicKey)
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := k.ctx.SignInit(k.session, []*p11.Mechanism{p11.NewMechanism(mechanism, nil)}, k.privateKey); err != nil {
+		return nil, fmt.Errorf("signing using PKCS#11 key: %w", err)
+	}
+	sig, err := k.ctx.Sign(k.session, input)
+	if err != nil {
+		return nil, fmt.Errorf("signing using PKCS#11 key: %w", err)
+	}
+	if mechanism == p11.CKM_ECDSA {
+		return ecdsaSignatureToASN1(sig)
+	}
+	return sig, nil
+}
+
+// ecdsaSignatureToASN1 converts a PKCS#11 ECDSA signature (r || s) into the ASN.1 format used by crypto/ecdsa.
+func ecdsaSignatureToASN1(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, fmt.Errorf("invalid ECDSA signature length %d", len(sig))
+	}
+	half := len(sig) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(sig[:half]),
+		S: new(big.Int).SetBytes(sig[half:]),
+	})
+}
+
+// close logs out, closes the session and unloads the module.
+func (k *tokenKey) close() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.ctx == nil {
+		return nil
+	}
+	var err error
+	if k.session != 0 {
+		_ = k.ctx.Logout(k.session) // Fails if we have not logged in; that’s fine.
+		err = k.ctx.CloseSession(k.session)
+	}
+	if err2 := k.ctx.Finalize(); err == nil {
+		err = err2
+	}
+	k.ctx.Destroy()
+	k.ctx = nil
+	return err
+}
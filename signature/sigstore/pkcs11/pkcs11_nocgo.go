@@ -0,0 +1,20 @@
+//go:build !cgo
+// +build !cgo
+
+package pkcs11
+
+import (
+	"errors"
+
+	"github.com/containers/image/v5/signature/sigstore/internal"
+)
+
+// PINCallback is called to obtain the PIN of a PKCS#11 token, described by tokenDescription (typically the token label),
+// e.g. by prompting the user.
+type PINCallback func(tokenDescription string) (string, error)
+
+func WithPKCS11Key(keyURI string, pinCallback PINCallback) internal.Option {
+	return func(s *internal.SigstoreSigner) error {
+		return errors.New("PKCS#11 support requires cgo, which was disabled at compile time")
+	}
+}
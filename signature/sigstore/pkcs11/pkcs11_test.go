@@ -0,0 +1,130 @@
+//go:build cgo
+// +build cgo
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/containers/image/v5/signature/sigstore/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithPKCS11Key(t *testing.T) {
+	// Multiple private key sources
+	s := internal.SigstoreSigner{PrivateKey: &tokenKey{}}
+	err := WithPKCS11Key("pkcs11:object=key?module-path=/dev/null", nil)(&s)
+	assert.Error(t, err)
+
+	for _, uri := range []string{
+		"",                                     // Empty
+		"https://example.com",                  // Not a PKCS#11 URI
+		"pkcs11:token=t?module-path=/dev/null", // No key identification
+		"pkcs11:object=key;type=cert?module-path=/dev/null", // Not a private key
+		"pkcs11:object=key", // No module
+		"pkcs11:object=key?module-name=this-does-not-exist",  // Module not found
+		"pkcs11:object=key?module-path=/this/does/not/exist", // Module not found
+	} {
+		s := internal.SigstoreSigner{}
+		err := WithPKCS11Key(uri, nil)(&s)
+		assert.Error(t, err, uri)
+		assert.Nil(t, s.PrivateKey, uri)
+		assert.Nil(t, s.PrivateKeyCloser, uri)
+	}
+}
+
+func TestECPublicKeyFromAttributes(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		require.NoError(t, err)
+		ecdhKey, err := privateKey.PublicKey.ECDH()
+		require.NoError(t, err)
+		rawPoint := ecdhKey.Bytes()
+		var oid asn1.ObjectIdentifier
+		switch curve {
+		case elliptic.P256():
+			oid = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+		case elliptic.P384():
+			oid = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+		}
+		ecParams, err := asn1.Marshal(oid)
+		require.NoError(t, err)
+		wrappedPoint, err := asn1.Marshal(rawPoint)
+		require.NoError(t, err)
+
+		// Both the standard DER-wrapped point, and a raw point returned by some modules, are accepted.
+		for _, point := range [][]byte{wrappedPoint, rawPoint} {
+			publicKey, err := ecPublicKeyFromAttributes(ecParams, point)
+			require.NoError(t, err)
+			assert.True(t, privateKey.PublicKey.Equal(publicKey))
+		}
+	}
+
+	// Invalid inputs
+	ecParams, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	require.NoError(t, err)
+	_, err = ecPublicKeyFromAttributes(ecParams, []byte{0x04, 0x01, 0x02})
+	assert.Error(t, err)
+	_, err = ecPublicKeyFromAttributes([]byte{0x01}, []byte{0x04, 0x01, 0x02})
+	assert.Error(t, err)
+}
+
+func TestRSAPublicKeyFromAttributes(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKey, err := rsaPublicKeyFromAttributes(privateKey.N.Bytes(), big.NewInt(int64(privateKey.E)).Bytes())
+	require.NoError(t, err)
+	assert.True(t, privateKey.PublicKey.Equal(publicKey))
+
+	// Invalid inputs
+	for _, c := range []struct{ modulus, exponent []byte }{
+		{privateKey.N.Bytes(), nil},
+		{privateKey.N.Bytes(), []byte{1}},
+		{privateKey.N.Bytes(), []byte{1, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{nil, big.NewInt(int64(privateKey.E)).Bytes()},
+	} {
+		_, err := rsaPublicKeyFromAttributes(c.modulus, c.exponent)
+		assert.Error(t, err)
+	}
+}
+
+func TestECDSASignatureToASN1(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("message"))
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+	require.NoError(t, err)
+	raw := make([]byte, 64)
+	r.FillBytes(raw[:32])
+	s.FillBytes(raw[32:])
+
+	sig, err := ecdsaSignatureToASN1(raw)
+	require.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], sig))
+
+	// Invalid inputs
+	for _, raw := range [][]byte{nil, {1, 2, 3}} {
+		_, err := ecdsaSignatureToASN1(raw)
+		assert.Error(t, err)
+	}
+}
+
+func TestRSASHA256DigestInfoPrefix(t *testing.T) {
+	// Verify the constant against the standard library, which uses the same DigestInfo encoding.
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := rsa.SignPKCS1v15(nil, privateKey, crypto.Hash(0), append(append([]byte{}, rsaSHA256DigestInfoPrefix...), digest[:]...))
+	require.NoError(t, err)
+	err = rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, digest[:], sig)
+	assert.NoError(t, err)
+}
@@ -1,6 +1,8 @@
 package sigstore
 
 import (
+	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"os"
@@ -9,6 +11,7 @@ import (
 	"github.com/containers/image/v5/signature/signer"
 	"github.com/containers/image/v5/signature/sigstore/internal"
 	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature/kms"
 )
 
 type Option = internal.Option
@@ -45,10 +48,41 @@ func WithPrivateKeyFile(file string, passphrase []byte) Option {
 	}
 }
 
+// WithKMSKey returns an Option which signs using the key identified by keyReference in a key management service,
+// e.g. "awskms:///…", "gcpkms://…", "azurekms://…" or "hashivault://…", as accepted by cosign.
+// ctx is used when connecting to the key management service.
+//
+// The providers of the key management services are not linked in by default; the caller must register them,
+// typically by importing the relevant subpackage of github.com/sigstore/sigstore/pkg/signature/kms.
+func WithKMSKey(ctx context.Context, keyReference string) Option {
+	return func(s *internal.SigstoreSigner) error {
+		if s.PrivateKey != nil {
+			return fmt.Errorf("multiple private key sources specified when preparing to create sigstore signatures")
+		}
+
+		signerVerifier, err := kms.Get(ctx, keyReference, crypto.SHA256)
+		if err != nil {
+			return fmt.Errorf("initializing KMS key %s: %w", keyReference, err)
+		}
+		publicKey, err := signerVerifier.PublicKey()
+		if err != nil {
+			return fmt.Errorf("getting public key of KMS key %s: %w", keyReference, err)
+		}
+		publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(publicKey)
+		if err != nil {
+			return fmt.Errorf("converting public key to PEM: %w", err)
+		}
+		s.PrivateKey = signerVerifier
+		s.SigningKeyOrCert = publicKeyPEM
+		return nil
+	}
+}
+
 func NewSigner(opts ...Option) (*signer.Signer, error) {
 	s := internal.SigstoreSigner{}
 	for _, o := range opts {
 		if err := o(&s); err != nil {
+			_ = s.Close() // Release resources acquired by earlier options, if any.
 			return nil, err
 		}
 	}
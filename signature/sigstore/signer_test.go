@@ -0,0 +1,62 @@
+package sigstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/signature/kms/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithKMSKey(t *testing.T) {
+	testManifest := []byte("{}")
+	testDockerReference, err := reference.ParseNormalizedNamed("example.com/foo:notlatest")
+	require.NoError(t, err)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), fake.KmsCtxKey{}, privateKey)
+
+	signer, err := NewSigner(WithKMSKey(ctx, fake.ReferenceScheme+"test-key"))
+	require.NoError(t, err)
+	defer signer.Close()
+	sig0, err := internalSigner.SignImageManifest(context.Background(), signer, testManifest, testDockerReference)
+	require.NoError(t, err)
+	sig, ok := sig0.(signature.Sigstore)
+	require.True(t, ok)
+
+	_, err = internal.VerifySigstorePayload([]crypto.PublicKey{privateKey.Public()}, sig.UntrustedPayload(),
+		sig.UntrustedAnnotations()[signature.SigstoreSignatureAnnotationKey],
+		internal.SigstorePayloadAcceptanceRules{
+			ValidateSignedDockerReference: func(ref string) error {
+				assert.Equal(t, "example.com/foo:notlatest", ref)
+				return nil
+			},
+			ValidateSignedDockerManifestDigest: func(digest digest.Digest) error {
+				matches, err := manifest.MatchesDigest(testManifest, digest)
+				require.NoError(t, err)
+				assert.True(t, matches)
+				return nil
+			},
+		})
+	assert.NoError(t, err)
+
+	// An unknown provider
+	_, err = NewSigner(WithKMSKey(context.Background(), "unknownkms://test-key"))
+	assert.Error(t, err)
+
+	// Multiple key sources
+	_, err = NewSigner(WithKMSKey(ctx, fake.ReferenceScheme+"test-key"), WithKMSKey(ctx, fake.ReferenceScheme+"test-key"))
+	assert.Error(t, err)
+}
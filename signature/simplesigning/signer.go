@@ -18,6 +18,8 @@ type simpleSigner struct {
 	mech           signature.SigningMechanism
 	keyFingerprint string
 	passphrase     string // "" if not provided.
+	// Or nil if not provided; at most one of passphrase and passphraseCallback is set.
+	passphraseCallback func(keyDescription string) (string, error)
 }
 
 type Option func(*simpleSigner) error
@@ -38,11 +40,28 @@ func WithPassphrase(passphrase string) Option {
 		if strings.Contains(passphrase, "\n") {
 			return errors.New("invalid passphrase: must not contain a line break")
 		}
+		if s.passphraseCallback != nil {
+			return errors.New("both a passphrase and a passphrase callback specified")
+		}
 		s.passphrase = passphrase
 		return nil
 	}
 }
 
+// WithPassphraseCallback returns an Option for NewSigner, specifying a function to call to obtain the passphrase
+// for the private key, given a human-readable description of the key; this allows e.g. headless services to sign
+// without an interactive gpg-agent / pinentry.
+// The callback is called each time a signature is created, if the key requires a passphrase.
+func WithPassphraseCallback(callback func(keyDescription string) (string, error)) Option {
+	return func(s *simpleSigner) error {
+		if s.passphrase != "" {
+			return errors.New("both a passphrase and a passphrase callback specified")
+		}
+		s.passphraseCallback = callback
+		return nil
+	}
+}
+
 // NewSigner returns a signature.Signer which creates “simple signing” signatures using the user’s default
 // GPG configuration ($GNUPGHOME / ~/.gnupg).
 //
@@ -92,7 +111,8 @@ func (s *simpleSigner) SignImageManifest(ctx context.Context, m []byte, dockerRe
 		return nil, fmt.Errorf("reference %s can’t be signed, it has neither a tag nor a digest", dockerReference.String())
 	}
 	simpleSig, err := signature.SignDockerManifestWithOptions(m, dockerReference.String(), s.mech, s.keyFingerprint, &signature.SignOptions{
-		Passphrase: s.passphrase,
+		Passphrase:         s.passphrase,
+		PassphraseCallback: s.passphraseCallback,
 	})
 	if err != nil {
 		return nil, err
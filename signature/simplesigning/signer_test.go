@@ -2,6 +2,7 @@ package simplesigning
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 
@@ -157,6 +158,41 @@ func TestSimpleSignerSignImageManifest(t *testing.T) {
 			opts: []Option{WithKeyFingerprint(testKeyFingerprintWithPassphrase)},
 			ref:  testImageSignatureReference,
 		},
+		{
+			name: "Both a passphrase and a passphrase callback",
+			opts: []Option{
+				WithKeyFingerprint(testKeyFingerprintWithPassphrase),
+				WithPassphrase(testPassphrase),
+				WithPassphraseCallback(func(string) (string, error) { return testPassphrase, nil }),
+			},
+			creationFails:         true,
+			creationErrorContains: "both a passphrase and a passphrase callback",
+			ref:                   testImageSignatureReference,
+		},
+		{
+			name: "Passphrase callback fails",
+			opts: []Option{
+				WithKeyFingerprint(testKeyFingerprintWithPassphrase),
+				WithPassphraseCallback(func(string) (string, error) { return "", errors.New("no passphrase available") }),
+			},
+			ref: testImageSignatureReference,
+		},
+		{
+			name: "Wrong passphrase from a passphrase callback",
+			opts: []Option{
+				WithKeyFingerprint(testKeyFingerprintWithPassphrase),
+				WithPassphraseCallback(func(string) (string, error) { return "wrong", nil }),
+			},
+			ref: testImageSignatureReference,
+		},
+		{
+			name: "Invalid passphrase from a passphrase callback",
+			opts: []Option{
+				WithKeyFingerprint(testKeyFingerprintWithPassphrase),
+				WithPassphraseCallback(func(string) (string, error) { return testPassphrase + "\n", nil }),
+			},
+			ref: testImageSignatureReference,
+		},
 	} {
 		testFailure(c)
 	}
@@ -176,6 +212,13 @@ func TestSimpleSignerSignImageManifest(t *testing.T) {
 			fingerprint: testKeyFingerprintWithPassphrase,
 			opts:        []Option{WithPassphrase(testPassphrase)},
 		},
+		{
+			name:        "With passphrase callback",
+			fingerprint: testKeyFingerprintWithPassphrase,
+			opts: []Option{WithPassphraseCallback(func(string) (string, error) {
+				return testPassphrase, nil
+			})},
+		},
 	} {
 		s, err := NewSigner(append([]Option{WithKeyFingerprint(c.fingerprint)}, c.opts...)...)
 		require.NoError(t, err, c.name)
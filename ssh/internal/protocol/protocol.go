@@ -0,0 +1,125 @@
+// Package protocol defines the protocol used by the ssh transport to communicate with the helper on the remote host.
+//
+// The helper serves HTTP/1.1 requests on its standard input and output, for a single image specified when
+// starting the helper. Errors are reported using a non-2xx status and a text/plain body.
+package protocol
+
+import (
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// BaseURL is the URL prefix used in HTTP requests sent to the helper; the host name is never resolved.
+const BaseURL = "http://ssh-helper.invalid"
+
+// Paths of the requests supported by the helper.
+const (
+	// PathClose (POST) closes the image source and destination, if any.
+	PathClose = "/close"
+	// PathDelete (POST) deletes the image.
+	PathDelete = "/delete"
+
+	// PathSource (POST) opens an image source.
+	PathSource = "/source"
+	// PathSourceManifest (GET) returns a manifest, with its MIME type in the Content-Type header.
+	PathSourceManifest = "/source/manifest"
+	// PathSourceBlob (POST) returns a blob described by a JSON types.BlobInfo in the request body;
+	// the blob size, or -1, is in BlobSizeHeader.
+	PathSourceBlob = "/source/blob"
+	// PathSourceSignatures (GET) returns a JSON SignatureList.
+	PathSourceSignatures = "/source/signatures"
+	// PathSourceLayerInfosForCopy (GET) returns a JSON []types.BlobInfo, or null.
+	PathSourceLayerInfosForCopy = "/source/layer-infos-for-copy"
+
+	// PathDestination (POST) opens an image destination, and returns JSON DestinationProperties.
+	PathDestination = "/destination"
+	// PathDestinationBlob (POST) stores the request body as a blob, described by BlobInfoHeader and PutBlobOptionsHeader,
+	// and returns a JSON UploadedBlob.
+	PathDestinationBlob = "/destination/blob"
+	// PathDestinationReuse (POST) tries to reuse a blob described by a JSON ReuseRequest, and returns a JSON ReuseResponse.
+	PathDestinationReuse = "/destination/reuse"
+	// PathDestinationManifest (PUT) stores the request body as a manifest.
+	PathDestinationManifest = "/destination/manifest"
+	// PathDestinationSignatures (PUT) stores a JSON SignatureList.
+	PathDestinationSignatures = "/destination/signatures"
+	// PathDestinationCommit (POST) commits the image, using a JSON CommitRequest.
+	PathDestinationCommit = "/destination/commit"
+)
+
+const (
+	// InstanceParameter is the query parameter containing the instance digest, if any, for requests that accept one.
+	InstanceParameter = "instance"
+	// BlobSizeHeader contains the size of a blob in a response body, or -1 if unknown.
+	BlobSizeHeader = "X-Blob-Size"
+	// BlobInfoHeader contains a JSON types.BlobInfo describing a blob in a request body.
+	BlobInfoHeader = "X-Blob-Info"
+	// PutBlobOptionsHeader contains JSON PutBlobOptions for a blob in a request body.
+	PutBlobOptionsHeader = "X-Put-Blob-Options"
+	// ErrorCategoryHeader contains the name of an ErrorCategories entry matching an error response, if any.
+	ErrorCategoryHeader = "X-Error-Category"
+)
+
+// ErrorCategories are the types.Err* values which are preserved across the protocol, most specific first.
+var ErrorCategories = []struct {
+	Name string
+	Err  error
+}{
+	{"manifest-unknown", types.ErrManifestUnknown},
+	{"blob-unknown", types.ErrBlobUnknown},
+	{"not-found", types.ErrNotFound},
+	{"unauthorized", types.ErrUnauthorized},
+	{"denied", types.ErrDenied},
+	{"manifest-invalid", types.ErrManifestInvalid},
+	{"rate-limited", types.ErrRateLimited},
+}
+
+// DestinationProperties are the properties of an image destination on the remote host.
+type DestinationProperties struct {
+	SupportedManifestMIMETypes     []string
+	DesiredLayerCompression        types.LayerCompression
+	AcceptsForeignLayerURLs        bool
+	MustMatchRuntimeOS             bool
+	IgnoresEmbeddedDockerReference bool
+	AcceptsNonImageArtifacts       bool // Not sent by older helpers, which is safely interpreted as false.
+	// If not "", the reason why the destination does not support signatures.
+	SignaturesNotSupported string
+}
+
+// PutBlobOptions are the subset of private.PutBlobOptions forwarded to the remote host.
+type PutBlobOptions struct {
+	IsConfig   bool
+	EmptyLayer bool
+	LayerIndex *int
+}
+
+// UploadedBlob is information about a blob written to the destination.
+type UploadedBlob struct {
+	Digest digest.Digest
+	Size   int64
+}
+
+// ReuseRequest is a request to reuse a blob in the destination.
+type ReuseRequest struct {
+	Info       types.BlobInfo
+	EmptyLayer bool
+	LayerIndex *int
+}
+
+// ReuseResponse is the result of a ReuseRequest.
+type ReuseResponse struct {
+	Reused bool
+	Digest digest.Digest
+	Size   int64
+}
+
+// SignatureList is a list of signatures, each in the format of internal/signature.Blob.
+type SignatureList struct {
+	Signatures [][]byte
+}
+
+// CommitRequest is a request to commit the destination.
+type CommitRequest struct {
+	// The top-level manifest of the source image, and its MIME type, if known.
+	ToplevelManifest         []byte
+	ToplevelManifestMIMEType string
+}
@@ -0,0 +1,574 @@
+// Package server implements the helper which the ssh transport runs on a remote host.
+//
+// The ssh transport runs (ssh host helper-command image-name); the helper command can be any program
+// which calls Serve with the image name and its standard input and output.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/pkg/blobinfocache"
+	"github.com/containers/image/v5/ssh/internal/protocol"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// server serves a single image to a single client.
+type server struct {
+	sys    *types.SystemContext
+	ref    types.ImageReference // nil if refErr != nil
+	refErr error
+	cache  types.BlobInfoCache
+
+	mutex sync.Mutex // Protects the fields below, and serializes all requests.
+	src   private.ImageSource
+	dest  private.ImageDestination
+}
+
+// Serve serves imageName, in the format of alltransports.ParseImageName, to an ssh transport client
+// connected to in and out (typically the standard input and output of the helper process), until the client
+// disconnects or ctx is canceled.
+// The image source and destination are created using sys, which is not affected by the client.
+func Serve(ctx context.Context, sys *types.SystemContext, imageName string, in io.Reader, out io.Writer) error {
+	s := &server{
+		sys:   sys,
+		cache: blobinfocache.DefaultCache(sys),
+	}
+	// Report an invalid image name in responses to the client instead of failing here, where
+	// the client would only see a closed connection.
+	s.ref, s.refErr = alltransports.ParseImageName(imageName)
+	defer s.closeImages()
+
+	l := newSingleConnListener(&streamConn{in: in, out: out})
+	srv := &http.Server{
+		Handler: s.handler(),
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				l.Close()
+			}
+		},
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	stop := context.AfterFunc(ctx, func() {
+		srv.Close()
+	})
+	defer stop()
+	err := srv.Serve(l)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// closeImages closes the image source and destination, if any.
+func (s *server) closeImages() error {
+	var err error
+	if s.src != nil {
+		err = s.src.Close()
+		s.src = nil
+	}
+	if s.dest != nil {
+		if destErr := s.dest.Close(); destErr != nil && err == nil {
+			err = destErr
+		}
+		s.dest = nil
+	}
+	return err
+}
+
+// handler returns a http.Handler for the requests defined in protocol.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	s.handle(mux, http.MethodPost, protocol.PathClose, s.handleClose)
+	s.handle(mux, http.MethodPost, protocol.PathDelete, s.handleDelete)
+	s.handle(mux, http.MethodPost, protocol.PathSource, s.handleSource)
+	s.handle(mux, http.MethodGet, protocol.PathSourceManifest, s.handleSourceManifest)
+	s.handle(mux, http.MethodPost, protocol.PathSourceBlob, s.handleSourceBlob)
+	s.handle(mux, http.MethodGet, protocol.PathSourceSignatures, s.handleSourceSignatures)
+	s.handle(mux, http.MethodGet, protocol.PathSourceLayerInfosForCopy, s.handleSourceLayerInfosForCopy)
+	s.handle(mux, http.MethodPost, protocol.PathDestination, s.handleDestination)
+	s.handle(mux, http.MethodPost, protocol.PathDestinationBlob, s.handleDestinationBlob)
+	s.handle(mux, http.MethodPost, protocol.PathDestinationReuse, s.handleDestinationReuse)
+	s.handle(mux, http.MethodPut, protocol.PathDestinationManifest, s.handleDestinationManifest)
+	s.handle(mux, http.MethodPut, protocol.PathDestinationSignatures, s.handleDestinationSignatures)
+	s.handle(mux, http.MethodPost, protocol.PathDestinationCommit, s.handleDestinationCommit)
+	return mux
+}
+
+// handle registers handler for method and path in mux, and reports errors returned by handler to the client.
+func (s *server) handle(mux *http.ServeMux, method, path string, handler func(w http.ResponseWriter, r *http.Request) error) {
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, fmt.Sprintf("method %s not allowed for %s", r.Method, path), http.StatusMethodNotAllowed)
+			return
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if err := handler(w, r); err != nil {
+			logrus.Debugf("ssh helper: %s %s: %v", method, path, err)
+			status := http.StatusInternalServerError
+			var rejected types.ManifestTypeRejectedError
+			if errors.As(err, &rejected) {
+				status = http.StatusUnsupportedMediaType
+			}
+			for _, c := range protocol.ErrorCategories {
+				if errors.Is(err, c.Err) {
+					w.Header().Set(protocol.ErrorCategoryHeader, c.Name)
+					break
+				}
+			}
+			http.Error(w, err.Error(), status)
+		}
+	})
+}
+
+// reference returns the served image reference.
+func (s *server) reference() (types.ImageReference, error) {
+	if s.refErr != nil {
+		return nil, s.refErr
+	}
+	return s.ref, nil
+}
+
+// instanceDigest returns the instance digest specified in r, if any.
+func instanceDigest(r *http.Request) (*digest.Digest, error) {
+	value := r.URL.Query().Get(protocol.InstanceParameter)
+	if value == "" {
+		return nil, nil
+	}
+	d, err := digest.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// readJSON decodes a JSON value from data, typically the value of a header.
+func readJSON(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding request: %w", err)
+	}
+	return nil
+}
+
+// readJSONBody decodes a JSON request body into v.
+func (s *server) readJSONBody(r *http.Request, v any) error {
+	data, err := iolimits.ReadAtMost(r.Body, iolimits.MaxSignatureListBodySizeFor(s.sys)) // The largest requests contain signature lists.
+	if err != nil {
+		return err
+	}
+	return readJSON(data, v)
+}
+
+// writeJSON sends v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+func (s *server) handleClose(w http.ResponseWriter, r *http.Request) error {
+	return s.closeImages()
+}
+
+func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) error {
+	ref, err := s.reference()
+	if err != nil {
+		return err
+	}
+	return ref.DeleteImage(r.Context(), s.sys)
+}
+
+func (s *server) handleSource(w http.ResponseWriter, r *http.Request) error {
+	ref, err := s.reference()
+	if err != nil {
+		return err
+	}
+	if s.src != nil {
+		return errors.New("an image source is already open")
+	}
+	src, err := ref.NewImageSource(r.Context(), s.sys)
+	if err != nil {
+		return err
+	}
+	s.src = imagesource.FromPublic(src)
+	return nil
+}
+
+// source returns the open image source.
+func (s *server) source() (private.ImageSource, error) {
+	if s.src == nil {
+		return nil, errors.New("no image source is open")
+	}
+	return s.src, nil
+}
+
+func (s *server) handleSourceManifest(w http.ResponseWriter, r *http.Request) error {
+	src, err := s.source()
+	if err != nil {
+		return err
+	}
+	instance, err := instanceDigest(r)
+	if err != nil {
+		return err
+	}
+	m, mimeType, err := src.GetManifest(r.Context(), instance)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", mimeType)
+	_, err = w.Write(m)
+	return err
+}
+
+func (s *server) handleSourceBlob(w http.ResponseWriter, r *http.Request) error {
+	src, err := s.source()
+	if err != nil {
+		return err
+	}
+	var info types.BlobInfo
+	if err := s.readJSONBody(r, &info); err != nil {
+		return err
+	}
+	stream, size, err := src.GetBlob(r.Context(), info, s.cache)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	w.Header().Set(protocol.BlobSizeHeader, strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := io.Copy(w, stream); err != nil {
+		// The response has already started, so the only way to report the failure is to abort it.
+		logrus.Debugf("ssh helper: reading blob %s: %v", info.Digest, err)
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+func (s *server) handleSourceSignatures(w http.ResponseWriter, r *http.Request) error {
+	src, err := s.source()
+	if err != nil {
+		return err
+	}
+	instance, err := instanceDigest(r)
+	if err != nil {
+		return err
+	}
+	sigs, err := src.GetSignaturesWithFormat(r.Context(), instance)
+	if err != nil {
+		return err
+	}
+	list := protocol.SignatureList{Signatures: [][]byte{}}
+	for _, sig := range sigs {
+		blob, err := signature.Blob(sig)
+		if err != nil {
+			return err
+		}
+		list.Signatures = append(list.Signatures, blob)
+	}
+	return writeJSON(w, list)
+}
+
+func (s *server) handleSourceLayerInfosForCopy(w http.ResponseWriter, r *http.Request) error {
+	src, err := s.source()
+	if err != nil {
+		return err
+	}
+	instance, err := instanceDigest(r)
+	if err != nil {
+		return err
+	}
+	infos, err := src.LayerInfosForCopy(r.Context(), instance)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, infos)
+}
+
+func (s *server) handleDestination(w http.ResponseWriter, r *http.Request) error {
+	ref, err := s.reference()
+	if err != nil {
+		return err
+	}
+	if s.dest != nil {
+		return errors.New("an image destination is already open")
+	}
+	dest, err := ref.NewImageDestination(r.Context(), s.sys)
+	if err != nil {
+		return err
+	}
+	s.dest = imagedestination.FromPublic(dest)
+	props := protocol.DestinationProperties{
+		SupportedManifestMIMETypes:     s.dest.SupportedManifestMIMETypes(),
+		DesiredLayerCompression:        s.dest.DesiredLayerCompression(),
+		AcceptsForeignLayerURLs:        s.dest.AcceptsForeignLayerURLs(),
+		MustMatchRuntimeOS:             s.dest.MustMatchRuntimeOS(),
+		IgnoresEmbeddedDockerReference: s.dest.IgnoresEmbeddedDockerReference(),
+		AcceptsNonImageArtifacts:       s.dest.AcceptsNonImageArtifacts(),
+	}
+	if err := s.dest.SupportsSignatures(r.Context()); err != nil {
+		props.SignaturesNotSupported = err.Error()
+	}
+	return writeJSON(w, props)
+}
+
+// destination returns the open image destination.
+func (s *server) destination() (private.ImageDestination, error) {
+	if s.dest == nil {
+		return nil, errors.New("no image destination is open")
+	}
+	return s.dest, nil
+}
+
+func (s *server) handleDestinationBlob(w http.ResponseWriter, r *http.Request) error {
+	dest, err := s.destination()
+	if err != nil {
+		return err
+	}
+	var info types.BlobInfo
+	if err := readJSON([]byte(r.Header.Get(protocol.BlobInfoHeader)), &info); err != nil {
+		return err
+	}
+	var options protocol.PutBlobOptions
+	if err := readJSON([]byte(r.Header.Get(protocol.PutBlobOptionsHeader)), &options); err != nil {
+		return err
+	}
+	uploaded, err := dest.PutBlobWithOptions(r.Context(), r.Body, info, private.PutBlobOptions{
+		Cache:      internalblobinfocache.FromBlobInfoCache(s.cache),
+		IsConfig:   options.IsConfig,
+		EmptyLayer: options.EmptyLayer,
+		LayerIndex: options.LayerIndex,
+	})
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, protocol.UploadedBlob{Digest: uploaded.Digest, Size: uploaded.Size})
+}
+
+func (s *server) handleDestinationReuse(w http.ResponseWriter, r *http.Request) error {
+	dest, err := s.destination()
+	if err != nil {
+		return err
+	}
+	var req protocol.ReuseRequest
+	if err := s.readJSONBody(r, &req); err != nil {
+		return err
+	}
+	reused, blob, err := dest.TryReusingBlobWithOptions(r.Context(), req.Info, private.TryReusingBlobOptions{
+		Cache:         internalblobinfocache.FromBlobInfoCache(s.cache),
+		CanSubstitute: false,
+		EmptyLayer:    req.EmptyLayer,
+		LayerIndex:    req.LayerIndex,
+	})
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, protocol.ReuseResponse{Reused: reused, Digest: blob.Digest, Size: blob.Size})
+}
+
+func (s *server) handleDestinationManifest(w http.ResponseWriter, r *http.Request) error {
+	dest, err := s.destination()
+	if err != nil {
+		return err
+	}
+	instance, err := instanceDigest(r)
+	if err != nil {
+		return err
+	}
+	m, err := iolimits.ReadAtMost(r.Body, iolimits.MaxManifestBodySizeFor(s.sys))
+	if err != nil {
+		return err
+	}
+	return dest.PutManifest(r.Context(), m, instance)
+}
+
+func (s *server) handleDestinationSignatures(w http.ResponseWriter, r *http.Request) error {
+	dest, err := s.destination()
+	if err != nil {
+		return err
+	}
+	instance, err := instanceDigest(r)
+	if err != nil {
+		return err
+	}
+	var list protocol.SignatureList
+	if err := s.readJSONBody(r, &list); err != nil {
+		return err
+	}
+	sigs := []signature.Signature{}
+	for _, blob := range list.Signatures {
+		sig, err := signature.FromBlob(blob)
+		if err != nil {
+			return err
+		}
+		sigs = append(sigs, sig)
+	}
+	return dest.PutSignaturesWithFormat(r.Context(), sigs, instance)
+}
+
+func (s *server) handleDestinationCommit(w http.ResponseWriter, r *http.Request) error {
+	dest, err := s.destination()
+	if err != nil {
+		return err
+	}
+	var req protocol.CommitRequest
+	if err := s.readJSONBody(r, &req); err != nil {
+		return err
+	}
+	var unparsedToplevel types.UnparsedImage
+	if req.ToplevelManifest != nil {
+		unparsedToplevel = &toplevelImage{
+			ref:      s.ref,
+			manifest: req.ToplevelManifest,
+			mimeType: req.ToplevelManifestMIMEType,
+		}
+	}
+	return dest.Commit(r.Context(), unparsedToplevel)
+}
+
+// toplevelImage is a types.UnparsedImage for the top-level manifest of an image being copied by the client.
+type toplevelImage struct {
+	ref      types.ImageReference
+	manifest []byte
+	mimeType string
+}
+
+// Reference returns the reference used to set up this source, _as specified by the user_
+// (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
+func (i *toplevelImage) Reference() types.ImageReference {
+	return i.ref
+}
+
+// Manifest is like ImageSource.GetManifest, but the result is cached; it is OK to call this however often you need.
+func (i *toplevelImage) Manifest(ctx context.Context) ([]byte, string, error) {
+	return i.manifest, i.mimeType, nil
+}
+
+// Signatures is like ImageSource.GetSignatures, but the result is cached; it is OK to call this however often you need.
+func (i *toplevelImage) Signatures(ctx context.Context) ([][]byte, error) {
+	return nil, nil // The client does not send signatures of the source image.
+}
+
+// streamConn is a net.Conn which reads from in and writes to out.
+type streamConn struct {
+	in  io.Reader
+	out io.Writer
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+func (c *streamConn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
+
+// Close closes in and out, if they support it.
+func (c *streamConn) Close() error {
+	var err error
+	if closer, ok := c.in.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if closer, ok := c.out.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return streamAddr{}
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return streamAddr{}
+}
+
+// SetDeadline, SetReadDeadline and SetWriteDeadline are not supported, and only exist to implement net.Conn.
+func (c *streamConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// streamAddr is a net.Addr of a streamConn.
+type streamAddr struct{}
+
+func (streamAddr) Network() string {
+	return "stream"
+}
+
+func (streamAddr) String() string {
+	return "stream"
+}
+
+// singleConnListener is a net.Listener which returns a single connection.
+type singleConnListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newSingleConnListener returns a net.Listener which returns conn from the first Accept call, and blocks further
+// Accept calls until the listener is closed.
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	l := &singleConnListener{
+		conns:  make(chan net.Conn, 1),
+		closed: make(chan struct{}),
+	}
+	l.conns <- conn
+	return l
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return streamAddr{}
+}
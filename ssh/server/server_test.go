@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/ssh"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helperEnvVar, if set, makes the test binary act as the helper on the "remote" host.
+const helperEnvVar = "CONTAINERS_IMAGE_SSH_TEST_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnvVar) != "" {
+		if err := Serve(context.Background(), nil, os.Args[1], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testSystemContext returns a types.SystemContext which makes the ssh transport run this test binary
+// as the helper, on the local host, instead of using ssh(1).
+func testSystemContext(t *testing.T) *types.SystemContext {
+	// The fake ssh(1) ignores all options and the host name, and runs the remote command using a shell, like sshd(8) would.
+	fakeSSH := filepath.Join(t.TempDir(), "ssh")
+	err := os.WriteFile(fakeSSH, []byte("#!/bin/sh\n"+
+		"while [ \"$1\" != \"--\" ]; do shift; done\n"+
+		"shift 2\n"+
+		"exec sh -c \"$*\"\n"), 0755)
+	require.NoError(t, err)
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	return &types.SystemContext{
+		SSHCommand:       fakeSSH,
+		SSHHelperCommand: helperEnvVar + "=1 '" + strings.ReplaceAll(executable, "'", `'\''`) + "'",
+	}
+}
+
+func TestCopyOverSSH(t *testing.T) {
+	ctx := context.Background()
+	sys := testSystemContext(t)
+	dir := filepath.Join(t.TempDir(), "it's an image") // Verify that the image name is correctly quoted.
+	ref, err := ssh.NewReference("user@example.com:2222", "dir:"+dir)
+	require.NoError(t, err)
+	cache := memory.New()
+
+	publicDest, err := ref.NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer publicDest.Close()
+	dest := imagedestination.FromPublic(publicDest)
+	assert.NoError(t, dest.SupportsSignatures(ctx))
+	assert.Equal(t, types.PreserveOriginal, dest.DesiredLayerCompression())
+
+	layer := []byte("layer contents")
+	layerInfo, err := dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(layer), layerInfo.Digest)
+	assert.Equal(t, int64(len(layer)), layerInfo.Size)
+	reused, reusedInfo, err := dest.TryReusingBlob(ctx, types.BlobInfo{Digest: layerInfo.Digest, Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, layerInfo.Digest, reusedInfo.Digest)
+	reused, _, err = dest.TryReusingBlob(ctx, types.BlobInfo{Digest: digest.FromString("missing"), Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	configInfo, err := dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Size: int64(len(config))}, cache, true)
+	require.NoError(t, err)
+	m := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":%q,"digest":%q,"size":%d},"layers":[{"mediaType":%q,"digest":%q,"size":%d}]}`,
+		imgspecv1.MediaTypeImageManifest,
+		imgspecv1.MediaTypeImageConfig, configInfo.Digest, configInfo.Size,
+		imgspecv1.MediaTypeImageLayer, layerInfo.Digest, layerInfo.Size)
+	err = dest.PutManifest(ctx, []byte(m), nil)
+	require.NoError(t, err)
+	sig := signature.SimpleSigningFromBlob([]byte{0xA3, 0x01, 0x02}) // Looks like an OpenPGP message, so that signature.FromBlob recognizes it
+	err = dest.PutSignaturesWithFormat(ctx, []signature.Signature{sig}, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, dest.Close())
+
+	// The image was written by the helper.
+	localManifest, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, m, string(localManifest))
+
+	publicSrc, err := ref.NewImageSource(ctx, sys)
+	require.NoError(t, err)
+	defer publicSrc.Close()
+	src := imagesource.FromPublic(publicSrc)
+	m2, mimeType, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, m, string(m2))
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+
+	// Closing a blob stream before reading all of it does not break the connection.
+	stream, size, err := src.GetBlob(ctx, layerInfo, cache)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(layer)), size)
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(stream, buf)
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+
+	stream, _, err = src.GetBlob(ctx, configInfo, cache)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	assert.Equal(t, config, contents)
+
+	_, _, err = src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromString("missing"), Size: -1}, cache)
+	assert.Error(t, err)
+
+	sigs, err := src.GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	sigBlob, err := signature.Blob(sigs[0])
+	require.NoError(t, err)
+	expectedBlob, err := signature.Blob(sig)
+	require.NoError(t, err)
+	assert.Equal(t, expectedBlob, sigBlob)
+
+	infos, err := src.LayerInfosForCopy(ctx, nil)
+	require.NoError(t, err)
+	assert.Nil(t, infos)
+	require.NoError(t, src.Close())
+}
+
+func TestRemoteErrors(t *testing.T) {
+	ctx := context.Background()
+	sys := testSystemContext(t)
+
+	// The remote image does not exist.
+	ref, err := ssh.NewReference("example.com", "dir:"+filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(ctx, sys)
+	require.NoError(t, err) // The dir transport only notices a missing directory when reading data.
+	defer src.Close()
+	_, _, err = src.GetManifest(ctx, nil)
+	assert.ErrorContains(t, err, "missing")
+	assert.ErrorIs(t, err, types.ErrManifestUnknown)
+
+	// The remote image name is invalid.
+	ref, err = ssh.NewReference("example.com", "unknown-transport:foo")
+	require.NoError(t, err)
+	_, err = ref.NewImageDestination(ctx, sys)
+	assert.ErrorContains(t, err, "unknown transport")
+
+	// The helper can not be started.
+	ref, err = ssh.NewReference("example.com", "dir:"+t.TempDir())
+	require.NoError(t, err)
+	sys.SSHHelperCommand = "/this/does/not/exist"
+	_, err = ref.NewImageSource(ctx, sys)
+	assert.Error(t, err)
+}
@@ -0,0 +1,210 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/internal/commandconn"
+	"github.com/containers/image/v5/internal/errcategory"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/timeouts"
+	"github.com/containers/image/v5/ssh/internal/protocol"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// client is a connection to the helper on the remote host.
+type client struct {
+	conn       net.Conn
+	httpClient *http.Client
+	// The maximum size of a JSON response from the helper; the largest ones contain signature lists.
+	maxJSONResponseSize int
+}
+
+// newClient starts the helper on ref’s host, serving ref.imageName.
+// The caller must call .close() on the returned client.
+func newClient(ctx context.Context, sys *types.SystemContext, ref sshReference) (*client, error) {
+	sshCommand := "ssh"
+	helperCommand := DefaultHelperCommand
+	if sys != nil {
+		if sys.SSHCommand != "" {
+			sshCommand = sys.SSHCommand
+		}
+		if sys.SSHHelperCommand != "" {
+			helperCommand = sys.SSHHelperCommand
+		}
+	}
+	args := sshCommandArgs(ref, helperCommand)
+	if sys != nil && sys.ConnectTimeout > 0 {
+		// ssh(1) only accepts whole seconds.
+		seconds := int64(math.Ceil(sys.ConnectTimeout.Seconds()))
+		args = append([]string{"-o", fmt.Sprintf("ConnectTimeout=%d", seconds)}, args...)
+	}
+	logrus.Debugf("ssh: connecting using %s %v", sshCommand, args)
+	conn, err := commandconn.New(ctx, sshCommand, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The helper keeps state for the duration of a single connection, so never connect more than once.
+	var dialMutex sync.Mutex
+	dialed := false
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialMutex.Lock()
+			defer dialMutex.Unlock()
+			if dialed {
+				return nil, fmt.Errorf("ssh: connection to %s was lost", ref.host)
+			}
+			dialed = true
+			return conn, nil
+		},
+		MaxConnsPerHost:    1,
+		DisableCompression: true,
+	}
+	return &client{
+		conn:                conn,
+		httpClient:          &http.Client{Transport: timeouts.NewRoundTripper(transport, sys)},
+		maxJSONResponseSize: iolimits.MaxSignatureListBodySizeFor(sys),
+	}, nil
+}
+
+// sshCommandArgs returns the arguments of an ssh(1) invocation which runs helperCommand for ref on the remote host.
+func sshCommandArgs(ref sshReference, helperCommand string) []string {
+	args := []string{}
+	if ref.user != "" {
+		args = append(args, "-l", ref.user)
+	}
+	u := url.URL{Host: ref.host}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	// "--" ensures that a host name starting with "-" is not interpreted as an option.
+	// ssh(1) passes the command to a shell on the remote host, so the image name must be quoted.
+	return append(args, "--", u.Hostname(), helperCommand, shellQuote(ref.imageName))
+}
+
+// shellQuote returns s quoted for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// close asks the helper to release its resources, and terminates the connection.
+func (c *client) close(ctx context.Context) error {
+	err := c.doJSON(ctx, http.MethodPost, protocol.PathClose, nil, nil, nil)
+	c.httpClient.CloseIdleConnections() // This typically closes c.conn already.
+	if closeErr := c.conn.Close(); closeErr != nil && !errors.Is(closeErr, os.ErrClosed) && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// instanceQuery returns query parameters for instanceDigest, or nil if instanceDigest is nil.
+func instanceQuery(instanceDigest *digest.Digest) url.Values {
+	if instanceDigest == nil {
+		return nil
+	}
+	return url.Values{protocol.InstanceParameter: {instanceDigest.String()}}
+}
+
+// do sends a request to the helper, and returns the response if it was successful.
+// The caller must close the response body.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, header http.Header, body io.Reader) (*http.Response, error) {
+	u := protocol.BaseURL + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: %s %s: %w", method, path, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		msg, err := iolimits.ReadAtMost(res.Body, iolimits.MaxErrorBodySize)
+		if err != nil {
+			msg = []byte(res.Status)
+		}
+		err = fmt.Errorf("ssh: remote host: %s", strings.TrimSpace(string(msg)))
+		if name := res.Header.Get(protocol.ErrorCategoryHeader); name != "" {
+			for _, c := range protocol.ErrorCategories {
+				if c.Name == name {
+					err = errcategory.Wrap(err, c.Err)
+					break
+				}
+			}
+		}
+		if res.StatusCode == http.StatusUnsupportedMediaType {
+			return nil, types.ManifestTypeRejectedError{Err: err}
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// doJSON sends a request with a JSON-encoded input (if not nil) to the helper, and decodes a JSON response into output (if not nil).
+func (c *client) doJSON(ctx context.Context, method, path string, query url.Values, input, output any) error {
+	var body io.Reader
+	var header http.Header
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		header = http.Header{"Content-Type": {"application/json"}}
+	}
+	res, err := c.do(ctx, method, path, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if output == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+	data, err := iolimits.ReadAtMost(res.Body, c.maxJSONResponseSize)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, output); err != nil {
+		return fmt.Errorf("ssh: decoding response to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// drainingReadCloser is an io.ReadCloser which reads the rest of a response body before closing it, so that
+// the connection to the helper can be used for further requests.
+type drainingReadCloser struct {
+	body io.ReadCloser
+}
+
+func (r drainingReadCloser) Read(p []byte) (int, error) {
+	return r.body.Read(p)
+}
+
+func (r drainingReadCloser) Close() error {
+	_, err := io.Copy(io.Discard, r.body)
+	if closeErr := r.body.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHCommandArgs(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected []string
+	}{
+		{"//example.com/dir:/path", []string{"--", "example.com", "helper", "'dir:/path'"}},
+		{"//user@example.com:2222/dir:/path", []string{"-l", "user", "-p", "2222", "--", "example.com", "helper", "'dir:/path'"}},
+		{"//[::1]/dir:/it's $HOME", []string{"--", "::1", "helper", `'dir:/it'\''s $HOME'`}},
+	} {
+		ref, err := ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, sshCommandArgs(ref.(sshReference), "helper"), c.input)
+	}
+}
@@ -0,0 +1,199 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/ssh/internal/protocol"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+type sshImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+
+	ref                    sshReference
+	client                 *client
+	signaturesNotSupported string // If not "", the reason why the remote destination does not support signatures
+}
+
+// newImageDestination returns an ImageDestination for writing an image on a remote host.
+// The caller must call .Close() on the returned ImageDestination.
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref sshReference) (private.ImageDestination, error) {
+	c, err := newClient(ctx, sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	var props protocol.DestinationProperties
+	if err := c.doJSON(ctx, http.MethodPost, protocol.PathDestination, nil, nil, &props); err != nil {
+		c.close(ctx)
+		return nil, err
+	}
+
+	d := &sshImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes:     props.SupportedManifestMIMETypes,
+			DesiredLayerCompression:        props.DesiredLayerCompression,
+			AcceptsForeignLayerURLs:        props.AcceptsForeignLayerURLs,
+			MustMatchRuntimeOS:             props.MustMatchRuntimeOS,
+			IgnoresEmbeddedDockerReference: props.IgnoresEmbeddedDockerReference,
+			HasThreadSafePutBlob:           false, // All requests are serialized on a single connection.
+			AcceptsNonImageArtifacts:       props.AcceptsNonImageArtifacts,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+
+		ref:                    ref,
+		client:                 c,
+		signaturesNotSupported: props.SignaturesNotSupported,
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *sshImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *sshImageDestination) Close() error {
+	return d.client.close(context.Background())
+}
+
+// SupportsSignatures returns an error (to be displayed to the user) if the destination certainly can't store signatures.
+// Note: It is still possible for PutSignatures to fail if SupportsSignatures returns nil.
+func (d *sshImageDestination) SupportsSignatures(ctx context.Context) error {
+	if d.signaturesNotSupported != "" {
+		return errors.New(d.signaturesNotSupported)
+	}
+	return nil
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *sshImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	infoJSON, err := json.Marshal(inputInfo)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	optionsJSON, err := json.Marshal(protocol.PutBlobOptions{
+		IsConfig:   options.IsConfig,
+		EmptyLayer: options.EmptyLayer,
+		LayerIndex: options.LayerIndex,
+	})
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	// If reading stream fails, the request is aborted, and the remote destination sees a truncated body and fails.
+	res, err := d.client.do(ctx, http.MethodPost, protocol.PathDestinationBlob, nil, http.Header{
+		protocol.BlobInfoHeader:       {string(infoJSON)},
+		protocol.PutBlobOptionsHeader: {string(optionsJSON)},
+	}, stream)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	defer res.Body.Close()
+	var uploaded protocol.UploadedBlob
+	if err := json.NewDecoder(io.LimitReader(res.Body, int64(d.client.maxJSONResponseSize))).Decode(&uploaded); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	return private.UploadedBlob{Digest: uploaded.Digest, Size: uploaded.Size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *sshImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalCandidateMatchesTryReusingBlobOptions(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	// Only the blob itself can be reused; substitutes known to the remote destination could require
+	// compression changes which can not be reported back reliably.
+	var res protocol.ReuseResponse
+	if err := d.client.doJSON(ctx, http.MethodPost, protocol.PathDestinationReuse, nil, protocol.ReuseRequest{
+		Info:       info,
+		EmptyLayer: options.EmptyLayer,
+		LayerIndex: options.LayerIndex,
+	}, &res); err != nil {
+		return false, private.ReusedBlob{}, err
+	}
+	if !res.Reused {
+		return false, private.ReusedBlob{}, nil
+	}
+	return true, private.ReusedBlob{Digest: res.Digest, Size: res.Size}, nil
+}
+
+// PutManifest writes manifest to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write the manifest for (when
+// the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *sshImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	res, err := d.client.do(ctx, http.MethodPut, protocol.PathDestinationManifest, instanceQuery(instanceDigest), nil, bytes.NewReader(m))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(io.Discard, res.Body)
+	return err
+}
+
+// PutSignaturesWithFormat writes a set of signatures to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write or overwrite the signatures for
+// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// MUST be called after PutManifest (signatures may reference manifest contents).
+func (d *sshImageDestination) PutSignaturesWithFormat(ctx context.Context, signatures []signature.Signature, instanceDigest *digest.Digest) error {
+	list := protocol.SignatureList{Signatures: [][]byte{}}
+	for _, sig := range signatures {
+		blob, err := signature.Blob(sig)
+		if err != nil {
+			return err
+		}
+		list.Signatures = append(list.Signatures, blob)
+	}
+	return d.client.doJSON(ctx, http.MethodPut, protocol.PathDestinationSignatures, instanceQuery(instanceDigest), list, nil)
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *sshImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	req := protocol.CommitRequest{}
+	if unparsedToplevel != nil {
+		m, mimeType, err := unparsedToplevel.Manifest(ctx)
+		if err != nil {
+			return err
+		}
+		req.ToplevelManifest = m
+		req.ToplevelManifestMIMEType = mimeType
+	}
+	return d.client.doJSON(ctx, http.MethodPost, protocol.PathDestinationCommit, nil, req, nil)
+}
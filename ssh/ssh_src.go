@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/ssh/internal/protocol"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+type sshImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoGetBlobAtInitialize
+
+	ref             sshReference
+	client          *client
+	maxManifestSize int
+}
+
+// newImageSource returns an ImageSource reading from an image on a remote host.
+// The caller must call .Close() on the returned ImageSource.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref sshReference) (private.ImageSource, error) {
+	c, err := newClient(ctx, sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.doJSON(ctx, http.MethodPost, protocol.PathSource, nil, nil, nil); err != nil {
+		c.close(ctx)
+		return nil, err
+	}
+
+	s := &sshImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: false,
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
+
+		ref:             ref,
+		client:          c,
+		maxManifestSize: iolimits.MaxManifestBodySizeFor(sys),
+	}
+	s.Compat = impl.AddCompat(s)
+	return s, nil
+}
+
+// Reference returns the reference used to set up this source, _as specified by the user_
+// (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
+func (s *sshImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *sshImageSource) Close() error {
+	return s.client.close(context.Background())
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *sshImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	res, err := s.client.do(ctx, http.MethodGet, protocol.PathSourceManifest, instanceQuery(instanceDigest), nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	m, err := iolimits.ReadAtMost(res.Body, s.maxManifestSize)
+	if err != nil {
+		return nil, "", err
+	}
+	return m, res.Header.Get("Content-Type"), nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *sshImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, -1, err
+	}
+	res, err := s.client.do(ctx, http.MethodPost, protocol.PathSourceBlob, nil, http.Header{"Content-Type": {"application/json"}}, bytes.NewReader(data))
+	if err != nil {
+		return nil, -1, err
+	}
+	size, err := strconv.ParseInt(res.Header.Get(protocol.BlobSizeHeader), 10, 64)
+	if err != nil || size < -1 {
+		size = -1
+	}
+	return drainingReadCloser{body: res.Body}, size, nil
+}
+
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *sshImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	var list protocol.SignatureList
+	if err := s.client.doJSON(ctx, http.MethodGet, protocol.PathSourceSignatures, instanceQuery(instanceDigest), nil, &list); err != nil {
+		return nil, err
+	}
+	res := []signature.Signature{}
+	for _, blob := range list.Signatures {
+		sig, err := signature.FromBlob(blob)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sig)
+	}
+	return res, nil
+}
+
+// LayerInfosForCopy returns either nil (meaning the values in the manifest are fine), or updated values for the layer
+// blobsums that are listed in the image's manifest.  If values are returned, they should be used when using GetBlob()
+// to read the image's layers.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve BlobInfos for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+// The Digest field is guaranteed to be provided; Size may be -1.
+// WARNING: The list may contain duplicates, and they are semantically relevant.
+func (s *sshImageSource) LayerInfosForCopy(ctx context.Context, instanceDigest *digest.Digest) ([]types.BlobInfo, error) {
+	var res []types.BlobInfo
+	if err := s.client.doJSON(ctx, http.MethodGet, protocol.PathSourceLayerInfosForCopy, instanceQuery(instanceDigest), nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
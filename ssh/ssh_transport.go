@@ -0,0 +1,188 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/ssh/internal/protocol"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+func init() {
+	transports.Register(Transport)
+}
+
+// Transport is an ImageTransport for images accessed on a remote host over SSH.
+var Transport = sshTransport{}
+
+type sshTransport struct{}
+
+// DefaultHelperCommand is the command run on the remote host to serve images, if types.SystemContext.SSHHelperCommand is not set.
+// The command must serve the image using github.com/containers/image/v5/ssh/server.Serve;
+// github.com/containers/image/v5/cmd/containers-image-ssh-helper is such a command.
+const DefaultHelperCommand = "containers-image-ssh-helper"
+
+func (t sshTransport) Name() string {
+	return "ssh"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t sshTransport) ParseReference(reference string) (types.ImageReference, error) {
+	return ParseReference(reference)
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t sshTransport) ValidatePolicyConfigurationScope(scope string) error {
+	host, _, _ := strings.Cut(scope, "/")
+	if _, _, err := parseHost(host); err != nil {
+		return fmt.Errorf("Invalid scope %s: %w", scope, err)
+	}
+	return nil
+}
+
+// sshReference is an ImageReference for images accessed on a remote host over SSH.
+type sshReference struct {
+	user      string // "" if not specified
+	host      string // host[:port]
+	imageName string // The image name on the remote host, in the transport:reference format
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ssh ImageReference.
+// The expected format is //[user@]host[:port]/transport:reference.
+func ParseReference(refString string) (types.ImageReference, error) {
+	rest, ok := strings.CutPrefix(refString, "//")
+	if !ok {
+		return nil, fmt.Errorf("ssh: reference %q does not start with //", refString)
+	}
+	host, imageName, ok := strings.Cut(rest, "/")
+	if !ok {
+		return nil, fmt.Errorf("ssh: reference %q does not contain a remote image name", refString)
+	}
+	return NewReference(host, imageName)
+}
+
+// NewReference returns an ssh reference for imageName, in the transport:reference format, on host, in the [user@]host[:port] format.
+// imageName is not validated locally, it is interpreted on the remote host.
+func NewReference(host, imageName string) (types.ImageReference, error) {
+	user, host, err := parseHost(host)
+	if err != nil {
+		return nil, err
+	}
+	transportName, _, ok := strings.Cut(imageName, ":")
+	if !ok || transportName == "" {
+		return nil, fmt.Errorf("ssh: invalid remote image name %q, expected colon-separated transport:reference", imageName)
+	}
+	return sshReference{user: user, host: host, imageName: imageName}, nil
+}
+
+// parseHost parses a [user@]host[:port] value, and returns the user ("" if not specified) and host[:port].
+func parseHost(s string) (string, string, error) {
+	if s == "" {
+		return "", "", errors.New("ssh: missing host name")
+	}
+	u, err := url.Parse("ssh://" + s)
+	if err != nil {
+		return "", "", fmt.Errorf("ssh: invalid host %q: %w", s, err)
+	}
+	if u.Hostname() == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.ForceQuery {
+		return "", "", fmt.Errorf("ssh: invalid host %q", s)
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return "", "", fmt.Errorf("ssh: host %q must not contain a password, use an SSH key or an agent instead", s)
+	}
+	return u.User.Username(), u.Host, nil
+}
+
+func (ref sshReference) Transport() types.ImageTransport {
+	return Transport
+}
+
+// userHost returns the [user@]host[:port] part of ref.
+func (ref sshReference) userHost() string {
+	if ref.user == "" {
+		return ref.host
+	}
+	return ref.user + "@" + ref.host
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref sshReference) StringWithinTransport() string {
+	return "//" + ref.userHost() + "/" + ref.imageName
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref sshReference) DockerReference() reference.Named {
+	return nil // The remote image name is only interpreted on the remote host.
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref sshReference) PolicyConfigurationIdentity() string {
+	return ref.userHost() + "/" + ref.imageName
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref sshReference) PolicyConfigurationNamespaces() []string {
+	transportName, _, _ := strings.Cut(ref.imageName, ":")
+	res := []string{ref.userHost() + "/" + transportName, ref.userHost()}
+	if ref.user != "" {
+		res = append(res, ref.host)
+	}
+	return res
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref sshReference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref sshReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref sshReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return newImageDestination(ctx, sys, ref)
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref sshReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	c, err := newClient(ctx, sys, ref)
+	if err != nil {
+		return err
+	}
+	defer c.close(ctx)
+	return c.doJSON(ctx, http.MethodPost, protocol.PathDelete, nil, nil, nil)
+}
@@ -0,0 +1,110 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "ssh", Transport.Name())
+}
+
+func TestTransportParseReference(t *testing.T) {
+	for _, c := range []struct{ input, user, host, imageName string }{
+		{"//example.com/containers-storage:busybox", "", "example.com", "containers-storage:busybox"},
+		{"//user@example.com:2222/dir:/var/tmp/image", "user", "example.com:2222", "dir:/var/tmp/image"},
+		{"//[::1]:2222/oci:/path:tag", "", "[::1]:2222", "oci:/path:tag"},
+		{"//example.com/dir:relative/path with spaces", "", "example.com", "dir:relative/path with spaces"},
+	} {
+		ref, err := Transport.ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		sshRef, ok := ref.(sshReference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.user, sshRef.user, c.input)
+		assert.Equal(t, c.host, sshRef.host, c.input)
+		assert.Equal(t, c.imageName, sshRef.imageName, c.input)
+	}
+
+	for _, input := range []string{
+		"",
+		"example.com/dir:/path",          // Missing //
+		"//example.com",                  // Missing image name
+		"//example.com/",                 // Empty image name
+		"///dir:/path",                   // Missing host
+		"//example.com/no-transport",     // Missing transport name
+		"//example.com/:/path",           // Empty transport name
+		"//user:pass@example.com/dir:/a", // Password
+		"//example.com?x/dir:/path",      // Query
+		"//%zz/dir:/path",                // Invalid escape
+	} {
+		_, err := Transport.ParseReference(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"example.com/containers-storage:busybox",
+		"user@example.com:2222/dir",
+		"example.com",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"/dir:/path",
+		"user:pass@example.com",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestReferenceStringWithinTransport(t *testing.T) {
+	for _, input := range []string{
+		"//example.com/containers-storage:busybox",
+		"//user@example.com:2222/dir:/var/tmp/image",
+	} {
+		ref, err := ParseReference(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, input, ref.StringWithinTransport(), input)
+		// Do one more round to verify that the output can be parsed, to an equal value.
+		ref2, err := Transport.ParseReference(ref.StringWithinTransport())
+		require.NoError(t, err, input)
+		assert.Equal(t, ref, ref2, input)
+	}
+}
+
+func TestReferenceDockerReference(t *testing.T) {
+	ref, err := ParseReference("//example.com/docker://busybox:latest")
+	require.NoError(t, err)
+	assert.Nil(t, ref.DockerReference())
+}
+
+func TestReferencePolicyConfigurationIdentity(t *testing.T) {
+	ref, err := ParseReference("//user@example.com:2222/dir:/var/tmp/image")
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com:2222/dir:/var/tmp/image", ref.PolicyConfigurationIdentity())
+	require.NoError(t, Transport.ValidatePolicyConfigurationScope(ref.PolicyConfigurationIdentity()))
+}
+
+func TestReferencePolicyConfigurationNamespaces(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		expected []string
+	}{
+		{"//example.com/containers-storage:busybox", []string{"example.com/containers-storage", "example.com"}},
+		{"//user@example.com:2222/dir:/path", []string{"user@example.com:2222/dir", "user@example.com:2222", "example.com:2222"}},
+	} {
+		ref, err := ParseReference(c.input)
+		require.NoError(t, err, c.input)
+		ns := ref.PolicyConfigurationNamespaces()
+		assert.Equal(t, c.expected, ns, c.input)
+		for _, scope := range ns {
+			assert.NoError(t, Transport.ValidatePolicyConfigurationScope(scope), scope)
+		}
+	}
+}
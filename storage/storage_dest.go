@@ -280,7 +280,8 @@ func (f *zstdFetcher) GetBlobAt(chunks []chunked.ImageSourceChunk) (chan io.Read
 		newChunks = append(newChunks, i)
 	}
 	rc, errs, err := f.chunkAccessor.GetBlobAt(f.ctx, f.blobInfo, newChunks)
-	if _, ok := err.(private.BadPartialRequestError); ok {
+	var badRequest private.BadPartialRequestError
+	if errors.As(err, &badRequest) {
 		err = chunked.ErrBadRequest{}
 	}
 	return rc, errs, err
@@ -503,6 +504,33 @@ func (s *storageImageDestination) tryReusingBlobAsPending(blobDigest digest.Dige
 				}, nil
 			}
 		}
+
+		// Do we know the uncompressed digest matching the TOC, and have a layer with that uncompressed digest?
+		// This allows reusing layers pulled without using the TOC, e.g. when copying a zstd:chunked image
+		// whose layers were previously pulled as gzip.
+		if uncompressedDigest := options.Cache.UncompressedDigestForTOC(options.TOCDigest); uncompressedDigest != "" {
+			layers, err := s.imageRef.transport.store.LayersByUncompressedDigest(uncompressedDigest)
+			if err != nil && !errors.Is(err, storage.ErrLayerUnknown) {
+				return false, private.ReusedBlob{}, fmt.Errorf(`looking for layers with digest %q: %w`, uncompressedDigest, err)
+			}
+			if len(layers) > 0 {
+				if size != -1 {
+					s.lockProtected.blobDiffIDs[blobDigest] = uncompressedDigest
+					return true, private.ReusedBlob{
+						Digest:             blobDigest,
+						Size:               size,
+						MatchedByTOCDigest: true,
+					}, nil
+				} else if options.CanSubstitute {
+					s.lockProtected.blobDiffIDs[uncompressedDigest] = uncompressedDigest
+					return true, private.ReusedBlob{
+						Digest:             uncompressedDigest,
+						Size:               layers[0].UncompressedSize,
+						MatchedByTOCDigest: true,
+					}, nil
+				}
+			}
+		}
 	}
 
 	// Nope, we don't have it.
@@ -5,11 +5,13 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errcategory"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
@@ -153,11 +155,14 @@ func (s *storageReference) resolveImage(sys *types.SystemContext) (*storage.Imag
 	}
 	if s.id == "" {
 		logrus.Debugf("reference %q does not resolve to an image ID", s.StringWithinTransport())
-		return nil, fmt.Errorf("reference %q does not resolve to an image ID: %w", s.StringWithinTransport(), ErrNoSuchImage)
+		return nil, fmt.Errorf("reference %q does not resolve to an image ID: %w%.0w", s.StringWithinTransport(), ErrNoSuchImage, types.ErrNotFound)
 	}
 	if loadedImage == nil {
 		img, err := s.transport.store.Image(s.id)
 		if err != nil {
+			if errors.Is(err, storage.ErrImageUnknown) {
+				err = errcategory.Wrap(err, types.ErrNotFound)
+			}
 			return nil, fmt.Errorf("reading image %q: %w", s.id, err)
 		}
 		loadedImage = img
@@ -165,7 +170,7 @@ func (s *storageReference) resolveImage(sys *types.SystemContext) (*storage.Imag
 	if s.named != nil {
 		if !imageMatchesRepo(loadedImage, s.named) {
 			logrus.Errorf("no image matching reference %q found", s.StringWithinTransport())
-			return nil, ErrNoSuchImage
+			return nil, errcategory.Wrap(ErrNoSuchImage, types.ErrNotFound)
 		}
 	}
 	// Default to having the image digest that we hand back match the most recently
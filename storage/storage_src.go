@@ -10,10 +10,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"sync"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errcategory"
 	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
@@ -143,6 +145,9 @@ func (s *storageImageSource) GetBlob(ctx context.Context, info types.BlobInfo, c
 	if len(layers) == 0 {
 		b, err := s.imageRef.transport.store.ImageBigData(s.image.ID, digest.String())
 		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				err = errcategory.Wrap(err, types.ErrBlobUnknown)
+			}
 			return nil, 0, err
 		}
 		r := bytes.NewReader(b)
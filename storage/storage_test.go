@@ -20,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/internal/blobinfocache"
 	imanifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/manifest"
@@ -704,6 +705,71 @@ func TestDuplicateBlob(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestTryReusingBlobByTOCUncompressedDigest(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+	layer := makeLayer(t, archive.Gzip)
+	configBytes := []byte(`{"config":{"labels":{}},"created":"2006-01-02T15:04:05Z"}`)
+	config := testBlob{
+		compressedDigest: digest.SHA256.FromBytes(configBytes),
+		uncompressedSize: int64(len(configBytes)),
+		compressedSize:   int64(len(configBytes)),
+		data:             configBytes,
+	}
+	createImage(t, ref, cache, []testBlob{layer}, &config)
+	layers, err := store.LayersByCompressedDigest(layer.compressedDigest)
+	require.NoError(t, err)
+	require.NotEmpty(t, layers)
+	diffID := layers[0].UncompressedDigest
+
+	otherBlobDigest := digest.FromString("a differently-compressed blob")
+	tocDigest := digest.FromString("a TOC")
+	for _, c := range []struct {
+		knownTOC      bool
+		size          int64
+		canSubstitute bool
+		reused        bool
+		expected      digest.Digest
+	}{
+		{knownTOC: false, size: 1234, canSubstitute: true, reused: false},
+		{knownTOC: true, size: 1234, canSubstitute: false, reused: true, expected: otherBlobDigest},
+		{knownTOC: true, size: -1, canSubstitute: true, reused: true, expected: diffID},
+		{knownTOC: true, size: -1, canSubstitute: false, reused: false},
+	} {
+		cache := blobinfocache.FromBlobInfoCache(memory.New())
+		if c.knownTOC {
+			cache.RecordTOCUncompressedPair(tocDigest, diffID)
+		}
+		dest, err := ref.NewImageDestination(context.Background(), nil)
+		require.NoError(t, err)
+		dest2, ok := dest.(*storageImageDestination)
+		require.True(t, ok)
+		layerIndex := 0
+		reused, info, err := dest2.TryReusingBlobWithOptions(context.Background(), types.BlobInfo{
+			Digest: otherBlobDigest,
+			Size:   c.size,
+		}, private.TryReusingBlobOptions{
+			Cache:         cache,
+			CanSubstitute: c.canSubstitute,
+			LayerIndex:    &layerIndex,
+			TOCDigest:     tocDigest,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, c.reused, reused)
+		if c.reused {
+			assert.Equal(t, c.expected, info.Digest)
+			assert.True(t, info.MatchedByTOCDigest)
+		}
+		err = dest.Close()
+		require.NoError(t, err)
+	}
+}
+
 type unparsedImage struct {
 	imageReference types.ImageReference
 	manifestBytes  []byte
@@ -1,6 +1,10 @@
 // Package tarball provides a way to generate images using one or more layer
 // tarballs and an optional template configuration.
 //
+// Layer tarballs may be uncompressed, or compressed using gzip or zstd.
+// If the history in the template configuration has one entry per layer,
+// the entries are used as the histories of the individual layers.
+//
 // An example:
 //
 //	package main
@@ -0,0 +1,87 @@
+package tarball
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ConfigOverrider is an interface that ImageReferences for "tarball" images also
+// implement.  It can be used to override individual values of the configuration
+// and annotations set using ConfigUpdater, without having to modify the images
+// returned by the reference's NewImage() or NewImageSource() methods afterwards.
+type ConfigOverrider interface {
+	ConfigOverride(overrides ConfigOverrides) error
+}
+
+// ConfigOverrides contains values which override the corresponding parts of the
+// image configuration and manifest annotations of a "tarball" image.
+// Zero values leave the corresponding parts unchanged.
+type ConfigOverrides struct {
+	OS           string            // The operating system of the image, instead of the default runtime.GOOS
+	Architecture string            // The CPU architecture of the image, instead of the default runtime.GOARCH
+	Variant      string            // The CPU architecture variant of the image
+	Annotations  map[string]string // Manifest annotations, added to (or replacing) existing ones
+	Labels       map[string]string // Configuration labels, added to (or replacing) existing ones
+	Env          []string          // "NAME=value" environment variables, added to (or replacing values of) existing ones
+	Entrypoint   []string          // If not nil, the entrypoint of the image
+}
+
+// ConfigOverride records overrides to be applied to the image's configuration and annotations,
+// after the values set by ConfigUpdate.  If called several times, the overrides are applied in order.
+func (r *tarballReference) ConfigOverride(overrides ConfigOverrides) error {
+	for _, env := range overrides.Env {
+		if name, _, ok := strings.Cut(env, "="); !ok || name == "" {
+			return fmt.Errorf("invalid environment variable %q, expected NAME=value", env)
+		}
+	}
+	r.overrides = append(r.overrides, ConfigOverrides{
+		OS:           overrides.OS,
+		Architecture: overrides.Architecture,
+		Variant:      overrides.Variant,
+		Annotations:  maps.Clone(overrides.Annotations),
+		Labels:       maps.Clone(overrides.Labels),
+		Env:          slices.Clone(overrides.Env),
+		Entrypoint:   slices.Clone(overrides.Entrypoint),
+	})
+	return nil
+}
+
+// applyConfigOverrides applies overrides to config and annotations.
+// config must not share any slices or maps with other values; annotations must not be nil.
+func applyConfigOverrides(config *imgspecv1.Image, annotations map[string]string, overrides ConfigOverrides) {
+	if overrides.OS != "" {
+		config.OS = overrides.OS
+	}
+	if overrides.Architecture != "" {
+		config.Architecture = overrides.Architecture
+	}
+	if overrides.Variant != "" {
+		config.Variant = overrides.Variant
+	}
+	maps.Copy(annotations, overrides.Annotations)
+	if len(overrides.Labels) != 0 {
+		if config.Config.Labels == nil {
+			config.Config.Labels = map[string]string{}
+		}
+		maps.Copy(config.Config.Labels, overrides.Labels)
+	}
+	for _, env := range overrides.Env {
+		name, _, _ := strings.Cut(env, "=")
+		i := slices.IndexFunc(config.Config.Env, func(e string) bool {
+			n, _, _ := strings.Cut(e, "=")
+			return n == name
+		})
+		if i == -1 {
+			config.Config.Env = append(config.Config.Env, env)
+		} else {
+			config.Config.Env[i] = env
+		}
+	}
+	if overrides.Entrypoint != nil {
+		config.Config.Entrypoint = overrides.Entrypoint
+	}
+}
@@ -24,6 +24,7 @@ type ConfigUpdater interface {
 type tarballReference struct {
 	config      imgspecv1.Image
 	annotations map[string]string
+	overrides   []ConfigOverrides
 	filenames   []string
 	stdin       []byte
 }
@@ -9,13 +9,15 @@ import (
 	"maps"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
-	"github.com/klauspost/pgzip"
 	digest "github.com/opencontainers/go-digest"
 	imgspecs "github.com/opencontainers/image-spec/specs-go"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -46,6 +48,10 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 	if len(r.config.History) > 0 && r.config.History[0].Comment != "" {
 		comment = r.config.History[0].Comment
 	}
+	// If the configuration's history list has one entry per layer, use the entries as the layers' individual histories.
+	layerHistories := len(r.config.History) == len(r.filenames) && !slices.ContainsFunc(r.config.History, func(h imgspecv1.History) bool {
+		return h.EmptyLayer
+	})
 
 	// Gather up the digests, sizes, and history information for all of the files.
 	blobs := map[digest.Digest]tarballBlob{}
@@ -53,7 +59,7 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 	created := time.Time{}
 	history := []imgspecv1.History{}
 	layerDescriptors := []imgspecv1.Descriptor{}
-	for _, filename := range r.filenames {
+	for i, filename := range r.filenames {
 		var reader io.Reader
 		var blobTime time.Time
 		var blob tarballBlob
@@ -82,32 +88,46 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 			}
 		}
 
-		// Default to assuming the layer is compressed.
-		layerType := imgspecv1.MediaTypeImageLayerGzip
-
 		// Set up to digest the file as it is.
 		blobIDdigester := digest.Canonical.Digester()
 		reader = io.TeeReader(reader, blobIDdigester.Hash())
 
 		// Set up to digest the file after we maybe decompress it.
+		algo, decompressor, reader, err := compression.DetectCompressionFormat(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error detecting compression of %q: %w", filename, err)
+		}
+		var layerType string
+		var uncompressed io.ReadCloser
 		diffIDdigester := digest.Canonical.Digester()
-		uncompressed, err := pgzip.NewReader(reader)
-		if err == nil {
-			// It is compressed, so the diffID is the digest of the uncompressed version
-			reader = io.TeeReader(uncompressed, diffIDdigester.Hash())
-		} else {
+		if decompressor == nil {
 			// It is not compressed, so the diffID and the blobID are going to be the same
 			diffIDdigester = blobIDdigester
 			layerType = imgspecv1.MediaTypeImageLayer
-			uncompressed = nil
+		} else {
+			switch algo.Name() {
+			case compressiontypes.GzipAlgorithmName:
+				layerType = imgspecv1.MediaTypeImageLayerGzip
+			case compressiontypes.ZstdAlgorithmName, compressiontypes.ZstdChunkedAlgorithmName:
+				layerType = imgspecv1.MediaTypeImageLayerZstd
+			default:
+				return nil, fmt.Errorf("%q is compressed using %s, which is not supported in OCI images", filename, algo.Name())
+			}
+			// It is compressed, so the diffID is the digest of the uncompressed version
+			uncompressed, err = decompressor(reader)
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing %q: %w", filename, err)
+			}
+			reader = io.TeeReader(uncompressed, diffIDdigester.Hash())
 		}
 		// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
-		if _, err := io.Copy(io.Discard, reader); err != nil {
-			return nil, fmt.Errorf("error reading %q: %v", filename, err)
-		}
+		_, err = io.Copy(io.Discard, reader)
 		if uncompressed != nil {
 			uncompressed.Close()
 		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %q: %v", filename, err)
+		}
 
 		// Grab our uncompressed and possibly-compressed digests and sizes.
 		diffID := diffIDdigester.Digest()
@@ -115,11 +135,20 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 		diffIDs = append(diffIDs, diffID)
 		blobs[blobID] = blob
 
-		history = append(history, imgspecv1.History{
-			Created:   &blobTime,
-			CreatedBy: fmt.Sprintf("/bin/sh -c #(nop) ADD file:%s in %c", diffID.Encoded(), os.PathSeparator),
-			Comment:   comment,
-		})
+		layerHistory := imgspecv1.History{Comment: comment}
+		if layerHistories {
+			layerHistory = r.config.History[i]
+			if layerHistory.Comment == "" {
+				layerHistory.Comment = "imported from tarball"
+			}
+		}
+		if layerHistory.Created == nil {
+			layerHistory.Created = &blobTime
+		}
+		if layerHistory.CreatedBy == "" {
+			layerHistory.CreatedBy = fmt.Sprintf("/bin/sh -c #(nop) ADD file:%s in %c", diffID.Encoded(), os.PathSeparator)
+		}
+		history = append(history, layerHistory)
 		// Use the mtime of the most recently modified file as the image's creation time.
 		if created.Before(blobTime) {
 			created = blobTime
@@ -132,8 +161,20 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 		})
 	}
 
-	// Pick up other defaults from the config in the reference.
+	// Pick up other defaults from the config in the reference, and apply any overrides.
 	config := r.config
+	annotations := maps.Clone(r.annotations)
+	if len(r.overrides) != 0 {
+		// Don't modify the maps and slices shared with r.config.
+		config.Config.Labels = maps.Clone(config.Config.Labels)
+		config.Config.Env = slices.Clone(config.Config.Env)
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		for _, o := range r.overrides {
+			applyConfigOverrides(&config, annotations, o)
+		}
+	}
 	if config.Created == nil {
 		config.Created = &created
 	}
@@ -171,7 +212,7 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 			MediaType: imgspecv1.MediaTypeImageConfig,
 		},
 		Layers:      layerDescriptors,
-		Annotations: maps.Clone(r.annotations),
+		Annotations: annotations,
 	}
 
 	// Encode the manifest.
@@ -206,7 +247,7 @@ func (is *tarballImageSource) Close() error {
 func (is *tarballImageSource) GetBlob(ctx context.Context, blobinfo types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
 	blob, ok := is.blobs[blobinfo.Digest]
 	if !ok {
-		return nil, -1, fmt.Errorf("no blob with digest %q found", blobinfo.Digest.String())
+		return nil, -1, fmt.Errorf("no blob with digest %q found%.0w", blobinfo.Digest.String(), types.ErrBlobUnknown)
 	}
 	if blob.contents != nil {
 		return io.NopCloser(bytes.NewReader(blob.contents)), int64(len(blob.contents)), nil
@@ -1,5 +1,137 @@
 package tarball
 
-import "github.com/containers/image/v5/internal/private"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
 var _ private.ImageSource = (*tarballImageSource)(nil)
+
+func TestConfigOverride(t *testing.T) {
+	layerPath := filepath.Join(t.TempDir(), "layer.tar")
+	err := os.WriteFile(layerPath, []byte("not really a tarball"), 0644)
+	require.NoError(t, err)
+	ref, err := Transport.ParseReference(layerPath)
+	require.NoError(t, err)
+
+	err = ref.(ConfigUpdater).ConfigUpdate(imgspecv1.Image{
+		Config: imgspecv1.ImageConfig{
+			Env:        []string{"PATH=/bin", "HOME=/root"},
+			Entrypoint: []string{"/bin/sh"},
+			Labels:     map[string]string{"a": "1"},
+		},
+	}, map[string]string{"original": "yes"})
+	require.NoError(t, err)
+	overrider, ok := ref.(ConfigOverrider)
+	require.True(t, ok)
+	err = overrider.ConfigOverride(ConfigOverrides{Env: []string{"invalid"}})
+	assert.Error(t, err)
+	err = overrider.ConfigOverride(ConfigOverrides{
+		OS:           "linux",
+		Architecture: "arm64",
+		Variant:      "v8",
+		Annotations:  map[string]string{"added": "yes"},
+		Labels:       map[string]string{"a": "2", "b": "3"},
+		Env:          []string{"PATH=/usr/bin:/bin", "LANG=C"},
+		Entrypoint:   []string{"/init"},
+	})
+	require.NoError(t, err)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	manifestBytes, _, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	var m imgspecv1.Manifest
+	err = json.Unmarshal(manifestBytes, &m)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"original": "yes", "added": "yes"}, m.Annotations)
+
+	rc, _, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: m.Config.Digest, Size: m.Config.Size}, memory.New())
+	require.NoError(t, err)
+	configBytes, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	rc.Close()
+	var config imgspecv1.Image
+	err = json.Unmarshal(configBytes, &config)
+	require.NoError(t, err)
+	assert.Equal(t, "linux", config.OS)
+	assert.Equal(t, "arm64", config.Architecture)
+	assert.Equal(t, "v8", config.Variant)
+	assert.Equal(t, map[string]string{"a": "2", "b": "3"}, config.Config.Labels)
+	assert.Equal(t, []string{"PATH=/usr/bin:/bin", "HOME=/root", "LANG=C"}, config.Config.Env)
+	assert.Equal(t, []string{"/init"}, config.Config.Entrypoint)
+
+	// The configuration set using ConfigUpdate is not modified.
+	tr := ref.(*tarballReference)
+	assert.Equal(t, map[string]string{"a": "1"}, tr.config.Config.Labels)
+	assert.Equal(t, []string{"PATH=/bin", "HOME=/root"}, tr.config.Config.Env)
+	assert.Equal(t, map[string]string{"original": "yes"}, tr.annotations)
+}
+
+func TestCompressedLayers(t *testing.T) {
+	tmpDir := t.TempDir()
+	contents := []byte("not really a tarball")
+	paths := []string{}
+	for _, algo := range []compression.Algorithm{compression.Gzip, compression.Zstd} {
+		var buf bytes.Buffer
+		compressor, err := compression.CompressStream(&buf, algo, nil)
+		require.NoError(t, err)
+		_, err = compressor.Write(contents)
+		require.NoError(t, err)
+		require.NoError(t, compressor.Close())
+		path := filepath.Join(tmpDir, "layer-"+algo.Name())
+		err = os.WriteFile(path, buf.Bytes(), 0644)
+		require.NoError(t, err)
+		paths = append(paths, path)
+	}
+	ref, err := Transport.ParseReference(strings.Join(paths, ":"))
+	require.NoError(t, err)
+	err = ref.(ConfigUpdater).ConfigUpdate(imgspecv1.Image{
+		History: []imgspecv1.History{{CreatedBy: "first", Author: "a"}, {Comment: "second"}},
+	}, nil)
+	require.NoError(t, err)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	manifestBytes, _, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	var m imgspecv1.Manifest
+	err = json.Unmarshal(manifestBytes, &m)
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 2)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, m.Layers[0].MediaType)
+	assert.Equal(t, imgspecv1.MediaTypeImageLayerZstd, m.Layers[1].MediaType)
+
+	rc, _, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: m.Config.Digest, Size: m.Config.Size}, memory.New())
+	require.NoError(t, err)
+	configBytes, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	rc.Close()
+	var config imgspecv1.Image
+	err = json.Unmarshal(configBytes, &config)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(contents), digest.FromBytes(contents)}, config.RootFS.DiffIDs)
+	require.Len(t, config.History, 2)
+	assert.Equal(t, "first", config.History[0].CreatedBy)
+	assert.Equal(t, "a", config.History[0].Author)
+	assert.Equal(t, "imported from tarball", config.History[0].Comment)
+	assert.Equal(t, "second", config.History[1].Comment)
+	assert.Contains(t, config.History[1].CreatedBy, "ADD file:")
+}
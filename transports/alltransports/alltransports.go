@@ -10,13 +10,17 @@ import (
 	// Register all known transports.
 	// NOTE: Make sure docs/containers-transports.5.md and docs/containers-policy.json.5.md are updated when adding or updating
 	// a transport.
+	_ "github.com/containers/image/v5/containerd"
 	_ "github.com/containers/image/v5/directory"
 	_ "github.com/containers/image/v5/docker"
 	_ "github.com/containers/image/v5/docker/archive"
 	_ "github.com/containers/image/v5/oci/archive"
+	_ "github.com/containers/image/v5/oci/https"
 	_ "github.com/containers/image/v5/oci/layout"
+	_ "github.com/containers/image/v5/oci/s3"
 	_ "github.com/containers/image/v5/openshift"
 	_ "github.com/containers/image/v5/sif"
+	_ "github.com/containers/image/v5/ssh"
 	_ "github.com/containers/image/v5/tarball"
 	// The docker-daemon transport is registeredy by docker_daemon*.go
 	// The ostree transport is registered by ostree*.go
@@ -27,7 +27,11 @@ func TestParseImageName(t *testing.T) {
 func TestImageNameHandling(t *testing.T) {
 	// Always registered transports
 	for _, c := range []struct{ transport, input, roundtrip string }{
+		{"containerd", "busybox", "[default]docker.io/library/busybox:latest"},
+		{"containerd", "[k8s.io]example.com/ns/foo:bar", "[k8s.io]example.com/ns/foo:bar"},
 		{"dir", "/etc", "/etc"},
+		{"dir", "/etc#busybox", "/etc#busybox"},
+		{"dir-index", "/etc#busybox", "/etc#busybox"},
 		{"docker", "//busybox", "//busybox:latest"},
 		{"docker", "//busybox:notlatest", "//busybox:notlatest"}, // This also tests handling of multiple ":" characters
 		{"docker-archive", "/var/lib/oci/busybox.tar:busybox:latest", "/var/lib/oci/busybox.tar:docker.io/library/busybox:latest"},
@@ -36,6 +40,12 @@ func TestImageNameHandling(t *testing.T) {
 		{"oci", "/etc:someimage:mytag", "/etc:someimage:mytag"},
 		{"oci-archive", "/etc:someimage", "/etc:someimage"},
 		{"oci-archive", "/etc:someimage:mytag", "/etc:someimage:mytag"},
+		{"oci-https", "//example.com/layout:someimage", "//example.com/layout:someimage"},
+		{"oci-https", "//example.com:8443", "//example.com:8443/:"},
+		{"s3", "//bucket/prefix:someimage", "//bucket/prefix:someimage"},
+		{"s3", "//bucket:someimage:mytag", "//bucket:someimage:mytag"},
+		{"ssh", "//example.com/containers-storage:busybox", "//example.com/containers-storage:busybox"},
+		{"ssh", "//user@example.com:2222/dir:/var/tmp/image", "//user@example.com:2222/dir:/var/tmp/image"},
 		// "atomic" not tested here because it depends on per-user configuration for the default cluster.
 		// "containers-storage" not tested here because it needs to initialize various directories on the fs.
 	} {
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors which categorize failures reported by transports, independently of the transport and of the
+// text of the error. Transports wrap the errors they return so that errors.Is(err, ErrX) is true for the matching
+// category, without changing the error text; transport-specific details remain available using errors.As.
+// Not all failures fall into one of these categories.
+var (
+	// ErrUnauthorized matches failures caused by missing or rejected credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrDenied matches failures caused by the credentials (or anonymous access) not allowing the operation.
+	ErrDenied = errors.New("access denied")
+	// ErrNotFound matches failures caused by an image, repository, or another object not existing.
+	ErrNotFound = errors.New("not found")
+	// ErrManifestUnknown matches failures caused by a manifest not existing.
+	// Errors matching ErrManifestUnknown also match ErrNotFound.
+	ErrManifestUnknown = fmt.Errorf("manifest unknown: %w", ErrNotFound)
+	// ErrBlobUnknown matches failures caused by a blob not existing.
+	// Errors matching ErrBlobUnknown also match ErrNotFound.
+	ErrBlobUnknown = fmt.Errorf("blob unknown: %w", ErrNotFound)
+	// ErrManifestInvalid matches failures caused by a manifest which is malformed, or rejected as invalid by a server.
+	ErrManifestInvalid = errors.New("manifest invalid")
+	// ErrRateLimited matches failures caused by a server refusing requests because too many were made.
+	ErrRateLimited = errors.New("rate limited")
+)